@@ -0,0 +1,24 @@
+// Package adapters registers all of the source, destination, and state store adapters, the AWS SES alert email
+// sender, and the AWS Secrets Manager secret provider. Programs that only need some adapters may import those
+// packages directly instead, to avoid the dependencies of the others.
+package adapters
+
+import (
+	// Register the adapters
+	_ "github.com/silinternational/personnel-sync/v5/atlassian"
+	_ "github.com/silinternational/personnel-sync/v5/awsidentity"
+	_ "github.com/silinternational/personnel-sync/v5/awssecrets"
+	_ "github.com/silinternational/personnel-sync/v5/awsstate"
+	_ "github.com/silinternational/personnel-sync/v5/github"
+	_ "github.com/silinternational/personnel-sync/v5/google"
+	_ "github.com/silinternational/personnel-sync/v5/keycloak"
+	_ "github.com/silinternational/personnel-sync/v5/mailchimp"
+	_ "github.com/silinternational/personnel-sync/v5/microsoft"
+	_ "github.com/silinternational/personnel-sync/v5/restapi"
+	_ "github.com/silinternational/personnel-sync/v5/sesalert"
+	_ "github.com/silinternational/personnel-sync/v5/sftpfile"
+	_ "github.com/silinternational/personnel-sync/v5/sqldb"
+	_ "github.com/silinternational/personnel-sync/v5/webhelpdesk"
+	_ "github.com/silinternational/personnel-sync/v5/webhook"
+	_ "github.com/silinternational/personnel-sync/v5/workday"
+)
@@ -4,11 +4,6 @@ import (
 	"fmt"
 	"log"
 	"strings"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ses"
 )
 
 type Config struct {
@@ -19,29 +14,77 @@ type Config struct {
 	RecipientEmails    []string
 	AWSAccessKeyID     string
 	AWSSecretAccessKey string
+
+	// Locale selects the language of the default templates: en (the default), es, or fr
+	Locale string
+
+	// Templates overrides the default templates by name, using Go text/template syntax
+	Templates map[string]string
+
+	// SMTP is used to send alerts if its Host is set. Otherwise, alerts are sent through AWS SES.
+	SMTP SMTPConfig
+
+	PagerDuty PagerDutyConfig
+
+	Policy Policy
 }
 
-func SendEmail(config Config, body string) {
-	charSet := config.CharSet
+// Policy reduces the number of alert emails. It requires a state store to remember previous runs.
+type Policy struct {
+	// ConsecutiveFailures only alerts for a sync set once it has failed this many runs in a row
+	ConsecutiveFailures int
 
-	subject := config.SubjectText
-	subjContent := ses.Content{
-		Charset: &charSet,
-		Data:    &subject,
-	}
+	// DigestHours collects alerts and warnings into one digest email sent at most once in this many hours,
+	// instead of one email per alert. Zero disables digest mode.
+	DigestHours int
+}
 
-	msgContent := ses.Content{
-		Charset: &charSet,
-		Data:    &body,
+// Validate checks that the Locale is supported, that all configured Templates can be parsed, and that the SMTP
+// configuration is complete
+func (c Config) Validate() error {
+	switch c.SMTP.Security {
+	case "", SMTPSecurityStartTLS, SMTPSecurityTLS, SMTPSecurityNone:
+	default:
+		return fmt.Errorf("invalid SMTP Security %q", c.SMTP.Security)
+	}
+	if c.SMTP.Host != "" && c.ReturnToAddr == "" {
+		return fmt.Errorf("ReturnToAddr is required to send alerts through SMTP")
 	}
+	if err := c.PagerDuty.validate(); err != nil {
+		return err
+	}
+
+	return c.validateTemplates()
+}
+
+// SendAlert renders the named template with the given data and sends it as an email
+func SendAlert(config Config, templateName string, data interface{}) {
+	SendEmail(config, config.Render(templateName, data))
+}
+
+// EmailSender sends an alert email to one recipient
+type EmailSender func(config Config, recipient, subject, body string) error
 
-	msgBody := ses.Body{
-		Text: &msgContent,
+var emailSender EmailSender
+
+// RegisterEmailSender sets the sender of alert emails that are not sent through SMTP, such as AWS SES. The sender
+// package calls it from init, so a program only includes the email dependencies it imports.
+func RegisterEmailSender(sender EmailSender) {
+	emailSender = sender
+}
+
+// SendEmail sends the body to each of the RecipientEmails, through SMTP if its Host is set, or else through the
+// registered EmailSender
+func SendEmail(config Config, body string) {
+	subject := config.SubjectText
+	if subject == "" {
+		subject = config.Render(TemplateSubject, nil)
 	}
 
-	emailMsg := ses.Message{}
-	emailMsg.SetSubject(&subjContent)
-	emailMsg.SetBody(&msgBody)
+	if config.SMTP.Host == "" && emailSender == nil && len(config.RecipientEmails) > 0 {
+		log.Printf("Unable to send alert email: SMTP is not configured and no email sender is registered")
+		return
+	}
 
 	// Only report the last email error
 	lastError := ""
@@ -49,7 +92,12 @@ func SendEmail(config Config, body string) {
 
 	// Send emails to one recipient at a time to avoid one bad email sabotaging it all
 	for _, address := range config.RecipientEmails {
-		err := sendAnEmail(emailMsg, address, config)
+		var err error
+		if config.SMTP.Host != "" {
+			err = sendSMTPEmail(config, address, subject, body)
+		} else {
+			err = emailSender(config, address, subject, body)
+		}
 		if err != nil {
 			lastError = err.Error()
 			badRecipients = append(badRecipients, address)
@@ -62,32 +110,3 @@ func SendEmail(config Config, body string) {
 			config.ReturnToAddr, addresses, lastError)
 	}
 }
-
-func sendAnEmail(emailMsg ses.Message, recipient string, config Config) error {
-	recipients := []*string{&recipient}
-
-	input := &ses.SendEmailInput{
-		Destination: &ses.Destination{
-			ToAddresses: recipients,
-		},
-		Message: &emailMsg,
-		Source:  aws.String(config.ReturnToAddr),
-	}
-
-	cfg := &aws.Config{Region: aws.String(config.AWSRegion)}
-	if config.AWSAccessKeyID != "" && config.AWSSecretAccessKey != "" {
-		cfg.Credentials = credentials.NewStaticCredentials(config.AWSAccessKeyID, config.AWSSecretAccessKey, "")
-	}
-	sess, err := session.NewSession(cfg)
-	if err != nil {
-		return fmt.Errorf("error creating AWS session: %s", err)
-	}
-
-	svc := ses.New(sess)
-	result, err := svc.SendEmail(input)
-	if err != nil {
-		return fmt.Errorf("error sending email, result: %s, error: %s", result, err)
-	}
-	log.Printf("alert message sent to %s, message ID: %s", recipient, *result.MessageId)
-	return nil
-}
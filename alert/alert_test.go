@@ -0,0 +1,23 @@
+package alert
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSendEmail_RegisteredSender(t *testing.T) {
+	defer RegisterEmailSender(emailSender)
+
+	var sent []string
+	RegisterEmailSender(func(config Config, recipient, subject, body string) error {
+		sent = append(sent, recipient+": "+subject+": "+body)
+		return nil
+	})
+
+	SendEmail(Config{SubjectText: "Sync alert", RecipientEmails: []string{"a@example.org", "b@example.org"}}, "failed")
+
+	want := []string{"a@example.org: Sync alert: failed", "b@example.org: Sync alert: failed"}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("SendEmail() sent %v, want %v", sent, want)
+	}
+}
@@ -0,0 +1,93 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Owner is the team responsible for a sync set. Alerts about the sync set are sent to its owner as well as to the
+// RecipientEmails.
+type Owner struct {
+	// Name identifies the owner in the log, such as "HR Systems"
+	Name string
+
+	// Emails are sent alerts about the sync set, unless they are also RecipientEmails
+	Emails []string
+
+	// SlackWebhookURL is a Slack incoming webhook, which posts alerts about the sync set to the owner's channel
+	SlackWebhookURL string
+}
+
+// IsSet returns true if alerts can be sent to the owner
+func (o Owner) IsSet() bool {
+	return len(o.Emails) > 0 || o.SlackWebhookURL != ""
+}
+
+// SendOwnerAlert renders the named template with the given data and sends it to the owner's Emails and Slack
+// channel
+func SendOwnerAlert(config Config, owner Owner, templateName string, data interface{}) {
+	body := config.Render(templateName, data)
+
+	global := map[string]bool{}
+	for _, address := range config.RecipientEmails {
+		global[address] = true
+	}
+	var emails []string
+	for _, address := range owner.Emails {
+		if !global[address] {
+			emails = append(emails, address)
+		}
+	}
+	owner.Emails = emails
+	sendToOwner(config, owner, body)
+}
+
+// SendPrivateAlert renders the named template with the given data and sends it only to the owner's Emails and Slack
+// channel, never to the RecipientEmails, for alerts that contain confidential data such as passwords
+func SendPrivateAlert(config Config, owner Owner, templateName string, data interface{}) {
+	sendToOwner(config, owner, config.Render(templateName, data))
+}
+
+func sendToOwner(config Config, owner Owner, body string) {
+	if len(owner.Emails) > 0 {
+		config.RecipientEmails = owner.Emails
+		SendEmail(config, body)
+	}
+
+	if owner.SlackWebhookURL != "" {
+		subject := config.SubjectText
+		if subject == "" {
+			subject = config.Render(TemplateSubject, nil)
+		}
+		if err := sendSlackMessage(owner.SlackWebhookURL, subject+"\n"+body); err != nil {
+			log.Printf("error sending Slack alert to %s: %s", owner.Name, err)
+		}
+	}
+}
+
+func sendSlackMessage(webhookURL, text string) error {
+	body, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{text})
+	if err != nil {
+		return fmt.Errorf("unable to marshal Slack message: %s", err)
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s", resp.Status, respBody)
+	}
+	return nil
+}
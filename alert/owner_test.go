@@ -0,0 +1,36 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSendOwnerAlert(t *testing.T) {
+	var messages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var message struct{ Text string }
+		if err := json.NewDecoder(req.Body).Decode(&message); err != nil {
+			t.Errorf("invalid Slack message: %s", err)
+		}
+		messages = append(messages, message.Text)
+	}))
+	defer server.Close()
+
+	owner := Owner{Name: "HR Systems", SlackWebhookURL: server.URL}
+	SendOwnerAlert(Config{SubjectText: "Sync alert"}, owner, TemplateSyncErrors,
+		ErrorsData{Errors: []string{"staff failed"}})
+	SendOwnerAlert(Config{}, Owner{}, TemplateSyncErrors, ErrorsData{Errors: []string{"not sent"}})
+
+	if len(messages) != 1 {
+		t.Fatalf("got %v messages, want 1", len(messages))
+	}
+	if !strings.HasPrefix(messages[0], "Sync alert\n") || !strings.Contains(messages[0], "staff failed") {
+		t.Errorf("message = %q", messages[0])
+	}
+	if !owner.IsSet() || (Owner{Name: "nobody"}).IsSet() {
+		t.Error("IsSet() is wrong")
+	}
+}
@@ -0,0 +1,136 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+const DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+const (
+	pagerDutyTrigger = "trigger"
+	pagerDutyResolve = "resolve"
+)
+
+// PagerDutyConfig enables PagerDuty incidents for failing sync sets through the Events API v2
+type PagerDutyConfig struct {
+	// RoutingKey is the integration key of a PagerDuty service. PagerDuty is not used if it is empty.
+	RoutingKey string
+
+	// ErrorThreshold triggers an incident when a sync set has at least this many errors. Zero only triggers
+	// incidents for sync sets that fail entirely.
+	ErrorThreshold int
+
+	// Severity of triggered incidents: critical, error (the default), warning, or info
+	Severity string
+
+	// AutoResolve resolves the incident for a sync set when it next completes without exceeding the threshold
+	AutoResolve bool
+
+	URL string
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary  string `json:"summary"`
+	Source   string `json:"source"`
+	Severity string `json:"severity"`
+}
+
+// TriggerIncident triggers a PagerDuty incident for the sync set. Repeated triggers for the same sync set are
+// deduplicated by PagerDuty into one incident.
+func TriggerIncident(config Config, syncSetName, summary string) {
+	p := config.PagerDuty
+	if p.RoutingKey == "" {
+		return
+	}
+
+	severity := p.Severity
+	if severity == "" {
+		severity = "error"
+	}
+	source, _ := os.Hostname()
+	if source == "" {
+		source = "personnel-sync"
+	}
+
+	// PagerDuty limits the summary to 1024 characters
+	if len(summary) > 1024 {
+		summary = summary[:1021] + "..."
+	}
+
+	sendPagerDutyEvent(p, pagerDutyEvent{
+		RoutingKey:  p.RoutingKey,
+		EventAction: pagerDutyTrigger,
+		DedupKey:    pagerDutyDedupKey(syncSetName),
+		Payload:     &pagerDutyPayload{Summary: summary, Source: source, Severity: severity},
+	})
+}
+
+// ResolveIncident resolves the PagerDuty incident for the sync set, if AutoResolve is enabled
+func ResolveIncident(config Config, syncSetName string) {
+	p := config.PagerDuty
+	if p.RoutingKey == "" || !p.AutoResolve {
+		return
+	}
+
+	sendPagerDutyEvent(p, pagerDutyEvent{
+		RoutingKey:  p.RoutingKey,
+		EventAction: pagerDutyResolve,
+		DedupKey:    pagerDutyDedupKey(syncSetName),
+	})
+}
+
+func pagerDutyDedupKey(syncSetName string) string {
+	return "personnel-sync/" + syncSetName
+}
+
+func sendPagerDutyEvent(config PagerDutyConfig, event pagerDutyEvent) {
+	url := config.URL
+	if url == "" {
+		url = DefaultPagerDutyURL
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("unable to marshal PagerDuty event: %s", err)
+		return
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("error sending PagerDuty %s event for %s: %s", event.EventAction, event.DedupKey, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusAccepted {
+		log.Printf("PagerDuty %s event for %s failed: %s %s", event.EventAction, event.DedupKey, resp.Status,
+			respBody)
+		return
+	}
+	log.Printf("PagerDuty %s event sent for %s", event.EventAction, event.DedupKey)
+}
+
+func (p PagerDutyConfig) validate() error {
+	switch p.Severity {
+	case "", "critical", "error", "warning", "info":
+	default:
+		return fmt.Errorf("invalid PagerDuty Severity %q", p.Severity)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPagerDutyEvents(t *testing.T) {
+	var events []pagerDutyEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var event pagerDutyEvent
+		if err := json.NewDecoder(req.Body).Decode(&event); err != nil {
+			t.Errorf("invalid PagerDuty event: %s", err)
+		}
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	config := Config{PagerDuty: PagerDutyConfig{RoutingKey: "key", URL: server.URL, AutoResolve: true}}
+	TriggerIncident(config, "set1", "Sync failed")
+	ResolveIncident(config, "set1")
+
+	config.PagerDuty.AutoResolve = false
+	ResolveIncident(config, "set1")
+
+	TriggerIncident(Config{}, "set1", "not sent without a routing key")
+
+	if len(events) != 2 {
+		t.Fatalf("got %v events, want 2", len(events))
+	}
+	if events[0].EventAction != pagerDutyTrigger || events[0].DedupKey != "personnel-sync/set1" {
+		t.Errorf("first event = %+v, want trigger for set1", events[0])
+	}
+	wantPayload := pagerDutyPayload{Summary: "Sync failed", Source: events[0].Payload.Source, Severity: "error"}
+	if !reflect.DeepEqual(*events[0].Payload, wantPayload) {
+		t.Errorf("payload = %+v, want %+v", *events[0].Payload, wantPayload)
+	}
+	if events[1].EventAction != pagerDutyResolve || events[1].DedupKey != events[0].DedupKey || events[1].Payload != nil {
+		t.Errorf("second event = %+v, want resolve with same dedup key", events[1])
+	}
+}
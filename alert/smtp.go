@@ -0,0 +1,116 @@
+package alert
+
+import (
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SMTPSecurityStartTLS = "starttls"
+	SMTPSecurityTLS      = "tls"
+	SMTPSecurityNone     = "none"
+
+	DefaultSMTPPort = 587
+)
+
+// SMTPConfig configures sending alerts through an SMTP server instead of AWS SES
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+
+	// Security is starttls (the default), tls for implicit TLS (usually port 465), or none
+	Security string
+
+	// InsecureSkipVerify disables verification of the server certificate. Only use this for testing.
+	InsecureSkipVerify bool
+}
+
+// sendSMTPEmail sends one message to one recipient through the configured SMTP server
+func sendSMTPEmail(config Config, recipient, subject, body string) error {
+	s := config.SMTP
+	port := s.Port
+	if port == 0 {
+		port = DefaultSMTPPort
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: s.Host, InsecureSkipVerify: s.InsecureSkipVerify}
+
+	var conn net.Conn
+	var err error
+	if s.Security == SMTPSecurityTLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, 30*time.Second)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to connect to SMTP server %s: %s", addr, err)
+	}
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("SMTP error from %s: %s", addr, err)
+	}
+	defer client.Close()
+
+	if s.Security == "" || s.Security == SMTPSecurityStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("SMTP STARTTLS failed: %s", err)
+		}
+	}
+
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %s", err)
+		}
+	}
+
+	if err := client.Mail(config.ReturnToAddr); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %s", err)
+	}
+	if err := client.Rcpt(recipient); err != nil {
+		return fmt.Errorf("SMTP RCPT TO failed: %s", err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %s", err)
+	}
+	if _, err := w.Write(smtpMessage(config, recipient, subject, body)); err != nil {
+		return fmt.Errorf("unable to write SMTP message: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP message rejected: %s", err)
+	}
+
+	return client.Quit()
+}
+
+func smtpMessage(config Config, recipient, subject, body string) []byte {
+	charSet := config.CharSet
+	if charSet == "" {
+		charSet = "UTF-8"
+	}
+
+	headers := []string{
+		"From: " + config.ReturnToAddr,
+		"To: " + recipient,
+		"Subject: " + mime.QEncoding.Encode(charSet, subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=" + charSet,
+		"Content-Transfer-Encoding: 8bit",
+	}
+
+	body = strings.Replace(body, "\r\n", "\n", -1)
+	body = strings.Replace(body, "\n", "\r\n", -1)
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + body + "\r\n")
+}
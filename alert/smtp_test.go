@@ -0,0 +1,92 @@
+package alert
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPServer accepts one connection, answers every command with success, and sends the received commands and
+// message data on the returned channel
+func fakeSMTPServer(t *testing.T) (string, int, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 1)
+
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		var transcript strings.Builder
+		reply := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			transcript.WriteString(line)
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					reply("250 OK")
+				}
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case cmd == "QUIT":
+				reply("221 bye")
+				received <- transcript.String()
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+		received <- transcript.String()
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return host, portNumber, received
+}
+
+func TestSendSMTPEmail(t *testing.T) {
+	host, port, received := fakeSMTPServer(t)
+
+	config := Config{
+		ReturnToAddr: "no-reply@example.org",
+		SMTP:         SMTPConfig{Host: host, Port: port, Security: SMTPSecurityNone},
+	}
+	if err := sendSMTPEmail(config, "admin@example.org", "Alerta de sincronización", "line 1\nline 2"); err != nil {
+		t.Fatalf("sendSMTPEmail() error = %s", err)
+	}
+
+	transcript := <-received
+	for _, want := range []string{
+		"MAIL FROM:<no-reply@example.org>",
+		"RCPT TO:<admin@example.org>",
+		"Subject: =?UTF-8?q?Alerta_de_sincronizaci=C3=B3n?=",
+		"Content-Type: text/plain; charset=UTF-8",
+		"\r\n\r\nline 1\r\nline 2\r\n",
+	} {
+		if !strings.Contains(transcript, want) {
+			t.Errorf("SMTP transcript does not contain %q:\n%s", want, transcript)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package alert
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const DefaultLocale = "en"
+
+// Names of the alert templates. Each may be overridden in the Templates config.
+const (
+	TemplateSubject     = "subject"
+	TemplateConfigError = "configError"
+	TemplateSyncErrors  = "syncErrors"
+	TemplateApplyErrors = "applyErrors"
+	TemplateEvent       = "event"
+	TemplateDigest      = "digest"
+	TemplateCredentials = "credentials"
+)
+
+// ErrorData is the data for the configError template
+type ErrorData struct {
+	Error string
+}
+
+// ErrorsData is the data for the syncErrors and applyErrors templates
+type ErrorsData struct {
+	Errors []string
+}
+
+// EventData is the data for the event template
+type EventData struct {
+	Level    string
+	Category string
+	Message  string
+
+	// SyncSet, Destination, Operation, Person, and Error are the structured fields of the event, where known
+	SyncSet     string
+	Destination string
+	Operation   string
+	Person      string
+	Error       string
+}
+
+// DigestData is the data for the digest template
+type DigestData struct {
+	Since    time.Time
+	Messages []string
+
+	// Dropped is the number of messages left out because the digest was too large
+	Dropped int
+}
+
+// CredentialsData is the data for the credentials template, sent when an account is created with a password
+type CredentialsData struct {
+	Email             string
+	Password          string
+	ChangeAtNextLogin bool
+}
+
+// defaultTemplates are the built-in templates for each supported locale
+var defaultTemplates = map[string]map[string]string{
+	"en": {
+		TemplateSubject:     "personnel-sync alert",
+		TemplateConfigError: "{{.Error}}",
+		TemplateSyncErrors:  "Sync error(s):\n{{join .Errors \"\\n\"}}",
+		TemplateApplyErrors: "Apply error(s):\n{{join .Errors \"\\n\"}}",
+		TemplateEvent: "{{if .SyncSet}}[{{.SyncSet}}] {{end}}" +
+			"{{.Level}}{{if .Category}} ({{.Category}}){{end}}: {{.Message}}",
+		TemplateDigest: "{{len .Messages}} alert(s) and warning(s) since " +
+			"{{.Since.UTC.Format \"2006-01-02 15:04 MST\"}}:\n\n{{join .Messages \"\\n\"}}" +
+			"{{if .Dropped}}\n\n... and {{.Dropped}} more{{end}}",
+		TemplateCredentials: "An account was created for {{.Email}} with the password {{.Password}}" +
+			"{{if .ChangeAtNextLogin}}\nThe password must be changed at the first sign-in.{{end}}",
+	},
+	"es": {
+		TemplateSubject:     "alerta de personnel-sync",
+		TemplateConfigError: "{{.Error}}",
+		TemplateSyncErrors:  "Error(es) de sincronización:\n{{join .Errors \"\\n\"}}",
+		TemplateApplyErrors: "Error(es) al aplicar el plan:\n{{join .Errors \"\\n\"}}",
+		TemplateEvent: "{{if .SyncSet}}[{{.SyncSet}}] {{end}}" +
+			"{{.Level}}{{if .Category}} ({{.Category}}){{end}}: {{.Message}}",
+		TemplateDigest: "{{len .Messages}} alerta(s) y advertencia(s) desde " +
+			"{{.Since.UTC.Format \"2006-01-02 15:04 MST\"}}:\n\n{{join .Messages \"\\n\"}}" +
+			"{{if .Dropped}}\n\n... y {{.Dropped}} más{{end}}",
+		TemplateCredentials: "Se creó una cuenta para {{.Email}} con la contraseña {{.Password}}" +
+			"{{if .ChangeAtNextLogin}}\nLa contraseña debe cambiarse al iniciar sesión por primera vez.{{end}}",
+	},
+	"fr": {
+		TemplateSubject:     "alerte personnel-sync",
+		TemplateConfigError: "{{.Error}}",
+		TemplateSyncErrors:  "Erreur(s) de synchronisation :\n{{join .Errors \"\\n\"}}",
+		TemplateApplyErrors: "Erreur(s) lors de l'application du plan :\n{{join .Errors \"\\n\"}}",
+		TemplateEvent: "{{if .SyncSet}}[{{.SyncSet}}] {{end}}" +
+			"{{.Level}}{{if .Category}} ({{.Category}}){{end}} : {{.Message}}",
+		TemplateDigest: "{{len .Messages}} alerte(s) et avertissement(s) depuis le " +
+			"{{.Since.UTC.Format \"2006-01-02 15:04 MST\"}} :\n\n{{join .Messages \"\\n\"}}" +
+			"{{if .Dropped}}\n\n... et {{.Dropped}} de plus{{end}}",
+		TemplateCredentials: "Un compte a été créé pour {{.Email}} avec le mot de passe {{.Password}}" +
+			"{{if .ChangeAtNextLogin}}\nLe mot de passe doit être changé à la première connexion.{{end}}",
+	},
+}
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// validateTemplates checks that the Locale is supported and that all configured Templates can be parsed
+func (c Config) validateTemplates() error {
+	if c.Locale != "" {
+		if _, ok := defaultTemplates[c.Locale]; !ok {
+			return fmt.Errorf("unsupported alert Locale %q", c.Locale)
+		}
+	}
+	for name, text := range c.Templates {
+		if _, ok := defaultTemplates[DefaultLocale][name]; !ok {
+			return fmt.Errorf("unrecognized alert template %q", name)
+		}
+		if _, err := template.New(name).Funcs(templateFuncs).Parse(text); err != nil {
+			return fmt.Errorf("invalid alert template %q: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// Render executes the named template with the given data. A template in the Templates config is used if present,
+// otherwise the default for the configured Locale. If the template cannot be rendered, the English default is
+// used instead so an alert is never lost.
+func (c Config) Render(name string, data interface{}) string {
+	text, ok := c.Templates[name]
+	if !ok {
+		text = c.defaultTemplate(name)
+	}
+
+	out, err := execute(name, text, data)
+	if err != nil {
+		log.Printf("unable to render alert template %s, using default: %s", name, err)
+		out, _ = execute(name, defaultTemplates[DefaultLocale][name], data)
+	}
+	return out
+}
+
+func (c Config) defaultTemplate(name string) string {
+	if templates, ok := defaultTemplates[c.Locale]; ok {
+		return templates[name]
+	}
+	return defaultTemplates[DefaultLocale][name]
+}
+
+func execute(name, text string, data interface{}) (string, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,91 @@
+package alert
+
+import "testing"
+
+func TestConfig_Render(t *testing.T) {
+	errorsData := ErrorsData{Errors: []string{"first", "second"}}
+	tests := []struct {
+		name     string
+		config   Config
+		template string
+		data     interface{}
+		want     string
+	}{
+		{
+			name:     "default",
+			template: TemplateSyncErrors,
+			data:     errorsData,
+			want:     "Sync error(s):\nfirst\nsecond",
+		},
+		{
+			name:     "locale",
+			config:   Config{Locale: "es"},
+			template: TemplateSyncErrors,
+			data:     errorsData,
+			want:     "Error(es) de sincronización:\nfirst\nsecond",
+		},
+		{
+			name:     "override",
+			config:   Config{Locale: "fr", Templates: map[string]string{TemplateSyncErrors: "{{len .Errors}} errors"}},
+			template: TemplateSyncErrors,
+			data:     errorsData,
+			want:     "2 errors",
+		},
+		{
+			name:     "event without category",
+			template: TemplateEvent,
+			data:     EventData{Level: "Alert", Message: "something happened"},
+			want:     "Alert: something happened",
+		},
+		{
+			name:     "event with category",
+			template: TemplateEvent,
+			data:     EventData{Level: "Error", Category: "auth", Message: "denied"},
+			want:     "Error (auth): denied",
+		},
+		{
+			name:     "credentials",
+			config:   Config{Locale: "en"},
+			template: TemplateCredentials,
+			data:     CredentialsData{Email: "new@example.org", Password: "secret", ChangeAtNextLogin: true},
+			want: "An account was created for new@example.org with the password secret\n" +
+				"The password must be changed at the first sign-in.",
+		},
+		{
+			name:     "broken override falls back to default",
+			config:   Config{Templates: map[string]string{TemplateConfigError: "{{.Missing}}"}},
+			template: TemplateConfigError,
+			data:     ErrorData{Error: "bad config"},
+			want:     "bad config",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.Render(tt.template, tt.data); got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "empty", config: Config{}},
+		{name: "supported locale", config: Config{Locale: "fr"}},
+		{name: "unsupported locale", config: Config{Locale: "xx"}, wantErr: true},
+		{name: "valid template", config: Config{Templates: map[string]string{TemplateSubject: "sync alert"}}},
+		{name: "unknown template", config: Config{Templates: map[string]string{"other": "x"}}, wantErr: true},
+		{name: "invalid template", config: Config{Templates: map[string]string{TemplateSubject: "{{"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
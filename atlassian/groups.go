@@ -0,0 +1,322 @@
+package atlassian
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+const (
+	DefaultBatchSize         = 10
+	DefaultBatchDelaySeconds = 1
+	DefaultPageSize          = 50
+)
+
+// AtlassianGroups is a destination for the membership of Atlassian Cloud groups, which control access to Jira,
+// Confluence, and the other products of a site
+type AtlassianGroups struct {
+	// SiteURL is the Atlassian Cloud site, e.g. https://example.atlassian.net
+	SiteURL string
+
+	// Email and APIToken authenticate a site administrator. The account must be able to see the email addresses of
+	// the group members.
+	Email    string
+	APIToken string
+
+	// BatchSize changes are made every BatchDelaySeconds, to stay within the API rate limits
+	BatchSize         int
+	BatchDelaySeconds int
+
+	PageSize int
+	Retry    internal.RetryConfig
+
+	// Proxy is a SOCKS5 proxy for all requests
+	Proxy internal.ProxyConfig
+
+	GroupSyncSet GroupSyncSet
+	client       *http.Client
+
+	// hiddenMembers is the number of members found by ListUsers that have a hidden email address
+	hiddenMembers int
+}
+
+// GroupSyncSet selects the group for a sync set, by GroupID or, if that is not set, by GroupName
+type GroupSyncSet struct {
+	GroupID       string
+	GroupName     string
+	DisableAdd    bool
+	DisableDelete bool
+}
+
+type atlassianUser struct {
+	AccountID    string `json:"accountId"`
+	EmailAddress string `json:"emailAddress"`
+	AccountType  string `json:"accountType"`
+}
+
+func init() {
+	internal.RegisterDestination(internal.DestinationTypeAtlassianGroups, NewAtlassianGroupsDestination)
+
+	internal.DescribeDestination(internal.DestinationTypeAtlassianGroups, internal.AdapterConfig{
+		ExtraJSON: []interface{}{AtlassianGroups{}},
+		SyncSet:   GroupSyncSet{},
+	})
+}
+
+// NewAtlassianGroupsDestination unmarshals the destinationConfig's ExtraJSON into an AtlassianGroups struct
+func NewAtlassianGroupsDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var a AtlassianGroups
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &a); err != nil {
+		return &AtlassianGroups{}, err
+	}
+
+	if a.SiteURL == "" || a.Email == "" || a.APIToken == "" {
+		return &AtlassianGroups{}, errors.New("SiteURL, Email, and APIToken are required for AtlassianGroups")
+	}
+
+	a.SiteURL = strings.TrimSuffix(a.SiteURL, "/")
+	if a.BatchSize <= 0 {
+		a.BatchSize = DefaultBatchSize
+	}
+	if a.BatchDelaySeconds <= 0 {
+		a.BatchDelaySeconds = DefaultBatchDelaySeconds
+	}
+	if a.PageSize <= 0 {
+		a.PageSize = DefaultPageSize
+	}
+	var err error
+	if a.client, err = a.Proxy.Client(time.Minute); err != nil {
+		return &AtlassianGroups{}, err
+	}
+
+	return &a, nil
+}
+
+func (a *AtlassianGroups) ForSet(syncSetJson json.RawMessage) error {
+	var syncSetConfig GroupSyncSet
+	if err := json.Unmarshal(syncSetJson, &syncSetConfig); err != nil {
+		return err
+	}
+
+	if syncSetConfig.GroupID == "" && syncSetConfig.GroupName == "" {
+		return errors.New("GroupID or GroupName missing from sync set json")
+	}
+
+	a.GroupSyncSet = syncSetConfig
+	return nil
+}
+
+// ListUsers returns the active members of the group. Members whose email address is hidden are left out, so they
+// are never removed.
+func (a *AtlassianGroups) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+	var members []internal.Person
+	hidden := 0
+
+	for startAt := 0; ; {
+		params := a.groupParams()
+		params.Set("startAt", strconv.Itoa(startAt))
+		params.Set("maxResults", strconv.Itoa(a.PageSize))
+
+		body, err := a.request(http.MethodGet, "/rest/api/3/group/member?"+params.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get members of group %s: %s", a.groupName(), err)
+		}
+
+		var page struct {
+			Values []atlassianUser `json:"values"`
+			IsLast bool            `json:"isLast"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("unable to parse members of group %s: %s", a.groupName(), err)
+		}
+
+		for _, member := range page.Values {
+			if member.AccountType != "" && member.AccountType != "atlassian" {
+				continue
+			}
+			if member.EmailAddress == "" {
+				hidden++
+				continue
+			}
+			members = append(members, internal.Person{
+				CompareValue: member.EmailAddress,
+				ID:           member.AccountID,
+				Attributes: map[string]string{
+					"id":    member.AccountID,
+					"email": strings.ToLower(member.EmailAddress),
+				},
+			})
+		}
+
+		if page.IsLast || len(page.Values) == 0 {
+			break
+		}
+		startAt += len(page.Values)
+	}
+
+	a.hiddenMembers = hidden
+	return members, nil
+}
+
+func (a *AtlassianGroups) ApplyChangeSet(changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem) internal.ChangeResults {
+
+	var results internal.ChangeResults
+	var wg sync.WaitGroup
+	batchTimer := internal.NewBatchTimer(a.BatchSize, a.BatchDelaySeconds)
+
+	if a.hiddenMembers > 0 {
+		eventLog <- internal.EventLogItem{
+			Level: syslog.LOG_WARNING,
+			Message: fmt.Sprintf("%v members of group %s have a hidden email address and are not synced",
+				a.hiddenMembers, a.groupName()),
+		}
+	}
+
+	if !a.GroupSyncSet.DisableAdd {
+		for _, person := range changes.Create {
+			wg.Add(1)
+			go a.addMember(person, &results.Created, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	if !a.GroupSyncSet.DisableDelete {
+		for _, person := range changes.Delete {
+			wg.Add(1)
+			go a.removeMember(person, &results.Deleted, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	wg.Wait()
+	return results
+}
+
+func (a *AtlassianGroups) addMember(person internal.Person, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	accountID, err := a.findAccountID(person.CompareValue)
+	if err == nil {
+		_, err = a.request(http.MethodPost, "/rest/api/3/group/user?"+a.groupParams().Encode(),
+			map[string]string{"accountId": accountID})
+	}
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  fmt.Sprintf("unable to add %s to group %s: %s", person.CompareValue, a.groupName(), err)}
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: fmt.Sprintf("AddMember %s to %s", person.CompareValue, a.groupName()),
+	}
+	atomic.AddUint64(counter, 1)
+}
+
+func (a *AtlassianGroups) removeMember(person internal.Person, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	params := a.groupParams()
+	params.Set("accountId", person.ID)
+	if _, err := a.request(http.MethodDelete, "/rest/api/3/group/user?"+params.Encode(), nil); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  fmt.Sprintf("unable to remove %s from group %s: %s", person.CompareValue, a.groupName(), err)}
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: fmt.Sprintf("RemoveMember %s from %s", person.CompareValue, a.groupName()),
+	}
+	atomic.AddUint64(counter, 1)
+}
+
+// findAccountID returns the account ID of the user with the email address
+func (a *AtlassianGroups) findAccountID(email string) (string, error) {
+	body, err := a.request(http.MethodGet, "/rest/api/3/user/search?"+url.Values{"query": {email}}.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	var users []atlassianUser
+	if err := json.Unmarshal(body, &users); err != nil {
+		return "", fmt.Errorf("unable to parse user search results: %s", err)
+	}
+	for _, u := range users {
+		if strings.EqualFold(u.EmailAddress, email) {
+			return u.AccountID, nil
+		}
+	}
+	return "", fmt.Errorf("no user found with email address %s", email)
+}
+
+func (a *AtlassianGroups) groupParams() url.Values {
+	if a.GroupSyncSet.GroupID != "" {
+		return url.Values{"groupId": {a.GroupSyncSet.GroupID}}
+	}
+	return url.Values{"groupname": {a.GroupSyncSet.GroupName}}
+}
+
+func (a *AtlassianGroups) groupName() string {
+	if a.GroupSyncSet.GroupName != "" {
+		return a.GroupSyncSet.GroupName
+	}
+	return a.GroupSyncSet.GroupID
+}
+
+func (a *AtlassianGroups) request(method, path string, body interface{}) ([]byte, error) {
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		if bodyBytes, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("unable to marshal request body: %s", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, a.SiteURL+path, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(a.Email, a.APIToken)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.Retry.Do(a.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read http response body: %s", err)
+	}
+	if resp.StatusCode >= 400 {
+		return respBody, internal.NewStatusError(resp.StatusCode, resp.Header.Get("Retry-After"),
+			fmt.Errorf("status: %d, body: %s", resp.StatusCode, respBody))
+	}
+	return respBody, nil
+}
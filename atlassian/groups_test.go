@@ -0,0 +1,238 @@
+package atlassian
+
+import (
+	"encoding/json"
+	"log/syslog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+// fakeJira is an in-memory site with one group, staff
+type fakeJira struct {
+	sync.Mutex
+	users   []atlassianUser
+	members map[string]bool
+}
+
+func newFakeJira() *fakeJira {
+	return &fakeJira{
+		users: []atlassianUser{
+			{AccountID: "a1", EmailAddress: "Jane@example.org", AccountType: "atlassian"},
+			{AccountID: "a2", EmailAddress: "john@example.org", AccountType: "atlassian"},
+			{AccountID: "a3", AccountType: "atlassian"},
+			{AccountID: "a4", EmailAddress: "bot@example.org", AccountType: "app"},
+			{AccountID: "a5", EmailAddress: "pat@example.org", AccountType: "atlassian"},
+		},
+		members: map[string]bool{"a1": true, "a3": true, "a4": true, "a5": true},
+	}
+}
+
+func (f *fakeJira) server(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, token, _ := r.BasicAuth(); user != "admin@example.org" || token != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.Lock()
+		defer f.Unlock()
+
+		q := r.URL.Query()
+		if r.URL.Path != "/rest/api/3/user/search" && q.Get("groupname") != "staff" && q.Get("groupId") != "g1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/rest/api/3/group/member" && r.Method == http.MethodGet:
+			var ids []string
+			for id, member := range f.members {
+				if member {
+					ids = append(ids, id)
+				}
+			}
+			sort.Strings(ids)
+
+			startAt, _ := strconv.Atoi(q.Get("startAt"))
+			maxResults, _ := strconv.Atoi(q.Get("maxResults"))
+			values := []atlassianUser{}
+			for i := startAt; i < len(ids) && i < startAt+maxResults; i++ {
+				values = append(values, f.user(ids[i]))
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"values": values,
+				"isLast": startAt+maxResults >= len(ids),
+			})
+		case r.URL.Path == "/rest/api/3/user/search":
+			results := []atlassianUser{}
+			for _, u := range f.users {
+				if u.EmailAddress != "" && strings.Contains(strings.ToLower(u.EmailAddress), q.Get("query")) {
+					results = append(results, u)
+				}
+			}
+			_ = json.NewEncoder(w).Encode(results)
+		case r.URL.Path == "/rest/api/3/group/user" && r.Method == http.MethodPost:
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			f.members[body["accountId"]] = true
+			w.WriteHeader(http.StatusCreated)
+		case r.URL.Path == "/rest/api/3/group/user" && r.Method == http.MethodDelete:
+			f.members[q.Get("accountId")] = false
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func (f *fakeJira) user(id string) atlassianUser {
+	for _, u := range f.users {
+		if u.AccountID == id {
+			return u
+		}
+	}
+	return atlassianUser{}
+}
+
+func newTestAtlassianGroups(t *testing.T, serverURL, setJSON string) *AtlassianGroups {
+	config := `{"SiteURL":"` + serverURL + `/","Email":"admin@example.org","APIToken":"token","PageSize":2}`
+	dest, err := NewAtlassianGroupsDestination(internal.DestinationConfig{ExtraJSON: json.RawMessage(config)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dest.ForSet(json.RawMessage(setJSON)); err != nil {
+		t.Fatal(err)
+	}
+	return dest.(*AtlassianGroups)
+}
+
+func TestAtlassianGroups_ListUsers(t *testing.T) {
+	fake := newFakeJira()
+	server := fake.server(t)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		setJSON string
+		want    []string
+		wantErr bool
+	}{
+		{name: "by name", setJSON: `{"GroupName":"staff"}`, want: []string{"Jane@example.org", "pat@example.org"}},
+		{name: "by id", setJSON: `{"GroupID":"g1"}`, want: []string{"Jane@example.org", "pat@example.org"}},
+		{name: "missing group", setJSON: `{"GroupName":"other"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAtlassianGroups(t, server.URL, tt.setJSON)
+			people, err := a.ListUsers(nil)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, p := range people {
+				got = append(got, p.CompareValue)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListUsers() = %v, want %v", got, tt.want)
+			}
+			if people[0].ID != "a1" || people[0].Attributes["email"] != "jane@example.org" {
+				t.Errorf("ListUsers() first person = %+v", people[0])
+			}
+		})
+	}
+}
+
+func TestAtlassianGroups_ApplyChangeSet(t *testing.T) {
+	tests := []struct {
+		name        string
+		setJSON     string
+		want        internal.ChangeResults
+		wantMembers map[string]bool
+		wantErrs    int
+	}{
+		{
+			name:        "add and remove",
+			setJSON:     `{"GroupName":"staff"}`,
+			want:        internal.ChangeResults{Created: 1, Deleted: 1},
+			wantMembers: map[string]bool{"a1": true, "a2": true, "a3": true, "a4": true, "a5": false},
+			wantErrs:    1,
+		},
+		{
+			name:        "disabled",
+			setJSON:     `{"GroupID":"g1","DisableAdd":true,"DisableDelete":true}`,
+			want:        internal.ChangeResults{},
+			wantMembers: map[string]bool{"a1": true, "a3": true, "a4": true, "a5": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeJira()
+			server := fake.server(t)
+			defer server.Close()
+
+			a := newTestAtlassianGroups(t, server.URL, tt.setJSON)
+			eventLog := make(chan internal.EventLogItem, 10)
+			results := a.ApplyChangeSet(internal.ChangeSet{
+				Create: []internal.Person{{CompareValue: "john@example.org"}, {CompareValue: "nobody@example.org"}},
+				Delete: []internal.Person{{CompareValue: "pat@example.org", ID: "a5"}},
+			}, eventLog)
+			close(eventLog)
+
+			var errs []string
+			for msg := range eventLog {
+				if msg.Level <= syslog.LOG_ERR {
+					errs = append(errs, msg.Message)
+				}
+			}
+			if len(errs) != tt.wantErrs {
+				t.Errorf("errors = %v, want %v", errs, tt.wantErrs)
+			}
+			if !reflect.DeepEqual(results, tt.want) {
+				t.Errorf("results = %+v, want %+v", results, tt.want)
+			}
+			if !reflect.DeepEqual(fake.members, tt.wantMembers) {
+				t.Errorf("members = %v, want %v", fake.members, tt.wantMembers)
+			}
+		})
+	}
+}
+
+func TestAtlassianGroups_HiddenMembers(t *testing.T) {
+	fake := newFakeJira()
+	server := fake.server(t)
+	defer server.Close()
+
+	a := newTestAtlassianGroups(t, server.URL, `{"GroupName":"staff"}`)
+	if _, err := a.ListUsers(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	eventLog := make(chan internal.EventLogItem, 10)
+	a.ApplyChangeSet(internal.ChangeSet{}, eventLog)
+	close(eventLog)
+
+	var warnings []string
+	for msg := range eventLog {
+		if msg.Level == syslog.LOG_WARNING {
+			warnings = append(warnings, msg.Message)
+		}
+	}
+	want := []string{"1 members of group staff have a hidden email address and are not synced"}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("warnings = %v, want %v", warnings, want)
+	}
+}
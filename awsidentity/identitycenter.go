@@ -0,0 +1,634 @@
+package awsidentity
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/syslog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+const (
+	DefaultBatchSize         = 10
+	DefaultBatchDelaySeconds = 1
+
+	CompareAttributeUserName = "userName"
+	CompareAttributeEmail    = "email"
+
+	pageSize = 100
+)
+
+// IdentityCenter is a destination for the users and group memberships of the identity store of AWS IAM Identity
+// Center (successor to AWS SSO). It calls the Identity Store API directly, as the AWS SDK in use does not
+// support the document values that its updates need.
+type IdentityCenter struct {
+	// IdentityStoreID is the ID of the identity store, e.g. d-1234567890
+	IdentityStoreID string
+
+	AWSRegion string
+
+	// AWSAccessKeyID and AWSSecretAccessKey are optional. If not set, the default AWS credentials are used, such as
+	// the role of a Lambda function.
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+
+	// CompareAttribute is userName (the default) or email
+	CompareAttribute string
+
+	// BatchSize changes are made every BatchDelaySeconds, to stay within the API rate limits
+	BatchSize         int
+	BatchDelaySeconds int
+
+	Retry internal.RetryConfig
+
+	// Proxy is a SOCKS5 proxy for all requests
+	Proxy internal.ProxyConfig
+
+	// Endpoint overrides the regional Identity Store endpoint
+	Endpoint string
+
+	setConfig SetConfig
+	groupID   string
+
+	// users are the identity store users by lower case compare value, as last listed
+	users map[string]user
+
+	client *http.Client
+	signer *v4.Signer
+}
+
+// SetConfig selects what a sync set manages. If GroupName is set, the membership of that group is synced.
+// Otherwise, the users of the identity store are synced.
+type SetConfig struct {
+	GroupName string
+}
+
+type user struct {
+	UserID      string  `json:"UserId,omitempty"`
+	UserName    string  `json:",omitempty"`
+	DisplayName string  `json:",omitempty"`
+	Name        *name   `json:",omitempty"`
+	Emails      []email `json:",omitempty"`
+}
+
+type name struct {
+	GivenName  string `json:",omitempty"`
+	FamilyName string `json:",omitempty"`
+}
+
+type email struct {
+	Value   string
+	Type    string
+	Primary bool
+}
+
+type attributeOperation struct {
+	AttributePath  string
+	AttributeValue interface{}
+}
+
+type apiError struct {
+	Status  int
+	Type    string
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("status: %d, %s: %s", e.Status, e.Type, e.Message)
+}
+
+func init() {
+	internal.RegisterDestination(internal.DestinationTypeAWSIdentityCenter, NewIdentityCenterDestination)
+
+	internal.DescribeDestination(internal.DestinationTypeAWSIdentityCenter, internal.AdapterConfig{
+		ExtraJSON: []interface{}{IdentityCenter{}},
+		SyncSet:   SetConfig{},
+		Features:  []string{internal.FeaturePartialUpdates},
+	})
+}
+
+// NewIdentityCenterDestination unmarshals the destinationConfig's ExtraJSON into an IdentityCenter struct
+func NewIdentityCenterDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var ic IdentityCenter
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &ic); err != nil {
+		return &IdentityCenter{}, err
+	}
+
+	if ic.IdentityStoreID == "" || ic.AWSRegion == "" {
+		return &IdentityCenter{}, errors.New("IdentityStoreID and AWSRegion are required for AWSIdentityCenter")
+	}
+
+	switch ic.CompareAttribute {
+	case "":
+		ic.CompareAttribute = CompareAttributeUserName
+	case CompareAttributeUserName, CompareAttributeEmail:
+	default:
+		return &IdentityCenter{}, fmt.Errorf("invalid AWSIdentityCenter CompareAttribute %q, must be userName or email",
+			ic.CompareAttribute)
+	}
+
+	if ic.Endpoint == "" {
+		ic.Endpoint = fmt.Sprintf("https://identitystore.%s.amazonaws.com", ic.AWSRegion)
+	}
+	if ic.BatchSize <= 0 {
+		ic.BatchSize = DefaultBatchSize
+	}
+	if ic.BatchDelaySeconds <= 0 {
+		ic.BatchDelaySeconds = DefaultBatchDelaySeconds
+	}
+
+	cfg := &aws.Config{Region: aws.String(ic.AWSRegion)}
+	if ic.AWSAccessKeyID != "" && ic.AWSSecretAccessKey != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(ic.AWSAccessKeyID, ic.AWSSecretAccessKey, "")
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return &IdentityCenter{}, fmt.Errorf("error creating AWS session: %s", err)
+	}
+	ic.signer = v4.NewSigner(sess.Config.Credentials)
+
+	if ic.client, err = ic.Proxy.Client(time.Minute); err != nil {
+		return &IdentityCenter{}, err
+	}
+
+	return &ic, nil
+}
+
+func (ic *IdentityCenter) ForSet(syncSetJson json.RawMessage) error {
+	var setConfig SetConfig
+	if len(syncSetJson) > 0 {
+		if err := json.Unmarshal(syncSetJson, &setConfig); err != nil {
+			return err
+		}
+	}
+
+	ic.setConfig = setConfig
+	ic.groupID = ""
+	ic.users = nil
+	return nil
+}
+
+// ListUsers returns the users of the identity store or, for a group, the members of the group
+func (ic *IdentityCenter) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+	users, err := ic.listAllUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	ic.users = map[string]user{}
+	byID := map[string]user{}
+	for _, u := range users {
+		byID[u.UserID] = u
+		if key := ic.compareValue(u); key != "" {
+			ic.users[strings.ToLower(key)] = u
+		}
+	}
+
+	if ic.setConfig.GroupName == "" {
+		var people []internal.Person
+		for _, u := range users {
+			if p := ic.toPerson(u); p.CompareValue != "" {
+				people = append(people, p)
+			}
+		}
+		return people, nil
+	}
+
+	groupID, err := ic.getGroupID()
+	if err != nil {
+		return nil, err
+	}
+
+	var members []internal.Person
+	var nextToken string
+	for {
+		var page struct {
+			GroupMemberships []struct {
+				MembershipId string
+				MemberId     struct{ UserId string }
+			}
+			NextToken string
+		}
+		err := ic.call("ListGroupMemberships", map[string]interface{}{
+			"IdentityStoreId": ic.IdentityStoreID,
+			"GroupId":         groupID,
+			"MaxResults":      pageSize,
+			"NextToken":       optional(nextToken),
+		}, &page)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list members of group %s: %s", ic.setConfig.GroupName, err)
+		}
+
+		for _, m := range page.GroupMemberships {
+			u, ok := byID[m.MemberId.UserId]
+			if !ok {
+				continue
+			}
+			p := ic.toPerson(u)
+			if p.CompareValue == "" {
+				continue
+			}
+			p.ID = m.MembershipId
+			p.Attributes["id"] = m.MembershipId
+			members = append(members, p)
+		}
+
+		if page.NextToken == "" {
+			return members, nil
+		}
+		nextToken = page.NextToken
+	}
+}
+
+func (ic *IdentityCenter) listAllUsers() ([]user, error) {
+	var users []user
+	var nextToken string
+	for {
+		var page struct {
+			Users     []user
+			NextToken string
+		}
+		err := ic.call("ListUsers", map[string]interface{}{
+			"IdentityStoreId": ic.IdentityStoreID,
+			"MaxResults":      pageSize,
+			"NextToken":       optional(nextToken),
+		}, &page)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list identity store users: %s", err)
+		}
+
+		users = append(users, page.Users...)
+		if page.NextToken == "" {
+			return users, nil
+		}
+		nextToken = page.NextToken
+	}
+}
+
+func (ic *IdentityCenter) getGroupID() (string, error) {
+	if ic.groupID != "" {
+		return ic.groupID, nil
+	}
+
+	var out struct{ GroupId string }
+	err := ic.call("GetGroupId", map[string]interface{}{
+		"IdentityStoreId": ic.IdentityStoreID,
+		"AlternateIdentifier": map[string]interface{}{
+			"UniqueAttribute": map[string]interface{}{
+				"AttributePath":  "displayName",
+				"AttributeValue": ic.setConfig.GroupName,
+			},
+		},
+	}, &out)
+	if err != nil {
+		return "", fmt.Errorf("unable to find group %s: %s", ic.setConfig.GroupName, err)
+	}
+
+	ic.groupID = out.GroupId
+	return ic.groupID, nil
+}
+
+func (ic *IdentityCenter) ApplyChangeSet(changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem) internal.ChangeResults {
+
+	var results internal.ChangeResults
+	var wg sync.WaitGroup
+	batchTimer := internal.NewBatchTimer(ic.BatchSize, ic.BatchDelaySeconds)
+
+	groupMode := ic.setConfig.GroupName != ""
+	if groupMode {
+		if _, err := ic.getGroupID(); err != nil {
+			eventLog <- errorEvent("unable to apply changes", err)
+			return results
+		}
+	}
+
+	for _, person := range changes.Create {
+		wg.Add(1)
+		if groupMode {
+			go ic.addMember(person, &results.Created, &wg, eventLog)
+		} else {
+			go ic.createUser(person, &results.Created, &wg, eventLog)
+		}
+		batchTimer.WaitOnBatch()
+	}
+
+	// memberships have nothing to update
+	if !groupMode {
+		for _, person := range changes.Update {
+			wg.Add(1)
+			go ic.updateUser(person, changes.UpdateAttributes(person), &results.Updated, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	for _, person := range changes.Delete {
+		wg.Add(1)
+		if groupMode {
+			go ic.removeMember(person, &results.Deleted, &wg, eventLog)
+		} else {
+			go ic.deleteUser(person, &results.Deleted, &wg, eventLog)
+		}
+		batchTimer.WaitOnBatch()
+	}
+
+	wg.Wait()
+	return results
+}
+
+func (ic *IdentityCenter) createUser(person internal.Person, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	u := newUser(person)
+	input := map[string]interface{}{
+		"IdentityStoreId": ic.IdentityStoreID,
+		"UserName":        u.UserName,
+		"DisplayName":     u.DisplayName,
+	}
+	if u.Name != nil {
+		input["Name"] = u.Name
+	}
+	if len(u.Emails) > 0 {
+		input["Emails"] = u.Emails
+	}
+
+	if err := ic.call("CreateUser", input, nil); err != nil {
+		eventLog <- errorEvent("unable to create user "+person.CompareValue, err)
+		return
+	}
+
+	eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "CreateUser " + person.CompareValue}
+	atomic.AddUint64(counter, 1)
+}
+
+func (ic *IdentityCenter) updateUser(person internal.Person, attributes map[string]string, counter *uint64,
+	wg *sync.WaitGroup, eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	operations := updateOperations(attributes)
+	if len(operations) == 0 {
+		return
+	}
+
+	err := ic.call("UpdateUser", map[string]interface{}{
+		"IdentityStoreId": ic.IdentityStoreID,
+		"UserId":          person.ID,
+		"Operations":      operations,
+	}, nil)
+	if err != nil {
+		eventLog <- errorEvent("unable to update user "+person.CompareValue, err)
+		return
+	}
+
+	eventLog <- internal.UpdateEvent("UpdateUser", person.CompareValue, person)
+	atomic.AddUint64(counter, 1)
+}
+
+func (ic *IdentityCenter) deleteUser(person internal.Person, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	err := ic.call("DeleteUser", map[string]interface{}{
+		"IdentityStoreId": ic.IdentityStoreID,
+		"UserId":          person.ID,
+	}, nil)
+	if err != nil {
+		eventLog <- errorEvent("unable to delete user "+person.CompareValue, err)
+		return
+	}
+
+	eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: "DeleteUser " + person.CompareValue}
+	atomic.AddUint64(counter, 1)
+}
+
+func (ic *IdentityCenter) addMember(person internal.Person, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	u, ok := ic.users[strings.ToLower(person.CompareValue)]
+	if !ok {
+		eventLog <- errorEvent("unable to add "+person.CompareValue+" to group "+ic.setConfig.GroupName,
+			errors.New("no user found in the identity store"))
+		return
+	}
+
+	err := ic.call("CreateGroupMembership", map[string]interface{}{
+		"IdentityStoreId": ic.IdentityStoreID,
+		"GroupId":         ic.groupID,
+		"MemberId":        map[string]string{"UserId": u.UserID},
+	}, nil)
+	if err != nil {
+		eventLog <- errorEvent("unable to add "+person.CompareValue+" to group "+ic.setConfig.GroupName, err)
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: fmt.Sprintf("AddMember %s to %s", person.CompareValue, ic.setConfig.GroupName),
+	}
+	atomic.AddUint64(counter, 1)
+}
+
+func (ic *IdentityCenter) removeMember(person internal.Person, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	err := ic.call("DeleteGroupMembership", map[string]interface{}{
+		"IdentityStoreId": ic.IdentityStoreID,
+		"MembershipId":    person.ID,
+	}, nil)
+	if err != nil {
+		eventLog <- errorEvent("unable to remove "+person.CompareValue+" from group "+ic.setConfig.GroupName, err)
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: fmt.Sprintf("RemoveMember %s from %s", person.CompareValue, ic.setConfig.GroupName),
+	}
+	atomic.AddUint64(counter, 1)
+}
+
+func (ic *IdentityCenter) compareValue(u user) string {
+	if ic.CompareAttribute == CompareAttributeEmail {
+		return primaryEmail(u)
+	}
+	return u.UserName
+}
+
+func (ic *IdentityCenter) toPerson(u user) internal.Person {
+	attributes := map[string]string{
+		"id":          u.UserID,
+		"userName":    u.UserName,
+		"displayName": u.DisplayName,
+		"email":       strings.ToLower(primaryEmail(u)),
+	}
+	if u.Name != nil {
+		attributes["givenName"] = u.Name.GivenName
+		attributes["familyName"] = u.Name.FamilyName
+	}
+
+	return internal.Person{
+		CompareValue: ic.compareValue(u),
+		ID:           u.UserID,
+		Attributes:   attributes,
+	}
+}
+
+func primaryEmail(u user) string {
+	for _, e := range u.Emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+// newUser returns the user for a source person. The display name defaults to the given and family names.
+func newUser(person internal.Person) user {
+	attrs := person.Attributes
+	u := user{UserName: attrs["userName"], DisplayName: attrs["displayName"]}
+	if attrs["givenName"] != "" || attrs["familyName"] != "" {
+		u.Name = &name{GivenName: attrs["givenName"], FamilyName: attrs["familyName"]}
+	}
+	if u.DisplayName == "" {
+		u.DisplayName = strings.TrimSpace(attrs["givenName"] + " " + attrs["familyName"])
+	}
+	if attrs["email"] != "" {
+		u.Emails = []email{{Value: attrs["email"], Type: "work", Primary: true}}
+	}
+	return u
+}
+
+// updateOperations returns an operation for each of the attributes to update
+func updateOperations(attrs map[string]string) []attributeOperation {
+	paths := map[string]string{
+		"userName":    "userName",
+		"displayName": "displayName",
+		"givenName":   "name.givenName",
+		"familyName":  "name.familyName",
+	}
+
+	var operations []attributeOperation
+	for _, attr := range []string{"userName", "displayName", "givenName", "familyName"} {
+		if value, ok := attrs[attr]; ok && value != "" {
+			operations = append(operations, attributeOperation{AttributePath: paths[attr], AttributeValue: value})
+		}
+	}
+	if value := attrs["email"]; value != "" {
+		operations = append(operations, attributeOperation{
+			AttributePath:  "emails",
+			AttributeValue: []email{{Value: value, Type: "work", Primary: true}},
+		})
+	}
+	return operations
+}
+
+// optional returns nil for an empty string, so that it is left out of a request
+func optional(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// call sends a request for an Identity Store API operation, signed with AWS Signature Version 4, and unmarshals the
+// response into out, if it is not nil
+func (ic *IdentityCenter) call(operation string, input map[string]interface{}, out interface{}) error {
+	for key, value := range input {
+		if value == nil {
+			delete(input, key)
+		}
+	}
+	body, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("unable to marshal request body: %s", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(ic.Endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AWSIdentityStore."+operation)
+	if _, err := ic.signer.Sign(req, bytes.NewReader(body), "identitystore", ic.AWSRegion, time.Now()); err != nil {
+		return fmt.Errorf("unable to sign request: %s", err)
+	}
+
+	resp, err := ic.Retry.Do(ic.client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read http response body: %s", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string
+		}
+		_ = json.Unmarshal(respBody, &e)
+		if e.Message == "" {
+			e.Message = string(respBody)
+		}
+		// the type may be prefixed with a namespace, e.g. com.amazonaws.identitystore#ConflictException
+		e.Type = e.Type[strings.LastIndex(e.Type, "#")+1:]
+		status := resp.StatusCode
+		if e.Type == "ThrottlingException" {
+			status = http.StatusTooManyRequests
+		}
+		return internal.NewStatusError(status, resp.Header.Get("Retry-After"),
+			&apiError{Status: resp.StatusCode, Type: e.Type, Message: e.Message})
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("unable to parse %s response: %s", operation, err)
+	}
+	return nil
+}
+
+func errorEvent(message string, err error) internal.EventLogItem {
+	category := internal.ClassifyError(err)
+	var e *apiError
+	if errors.As(err, &e) {
+		category = internal.ClassifyHTTPStatus(e.Status)
+		if e.Type == "ConflictException" {
+			category = internal.ErrorCategoryConflict
+		}
+	}
+	return internal.EventLogItem{
+		Level:    syslog.LOG_ERR,
+		Category: category,
+		Message:  fmt.Sprintf("%s: %s", message, err),
+		Error:    err.Error(),
+	}
+}
@@ -0,0 +1,282 @@
+package awsidentity
+
+import (
+	"encoding/json"
+	"log/syslog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+// fakeIdentityStore is an in-memory identity store with one group, Engineers
+type fakeIdentityStore struct {
+	sync.Mutex
+	users   map[string]user
+	members map[string]string // membership ID to user ID
+	updates map[string][]attributeOperation
+	nextID  int
+}
+
+func newFakeIdentityStore() *fakeIdentityStore {
+	return &fakeIdentityStore{
+		users: map[string]user{
+			"u1": {UserID: "u1", UserName: "jane", DisplayName: "Jane Doe", Name: &name{GivenName: "Jane",
+				FamilyName: "Doe"}, Emails: []email{{Value: "Jane@example.org", Type: "work", Primary: true}}},
+			"u2": {UserID: "u2", UserName: "john", DisplayName: "John Smith"},
+			"u3": {UserID: "u3", UserName: "pat", DisplayName: "Pat Lee"},
+		},
+		members: map[string]string{"m1": "u1", "m3": "u3"},
+		updates: map[string][]attributeOperation{},
+	}
+}
+
+func (f *fakeIdentityStore) server(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		f.Lock()
+		defer f.Unlock()
+
+		var in map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		if in["IdentityStoreId"] != "d-123" {
+			t.Errorf("IdentityStoreId = %v", in["IdentityStoreId"])
+		}
+
+		var out interface{} = map[string]interface{}{}
+		switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AWSIdentityStore.") {
+		case "ListUsers":
+			out = f.listUsers(in)
+		case "GetGroupId":
+			unique := in["AlternateIdentifier"].(map[string]interface{})["UniqueAttribute"].(map[string]interface{})
+			if unique["AttributeValue"] != "Engineers" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","Message":"group not found"}`))
+				return
+			}
+			out = map[string]string{"GroupId": "g1"}
+		case "ListGroupMemberships":
+			var memberships []map[string]interface{}
+			for id, userID := range f.members {
+				memberships = append(memberships, map[string]interface{}{"MembershipId": id,
+					"MemberId": map[string]string{"UserId": userID}})
+			}
+			out = map[string]interface{}{"GroupMemberships": memberships}
+		case "CreateGroupMembership":
+			f.nextID++
+			f.members["new"+strconv.Itoa(f.nextID)] = in["MemberId"].(map[string]interface{})["UserId"].(string)
+		case "DeleteGroupMembership":
+			delete(f.members, in["MembershipId"].(string))
+		case "CreateUser":
+			for _, u := range f.users {
+				if u.UserName == in["UserName"] {
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte(`{"__type":"com.amazonaws.identitystore#ConflictException",` +
+						`"Message":"Duplicate UserName"}`))
+					return
+				}
+			}
+			var u user
+			b, _ := json.Marshal(in)
+			_ = json.Unmarshal(b, &u)
+			u.UserID = "new"
+			f.users[u.UserID] = u
+			out = map[string]string{"UserId": u.UserID}
+		case "UpdateUser":
+			var update struct {
+				UserId     string
+				Operations []attributeOperation
+			}
+			b, _ := json.Marshal(in)
+			_ = json.Unmarshal(b, &update)
+			f.updates[update.UserId] = update.Operations
+		case "DeleteUser":
+			delete(f.users, in["UserId"].(string))
+		default:
+			t.Errorf("unexpected operation %s", r.Header.Get("X-Amz-Target"))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+}
+
+// listUsers returns the users in pages of 2
+func (f *fakeIdentityStore) listUsers(in map[string]interface{}) interface{} {
+	var ids []string
+	for id := range f.users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	start := 0
+	if token, ok := in["NextToken"].(string); ok {
+		start, _ = strconv.Atoi(token)
+	}
+	var users []user
+	for i := start; i < len(ids) && i < start+2; i++ {
+		users = append(users, f.users[ids[i]])
+	}
+	out := map[string]interface{}{"Users": users}
+	if start+2 < len(ids) {
+		out["NextToken"] = strconv.Itoa(start + 2)
+	}
+	return out
+}
+
+func newTestIdentityCenter(t *testing.T, serverURL, extra, setJSON string) *IdentityCenter {
+	config := `{"IdentityStoreID":"d-123","AWSRegion":"us-east-1","AWSAccessKeyID":"AKID",` +
+		`"AWSSecretAccessKey":"secret","Endpoint":"` + serverURL + `"` + extra + `}`
+	dest, err := NewIdentityCenterDestination(internal.DestinationConfig{ExtraJSON: json.RawMessage(config)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dest.ForSet(json.RawMessage(setJSON)); err != nil {
+		t.Fatal(err)
+	}
+	return dest.(*IdentityCenter)
+}
+
+func applyChanges(ic *IdentityCenter, changes internal.ChangeSet) (internal.ChangeResults, []internal.EventLogItem) {
+	eventLog := make(chan internal.EventLogItem, 20)
+	results := ic.ApplyChangeSet(changes, eventLog)
+	close(eventLog)
+
+	var errs []internal.EventLogItem
+	for msg := range eventLog {
+		if msg.Level <= syslog.LOG_ERR {
+			errs = append(errs, msg)
+		}
+	}
+	return results, errs
+}
+
+func TestIdentityCenter_ListUsers(t *testing.T) {
+	fake := newFakeIdentityStore()
+	server := fake.server(t)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		extra   string
+		setJSON string
+		want    []string
+	}{
+		{name: "users", setJSON: `{}`, want: []string{"jane", "john", "pat"}},
+		{name: "users by email", extra: `,"CompareAttribute":"email"`, setJSON: `{}`, want: []string{"Jane@example.org"}},
+		{name: "group", setJSON: `{"GroupName":"Engineers"}`, want: []string{"jane", "pat"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ic := newTestIdentityCenter(t, server.URL, tt.extra, tt.setJSON)
+			people, err := ic.ListUsers(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, p := range people {
+				got = append(got, p.CompareValue)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListUsers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentityCenter_ApplyChangeSet_Users(t *testing.T) {
+	fake := newFakeIdentityStore()
+	server := fake.server(t)
+	defer server.Close()
+
+	ic := newTestIdentityCenter(t, server.URL, "", `{}`)
+	results, errs := applyChanges(ic, internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "sam", Attributes: map[string]string{"userName": "sam", "givenName": "Sam",
+				"familyName": "Fox", "email": "sam@example.org"}},
+			{CompareValue: "john", Attributes: map[string]string{"userName": "john"}},
+		},
+		Update: []internal.Person{
+			{CompareValue: "jane", ID: "u1", Attributes: map[string]string{"familyName": "Roe", "email": "jr@example.org"}},
+			{CompareValue: "kim", ID: "u2", Attributes: map[string]string{"givenName": "Kim", "familyName": "Lee",
+				"email": "kim@example.org"}, Changes: []internal.AttributeChange{
+				{Attribute: "familyName", Old: "Li", New: "Lee"}}},
+		},
+		Delete:         []internal.Person{{CompareValue: "pat", ID: "u3"}},
+		PartialUpdates: true,
+	})
+
+	if len(errs) != 1 || errs[0].Category != internal.ErrorCategoryConflict {
+		t.Errorf("errors = %+v, want one conflict", errs)
+	}
+	want := internal.ChangeResults{Created: 1, Updated: 2, Deleted: 1}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+
+	wantNew := user{UserID: "new", UserName: "sam", DisplayName: "Sam Fox", Name: &name{GivenName: "Sam",
+		FamilyName: "Fox"}, Emails: []email{{Value: "sam@example.org", Type: "work", Primary: true}}}
+	if !reflect.DeepEqual(fake.users["new"], wantNew) {
+		t.Errorf("new user = %+v, want %+v", fake.users["new"], wantNew)
+	}
+	wantOps := []attributeOperation{
+		{AttributePath: "name.familyName", AttributeValue: "Roe"},
+		{AttributePath: "emails", AttributeValue: []interface{}{
+			map[string]interface{}{"Value": "jr@example.org", "Type": "work", "Primary": true}}},
+	}
+	if !reflect.DeepEqual(fake.updates["u1"], wantOps) {
+		t.Errorf("update operations = %+v, want %+v", fake.updates["u1"], wantOps)
+	}
+	wantOps = []attributeOperation{{AttributePath: "name.familyName", AttributeValue: "Lee"}}
+	if !reflect.DeepEqual(fake.updates["u2"], wantOps) {
+		t.Errorf("update operations with Changes = %+v, want only the change %+v", fake.updates["u2"], wantOps)
+	}
+	if _, ok := fake.users["u3"]; ok {
+		t.Error("user was not deleted")
+	}
+}
+
+func TestIdentityCenter_ApplyChangeSet_Group(t *testing.T) {
+	fake := newFakeIdentityStore()
+	server := fake.server(t)
+	defer server.Close()
+
+	ic := newTestIdentityCenter(t, server.URL, "", `{"GroupName":"Engineers"}`)
+	people, err := ic.ListUsers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pat internal.Person
+	for _, p := range people {
+		if p.CompareValue == "pat" {
+			pat = p
+		}
+	}
+
+	results, errs := applyChanges(ic, internal.ChangeSet{
+		Create: []internal.Person{{CompareValue: "John"}, {CompareValue: "nobody"}},
+		Delete: []internal.Person{pat},
+	})
+	if len(errs) != 1 || !strings.Contains(errs[0].Message, "nobody") {
+		t.Errorf("errors = %+v, want one for nobody", errs)
+	}
+	want := internal.ChangeResults{Created: 1, Deleted: 1}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+	wantMembers := map[string]string{"m1": "u1", "new1": "u2"}
+	if !reflect.DeepEqual(fake.members, wantMembers) {
+		t.Errorf("members = %v, want %v", fake.members, wantMembers)
+	}
+}
@@ -0,0 +1,40 @@
+// Package awssecrets reads the PEM data of TLS certificates from AWS Secrets Manager. It registers itself as the
+// secret provider of the engine when imported.
+package awssecrets
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+func init() {
+	internal.RegisterSecretProvider(GetSecret)
+}
+
+// GetSecret returns the value of an AWS Secrets Manager secret, read with the default AWS credentials
+func GetSecret(secretID, region string) ([]byte, error) {
+	cfg := &aws.Config{}
+	if region != "" {
+		cfg.Region = aws.String(region)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating AWS session: %s", err)
+	}
+
+	out, err := secretsmanager.New(sess).GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.SecretString != nil {
+		return []byte(*out.SecretString), nil
+	}
+	return out.SecretBinary, nil
+}
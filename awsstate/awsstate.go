@@ -0,0 +1,150 @@
+package awsstate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+func init() {
+	internal.RegisterStateStore(internal.StateTypeS3, NewS3StateStore)
+	internal.RegisterStateStore(internal.StateTypeDynamoDB, NewDynamoDBStateStore)
+}
+
+// NewS3StateStore returns a StateStore that keeps state in an S3 bucket
+func NewS3StateStore(config internal.StateConfig) (internal.StateStore, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("state Bucket is required for s3 state store")
+	}
+	sess, err := newAWSSession(config)
+	if err != nil {
+		return nil, err
+	}
+	return &S3StateStore{Bucket: config.Bucket, Prefix: config.Prefix, client: s3.New(sess)}, nil
+}
+
+// NewDynamoDBStateStore returns a StateStore that keeps state in a DynamoDB table
+func NewDynamoDBStateStore(config internal.StateConfig) (internal.StateStore, error) {
+	if config.Table == "" {
+		return nil, errors.New("state Table is required for dynamodb state store")
+	}
+	sess, err := newAWSSession(config)
+	if err != nil {
+		return nil, err
+	}
+	return &DynamoDBStateStore{Table: config.Table, client: dynamodb.New(sess)}, nil
+}
+
+func newAWSSession(config internal.StateConfig) (*session.Session, error) {
+	cfg := &aws.Config{Region: aws.String(config.AWSRegion)}
+	if config.AWSAccessKeyID != "" && config.AWSSecretAccessKey != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(config.AWSAccessKeyID, config.AWSSecretAccessKey, "")
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating AWS session: %s", err)
+	}
+	return sess, nil
+}
+
+// S3StateStore keeps each key in a separate S3 object
+type S3StateStore struct {
+	Bucket string
+	Prefix string
+	client s3iface.S3API
+}
+
+func (s *S3StateStore) Load(key string, v interface{}) (bool, error) {
+	out, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.objectKey(key)),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to get state object %s: %s", s.objectKey(key), err)
+	}
+	defer out.Body.Close()
+
+	data, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return false, fmt.Errorf("unable to read state object %s: %s", s.objectKey(key), err)
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+func (s *S3StateStore) Save(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("unable to marshal state for %s: %s", key, err)
+	}
+	_, err = s.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(s.objectKey(key)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to put state object %s: %s", s.objectKey(key), err)
+	}
+	return nil
+}
+
+func (s *S3StateStore) objectKey(key string) string {
+	return path.Join(s.Prefix, key+".json")
+}
+
+// DynamoDBStateStore keeps each key in a separate item. The table must have a string partition key named "Key".
+// Note that DynamoDB limits items to 400KB, which may be exceeded by very large sync sets.
+type DynamoDBStateStore struct {
+	Table  string
+	client dynamodbiface.DynamoDBAPI
+}
+
+func (d *DynamoDBStateStore) Load(key string, v interface{}) (bool, error) {
+	out, err := d.client.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(d.Table),
+		Key:       map[string]*dynamodb.AttributeValue{"Key": {S: aws.String(key)}},
+	})
+	if err != nil {
+		return false, fmt.Errorf("unable to get state item %s: %s", key, err)
+	}
+	value, ok := out.Item["Value"]
+	if !ok || value.S == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal([]byte(*value.S), v)
+}
+
+func (d *DynamoDBStateStore) Save(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("unable to marshal state for %s: %s", key, err)
+	}
+	_, err = d.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(d.Table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"Key":   {S: aws.String(key)},
+			"Value": {S: aws.String(string(data))},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to put state item %s: %s", key, err)
+	}
+	return nil
+}
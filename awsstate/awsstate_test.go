@@ -0,0 +1,131 @@
+package awsstate
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// fakeS3 keeps objects in memory by key. Calls to other methods of the S3API panic.
+type fakeS3 struct {
+	s3iface.S3API
+	objects map[string][]byte
+	err     error
+}
+
+func (f *fakeS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	data, ok := f.objects[*input.Key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	data, _ := ioutil.ReadAll(input.Body)
+	f.objects[*input.Key] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+// fakeDynamoDB keeps items in memory by their Key attribute. Calls to other methods of the DynamoDBAPI panic.
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	items map[string]map[string]*dynamodb.AttributeValue
+	err   error
+}
+
+func (f *fakeDynamoDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &dynamodb.GetItemOutput{Item: f.items[*input.Key["Key"].S]}, nil
+}
+
+func (f *fakeDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.items[*input.Item["Key"].S] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+type testState struct {
+	Names []string
+}
+
+func TestS3StateStore(t *testing.T) {
+	client := &fakeS3{objects: map[string][]byte{}}
+	store := &S3StateStore{Bucket: "state", Prefix: "production", client: client}
+
+	var got testState
+	if found, err := store.Load("staff", &got); found || err != nil {
+		t.Fatalf("Load() of a missing key = %v, %v, want false, nil", found, err)
+	}
+
+	want := testState{Names: []string{"ann", "bob"}}
+	if err := store.Save("staff", want); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+	if _, ok := client.objects["production/staff.json"]; !ok {
+		t.Errorf("Save() wrote %v, want the object production/staff.json", client.objects)
+	}
+	if found, err := store.Load("staff", &got); !found || err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %v, %v, %+v, want true, nil, %+v", found, err, got, want)
+	}
+
+	if key := (&S3StateStore{}).objectKey("staff"); key != "staff.json" {
+		t.Errorf("objectKey() without a Prefix = %q, want staff.json", key)
+	}
+
+	client.err = errors.New("access denied")
+	if _, err := store.Load("staff", &got); err == nil {
+		t.Error("Load() did not return the error of GetObject")
+	}
+	if err := store.Save("staff", want); err == nil {
+		t.Error("Save() did not return the error of PutObject")
+	}
+}
+
+func TestDynamoDBStateStore(t *testing.T) {
+	client := &fakeDynamoDB{items: map[string]map[string]*dynamodb.AttributeValue{}}
+	store := &DynamoDBStateStore{Table: "state", client: client}
+
+	var got testState
+	if found, err := store.Load("staff", &got); found || err != nil {
+		t.Fatalf("Load() of a missing key = %v, %v, want false, nil", found, err)
+	}
+
+	want := testState{Names: []string{"ann", "bob"}}
+	if err := store.Save("staff", want); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+	if value := client.items["staff"]["Value"]; value == nil || aws.StringValue(value.S) != `{"Names":["ann","bob"]}` {
+		t.Errorf("Save() wrote %v, want the JSON of the state in Value", client.items["staff"])
+	}
+	if found, err := store.Load("staff", &got); !found || err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %v, %v, %+v, want true, nil, %+v", found, err, got, want)
+	}
+
+	client.err = errors.New("access denied")
+	if _, err := store.Load("staff", &got); err == nil {
+		t.Error("Load() did not return the error of GetItem")
+	}
+	if err := store.Save("staff", want); err == nil {
+		t.Error("Save() did not return the error of PutItem")
+	}
+}
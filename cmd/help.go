@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+// subcommands are the subcommands that are completed, with the words that are completed after each. The types of
+// sources and destinations are completed after help.
+var subcommands = []struct {
+	name  string
+	words []string
+}{
+	{name: "plan", words: []string{"-out"}},
+	{name: "apply", words: []string{"-plan"}},
+	{name: "config", words: []string{"diff", "-json"}},
+	{name: "help"},
+	{name: "completion", words: []string{"bash", "zsh"}},
+}
+
+// writeHelp writes the usage and the registered source, destination, and state store types
+func writeHelp(w io.Writer, command string) {
+	fmt.Fprintf(w, usage, command)
+	fmt.Fprintf(w, "\nSource types:\n  %s\n", strings.Join(internal.SourceTypes(), "\n  "))
+	fmt.Fprintf(w, "\nDestination types:\n  %s\n", strings.Join(internal.DestinationTypes(), "\n  "))
+	fmt.Fprintf(w, "\nState store types:\n  %s\n", strings.Join(internal.StateStoreTypes(), "\n  "))
+	fmt.Fprintf(w, "\nRun \"%s help <type>\" for the ExtraJSON and sync set fields of a source or destination type.\n",
+		command)
+}
+
+// writeTypeHelp writes the ExtraJSON and sync set fields of a source or destination type. A type that is both, such
+// as RestAPI, is described as each.
+func writeTypeHelp(w io.Writer, adapterType string) error {
+	found := false
+	for _, sourceType := range internal.SourceTypes() {
+		if strings.EqualFold(sourceType, adapterType) {
+			found = true
+			config, _ := internal.DescribedSource(sourceType)
+			writeAdapterConfig(w, sourceType+" source", config)
+		}
+	}
+	for _, destinationType := range internal.DestinationTypes() {
+		if strings.EqualFold(destinationType, adapterType) {
+			found = true
+			config, _ := internal.DescribedDestination(destinationType)
+			writeAdapterConfig(w, destinationType+" destination", config)
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown source or destination type %q", adapterType)
+	}
+	return nil
+}
+
+func writeAdapterConfig(w io.Writer, title string, config internal.AdapterConfig) {
+	fmt.Fprintf(w, "%s\n", title)
+	if fields := config.ExtraJSONFields(); len(fields) > 0 {
+		fmt.Fprintf(w, "\nExtraJSON fields:\n%s", internal.FormatConfigFields(fields))
+	}
+	if fields := config.SyncSetFields(); len(fields) > 0 {
+		fmt.Fprintf(w, "\nSync set fields:\n%s", internal.FormatConfigFields(fields))
+	}
+	fmt.Fprintln(w)
+}
+
+// adapterTypes returns the source and destination types, once each
+func adapterTypes() []string {
+	types := internal.SourceTypes()
+	seen := map[string]bool{}
+	for _, t := range types {
+		seen[t] = true
+	}
+	for _, t := range internal.DestinationTypes() {
+		if !seen[t] {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+const bashCompletion = `# bash completion for %[1]s
+_%[2]s() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    if [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=($(compgen -W "%[3]s" -- "$cur"))
+        return
+    fi
+    case "${COMP_WORDS[1]}" in
+%[4]s    esac
+}
+complete -o default -F _%[2]s %[1]s
+`
+
+const zshCompletion = `#compdef %[1]s
+_%[2]s() {
+    if (( CURRENT == 2 )); then
+        compadd -- %[3]s
+        return
+    fi
+    case "${words[2]}" in
+%[4]s    esac
+    _files
+}
+compdef _%[2]s %[1]s
+`
+
+// writeCompletion writes a completion script for the shell, completing the subcommands, their flags, and the types
+// for help
+func writeCompletion(w io.Writer, shell, command string) error {
+	var script, caseFormat string
+	switch shell {
+	case "bash":
+		script = bashCompletion
+		caseFormat = "        %s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n"
+	case "zsh":
+		script = zshCompletion
+		caseFormat = "        %s) compadd -- %s ;;\n"
+	default:
+		return fmt.Errorf("unsupported shell %q, must be bash or zsh", shell)
+	}
+
+	var names []string
+	var cases strings.Builder
+	for _, subcommand := range subcommands {
+		names = append(names, subcommand.name)
+		words := subcommand.words
+		if subcommand.name == "help" {
+			words = adapterTypes()
+		}
+		fmt.Fprintf(&cases, caseFormat, subcommand.name, strings.Join(words, " "))
+	}
+
+	function := strings.NewReplacer("-", "_", ".", "_").Replace(command)
+	fmt.Fprintf(w, script, command, function, strings.Join(names, " "), cases.String())
+	return nil
+}
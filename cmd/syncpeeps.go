@@ -1,13 +1,81 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/silinternational/personnel-sync/v5"
+	_ "github.com/silinternational/personnel-sync/v5/adapters"
 )
 
+const usage = `Usage:
+  %[1]s                           run a sync, applying all changes
+  %[1]s plan [-out plan.json]     write the changes to a signed plan file without applying them
+  %[1]s apply -plan plan.json     apply the changes in a plan file, if they are still current
+  %[1]s config diff [-json] old.json new.json
+                                  show the differences between two config files
+  %[1]s help [type]               list the source and destination types, or the fields of one type
+  %[1]s completion bash|zsh       write a shell completion script
+
+The config file is read from the CONFIG_PATH environment variable, or ./config.json by default.
+`
+
 func main() {
-	if err := personnel_sync.RunSync(""); err != nil {
+	if len(os.Args) < 2 {
+		if err := personnel_sync.RunSync(""); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "plan":
+		flags := flag.NewFlagSet("plan", flag.ExitOnError)
+		out := flags.String("out", "plan.json", "path of the plan file to write")
+		_ = flags.Parse(os.Args[2:])
+		err = personnel_sync.RunPlan("", *out)
+	case "apply":
+		flags := flag.NewFlagSet("apply", flag.ExitOnError)
+		planFile := flags.String("plan", "", "path of the plan file to apply")
+		_ = flags.Parse(os.Args[2:])
+		if *planFile == "" {
+			fmt.Fprintln(os.Stderr, "apply requires -plan")
+			os.Exit(2)
+		}
+		err = personnel_sync.RunApply("", *planFile)
+	case "config":
+		flags := flag.NewFlagSet("config diff", flag.ExitOnError)
+		asJSON := flags.Bool("json", false, "write the differences as JSON")
+		if len(os.Args) > 2 && os.Args[2] == "diff" {
+			_ = flags.Parse(os.Args[3:])
+		}
+		if len(os.Args) < 3 || os.Args[2] != "diff" || flags.NArg() != 2 {
+			fmt.Fprintf(os.Stderr, usage, os.Args[0])
+			os.Exit(2)
+		}
+		err = personnel_sync.RunConfigDiff(flags.Arg(0), flags.Arg(1), *asJSON)
+	case "help", "-h", "-help", "--help":
+		if len(os.Args) < 3 {
+			writeHelp(os.Stdout, os.Args[0])
+			break
+		}
+		err = writeTypeHelp(os.Stdout, os.Args[2])
+	case "completion":
+		if len(os.Args) != 3 {
+			fmt.Fprintf(os.Stderr, usage, os.Args[0])
+			os.Exit(2)
+		}
+		err = writeCompletion(os.Stdout, os.Args[2], filepath.Base(os.Args[0]))
+	default:
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 	os.Exit(0)
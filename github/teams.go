@@ -0,0 +1,341 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+const (
+	DefaultBaseURL           = "https://api.github.com"
+	DefaultBatchSize         = 10
+	DefaultBatchDelaySeconds = 1
+	DefaultPageSize          = 100
+
+	// UsernameAttribute is the destination attribute holding a person's GitHub login
+	UsernameAttribute = "githubUsername"
+
+	RoleMember     = "member"
+	RoleMaintainer = "maintainer"
+)
+
+// GitHubTeams is a destination for the membership of the teams of a GitHub organization
+type GitHubTeams struct {
+	// BaseURL is the API URL, https://api.github.com unless using GitHub Enterprise Server
+	BaseURL string
+
+	// Token is a personal access token or app installation token with the admin:org scope
+	Token string
+
+	Organization string
+
+	// BatchSize changes are made every BatchDelaySeconds, to stay within the API rate limits
+	BatchSize         int
+	BatchDelaySeconds int
+
+	// PageSize is the number of members listed per request, at most 100
+	PageSize int
+
+	Retry internal.RetryConfig
+
+	// Proxy is a SOCKS5 proxy for all requests, such as to a GitHub Enterprise Server behind a firewall
+	Proxy internal.ProxyConfig
+
+	TeamSyncSet TeamSyncSet
+	client      *http.Client
+}
+
+// TeamSyncSet selects the team for a sync set by its slug
+type TeamSyncSet struct {
+	Team string
+
+	// Role of new members, member (the default) or maintainer
+	Role string
+
+	// ExtraMembers are logins that are added to the team, but never removed, such as bot accounts
+	ExtraMembers  []string
+	DisableAdd    bool
+	DisableDelete bool
+}
+
+type githubUser struct {
+	Login string `json:"login"`
+	ID    int64  `json:"id"`
+}
+
+func init() {
+	internal.RegisterDestination(internal.DestinationTypeGitHubTeams, NewGitHubTeamsDestination)
+
+	internal.DescribeDestination(internal.DestinationTypeGitHubTeams, internal.AdapterConfig{
+		ExtraJSON: []interface{}{GitHubTeams{}},
+		SyncSet:   TeamSyncSet{},
+	})
+}
+
+// NewGitHubTeamsDestination unmarshals the destinationConfig's ExtraJSON into a GitHubTeams struct
+func NewGitHubTeamsDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var g GitHubTeams
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &g); err != nil {
+		return &GitHubTeams{}, err
+	}
+
+	if g.Token == "" || g.Organization == "" {
+		return &GitHubTeams{}, errors.New("Token and Organization are required for GitHubTeams")
+	}
+
+	if g.BaseURL == "" {
+		g.BaseURL = DefaultBaseURL
+	}
+	g.BaseURL = strings.TrimSuffix(g.BaseURL, "/")
+	if g.BatchSize <= 0 {
+		g.BatchSize = DefaultBatchSize
+	}
+	if g.BatchDelaySeconds <= 0 {
+		g.BatchDelaySeconds = DefaultBatchDelaySeconds
+	}
+	if g.PageSize <= 0 || g.PageSize > DefaultPageSize {
+		g.PageSize = DefaultPageSize
+	}
+	var err error
+	if g.client, err = g.Proxy.Client(time.Minute); err != nil {
+		return &GitHubTeams{}, err
+	}
+
+	return &g, nil
+}
+
+func (g *GitHubTeams) ForSet(syncSetJson json.RawMessage) error {
+	var syncSetConfig TeamSyncSet
+	if err := json.Unmarshal(syncSetJson, &syncSetConfig); err != nil {
+		return err
+	}
+
+	if syncSetConfig.Team == "" {
+		return errors.New("Team missing from sync set json")
+	}
+
+	switch syncSetConfig.Role {
+	case "":
+		syncSetConfig.Role = RoleMember
+	case RoleMember, RoleMaintainer:
+	default:
+		return fmt.Errorf("invalid Role %q for team %s, must be member or maintainer", syncSetConfig.Role,
+			syncSetConfig.Team)
+	}
+
+	g.TeamSyncSet = syncSetConfig
+	return nil
+}
+
+// ListUsers returns the members of the team, including those with a pending invitation to the organization, so
+// that they are not invited again
+func (g *GitHubTeams) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+	users, err := g.listAll("/members?role=all")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get members of team %s: %s", g.TeamSyncSet.Team, err)
+	}
+
+	invitations, err := g.listAll("/invitations")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get invitations to team %s: %s", g.TeamSyncSet.Team, err)
+	}
+
+	var members []internal.Person
+	for _, u := range append(users, invitations...) {
+		// invitations by email address have no login
+		if u.Login == "" {
+			continue
+		}
+
+		// Do not include ExtraMembers in list to prevent inclusion in delete list
+		if g.isExtraMember(u.Login) {
+			continue
+		}
+
+		members = append(members, internal.Person{
+			CompareValue: u.Login,
+			ID:           u.Login,
+			Attributes: map[string]string{
+				"id":              u.Login,
+				UsernameAttribute: u.Login,
+			},
+		})
+	}
+
+	return members, nil
+}
+
+func (g *GitHubTeams) listAll(path string) ([]githubUser, error) {
+	var all []githubUser
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	for page := 1; ; page++ {
+		body, err := g.request(http.MethodGet, fmt.Sprintf("%s%s%sper_page=%v&page=%v", g.teamPath(), path,
+			separator, g.PageSize, page), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var users []githubUser
+		if err := json.Unmarshal(body, &users); err != nil {
+			return nil, fmt.Errorf("unable to parse response: %s", err)
+		}
+		all = append(all, users...)
+
+		if len(users) < g.PageSize {
+			return all, nil
+		}
+	}
+}
+
+func (g *GitHubTeams) ApplyChangeSet(changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem) internal.ChangeResults {
+
+	var results internal.ChangeResults
+	var wg sync.WaitGroup
+	batchTimer := internal.NewBatchTimer(g.BatchSize, g.BatchDelaySeconds)
+
+	if !g.TeamSyncSet.DisableAdd {
+		toBeAdded := make([]string, 0, len(changes.Create)+len(g.TeamSyncSet.ExtraMembers))
+		for _, person := range changes.Create {
+			toBeAdded = append(toBeAdded, username(person))
+		}
+		toBeAdded = append(toBeAdded, g.TeamSyncSet.ExtraMembers...)
+
+		for _, login := range toBeAdded {
+			wg.Add(1)
+			go g.addMember(login, &results.Created, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	if !g.TeamSyncSet.DisableDelete {
+		for _, person := range changes.Delete {
+			wg.Add(1)
+			go g.removeMember(person.CompareValue, &results.Deleted, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	wg.Wait()
+	return results
+}
+
+// username is the GitHub login of a source person, the githubUsername attribute if it is mapped
+func username(person internal.Person) string {
+	if login := person.Attributes[UsernameAttribute]; login != "" {
+		return login
+	}
+	return person.CompareValue
+}
+
+func (g *GitHubTeams) addMember(login string, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	body, err := g.request(http.MethodPut, g.teamPath()+"/memberships/"+url.PathEscape(login),
+		map[string]string{"role": g.TeamSyncSet.Role})
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  fmt.Sprintf("unable to add %s to team %s: %s", login, g.TeamSyncSet.Team, err)}
+		return
+	}
+
+	var membership struct {
+		State string `json:"state"`
+	}
+	_ = json.Unmarshal(body, &membership)
+
+	message := fmt.Sprintf("AddMember %s to %s", login, g.TeamSyncSet.Team)
+	if membership.State == "pending" {
+		message += ", invited to the organization"
+	}
+	eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: message}
+	atomic.AddUint64(counter, 1)
+}
+
+func (g *GitHubTeams) removeMember(login string, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	if _, err := g.request(http.MethodDelete, g.teamPath()+"/memberships/"+url.PathEscape(login), nil); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  fmt.Sprintf("unable to remove %s from team %s: %s", login, g.TeamSyncSet.Team, err)}
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: fmt.Sprintf("RemoveMember %s from %s", login, g.TeamSyncSet.Team),
+	}
+	atomic.AddUint64(counter, 1)
+}
+
+func (g *GitHubTeams) isExtraMember(login string) bool {
+	for _, extra := range g.TeamSyncSet.ExtraMembers {
+		if strings.EqualFold(extra, login) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *GitHubTeams) teamPath() string {
+	return fmt.Sprintf("/orgs/%s/teams/%s", url.PathEscape(g.Organization), url.PathEscape(g.TeamSyncSet.Team))
+}
+
+func (g *GitHubTeams) request(method, path string, body interface{}) ([]byte, error) {
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		if bodyBytes, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("unable to marshal request body: %s", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, g.BaseURL+path, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+g.Token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.Retry.Do(g.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read http response body: %s", err)
+	}
+	if resp.StatusCode >= 400 {
+		return respBody, internal.NewStatusError(resp.StatusCode, resp.Header.Get("Retry-After"),
+			fmt.Errorf("status: %d, body: %s", resp.StatusCode, respBody))
+	}
+	return respBody, nil
+}
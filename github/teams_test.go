@@ -0,0 +1,199 @@
+package github
+
+import (
+	"encoding/json"
+	"log/syslog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+// fakeGitHub is an in-memory organization with one team, eng
+type fakeGitHub struct {
+	sync.Mutex
+	members map[string]string
+	pending map[string]bool
+	known   map[string]bool
+}
+
+func newFakeGitHub() *fakeGitHub {
+	return &fakeGitHub{
+		members: map[string]string{"alice": RoleMaintainer, "bob": RoleMember, "ci-bot": RoleMember},
+		pending: map[string]bool{"carol": true},
+		known:   map[string]bool{"alice": true, "bob": true, "carol": true, "dave": true, "ci-bot": true},
+	}
+}
+
+func (f *fakeGitHub) server(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.Lock()
+		defer f.Unlock()
+
+		const team = "/orgs/acme/teams/eng"
+		switch {
+		case r.URL.Path == team+"/members":
+			var logins []string
+			for login := range f.members {
+				logins = append(logins, login)
+			}
+			f.writePage(w, r, logins)
+		case r.URL.Path == team+"/invitations":
+			var logins []string
+			for login := range f.pending {
+				logins = append(logins, login)
+			}
+			f.writePage(w, r, append(logins, ""))
+		case strings.HasPrefix(r.URL.Path, team+"/memberships/"):
+			login := strings.TrimPrefix(r.URL.Path, team+"/memberships/")
+			if !f.known[login] {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.Method == http.MethodDelete {
+				delete(f.members, login)
+				delete(f.pending, login)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			f.members[login] = body["role"]
+			_, _ = w.Write([]byte(`{"state":"active","role":"` + body["role"] + `"}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func (f *fakeGitHub) writePage(w http.ResponseWriter, r *http.Request, logins []string) {
+	sort.Strings(logins)
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+
+	users := []githubUser{}
+	for i := (page - 1) * perPage; i < len(logins) && i < page*perPage; i++ {
+		users = append(users, githubUser{Login: logins[i]})
+	}
+	_ = json.NewEncoder(w).Encode(users)
+}
+
+func newTestGitHubTeams(t *testing.T, serverURL, setJSON string) *GitHubTeams {
+	config := `{"BaseURL":"` + serverURL + `","Token":"secret","Organization":"acme","PageSize":2}`
+	dest, err := NewGitHubTeamsDestination(internal.DestinationConfig{ExtraJSON: json.RawMessage(config)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dest.ForSet(json.RawMessage(setJSON)); err != nil {
+		t.Fatal(err)
+	}
+	return dest.(*GitHubTeams)
+}
+
+func TestGitHubTeams_ListUsers(t *testing.T) {
+	fake := newFakeGitHub()
+	server := fake.server(t)
+	defer server.Close()
+
+	g := newTestGitHubTeams(t, server.URL, `{"Team":"eng","ExtraMembers":["CI-Bot"]}`)
+	people, err := g.ListUsers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, p := range people {
+		got = append(got, p.Attributes[UsernameAttribute])
+	}
+	want := []string{"alice", "bob", "carol"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListUsers() = %v, want %v", got, want)
+	}
+}
+
+func TestGitHubTeams_ForSet(t *testing.T) {
+	g := &GitHubTeams{}
+	tests := []struct {
+		setJSON string
+		wantErr bool
+	}{
+		{setJSON: `{"Team":"eng"}`},
+		{setJSON: `{"Team":"eng","Role":"maintainer"}`},
+		{setJSON: `{"Team":"eng","Role":"owner"}`, wantErr: true},
+		{setJSON: `{}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := g.ForSet(json.RawMessage(tt.setJSON)); (err != nil) != tt.wantErr {
+			t.Errorf("ForSet(%s) error = %v, wantErr %v", tt.setJSON, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGitHubTeams_ApplyChangeSet(t *testing.T) {
+	tests := []struct {
+		name        string
+		setJSON     string
+		want        internal.ChangeResults
+		wantMembers map[string]string
+		wantErrs    int
+	}{
+		{
+			name:        "add and remove",
+			setJSON:     `{"Team":"eng","Role":"maintainer"}`,
+			want:        internal.ChangeResults{Created: 1, Deleted: 1},
+			wantMembers: map[string]string{"alice": RoleMaintainer, "dave": RoleMaintainer, "ci-bot": RoleMember},
+			wantErrs:    1,
+		},
+		{
+			name:        "disabled",
+			setJSON:     `{"Team":"eng","DisableAdd":true,"DisableDelete":true}`,
+			want:        internal.ChangeResults{},
+			wantMembers: map[string]string{"alice": RoleMaintainer, "bob": RoleMember, "ci-bot": RoleMember},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeGitHub()
+			server := fake.server(t)
+			defer server.Close()
+
+			g := newTestGitHubTeams(t, server.URL, tt.setJSON)
+			eventLog := make(chan internal.EventLogItem, 10)
+			results := g.ApplyChangeSet(internal.ChangeSet{
+				Create: []internal.Person{
+					{CompareValue: "dave@example.org", Attributes: map[string]string{UsernameAttribute: "dave"}},
+					{CompareValue: "nobody"},
+				},
+				Delete: []internal.Person{{CompareValue: "bob"}},
+			}, eventLog)
+			close(eventLog)
+
+			var errs []string
+			for msg := range eventLog {
+				if msg.Level <= syslog.LOG_ERR {
+					errs = append(errs, msg.Message)
+				}
+			}
+			if len(errs) != tt.wantErrs {
+				t.Errorf("errors = %v, want %v", errs, tt.wantErrs)
+			}
+			if !reflect.DeepEqual(results, tt.want) {
+				t.Errorf("results = %+v, want %+v", results, tt.want)
+			}
+			if !reflect.DeepEqual(fake.members, tt.wantMembers) {
+				t.Errorf("members = %v, want %v", fake.members, tt.wantMembers)
+			}
+		})
+	}
+}
@@ -5,9 +5,16 @@ go 1.14
 replace github.com/silinternational/personnel-sync/v5 => ./
 
 require (
+	github.com/Azure/go-ntlmssp v0.0.1
 	github.com/Jeffail/gabs/v2 v2.5.1
-	github.com/aws/aws-lambda-go v1.19.1 // indirect
+	github.com/aws/aws-lambda-go v1.19.1
 	github.com/aws/aws-sdk-go v1.34.33
+	github.com/denisenkom/go-mssqldb v0.9.0
+	github.com/go-sql-driver/mysql v1.5.0
+	github.com/jcmturner/gokrb5/v8 v8.4.2
+	github.com/lib/pq v1.9.0
+	github.com/pkg/sftp v1.12.0
+	golang.org/x/crypto v0.0.0-20201112155050-0c6587e931a9
 	golang.org/x/net v0.0.0-20200822124328-c89045814202
 	golang.org/x/oauth2 v0.0.0-20200902213428-5d25da1a8d43
 	google.golang.org/api v0.32.0
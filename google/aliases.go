@@ -0,0 +1,133 @@
+package google
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2/google"
+	admin "google.golang.org/api/admin/directory/v1"
+	gmail "google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+	"github.com/silinternational/personnel-sync/v5/pkg/diff"
+)
+
+// updateAliases makes the aliases of the user those in the list, separated by commas. Aliases that are not in the
+// list are removed. If SendAsAliases is set, a send-as address is added and removed along with each alias.
+func (g *GoogleUsers) updateAliases(email, list string, oldAliases []string) error {
+	var aliases []string
+	if list = diff.NormalizeList(list, false); list != "" {
+		aliases = strings.Split(list, ",")
+	}
+
+	want := map[string]bool{}
+	for _, alias := range aliases {
+		want[strings.ToLower(alias)] = true
+	}
+	have := map[string]bool{}
+	for _, alias := range oldAliases {
+		have[strings.ToLower(alias)] = true
+	}
+
+	for _, alias := range aliases {
+		if have[strings.ToLower(alias)] {
+			continue
+		}
+		if _, err := g.AdminService.Users.Aliases.Insert(email, &admin.Alias{Alias: alias}).Do(); err != nil {
+			return fmt.Errorf("unable to add alias %s: %s", alias, err)
+		}
+		if g.SendAsAliases {
+			if err := g.addSendAs(email, alias); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, alias := range oldAliases {
+		if want[strings.ToLower(alias)] {
+			continue
+		}
+		if g.SendAsAliases {
+			if err := g.removeSendAs(email, alias); err != nil {
+				return err
+			}
+		}
+		if err := g.AdminService.Users.Aliases.Delete(email, alias).Do(); err != nil {
+			return fmt.Errorf("unable to remove alias %s: %s", alias, err)
+		}
+	}
+	return nil
+}
+
+// addSendAs adds the alias as a send-as address of the user, unless it already is one
+func (g *GoogleUsers) addSendAs(email, alias string) error {
+	service, err := g.gmailService(email, gmail.GmailSettingsSharingScope)
+	if err != nil {
+		return err
+	}
+	sendAs := &gmail.SendAs{SendAsEmail: alias, TreatAsAlias: true}
+	_, err = service.Users.Settings.SendAs.Create("me", sendAs).Do()
+	if err != nil && !isStatus(err, http.StatusConflict) {
+		return fmt.Errorf("unable to add send-as address %s: %s", alias, err)
+	}
+	return nil
+}
+
+// removeSendAs removes the alias from the send-as addresses of the user, if it is one
+func (g *GoogleUsers) removeSendAs(email, alias string) error {
+	service, err := g.gmailService(email, gmail.GmailSettingsSharingScope)
+	if err != nil {
+		return err
+	}
+	err = service.Users.Settings.SendAs.Delete("me", alias).Do()
+	if err != nil && !isStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("unable to remove send-as address %s: %s", alias, err)
+	}
+	return nil
+}
+
+// gmailService returns a Gmail API service with the scopes that acts as the user, since mail settings such as
+// send-as addresses can only be managed by the user themselves
+func (g *GoogleUsers) gmailService(email string, scopes ...string) (*gmail.Service, error) {
+	if g.GmailService != nil {
+		return g.GmailService(email)
+	}
+
+	googleAuthJson, err := json.Marshal(g.GoogleConfig.GoogleAuth)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal google auth data into json, error: %s", err)
+	}
+
+	config, err := google.JWTConfigFromJSON(googleAuthJson, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse client secret file to config: %s", err)
+	}
+
+	ctx := context.Background()
+	config.Subject = email
+	service, err := gmail.NewService(ctx, option.WithHTTPClient(config.Client(ctx)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Gmail API service for %s: %s", email, err)
+	}
+	return service, nil
+}
+
+func isStatus(err error, code int) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	return ok && apiErr.Code == code
+}
+
+// statusError returns the error as an internal error type, such as a RateLimitError, if cause is a Google API error
+// with a status code that has one
+func statusError(cause, err error) error {
+	apiErr, ok := cause.(*googleapi.Error)
+	if !ok {
+		return err
+	}
+	return internal.NewStatusError(apiErr.Code, apiErr.Header.Get("Retry-After"), err)
+}
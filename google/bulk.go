@@ -0,0 +1,183 @@
+package google
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+// DefaultBulkWindowMinutes is how long a run adds the members of a group in bulk mode if WindowMinutes is not set
+const DefaultBulkWindowMinutes = 50
+
+// DefaultBulkProgressEvery is how many members are added between progress reports if ProgressEvery is not set
+const DefaultBulkProgressEvery = 500
+
+// BulkConfig adds the members of a group in bulk mode when there are many to add, such as the first load of a
+// large group. In bulk mode, members are added for at most WindowMinutes in each run, and the rest are added by the
+// next runs. Progress is logged as members are added, and is kept in the state store, if there is one, until all of
+// the members have been added.
+type BulkConfig struct {
+	// Threshold is the number of members to be added to a group at which bulk mode is used. Zero turns bulk mode
+	// off.
+	Threshold int
+
+	// WindowMinutes is how long a run adds members to a group in bulk mode
+	WindowMinutes int
+
+	// ProgressEvery is how many members are added between progress reports
+	ProgressEvery int
+}
+
+// bulkCheckpoint is the progress of a bulk load of a group across runs
+type bulkCheckpoint struct {
+	Total   int
+	Added   int
+	Started time.Time
+}
+
+// bulkLoad is the bulk load of a group in the current run
+type bulkLoad struct {
+	groupEmail    string
+	checkpoint    bulkCheckpoint
+	deadline      time.Time
+	progressEvery int
+	dispatched    int
+	remaining     int
+}
+
+// startBulkLoad returns the bulk load of the group of the sync set if the number of members to be added reaches the
+// Threshold, or if a bulk load that was started by an earlier run is not finished. Otherwise, it returns nil. A
+// bulk load that has no members left to add is finished.
+func (g *GoogleGroups) startBulkLoad(toBeAdded int, eventLog chan<- internal.EventLogItem) *bulkLoad {
+	if g.Bulk.Threshold <= 0 {
+		return nil
+	}
+	groupEmail := g.GroupSyncSet.GroupEmail
+	checkpoint := g.loadBulkCheckpoint(eventLog)
+
+	if toBeAdded == 0 {
+		if checkpoint.Total > 0 {
+			eventLog <- internal.EventLogItem{
+				Level: syslog.LOG_INFO,
+				Message: fmt.Sprintf("BulkLoad %s: complete, %v members added since %s", groupEmail,
+					checkpoint.Added, checkpoint.Started.UTC().Format(time.RFC3339)),
+			}
+			g.saveBulkCheckpoint(bulkCheckpoint{}, eventLog)
+		}
+		return nil
+	}
+	if checkpoint.Total == 0 && toBeAdded < g.Bulk.Threshold {
+		return nil
+	}
+
+	now := g.getClock().Now()
+	if checkpoint.Total == 0 {
+		checkpoint.Started = now
+	}
+	if total := checkpoint.Added + toBeAdded; total > checkpoint.Total {
+		checkpoint.Total = total
+	}
+
+	windowMinutes := g.Bulk.WindowMinutes
+	if windowMinutes <= 0 {
+		windowMinutes = DefaultBulkWindowMinutes
+	}
+	progressEvery := g.Bulk.ProgressEvery
+	if progressEvery <= 0 {
+		progressEvery = DefaultBulkProgressEvery
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level: syslog.LOG_INFO,
+		Message: fmt.Sprintf("BulkLoad %s: %v of %v members added, adding up to %v minutes of the remaining %v",
+			groupEmail, checkpoint.Added, checkpoint.Total, windowMinutes, toBeAdded),
+	}
+	return &bulkLoad{
+		groupEmail:    groupEmail,
+		checkpoint:    checkpoint,
+		deadline:      now.Add(time.Duration(windowMinutes) * time.Minute),
+		progressEvery: progressEvery,
+		remaining:     toBeAdded,
+	}
+}
+
+// windowEnded reports whether the time window of the run has ended, so that no more members are to be added
+func (b *bulkLoad) windowEnded(clock internal.Clock) bool {
+	return !clock.Now().Before(b.deadline)
+}
+
+// dispatch counts a member whose addition has been started, and reports the progress every progressEvery members.
+// added is the number of members added by the run so far.
+func (b *bulkLoad) dispatch(added uint64, eventLog chan<- internal.EventLogItem) {
+	b.dispatched++
+	if b.dispatched%b.progressEvery != 0 {
+		return
+	}
+	eventLog <- internal.EventLogItem{
+		Level: syslog.LOG_INFO,
+		Message: fmt.Sprintf("BulkLoad %s: %v of %v members added", b.groupEmail,
+			b.checkpoint.Added+int(added), b.checkpoint.Total),
+	}
+}
+
+// finishBulkRun records the members added by the run in the checkpoint, and reports the progress
+func (g *GoogleGroups) finishBulkRun(b *bulkLoad, added uint64, eventLog chan<- internal.EventLogItem) {
+	b.checkpoint.Added += int(added)
+	if b.checkpoint.Added > b.checkpoint.Total {
+		b.checkpoint.Total = b.checkpoint.Added
+	}
+	g.saveBulkCheckpoint(b.checkpoint, eventLog)
+
+	message := fmt.Sprintf("BulkLoad %s: %v of %v members added", b.groupEmail, b.checkpoint.Added,
+		b.checkpoint.Total)
+	if remaining := b.remaining - int(added); remaining > 0 {
+		message += fmt.Sprintf(", the remaining %v are added by the next run", remaining)
+	}
+	eventLog <- internal.EventLogItem{Level: syslog.LOG_INFO, Message: message}
+}
+
+func (g *GoogleGroups) bulkCheckpointKey() string {
+	return "googlegroups/bulk/" + strings.ToLower(g.GroupSyncSet.GroupEmail)
+}
+
+// loadBulkCheckpoint returns the progress of the bulk load of the group, or an empty checkpoint if none is stored
+func (g *GoogleGroups) loadBulkCheckpoint(eventLog chan<- internal.EventLogItem) bulkCheckpoint {
+	var checkpoint bulkCheckpoint
+	if g.stateStore == nil {
+		return checkpoint
+	}
+	if _, err := g.stateStore.Load(g.bulkCheckpointKey(), &checkpoint); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_WARNING,
+			Message: fmt.Sprintf("unable to load bulk load progress of %s: %s", g.GroupSyncSet.GroupEmail, err),
+		}
+	}
+	return checkpoint
+}
+
+func (g *GoogleGroups) saveBulkCheckpoint(checkpoint bulkCheckpoint, eventLog chan<- internal.EventLogItem) {
+	if g.stateStore == nil {
+		return
+	}
+	if err := g.stateStore.Save(g.bulkCheckpointKey(), checkpoint); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_WARNING,
+			Message: fmt.Sprintf("unable to save bulk load progress of %s: %s", g.GroupSyncSet.GroupEmail, err),
+		}
+	}
+}
+
+// SetStateStore sets the state store that keeps the progress of bulk loads
+func (g *GoogleGroups) SetStateStore(stateStore internal.StateStore) {
+	g.stateStore = stateStore
+}
+
+func (g *GoogleGroups) getClock() internal.Clock {
+	if g.clock == nil {
+		return internal.SystemClock
+	}
+	return g.clock
+}
@@ -0,0 +1,363 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/syslog"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/oauth2/google"
+	calendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+// The roles that a person can be given on a calendar
+const (
+	CalendarRoleFreeBusyReader = "freeBusyReader"
+	CalendarRoleReader         = "reader"
+	CalendarRoleWriter         = "writer"
+	CalendarRoleOwner          = "owner"
+)
+
+// calendarRolePattern matches the roles that a person can be given on a calendar
+var calendarRolePattern = regexp.MustCompile(`^(?i)(freeBusyReader|reader|writer|owner)$`)
+
+// aclScopeUser is the scope type of an ACL rule that gives access to one person
+const aclScopeUser = "user"
+
+// GoogleCalendar is a destination that shares calendars, such as a shared calendar or the calendar of a room or
+// other resource, with the people in the source, by managing the access control list (ACL) of each calendar. Only
+// the rules for individual users are synced; rules for groups, domains, and the public are left as they are.
+type GoogleCalendar struct {
+	DestinationConfig internal.DestinationConfig
+	GoogleConfig      GoogleConfig
+	CalendarSyncSet   CalendarSyncSet
+	BatchSize         int
+	BatchDelaySeconds int
+
+	// SendNotifications emails each person who is given access to a calendar
+	SendNotifications bool
+
+	// CalendarService manages calendar ACLs. It is created with the calendar scope, on behalf of the
+	// DelegatedAdminEmail, who must be able to share the calendars.
+	CalendarService *calendar.Service `json:"-"`
+
+	// ruleIDs holds the ID of the ACL rule of each listed person, by lowercase email
+	ruleIDs map[string]string
+
+	// owners holds the lowercase email of each person with the owner role, who is not listed
+	owners map[string]bool
+}
+
+type CalendarSyncSet struct {
+	// CalendarID is the ID of the calendar, such as the ID of a shared calendar, or the email address of a resource
+	CalendarID string
+
+	// Role is given to each person who has no Role attribute: freeBusyReader, reader, writer, or owner. It is
+	// reader if it is not set.
+	Role string
+
+	DisableAdd    bool
+	DisableUpdate bool
+	DisableDelete bool
+}
+
+func NewGoogleCalendarDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var googleCalendar GoogleCalendar
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &googleCalendar.GoogleConfig); err != nil {
+		return &GoogleCalendar{}, err
+	}
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &googleCalendar); err != nil {
+		return &GoogleCalendar{}, err
+	}
+	googleCalendar.DestinationConfig = destinationConfig
+
+	if googleCalendar.BatchSize <= 0 {
+		googleCalendar.BatchSize = DefaultBatchSize
+	}
+	if googleCalendar.BatchDelaySeconds <= 0 {
+		googleCalendar.BatchDelaySeconds = DefaultBatchDelaySeconds
+	}
+
+	service, err := initCalendarService(googleCalendar.GoogleConfig.GoogleAuth,
+		googleCalendar.GoogleConfig.DelegatedAdminEmail)
+	if err != nil {
+		return &GoogleCalendar{}, err
+	}
+	googleCalendar.CalendarService = service
+
+	return &googleCalendar, nil
+}
+
+func initCalendarService(auth GoogleAuth, adminEmail string) (*calendar.Service, error) {
+	googleAuthJson, err := json.Marshal(auth)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal google auth data into json, error: %s", err)
+	}
+
+	config, err := google.JWTConfigFromJSON(googleAuthJson, calendar.CalendarScope)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse client secret file to config: %s", err)
+	}
+
+	ctx := context.Background()
+	config.Subject = adminEmail
+	service, err := calendar.NewService(ctx, option.WithHTTPClient(config.Client(ctx)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Calendar API service: %s", err)
+	}
+	return service, nil
+}
+
+func (g *GoogleCalendar) ForSet(syncSetJson json.RawMessage) error {
+	var syncSetConfig CalendarSyncSet
+	if err := json.Unmarshal(syncSetJson, &syncSetConfig); err != nil {
+		return err
+	}
+
+	if syncSetConfig.CalendarID == "" {
+		return errors.New("CalendarID missing from sync set json")
+	}
+	if syncSetConfig.Role == "" {
+		syncSetConfig.Role = CalendarRoleReader
+	}
+	role, err := calendarRole(syncSetConfig.Role)
+	if err != nil {
+		return fmt.Errorf("invalid Role for calendar %s: %s", syncSetConfig.CalendarID, err)
+	}
+	syncSetConfig.Role = role
+
+	g.CalendarSyncSet = syncSetConfig
+	return nil
+}
+
+// LintRules checks that people are email addresses with a valid role
+func (g *GoogleCalendar) LintRules() []internal.LintRule {
+	return []internal.LintRule{
+		{Attribute: "Email", Pattern: internal.EmailAddressPattern, Description: "an email address"},
+		{
+			Attribute:   RoleAttribute,
+			Pattern:     calendarRolePattern,
+			Description: "freeBusyReader, reader, writer, or owner",
+		},
+	}
+}
+
+// ListUsers lists the people that the calendar is shared with. People with the owner role are not listed, so that
+// they are not changed or removed.
+func (g *GoogleCalendar) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+	g.ruleIDs = map[string]string{}
+	g.owners = map[string]bool{}
+
+	calendarID := g.CalendarSyncSet.CalendarID
+	var rules []*calendar.AclRule
+	err := g.CalendarService.Acl.List(calendarID).Pages(context.Background(), func(acl *calendar.Acl) error {
+		rules = append(rules, acl.Items...)
+		return nil
+	})
+	if err != nil {
+		return []internal.Person{}, statusError(err, fmt.Errorf("unable to list the ACL of calendar %s: %s",
+			calendarID, err))
+	}
+
+	var people []internal.Person
+	for _, rule := range rules {
+		if rule.Scope == nil || rule.Scope.Type != aclScopeUser {
+			continue
+		}
+		email := strings.ToLower(rule.Scope.Value)
+		if rule.Role == CalendarRoleOwner {
+			g.owners[email] = true
+			continue
+		}
+		g.ruleIDs[email] = rule.Id
+		people = append(people, internal.Person{
+			CompareValue: email,
+			Attributes: map[string]string{
+				"Email":       email,
+				RoleAttribute: rule.Role,
+			},
+		})
+	}
+	return people, nil
+}
+
+func (g *GoogleCalendar) ApplyChangeSet(
+	changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem) internal.ChangeResults {
+
+	var results internal.ChangeResults
+	var wg sync.WaitGroup
+	batchTimer := internal.NewBatchTimer(g.BatchSize, g.BatchDelaySeconds)
+
+	if !g.CalendarSyncSet.DisableAdd {
+		for _, person := range changes.Create {
+			// an owner already has every permission
+			if g.owners[strings.ToLower(person.CompareValue)] {
+				continue
+			}
+			role, err := g.personRole(person)
+			if err != nil {
+				eventLog <- internal.EventLogItem{
+					Level: syslog.LOG_ERR,
+					Message: fmt.Sprintf("unable to share calendar %s with %s: %s", g.CalendarSyncSet.CalendarID,
+						person.CompareValue, err)}
+				continue
+			}
+			wg.Add(1)
+			go g.addRule(person.CompareValue, role, &results.Created, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	if !g.CalendarSyncSet.DisableUpdate {
+		for _, person := range changes.Update {
+			role, err := g.personRole(person)
+			if err != nil {
+				eventLog <- internal.EventLogItem{
+					Level: syslog.LOG_ERR,
+					Message: fmt.Sprintf("unable to change the access of %s to calendar %s: %s", person.CompareValue,
+						g.CalendarSyncSet.CalendarID, err)}
+				continue
+			}
+			wg.Add(1)
+			go g.updateRule(person.CompareValue, role, &results.Updated, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	if !g.CalendarSyncSet.DisableDelete {
+		for _, person := range changes.Delete {
+			wg.Add(1)
+			go g.removeRule(person.CompareValue, &results.Deleted, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	wg.Wait()
+	return results
+}
+
+// personRole returns the role in the person's Role attribute, or the Role of the sync set if they have none
+func (g *GoogleCalendar) personRole(person internal.Person) (string, error) {
+	role := strings.TrimSpace(person.Attributes[RoleAttribute])
+	if role == "" {
+		return g.CalendarSyncSet.Role, nil
+	}
+	return calendarRole(role)
+}
+
+// calendarRole returns the role as it is written in the Calendar API, such as freeBusyReader for FREEBUSYREADER
+func calendarRole(role string) (string, error) {
+	if !calendarRolePattern.MatchString(role) {
+		return "", fmt.Errorf("%q is not a role: freeBusyReader, reader, writer, or owner", role)
+	}
+	for _, r := range []string{CalendarRoleFreeBusyReader, CalendarRoleReader, CalendarRoleWriter, CalendarRoleOwner} {
+		if strings.EqualFold(role, r) {
+			return r, nil
+		}
+	}
+	return role, nil
+}
+
+// ruleID returns the ID of the ACL rule of the person
+func (g *GoogleCalendar) ruleID(email string) string {
+	if id, ok := g.ruleIDs[strings.ToLower(email)]; ok {
+		return id
+	}
+	return aclScopeUser + ":" + email
+}
+
+func (g *GoogleCalendar) addRule(
+	email, role string,
+	counter *uint64,
+	wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	rule := &calendar.AclRule{
+		Role:  role,
+		Scope: &calendar.AclRuleScope{Type: aclScopeUser, Value: email},
+	}
+	_, err := g.CalendarService.Acl.Insert(g.CalendarSyncSet.CalendarID, rule).
+		SendNotifications(g.SendNotifications).Do()
+	if err != nil {
+		err = statusError(err, fmt.Errorf("unable to share calendar %s with %s: %s", g.CalendarSyncSet.CalendarID,
+			email, err))
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  err.Error()}
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: fmt.Sprintf("AddRule %s %s", email, role),
+	}
+
+	atomic.AddUint64(counter, 1)
+}
+
+func (g *GoogleCalendar) updateRule(
+	email, role string,
+	counter *uint64,
+	wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	_, err := g.CalendarService.Acl.Patch(g.CalendarSyncSet.CalendarID, g.ruleID(email),
+		&calendar.AclRule{Role: role}).SendNotifications(g.SendNotifications).Do()
+	if err != nil {
+		err = statusError(err, fmt.Errorf("unable to change the access of %s to calendar %s: %s", email,
+			g.CalendarSyncSet.CalendarID, err))
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  err.Error()}
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: fmt.Sprintf("UpdateRule %s %s", email, role),
+	}
+
+	atomic.AddUint64(counter, 1)
+}
+
+func (g *GoogleCalendar) removeRule(
+	email string,
+	counter *uint64,
+	wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	err := g.CalendarService.Acl.Delete(g.CalendarSyncSet.CalendarID, g.ruleID(email)).Do()
+	if err != nil {
+		err = statusError(err, fmt.Errorf("unable to remove the access of %s to calendar %s: %s", email,
+			g.CalendarSyncSet.CalendarID, err))
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  err.Error()}
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: "RemoveRule " + email,
+	}
+
+	atomic.AddUint64(counter, 1)
+}
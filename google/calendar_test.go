@@ -0,0 +1,147 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	calendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+func TestGoogleCalendar_ForSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     string
+		wantRole string
+		wantErr  bool
+	}{
+		{name: "default role", json: `{"CalendarID": "room@resource.calendar.google.com"}`, wantRole: "reader"},
+		{name: "role", json: `{"CalendarID": "c1@group.calendar.google.com", "Role": "FreeBusyReader"}`,
+			wantRole: "freeBusyReader"},
+		{name: "invalid role", json: `{"CalendarID": "c1@group.calendar.google.com", "Role": "admin"}`, wantErr: true},
+		{name: "no calendar", json: `{"Role": "reader"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var g GoogleCalendar
+			err := g.ForSet(json.RawMessage(tt.json))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ForSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if g.CalendarSyncSet.Role != tt.wantRole {
+				t.Errorf("ForSet() Role = %q, want %q", g.CalendarSyncSet.Role, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestGoogleCalendar_sync(t *testing.T) {
+	userRule := func(email, role string) *calendar.AclRule {
+		return &calendar.AclRule{Id: "user:" + strings.ToLower(email), Role: role,
+			Scope: &calendar.AclRuleScope{Type: "user", Value: email}}
+	}
+	rules := []*calendar.AclRule{
+		userRule("Ann@example.org", "reader"),
+		userRule("bob@example.org", "reader"),
+		userRule("own@example.org", "owner"),
+		{Id: "domain:example.org", Role: "reader", Scope: &calendar.AclRuleScope{Type: "domain", Value: "example.org"}},
+		{Id: "group:it@example.org", Role: "writer",
+			Scope: &calendar.AclRuleScope{Type: "group", Value: "it@example.org"}},
+	}
+	var mutex sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/calendars/")
+		if r.Method == http.MethodGet {
+			if r.URL.Query().Get("pageToken") == "" {
+				_ = json.NewEncoder(w).Encode(calendar.Acl{Items: rules[:2], NextPageToken: "2"})
+			} else {
+				_ = json.NewEncoder(w).Encode(calendar.Acl{Items: rules[2:]})
+			}
+			return
+		}
+		var rule calendar.AclRule
+		_ = json.NewDecoder(r.Body).Decode(&rule)
+		request := r.Method + " " + path + " " + rule.Role
+		if rule.Scope != nil {
+			request += " " + rule.Scope.Value
+		}
+		request += " notify=" + r.URL.Query().Get("sendNotifications")
+		mutex.Lock()
+		requests = append(requests, request)
+		mutex.Unlock()
+		_ = json.NewEncoder(w).Encode(rule)
+	}))
+	defer server.Close()
+
+	service, err := calendar.NewService(context.Background(), option.WithEndpoint(server.URL+"/"),
+		option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := GoogleCalendar{CalendarService: service, BatchSize: 10}
+	if err := g.ForSet(json.RawMessage(`{"CalendarID": "cal@example.org"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	listed, err := g.ListUsers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []internal.Person{
+		{CompareValue: "ann@example.org", Attributes: map[string]string{"Email": "ann@example.org", "Role": "reader"}},
+		{CompareValue: "bob@example.org", Attributes: map[string]string{"Email": "bob@example.org", "Role": "reader"}},
+	}
+	if !reflect.DeepEqual(listed, want) {
+		t.Errorf("ListUsers() = %v\nwant %v", listed, want)
+	}
+
+	changeSet := internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "carl@example.org", Attributes: map[string]string{}},
+			{CompareValue: "dee@example.org", Attributes: map[string]string{"Role": "WRITER"}},
+			{CompareValue: "own@example.org", Attributes: map[string]string{}},
+			{CompareValue: "eve@example.org", Attributes: map[string]string{"Role": "admin"}},
+		},
+		Update: []internal.Person{{CompareValue: "ann@example.org", Attributes: map[string]string{"Role": "writer"}}},
+		Delete: []internal.Person{{CompareValue: "bob@example.org"}},
+	}
+	eventLog := make(chan internal.EventLogItem, 20)
+	results := g.ApplyChangeSet(changeSet, eventLog)
+	close(eventLog)
+
+	sort.Strings(requests)
+	wantRequests := []string{
+		"DELETE cal@example.org/acl/user:bob@example.org  notify=",
+		"PATCH cal@example.org/acl/user:ann@example.org writer notify=false",
+		"POST cal@example.org/acl reader carl@example.org notify=false",
+		"POST cal@example.org/acl writer dee@example.org notify=false",
+	}
+	if !reflect.DeepEqual(requests, wantRequests) {
+		t.Errorf("ApplyChangeSet() requests %q\nwant %q", requests, wantRequests)
+	}
+	wantResults := internal.ChangeResults{Created: 2, Updated: 1, Deleted: 1}
+	if results.Created != wantResults.Created || results.Updated != wantResults.Updated ||
+		results.Deleted != wantResults.Deleted {
+		t.Errorf("ApplyChangeSet() = %+v, want %+v", results, wantResults)
+	}
+
+	errors := 0
+	for item := range eventLog {
+		if strings.Contains(item.Message, "eve@example.org") {
+			errors++
+		}
+	}
+	if errors != 1 {
+		t.Errorf("ApplyChangeSet() logged %v errors for an invalid role, want 1", errors)
+	}
+}
@@ -0,0 +1,91 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/oauth2/google"
+	licensing "google.golang.org/api/licensing/v1"
+	"google.golang.org/api/option"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+// The product and SKU of the Cloud Identity Free license
+const (
+	CloudIdentityFreeProductID = "101001"
+	CloudIdentityFreeSkuID     = "1010010001"
+)
+
+// NewGoogleCloudIdentityDestination creates a Google Users destination for identities without a Workspace license,
+// such as contractors. It is configured like GoogleUsers, and each user it creates is given the Cloud Identity Free
+// license. Options that need a Workspace mailbox or Drive are not allowed.
+func NewGoogleCloudIdentityDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var workspaceOptions struct {
+		SendAsAliases     bool
+		RevokeMailAccess  bool
+		TransferToManager bool
+	}
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &workspaceOptions); err != nil {
+		return &GoogleUsers{}, err
+	}
+	switch {
+	case workspaceOptions.SendAsAliases:
+		return &GoogleUsers{}, errors.New("SendAsAliases requires a Google Workspace license")
+	case workspaceOptions.RevokeMailAccess:
+		return &GoogleUsers{}, errors.New("RevokeMailAccess requires a Google Workspace license")
+	case workspaceOptions.TransferToManager:
+		return &GoogleUsers{}, errors.New("TransferToManager requires a Google Workspace license")
+	}
+
+	destination, err := NewGoogleUsersDestination(destinationConfig)
+	if err != nil {
+		return &GoogleUsers{}, err
+	}
+	googleUsers := destination.(*GoogleUsers)
+	googleUsers.cloudIdentity = true
+	return googleUsers, nil
+}
+
+// assignCloudIdentityLicense gives the user the Cloud Identity Free license
+func (g *GoogleUsers) assignCloudIdentityLicense(email string) error {
+	if err := g.initLicensingService(); err != nil {
+		return err
+	}
+
+	assignment := &licensing.LicenseAssignmentInsert{UserId: email}
+	_, err := g.LicensingService.LicenseAssignments.Insert(CloudIdentityFreeProductID, CloudIdentityFreeSkuID,
+		assignment).Do()
+	if err != nil {
+		return statusError(err, fmt.Errorf("unable to assign the Cloud Identity Free license: %s", err))
+	}
+	return nil
+}
+
+// initLicensingService creates the LicensingService if it has not been set
+func (g *GoogleUsers) initLicensingService() error {
+	if g.LicensingService != nil {
+		return nil
+	}
+
+	googleAuthJson, err := json.Marshal(g.GoogleConfig.GoogleAuth)
+	if err != nil {
+		return fmt.Errorf("unable to marshal google auth data into json, error: %s", err)
+	}
+
+	config, err := google.JWTConfigFromJSON(googleAuthJson, licensing.AppsLicensingScope)
+	if err != nil {
+		return fmt.Errorf("unable to parse client secret file to config: %s", err)
+	}
+
+	ctx := context.Background()
+	config.Subject = g.GoogleConfig.DelegatedAdminEmail
+	service, err := licensing.NewService(ctx, option.WithHTTPClient(config.Client(ctx)))
+	if err != nil {
+		return fmt.Errorf("unable to create Enterprise License Manager API service: %s", err)
+	}
+	g.LicensingService = service
+	return nil
+}
@@ -0,0 +1,87 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	admin "google.golang.org/api/admin/directory/v1"
+	licensing "google.golang.org/api/licensing/v1"
+	"google.golang.org/api/option"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+func TestGoogleCloudIdentity_CreateUsers(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var fields map[string]interface{}
+		_ = json.Unmarshal(body, &fields)
+		mutex.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+stringField(fields, "primaryEmail")+
+			stringField(fields, "userId"))
+		mutex.Unlock()
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	options := []option.ClientOption{option.WithEndpoint(server.URL + "/"), option.WithHTTPClient(server.Client())}
+	adminService, err := admin.NewService(context.Background(), options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	licensingService, err := licensing.NewService(context.Background(), options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := GoogleUsers{AdminService: *adminService, LicensingService: licensingService, BatchSize: 10,
+		BatchDelaySeconds: 1, CreateUsers: true, cloudIdentity: true}
+	changes := internal.ChangeSet{Create: []internal.Person{{
+		CompareValue: "contractor@example.org",
+		Attributes: map[string]string{"email": "contractor@example.org", "givenName": "Con",
+			"familyName": "Tractor"},
+	}}}
+
+	eventLog := make(chan internal.EventLogItem, 10)
+	results := g.ApplyChangeSet(changes, eventLog)
+	close(eventLog)
+	for msg := range eventLog {
+		if strings.HasPrefix(msg.Message, "unable") {
+			t.Errorf("ApplyChangeSet() logged %q", msg.Message)
+		}
+	}
+
+	want := []string{
+		"POST /admin/directory/v1/users contractor@example.org",
+		"POST /apps/licensing/v1/product/101001/sku/1010010001/user contractor@example.org",
+	}
+	if !reflect.DeepEqual(requests, want) || results.Created != 1 {
+		t.Errorf("ApplyChangeSet() = %+v with requests %q\nwant %q", results, requests, want)
+	}
+}
+
+func stringField(fields map[string]interface{}, name string) string {
+	value, _ := fields[name].(string)
+	return value
+}
+
+func TestNewGoogleCloudIdentityDestination(t *testing.T) {
+	for _, option := range []string{"SendAsAliases", "RevokeMailAccess", "TransferToManager"} {
+		config := internal.DestinationConfig{
+			Type:      internal.DestinationTypeGoogleCloudIdentity,
+			ExtraJSON: []byte(`{"OnDelete": "delete", "` + option + `": true}`),
+		}
+		if _, err := NewGoogleCloudIdentityDestination(config); err == nil || !strings.Contains(err.Error(), option) {
+			t.Errorf("NewGoogleCloudIdentityDestination() error = %v, want an error for %s", err, option)
+		}
+	}
+}
@@ -7,9 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"log/syslog"
 	"net/http"
+	"regexp"
 	"sync"
 	"sync/atomic"
 
@@ -21,6 +21,11 @@ import (
 
 const MaxQuerySize = 10000
 
+var (
+	birthdayPattern    = regexp.MustCompile(`^(\d{4}|-)-\d{2}-\d{2}$`)
+	anniversaryPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+)
+
 const (
 	contactFieldID             = "id"
 	contactFieldEmail          = "email"
@@ -34,6 +39,19 @@ const (
 	contactFieldJobDescription = "jobDescription"
 	contactFieldDepartment     = "department"
 	contactFieldNotes          = "notes"
+	contactFieldStreet         = "street"
+	contactFieldCity           = "city"
+	contactFieldRegion         = "region"
+	contactFieldPostalCode     = "postalCode"
+	contactFieldCountry        = "country"
+	contactFieldBirthday       = "birthday"
+	contactFieldAnniversary    = "anniversary"
+	contactFieldPreferredName  = "preferredName"
+	contactFieldPronouns       = "pronouns"
+	contactFieldHomeEmail      = "homeEmail"
+	contactFieldOtherEmail     = "otherEmail"
+	contactFieldMobilePhone    = "mobilePhone"
+	contactFieldHomePhone      = "homePhone"
 )
 
 type GoogleContacts struct {
@@ -62,16 +80,23 @@ type Contact struct {
 	Organization Organization  `xml:"organization"`
 	Where        Where         `xml:"where"`
 	Notes        string        `xml:"content"`
+	Addresses    []Address     `xml:"structuredPostalAddress"`
+	Birthday     Birthday      `xml:"birthday"`
+	Events       []Event       `xml:"event"`
+	Nickname     string        `xml:"nickname"`
+	UserFields   []UserField   `xml:"userDefinedField"`
 }
 
 type Email struct {
 	XMLName xml.Name `xml:"email"`
+	Rel     string   `xml:"rel,attr"`
 	Address string   `xml:"address,attr"`
 	Primary bool     `xml:"primary,attr"`
 }
 
 type PhoneNumber struct {
 	XMLName xml.Name `xml:"phoneNumber"`
+	Rel     string   `xml:"rel,attr"`
 	Value   string   `xml:",chardata"`
 	Primary bool     `xml:"primary,attr"`
 }
@@ -91,6 +116,38 @@ type Organization struct {
 	Department     string   `xml:"orgDepartment"`
 }
 
+type Address struct {
+	XMLName    xml.Name `xml:"structuredPostalAddress"`
+	Primary    bool     `xml:"primary,attr"`
+	Street     string   `xml:"street"`
+	City       string   `xml:"city"`
+	Region     string   `xml:"region"`
+	PostalCode string   `xml:"postcode"`
+	Country    string   `xml:"country"`
+}
+
+type Birthday struct {
+	XMLName xml.Name `xml:"birthday"`
+	When    string   `xml:"when,attr"`
+}
+
+type Event struct {
+	XMLName xml.Name `xml:"event"`
+	Rel     string   `xml:"rel,attr"`
+	When    When     `xml:"when"`
+}
+
+type When struct {
+	XMLName   xml.Name `xml:"when"`
+	StartTime string   `xml:"startTime,attr"`
+}
+
+type UserField struct {
+	XMLName xml.Name `xml:"userDefinedField"`
+	Key     string   `xml:"key,attr"`
+	Value   string   `xml:"value,attr"`
+}
+
 type Link struct {
 	XMLName xml.Name `xml:"link"`
 	Rel     string   `xml:"rel,attr"`
@@ -174,34 +231,22 @@ func (g *GoogleContacts) ApplyChangeSet(
 	batchTimer := internal.NewBatchTimer(g.BatchSize,
 		g.BatchDelaySeconds)
 
-	if g.DestinationConfig.DisableAdd {
-		log.Println("Contact creation is disabled.")
-	} else {
-		for _, toCreate := range changes.Create {
-			wg.Add(1)
-			go g.addContact(toCreate, &results.Created, &wg, eventLog)
-			batchTimer.WaitOnBatch()
-		}
+	for _, toCreate := range changes.Create {
+		wg.Add(1)
+		go g.addContact(toCreate, &results.Created, &wg, eventLog)
+		batchTimer.WaitOnBatch()
 	}
 
-	if g.DestinationConfig.DisableUpdate {
-		log.Println("Contact update is disabled.")
-	} else {
-		for _, toUpdate := range changes.Update {
-			wg.Add(1)
-			go g.updateContact(toUpdate, &results.Updated, &wg, eventLog)
-			batchTimer.WaitOnBatch()
-		}
+	for _, toUpdate := range changes.Update {
+		wg.Add(1)
+		go g.updateContact(toUpdate, &results.Updated, &wg, eventLog)
+		batchTimer.WaitOnBatch()
 	}
 
-	if g.DestinationConfig.DisableDelete {
-		log.Println("Contact deletion is disabled.")
-	} else {
-		for _, toUpdate := range changes.Delete {
-			wg.Add(1)
-			go g.deleteContact(toUpdate, &results.Deleted, &wg, eventLog)
-			batchTimer.WaitOnBatch()
-		}
+	for _, toUpdate := range changes.Delete {
+		wg.Add(1)
+		go g.deleteContact(toUpdate, &results.Deleted, &wg, eventLog)
+		batchTimer.WaitOnBatch()
 	}
 
 	wg.Wait()
@@ -229,7 +274,7 @@ func (g *GoogleContacts) httpRequest(verb, url, body string, headers map[string]
 	req.Header.Set("GData-Version", "3.0")
 	req.Header.Set("User-Agent", "personnel-sync")
 
-	resp, err := g.Client.Do(req)
+	resp, err := g.GoogleConfig.Retry.Do(&g.Client, req)
 	if err != nil {
 		return "", err
 	}
@@ -242,7 +287,7 @@ func (g *GoogleContacts) httpRequest(verb, url, body string, headers map[string]
 	bodyString := string(bodyBytes)
 
 	if resp.StatusCode >= 400 {
-		return bodyString, errors.New(resp.Status)
+		return bodyString, internal.NewStatusError(resp.StatusCode, resp.Header.Get("Retry-After"), errors.New(resp.Status))
 	}
 
 	return bodyString, nil
@@ -252,6 +297,7 @@ func (g *GoogleContacts) extractPersonsFromResponse(contacts []Contact) ([]inter
 	persons := make([]internal.Person, len(contacts))
 	for i, entry := range contacts {
 		id := findSelfLink(entry)
+		address := findPrimaryAddress(entry)
 		persons[i] = internal.Person{
 			CompareValue: findPrimaryEmail(entry),
 			ID:           id,
@@ -268,6 +314,19 @@ func (g *GoogleContacts) extractPersonsFromResponse(contacts []Contact) ([]inter
 				contactFieldJobDescription: entry.Organization.JobDescription,
 				contactFieldDepartment:     entry.Organization.Department,
 				contactFieldNotes:          entry.Notes,
+				contactFieldStreet:         address.Street,
+				contactFieldCity:           address.City,
+				contactFieldRegion:         address.Region,
+				contactFieldPostalCode:     address.PostalCode,
+				contactFieldCountry:        address.Country,
+				contactFieldBirthday:       entry.Birthday.When,
+				contactFieldAnniversary:    findEvent(entry, "anniversary"),
+				contactFieldPreferredName:  entry.Nickname,
+				contactFieldPronouns:       findUserField(entry, contactFieldPronouns),
+				contactFieldHomeEmail:      findEmail(entry, relHome),
+				contactFieldOtherEmail:     findEmail(entry, relOther),
+				contactFieldMobilePhone:    findPhoneNumber(entry, relMobile),
+				contactFieldHomePhone:      findPhoneNumber(entry, relHome),
 			},
 		}
 	}
@@ -293,6 +352,26 @@ func findPrimaryEmail(entry Contact) string {
 	return ""
 }
 
+// findEmail returns the first email address of the rel that is not the primary one
+func findEmail(entry Contact, rel string) string {
+	for _, email := range entry.Emails {
+		if email.Rel == rel && !email.Primary {
+			return email.Address
+		}
+	}
+	return ""
+}
+
+// findPhoneNumber returns the first phone number of the rel that is not the primary one
+func findPhoneNumber(entry Contact, rel string) string {
+	for _, phone := range entry.PhoneNumbers {
+		if phone.Rel == rel && !phone.Primary {
+			return phone.Value
+		}
+	}
+	return ""
+}
+
 func findPrimaryPhoneNumber(entry Contact) string {
 	for _, phone := range entry.PhoneNumbers {
 		if phone.Primary {
@@ -302,6 +381,33 @@ func findPrimaryPhoneNumber(entry Contact) string {
 	return ""
 }
 
+func findPrimaryAddress(entry Contact) Address {
+	for _, address := range entry.Addresses {
+		if address.Primary {
+			return address
+		}
+	}
+	return Address{}
+}
+
+func findEvent(entry Contact, rel string) string {
+	for _, event := range entry.Events {
+		if event.Rel == rel {
+			return event.When.StartTime
+		}
+	}
+	return ""
+}
+
+func findUserField(entry Contact, key string) string {
+	for _, field := range entry.UserFields {
+		if field.Key == key {
+			return field.Value
+		}
+	}
+	return ""
+}
+
 func (g *GoogleContacts) addContact(
 	person internal.Person,
 	counter *uint64,
@@ -311,9 +417,12 @@ func (g *GoogleContacts) addContact(
 	defer wg.Done()
 
 	href := "https://www.google.com/m8/feeds/contacts/" + g.GoogleConfig.Domain + "/full"
-	body := g.createBody(person)
-	headers := map[string]string{"Content-Type": "application/atom+xml"}
-	if _, err := g.httpRequest(http.MethodPost, href, body, headers); err != nil {
+	body, err := g.createBody(person)
+	if err == nil {
+		headers := map[string]string{"Content-Type": "application/atom+xml"}
+		_, err = g.httpRequest(http.MethodPost, href, body, headers)
+	}
+	if err != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ERR,
 			Message: fmt.Sprintf("unable to insert %s in Google contacts: %s", person.CompareValue, err)}
@@ -348,49 +457,52 @@ func (g *GoogleContacts) initGoogleClient() error {
 	return nil
 }
 
-// createBody inserts attributes into an XML request body. This might be possible using the Go XML library, but
-// it would probably take some sort of hack or workaround to get it to insert the "gd:" namespace prefix on the
-// tag names.
-// WARNING: This updates all fields, even if omitted in the field mapping. A safer implementation would be to
-// merge the data retrieved from Google with the data coming from the source.
-func (g *GoogleContacts) createBody(person internal.Person) string {
-	const bodyTemplate = `<atom:entry xmlns:atom='http://www.w3.org/2005/Atom' xmlns:gd='http://schemas.google.com/g/2005'>
-	<atom:category scheme='http://schemas.google.com/g/2005#kind' term='http://schemas.google.com/contact/2008#contact' />
-	<atom:content type='text'>%s</atom:content>
-	<gd:name>
-		<gd:fullName>%s</gd:fullName>
-		<gd:givenName>%s</gd:givenName>
-		<gd:familyName>%s</gd:familyName>
-	</gd:name>
-	<gd:email rel='http://schemas.google.com/g/2005#work' primary='true' address='%s'/>
-	<gd:phoneNumber rel='http://schemas.google.com/g/2005#work' primary='true'>%s</gd:phoneNumber>
-	<gd:where valueString='%s'/>
-	<gd:organization rel="http://schemas.google.com/g/2005#work" label="Work" primary="true">
-		  <gd:orgName>%s</gd:orgName>
-		  <gd:orgTitle>%s</gd:orgTitle>
-		  <gd:orgJobDescription>%s</gd:orgJobDescription>
-		  <gd:orgDepartment>%s</gd:orgDepartment>
-	</gd:organization> 
-</atom:entry>`
-
-	return fmt.Sprintf(bodyTemplate,
-		escapeForXML(person.Attributes[contactFieldNotes]),
-		escapeForXML(person.Attributes[contactFieldFullName]),
-		escapeForXML(person.Attributes[contactFieldGivenName]),
-		escapeForXML(person.Attributes[contactFieldFamilyName]),
-		escapeForXML(person.Attributes[contactFieldEmail]),
-		escapeForXML(person.Attributes[contactFieldPhoneNumber]),
-		escapeForXML(person.Attributes[contactFieldWhere]),
-		escapeForXML(person.Attributes[contactFieldOrganization]),
-		escapeForXML(person.Attributes[contactFieldTitle]),
-		escapeForXML(person.Attributes[contactFieldJobDescription]),
-		escapeForXML(person.Attributes[contactFieldDepartment]))
-}
-
-func escapeForXML(s string) string {
-	buf := new(bytes.Buffer)
-	_ = xml.EscapeText(buf, []byte(s))
-	return buf.String()
+// ValidateChangeSet checks the date formats of contacts to be created or updated, and that each contact to be
+// updated has an ID
+func (g *GoogleContacts) ValidateChangeSet(changes internal.ChangeSet) map[string]string {
+	failures := map[string]string{}
+
+	for _, people := range [][]internal.Person{changes.Create, changes.Update} {
+		for _, person := range people {
+			if birthday := person.Attributes[contactFieldBirthday]; birthday != "" && !birthdayPattern.MatchString(birthday) {
+				failures[person.CompareValue] = fmt.Sprintf("invalid birthday %q", birthday)
+			}
+			if anniversary := person.Attributes[contactFieldAnniversary]; anniversary != "" &&
+				!anniversaryPattern.MatchString(anniversary) {
+				failures[person.CompareValue] = fmt.Sprintf("invalid anniversary %q", anniversary)
+			}
+		}
+	}
+
+	for _, person := range changes.Update {
+		if person.ID == "" {
+			failures[person.CompareValue] = "contact ID is missing"
+		}
+	}
+
+	return failures
+}
+
+// createBody returns the XML entry of a new contact with the person's attributes that are not empty
+func (g *GoogleContacts) createBody(person internal.Person) (string, error) {
+	entry := &xmlNode{Name: xml.Name{Space: xmlnsAtom, Local: "entry"}}
+	entry.addChild(xmlnsAtom, "category",
+		xml.Attr{Name: xml.Name{Local: "scheme"}, Value: "http://schemas.google.com/g/2005#kind"},
+		xml.Attr{Name: xml.Name{Local: "term"}, Value: "http://schemas.google.com/contact/2008#contact"})
+
+	attrs := map[string]string{}
+	for key, value := range person.Attributes {
+		if value != "" {
+			attrs[key] = value
+		}
+	}
+	mergeIntoEntry(entry, attrs)
+
+	body, err := entry.marshal()
+	if err != nil {
+		return "", fmt.Errorf("unable to create XML body: %s", err)
+	}
+	return string(body), nil
 }
 
 func (g *GoogleContacts) updateContact(
@@ -403,7 +515,7 @@ func (g *GoogleContacts) updateContact(
 
 	url := person.ID
 
-	contact, err := g.getContact(url)
+	entry, err := g.getContactEntry(url)
 	if err != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ERR,
@@ -411,12 +523,15 @@ func (g *GoogleContacts) updateContact(
 		return
 	}
 
-	body := g.createBody(person)
+	mergeIntoEntry(entry, person.Attributes)
 
-	_, err = g.httpRequest(http.MethodPut, url, body, map[string]string{
-		"If-Match":     contact.Etag,
-		"Content-Type": "application/atom+xml",
-	})
+	body, err := entry.marshal()
+	if err == nil {
+		_, err = g.httpRequest(http.MethodPut, url, string(body), map[string]string{
+			"If-Match":     entry.attr(xmlnsGData, "etag"),
+			"Content-Type": "application/atom+xml",
+		})
+	}
 	if err != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ERR,
@@ -442,6 +557,21 @@ func (g *GoogleContacts) getContact(url string) (Contact, error) {
 	return c, nil
 }
 
+// getContactEntry returns the whole entry of a contact, including the elements that are not synced
+func (g *GoogleContacts) getContactEntry(url string) (*xmlNode, error) {
+	existingContact, err := g.httpRequest(http.MethodGet, url, "", map[string]string{})
+	if err != nil {
+		return nil, fmt.Errorf("GET failed: %s", err)
+	}
+
+	entry, err := parseXMLNode([]byte(existingContact))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse xml: %s", err)
+	}
+
+	return entry, nil
+}
+
 func (g *GoogleContacts) deleteContact(
 	person internal.Person,
 	counter *uint64,
@@ -166,6 +166,30 @@ func TestGoogleContacts_extractPersonsFromResponse(t *testing.T) {
 						ValueString: "some place",
 					},
 					Notes: "some notes",
+					Addresses: []Address{
+						{
+							XMLName: xml.Name{Space: "http://www.w3.org/2005/Atom", Local: "structuredPostalAddress"},
+							Street:  "PO Box 1",
+						},
+						{
+							XMLName:    xml.Name{Space: "http://www.w3.org/2005/Atom", Local: "structuredPostalAddress"},
+							Primary:    true,
+							Street:     "1 Main St",
+							City:       "Springfield",
+							Region:     "IL",
+							PostalCode: "62701",
+							Country:    "USA",
+						},
+					},
+					Birthday: Birthday{When: "1952-02-29"},
+					Events: []Event{
+						{Rel: "other", When: When{StartTime: "2000-01-01"}},
+						{Rel: "anniversary", When: When{StartTime: "1980-06-01"}},
+					},
+					Nickname: "Al",
+					UserFields: []UserField{
+						{Key: "pronouns", Value: "he/him"},
+					},
 				},
 			},
 			want: []internal.Person{
@@ -185,6 +209,19 @@ func TestGoogleContacts_extractPersonsFromResponse(t *testing.T) {
 						contactFieldDepartment:     "Marketing",
 						contactFieldWhere:          "some place",
 						contactFieldNotes:          "some notes",
+						contactFieldStreet:         "1 Main St",
+						contactFieldCity:           "Springfield",
+						contactFieldRegion:         "IL",
+						contactFieldPostalCode:     "62701",
+						contactFieldCountry:        "USA",
+						contactFieldBirthday:       "1952-02-29",
+						contactFieldAnniversary:    "1980-06-01",
+						contactFieldPreferredName:  "Al",
+						contactFieldPronouns:       "he/him",
+						contactFieldHomeEmail:      "",
+						contactFieldOtherEmail:     "",
+						contactFieldMobilePhone:    "",
+						contactFieldHomePhone:      "",
 					},
 					DisableChanges: false,
 				},
@@ -219,6 +256,19 @@ func TestGoogleContacts_extractPersonsFromResponse(t *testing.T) {
 						contactFieldDepartment:     "",
 						contactFieldWhere:          "",
 						contactFieldNotes:          "",
+						contactFieldStreet:         "",
+						contactFieldCity:           "",
+						contactFieldRegion:         "",
+						contactFieldPostalCode:     "",
+						contactFieldCountry:        "",
+						contactFieldBirthday:       "",
+						contactFieldAnniversary:    "",
+						contactFieldPreferredName:  "",
+						contactFieldPronouns:       "",
+						contactFieldHomeEmail:      "",
+						contactFieldOtherEmail:     "",
+						contactFieldMobilePhone:    "",
+						contactFieldHomePhone:      "",
 					},
 					DisableChanges: false,
 				},
@@ -238,6 +288,19 @@ func TestGoogleContacts_extractPersonsFromResponse(t *testing.T) {
 						contactFieldDepartment:     "",
 						contactFieldWhere:          "",
 						contactFieldNotes:          "",
+						contactFieldStreet:         "",
+						contactFieldCity:           "",
+						contactFieldRegion:         "",
+						contactFieldPostalCode:     "",
+						contactFieldCountry:        "",
+						contactFieldBirthday:       "",
+						contactFieldAnniversary:    "",
+						contactFieldPreferredName:  "",
+						contactFieldPronouns:       "",
+						contactFieldHomeEmail:      "",
+						contactFieldOtherEmail:     "",
+						contactFieldMobilePhone:    "",
+						contactFieldHomePhone:      "",
 					},
 					DisableChanges: false,
 				},
@@ -263,72 +326,217 @@ func TestGoogleContacts_createBody(t *testing.T) {
 	tests := []struct {
 		name   string
 		person internal.Person
-		want   string
 	}{
 		{
 			name:   "fullName",
 			person: internal.Person{Attributes: map[string]string{contactFieldFullName: "Fred J. Smith"}},
-			want:   "<gd:fullName>Fred J. Smith</gd:fullName>",
 		},
 		{
 			name:   "givenName",
 			person: internal.Person{Attributes: map[string]string{contactFieldGivenName: "Fred"}},
-			want:   "<gd:givenName>Fred</gd:givenName>",
 		},
 		{
 			name:   "familyName",
 			person: internal.Person{Attributes: map[string]string{contactFieldFamilyName: "Smith"}},
-			want:   "<gd:familyName>Smith</gd:familyName>",
 		},
 		{
 			name:   "email",
 			person: internal.Person{Attributes: map[string]string{contactFieldEmail: "fred@example.com"}},
-			want:   "<gd:email rel='http://schemas.google.com/g/2005#work' primary='true' address='fred@example.com'/>",
 		},
 		{
 			name:   "phoneNumber",
 			person: internal.Person{Attributes: map[string]string{contactFieldPhoneNumber: "555-1212"}},
-			want:   "<gd:phoneNumber rel='http://schemas.google.com/g/2005#work' primary='true'>555-1212</gd:phoneNumber>",
 		},
 		{
 			name:   "organization",
 			person: internal.Person{Attributes: map[string]string{contactFieldOrganization: "Acme, Inc."}},
-			want:   "<gd:orgName>Acme, Inc.</gd:orgName>",
 		},
 		{
 			name:   "department",
 			person: internal.Person{Attributes: map[string]string{contactFieldDepartment: "Operations"}},
-			want:   "<gd:orgDepartment>Operations</gd:orgDepartment>",
 		},
 		{
 			name:   "title",
 			person: internal.Person{Attributes: map[string]string{contactFieldTitle: "VP of Operations"}},
-			want:   "<gd:orgTitle>VP of Operations</gd:orgTitle>",
 		},
 		{
 			name:   "jobDescription",
 			person: internal.Person{Attributes: map[string]string{contactFieldJobDescription: "does important stuff"}},
-			want:   "<gd:orgJobDescription>does important stuff</gd:orgJobDescription>",
+		},
+		{
+			name:   "address",
+			person: internal.Person{Attributes: map[string]string{contactFieldCity: "Springfield", contactFieldCountry: "USA"}},
+		},
+		{
+			name:   "birthday",
+			person: internal.Person{Attributes: map[string]string{contactFieldBirthday: "--02-29"}},
+		},
+		{
+			name:   "anniversary",
+			person: internal.Person{Attributes: map[string]string{contactFieldAnniversary: "1980-06-01"}},
+		},
+		{
+			name:   "preferredName",
+			person: internal.Person{Attributes: map[string]string{contactFieldPreferredName: "Sam"}},
+		},
+		{
+			name:   "pronouns",
+			person: internal.Person{Attributes: map[string]string{contactFieldPronouns: "they/them"}},
 		},
 		{
 			name:   "notes",
 			person: internal.Person{Attributes: map[string]string{contactFieldNotes: "these are some notes"}},
-			want:   "<atom:content type='text'>these are some notes</atom:content>",
+		},
+		{
+			name: "special characters",
+			person: internal.Person{Attributes: map[string]string{contactFieldFullName: `Fred "Bud" O'Brien & <Co>`,
+				contactFieldEmail: "o'brien@example.com", contactFieldNotes: "a < b && c > d"}},
+		},
+		{
+			name: "more emails and phones",
+			person: internal.Person{Attributes: map[string]string{contactFieldEmail: "fred@example.com",
+				contactFieldHomeEmail: "fred@example.net", contactFieldOtherEmail: "fred@example.org",
+				contactFieldPhoneNumber: "555-1212", contactFieldMobilePhone: "555-3434",
+				contactFieldHomePhone: "555-5656"}},
 		},
 	}
 	for _, tt := range tests {
 		g := GoogleContacts{}
 		t.Run(tt.name, func(t *testing.T) {
-			body := g.createBody(tt.person)
-			if !strings.Contains(body, tt.want) {
-				t.Errorf(`no "%v" in body: \n%v`, tt.want, body)
+			body, err := g.createBody(tt.person)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(body, `<atom:entry xmlns:atom="http://www.w3.org/2005/Atom"`) {
+				t.Errorf("missing <atom:entry> tag: \n%v", body)
 			}
-			if !strings.HasPrefix(body, `<atom:entry xmlns:atom='http://www.w3.org/2005/Atom' xmlns:gd='http://schemas.google.com/g/2005'>`) {
-				t.Errorf("missing <atom:entry> tag")
+			if !strings.Contains(body, `<atom:category scheme="http://schemas.google.com/g/2005#kind" `+
+				`term="http://schemas.google.com/contact/2008#contact">`) {
+				t.Errorf("missing <atom:category> tag: \n%v", body)
 			}
-			if !strings.Contains(body, `<atom:category scheme='http://schemas.google.com/g/2005#kind' term='http://schemas.google.com/contact/2008#contact' />`) {
-				t.Errorf("missing <atom:entry> tag")
+
+			var contact Contact
+			if err := xml.Unmarshal([]byte(body), &contact); err != nil {
+				t.Fatalf("invalid body: %s\n%v", err, body)
+			}
+			persons, _ := g.extractPersonsFromResponse([]Contact{contact})
+			persons[0].Attributes[contactFieldFullName] = contact.Name.FullName // Google fills in the title
+			for key, want := range tt.person.Attributes {
+				if got := persons[0].Attributes[key]; got != want {
+					t.Errorf("%s = %q, want %q in body: \n%v", key, got, want, body)
+				}
 			}
 		})
 	}
 }
+
+func TestGoogleContacts_ValidateChangeSet(t *testing.T) {
+	changes := internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "ok@example.com", Attributes: map[string]string{contactFieldBirthday: "--02-29"}},
+			{CompareValue: "birthday@example.com", Attributes: map[string]string{contactFieldBirthday: "02/29/1952"}},
+		},
+		Update: []internal.Person{
+			{CompareValue: "noid@example.com", Attributes: map[string]string{}},
+			{CompareValue: "anniversary@example.com", ID: "https://www.google.com/m8/feeds/contacts/example.org/full/1",
+				Attributes: map[string]string{contactFieldAnniversary: "--06-01"}},
+		},
+	}
+
+	g := &GoogleContacts{}
+	got := g.ValidateChangeSet(changes)
+	want := map[string]string{
+		"birthday@example.com":    `invalid birthday "02/29/1952"`,
+		"noid@example.com":        "contact ID is missing",
+		"anniversary@example.com": `invalid anniversary "--06-01"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ValidateChangeSet() = %v, want %v", got, want)
+	}
+}
+
+func TestMergeIntoEntry(t *testing.T) {
+	const existing = `<?xml version='1.0' encoding='UTF-8'?>
+<entry xmlns='http://www.w3.org/2005/Atom' xmlns:gContact='http://schemas.google.com/contact/2008'
+    xmlns:gd='http://schemas.google.com/g/2005' gd:etag='"Q3c5eDVSLyt7I2A9XRVWFkkIQQ0."'>
+  <id>http://www.google.com/m8/feeds/contacts/example.org/base/1</id>
+  <content type='text'>added by hand</content>
+  <link rel='http://schemas.google.com/contacts/2008/rel#photo' type='image/*'
+      href='https://www.google.com/m8/feeds/photos/media/example.org/1'/>
+  <link rel='self' type='application/atom+xml' href='https://www.google.com/m8/feeds/contacts/example.org/full/1'/>
+  <gd:name>
+    <gd:givenName>Alfred</gd:givenName>
+    <gd:familyName>Newman</gd:familyName>
+  </gd:name>
+  <gd:email rel='http://schemas.google.com/g/2005#home' address='al@example.net'/>
+  <gd:email rel='http://schemas.google.com/g/2005#work' primary='true' address='alfred@example.com'/>
+  <gd:phoneNumber rel='http://schemas.google.com/g/2005#work' primary='true'>555-1212</gd:phoneNumber>
+  <gd:structuredPostalAddress rel='http://schemas.google.com/g/2005#work' primary='true'>
+    <gd:formattedAddress>1 Main St Springfield</gd:formattedAddress>
+    <gd:street>1 Main St</gd:street>
+    <gd:city>Springfield</gd:city>
+  </gd:structuredPostalAddress>
+  <gContact:nickname>Al</gContact:nickname>
+  <gContact:userDefinedField key='badge' value='1234 &amp; 5'/>
+  <gContact:userDefinedField key='pronouns' value='he/him'/>
+</entry>`
+
+	entry, err := parseXMLNode([]byte(existing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mergeIntoEntry(entry, map[string]string{
+		contactFieldEmail:         "alfred@example.com",
+		contactFieldPhoneNumber:   "555-9999",
+		contactFieldCity:          "Shelbyville",
+		contactFieldPreferredName: "",
+		contactFieldPronouns:      "they/them",
+		contactFieldTitle:         "Composer",
+		contactFieldMobilePhone:   "555-3434",
+	})
+
+	var contact Contact
+	merged, err := entry.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(merged, &contact); err != nil {
+		t.Fatalf("merged entry is not valid: %s\n%s", err, merged)
+	}
+	g := &GoogleContacts{}
+	persons, _ := g.extractPersonsFromResponse([]Contact{contact})
+	for field, want := range map[string]string{
+		contactFieldID:            "https://www.google.com/m8/feeds/contacts/example.org/full/1",
+		contactFieldEmail:         "alfred@example.com",
+		contactFieldPhoneNumber:   "555-9999",
+		contactFieldGivenName:     "Alfred",
+		contactFieldFamilyName:    "Newman",
+		contactFieldNotes:         "added by hand",
+		contactFieldStreet:        "1 Main St",
+		contactFieldCity:          "Shelbyville",
+		contactFieldTitle:         "Composer",
+		contactFieldPreferredName: "",
+		contactFieldPronouns:      "they/them",
+		contactFieldHomeEmail:     "al@example.net",
+		contactFieldOtherEmail:    "",
+		contactFieldMobilePhone:   "555-3434",
+		contactFieldHomePhone:     "",
+	} {
+		if got := persons[0].Attributes[field]; got != want {
+			t.Errorf("merged %s = %q, want %q", field, got, want)
+		}
+	}
+
+	if len(contact.Emails) != 2 || contact.Emails[0].Address != "al@example.net" {
+		t.Errorf("merged emails = %+v, want the home email to be kept", contact.Emails)
+	}
+	if len(contact.Links) != 2 || findUserField(contact, "badge") != "1234 & 5" {
+		t.Errorf("merged entry lost elements that are not synced:\n%s", merged)
+	}
+	if entry.attr(xmlnsGData, "etag") != `"Q3c5eDVSLyt7I2A9XRVWFkkIQQ0."` {
+		t.Errorf("etag = %q", entry.attr(xmlnsGData, "etag"))
+	}
+	if strings.Contains(string(merged), "formattedAddress") {
+		t.Error("formattedAddress was not removed after the address changed")
+	}
+}
@@ -0,0 +1,429 @@
+package google
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	xmlnsAtom    = "http://www.w3.org/2005/Atom"
+	xmlnsGData   = "http://schemas.google.com/g/2005"
+	xmlnsContact = "http://schemas.google.com/contact/2008"
+	xmlnsXML     = "http://www.w3.org/XML/1998/namespace"
+
+	relWork   = "http://schemas.google.com/g/2005#work"
+	relHome   = "http://schemas.google.com/g/2005#home"
+	relOther  = "http://schemas.google.com/g/2005#other"
+	relMobile = "http://schemas.google.com/g/2005#mobile"
+)
+
+// contactOtherEmails and contactOtherPhones are the attributes of email addresses and phone numbers other than the
+// primary ones, with their rel
+var (
+	contactOtherEmails = [][2]string{{contactFieldHomeEmail, relHome}, {contactFieldOtherEmail, relOther}}
+	contactOtherPhones = [][2]string{{contactFieldMobilePhone, relMobile}, {contactFieldHomePhone, relHome}}
+)
+
+// xmlPrefixes are the namespace prefixes written in request bodies. Other namespaces get a generated prefix.
+var xmlPrefixes = map[string]string{
+	xmlnsAtom:                               "atom",
+	xmlnsGData:                              "gd",
+	xmlnsContact:                            "gContact",
+	xmlnsXML:                                "xml",
+	"http://www.w3.org/2007/app":            "app",
+	"http://schemas.google.com/gdata/batch": "batch",
+}
+
+// xmlNode is an XML element that is kept whole, so that a contact entry can be sent back with only the synced
+// properties changed. Text is only written for an element without children.
+type xmlNode struct {
+	Name     xml.Name
+	Attrs    []xml.Attr
+	Text     string
+	Children []*xmlNode
+}
+
+// parseXMLNode parses an XML document into a tree of nodes. Namespace declarations are dropped, since the names
+// of elements and attributes hold their namespaces and marshal declares them again.
+func parseXMLNode(data []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var root *xmlNode
+	var stack []*xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{Name: t.Name}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" || attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+					continue
+				}
+				node.Attrs = append(node.Attrs, attr)
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, node)
+			} else if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("no XML element found")
+	}
+	return root, nil
+}
+
+// marshal returns the node as an XML document, with the namespaces declared on the root element. The document is
+// written by an xml.Encoder, which escapes all text and attribute values. The encoder would declare a namespace on
+// every element that uses it, so the names are given with their prefixes instead, such as "gd:email".
+func (n *xmlNode) marshal() ([]byte, error) {
+	prefixes := map[string]string{}
+	var namespaces []string
+	n.walk(func(node *xmlNode) {
+		names := []xml.Name{node.Name}
+		for _, attr := range node.Attrs {
+			names = append(names, attr.Name)
+		}
+		for _, name := range names {
+			if _, ok := prefixes[name.Space]; ok || name.Space == "" {
+				continue
+			}
+			prefix, ok := xmlPrefixes[name.Space]
+			if !ok {
+				prefix = fmt.Sprintf("ns%d", len(namespaces))
+			}
+			prefixes[name.Space] = prefix
+			namespaces = append(namespaces, name.Space)
+		}
+	})
+
+	var declarations []xml.Attr
+	for _, space := range namespaces {
+		if space != xmlnsXML {
+			declarations = append(declarations, xml.Attr{Name: xml.Name{Local: "xmlns:" + prefixes[space]},
+				Value: space})
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := xml.NewEncoder(buf)
+	if err := n.encode(encoder, prefixes, declarations); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (n *xmlNode) walk(fn func(*xmlNode)) {
+	fn(n)
+	for _, child := range n.Children {
+		child.walk(fn)
+	}
+}
+
+func (n *xmlNode) encode(encoder *xml.Encoder, prefixes map[string]string, declarations []xml.Attr) error {
+	qualified := func(name xml.Name) xml.Name {
+		if name.Space == "" {
+			return name
+		}
+		return xml.Name{Local: prefixes[name.Space] + ":" + name.Local}
+	}
+
+	start := xml.StartElement{Name: qualified(n.Name), Attr: declarations}
+	for _, attr := range n.Attrs {
+		start.Attr = append(start.Attr, xml.Attr{Name: qualified(attr.Name), Value: attr.Value})
+	}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	if len(n.Children) == 0 && n.Text != "" {
+		if err := encoder.EncodeToken(xml.CharData(n.Text)); err != nil {
+			return err
+		}
+	}
+	for _, child := range n.Children {
+		if err := child.encode(encoder, prefixes, nil); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// attr returns the value of an attribute, or an empty string if the element does not have it
+func (n *xmlNode) attr(space, local string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Space == space && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func (n *xmlNode) setAttr(space, local, value string) {
+	for i, attr := range n.Attrs {
+		if attr.Name.Space == space && attr.Name.Local == local {
+			n.Attrs[i].Value = value
+			return
+		}
+	}
+	n.Attrs = append(n.Attrs, xml.Attr{Name: xml.Name{Space: space, Local: local}, Value: value})
+}
+
+// child returns the first child element with the name, or nil if there is none
+func (n *xmlNode) child(space, local string) *xmlNode {
+	for _, child := range n.Children {
+		if child.Name.Space == space && child.Name.Local == local {
+			return child
+		}
+	}
+	return nil
+}
+
+// primaryChild returns the child element with the name that is marked as primary, or else the first one, or nil
+func (n *xmlNode) primaryChild(space, local string) *xmlNode {
+	var found *xmlNode
+	for _, child := range n.Children {
+		if child.Name.Space != space || child.Name.Local != local {
+			continue
+		}
+		if child.attr("", "primary") == "true" {
+			return child
+		}
+		if found == nil {
+			found = child
+		}
+	}
+	return found
+}
+
+// ensureChild returns the first child element with the name, adding it if there is none
+func (n *xmlNode) ensureChild(space, local string) *xmlNode {
+	if child := n.child(space, local); child != nil {
+		return child
+	}
+	return n.addChild(space, local)
+}
+
+func (n *xmlNode) addChild(space, local string, attrs ...xml.Attr) *xmlNode {
+	child := &xmlNode{Name: xml.Name{Space: space, Local: local}, Attrs: attrs}
+	n.Children = append(n.Children, child)
+	return child
+}
+
+// removeChildren removes the child elements with the name for which match returns true
+func (n *xmlNode) removeChildren(space, local string, match func(*xmlNode) bool) {
+	var kept []*xmlNode
+	for _, child := range n.Children {
+		if child.Name.Space == space && child.Name.Local == local && match(child) {
+			continue
+		}
+		kept = append(kept, child)
+	}
+	n.Children = kept
+}
+
+func (n *xmlNode) removeChild(child *xmlNode) {
+	n.removeChildren(child.Name.Space, child.Name.Local, func(c *xmlNode) bool { return c == child })
+}
+
+// setChildText sets the text of a child element, or removes the child if the text is empty
+func (n *xmlNode) setChildText(space, local, text string) {
+	if text == "" {
+		n.removeChildren(space, local, func(*xmlNode) bool { return true })
+		return
+	}
+	n.ensureChild(space, local).Text = text
+}
+
+// mergeIntoEntry sets the properties in the attributes on an existing contact entry. Properties that are not in
+// the attributes, other email addresses, phone numbers, and addresses, and all elements that are not synced, such
+// as photo links, group memberships, and other user-defined fields, are left as they are.
+func mergeIntoEntry(entry *xmlNode, attrs map[string]string) {
+	if value, ok := attrs[contactFieldNotes]; ok {
+		content := entry.ensureChild(xmlnsAtom, "content")
+		content.setAttr("", "type", "text")
+		content.Text = value
+	}
+
+	mergeIntoChild(entry, xmlnsGData, "name", nil, attrs, [][2]string{
+		{contactFieldFullName, "fullName"},
+		{contactFieldGivenName, "givenName"},
+		{contactFieldFamilyName, "familyName"},
+	})
+
+	if value, ok := attrs[contactFieldEmail]; ok {
+		email := entry.primaryChild(xmlnsGData, "email")
+		if email == nil && value != "" {
+			email = entry.addChild(xmlnsGData, "email", primaryWorkAttrs()...)
+		}
+		if value == "" && email != nil {
+			entry.removeChild(email)
+		} else if email != nil {
+			email.setAttr("", "address", value)
+		}
+	}
+
+	if value, ok := attrs[contactFieldPhoneNumber]; ok {
+		phone := entry.primaryChild(xmlnsGData, "phoneNumber")
+		if phone == nil && value != "" {
+			phone = entry.addChild(xmlnsGData, "phoneNumber", primaryWorkAttrs()...)
+		}
+		if value == "" && phone != nil {
+			entry.removeChild(phone)
+		} else if phone != nil {
+			phone.Text = value
+		}
+	}
+
+	for _, field := range contactOtherEmails {
+		if value, ok := attrs[field[0]]; ok {
+			mergeIntoRel(entry, "email", field[1], value, func(email *xmlNode) {
+				email.setAttr("", "address", value)
+			})
+		}
+	}
+	for _, field := range contactOtherPhones {
+		if value, ok := attrs[field[0]]; ok {
+			mergeIntoRel(entry, "phoneNumber", field[1], value, func(phone *xmlNode) {
+				phone.Text = value
+			})
+		}
+	}
+
+	if value, ok := attrs[contactFieldWhere]; ok {
+		if value == "" {
+			entry.removeChildren(xmlnsGData, "where", func(*xmlNode) bool { return true })
+		} else {
+			entry.ensureChild(xmlnsGData, "where").setAttr("", "valueString", value)
+		}
+	}
+
+	mergeIntoChild(entry, xmlnsGData, "organization", primaryWorkAttrs(), attrs, [][2]string{
+		{contactFieldOrganization, "orgName"},
+		{contactFieldTitle, "orgTitle"},
+		{contactFieldJobDescription, "orgJobDescription"},
+		{contactFieldDepartment, "orgDepartment"},
+	})
+
+	mergeIntoChild(entry, xmlnsGData, "structuredPostalAddress", primaryWorkAttrs(), attrs, [][2]string{
+		{contactFieldStreet, "street"},
+		{contactFieldCity, "city"},
+		{contactFieldRegion, "region"},
+		{contactFieldPostalCode, "postcode"},
+		{contactFieldCountry, "country"},
+	})
+
+	if value, ok := attrs[contactFieldBirthday]; ok {
+		entry.removeChildren(xmlnsContact, "birthday", func(*xmlNode) bool { return true })
+		if value != "" {
+			entry.addChild(xmlnsContact, "birthday", xml.Attr{Name: xml.Name{Local: "when"}, Value: value})
+		}
+	}
+
+	if value, ok := attrs[contactFieldAnniversary]; ok {
+		entry.removeChildren(xmlnsContact, "event", func(c *xmlNode) bool { return c.attr("", "rel") == "anniversary" })
+		if value != "" {
+			event := entry.addChild(xmlnsContact, "event", xml.Attr{Name: xml.Name{Local: "rel"}, Value: "anniversary"})
+			event.addChild(xmlnsGData, "when", xml.Attr{Name: xml.Name{Local: "startTime"}, Value: value})
+		}
+	}
+
+	if value, ok := attrs[contactFieldPreferredName]; ok {
+		entry.setChildText(xmlnsContact, "nickname", value)
+	}
+
+	if value, ok := attrs[contactFieldPronouns]; ok {
+		entry.removeChildren(xmlnsContact, "userDefinedField", func(c *xmlNode) bool {
+			return c.attr("", "key") == contactFieldPronouns
+		})
+		if value != "" {
+			entry.addChild(xmlnsContact, "userDefinedField",
+				xml.Attr{Name: xml.Name{Local: "key"}, Value: contactFieldPronouns},
+				xml.Attr{Name: xml.Name{Local: "value"}, Value: value})
+		}
+	}
+}
+
+// mergeIntoChild sets the text of the sub-elements of the primary child element with the name, for the attributes
+// in fields that are present. The child is added if it is missing, and removed if it is left without sub-elements.
+// A formattedAddress is removed when an address changes, so that Google formats it again.
+func mergeIntoChild(entry *xmlNode, space, local string, newAttrs []xml.Attr, attrs map[string]string,
+	fields [][2]string) {
+	var changed bool
+	for _, field := range fields {
+		if _, ok := attrs[field[0]]; ok {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	child := entry.primaryChild(space, local)
+	if child == nil {
+		child = entry.addChild(space, local, newAttrs...)
+	}
+	for _, field := range fields {
+		if value, ok := attrs[field[0]]; ok {
+			child.setChildText(space, field[1], value)
+		}
+	}
+	child.removeChildren(xmlnsGData, "formattedAddress", func(*xmlNode) bool { return true })
+	if len(child.Children) == 0 {
+		entry.removeChild(child)
+	}
+}
+
+// mergeIntoRel calls set with the first gd element with the name and rel that is not the primary one, adding it if
+// there is none. If the value is empty, the element is removed instead.
+func mergeIntoRel(entry *xmlNode, local, rel, value string, set func(*xmlNode)) {
+	var child *xmlNode
+	for _, c := range entry.Children {
+		if c.Name.Space == xmlnsGData && c.Name.Local == local && c.attr("", "rel") == rel &&
+			c.attr("", "primary") != "true" {
+			child = c
+			break
+		}
+	}
+
+	if value == "" {
+		if child != nil {
+			entry.removeChild(child)
+		}
+		return
+	}
+	if child == nil {
+		child = entry.addChild(xmlnsGData, local, xml.Attr{Name: xml.Name{Local: "rel"}, Value: rel})
+	}
+	set(child)
+}
+
+func primaryWorkAttrs() []xml.Attr {
+	return []xml.Attr{
+		{Name: xml.Name{Local: "rel"}, Value: relWork},
+		{Name: xml.Name{Local: "primary"}, Value: "true"},
+	}
+}
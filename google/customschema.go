@@ -0,0 +1,254 @@
+package google
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+	"github.com/silinternational/personnel-sync/v5/pkg/diff"
+)
+
+// Custom schema field types of the Directory API
+const (
+	FieldTypeString = "STRING"
+	FieldTypeInt64  = "INT64"
+	FieldTypeDouble = "DOUBLE"
+	FieldTypeBool   = "BOOL"
+	FieldTypeDate   = "DATE"
+	FieldTypeEmail  = "EMAIL"
+	FieldTypePhone  = "PHONE"
+)
+
+// CustomSchemaField declares the type of a custom schema field, so that its values are written as the type the
+// field is defined with. Fields that are not declared are written as strings.
+type CustomSchemaField struct {
+	// Name is the schema name and field name, such as "Location.Floor"
+	Name string
+
+	// Type is the field type: STRING (the default), INT64, DOUBLE, BOOL, DATE, EMAIL, or PHONE
+	Type string
+
+	// MultiValued is set for a field that holds a list of values. The attribute value is the list, separated by
+	// commas.
+	MultiValued bool
+}
+
+func (f CustomSchemaField) fieldType() string {
+	if f.Type == "" {
+		return FieldTypeString
+	}
+	return strings.ToUpper(f.Type)
+}
+
+func (f CustomSchemaField) validate() error {
+	if keys := strings.SplitN(f.Name, ".", 2); len(keys) < 2 || keys[0] == "" || keys[1] == "" {
+		return fmt.Errorf("CustomSchemaFields Name %q must be a schema name and field name, such as Location.Floor",
+			f.Name)
+	}
+	switch f.fieldType() {
+	case FieldTypeString, FieldTypeInt64, FieldTypeDouble, FieldTypeBool, FieldTypeDate, FieldTypeEmail,
+		FieldTypePhone:
+	default:
+		return fmt.Errorf("invalid CustomSchemaFields Type %q for %s", f.Type, f.Name)
+	}
+	return nil
+}
+
+// values splits the attribute value into the values of the field
+func (f CustomSchemaField) values(value string) []string {
+	if !f.MultiValued {
+		return []string{value}
+	}
+	if value = diff.NormalizeList(value, true); value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// encode returns the attribute value as the field's type, in the form the Directory API expects
+func (f CustomSchemaField) encode(value string) (interface{}, error) {
+	if f.MultiValued {
+		items := []map[string]interface{}{}
+		for _, v := range f.values(value) {
+			item, err := f.encodeOne(v)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, map[string]interface{}{"value": item})
+		}
+		return items, nil
+	}
+	if value == "" {
+		return nil, nil
+	}
+	return f.encodeOne(value)
+}
+
+func (f CustomSchemaField) encodeOne(value string) (interface{}, error) {
+	value = strings.TrimSpace(value)
+	switch f.fieldType() {
+	case FieldTypeInt64:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("%s value %q is not an integer", f.Name, value)
+		}
+		return json.Number(value), nil
+	case FieldTypeDouble:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("%s value %q is not a number", f.Name, value)
+		}
+		return json.Number(value), nil
+	case FieldTypeBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s value %q is not true or false", f.Name, value)
+		}
+		return b, nil
+	}
+	return value, nil
+}
+
+// formatCustomSchemaValue returns a custom schema field value read from the Directory API as an attribute value.
+// Numbers and booleans are formatted as text, and the values of a multi-valued field are separated by commas.
+func formatCustomSchemaValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); ok {
+				values = append(values, formatCustomSchemaValue(m["value"]))
+			}
+		}
+		return strings.Join(values, ",")
+	}
+	return ""
+}
+
+// customSchemaField returns the declared field with the name, such as "Location.Floor"
+func (g *GoogleUsers) customSchemaField(name string) (CustomSchemaField, bool) {
+	for _, field := range g.CustomSchemaFields {
+		if strings.EqualFold(field.Name, name) {
+			return field, true
+		}
+	}
+	return CustomSchemaField{}, false
+}
+
+// typeCustomSchemas converts the values of the declared CustomSchemaFields in the user's custom schemas from text
+// to their declared type
+func (g *GoogleUsers) typeCustomSchemas(user *admin.User) error {
+	if len(g.CustomSchemaFields) == 0 {
+		return nil
+	}
+	for schemaName, raw := range user.CustomSchemas {
+		var properties map[string]string
+		if err := json.Unmarshal(raw, &properties); err != nil {
+			return fmt.Errorf("error reading custom schema %s, %s", schemaName, err)
+		}
+		typed := map[string]interface{}{}
+		for key, value := range properties {
+			field, ok := g.customSchemaField(schemaName + "." + key)
+			if !ok {
+				typed[key] = value
+				continue
+			}
+			encoded, err := field.encode(value)
+			if err != nil {
+				return err
+			}
+			typed[key] = encoded
+		}
+		j, err := json.Marshal(typed)
+		if err != nil {
+			return fmt.Errorf("error marshaling custom schema, %s", err)
+		}
+		user.CustomSchemas[schemaName] = googleapi.RawMessage(j)
+	}
+	return nil
+}
+
+// validateCustomSchemas checks that each declared field that is given to a person is defined in the domain's custom
+// schemas with the declared type, and that the person's value is of that type. It returns the reason each invalid
+// person fails, by compare value. The schemas are only listed if there are declared fields to check.
+func (g *GoogleUsers) validateCustomSchemas(people []internal.Person) map[string]string {
+	failures := map[string]string{}
+	if len(g.CustomSchemaFields) == 0 {
+		return failures
+	}
+
+	var schemas map[string]*admin.SchemaFieldSpec
+	var listErr error
+	listed := false
+	for _, person := range people {
+		for _, field := range g.CustomSchemaFields {
+			value, ok := person.Attributes[field.Name]
+			if !ok {
+				continue
+			}
+			if !listed {
+				schemas, listErr = g.listSchemaFields()
+				listed = true
+			}
+			if reason := checkCustomSchemaField(field, schemas, listErr, value); reason != "" {
+				failures[person.CompareValue] = reason
+				break
+			}
+		}
+	}
+	return failures
+}
+
+func checkCustomSchemaField(field CustomSchemaField, schemas map[string]*admin.SchemaFieldSpec, listErr error,
+	value string) string {
+
+	if listErr != nil {
+		return fmt.Sprintf("unable to validate %s: %s", field.Name, listErr)
+	}
+	spec, ok := schemas[strings.ToLower(field.Name)]
+	if !ok {
+		return fmt.Sprintf("custom schema field %s does not exist", field.Name)
+	}
+	if !strings.EqualFold(spec.FieldType, field.fieldType()) || spec.MultiValued != field.MultiValued {
+		return fmt.Sprintf("custom schema field %s is %s with multiValued %t, not %s with multiValued %t as "+
+			"declared", field.Name, spec.FieldType, spec.MultiValued, field.fieldType(), field.MultiValued)
+	}
+	if _, err := field.encode(value); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// listSchemaFields returns the field of every custom schema, keyed by the lower case schema and field name
+func (g *GoogleUsers) listSchemaFields() (map[string]*admin.SchemaFieldSpec, error) {
+	if g.SchemaService == nil {
+		service, err := initGoogleAdminService(g.GoogleConfig.GoogleAuth, g.GoogleConfig.DelegatedAdminEmail,
+			admin.AdminDirectoryUserschemaReadonlyScope)
+		if err != nil {
+			return nil, err
+		}
+		g.SchemaService = &service
+	}
+
+	schemas, err := g.SchemaService.Schemas.List("my_customer").Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list custom schemas: %s", err)
+	}
+
+	fields := map[string]*admin.SchemaFieldSpec{}
+	for _, schema := range schemas.Schemas {
+		for _, field := range schema.Fields {
+			fields[strings.ToLower(schema.SchemaName+"."+field.FieldName)] = field
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,122 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+var testCustomSchemaFields = []CustomSchemaField{
+	{Name: "Location.Floor", Type: "int64"},
+	{Name: "Employment.Contractor", Type: FieldTypeBool},
+	{Name: "Employment.Rate", Type: FieldTypeDouble},
+	{Name: "Skills.Languages", MultiValued: true},
+}
+
+func TestGoogleUsers_typeCustomSchemas(t *testing.T) {
+	g := GoogleUsers{PersonalSchema: DefaultPersonalSchema, CustomSchemaFields: testCustomSchemaFields}
+	person := internal.Person{Attributes: map[string]string{
+		"Location.Floor":        "3",
+		"Location.Building":     "North",
+		"Employment.Contractor": "true",
+		"Employment.Rate":       "",
+		"Skills.Languages":      "French, English",
+	}}
+
+	user, err := g.newUser(person, admin.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Location":   `{"Building":"North","Floor":3}`,
+		"Employment": `{"Contractor":true,"Rate":null}`,
+		"Skills":     `{"Languages":[{"value":"English"},{"value":"French"}]}`,
+	}
+	got := map[string]string{}
+	for name, raw := range user.CustomSchemas {
+		got[name] = string(raw)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CustomSchemas = %v, want %v", got, want)
+	}
+
+	person.Attributes["Location.Floor"] = "third"
+	if _, err := g.newUser(person, admin.User{}); err == nil {
+		t.Error("newUser() did not return an error for a value that is not an integer")
+	}
+
+	listed := extractData(admin.User{CustomSchemas: map[string]googleapi.RawMessage{
+		"Location":   googleapi.RawMessage(`{"Floor":"3","Wing":2}`),
+		"Employment": googleapi.RawMessage(`{"Contractor":false,"Rate":12.5}`),
+		"Skills":     googleapi.RawMessage(`{"Languages":[{"value":"English"},{"type":"work","value":"French"}]}`),
+	}})
+	for attribute, value := range map[string]string{"Location.Floor": "3", "Location.Wing": "2",
+		"Employment.Contractor": "false", "Employment.Rate": "12.5", "Skills.Languages": "English,French"} {
+		if listed.Attributes[attribute] != value {
+			t.Errorf("extractData() %s = %q, want %q", attribute, listed.Attributes[attribute], value)
+		}
+	}
+
+	for _, field := range []CustomSchemaField{{Name: "Floor"}, {Name: "Location.Floor", Type: "NUMBER"}} {
+		if err := field.validate(); err == nil {
+			t.Errorf("validate() did not return an error for %+v", field)
+		}
+	}
+}
+
+func TestGoogleUsers_validateCustomSchemas(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_ = json.NewEncoder(w).Encode(admin.Schemas{Schemas: []*admin.Schema{
+			{SchemaName: "Location", Fields: []*admin.SchemaFieldSpec{{FieldName: "Floor", FieldType: "INT64"}}},
+			{SchemaName: "Employment", Fields: []*admin.SchemaFieldSpec{{FieldName: "Contractor", FieldType: "STRING"}}},
+			{SchemaName: "Skills", Fields: []*admin.SchemaFieldSpec{
+				{FieldName: "Languages", FieldType: "STRING", MultiValued: true},
+			}},
+		}})
+	}))
+	defer server.Close()
+
+	service, err := admin.NewService(context.Background(), option.WithEndpoint(server.URL+"/"),
+		option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := GoogleUsers{SchemaService: service, CustomSchemaFields: testCustomSchemaFields}
+
+	if failures := g.validateCustomSchemas([]internal.Person{{CompareValue: "plain@example.org",
+		Attributes: map[string]string{"title": "Director"}}}); len(failures) > 0 || requests > 0 {
+		t.Errorf("validateCustomSchemas() = %v after %v requests, want no failures or requests", failures, requests)
+	}
+
+	people := []internal.Person{
+		{CompareValue: "valid@example.org", Attributes: map[string]string{"Location.Floor": "3",
+			"Skills.Languages": "French"}},
+		{CompareValue: "text@example.org", Attributes: map[string]string{"Location.Floor": "third"}},
+		{CompareValue: "type@example.org", Attributes: map[string]string{"Employment.Contractor": "true"}},
+		{CompareValue: "missing@example.org", Attributes: map[string]string{"Employment.Rate": "1.5"}},
+	}
+	failures := g.validateCustomSchemas(people)
+	want := map[string]string{
+		"text@example.org": `Location.Floor value "third" is not an integer`,
+		"type@example.org": "custom schema field Employment.Contractor is STRING with multiValued false, " +
+			"not BOOL with multiValued false as declared",
+		"missing@example.org": "custom schema field Employment.Rate does not exist",
+	}
+	if !reflect.DeepEqual(failures, want) {
+		t.Errorf("validateCustomSchemas() = %v, want %v", failures, want)
+	}
+	if requests != 1 {
+		t.Errorf("custom schemas listed %v times, want 1", requests)
+	}
+}
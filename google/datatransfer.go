@@ -0,0 +1,168 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+	datatransfer "google.golang.org/api/admin/datatransfer/v1"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/option"
+)
+
+// DefaultTransferApplications are the applications whose data is transferred if TransferApplications is not set
+var DefaultTransferApplications = []string{"Drive and Docs", "Calendar"}
+
+// Overall status codes of a data transfer
+const (
+	transferStatusCompleted = "completed"
+	transferStatusFailed    = "failed"
+)
+
+// transferParams are the transfer parameters of the applications that need them, so that all files and calendar
+// resources are transferred
+var transferParams = map[string][]*datatransfer.ApplicationTransferParam{
+	"drive and docs": {{Key: "PRIVACY_LEVEL", Value: []string{"PRIVATE", "SHARED"}}},
+	"calendar":       {{Key: "RELEASE_RESOURCES", Value: []string{"TRUE"}}},
+}
+
+// transferState is the progress of the transfer of a user's data before the user is deleted
+type transferState int
+
+const (
+	transferStarted transferState = iota
+	transferInProgress
+	transferCompleted
+)
+
+// transferData makes sure the data of the user has been transferred to their manager, or to the
+// TransferDefaultOwner if they have none. A transfer is started if there is none, or if the last one failed. The
+// user can be deleted once the state is transferCompleted.
+func (g *GoogleUsers) transferData(email string) (transferState, string, error) {
+	user, err := g.getUser(email)
+	if err != nil {
+		return 0, "", fmt.Errorf("unable to get user: %s", err)
+	}
+
+	if err := g.initTransferService(); err != nil {
+		return 0, "", err
+	}
+
+	transfers, err := g.TransferService.Transfers.List().CustomerId(user.CustomerId).OldOwnerUserId(user.Id).Do()
+	if err != nil {
+		return 0, "", fmt.Errorf("unable to list data transfers: %s", err)
+	}
+	var last *datatransfer.DataTransfer
+	for _, transfer := range transfers.DataTransfers {
+		if last == nil || transfer.RequestTime > last.RequestTime {
+			last = transfer
+		}
+	}
+	if last != nil && last.OverallTransferStatusCode != transferStatusFailed {
+		if last.OverallTransferStatusCode == transferStatusCompleted {
+			return transferCompleted, "", nil
+		}
+		return transferInProgress, "", nil
+	}
+
+	newOwner, err := g.newDataOwner(user)
+	if err != nil {
+		return 0, "", err
+	}
+
+	applications, err := g.transferApplications(user.CustomerId)
+	if err != nil {
+		return 0, "", err
+	}
+
+	transfer := &datatransfer.DataTransfer{
+		OldOwnerUserId:           user.Id,
+		NewOwnerUserId:           newOwner.Id,
+		ApplicationDataTransfers: applications,
+	}
+	if _, err := g.TransferService.Transfers.Insert(transfer).Do(); err != nil {
+		return 0, "", fmt.Errorf("unable to start data transfer to %s: %s", newOwner.PrimaryEmail, err)
+	}
+	return transferStarted, newOwner.PrimaryEmail, nil
+}
+
+// newDataOwner returns the manager of the user, or the TransferDefaultOwner if they have none
+func (g *GoogleUsers) newDataOwner(user admin.User) (admin.User, error) {
+	ownerEmail := g.TransferDefaultOwner
+	if found := findFirstMatchingType(user.Relations, "manager"); found != nil {
+		if manager, ok := found["value"].(string); ok && manager != "" {
+			ownerEmail = manager
+		}
+	}
+	if ownerEmail == "" {
+		return admin.User{}, errors.New("no manager to transfer data to, and no TransferDefaultOwner")
+	}
+
+	owner, err := g.getUser(ownerEmail)
+	if err != nil {
+		return admin.User{}, fmt.Errorf("unable to get new data owner %s: %s", ownerEmail, err)
+	}
+	return owner, nil
+}
+
+// transferApplications returns a transfer for each of the TransferApplications, found by name
+func (g *GoogleUsers) transferApplications(customerID string) ([]*datatransfer.ApplicationDataTransfer, error) {
+	names := g.TransferApplications
+	if len(names) == 0 {
+		names = DefaultTransferApplications
+	}
+
+	ids := map[string]int64{}
+	err := g.TransferService.Applications.List().CustomerId(customerID).Pages(context.TODO(),
+		func(response *datatransfer.ApplicationsListResponse) error {
+			for _, application := range response.Applications {
+				ids[strings.ToLower(application.Name)] = application.Id
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list data transfer applications: %s", err)
+	}
+
+	var applications []*datatransfer.ApplicationDataTransfer
+	for _, name := range names {
+		id, ok := ids[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("data transfer application %q does not exist", name)
+		}
+		applications = append(applications, &datatransfer.ApplicationDataTransfer{
+			ApplicationId:             id,
+			ApplicationTransferParams: transferParams[strings.ToLower(name)],
+		})
+	}
+	return applications, nil
+}
+
+// initTransferService creates the TransferService if it has not been set
+func (g *GoogleUsers) initTransferService() error {
+	if g.TransferService != nil {
+		return nil
+	}
+
+	googleAuthJson, err := json.Marshal(g.GoogleConfig.GoogleAuth)
+	if err != nil {
+		return fmt.Errorf("unable to marshal google auth data into json, error: %s", err)
+	}
+
+	config, err := google.JWTConfigFromJSON(googleAuthJson, datatransfer.AdminDatatransferScope)
+	if err != nil {
+		return fmt.Errorf("unable to parse client secret file to config: %s", err)
+	}
+
+	ctx := context.Background()
+	config.Subject = g.GoogleConfig.DelegatedAdminEmail
+	service, err := datatransfer.NewService(ctx, option.WithHTTPClient(config.Client(ctx)))
+	if err != nil {
+		return fmt.Errorf("unable to create Data Transfer API service: %s", err)
+	}
+	g.TransferService = service
+	return nil
+}
@@ -1,12 +1,48 @@
 package google
 
+import "github.com/silinternational/personnel-sync/v5/internal"
+
 const DefaultBatchSize = 10
 const DefaultBatchDelaySeconds = 3
 
+func init() {
+	internal.RegisterSource(internal.SourceTypeGoogleSheets, NewGoogleSheetsSource)
+	internal.RegisterDestination(internal.DestinationTypeGoogleContacts, NewGoogleContactsDestination)
+	internal.RegisterDestination(internal.DestinationTypeGoogleGroups, NewGoogleGroupsDestination)
+	internal.RegisterDestination(internal.DestinationTypeGoogleSheets, NewGoogleSheetsDestination)
+	internal.RegisterDestination(internal.DestinationTypeGoogleUsers, NewGoogleUsersDestination)
+	internal.RegisterDestination(internal.DestinationTypeGoogleCalendar, NewGoogleCalendarDestination)
+	internal.RegisterDestination(internal.DestinationTypeGoogleCloudIdentity, NewGoogleCloudIdentityDestination)
+
+	internal.DescribeSource(internal.SourceTypeGoogleSheets, internal.AdapterConfig{
+		ExtraJSON: []interface{}{GoogleConfig{}},
+		SyncSet:   SheetsSyncSet{},
+	})
+	internal.DescribeDestination(internal.DestinationTypeGoogleCalendar, internal.AdapterConfig{
+		ExtraJSON: []interface{}{GoogleConfig{}, GoogleCalendar{}},
+		SyncSet:   CalendarSyncSet{},
+	})
+	internal.DescribeDestination(internal.DestinationTypeGoogleContacts, internal.AdapterConfig{
+		ExtraJSON: []interface{}{GoogleConfig{}, struct{ API string }{}},
+	})
+	internal.DescribeDestination(internal.DestinationTypeGoogleGroups, internal.AdapterConfig{
+		ExtraJSON: []interface{}{GoogleConfig{}, groupsConfig{}},
+		SyncSet:   GroupSyncSet{},
+	})
+	internal.DescribeDestination(internal.DestinationTypeGoogleSheets, internal.AdapterConfig{
+		ExtraJSON: []interface{}{GoogleConfig{}},
+		SyncSet:   SheetsSyncSet{},
+	})
+	users := internal.AdapterConfig{ExtraJSON: []interface{}{GoogleConfig{}, GoogleUsers{}}}
+	internal.DescribeDestination(internal.DestinationTypeGoogleUsers, users)
+	internal.DescribeDestination(internal.DestinationTypeGoogleCloudIdentity, users)
+}
+
 type GoogleConfig struct {
 	DelegatedAdminEmail string
 	Domain              string
 	GoogleAuth          GoogleAuth
+	Retry               internal.RetryConfig
 }
 
 type GoogleAuth struct {
@@ -2,13 +2,18 @@ package google
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/syslog"
+	"net/http"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 
 	admin "google.golang.org/api/admin/directory/v1"
+	groupssettings "google.golang.org/api/groupssettings/v1"
 
 	"github.com/silinternational/personnel-sync/v5/internal"
 
@@ -19,6 +24,15 @@ const RoleMember = "MEMBER"
 const RoleOwner = "OWNER"
 const RoleManager = "MANAGER"
 
+// RoleAttribute is the attribute that holds a member's role: OWNER, MANAGER, or MEMBER
+const RoleAttribute = "Role"
+
+// rolePattern matches the roles that a member can be given
+var rolePattern = regexp.MustCompile(`^(?i)(OWNER|MANAGER|MEMBER)$`)
+
+// DefaultListConcurrency is the number of groups whose members are listed at the same time before the first sync set
+const DefaultListConcurrency = 5
+
 type GoogleGroups struct {
 	DestinationConfig internal.DestinationConfig
 	GoogleConfig      GoogleConfig
@@ -26,6 +40,50 @@ type GoogleGroups struct {
 	GroupSyncSet      GroupSyncSet
 	BatchSize         int
 	BatchDelaySeconds int
+
+	// ListConcurrency is the number of groups whose members are listed at the same time before the first sync set
+	ListConcurrency int
+
+	// GroupSettings are the settings that every group is given, such as "whoCanPostMessage", by their Groups
+	// Settings API property name. The Settings of a sync set are used in place of those with the same name.
+	GroupSettings map[string]string
+
+	// Bulk adds the members of a group over several runs when there are many to add
+	Bulk BulkConfig
+
+	// CreateGroups creates the group of a sync set if it does not exist, instead of failing the sync set
+	CreateGroups bool
+
+	// ExpandNestedGroups lists the members of the groups that are members of a group, so that people who are
+	// members through a nested group are not added directly
+	ExpandNestedGroups bool
+
+	// Workers is the number of membership changes that are made at the same time, instead of pacing them by
+	// BatchSize and BatchDelaySeconds. When Google limits the rate of requests, all workers wait, with backoff
+	// as set by the Retry of the GoogleConfig, and the change is tried again.
+	Workers int
+
+	// SettingsService gets and changes group settings. If it is nil, it is created when it is first needed, with
+	// the apps.groups.settings scope.
+	SettingsService *groupssettings.Service `json:"-"`
+
+	// preloaded holds the members of each group, keyed by lowercase group email, until its sync set lists them
+	preloaded map[string][]*admin.Member
+
+	// groupMissing is set when the group of the sync set was not found, and is to be created
+	groupMissing bool
+
+	// indirect holds the lowercase email of each listed person who is only a member through a nested group
+	indirect map[string]bool
+
+	// stateStore keeps the progress of bulk loads, if it is set
+	stateStore internal.StateStore
+
+	// clock is used to end the time window of bulk loads. It is SystemClock if it is nil.
+	clock internal.Clock
+
+	// backoff is shared by the Workers while they make the changes of a sync set
+	backoff *sharedBackoff
 }
 
 type GroupSyncSet struct {
@@ -38,6 +96,25 @@ type GroupSyncSet struct {
 	DisableAdd    bool
 	DisableUpdate bool
 	DisableDelete bool
+
+	// Settings are the settings of the group, in addition to the GroupSettings of the destination
+	Settings map[string]string
+
+	// GroupName and GroupDescription are given to the group if it is created. The name is the GroupEmail if it is
+	// not set.
+	GroupName        string
+	GroupDescription string
+}
+
+// groupsConfig is the part of the ExtraJSON of a Google Groups destination that is not GoogleConfig
+type groupsConfig struct {
+	ListConcurrency int
+	GroupSettings   map[string]string
+	CreateGroups    bool
+	Bulk            BulkConfig
+
+	ExpandNestedGroups bool
+	Workers            int
 }
 
 func NewGoogleGroupsDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
@@ -47,6 +124,19 @@ func NewGoogleGroupsDestination(destinationConfig internal.DestinationConfig) (i
 	if err != nil {
 		return &GoogleGroups{}, err
 	}
+	var extraConfig groupsConfig
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &extraConfig); err != nil {
+		return &GoogleGroups{}, err
+	}
+	googleGroups.ListConcurrency = extraConfig.ListConcurrency
+	if err := validateGroupSettings(extraConfig.GroupSettings); err != nil {
+		return &GoogleGroups{}, err
+	}
+	googleGroups.GroupSettings = extraConfig.GroupSettings
+	googleGroups.CreateGroups = extraConfig.CreateGroups
+	googleGroups.Bulk = extraConfig.Bulk
+	googleGroups.ExpandNestedGroups = extraConfig.ExpandNestedGroups
+	googleGroups.Workers = extraConfig.Workers
 
 	// Defaults
 	if googleGroups.BatchSize <= 0 {
@@ -55,6 +145,9 @@ func NewGoogleGroupsDestination(destinationConfig internal.DestinationConfig) (i
 	if googleGroups.BatchDelaySeconds <= 0 {
 		googleGroups.BatchDelaySeconds = DefaultBatchDelaySeconds
 	}
+	if googleGroups.ListConcurrency <= 0 {
+		googleGroups.ListConcurrency = DefaultListConcurrency
+	}
 
 	// Initialize AdminService object
 	googleGroups.AdminService, err = initGoogleAdminService(
@@ -80,41 +173,177 @@ func (g *GoogleGroups) ForSet(syncSetJson json.RawMessage) error {
 	if syncSetConfig.GroupEmail == "" {
 		return fmt.Errorf("GroupEmail missing from sync set json")
 	}
+	if !internal.EmailAddressPattern.MatchString(syncSetConfig.GroupEmail) {
+		return fmt.Errorf("GroupEmail %q is not an email address", syncSetConfig.GroupEmail)
+	}
+	lists := [][]string{syncSetConfig.Owners, syncSetConfig.ExtraOwners, syncSetConfig.Managers,
+		syncSetConfig.ExtraManagers, syncSetConfig.ExtraMembers}
+	for _, emails := range lists {
+		for _, email := range emails {
+			if !internal.EmailAddressPattern.MatchString(email) {
+				return fmt.Errorf("%q in the sync set of group %s is not an email address", email,
+					syncSetConfig.GroupEmail)
+			}
+		}
+	}
+
+	if err := validateGroupSettings(syncSetConfig.Settings); err != nil {
+		return fmt.Errorf("invalid Settings of group %s: %s", syncSetConfig.GroupEmail, err)
+	}
 
 	g.GroupSyncSet = syncSetConfig
 
 	return nil
 }
 
-func (g *GoogleGroups) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+// LintRules checks that members are email addresses with a valid role
+func (g *GoogleGroups) LintRules() []internal.LintRule {
+	return []internal.LintRule{
+		{Attribute: "Email", Pattern: internal.EmailAddressPattern, Description: "an email address"},
+		{Attribute: RoleAttribute, Pattern: rolePattern, Description: "OWNER, MANAGER, or MEMBER"},
+	}
+}
+
+// PreloadSyncSets lists the members of the groups of all sync sets, ListConcurrency groups at a time, so that each
+// sync set can use the members listed for its group instead of waiting to list them. A group that could not be listed
+// is listed again by its sync set.
+func (g *GoogleGroups) PreloadSyncSets(syncSetsJson []json.RawMessage) error {
+	var groupEmails []string
+	seen := map[string]bool{}
+	for _, syncSetJson := range syncSetsJson {
+		var syncSetConfig GroupSyncSet
+		if err := json.Unmarshal(syncSetJson, &syncSetConfig); err != nil || syncSetConfig.GroupEmail == "" {
+			continue // reported by ForSet
+		}
+		key := strings.ToLower(syncSetConfig.GroupEmail)
+		if seen[key] {
+			continue // listed by the first sync set, since the members may change before the second
+		}
+		seen[key] = true
+		groupEmails = append(groupEmails, syncSetConfig.GroupEmail)
+	}
+
+	concurrency := g.ListConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultListConcurrency
+	}
+
+	preloaded := map[string][]*admin.Member{}
+	var errs []string
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for _, groupEmail := range groupEmails {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(groupEmail string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			members, err := g.listMembers(groupEmail)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				if !(g.CreateGroups && isNotFound(err)) { // a missing group is created by its sync set
+					errs = append(errs, err.Error())
+				}
+				return
+			}
+			preloaded[strings.ToLower(groupEmail)] = members
+		}(groupEmail)
+	}
+	wg.Wait()
+
+	g.preloaded = preloaded
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("%v of %v groups were not preloaded: %s", len(errs), len(groupEmails), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// listMembers lists all members of a group, page by page
+func (g *GoogleGroups) listMembers(groupEmail string) ([]*admin.Member, error) {
 	var membersList []*admin.Member
-	membersListCall := g.AdminService.Members.List(g.GroupSyncSet.GroupEmail)
+	membersListCall := g.AdminService.Members.List(groupEmail)
 	err := membersListCall.Pages(context.TODO(), func(members *admin.Members) error {
 		membersList = append(membersList, members.Members...)
 		return nil
 	})
 	if err != nil {
-		return []internal.Person{}, fmt.Errorf("unable to get members of group %s: %s", g.GroupSyncSet.GroupEmail, err.Error())
+		return nil, statusError(err, fmt.Errorf("unable to get members of group %s: %s", groupEmail, err.Error()))
+	}
+	return membersList, nil
+}
+
+func isNotFound(err error) bool {
+	var notFoundErr *internal.NotFoundError
+	return errors.As(err, &notFoundErr)
+}
+
+func (g *GoogleGroups) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+	g.groupMissing = false
+	g.indirect = map[string]bool{}
+	key := strings.ToLower(g.GroupSyncSet.GroupEmail)
+	membersList, ok := g.preloaded[key]
+	if ok {
+		delete(g.preloaded, key)
+	} else {
+		var err error
+		membersList, err = g.listMembers(g.GroupSyncSet.GroupEmail)
+		if err != nil && g.CreateGroups && isNotFound(err) {
+			g.groupMissing = true
+			return []internal.Person{}, nil
+		}
+		if err != nil {
+			return []internal.Person{}, err
+		}
 	}
 
 	var members []internal.Person
+	direct := map[string]bool{}
 
 	for _, nextMember := range membersList {
-		// Do not include Extra Managers or ExtraOwners in list to prevent inclusion in delete list
-		if isExtraManager, _ := internal.InArray(nextMember.Email, g.GroupSyncSet.ExtraManagers); isExtraManager {
+		direct[strings.ToLower(nextMember.Email)] = true
+		if g.isExtra(nextMember.Email) {
 			continue
 		}
-		if isExtraOwner, _ := internal.InArray(nextMember.Email, g.GroupSyncSet.ExtraOwners); isExtraOwner {
-			continue
-		}
-		if isExtraMember, _ := internal.InArray(nextMember.Email, g.GroupSyncSet.ExtraMembers); isExtraMember {
+		// Nested groups are expanded rather than synced, so that they are not deleted
+		if g.ExpandNestedGroups && nextMember.Type == memberTypeGroup {
 			continue
 		}
 
 		members = append(members, internal.Person{
 			CompareValue: nextMember.Email,
 			Attributes: map[string]string{
-				"Email": strings.ToLower(nextMember.Email),
+				"Email":       strings.ToLower(nextMember.Email),
+				RoleAttribute: nextMember.Role,
+			},
+		})
+	}
+
+	if !g.ExpandNestedGroups {
+		return members, nil
+	}
+	nested, err := g.nestedMembers(membersList)
+	if err != nil {
+		return []internal.Person{}, err
+	}
+	var emails []string
+	for email := range nested {
+		if !direct[email] && !g.isExtra(email) {
+			emails = append(emails, email)
+		}
+	}
+	sort.Strings(emails)
+	for _, email := range emails {
+		g.indirect[email] = true
+		members = append(members, internal.Person{
+			CompareValue: email,
+			Attributes: map[string]string{
+				"Email":       email,
+				RoleAttribute: RoleMember,
 			},
 		})
 	}
@@ -122,6 +351,18 @@ func (g *GoogleGroups) ListUsers(desiredAttrs []string) ([]internal.Person, erro
 	return members, nil
 }
 
+// isExtra reports whether the email is one of the ExtraManagers, ExtraOwners, or ExtraMembers. They are not listed,
+// so that they are not deleted.
+func (g *GoogleGroups) isExtra(email string) bool {
+	for _, extras := range [][]string{g.GroupSyncSet.ExtraManagers, g.GroupSyncSet.ExtraOwners,
+		g.GroupSyncSet.ExtraMembers} {
+		if isExtra, _ := internal.InArray(email, extras); isExtra {
+			return true
+		}
+	}
+	return false
+}
+
 func (g *GoogleGroups) ApplyChangeSet(
 	changes internal.ChangeSet,
 	eventLog chan<- internal.EventLogItem) internal.ChangeResults {
@@ -129,22 +370,41 @@ func (g *GoogleGroups) ApplyChangeSet(
 	var results internal.ChangeResults
 	var wg sync.WaitGroup
 
+	if g.groupMissing {
+		if g.GroupSyncSet.DisableAdd {
+			eventLog <- internal.EventLogItem{
+				Level: syslog.LOG_WARNING,
+				Message: fmt.Sprintf("Google group %s does not exist, and is not created with DisableAdd",
+					g.GroupSyncSet.GroupEmail),
+			}
+			return results
+		}
+		if err := g.createGroup(); err != nil {
+			eventLog <- internal.EventLogItem{
+				Level:    syslog.LOG_ERR,
+				Category: internal.ClassifyError(err),
+				Message:  err.Error()}
+			return results
+		}
+		g.groupMissing = false
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_INFO,
+			Message: "CreateGroup " + g.GroupSyncSet.GroupEmail,
+		}
+	}
+
 	// key = email, value = role
 	toBeCreated := map[string]string{}
 	for _, person := range changes.Create {
-		toBeCreated[person.CompareValue] = RoleMember
-	}
-
-	// Update Owner / Manager roles
-	for _, owner := range g.GroupSyncSet.Owners {
-		if _, ok := toBeCreated[owner]; ok {
-			toBeCreated[owner] = RoleOwner
-		}
-	}
-	for _, manager := range g.GroupSyncSet.Managers {
-		if _, ok := toBeCreated[manager]; ok {
-			toBeCreated[manager] = RoleManager
+		role, err := g.memberRole(person)
+		if err != nil {
+			eventLog <- internal.EventLogItem{
+				Level: syslog.LOG_ERR,
+				Message: fmt.Sprintf("unable to insert %s in Google group %s: %s", person.CompareValue,
+					g.GroupSyncSet.GroupEmail, err)}
+			continue
 		}
+		toBeCreated[person.CompareValue] = role
 	}
 
 	// Add any ExtraManagers, ExtraOwners, and ExtraMembers to Create list since they are not in the source people
@@ -158,14 +418,62 @@ func (g *GoogleGroups) ApplyChangeSet(
 		toBeCreated[member] = RoleMember
 	}
 
+	if !g.GroupSyncSet.DisableUpdate {
+		g.applyGroupSettings(eventLog)
+	}
+
 	// One minute per batch
-	batchTimer := internal.NewBatchTimer(g.BatchSize, g.BatchDelaySeconds)
+	batchTimer := internal.NewBatchTimerWithClock(g.BatchSize, g.BatchDelaySeconds, g.getClock())
+
+	var workers *memberWorkers
+	g.backoff = nil
+	if g.Workers > 0 {
+		workers = startMemberWorkers(g.Workers)
+		g.backoff = newSharedBackoff(g.GoogleConfig.Retry, g.getClock())
+	}
+	dispatch := func(change func()) {
+		if workers != nil {
+			workers.do(change)
+			return
+		}
+		go change()
+		batchTimer.WaitOnBatch()
+	}
 
+	var bulk *bulkLoad
 	if !g.GroupSyncSet.DisableAdd {
+		bulk = g.startBulkLoad(len(changes.Create), eventLog)
 		for email, role := range toBeCreated {
+			if bulk != nil && bulk.windowEnded(g.getClock()) {
+				break
+			}
+			email, role := email, role
+			wg.Add(1)
+			dispatch(func() { g.addMember(email, role, &results.Created, &wg, eventLog) })
+			if bulk != nil {
+				bulk.dispatch(atomic.LoadUint64(&results.Created), eventLog)
+			}
+		}
+	}
+
+	if !g.GroupSyncSet.DisableUpdate {
+		for _, person := range changes.Update {
+			role, err := g.memberRole(person)
+			if err != nil {
+				eventLog <- internal.EventLogItem{
+					Level: syslog.LOG_ERR,
+					Message: fmt.Sprintf("unable to update %s in Google group %s: %s", person.CompareValue,
+						g.GroupSyncSet.GroupEmail, err)}
+				continue
+			}
+			email := person.CompareValue
 			wg.Add(1)
-			go g.addMember(email, role, &results.Created, &wg, eventLog)
-			batchTimer.WaitOnBatch()
+			if g.indirect[strings.ToLower(email)] {
+				// a member through a nested group is given another role by adding them directly
+				dispatch(func() { g.addMember(email, role, &results.Created, &wg, eventLog) })
+			} else {
+				dispatch(func() { g.updateMemberRole(email, role, &results.Updated, &wg, eventLog) })
+			}
 		}
 	}
 
@@ -181,17 +489,71 @@ func (g *GoogleGroups) ApplyChangeSet(
 			if isExtraMember, _ := internal.InArray(dp.CompareValue, g.GroupSyncSet.ExtraMembers); isExtraMember {
 				continue
 			}
+			// Members through a nested group are removed from the nested group, not this one
+			if g.indirect[strings.ToLower(dp.CompareValue)] {
+				continue
+			}
+			email := dp.CompareValue
 			wg.Add(1)
-			go g.removeMember(dp.CompareValue, &results.Deleted, &wg, eventLog)
-			batchTimer.WaitOnBatch()
+			dispatch(func() { g.removeMember(email, &results.Deleted, &wg, eventLog) })
 		}
 	}
 
+	if workers != nil {
+		workers.stop()
+	}
 	wg.Wait()
 
+	if bulk != nil {
+		g.finishBulkRun(bulk, results.Created, eventLog)
+	}
+
 	return results
 }
 
+// createGroup creates the group of the sync set with its GroupName and GroupDescription
+func (g *GoogleGroups) createGroup() error {
+	group := admin.Group{
+		Email:       g.GroupSyncSet.GroupEmail,
+		Name:        g.GroupSyncSet.GroupName,
+		Description: g.GroupSyncSet.GroupDescription,
+	}
+	if group.Name == "" {
+		group.Name = group.Email
+	}
+	if _, err := g.AdminService.Groups.Insert(&group).Do(); err != nil {
+		return statusError(err, fmt.Errorf("unable to create Google group %s: %s", group.Email, err))
+	}
+	return nil
+}
+
+// memberRole returns the role of the person in the group: OWNER or MANAGER if they are in the Owners or Managers of
+// the sync set, otherwise the role in their Role attribute, or MEMBER if they have none
+func (g *GoogleGroups) memberRole(person internal.Person) (string, error) {
+	if isOwner, _ := internal.InArray(person.CompareValue, g.GroupSyncSet.Owners); isOwner {
+		return RoleOwner, nil
+	}
+	if isManager, _ := internal.InArray(person.CompareValue, g.GroupSyncSet.Managers); isManager {
+		return RoleManager, nil
+	}
+	role := strings.TrimSpace(person.Attributes[RoleAttribute])
+	if role == "" {
+		return RoleMember, nil
+	}
+	if !rolePattern.MatchString(role) {
+		return "", fmt.Errorf("%q is not a role: OWNER, MANAGER, or MEMBER", role)
+	}
+	return strings.ToUpper(role), nil
+}
+
+// call sends a request to the Directory API, retrying it with the shared backoff when Workers are used
+func (g *GoogleGroups) call(request func() error) error {
+	if g.backoff == nil {
+		return request()
+	}
+	return g.backoff.call(request)
+}
+
 func (g *GoogleGroups) addMember(
 	email, role string,
 	counter *uint64,
@@ -205,19 +567,43 @@ func (g *GoogleGroups) addMember(
 		Email: email,
 	}
 
-	_, err := g.AdminService.Members.Insert(g.GroupSyncSet.GroupEmail, &newMember).Do()
-	if err != nil && !strings.Contains(err.Error(), "409") { // error code 409 is for existing user
-		eventLog <- internal.EventLogItem{
-			Level:   syslog.LOG_ERR,
-			Message: fmt.Sprintf("unable to insert %s in Google group %s: %s", email, g.GroupSyncSet.GroupEmail, err.Error())}
+	err := g.call(func() error {
+		_, err := g.AdminService.Members.Insert(g.GroupSyncSet.GroupEmail, &newMember).Do()
+		return err
+	})
+	if err != nil && !isStatus(err, http.StatusConflict) { // the person is already a member
+		eventLog <- internal.ChangeErrorEvent("AddMember", email,
+			fmt.Sprintf("unable to insert %s in Google group %s", email, g.GroupSyncSet.GroupEmail), err)
 		return
 	}
 
-	eventLog <- internal.EventLogItem{
-		Level:   syslog.LOG_INFO,
-		Message: "AddMember " + email,
+	eventLog <- internal.ChangeEvent("AddMember", email)
+
+	atomic.AddUint64(counter, 1)
+}
+
+func (g *GoogleGroups) updateMemberRole(
+	email, role string,
+	counter *uint64,
+	wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	err := g.call(func() error {
+		_, err := g.AdminService.Members.Patch(g.GroupSyncSet.GroupEmail, email, &admin.Member{Role: role}).Do()
+		return err
+	})
+	if err != nil {
+		eventLog <- internal.ChangeErrorEvent("UpdateMember", email,
+			fmt.Sprintf("unable to change role of %s in Google group %s", email, g.GroupSyncSet.GroupEmail), err)
+		return
 	}
 
+	event := internal.ChangeEvent("UpdateMember", email)
+	event.Message += " " + role
+	eventLog <- event
+
 	atomic.AddUint64(counter, 1)
 }
 
@@ -229,18 +615,16 @@ func (g *GoogleGroups) removeMember(
 
 	defer wg.Done()
 
-	err := g.AdminService.Members.Delete(g.GroupSyncSet.GroupEmail, email).Do()
+	err := g.call(func() error {
+		return g.AdminService.Members.Delete(g.GroupSyncSet.GroupEmail, email).Do()
+	})
 	if err != nil {
-		eventLog <- internal.EventLogItem{
-			Level:   syslog.LOG_ERR,
-			Message: fmt.Sprintf("unable to delete %s from Google group %s: %s", email, g.GroupSyncSet.GroupEmail, err.Error())}
+		eventLog <- internal.ChangeErrorEvent("RemoveMember", email,
+			fmt.Sprintf("unable to delete %s from Google group %s", email, g.GroupSyncSet.GroupEmail), err)
 		return
 	}
 
-	eventLog <- internal.EventLogItem{
-		Level:   syslog.LOG_INFO,
-		Message: "RemoveMember " + email,
-	}
+	eventLog <- internal.ChangeEvent("RemoveMember", email)
 
 	atomic.AddUint64(counter, 1)
 }
@@ -1,12 +1,25 @@
 package google
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/syslog"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/silinternational/personnel-sync/v5/internal"
 
 	admin "google.golang.org/api/admin/directory/v1"
+	groupssettings "google.golang.org/api/groupssettings/v1"
+	"google.golang.org/api/option"
 )
 
 func TestGoogleGroups_ApplyChangeSet(t *testing.T) {
@@ -112,3 +125,576 @@ func TestGoogleGroups_ListUsers(t *testing.T) {
 		})
 	}
 }
+
+func TestGoogleGroups_ForSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr bool
+	}{
+		{name: "valid", json: `{"GroupEmail": "staff@example.org", "ExtraMembers": ["a@example.org"]}`},
+		{name: "missing group", json: `{}`, wantErr: true},
+		{name: "invalid group", json: `{"GroupEmail": "staff"}`, wantErr: true},
+		{name: "invalid owner", json: `{"GroupEmail": "staff@example.org", "Owners": ["jane doe@example.org"]}`,
+			wantErr: true},
+		{name: "settings",
+			json: `{"GroupEmail": "staff@example.org", "Settings": {"whoCanPostMessage": "ALL_MEMBERS_CAN_POST"}}`},
+		{name: "invalid setting", json: `{"GroupEmail": "staff@example.org", "Settings": {"whoCanPost": "ANYONE"}}`,
+			wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var g GoogleGroups
+			if err := g.ForSet([]byte(tt.json)); (err != nil) != tt.wantErr {
+				t.Errorf("ForSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGoogleGroups_PreloadSyncSets(t *testing.T) {
+	var mutex sync.Mutex
+	requests := map[string]int{}
+	active, maxActive := 0, 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		groupEmail := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/admin/directory/v1/groups/"), "/members")
+		mutex.Lock()
+		requests[groupEmail]++
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mutex.Unlock()
+		defer func() {
+			mutex.Lock()
+			active--
+			mutex.Unlock()
+		}()
+
+		if groupEmail == "missing@example.org" {
+			http.Error(w, `{"error": {"code": 404, "message": "Resource Not Found"}}`, http.StatusNotFound)
+			return
+		}
+		members := admin.Members{Members: []*admin.Member{{Email: "a." + groupEmail}}}
+		if r.URL.Query().Get("pageToken") == "" {
+			members.NextPageToken = "2"
+		} else {
+			members.Members[0].Email = "b." + groupEmail
+		}
+		_ = json.NewEncoder(w).Encode(members)
+	}))
+	defer server.Close()
+
+	service, err := admin.NewService(context.Background(), option.WithEndpoint(server.URL+"/"),
+		option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := GoogleGroups{AdminService: *service, ListConcurrency: 2}
+
+	var syncSetsJson []json.RawMessage
+	for i := 1; i <= 5; i++ {
+		syncSetsJson = append(syncSetsJson, json.RawMessage(fmt.Sprintf(`{"GroupEmail": "group%v@example.org"}`, i)))
+	}
+	syncSetsJson = append(syncSetsJson, json.RawMessage(`{"GroupEmail": "GROUP1@example.org"}`),
+		json.RawMessage(`{"GroupEmail": "missing@example.org"}`))
+
+	if err := g.PreloadSyncSets(syncSetsJson); err == nil || !strings.Contains(err.Error(), "missing@example.org") {
+		t.Errorf("PreloadSyncSets() error = %v, want an error for missing@example.org", err)
+	}
+	if maxActive > 2 {
+		t.Errorf("PreloadSyncSets() listed %v groups at a time, want at most 2", maxActive)
+	}
+	if requests["group1@example.org"] != 2 || requests["GROUP1@example.org"] != 0 {
+		t.Errorf("PreloadSyncSets() made %v requests for group1, want one for each of 2 pages", requests)
+	}
+
+	for _, groupEmail := range []string{"group3@example.org", "group3@example.org"} {
+		if err := g.ForSet([]byte(`{"GroupEmail": "` + groupEmail + `"}`)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := g.ListUsers(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[0].CompareValue != "a.group3@example.org" || got[1].CompareValue != "b.group3@example.org" {
+			t.Errorf("ListUsers() = %v", got)
+		}
+	}
+	if requests["group3@example.org"] != 4 {
+		t.Errorf("ListUsers() made %v requests for group3, want 2 preloaded and 2 listed again by the second sync set",
+			requests["group3@example.org"])
+	}
+}
+
+func TestGoogleGroups_applyGroupSettings(t *testing.T) {
+	var patches []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			body, _ := ioutil.ReadAll(r.Body)
+			patches = append(patches, r.URL.Path+" "+strings.TrimSpace(string(body)))
+		}
+		_, _ = w.Write([]byte(`{"email": "staff@example.org", "whoCanPostMessage": "ALL_MEMBERS_CAN_POST", ` +
+			`"whoCanViewMembership": "ALL_IN_DOMAIN_CAN_VIEW", "allowExternalMembers": "true"}`))
+	}))
+	defer server.Close()
+
+	service, err := groupssettings.NewService(context.Background(), option.WithEndpoint(server.URL+"/"),
+		option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := GoogleGroups{
+		SettingsService: service,
+		GroupSettings:   map[string]string{"whoCanPostMessage": "ALL_MEMBERS_CAN_POST", "allowExternalMembers": "false"},
+		GroupSyncSet: GroupSyncSet{GroupEmail: "staff@example.org",
+			Settings: map[string]string{"whoCanViewMembership": "ALL_MANAGERS_CAN_VIEW"}},
+	}
+
+	eventLog := make(chan internal.EventLogItem, 10)
+	g.applyGroupSettings(eventLog)
+	close(eventLog)
+
+	want := []string{`/staff@example.org {"allowExternalMembers":"false",` +
+		`"whoCanViewMembership":"ALL_MANAGERS_CAN_VIEW"}`}
+	if !reflect.DeepEqual(patches, want) {
+		t.Errorf("patches = %q\nwant %q", patches, want)
+	}
+	msg := <-eventLog
+	wantMessage := "UpdateGroupSettings staff@example.org: allowExternalMembers=false, " +
+		"whoCanViewMembership=ALL_MANAGERS_CAN_VIEW"
+	if msg.Message != wantMessage {
+		t.Errorf("event = %q, want %q", msg.Message, wantMessage)
+	}
+
+	patches = nil
+	g.GroupSettings = map[string]string{"whoCanPostMessage": "all_members_can_post"}
+	g.GroupSyncSet.Settings = nil
+	g.applyGroupSettings(make(chan internal.EventLogItem, 10))
+	if len(patches) > 0 {
+		t.Errorf("settings that are already set were changed: %q", patches)
+	}
+}
+
+func TestGoogleGroups_addMember(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var member admin.Member
+		_ = json.NewDecoder(r.Body).Decode(&member)
+		switch member.Email {
+		case "existing@example.org":
+			http.Error(w, `{"error": {"code": 409, "message": "Member already exists."}}`, http.StatusConflict)
+		case "id409@example.org":
+			http.Error(w, `{"error": {"code": 400, "message": "Invalid input: id409"}}`, http.StatusBadRequest)
+		default:
+			_ = json.NewEncoder(w).Encode(member)
+		}
+	}))
+	defer server.Close()
+
+	service, err := admin.NewService(context.Background(), option.WithEndpoint(server.URL+"/"),
+		option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := GoogleGroups{AdminService: *service, GroupSyncSet: GroupSyncSet{GroupEmail: "staff@example.org"}}
+
+	tests := []struct {
+		email     string
+		wantAdded bool
+	}{
+		{email: "new@example.org", wantAdded: true},
+		{email: "existing@example.org", wantAdded: true},
+		{email: "id409@example.org", wantAdded: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			var counter uint64
+			var wg sync.WaitGroup
+			eventLog := make(chan internal.EventLogItem, 1)
+			wg.Add(1)
+			g.addMember(tt.email, RoleMember, &counter, &wg, eventLog)
+			if added := counter == 1; added != tt.wantAdded {
+				t.Errorf("addMember() added = %v, want %v, event %q", added, tt.wantAdded, (<-eventLog).Message)
+			}
+		})
+	}
+}
+
+func TestGoogleGroups_memberRoles(t *testing.T) {
+	var mutex sync.Mutex
+	var changes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(admin.Members{Members: []*admin.Member{
+				{Email: "Owner@example.org", Role: RoleOwner},
+				{Email: "member@example.org", Role: RoleMember},
+			}})
+			return
+		}
+		var member admin.Member
+		_ = json.NewDecoder(r.Body).Decode(&member)
+		mutex.Lock()
+		changes = append(changes, r.Method+" "+strings.TrimPrefix(r.URL.Path, "/admin/directory/v1/groups/")+" "+
+			member.Email+" "+member.Role)
+		mutex.Unlock()
+		_ = json.NewEncoder(w).Encode(member)
+	}))
+	defer server.Close()
+
+	service, err := admin.NewService(context.Background(), option.WithEndpoint(server.URL+"/"),
+		option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := GoogleGroups{AdminService: *service, BatchSize: 10, GroupSyncSet: GroupSyncSet{
+		GroupEmail: "staff@example.org",
+		Owners:     []string{"director@example.org"},
+	}}
+
+	listed, err := g.ListUsers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantListed := []internal.Person{
+		{CompareValue: "Owner@example.org", Attributes: map[string]string{"Email": "owner@example.org", "Role": "OWNER"}},
+		{CompareValue: "member@example.org", Attributes: map[string]string{"Email": "member@example.org", "Role": "MEMBER"}},
+	}
+	if !reflect.DeepEqual(listed, wantListed) {
+		t.Errorf("ListUsers() = %v, want %v", listed, wantListed)
+	}
+
+	changeSet := internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "manager@example.org", Attributes: map[string]string{"Role": " manager"}},
+			{CompareValue: "new@example.org", Attributes: map[string]string{}},
+			{CompareValue: "director@example.org", Attributes: map[string]string{"Role": "MEMBER"}},
+			{CompareValue: "boss@example.org", Attributes: map[string]string{"Role": "boss"}},
+		},
+		Update: []internal.Person{
+			{CompareValue: "member@example.org", Attributes: map[string]string{"Role": "owner"}},
+		},
+	}
+	eventLog := make(chan internal.EventLogItem, 10)
+	results := g.ApplyChangeSet(changeSet, eventLog)
+	close(eventLog)
+
+	sort.Strings(changes)
+	want := []string{
+		"PATCH staff@example.org/members/member@example.org  OWNER",
+		"POST staff@example.org/members director@example.org OWNER",
+		"POST staff@example.org/members manager@example.org MANAGER",
+		"POST staff@example.org/members new@example.org MEMBER",
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %q\nwant %q", changes, want)
+	}
+	if results.Created != 3 || results.Updated != 1 {
+		t.Errorf("ApplyChangeSet() = %+v, want 3 created and 1 updated", results)
+	}
+	var errors []string
+	for item := range eventLog {
+		if item.Level == syslog.LOG_ERR {
+			errors = append(errors, item.Message)
+		}
+	}
+	if len(errors) != 1 || !strings.Contains(errors[0], "boss@example.org") {
+		t.Errorf("errors = %q, want one for boss@example.org", errors)
+	}
+}
+
+func TestGoogleGroups_CreateGroups(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		requests = append(requests, r.Method+" "+strings.TrimPrefix(r.URL.Path, "/admin/directory/v1/")+" "+
+			strings.TrimSpace(string(body)))
+		mutex.Unlock()
+		if r.Method == http.MethodGet {
+			http.Error(w, `{"error": {"code": 404, "message": "Resource Not Found: groupKey"}}`, http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	service, err := admin.NewService(context.Background(), option.WithEndpoint(server.URL+"/"),
+		option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := GoogleGroups{AdminService: *service, BatchSize: 10}
+	if err := g.ForSet([]byte(`{"GroupEmail": "finance@example.org", "GroupName": "Finance",
+		"GroupDescription": "Everyone in the finance department"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := g.ListUsers(nil); err == nil {
+		t.Error("ListUsers() did not return an error for a missing group without CreateGroups")
+	}
+
+	g.CreateGroups = true
+	if err := g.PreloadSyncSets([]json.RawMessage{[]byte(`{"GroupEmail": "finance@example.org"}`)}); err != nil {
+		t.Errorf("PreloadSyncSets() error = %s, want none for a group that is to be created", err)
+	}
+	listed, err := g.ListUsers(nil)
+	if err != nil || len(listed) > 0 {
+		t.Fatalf("ListUsers() = %v, %v, want no members", listed, err)
+	}
+
+	requests = nil
+	eventLog := make(chan internal.EventLogItem, 10)
+	results := g.ApplyChangeSet(internal.ChangeSet{Create: []internal.Person{
+		{CompareValue: "ann@example.org", Attributes: map[string]string{"Email": "ann@example.org"}},
+	}}, eventLog)
+	close(eventLog)
+
+	want := []string{
+		`POST groups {"description":"Everyone in the finance department","email":"finance@example.org",` +
+			`"name":"Finance"}`,
+		`POST groups/finance@example.org/members {"email":"ann@example.org","role":"MEMBER"}`,
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %q\nwant %q", requests, want)
+	}
+	if results.Created != 1 {
+		t.Errorf("ApplyChangeSet() = %+v, want 1 created", results)
+	}
+	if msg := <-eventLog; msg.Message != "CreateGroup finance@example.org" {
+		t.Errorf("first event = %q, want CreateGroup", msg.Message)
+	}
+}
+
+func TestGoogleGroups_Bulk(t *testing.T) {
+	var mutex sync.Mutex
+	added := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var member admin.Member
+		_ = json.NewDecoder(r.Body).Decode(&member)
+		mutex.Lock()
+		added[member.Email] = true
+		mutex.Unlock()
+		_ = json.NewEncoder(w).Encode(member)
+	}))
+	defer server.Close()
+
+	service, err := admin.NewService(context.Background(), option.WithEndpoint(server.URL+"/"),
+		option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := GoogleGroups{
+		AdminService:      *service,
+		BatchSize:         1,
+		BatchDelaySeconds: 60,
+		Bulk:              BulkConfig{Threshold: 5, WindowMinutes: 2, ProgressEvery: 2},
+		GroupSyncSet:      GroupSyncSet{GroupEmail: "everyone@example.org"},
+		clock:             internal.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	g.SetStateStore(&internal.MemoryStateStore{})
+
+	var people []internal.Person
+	for i := 1; i <= 6; i++ {
+		email := fmt.Sprintf("person%v@example.org", i)
+		people = append(people, internal.Person{CompareValue: email, Attributes: map[string]string{"Email": email}})
+	}
+
+	run := func(create []internal.Person) (internal.ChangeResults, []string) {
+		eventLog := make(chan internal.EventLogItem, 20)
+		results := g.ApplyChangeSet(internal.ChangeSet{Create: create}, eventLog)
+		close(eventLog)
+		var messages []string
+		for msg := range eventLog {
+			if strings.HasPrefix(msg.Message, "BulkLoad") {
+				messages = append(messages, msg.Message)
+			}
+		}
+		return results, messages
+	}
+
+	results, messages := run(people)
+	if results.Created != 3 || len(added) != 3 {
+		// the first batch ends after a second, and the next ones after a minute
+		t.Fatalf("first run added %v members, want 3 in a 2 minute window", results.Created)
+	}
+	want := "BulkLoad everyone@example.org: 3 of 6 members added, the remaining 3 are added by the next run"
+	if len(messages) != 3 || messages[2] != want {
+		t.Errorf("first run messages = %q, want the start, one progress report, and %q", messages, want)
+	}
+
+	var remaining []internal.Person
+	for _, person := range people {
+		if !added[person.CompareValue] {
+			remaining = append(remaining, person)
+		}
+	}
+	results, messages = run(remaining)
+	want = "BulkLoad everyone@example.org: 6 of 6 members added"
+	if results.Created != 3 || messages[len(messages)-1] != want {
+		t.Errorf("second run added %v with messages %q, want 3 added below the Threshold and %q", results.Created,
+			messages, want)
+	}
+
+	results, messages = run(nil)
+	want = "BulkLoad everyone@example.org: complete, 6 members added since 2020-01-01T00:00:00Z"
+	if results.Created != 0 || len(messages) != 1 || messages[0] != want {
+		t.Errorf("last run messages = %q, want %q", messages, want)
+	}
+
+	if _, messages = run(remaining[:1]); len(messages) > 0 {
+		t.Errorf("a run below the Threshold after the bulk load was complete reported %q", messages)
+	}
+}
+
+func TestGoogleGroups_ExpandNestedGroups(t *testing.T) {
+	groups := map[string][]*admin.Member{
+		"staff@example.org": {
+			{Email: "ann@example.org", Role: RoleOwner, Type: "USER"},
+			{Email: "team@example.org", Role: RoleMember, Type: "GROUP"},
+		},
+		"team@example.org": {
+			{Email: "Bob@example.org", Role: RoleMember, Type: "USER"},
+			{Email: "sub@example.org", Role: RoleMember, Type: "GROUP"},
+			{Email: "staff@example.org", Role: RoleMember, Type: "GROUP"},
+		},
+		"sub@example.org": {
+			{Email: "carl@example.org", Role: RoleMember, Type: "USER"},
+			{Email: "ann@example.org", Role: RoleMember, Type: "USER"},
+		},
+	}
+	var mutex sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/admin/directory/v1/groups/")
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(admin.Members{Members: groups[strings.TrimSuffix(path, "/members")]})
+			return
+		}
+		var member admin.Member
+		_ = json.NewDecoder(r.Body).Decode(&member)
+		mutex.Lock()
+		requests = append(requests, r.Method+" "+path+" "+member.Email+" "+member.Role)
+		mutex.Unlock()
+		_ = json.NewEncoder(w).Encode(member)
+	}))
+	defer server.Close()
+
+	service, err := admin.NewService(context.Background(), option.WithEndpoint(server.URL+"/"),
+		option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := GoogleGroups{AdminService: *service, BatchSize: 10, ExpandNestedGroups: true,
+		GroupSyncSet: GroupSyncSet{GroupEmail: "staff@example.org"}}
+
+	listed, err := g.ListUsers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []internal.Person{
+		{CompareValue: "ann@example.org", Attributes: map[string]string{"Email": "ann@example.org", "Role": "OWNER"}},
+		{CompareValue: "bob@example.org", Attributes: map[string]string{"Email": "bob@example.org", "Role": "MEMBER"}},
+		{CompareValue: "carl@example.org", Attributes: map[string]string{"Email": "carl@example.org", "Role": "MEMBER"}},
+	}
+	if !reflect.DeepEqual(listed, want) {
+		t.Errorf("ListUsers() = %v\nwant %v", listed, want)
+	}
+
+	changeSet := internal.ChangeSet{
+		Update: []internal.Person{{CompareValue: "bob@example.org", Attributes: map[string]string{"Role": "MANAGER"}}},
+		Delete: []internal.Person{{CompareValue: "carl@example.org"}},
+	}
+	results := g.ApplyChangeSet(changeSet, make(chan internal.EventLogItem, 10))
+
+	wantRequests := []string{"POST staff@example.org/members bob@example.org MANAGER"}
+	if !reflect.DeepEqual(requests, wantRequests) || results.Created != 1 || results.Deleted != 0 {
+		t.Errorf("ApplyChangeSet() = %+v with requests %q\nwant %q", results, requests, wantRequests)
+	}
+}
+
+func TestGoogleGroups_Workers(t *testing.T) {
+	var mutex sync.Mutex
+	limited := 0
+	attempts := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var member admin.Member
+		_ = json.NewDecoder(r.Body).Decode(&member)
+		request := r.Method + " " + strings.TrimPrefix(r.URL.Path, "/admin/directory/v1/groups/") + " " + member.Email
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts[request]++
+		switch {
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": {"code": 404, "message": "Resource Not Found: memberKey"}}`))
+		case limited < 2:
+			limited++
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case limited < 3:
+			limited++
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error": {"code": 403, "message": "Quota exceeded",
+				"errors": [{"reason": "userRateLimitExceeded"}]}}`))
+		default:
+			_ = json.NewEncoder(w).Encode(member)
+		}
+	}))
+	defer server.Close()
+
+	service, err := admin.NewService(context.Background(), option.WithEndpoint(server.URL+"/"),
+		option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := internal.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	g := GoogleGroups{
+		AdminService: *service,
+		GoogleConfig: GoogleConfig{Retry: internal.RetryConfig{MaxAttempts: 5, BaseDelayMillisec: 100}},
+		BatchSize:    1,
+		Workers:      3,
+		GroupSyncSet: GroupSyncSet{GroupEmail: "everyone@example.org"},
+		clock:        clock,
+	}
+
+	var create []internal.Person
+	for i := 1; i <= 6; i++ {
+		create = append(create, internal.Person{CompareValue: fmt.Sprintf("person%v@example.org", i)})
+	}
+	eventLog := make(chan internal.EventLogItem, 20)
+	results := g.ApplyChangeSet(internal.ChangeSet{
+		Create: create,
+		Delete: []internal.Person{{CompareValue: "gone@example.org"}},
+	}, eventLog)
+	close(eventLog)
+
+	var errors []string
+	for msg := range eventLog {
+		if msg.Level == syslog.LOG_ERR {
+			errors = append(errors, msg.Message)
+		}
+	}
+	if results.Created != 6 || results.Deleted != 0 || len(errors) != 1 {
+		t.Errorf("ApplyChangeSet() = %+v with errors %q, want 6 created and an error for the missing member",
+			results, errors)
+	}
+	if got := attempts["DELETE everyone@example.org/members/gone@example.org "]; got != 1 {
+		t.Errorf("a member that was not found was deleted %v times, want 1", got)
+	}
+	total := 0
+	for _, n := range attempts {
+		total += n
+	}
+	if total != 10 {
+		t.Errorf("sent %v requests, want 10: 6 members, 3 of them retried, and 1 delete", total)
+	}
+	if clock.Slept() < 5*time.Second {
+		t.Errorf("workers slept %v, want at least the 5 seconds of Retry-After", clock.Slept())
+	}
+	if since := clock.Now().Sub(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)); since > time.Minute {
+		t.Errorf("changes took %v, want no pacing by BatchSize and BatchDelaySeconds", since)
+	}
+}
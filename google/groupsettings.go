@@ -0,0 +1,147 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"reflect"
+	"sort"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+	groupssettings "google.golang.org/api/groupssettings/v1"
+	"google.golang.org/api/option"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+// groupSettingNames are the property names of the Groups Settings API settings, such as "whoCanPostMessage"
+var groupSettingNames = func() map[string]bool {
+	names := map[string]bool{}
+	t := reflect.TypeOf(groupssettings.Groups{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Type.Kind() == reflect.String && name != "" && name != "-" && name != "email" && name != "kind" {
+			names[name] = true
+		}
+	}
+	return names
+}()
+
+// validateGroupSettings checks that each setting is a property of the Groups Settings API
+func validateGroupSettings(settings map[string]string) error {
+	for name := range settings {
+		if !groupSettingNames[name] {
+			return fmt.Errorf("%q is not a Google group setting", name)
+		}
+	}
+	return nil
+}
+
+// groupSettings returns the settings for the group of the sync set: the GroupSettings of the destination, with
+// those of the sync set in place of any with the same name
+func (g *GoogleGroups) groupSettings() map[string]string {
+	settings := map[string]string{}
+	for name, value := range g.GroupSettings {
+		settings[name] = value
+	}
+	for name, value := range g.GroupSyncSet.Settings {
+		settings[name] = value
+	}
+	return settings
+}
+
+// applyGroupSettings changes the settings of the group that differ from those configured
+func (g *GoogleGroups) applyGroupSettings(eventLog chan<- internal.EventLogItem) {
+	settings := g.groupSettings()
+	if len(settings) == 0 {
+		return
+	}
+	groupEmail := g.GroupSyncSet.GroupEmail
+
+	if err := g.initSettingsService(); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to update settings of group %s: %s", groupEmail, err)}
+		return
+	}
+
+	current, err := g.SettingsService.Groups.Get(groupEmail).Do()
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  fmt.Sprintf("unable to get settings of group %s: %s", groupEmail, err)}
+		return
+	}
+	var currentSettings map[string]string
+	j, _ := json.Marshal(current)
+	if err := json.Unmarshal(j, &currentSettings); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to read settings of group %s: %s", groupEmail, err)}
+		return
+	}
+
+	changed := map[string]string{}
+	var descriptions []string
+	for name, value := range settings {
+		if !strings.EqualFold(currentSettings[name], value) {
+			changed[name] = value
+			descriptions = append(descriptions, name+"="+value)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	sort.Strings(descriptions)
+
+	var patch groupssettings.Groups
+	j, _ = json.Marshal(changed)
+	if err := json.Unmarshal(j, &patch); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to prepare settings of group %s: %s", groupEmail, err)}
+		return
+	}
+	if _, err := g.SettingsService.Groups.Patch(groupEmail, &patch).Do(); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  fmt.Sprintf("unable to update settings of group %s: %s", groupEmail, err)}
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: fmt.Sprintf("UpdateGroupSettings %s: %s", groupEmail, strings.Join(descriptions, ", ")),
+	}
+}
+
+// initSettingsService creates the SettingsService if it has not been set
+func (g *GoogleGroups) initSettingsService() error {
+	if g.SettingsService != nil {
+		return nil
+	}
+
+	googleAuthJson, err := json.Marshal(g.GoogleConfig.GoogleAuth)
+	if err != nil {
+		return fmt.Errorf("unable to marshal google auth data into json, error: %s", err)
+	}
+
+	config, err := google.JWTConfigFromJSON(googleAuthJson, groupssettings.AppsGroupsSettingsScope)
+	if err != nil {
+		return fmt.Errorf("unable to parse client secret file to config: %s", err)
+	}
+
+	ctx := context.Background()
+	config.Subject = g.GoogleConfig.DelegatedAdminEmail
+	service, err := groupssettings.NewService(ctx, option.WithHTTPClient(config.Client(ctx)))
+	if err != nil {
+		return fmt.Errorf("unable to create Groups Settings API service: %s", err)
+	}
+	g.SettingsService = service
+	return nil
+}
@@ -0,0 +1,58 @@
+package google
+
+import (
+	"fmt"
+
+	gmail "google.golang.org/api/gmail/v1"
+)
+
+// revokeMailAccess removes the mailbox delegates of the user, turns off automatic forwarding, and deletes the
+// filters that forward mail, so that no one keeps access to the mail of a user who has left. It returns a
+// description of each access that was removed.
+func (g *GoogleUsers) revokeMailAccess(email string) ([]string, error) {
+	service, err := g.gmailService(email, gmail.GmailSettingsBasicScope, gmail.GmailSettingsSharingScope)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+
+	delegates, err := service.Users.Settings.Delegates.List("me").Do()
+	if err != nil {
+		return removed, fmt.Errorf("unable to list delegates: %s", err)
+	}
+	for _, delegate := range delegates.Delegates {
+		if err := service.Users.Settings.Delegates.Delete("me", delegate.DelegateEmail).Do(); err != nil {
+			return removed, fmt.Errorf("unable to remove delegate %s: %s", delegate.DelegateEmail, err)
+		}
+		removed = append(removed, "delegate "+delegate.DelegateEmail)
+	}
+
+	forwarding, err := service.Users.Settings.GetAutoForwarding("me").Do()
+	if err != nil {
+		return removed, fmt.Errorf("unable to get forwarding: %s", err)
+	}
+	if forwarding.Enabled {
+		disabled := &gmail.AutoForwarding{Enabled: false, ForceSendFields: []string{"Enabled"}}
+		if _, err := service.Users.Settings.UpdateAutoForwarding("me", disabled).Do(); err != nil {
+			return removed, fmt.Errorf("unable to turn off forwarding: %s", err)
+		}
+		removed = append(removed, "forwarding to "+forwarding.EmailAddress)
+	}
+
+	filters, err := service.Users.Settings.Filters.List("me").Do()
+	if err != nil {
+		return removed, fmt.Errorf("unable to list filters: %s", err)
+	}
+	for _, filter := range filters.Filter {
+		if filter.Action == nil || filter.Action.Forward == "" {
+			continue
+		}
+		if err := service.Users.Settings.Filters.Delete("me", filter.Id).Do(); err != nil {
+			return removed, fmt.Errorf("unable to delete filter %s: %s", filter.Id, err)
+		}
+		removed = append(removed, "filter forwarding to "+filter.Action.Forward)
+	}
+
+	return removed, nil
+}
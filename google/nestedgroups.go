@@ -0,0 +1,47 @@
+package google
+
+import (
+	"strings"
+
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// memberTypeGroup is the type of a member that is itself a group
+const memberTypeGroup = "GROUP"
+
+// nestedMembers lists the members of the groups among the direct members of the group, and of the groups within
+// those, and returns the lowercase email of each member that is not a group. Each nested group is listed once, even
+// if groups are nested within each other.
+func (g *GoogleGroups) nestedMembers(direct []*admin.Member) (map[string]bool, error) {
+	listed := map[string]bool{strings.ToLower(g.GroupSyncSet.GroupEmail): true}
+	members := map[string]bool{}
+
+	var groups []string
+	for _, member := range direct {
+		if member.Type == memberTypeGroup {
+			groups = append(groups, member.Email)
+		}
+	}
+
+	for len(groups) > 0 {
+		groupEmail := groups[0]
+		groups = groups[1:]
+		if listed[strings.ToLower(groupEmail)] {
+			continue
+		}
+		listed[strings.ToLower(groupEmail)] = true
+
+		nested, err := g.listMembers(groupEmail)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range nested {
+			if member.Type == memberTypeGroup {
+				groups = append(groups, member.Email)
+				continue
+			}
+			members[strings.ToLower(member.Email)] = true
+		}
+	}
+	return members, nil
+}
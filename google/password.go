@@ -0,0 +1,119 @@
+package google
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	"github.com/silinternational/personnel-sync/v5/alert"
+)
+
+// DefaultPasswordLength is the length of generated passwords if PasswordConfig Length is not set
+const DefaultPasswordLength = 16
+
+// Google requires passwords of 8 to 100 characters
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 100
+)
+
+const (
+	upperChars  = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	lowerChars  = "abcdefghijkmnopqrstuvwxyz"
+	digitChars  = "23456789"
+	symbolChars = "!#$%&*+-=?@^_~"
+)
+
+// PasswordConfig controls the random initial password of users created by GoogleUsers
+type PasswordConfig struct {
+	// Length is the number of characters, from 8 to 100. The default is 16.
+	Length int
+
+	// MinUpper, MinLower, MinDigits, and MinSymbols are the least number of characters of each kind
+	MinUpper   int
+	MinLower   int
+	MinDigits  int
+	MinSymbols int
+
+	// ChangeAtNextLogin requires the user to change the password when they first sign in, unless it is set to false
+	ChangeAtNextLogin *bool
+
+	// Recipients are sent the email address and password of each new user. If it is not set, the password is not
+	// sent anywhere, and must be reset by an administrator before the user can sign in.
+	Recipients alert.Owner
+}
+
+func (p PasswordConfig) validate() error {
+	if p.Length != 0 && (p.Length < minPasswordLength || p.Length > maxPasswordLength) {
+		return fmt.Errorf("Password Length must be from %v to %v, not %v", minPasswordLength, maxPasswordLength,
+			p.Length)
+	}
+	if p.MinUpper < 0 || p.MinLower < 0 || p.MinDigits < 0 || p.MinSymbols < 0 {
+		return fmt.Errorf("Password minimums must not be negative")
+	}
+	if minimum := p.MinUpper + p.MinLower + p.MinDigits + p.MinSymbols; minimum > p.length() {
+		return fmt.Errorf("Password minimums add up to %v, more than the Length of %v", minimum, p.length())
+	}
+	return nil
+}
+
+func (p PasswordConfig) length() int {
+	if p.Length == 0 {
+		return DefaultPasswordLength
+	}
+	return p.Length
+}
+
+func (p PasswordConfig) changeAtNextLogin() bool {
+	return p.ChangeAtNextLogin == nil || *p.ChangeAtNextLogin
+}
+
+// generate returns a random password with at least the minimum number of characters of each kind. Characters that
+// are easily confused, such as 0 and O, are not used.
+func (p PasswordConfig) generate() (string, error) {
+	var password []byte
+	for _, kind := range []struct {
+		chars   string
+		minimum int
+	}{
+		{upperChars, p.MinUpper},
+		{lowerChars, p.MinLower},
+		{digitChars, p.MinDigits},
+		{symbolChars, p.MinSymbols},
+	} {
+		for i := 0; i < kind.minimum; i++ {
+			c, err := randomChar(kind.chars)
+			if err != nil {
+				return "", err
+			}
+			password = append(password, c)
+		}
+	}
+
+	all := upperChars + lowerChars + digitChars + symbolChars
+	for len(password) < p.length() {
+		c, err := randomChar(all)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	// shuffle, so that the required characters are not always first
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", fmt.Errorf("unable to generate password: %s", err)
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+	return string(password), nil
+}
+
+func randomChar(chars string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+	if err != nil {
+		return 0, fmt.Errorf("unable to generate password: %s", err)
+	}
+	return chars[n.Int64()], nil
+}
@@ -0,0 +1,54 @@
+package google
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordConfig_generate(t *testing.T) {
+	count := func(password, chars string) int {
+		n := 0
+		for _, c := range password {
+			if strings.ContainsRune(chars, c) {
+				n++
+			}
+		}
+		return n
+	}
+
+	tests := []struct {
+		name    string
+		config  PasswordConfig
+		wantLen int
+	}{
+		{name: "default", config: PasswordConfig{}, wantLen: DefaultPasswordLength},
+		{name: "minimums", config: PasswordConfig{Length: 8, MinUpper: 2, MinLower: 2, MinDigits: 2, MinSymbols: 2},
+			wantLen: 8},
+		{name: "long", config: PasswordConfig{Length: 100, MinSymbols: 10}, wantLen: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); err != nil {
+				t.Fatal(err)
+			}
+			password, err := tt.config.generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(password) != tt.wantLen {
+				t.Errorf("generate() = %q, want %v characters", password, tt.wantLen)
+			}
+			if count(password, upperChars) < tt.config.MinUpper || count(password, lowerChars) < tt.config.MinLower ||
+				count(password, digitChars) < tt.config.MinDigits || count(password, symbolChars) < tt.config.MinSymbols {
+				t.Errorf("generate() = %q, want at least the minimum of each kind of character", password)
+			}
+		})
+	}
+
+	for _, config := range []PasswordConfig{{Length: 7}, {Length: 101}, {Length: 8, MinUpper: 5, MinDigits: 4},
+		{MinLower: -1}} {
+		if err := config.validate(); err == nil {
+			t.Errorf("validate() did not return an error for %+v", config)
+		}
+	}
+}
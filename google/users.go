@@ -5,22 +5,125 @@ import (
 	"errors"
 	"fmt"
 	"log/syslog"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/silinternational/personnel-sync/v5/alert"
 	"github.com/silinternational/personnel-sync/v5/internal"
 
 	"golang.org/x/net/context"
+	datatransfer "google.golang.org/api/admin/datatransfer/v1"
 	admin "google.golang.org/api/admin/directory/v1"
+	gmail "google.golang.org/api/gmail/v1"
 	"google.golang.org/api/googleapi"
+	licensing "google.golang.org/api/licensing/v1"
 )
 
+// addressProperties maps the supported address attributes to their Google property names
+var addressProperties = map[string]string{
+	"street":     "streetAddress",
+	"city":       "locality",
+	"region":     "region",
+	"postalCode": "postalCode",
+	"country":    "country",
+}
+
+// DefaultPersonalSchema is the custom schema used to store the preferred name and pronouns attributes
+const DefaultPersonalSchema = "Personal"
+
+// MaxNameLength is the maximum length of a user's givenName and familyName
+const MaxNameLength = 60
+
+// OnDelete values for GoogleUsers, what is done to users who are no longer in the source
+const (
+	OnDeleteNone    = "none"
+	OnDeleteSuspend = "suspend"
+	OnDeleteArchive = "archive"
+	OnDeleteMove    = "move"
+	OnDeleteDelete  = "delete"
+)
+
+// personalAttributes are stored in the PersonalSchema custom schema because they have no standard Google property
+var personalAttributes = []string{"preferredName", "pronouns"}
+
 type GoogleUsers struct {
+	DestinationConfig internal.DestinationConfig
 	BatchSize         int
 	BatchDelaySeconds int
+	PersonalSchema    string
 	GoogleConfig      GoogleConfig
 	AdminService      admin.Service
+
+	// OnDelete is what is done to users who are no longer in the source: none (the default), suspend, archive,
+	// move to the DeleteOrgUnitPath, or delete
+	OnDelete string
+
+	// DeleteOrgUnitPath is the organizational unit, such as "/Former Staff", that users are moved to on delete. It
+	// is required for move, and optional for suspend and archive.
+	DeleteOrgUnitPath string
+
+	// OrgUnitService lists the organizational units to validate orgUnitPath values. If it is nil, it is created
+	// when it is first needed, with the read-only orgunit scope.
+	OrgUnitService *admin.Service `json:"-"`
+
+	// CustomSchemaFields declares the type of custom schema fields that are not single strings, such as numbers or
+	// lists
+	CustomSchemaFields []CustomSchemaField
+
+	// SchemaService lists the custom schemas to validate the CustomSchemaFields. If it is nil, it is created when it
+	// is first needed, with the read-only userschema scope.
+	SchemaService *admin.Service `json:"-"`
+
+	// SendAsAliases also makes each alias in the aliases attribute a Gmail send-as address of the user
+	SendAsAliases bool
+
+	// RevokeMailAccess removes the mailbox delegates, automatic forwarding, and forwarding filters of each user
+	// before OnDelete is applied to them
+	RevokeMailAccess bool
+
+	// TransferToManager transfers the Drive and Calendar data of each user to their manager before the user is
+	// deleted by OnDelete. The user is suspended until the transfer is complete, and is deleted on a later run.
+	TransferToManager bool
+
+	// TransferApplications are the names of the applications whose data is transferred. The default is
+	// DefaultTransferApplications.
+	TransferApplications []string
+
+	// TransferDefaultOwner is the email address of the user who is given the data of a user without a manager. If
+	// it is not set, a user without a manager is not deleted.
+	TransferDefaultOwner string
+
+	// TransferService starts data transfers. If it is nil, it is created when it is first needed, with the
+	// datatransfer scope.
+	TransferService *datatransfer.Service `json:"-"`
+
+	// GmailService returns a Gmail API service acting as the user. If it is nil, one is created with the
+	// gmail.settings.sharing scope.
+	GmailService func(email string) (*gmail.Service, error) `json:"-"`
+
+	// CreateUsers creates users who are in the source but not in Google, with a random password as configured by
+	// Password. Users are only created if it is set.
+	CreateUsers bool
+
+	// Password configures the initial password of created users, and who it is sent to
+	Password PasswordConfig
+
+	// LicensingService assigns the Cloud Identity Free license to users created by the GoogleCloudIdentity
+	// destination. If it is nil, it is created when it is first needed, with the apps.licensing scope.
+	LicensingService *licensing.Service `json:"-"`
+
+	// cloudIdentity is set for the GoogleCloudIdentity destination, whose users are not given a Workspace license
+	cloudIdentity bool
+
+	// alertConfig is used to send the password of each created user to the Password Recipients
+	alertConfig alert.Config
+
+	// offboarded holds the lower case email of each listed user who is already as OnDelete leaves them, so that
+	// they are not changed again on every run
+	offboarded map[string]bool
 }
 
 func NewGoogleUsersDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
@@ -30,6 +133,10 @@ func NewGoogleUsersDestination(destinationConfig internal.DestinationConfig) (in
 	if err != nil {
 		return &GoogleUsers{}, err
 	}
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &googleUsers); err != nil {
+		return &GoogleUsers{}, err
+	}
+	googleUsers.DestinationConfig = destinationConfig
 
 	// Defaults
 	if googleUsers.BatchSize <= 0 {
@@ -38,6 +145,20 @@ func NewGoogleUsersDestination(destinationConfig internal.DestinationConfig) (in
 	if googleUsers.BatchDelaySeconds <= 0 {
 		googleUsers.BatchDelaySeconds = DefaultBatchDelaySeconds
 	}
+	if googleUsers.PersonalSchema == "" {
+		googleUsers.PersonalSchema = DefaultPersonalSchema
+	}
+	if err := googleUsers.validateOnDelete(); err != nil {
+		return &GoogleUsers{}, err
+	}
+	if err := googleUsers.Password.validate(); err != nil {
+		return &GoogleUsers{}, err
+	}
+	for _, field := range googleUsers.CustomSchemaFields {
+		if err := field.validate(); err != nil {
+			return &GoogleUsers{}, err
+		}
+	}
 
 	// Initialize AdminService object
 	googleUsers.AdminService, err = initGoogleAdminService(
@@ -61,10 +182,19 @@ func extractData(user admin.User) internal.Person {
 	newPerson := internal.Person{
 		CompareValue: user.PrimaryEmail,
 		Attributes: map[string]string{
-			"email": strings.ToLower(user.PrimaryEmail),
+			"email":   strings.ToLower(user.PrimaryEmail),
+			"enabled": strconv.FormatBool(!user.Suspended),
 		},
 	}
 
+	if user.OrgUnitPath != "" {
+		newPerson.Attributes["orgUnitPath"] = user.OrgUnitPath
+	}
+
+	if len(user.Aliases) > 0 {
+		newPerson.Attributes["aliases"] = strings.Join(user.Aliases, ",")
+	}
+
 	if found := findFirstMatchingType(user.ExternalIds, "organization"); found != nil {
 		setStringFromInterface(found["value"], newPerson.Attributes, "id")
 	}
@@ -83,6 +213,12 @@ func extractData(user admin.User) internal.Person {
 		setStringFromInterface(found["value"], newPerson.Attributes, "phone")
 	}
 
+	if found := findFirstMatchingType(user.Addresses, "work"); found != nil {
+		for attr, property := range addressProperties {
+			setStringFromInterface(found[property], newPerson.Attributes, attr)
+		}
+	}
+
 	if found := findFirstMatchingType(user.Relations, "manager"); found != nil {
 		setStringFromInterface(found["value"], newPerson.Attributes, "manager")
 	}
@@ -92,17 +228,30 @@ func extractData(user admin.User) internal.Person {
 		newPerson.Attributes["givenName"] = user.Name.GivenName
 	}
 
+	newPerson.CreatedAt = parseUserTime(user.CreationTime)
+	newPerson.LastLoginAt = parseUserTime(user.LastLoginTime)
+
 	for schemaKey, schemaVal := range user.CustomSchemas {
-		var schema map[string]string
+		var schema map[string]interface{}
 		_ = json.Unmarshal(schemaVal, &schema)
 		for propertyKey, propertyVal := range schema {
-			newPerson.Attributes[schemaKey+"."+propertyKey] = propertyVal
+			newPerson.Attributes[schemaKey+"."+propertyKey] = formatCustomSchemaValue(propertyVal)
 		}
 	}
 
 	return newPerson
 }
 
+// parseUserTime parses a time from the Directory API. It returns the zero time if the value is missing or is the
+// Unix epoch, which the API uses for a user who has never logged in.
+func parseUserTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil || t.Unix() <= 0 {
+		return time.Time{}
+	}
+	return t
+}
+
 // findFirstMatchingType iterates through a slice of interfaces until it finds a matching key. The underlying type
 // of the given interface must be `[]map[string]interface{}`. If `findType` is empty, the first element in the
 // slice is returned.
@@ -150,13 +299,17 @@ func (g *GoogleUsers) ListUsers(desiredAttrs []string) ([]internal.Person, error
 		return nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("unable to get users: %s", err)
+		return nil, statusError(err, fmt.Errorf("unable to get users: %s", err))
 	}
 
 	var people []internal.Person
+	g.offboarded = map[string]bool{}
 	for _, nextUser := range usersList {
 		if nextUser != nil {
-			people = append(people, extractData(*nextUser))
+			people = append(people, g.fromPersonalSchema(extractData(*nextUser)))
+			if g.isOffboarded(*nextUser) {
+				g.offboarded[strings.ToLower(nextUser.PrimaryEmail)] = true
+			}
 		}
 	}
 	return people, nil
@@ -172,22 +325,95 @@ func (g *GoogleUsers) ApplyChangeSet(
 	// One minute per batch
 	batchTimer := internal.NewBatchTimer(g.BatchSize, g.BatchDelaySeconds)
 
+	if g.CreateUsers {
+		invalid := g.validatePeople(changes.Create)
+		for _, toCreate := range changes.Create {
+			if reason, ok := invalid[toCreate.CompareValue]; ok {
+				eventLog <- internal.EventLogItem{
+					Level:    syslog.LOG_ERR,
+					Category: internal.ErrorCategoryValidation,
+					Message:  fmt.Sprintf("unable to create %s in Users: %s", toCreate.CompareValue, reason)}
+				continue
+			}
+			wg.Add(1)
+			go g.createUser(toCreate, &results.Created, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	invalid := g.validatePeople(changes.Update)
 	for _, toUpdate := range changes.Update {
+		if reason, ok := invalid[toUpdate.CompareValue]; ok {
+			eventLog <- internal.EventLogItem{
+				Level:    syslog.LOG_ERR,
+				Category: internal.ErrorCategoryValidation,
+				Message:  fmt.Sprintf("unable to update %s in Users: %s", toUpdate.CompareValue, reason)}
+			continue
+		}
 		wg.Add(1)
 		go g.updateUser(toUpdate, &results.Updated, &wg, eventLog)
 		batchTimer.WaitOnBatch()
 	}
 
+	if g.OnDelete != "" && g.OnDelete != OnDeleteNone {
+		for _, toDelete := range changes.Delete {
+			if g.offboarded[strings.ToLower(toDelete.CompareValue)] {
+				continue
+			}
+			wg.Add(1)
+			go g.deleteUser(toDelete, &results.Deleted, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
 	wg.Wait()
 
 	return results
 }
 
+// ValidateChangeSet looks up each user to be updated, without changing it, to check that the user exists, that
+// the update can be prepared, and that its orgUnitPath and custom schema fields are valid. The orgUnitPath and custom
+// schema fields of users to be created are checked as well.
+func (g *GoogleUsers) ValidateChangeSet(changes internal.ChangeSet) map[string]string {
+	failures := g.validatePeople(changes.Update)
+	if g.CreateUsers {
+		for email, reason := range g.validatePeople(changes.Create) {
+			failures[email] = reason
+		}
+	}
+
+	for _, person := range changes.Update {
+		if _, ok := failures[person.CompareValue]; ok {
+			continue
+		}
+		oldUser, err := g.getUser(person.CompareValue)
+		if err != nil {
+			failures[person.CompareValue] = fmt.Sprintf("unable to get user: %s", err)
+			continue
+		}
+		if _, err := g.newUser(person, oldUser); err != nil {
+			failures[person.CompareValue] = err.Error()
+		}
+	}
+
+	return failures
+}
+
+// LintRules checks the names against the limits of the Directory API, which rejects longer names
+func (g *GoogleUsers) LintRules() []internal.LintRule {
+	return []internal.LintRule{
+		{Attribute: "givenName", MaxLength: MaxNameLength},
+		{Attribute: "familyName", MaxLength: MaxNameLength},
+	}
+}
+
 func newUserForUpdate(person internal.Person, oldUser admin.User) (admin.User, error) {
 	user := admin.User{}
 	var err error
 	var organization admin.UserOrganization
 	isOrgModified := false
+	address := map[string]string{}
+	customSchemas := map[string]map[string]string{}
 
 	for key, val := range person.Attributes {
 		switch key {
@@ -205,6 +431,15 @@ func newUserForUpdate(person internal.Person, oldUser admin.User) (admin.User, e
 				user.Name.FamilyName = val
 			}
 
+		case "enabled":
+			enabled, err := strconv.ParseBool(val)
+			if err != nil {
+				return admin.User{}, fmt.Errorf("invalid enabled value %q", val)
+			}
+			// Suspended must be sent even when false, to reactivate a suspended user
+			user.Suspended = !enabled
+			user.ForceSendFields = append(user.ForceSendFields, "Suspended")
+
 		case "id":
 			user.ExternalIds, err = updateIDs(val, oldUser.ExternalIds)
 			if err != nil {
@@ -241,21 +476,35 @@ func newUserForUpdate(person internal.Person, oldUser admin.User) (admin.User, e
 				return admin.User{}, err
 			}
 
+		case "street", "city", "region", "postalCode", "country":
+			address[addressProperties[key]] = val
+
+		case "orgUnitPath":
+			user.OrgUnitPath = val
+
 		default:
 			keys := strings.SplitN(key, ".", 2)
 			if len(keys) < 2 {
 				continue
 			}
 
-			j, err := json.Marshal(&map[string]string{keys[1]: val})
-			if err != nil {
-				return admin.User{}, fmt.Errorf("error marshaling custom schema, %s", err)
+			if customSchemas[keys[0]] == nil {
+				customSchemas[keys[0]] = map[string]string{}
 			}
+			customSchemas[keys[0]][keys[1]] = val
+		}
+	}
 
-			user.CustomSchemas = map[string]googleapi.RawMessage{
-				keys[0]: j,
-			}
+	for schemaName, properties := range customSchemas {
+		j, err := json.Marshal(properties)
+		if err != nil {
+			return admin.User{}, fmt.Errorf("error marshaling custom schema, %s", err)
+		}
+
+		if user.CustomSchemas == nil {
+			user.CustomSchemas = map[string]googleapi.RawMessage{}
 		}
+		user.CustomSchemas[schemaName] = j
 	}
 
 	if isOrgModified {
@@ -263,6 +512,104 @@ func newUserForUpdate(person internal.Person, oldUser admin.User) (admin.User, e
 		user.Organizations = []admin.UserOrganization{organization}
 	}
 
+	if len(address) > 0 {
+		user.Addresses, err = updateAddresses(address, oldUser.Addresses)
+		if err != nil {
+			return admin.User{}, err
+		}
+	}
+
+	return user, nil
+}
+
+// SetAlertConfig sets the configuration used to send the passwords of created users
+func (g *GoogleUsers) SetAlertConfig(config alert.Config) {
+	g.alertConfig = config
+}
+
+// createUser creates the user with a random password, which is sent to the Password Recipients
+func (g *GoogleUsers) createUser(
+	person internal.Person,
+	counter *uint64,
+	wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	email := person.CompareValue
+
+	newUser, err := g.newUser(person, admin.User{})
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ErrorCategoryValidation,
+			Message:  fmt.Sprintf("unable to prepare %s for Users: %s", email, err)}
+		return
+	}
+
+	password, err := g.Password.generate()
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to create %s in Users: %s", email, err)}
+		return
+	}
+	newUser.PrimaryEmail = email
+	newUser.Password = password
+	newUser.ChangePasswordAtNextLogin = g.Password.changeAtNextLogin()
+
+	if _, err := g.AdminService.Users.Insert(&newUser).Do(); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  fmt.Sprintf("unable to create %s in Users: %s", email, err)}
+		return
+	}
+
+	if g.cloudIdentity {
+		if err := g.assignCloudIdentityLicense(email); err != nil {
+			eventLog <- internal.EventLogItem{
+				Level:    syslog.LOG_ERR,
+				Category: internal.ClassifyError(err),
+				Message:  fmt.Sprintf("unable to license %s in Users: %s", email, err)}
+		}
+	}
+
+	if g.Password.Recipients.IsSet() {
+		alert.SendPrivateAlert(g.alertConfig, g.Password.Recipients, alert.TemplateCredentials, alert.CredentialsData{
+			Email:             email,
+			Password:          password,
+			ChangeAtNextLogin: newUser.ChangePasswordAtNextLogin,
+		})
+	}
+
+	if aliases, ok := person.Attributes["aliases"]; ok {
+		if err := g.updateAliases(email, aliases, nil); err != nil {
+			eventLog <- internal.EventLogItem{
+				Level:    syslog.LOG_ERR,
+				Category: internal.ClassifyError(err),
+				Message:  fmt.Sprintf("unable to add aliases of %s in Users: %s", email, err)}
+		}
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: "CreateUser " + email,
+	}
+
+	atomic.AddUint64(counter, 1)
+}
+
+// newUser returns the user properties to create or update the person with, with the declared custom schema fields
+// converted to their types
+func (g *GoogleUsers) newUser(person internal.Person, oldUser admin.User) (admin.User, error) {
+	user, err := newUserForUpdate(g.toPersonalSchema(person), oldUser)
+	if err != nil {
+		return admin.User{}, err
+	}
+	if err := g.typeCustomSchemas(&user); err != nil {
+		return admin.User{}, err
+	}
 	return user, nil
 }
 
@@ -276,7 +623,13 @@ func (g *GoogleUsers) updateUser(
 
 	email := person.Attributes["email"]
 
-	oldUser, err := g.getUser(person.CompareValue)
+	// a person linked by ID whose email changed is found by their old email, and renamed
+	lookupKey, updateKey := person.CompareValue, email
+	if person.PreviousCompareValue != "" {
+		lookupKey, updateKey = person.PreviousCompareValue, person.PreviousCompareValue
+	}
+
+	oldUser, err := g.getUser(lookupKey)
 	if err != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ERR,
@@ -284,7 +637,7 @@ func (g *GoogleUsers) updateUser(
 		return
 	}
 
-	newUser, err2 := newUserForUpdate(person, oldUser)
+	newUser, err2 := g.newUser(person, oldUser)
 	if err2 != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ERR,
@@ -292,7 +645,11 @@ func (g *GoogleUsers) updateUser(
 		return
 	}
 
-	_, err3 := g.AdminService.Users.Update(email, &newUser).Do()
+	if person.PreviousCompareValue != "" {
+		newUser.PrimaryEmail = email
+	}
+
+	_, err3 := g.AdminService.Users.Update(updateKey, &newUser).Do()
 	if err3 != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ERR,
@@ -300,14 +657,262 @@ func (g *GoogleUsers) updateUser(
 		return
 	}
 
+	if aliases, ok := person.Attributes["aliases"]; ok {
+		if err := g.updateAliases(email, aliases, oldUser.Aliases); err != nil {
+			eventLog <- internal.EventLogItem{
+				Level:    syslog.LOG_ERR,
+				Category: internal.ClassifyError(err),
+				Message:  fmt.Sprintf("unable to update aliases of %s in Users: %s", email, err)}
+			return
+		}
+	}
+
+	eventLog <- internal.UpdateEvent("UpdateUser", email, person)
+
+	atomic.AddUint64(counter, 1)
+}
+
+func (g *GoogleUsers) validateOnDelete() error {
+	switch g.OnDelete {
+	case "", OnDeleteNone, OnDeleteSuspend, OnDeleteArchive, OnDeleteDelete:
+	case OnDeleteMove:
+		if g.DeleteOrgUnitPath == "" {
+			return errors.New("OnDelete move requires a DeleteOrgUnitPath")
+		}
+	default:
+		return fmt.Errorf("invalid OnDelete %q, must be none, suspend, archive, move, or delete", g.OnDelete)
+	}
+	if g.DeleteOrgUnitPath != "" && !strings.HasPrefix(g.DeleteOrgUnitPath, "/") {
+		return fmt.Errorf("DeleteOrgUnitPath %q must start with /", g.DeleteOrgUnitPath)
+	}
+	if g.RevokeMailAccess && (g.OnDelete == "" || g.OnDelete == OnDeleteNone) {
+		return errors.New("RevokeMailAccess requires an OnDelete")
+	}
+	if g.TransferToManager && g.OnDelete != OnDeleteDelete {
+		return errors.New("TransferToManager requires an OnDelete of delete")
+	}
+	return nil
+}
+
+// isOffboarded returns true if the user is already as OnDelete would leave them. A deleted user is never listed.
+func (g *GoogleUsers) isOffboarded(user admin.User) bool {
+	if g.DeleteOrgUnitPath != "" && !strings.EqualFold(user.OrgUnitPath, g.DeleteOrgUnitPath) {
+		return false
+	}
+	switch g.OnDelete {
+	case OnDeleteSuspend:
+		return user.Suspended
+	case OnDeleteArchive:
+		return user.Archived
+	case OnDeleteMove:
+		return true
+	}
+	return false
+}
+
+// userForDelete returns the changes to a user that OnDelete makes, for all but delete
+func (g *GoogleUsers) userForDelete() admin.User {
+	user := admin.User{OrgUnitPath: g.DeleteOrgUnitPath}
+	switch g.OnDelete {
+	case OnDeleteSuspend:
+		user.Suspended = true
+	case OnDeleteArchive:
+		user.Archived = true
+	}
+	return user
+}
+
+func (g *GoogleUsers) deleteUser(
+	person internal.Person,
+	counter *uint64,
+	wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	email := person.CompareValue
+
+	if g.RevokeMailAccess {
+		removed, err := g.revokeMailAccess(email)
+		if len(removed) > 0 {
+			eventLog <- internal.EventLogItem{
+				Level:   syslog.LOG_INFO,
+				Message: fmt.Sprintf("RevokeMailAccess %s: %s", email, strings.Join(removed, ", ")),
+			}
+		}
+		if err != nil {
+			// the user is still offboarded, since leaving them active would be worse
+			eventLog <- internal.EventLogItem{
+				Level:    syslog.LOG_ERR,
+				Category: internal.ClassifyError(err),
+				Message:  fmt.Sprintf("unable to revoke mail access of %s: %s", email, err)}
+		}
+	}
+
+	if g.OnDelete == OnDeleteDelete && g.TransferToManager && !g.waitForTransfer(email, eventLog) {
+		return
+	}
+
+	var err error
+	if g.OnDelete == OnDeleteDelete {
+		err = g.AdminService.Users.Delete(email).Do()
+	} else {
+		user := g.userForDelete()
+		_, err = g.AdminService.Users.Update(email, &user).Do()
+	}
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  fmt.Sprintf("unable to %s %s in Users: %s", g.OnDelete, email, err.Error())}
+		return
+	}
+
+	action := map[string]string{
+		OnDeleteSuspend: "SuspendUser ",
+		OnDeleteArchive: "ArchiveUser ",
+		OnDeleteMove:    "MoveUser ",
+		OnDeleteDelete:  "DeleteUser ",
+	}[g.OnDelete]
+	message := action + email
+	if g.DeleteOrgUnitPath != "" && g.OnDelete != OnDeleteDelete {
+		message += " to " + g.DeleteOrgUnitPath
+	}
 	eventLog <- internal.EventLogItem{
 		Level:   syslog.LOG_INFO,
-		Message: "UpdateUser " + email,
+		Message: message,
 	}
 
 	atomic.AddUint64(counter, 1)
 }
 
+// waitForTransfer returns true once the data of the user has been transferred, so that they can be deleted. Until
+// then, the user is suspended, and a transfer is started if there is none.
+func (g *GoogleUsers) waitForTransfer(email string, eventLog chan<- internal.EventLogItem) bool {
+	state, newOwner, err := g.transferData(email)
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  fmt.Sprintf("unable to delete %s in Users, data transfer failed: %s", email, err)}
+		return false
+	}
+	if state == transferCompleted {
+		return true
+	}
+
+	if state == transferStarted {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_INFO,
+			Message: fmt.Sprintf("TransferData %s to %s", email, newOwner),
+		}
+	}
+	suspended := admin.User{Suspended: true}
+	if _, err := g.AdminService.Users.Update(email, &suspended).Do(); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  fmt.Sprintf("unable to suspend %s in Users during data transfer: %s", email, err)}
+	}
+	return false
+}
+
+// validatePeople returns the reason, by compare value, that each person has an invalid orgUnitPath or custom schema
+// field
+func (g *GoogleUsers) validatePeople(people []internal.Person) map[string]string {
+	failures := g.validateOrgUnits(people)
+	for compareValue, reason := range g.validateCustomSchemas(people) {
+		if _, ok := failures[compareValue]; !ok {
+			failures[compareValue] = reason
+		}
+	}
+	return failures
+}
+
+// validateOrgUnits checks that the orgUnitPath of each person exists, and returns the reason it is invalid by compare
+// value. The organizational units are only listed if there are orgUnitPath values to check. An empty orgUnitPath is
+// left for the API to reject.
+func (g *GoogleUsers) validateOrgUnits(people []internal.Person) map[string]string {
+	failures := map[string]string{}
+
+	var toCheck []internal.Person
+	for _, person := range people {
+		if person.Attributes["orgUnitPath"] != "" {
+			toCheck = append(toCheck, person)
+		}
+	}
+	if len(toCheck) == 0 {
+		return failures
+	}
+
+	paths, err := g.listOrgUnitPaths()
+	for _, person := range toCheck {
+		path := person.Attributes["orgUnitPath"]
+		switch {
+		case err != nil:
+			failures[person.CompareValue] = fmt.Sprintf("unable to validate orgUnitPath %q: %s", path, err)
+		case !strings.HasPrefix(path, "/"):
+			failures[person.CompareValue] = fmt.Sprintf("orgUnitPath %q must start with /", path)
+		case !paths[strings.ToLower(path)]:
+			failures[person.CompareValue] = fmt.Sprintf("orgUnitPath %q does not exist", path)
+		}
+	}
+	return failures
+}
+
+// listOrgUnitPaths returns the lower case path of every organizational unit, including the root "/"
+func (g *GoogleUsers) listOrgUnitPaths() (map[string]bool, error) {
+	if g.OrgUnitService == nil {
+		service, err := initGoogleAdminService(g.GoogleConfig.GoogleAuth, g.GoogleConfig.DelegatedAdminEmail,
+			admin.AdminDirectoryOrgunitReadonlyScope)
+		if err != nil {
+			return nil, err
+		}
+		g.OrgUnitService = &service
+	}
+
+	orgUnits, err := g.OrgUnitService.Orgunits.List("my_customer").Type("all").Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list organizational units: %s", err)
+	}
+
+	paths := map[string]bool{"/": true}
+	for _, orgUnit := range orgUnits.OrganizationUnits {
+		paths[strings.ToLower(orgUnit.OrgUnitPath)] = true
+	}
+	return paths, nil
+}
+
+// fromPersonalSchema renames the personal attributes read from the PersonalSchema custom schema to their
+// plain attribute names
+func (g *GoogleUsers) fromPersonalSchema(person internal.Person) internal.Person {
+	for _, attr := range personalAttributes {
+		schemaKey := g.PersonalSchema + "." + attr
+		if val, ok := person.Attributes[schemaKey]; ok {
+			person.Attributes[attr] = val
+			delete(person.Attributes, schemaKey)
+		}
+	}
+	return person
+}
+
+// toPersonalSchema returns a copy of the person with the personal attributes renamed to their PersonalSchema
+// custom schema keys
+func (g *GoogleUsers) toPersonalSchema(person internal.Person) internal.Person {
+	attrs := map[string]string{}
+	for key, val := range person.Attributes {
+		attrs[key] = val
+	}
+	for _, attr := range personalAttributes {
+		if val, ok := attrs[attr]; ok {
+			attrs[g.PersonalSchema+"."+attr] = val
+			delete(attrs, attr)
+		}
+	}
+	person.Attributes = attrs
+	return person
+}
+
 func (g *GoogleUsers) getUser(email string) (admin.User, error) {
 	userCall := g.AdminService.Users.Get(email)
 	user, err := userCall.Do()
@@ -488,3 +1093,60 @@ func updateRelations(newRelation string, oldRelations interface{}) ([]admin.User
 
 	return relations, nil
 }
+
+// updateAddresses replaces the properties given in newAddress on the "work" address, keeping any other properties
+// of the existing work address as well as all addresses of other types
+func updateAddresses(newAddress map[string]string, oldAddresses interface{}) ([]admin.UserAddress, error) {
+	var addresses []admin.UserAddress
+	workAddress := map[string]interface{}{}
+
+	if oldAddresses != nil {
+		interfaces, ok := oldAddresses.([]interface{})
+		if !ok {
+			return nil, errors.New("no slice in Google API Addresses")
+		}
+
+		for i := range interfaces {
+			addressMap, ok := interfaces[i].(map[string]interface{})
+			if !ok {
+				return nil, errors.New("unexpected data in Google API address list")
+			}
+
+			thisType, ok := addressMap["type"].(string)
+			if !ok {
+				return nil, errors.New("unexpected data in Google API address list entry")
+			}
+
+			if thisType == "work" {
+				workAddress = addressMap
+				continue
+			}
+
+			addresses = append(addresses, newUserAddress(addressMap))
+		}
+	}
+
+	for property, value := range newAddress {
+		workAddress[property] = value
+	}
+	workAddress["type"] = "work"
+
+	return append([]admin.UserAddress{newUserAddress(workAddress)}, addresses...), nil
+}
+
+func newUserAddress(m map[string]interface{}) admin.UserAddress {
+	var a admin.UserAddress
+	a.Type, _ = m["type"].(string)
+	a.CustomType, _ = m["customType"].(string)
+	a.StreetAddress, _ = m["streetAddress"].(string)
+	a.Locality, _ = m["locality"].(string)
+	a.Region, _ = m["region"].(string)
+	a.PostalCode, _ = m["postalCode"].(string)
+	a.Country, _ = m["country"].(string)
+	a.CountryCode, _ = m["countryCode"].(string)
+	a.ExtendedAddress, _ = m["extendedAddress"].(string)
+	a.PoBox, _ = m["poBox"].(string)
+	a.Formatted, _ = m["formatted"].(string)
+	a.Primary, _ = m["primary"].(bool)
+	return a
+}
@@ -1,16 +1,30 @@
 package google
 
 import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log/syslog"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"google.golang.org/api/googleapi"
 
+	"github.com/silinternational/personnel-sync/v5/alert"
 	"github.com/silinternational/personnel-sync/v5/internal"
 
+	datatransfer "google.golang.org/api/admin/datatransfer/v1"
 	admin "google.golang.org/api/admin/directory/v1"
+	gmail "google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
 )
 
 func TestGoogleUsers_ListUsers(t *testing.T) {
@@ -169,7 +183,7 @@ func TestGoogleUsers_extractData(t *testing.T) {
 			},
 			want: internal.Person{
 				CompareValue: "email@example.com",
-				Attributes:   map[string]string{"email": "email@example.com"},
+				Attributes:   map[string]string{"email": "email@example.com", "enabled": "true"},
 			},
 		},
 		{
@@ -198,6 +212,7 @@ func TestGoogleUsers_extractData(t *testing.T) {
 					"value": "555-1212",
 				}},
 				PrimaryEmail: "email@example.com",
+				OrgUnitPath:  "/Staff/IT",
 				Relations: []interface{}{map[string]interface{}{
 					"type":  "manager",
 					"value": "manager@example.com",
@@ -205,11 +220,20 @@ func TestGoogleUsers_extractData(t *testing.T) {
 				CustomSchemas: map[string]googleapi.RawMessage{
 					"Location": []byte(`{"Building":"A building"}`),
 				},
+				Addresses: []interface{}{map[string]interface{}{
+					"type":          "work",
+					"streetAddress": "1 Main St",
+					"locality":      "Springfield",
+					"region":        "IL",
+					"postalCode":    "62701",
+					"country":       "USA",
+				}},
 			},
 			want: internal.Person{
 				CompareValue: "email@example.com",
 				Attributes: map[string]string{
 					"email":             "email@example.com",
+					"enabled":           "true",
 					"familyName":        "Jones",
 					"givenName":         "John",
 					"id":                "12345",
@@ -220,6 +244,12 @@ func TestGoogleUsers_extractData(t *testing.T) {
 					"phone":             "555-1212",
 					"manager":           "manager@example.com",
 					"Location.Building": "A building",
+					"street":            "1 Main St",
+					"city":              "Springfield",
+					"region":            "IL",
+					"postalCode":        "62701",
+					"country":           "USA",
+					"orgUnitPath":       "/Staff/IT",
 				},
 			},
 		},
@@ -241,8 +271,9 @@ func TestGoogleUsers_extractData(t *testing.T) {
 			want: internal.Person{
 				CompareValue: "email@example.com",
 				Attributes: map[string]string{
-					"email": "email@example.com",
-					"id":    "12345",
+					"email":   "email@example.com",
+					"enabled": "true",
+					"id":      "12345",
 				},
 			},
 		},
@@ -264,8 +295,9 @@ func TestGoogleUsers_extractData(t *testing.T) {
 			want: internal.Person{
 				CompareValue: "email@example.com",
 				Attributes: map[string]string{
-					"email": "email@example.com",
-					"phone": "888-5555",
+					"email":   "email@example.com",
+					"enabled": "true",
+					"phone":   "888-5555",
 				},
 			},
 		},
@@ -287,8 +319,9 @@ func TestGoogleUsers_extractData(t *testing.T) {
 			want: internal.Person{
 				CompareValue: "email@example.com",
 				Attributes: map[string]string{
-					"email": "email@example.com",
-					"area":  "An area",
+					"email":   "email@example.com",
+					"enabled": "true",
+					"area":    "An area",
 				},
 			},
 		},
@@ -321,10 +354,35 @@ func TestGoogleUsers_extractData(t *testing.T) {
 			want: internal.Person{
 				CompareValue: "email@example.com",
 				Attributes: map[string]string{
-					"email": "email@example.com",
+					"email":   "email@example.com",
+					"enabled": "true",
 				},
 			},
 		},
+		{
+			name: "account times, never logged in",
+			user: admin.User{
+				PrimaryEmail:  "email@example.com",
+				CreationTime:  "2019-05-01T10:00:00.000Z",
+				LastLoginTime: "1970-01-01T00:00:00.000Z",
+			},
+			want: internal.Person{
+				CompareValue: "email@example.com",
+				Attributes:   map[string]string{"email": "email@example.com", "enabled": "true"},
+				CreatedAt:    time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "suspended",
+			user: admin.User{
+				PrimaryEmail: "email@example.com",
+				Suspended:    true,
+			},
+			want: internal.Person{
+				CompareValue: "email@example.com",
+				Attributes:   map[string]string{"email": "email@example.com", "enabled": "false"},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -390,6 +448,28 @@ func Test_newUserForUpdate(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "reactivate",
+			person: internal.Person{
+				CompareValue: "email@example.com",
+				Attributes:   map[string]string{"enabled": "true"},
+			},
+			want: admin.User{
+				Suspended:       false,
+				ForceSendFields: []string{"Suspended"},
+			},
+		},
+		{
+			name: "suspend",
+			person: internal.Person{
+				CompareValue: "email@example.com",
+				Attributes:   map[string]string{"enabled": "false"},
+			},
+			want: admin.User{
+				Suspended:       true,
+				ForceSendFields: []string{"Suspended"},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -753,3 +833,603 @@ func Test_updateRelations(t *testing.T) {
 		})
 	}
 }
+
+func Test_updateAddresses(t *testing.T) {
+	tests := []struct {
+		name         string
+		newAddress   map[string]string
+		oldAddresses interface{}
+		want         []admin.UserAddress
+		wantErr      bool
+	}{
+		{
+			name:       "no old addresses",
+			newAddress: map[string]string{"locality": "Springfield"},
+			want:       []admin.UserAddress{{Type: "work", Locality: "Springfield"}},
+		},
+		{
+			name:       "merge with existing work address and keep home address",
+			newAddress: map[string]string{"locality": "Shelbyville", "postalCode": "62565"},
+			oldAddresses: []interface{}{
+				map[string]interface{}{
+					"type":          "home",
+					"streetAddress": "742 Evergreen Terrace",
+				},
+				map[string]interface{}{
+					"type":          "work",
+					"streetAddress": "1 Main St",
+					"locality":      "Springfield",
+					"country":       "USA",
+				},
+			},
+			want: []admin.UserAddress{
+				{
+					Type:          "work",
+					StreetAddress: "1 Main St",
+					Locality:      "Shelbyville",
+					PostalCode:    "62565",
+					Country:       "USA",
+				},
+				{
+					Type:          "home",
+					StreetAddress: "742 Evergreen Terrace",
+				},
+			},
+		},
+		{
+			name:         "invalid data",
+			newAddress:   map[string]string{"locality": "Springfield"},
+			oldAddresses: []interface{}{"not a map"},
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := updateAddresses(tt.newAddress, tt.oldAddresses)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("updateAddresses() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("updateAddresses() = %#v\nwant: %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoogleUsers_personalSchema(t *testing.T) {
+	g := GoogleUsers{PersonalSchema: "Personal"}
+
+	person := internal.Person{
+		CompareValue: "email@example.com",
+		Attributes: map[string]string{
+			"email":         "email@example.com",
+			"preferredName": "Sam",
+			"pronouns":      "they/them",
+			"Location.Desk": "12",
+		},
+	}
+
+	gotUser, err := newUserForUpdate(g.toPersonalSchema(person), admin.User{})
+	if err != nil {
+		t.Fatalf("newUserForUpdate() error: %s", err)
+	}
+	wantSchemas := map[string]googleapi.RawMessage{
+		"Personal": []byte(`{"preferredName":"Sam","pronouns":"they/them"}`),
+		"Location": []byte(`{"Desk":"12"}`),
+	}
+	if !reflect.DeepEqual(gotUser.CustomSchemas, wantSchemas) {
+		t.Errorf("CustomSchemas = %s\nwant: %s", gotUser.CustomSchemas, wantSchemas)
+	}
+	if _, ok := person.Attributes["Personal.pronouns"]; ok {
+		t.Error("toPersonalSchema() modified the original attributes")
+	}
+
+	got := g.fromPersonalSchema(extractData(admin.User{
+		PrimaryEmail:  "email@example.com",
+		CustomSchemas: gotUser.CustomSchemas,
+	}))
+	want := internal.Person{
+		CompareValue: "email@example.com",
+		Attributes: map[string]string{
+			"email":         "email@example.com",
+			"enabled":       "true",
+			"preferredName": "Sam",
+			"pronouns":      "they/them",
+			"Location.Desk": "12",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fromPersonalSchema() = %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestGoogleUsers_OnDelete(t *testing.T) {
+	listed := []*admin.User{
+		{PrimaryEmail: "active@example.org"},
+		{PrimaryEmail: "suspended@example.org", Suspended: true},
+		{PrimaryEmail: "moved@example.org", Suspended: true, OrgUnitPath: "/Former Staff"},
+	}
+	toDelete := []internal.Person{
+		{CompareValue: "active@example.org"},
+		{CompareValue: "suspended@example.org"},
+		{CompareValue: "moved@example.org"},
+	}
+
+	tests := []struct {
+		name              string
+		onDelete          string
+		deleteOrgUnitPath string
+		want              []string
+	}{
+		{name: "none", onDelete: "", want: nil},
+		{name: "suspend", onDelete: OnDeleteSuspend, want: []string{
+			`PUT active@example.org {"suspended":true}`,
+		}},
+		{name: "suspend and move", onDelete: OnDeleteSuspend, deleteOrgUnitPath: "/former staff", want: []string{
+			`PUT active@example.org {"orgUnitPath":"/former staff","suspended":true}`,
+			`PUT suspended@example.org {"orgUnitPath":"/former staff","suspended":true}`,
+		}},
+		{name: "archive", onDelete: OnDeleteArchive, want: []string{
+			`PUT active@example.org {"archived":true}`,
+			`PUT moved@example.org {"archived":true}`,
+			`PUT suspended@example.org {"archived":true}`,
+		}},
+		{name: "move", onDelete: OnDeleteMove, deleteOrgUnitPath: "/Former Staff", want: []string{
+			`PUT active@example.org {"orgUnitPath":"/Former Staff"}`,
+			`PUT suspended@example.org {"orgUnitPath":"/Former Staff"}`,
+		}},
+		{name: "delete", onDelete: OnDeleteDelete, want: []string{
+			`DELETE active@example.org `,
+			`DELETE moved@example.org `,
+			`DELETE suspended@example.org `,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			var requests []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					_ = json.NewEncoder(w).Encode(admin.Users{Users: listed})
+					return
+				}
+				body, _ := ioutil.ReadAll(r.Body)
+				mutex.Lock()
+				requests = append(requests, r.Method+" "+strings.TrimPrefix(r.URL.Path, "/admin/directory/v1/users/")+
+					" "+strings.TrimSpace(string(body)))
+				mutex.Unlock()
+				_, _ = w.Write([]byte("{}"))
+			}))
+			defer server.Close()
+
+			service, err := admin.NewService(context.Background(), option.WithEndpoint(server.URL+"/"),
+				option.WithHTTPClient(server.Client()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := GoogleUsers{AdminService: *service, BatchSize: 10, BatchDelaySeconds: 1, OnDelete: tt.onDelete,
+				DeleteOrgUnitPath: tt.deleteOrgUnitPath}
+			if err := g.validateOnDelete(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := g.ListUsers(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			eventLog := make(chan internal.EventLogItem, 50)
+			results := g.ApplyChangeSet(internal.ChangeSet{Delete: toDelete}, eventLog)
+			close(eventLog)
+
+			sort.Strings(requests)
+			if !reflect.DeepEqual(requests, tt.want) {
+				t.Errorf("requests = %q, want %q", requests, tt.want)
+			}
+			if results.Deleted != uint64(len(tt.want)) {
+				t.Errorf("Deleted = %v, want %v", results.Deleted, len(tt.want))
+			}
+		})
+	}
+
+	for _, g := range []GoogleUsers{{OnDelete: "remove"}, {OnDelete: OnDeleteMove}, {DeleteOrgUnitPath: "Former"}} {
+		if err := g.validateOnDelete(); err == nil {
+			t.Errorf("validateOnDelete() did not return an error for %+v", g)
+		}
+	}
+}
+
+func TestGoogleUsers_updateRenamed(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/admin/directory/v1/users/")
+		if r.Method == http.MethodGet {
+			if path != "old.name@example.org" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(admin.User{PrimaryEmail: "old.name@example.org"})
+			return
+		}
+		var user admin.User
+		_ = json.NewDecoder(r.Body).Decode(&user)
+		mutex.Lock()
+		requests = append(requests, r.Method+" "+path+" "+user.PrimaryEmail)
+		mutex.Unlock()
+		_ = json.NewEncoder(w).Encode(user)
+	}))
+	defer server.Close()
+
+	service, err := admin.NewService(context.Background(), option.WithEndpoint(server.URL+"/"),
+		option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := GoogleUsers{AdminService: *service, BatchSize: 10, BatchDelaySeconds: 1}
+
+	// the update of a person matched by an ID link after their email changed
+	update := internal.Person{
+		CompareValue:         "new.name@example.org",
+		PreviousCompareValue: "old.name@example.org",
+		Attributes:           map[string]string{"email": "new.name@example.org", "givenName": "New"},
+	}
+	eventLog := make(chan internal.EventLogItem, 10)
+	results := g.ApplyChangeSet(internal.ChangeSet{Update: []internal.Person{update}}, eventLog)
+	close(eventLog)
+	for item := range eventLog {
+		if item.Level <= syslog.LOG_ERR {
+			t.Errorf("ApplyChangeSet() logged an error: %s", item.Message)
+		}
+	}
+
+	want := []string{"PUT old.name@example.org new.name@example.org"}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %q, want %q", requests, want)
+	}
+	if results.Updated != 1 {
+		t.Errorf("Updated = %v, want 1", results.Updated)
+	}
+}
+
+func TestGoogleUsers_validateOrgUnits(t *testing.T) {
+	listed := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		listed++
+		_ = json.NewEncoder(w).Encode(admin.OrgUnits{OrganizationUnits: []*admin.OrgUnit{
+			{OrgUnitPath: "/Staff"},
+			{OrgUnitPath: "/Staff/IT"},
+		}})
+	}))
+	defer server.Close()
+
+	service, err := admin.NewService(context.Background(), option.WithEndpoint(server.URL+"/"),
+		option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := GoogleUsers{OrgUnitService: service}
+
+	person := func(email, orgUnitPath string) internal.Person {
+		return internal.Person{CompareValue: email, Attributes: map[string]string{"orgUnitPath": orgUnitPath}}
+	}
+	if failures := g.validateOrgUnits([]internal.Person{{CompareValue: "a@example.org"}}); len(failures) > 0 ||
+		listed > 0 {
+		t.Errorf("validateOrgUnits() = %v and listed the organizational units without an orgUnitPath", failures)
+	}
+
+	failures := g.validateOrgUnits([]internal.Person{
+		person("root@example.org", "/"),
+		person("it@example.org", "/staff/it"),
+		person("missing@example.org", "/Students"),
+		person("relative@example.org", "Staff"),
+	})
+	want := map[string]string{
+		"missing@example.org":  `orgUnitPath "/Students" does not exist`,
+		"relative@example.org": `orgUnitPath "Staff" must start with /`,
+	}
+	if !reflect.DeepEqual(failures, want) {
+		t.Errorf("validateOrgUnits() = %v, want %v", failures, want)
+	}
+
+	user, err := newUserForUpdate(person("it@example.org", "/Staff/IT"), admin.User{})
+	if err != nil || user.OrgUnitPath != "/Staff/IT" {
+		t.Errorf("newUserForUpdate() = %+v, %v, want OrgUnitPath /Staff/IT", user, err)
+	}
+}
+
+func TestGoogleUsers_updateAliases(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+strings.TrimSpace(string(body)))
+		mutex.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/sendAs/gone@example.org") {
+			http.Error(w, `{"error": {"code": 404, "message": "Not Found"}}`, http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	options := []option.ClientOption{option.WithEndpoint(server.URL + "/"), option.WithHTTPClient(server.Client())}
+	service, err := admin.NewService(context.Background(), options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gmailUsers []string
+	g := GoogleUsers{AdminService: *service, SendAsAliases: true,
+		GmailService: func(email string) (*gmail.Service, error) {
+			gmailUsers = append(gmailUsers, email)
+			return gmail.NewService(context.Background(), options...)
+		}}
+
+	err = g.updateAliases("user@example.org", " New@example.org,kept@example.org, ",
+		[]string{"KEPT@example.org", "gone@example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`POST /admin/directory/v1/users/user@example.org/aliases {"alias":"New@example.org"}`,
+		`POST /gmail/v1/users/me/settings/sendAs {"sendAsEmail":"New@example.org","treatAsAlias":true}`,
+		`DELETE /gmail/v1/users/me/settings/sendAs/gone@example.org `,
+		`DELETE /admin/directory/v1/users/user@example.org/aliases/gone@example.org `,
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %q\nwant %q", requests, want)
+	}
+	if !reflect.DeepEqual(gmailUsers, []string{"user@example.org", "user@example.org"}) {
+		t.Errorf("Gmail service acted as %v, want the user", gmailUsers)
+	}
+
+	person := extractData(admin.User{PrimaryEmail: "user@example.org", Aliases: []string{"a@example.org",
+		"b@example.org"}})
+	if person.Attributes["aliases"] != "a@example.org,b@example.org" {
+		t.Errorf("extractData() aliases = %q", person.Attributes["aliases"])
+	}
+}
+
+func TestGoogleUsers_CreateUsers(t *testing.T) {
+	var mutex sync.Mutex
+	var created []admin.User
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var user admin.User
+		_ = json.NewDecoder(r.Body).Decode(&user)
+		mutex.Lock()
+		created = append(created, user)
+		mutex.Unlock()
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	var messages []string
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message struct{ Text string }
+		_ = json.NewDecoder(r.Body).Decode(&message)
+		mutex.Lock()
+		messages = append(messages, message.Text)
+		mutex.Unlock()
+	}))
+	defer slack.Close()
+
+	service, err := admin.NewService(context.Background(), option.WithEndpoint(server.URL+"/"),
+		option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := false
+	g := GoogleUsers{AdminService: *service, BatchSize: 10, BatchDelaySeconds: 1,
+		Password: PasswordConfig{Length: 12, MinDigits: 2, ChangeAtNextLogin: &change,
+			Recipients: alert.Owner{Name: "help desk", SlackWebhookURL: slack.URL}}}
+	changes := internal.ChangeSet{Create: []internal.Person{{
+		CompareValue: "new@example.org",
+		Attributes:   map[string]string{"email": "new@example.org", "givenName": "New", "familyName": "Person"},
+	}}}
+
+	eventLog := make(chan internal.EventLogItem, 50)
+	if results := g.ApplyChangeSet(changes, eventLog); results.Created != 0 || len(created) != 0 {
+		t.Fatalf("ApplyChangeSet() created %v users without CreateUsers", results.Created)
+	}
+
+	g.CreateUsers = true
+	results := g.ApplyChangeSet(changes, eventLog)
+	close(eventLog)
+	if results.Created != 1 || len(created) != 1 {
+		t.Fatalf("ApplyChangeSet() created %v users, want 1", results.Created)
+	}
+
+	user := created[0]
+	if user.PrimaryEmail != "new@example.org" || user.Name == nil || user.Name.GivenName != "New" {
+		t.Errorf("created user = %+v", user)
+	}
+	if len(user.Password) != 12 || user.ChangePasswordAtNextLogin {
+		t.Errorf("created user password = %q, change at next login %v", user.Password, user.ChangePasswordAtNextLogin)
+	}
+	if len(messages) != 1 || !strings.Contains(messages[0], user.Password) {
+		t.Errorf("Slack messages = %q, want the password", messages)
+	}
+	for msg := range eventLog {
+		if strings.Contains(msg.Message, user.Password) {
+			t.Errorf("password logged in %q", msg.Message)
+		}
+	}
+}
+
+func TestGoogleUsers_RevokeMailAccess(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+strings.TrimSpace(string(body)))
+		mutex.Unlock()
+		if r.Method != http.MethodGet {
+			_, _ = w.Write([]byte("{}"))
+			return
+		}
+		switch r.URL.Path {
+		case "/gmail/v1/users/me/settings/delegates":
+			_, _ = w.Write([]byte(`{"delegates": [{"delegateEmail": "assistant@example.org"}]}`))
+		case "/gmail/v1/users/me/settings/autoForwarding":
+			_, _ = w.Write([]byte(`{"enabled": true, "emailAddress": "personal@example.com"}`))
+		case "/gmail/v1/users/me/settings/filters":
+			_, _ = w.Write([]byte(`{"filter": [{"id": "f1", "action": {"addLabelIds": ["STARRED"]}},
+				{"id": "f2", "action": {"forward": "other@example.com"}}]}`))
+		default:
+			_, _ = w.Write([]byte("{}"))
+		}
+	}))
+	defer server.Close()
+
+	options := []option.ClientOption{option.WithEndpoint(server.URL + "/"), option.WithHTTPClient(server.Client())}
+	service, err := admin.NewService(context.Background(), options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := GoogleUsers{AdminService: *service, BatchSize: 10, BatchDelaySeconds: 1, OnDelete: OnDeleteSuspend,
+		RevokeMailAccess: true,
+		GmailService: func(email string) (*gmail.Service, error) {
+			return gmail.NewService(context.Background(), options...)
+		}}
+	if err := g.validateOnDelete(); err != nil {
+		t.Fatal(err)
+	}
+
+	eventLog := make(chan internal.EventLogItem, 50)
+	results := g.ApplyChangeSet(internal.ChangeSet{Delete: []internal.Person{{CompareValue: "gone@example.org"}}},
+		eventLog)
+	close(eventLog)
+	if results.Deleted != 1 {
+		t.Errorf("Deleted = %v, want 1", results.Deleted)
+	}
+
+	want := []string{
+		`GET /gmail/v1/users/me/settings/delegates `,
+		`DELETE /gmail/v1/users/me/settings/delegates/assistant@example.org `,
+		`GET /gmail/v1/users/me/settings/autoForwarding `,
+		`PUT /gmail/v1/users/me/settings/autoForwarding {"enabled":false}`,
+		`GET /gmail/v1/users/me/settings/filters `,
+		`DELETE /gmail/v1/users/me/settings/filters/f2 `,
+		`PUT /admin/directory/v1/users/gone@example.org {"suspended":true}`,
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %q\nwant %q", requests, want)
+	}
+
+	var messages []string
+	for msg := range eventLog {
+		messages = append(messages, msg.Message)
+	}
+	wantMessage := "RevokeMailAccess gone@example.org: delegate assistant@example.org, forwarding to " +
+		"personal@example.com, filter forwarding to other@example.com"
+	if len(messages) == 0 || messages[0] != wantMessage {
+		t.Errorf("event log = %q, want %q first", messages, wantMessage)
+	}
+
+	if err := (&GoogleUsers{RevokeMailAccess: true}).validateOnDelete(); err == nil {
+		t.Error("validateOnDelete() did not return an error for RevokeMailAccess without OnDelete")
+	}
+}
+
+func TestGoogleUsers_TransferToManager(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      string
+		manager     string
+		wantDeleted uint64
+		want        []string
+	}{
+		{name: "start", manager: "boss@example.org", want: []string{
+			`POST /admin/datatransfer/v1/transfers {"applicationDataTransfers":[{"applicationId":"55656082996",` +
+				`"applicationTransferParams":[{"key":"PRIVACY_LEVEL","value":["PRIVATE","SHARED"]}]},` +
+				`{"applicationId":"435070579839","applicationTransferParams":[{"key":"RELEASE_RESOURCES",` +
+				`"value":["TRUE"]}]}],"newOwnerUserId":"boss-id","oldOwnerUserId":"gone-id"}`,
+			`PUT /admin/directory/v1/users/gone@example.org {"suspended":true}`,
+		}},
+		{name: "default owner", want: []string{
+			`POST /admin/datatransfer/v1/transfers {"applicationDataTransfers":[{"applicationId":"55656082996",` +
+				`"applicationTransferParams":[{"key":"PRIVACY_LEVEL","value":["PRIVATE","SHARED"]}]},` +
+				`{"applicationId":"435070579839","applicationTransferParams":[{"key":"RELEASE_RESOURCES",` +
+				`"value":["TRUE"]}]}],"newOwnerUserId":"it-id","oldOwnerUserId":"gone-id"}`,
+			`PUT /admin/directory/v1/users/gone@example.org {"suspended":true}`,
+		}},
+		{name: "in progress", status: "inProgress", manager: "boss@example.org", want: []string{
+			`PUT /admin/directory/v1/users/gone@example.org {"suspended":true}`,
+		}},
+		{name: "completed", status: "completed", manager: "boss@example.org", wantDeleted: 1, want: []string{
+			`DELETE /admin/directory/v1/users/gone@example.org `,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				if r.Method != http.MethodGet {
+					requests = append(requests, r.Method+" "+r.URL.Path+" "+strings.TrimSpace(string(body)))
+				}
+				switch r.Method + " " + r.URL.Path {
+				case "GET /admin/directory/v1/users/gone@example.org":
+					user := admin.User{Id: "gone-id", PrimaryEmail: "gone@example.org", CustomerId: "C01"}
+					if tt.manager != "" {
+						user.Relations = []interface{}{map[string]interface{}{"type": "manager", "value": tt.manager}}
+					}
+					_ = json.NewEncoder(w).Encode(user)
+				case "GET /admin/directory/v1/users/boss@example.org":
+					_, _ = w.Write([]byte(`{"id": "boss-id", "primaryEmail": "boss@example.org"}`))
+				case "GET /admin/directory/v1/users/it@example.org":
+					_, _ = w.Write([]byte(`{"id": "it-id", "primaryEmail": "it@example.org"}`))
+				case "GET /admin/datatransfer/v1/transfers":
+					if tt.status == "" {
+						_, _ = w.Write([]byte(`{}`))
+						return
+					}
+					_, _ = w.Write([]byte(`{"dataTransfers": [{"requestTime": "2020-01-01T00:00:00Z", ` +
+						`"overallTransferStatusCode": "failed"}, {"requestTime": "2020-01-02T00:00:00Z", ` +
+						`"overallTransferStatusCode": "` + tt.status + `"}]}`))
+				case "GET /admin/datatransfer/v1/applications":
+					_, _ = w.Write([]byte(`{"applications": [{"id": "55656082996", "name": "Drive and Docs"}, ` +
+						`{"id": "435070579839", "name": "Calendar"}, {"id": "1", "name": "Google Sites"}]}`))
+				default:
+					_, _ = w.Write([]byte("{}"))
+				}
+			}))
+			defer server.Close()
+
+			options := []option.ClientOption{option.WithEndpoint(server.URL + "/"),
+				option.WithHTTPClient(server.Client())}
+			service, err := admin.NewService(context.Background(), options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			transferService, err := datatransfer.NewService(context.Background(), options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := GoogleUsers{AdminService: *service, TransferService: transferService, BatchSize: 10,
+				BatchDelaySeconds: 1, OnDelete: OnDeleteDelete, TransferToManager: true,
+				TransferDefaultOwner: "it@example.org"}
+			if err := g.validateOnDelete(); err != nil {
+				t.Fatal(err)
+			}
+
+			eventLog := make(chan internal.EventLogItem, 50)
+			results := g.ApplyChangeSet(internal.ChangeSet{Delete: []internal.Person{{CompareValue: "gone@example.org"}}},
+				eventLog)
+			close(eventLog)
+
+			if !reflect.DeepEqual(requests, tt.want) {
+				t.Errorf("requests = %q\nwant %q", requests, tt.want)
+			}
+			if results.Deleted != tt.wantDeleted {
+				t.Errorf("Deleted = %v, want %v", results.Deleted, tt.wantDeleted)
+			}
+		})
+	}
+
+	if err := (&GoogleUsers{OnDelete: OnDeleteSuspend, TransferToManager: true}).validateOnDelete(); err == nil {
+		t.Error("validateOnDelete() did not return an error for TransferToManager without delete")
+	}
+}
@@ -0,0 +1,130 @@
+package google
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+// rateLimitReasons are the reasons given with a 403 status when Google limits the rate of requests
+var rateLimitReasons = map[string]bool{
+	"rateLimitExceeded":     true,
+	"userRateLimitExceeded": true,
+	"quotaExceeded":         true,
+}
+
+// memberWorkers makes membership changes with a fixed number of workers, each making one change at a time
+type memberWorkers struct {
+	changes chan func()
+	done    sync.WaitGroup
+}
+
+// startMemberWorkers starts the workers. Each change given to do is made by the first worker that is free.
+func startMemberWorkers(workers int) *memberWorkers {
+	w := &memberWorkers{changes: make(chan func())}
+	for i := 0; i < workers; i++ {
+		w.done.Add(1)
+		go func() {
+			defer w.done.Done()
+			for change := range w.changes {
+				change()
+			}
+		}()
+	}
+	return w
+}
+
+// do waits for a worker to be free, and gives it the change
+func (w *memberWorkers) do(change func()) {
+	w.changes <- change
+}
+
+// stop waits for the workers to finish the changes they have been given
+func (w *memberWorkers) stop() {
+	close(w.changes)
+	w.done.Wait()
+}
+
+// sharedBackoff retries the requests of several workers. When a request is rate limited, or fails with a
+// retryable status, none of the workers sends another request until the backoff delay has passed.
+type sharedBackoff struct {
+	retry internal.RetryConfig
+	clock internal.Clock
+
+	mutex    sync.Mutex
+	resumeAt time.Time
+}
+
+// newSharedBackoff returns a sharedBackoff that waits with the Clock of the Retry config, or with clock if it has none
+func newSharedBackoff(retry internal.RetryConfig, clock internal.Clock) *sharedBackoff {
+	if retry.Clock != nil {
+		clock = retry.Clock
+	}
+	return &sharedBackoff{retry: retry, clock: clock}
+}
+
+// call sends a request, and sends it again after the backoff delay if it fails with a retryable error, up to the
+// MaxAttempts of the Retry config in total. It returns the error of the last attempt.
+func (b *sharedBackoff) call(request func() error) error {
+	maxAttempts := b.retry.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = internal.DefaultRetryMaxAttempts
+	}
+
+	for attempt := 0; ; attempt++ {
+		b.wait()
+		err := request()
+		retryAfter, retryable := b.retryable(err)
+		if !retryable || attempt+1 >= maxAttempts {
+			return err
+		}
+		delay := b.retry.Delay(attempt, retryAfter)
+		if b.retry.ExceedsMaxDelay(delay) {
+			return err
+		}
+		b.pause(delay)
+	}
+}
+
+// retryable returns whether the error is retryable, and the Retry-After header of its response
+func (b *sharedBackoff) retryable(err error) (string, bool) {
+	apiErr, ok := err.(*googleapi.Error)
+	if !ok {
+		return "", false
+	}
+	retryAfter := apiErr.Header.Get("Retry-After")
+	if b.retry.IsRetryable(apiErr.Code) {
+		return retryAfter, true
+	}
+	if apiErr.Code == http.StatusForbidden {
+		for _, item := range apiErr.Errors {
+			if rateLimitReasons[item.Reason] {
+				return retryAfter, true
+			}
+		}
+	}
+	return "", false
+}
+
+// wait waits until the backoff delay, if any, has passed
+func (b *sharedBackoff) wait() {
+	b.mutex.Lock()
+	delay := b.resumeAt.Sub(b.clock.Now())
+	b.mutex.Unlock()
+	if delay > 0 {
+		b.clock.Sleep(delay)
+	}
+}
+
+// pause stops all requests until the delay has passed, unless they are already stopped for longer
+func (b *sharedBackoff) pause(delay time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if resumeAt := b.clock.Now().Add(delay); resumeAt.After(b.resumeAt) {
+		b.resumeAt = resumeAt
+	}
+}
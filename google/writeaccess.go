@@ -0,0 +1,63 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// canAuthorize reports whether the service account is allowed the scopes on behalf of the adminEmail, by requesting
+// a token for them. A token is refused with unauthorized_client if domain-wide delegation does not grant all of the
+// scopes.
+func canAuthorize(auth GoogleAuth, adminEmail string, scopes ...string) (bool, error) {
+	googleAuthJson, err := json.Marshal(auth)
+	if err != nil {
+		return false, fmt.Errorf("unable to marshal google auth data into json, error: %s", err)
+	}
+
+	config, err := google.JWTConfigFromJSON(googleAuthJson, scopes...)
+	if err != nil {
+		return false, fmt.Errorf("unable to parse client secret file to config: %s", err)
+	}
+
+	config.Subject = adminEmail
+	if _, err := config.TokenSource(context.Background()).Token(); err != nil {
+		if strings.Contains(err.Error(), "unauthorized_client") {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to get a token: %s", err)
+	}
+	return true, nil
+}
+
+// CheckWriteAccess reports whether the service account can change groups and their members. If it cannot, the
+// AdminService is created again with read-only scopes, so that the members can still be listed.
+func (g *GoogleGroups) CheckWriteAccess() (bool, error) {
+	writable, err := canAuthorize(g.GoogleConfig.GoogleAuth, g.GoogleConfig.DelegatedAdminEmail,
+		admin.AdminDirectoryGroupScope, admin.AdminDirectoryGroupMemberScope)
+	if err != nil || writable {
+		return writable, err
+	}
+
+	g.AdminService, err = initGoogleAdminService(g.GoogleConfig.GoogleAuth, g.GoogleConfig.DelegatedAdminEmail,
+		admin.AdminDirectoryGroupReadonlyScope, admin.AdminDirectoryGroupMemberReadonlyScope)
+	return false, err
+}
+
+// CheckWriteAccess reports whether the service account can change users. If it cannot, the AdminService is created
+// again with the read-only scope, so that the users can still be listed.
+func (g *GoogleUsers) CheckWriteAccess() (bool, error) {
+	writable, err := canAuthorize(g.GoogleConfig.GoogleAuth, g.GoogleConfig.DelegatedAdminEmail,
+		admin.AdminDirectoryUserScope)
+	if err != nil || writable {
+		return writable, err
+	}
+
+	g.AdminService, err = initGoogleAdminService(g.GoogleConfig.GoogleAuth, g.GoogleConfig.DelegatedAdminEmail,
+		admin.AdminDirectoryUserReadonlyScope)
+	return false, err
+}
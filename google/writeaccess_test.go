@@ -0,0 +1,75 @@
+package google
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+func TestGoogleGroups_CheckWriteAccess(t *testing.T) {
+	var grantedScopes map[string]bool
+	var requestedScopes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		var claims struct{ Scope string }
+		if len(parts) == 3 {
+			payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			_ = json.Unmarshal(payload, &claims)
+		}
+		requestedScopes = append(requestedScopes, claims.Scope)
+
+		for _, scope := range strings.Fields(claims.Scope) {
+			if !grantedScopes[scope] {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"error": "unauthorized_client", "error_description": "Client is ` +
+					`unauthorized to retrieve access tokens using this method"}`))
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token": "token", "token_type": "Bearer", "expires_in": 3600}`))
+	}))
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	g := GoogleGroups{GoogleConfig: GoogleConfig{
+		DelegatedAdminEmail: "admin@example.org",
+		GoogleAuth: GoogleAuth{Type: "service_account", PrivateKey: string(privateKey),
+			ClientEmail: "sync@example.iam.gserviceaccount.com", TokenURI: server.URL},
+	}}
+
+	grantedScopes = map[string]bool{admin.AdminDirectoryGroupScope: true, admin.AdminDirectoryGroupMemberScope: true}
+	if writable, err := g.CheckWriteAccess(); !writable || err != nil {
+		t.Errorf("CheckWriteAccess() = %t, %v, want true", writable, err)
+	}
+
+	grantedScopes = map[string]bool{admin.AdminDirectoryGroupReadonlyScope: true,
+		admin.AdminDirectoryGroupMemberReadonlyScope: true}
+	if writable, err := g.CheckWriteAccess(); writable || err != nil {
+		t.Errorf("CheckWriteAccess() = %t, %v, want false", writable, err)
+	}
+
+	server.Close()
+	if _, err := g.CheckWriteAccess(); err == nil {
+		t.Error("CheckWriteAccess() did not return an error when no token could be requested")
+	}
+
+	if len(requestedScopes) != 2 {
+		t.Errorf("tokens were requested for %q, want once for each check", requestedScopes)
+	}
+}
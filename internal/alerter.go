@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"log"
+	"log/syslog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v5/alert"
+)
+
+const (
+	alertStateKey = "alerts"
+
+	// maxDigestMessages limits the size of the digest kept in the state store
+	maxDigestMessages = 1000
+)
+
+// alertState is the alert policy state kept between runs
+type alertState struct {
+	// Failures is the number of consecutive failed runs of each sync set
+	Failures map[string]int
+
+	// Digest holds the messages waiting for the next digest
+	Digest []string
+
+	// Dropped is the number of messages not kept because the digest was full
+	Dropped int
+
+	LastDigest time.Time
+}
+
+// Alerter sends alerts according to the alert Policy. Without a state store, every alert is sent immediately.
+// Alerts about a sync set with an Owner are also sent to the owner, but never added to the digest.
+type Alerter struct {
+	config alert.Config
+	store  StateStore
+	clock  Clock
+	state  alertState
+	failed []string
+	mutex  sync.Mutex
+
+	// owners are the owners of the sync sets by the name they run under, and ownerFailed the failures to send them
+	owners      map[string]alert.Owner
+	ownerFailed map[string][]string
+}
+
+// NewAlerter returns an Alerter for the config, loading the policy state from the store if one is given
+func NewAlerter(config AppConfig, store StateStore) *Alerter {
+	a := &Alerter{
+		config:      config.Alert,
+		clock:       config.Runtime.GetClock(),
+		state:       alertState{Failures: map[string]int{}},
+		owners:      map[string]alert.Owner{},
+		ownerFailed: map[string][]string{},
+	}
+
+	for _, syncSet := range config.SyncSets {
+		if !syncSet.Owner.IsSet() {
+			continue
+		}
+		for _, run := range config.SyncSetDestinations(syncSet) {
+			a.owners[run.SyncSet.Name] = syncSet.Owner
+		}
+		a.owners[syncSet.Name] = syncSet.Owner
+	}
+
+	if store != nil && (config.Alert.Policy.ConsecutiveFailures > 1 || config.Alert.Policy.DigestHours > 0) {
+		a.store = store
+		if _, err := store.Load(alertStateKey, &a.state); err != nil {
+			log.Printf("unable to load alert state: %s", err)
+		}
+		if a.state.Failures == nil {
+			a.state.Failures = map[string]int{}
+		}
+		if a.state.LastDigest.IsZero() {
+			a.state.LastDigest = a.clock.Now()
+		}
+	}
+
+	return a
+}
+
+func (a *Alerter) digestMode() bool {
+	return a.store != nil && a.config.Policy.DigestHours > 0
+}
+
+// SyncSetFailed records a failed run of a sync set. The message is alerted by Finish once the sync set has failed
+// the configured number of consecutive runs.
+func (a *Alerter) SyncSetFailed(syncSetName, msg string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.state.Failures[syncSetName]++
+	if a.store == nil || a.state.Failures[syncSetName] >= a.config.Policy.ConsecutiveFailures {
+		a.failed = append(a.failed, msg)
+		if _, ok := a.owners[syncSetName]; ok {
+			a.ownerFailed[syncSetName] = append(a.ownerFailed[syncSetName], msg)
+		}
+	}
+}
+
+// SyncSetSucceeded resets the consecutive failure count of a sync set
+func (a *Alerter) SyncSetSucceeded(syncSetName string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.state.Failures, syncSetName)
+}
+
+// Event alerts an event with level LOG_ALERT or LOG_EMERG. In digest mode, the event is added to the digest
+// instead, along with all other events with level LOG_WARNING or more severe.
+func (a *Alerter) Event(msg EventLogItem) {
+	isAlert := msg.Level == syslog.LOG_ALERT || msg.Level == syslog.LOG_EMERG
+	if !a.digestMode() {
+		if isAlert {
+			alert.SendAlert(a.config, alert.TemplateEvent, eventData(msg))
+		}
+		return
+	}
+
+	if msg.Level <= syslog.LOG_WARNING {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		a.addToDigest(a.config.Render(alert.TemplateEvent, eventData(msg)))
+	}
+}
+
+// SyncSetEvent alerts an event like Event, and also sends an event with level LOG_ALERT or LOG_EMERG to the owner
+// of the sync set
+func (a *Alerter) SyncSetEvent(syncSetName string, msg EventLogItem) {
+	a.Event(msg)
+
+	owner, ok := a.owners[syncSetName]
+	if ok && (msg.Level == syslog.LOG_ALERT || msg.Level == syslog.LOG_EMERG) {
+		alert.SendOwnerAlert(a.config, owner, alert.TemplateEvent, eventData(msg))
+	}
+}
+
+// Finish sends an alert, rendered with the named template, for the sync sets that failed often enough, or adds it
+// to the digest. In digest mode, the digest is sent if it is due. The owners of the failed sync sets are each sent
+// an alert for their own sync sets. The alert policy state is then saved.
+func (a *Alerter) Finish(templateName string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var names []string
+	for name := range a.ownerFailed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		alert.SendOwnerAlert(a.config, a.owners[name], templateName, alert.ErrorsData{Errors: a.ownerFailed[name]})
+	}
+	a.ownerFailed = map[string][]string{}
+
+	if len(a.failed) > 0 {
+		data := alert.ErrorsData{Errors: a.failed}
+		if a.digestMode() {
+			a.addToDigest(a.config.Render(templateName, data))
+		} else {
+			alert.SendAlert(a.config, templateName, data)
+		}
+		a.failed = nil
+	}
+
+	if a.store == nil {
+		return
+	}
+
+	now := a.clock.Now()
+	due := a.state.LastDigest.Add(time.Duration(a.config.Policy.DigestHours) * time.Hour)
+	if a.digestMode() && !now.Before(due) {
+		if len(a.state.Digest) > 0 {
+			alert.SendAlert(a.config, alert.TemplateDigest, alert.DigestData{
+				Since:    a.state.LastDigest,
+				Messages: a.state.Digest,
+				Dropped:  a.state.Dropped,
+			})
+		}
+		a.state.Digest = nil
+		a.state.Dropped = 0
+		a.state.LastDigest = now
+	}
+
+	if err := a.store.Save(alertStateKey, a.state); err != nil {
+		log.Printf("unable to save alert state: %s", err)
+	}
+}
+
+func (a *Alerter) addToDigest(msg string) {
+	if len(a.state.Digest) >= maxDigestMessages {
+		a.state.Dropped++
+		return
+	}
+	a.state.Digest = append(a.state.Digest, msg)
+}
+
+func eventData(msg EventLogItem) alert.EventData {
+	return alert.EventData{
+		Level:       LogLevels[msg.Level],
+		Category:    string(msg.Category),
+		Message:     msg.Message,
+		SyncSet:     msg.SyncSet,
+		Destination: msg.Destination,
+		Operation:   msg.Operation,
+		Person:      msg.PersonCompareValue,
+		Error:       msg.Error,
+	}
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"encoding/json"
+	"log/syslog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v5/alert"
+)
+
+func TestAlerter_ConsecutiveFailures(t *testing.T) {
+	store := &MemoryStateStore{}
+	config := AppConfig{Alert: alert.Config{Policy: alert.Policy{ConsecutiveFailures: 2}}}
+
+	a := NewAlerter(config, store)
+	a.SyncSetFailed("set1", "set1 failed")
+	if len(a.failed) != 0 {
+		t.Errorf("first failure should not be alerted, got %v", a.failed)
+	}
+	a.Finish(alert.TemplateSyncErrors)
+
+	a = NewAlerter(config, store)
+	a.SyncSetFailed("set1", "set1 failed again")
+	a.SyncSetFailed("set2", "set2 failed")
+	if want := []string{"set1 failed again"}; !reflect.DeepEqual(a.failed, want) {
+		t.Errorf("failed = %v, want %v", a.failed, want)
+	}
+	a.Finish(alert.TemplateSyncErrors)
+
+	a = NewAlerter(config, store)
+	a.SyncSetSucceeded("set1")
+	a.Finish(alert.TemplateSyncErrors)
+
+	a = NewAlerter(config, store)
+	if want := map[string]int{"set2": 1}; !reflect.DeepEqual(a.state.Failures, want) {
+		t.Errorf("Failures = %v, want %v", a.state.Failures, want)
+	}
+}
+
+func TestAlerter_Digest(t *testing.T) {
+	store := &MemoryStateStore{}
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	config := AppConfig{
+		Runtime: RuntimeConfig{Clock: clock},
+		Alert:   alert.Config{Policy: alert.Policy{DigestHours: 24}},
+	}
+
+	a := NewAlerter(config, store)
+	a.Event(EventLogItem{Level: syslog.LOG_INFO, Message: "not included"})
+	a.Event(EventLogItem{Level: syslog.LOG_WARNING, Message: "slow response"})
+	a.Event(EventLogItem{Level: syslog.LOG_ALERT, Message: "something is wrong"})
+	a.SyncSetFailed("set1", "set1 failed")
+	a.Finish(alert.TemplateSyncErrors)
+
+	clock.Advance(12 * time.Hour)
+	a = NewAlerter(config, store)
+	want := []string{"Warning: slow response", "Alert: something is wrong", "Sync error(s):\nset1 failed"}
+	if !reflect.DeepEqual(a.state.Digest, want) {
+		t.Errorf("Digest = %q, want %q", a.state.Digest, want)
+	}
+	a.Finish(alert.TemplateSyncErrors)
+
+	clock.Advance(12 * time.Hour)
+	a = NewAlerter(config, store)
+	a.Finish(alert.TemplateSyncErrors)
+
+	a = NewAlerter(config, store)
+	if len(a.state.Digest) != 0 || !a.state.LastDigest.Equal(clock.Now()) {
+		t.Errorf("digest should have been sent and cleared, got %v, last sent %s", a.state.Digest, a.state.LastDigest)
+	}
+}
+
+func TestAlerter_Owner(t *testing.T) {
+	var messages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var message struct{ Text string }
+		_ = json.NewDecoder(req.Body).Decode(&message)
+		messages = append(messages, message.Text)
+	}))
+	defer server.Close()
+
+	config := AppConfig{
+		Destinations: []DestinationConfig{{Name: "ldap", Type: "RestAPI"}},
+		SyncSets: []SyncSet{
+			{Name: "staff", Destinations: map[string]json.RawMessage{"ldap": json.RawMessage(`{}`)},
+				Owner: alert.Owner{Name: "HR Systems", SlackWebhookURL: server.URL}},
+			{Name: "students", Destinations: map[string]json.RawMessage{"ldap": json.RawMessage(`{}`)}},
+		},
+	}
+
+	a := NewAlerter(config, nil)
+	a.SyncSetEvent("staff/ldap", EventLogItem{Level: syslog.LOG_WARNING, Message: "not sent to the owner"})
+	a.SyncSetEvent("staff/ldap", EventLogItem{Level: syslog.LOG_ALERT, Message: "staff conflict"})
+	a.SyncSetEvent("students/ldap", EventLogItem{Level: syslog.LOG_ALERT, Message: "students conflict"})
+	a.SyncSetFailed("staff/ldap", "staff failed")
+	a.SyncSetFailed("students/ldap", "students failed")
+	a.Finish(alert.TemplateSyncErrors)
+
+	if len(messages) != 2 {
+		t.Fatalf("owner was sent %v messages, want 2: %q", len(messages), messages)
+	}
+	if !strings.Contains(messages[0], "staff conflict") {
+		t.Errorf("first message = %q, want the staff event", messages[0])
+	}
+	if !strings.Contains(messages[1], "staff failed") || strings.Contains(messages[1], "students") {
+		t.Errorf("second message = %q, want only the staff failure", messages[1])
+	}
+}
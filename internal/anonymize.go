@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	AnonymizeEmail      = "email"
+	AnonymizeGivenName  = "givenName"
+	AnonymizeFamilyName = "familyName"
+	AnonymizeName       = "name"
+	AnonymizePhone      = "phone"
+	AnonymizeHash       = "hash"
+	AnonymizeRedact     = "redact"
+
+	DefaultAnonymizeEmailDomain = "example.org"
+)
+
+// AnonymizeConfig pseudonymizes personal data as it is read from the source, so that a production config can be
+// run against a test destination without exposing real people. Each value is replaced by a pseudonym derived from
+// it and the Key, so a person gets the same pseudonym on every run and changes are still detected.
+type AnonymizeConfig struct {
+	// Attributes maps source attribute names to the way they are anonymized: email, givenName, familyName, name,
+	// phone, hash, or redact
+	Attributes map[string]string
+
+	// Key is a secret that is mixed into every pseudonym, so that they cannot be reversed by trying likely values
+	Key string
+
+	// EmailDomain is the domain of anonymized email addresses, DefaultAnonymizeEmailDomain if not set
+	EmailDomain string
+}
+
+var (
+	anonymousGivenNames = []string{"Alex", "Avery", "Blake", "Casey", "Charlie", "Dana", "Drew", "Emerson", "Finley",
+		"Harper", "Jamie", "Jordan", "Kai", "Logan", "Morgan", "Parker", "Quinn", "Reese", "Riley", "Rowan", "Sage",
+		"Sawyer", "Skyler", "Taylor"}
+	anonymousFamilyNames = []string{"Archer", "Baker", "Brooks", "Carter", "Cooper", "Ellis", "Fisher", "Foster",
+		"Gray", "Hayes", "Hunter", "Lane", "Mason", "Miller", "Palmer", "Porter", "Reed", "Shaw", "Stone", "Turner",
+		"Walker", "Wells", "West", "Young"}
+)
+
+// validate checks that the Key is set and that each attribute has a known anonymization
+func (a AnonymizeConfig) validate() error {
+	if len(a.Attributes) == 0 {
+		return nil
+	}
+	if a.Key == "" {
+		return errors.New("a Key is required to Anonymize attributes")
+	}
+	for attribute, kind := range a.Attributes {
+		switch kind {
+		case AnonymizeEmail, AnonymizeGivenName, AnonymizeFamilyName, AnonymizeName, AnonymizePhone, AnonymizeHash,
+			AnonymizeRedact:
+		default:
+			return fmt.Errorf("invalid anonymization %q for attribute %s", kind, attribute)
+		}
+	}
+	return nil
+}
+
+// anonymizePeople replaces the values of the configured attributes with pseudonyms. A compare value that is the
+// value of an anonymized attribute, such as an email address, is replaced by the same pseudonym.
+func anonymizePeople(people []Person, config AnonymizeConfig) {
+	for i, person := range people {
+		attributes := make(map[string]string, len(person.Attributes))
+		compareValue := person.CompareValue
+		for name, value := range person.Attributes {
+			kind, ok := config.Attributes[name]
+			if !ok || value == "" {
+				attributes[name] = value
+				continue
+			}
+			attributes[name] = config.anonymize(kind, value)
+			if strings.EqualFold(person.CompareValue, value) {
+				compareValue = attributes[name]
+			}
+		}
+		people[i].Attributes = attributes
+		people[i].CompareValue = compareValue
+	}
+}
+
+// anonymize returns the pseudonym of a value. Values that differ only in case or surrounding whitespace get the
+// same pseudonym.
+func (a AnonymizeConfig) anonymize(kind, value string) string {
+	mac := hmac.New(sha256.New, []byte(a.Key))
+	_, _ = mac.Write([]byte(kind + "\x00" + strings.ToLower(strings.TrimSpace(value))))
+	sum := mac.Sum(nil)
+
+	switch kind {
+	case AnonymizeEmail:
+		domain := a.EmailDomain
+		if domain == "" {
+			domain = DefaultAnonymizeEmailDomain
+		}
+		return "user-" + hex.EncodeToString(sum[:5]) + "@" + domain
+	case AnonymizeGivenName:
+		return pick(anonymousGivenNames, sum[0:8])
+	case AnonymizeFamilyName:
+		return pick(anonymousFamilyNames, sum[8:16])
+	case AnonymizeName:
+		return pick(anonymousGivenNames, sum[0:8]) + " " + pick(anonymousFamilyNames, sum[8:16])
+	case AnonymizePhone:
+		return anonymizeDigits(value, sum)
+	case AnonymizeHash:
+		return hex.EncodeToString(sum[:8])
+	}
+	return ""
+}
+
+func pick(list []string, b []byte) string {
+	return list[binary.BigEndian.Uint64(b)%uint64(len(list))]
+}
+
+// anonymizeDigits replaces each digit of the value with one taken from the hash, keeping any other characters so
+// that the format of a phone number is unchanged
+func anonymizeDigits(value string, sum []byte) string {
+	var b strings.Builder
+	i := 0
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			r = rune('0' + sum[i%len(sum)]%10)
+			i++
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAnonymizePeople(t *testing.T) {
+	config := AnonymizeConfig{
+		Key:         "secret",
+		EmailDomain: "test.example.org",
+		Attributes: map[string]string{
+			"email":  AnonymizeEmail,
+			"first":  AnonymizeGivenName,
+			"last":   AnonymizeFamilyName,
+			"full":   AnonymizeName,
+			"phone":  AnonymizePhone,
+			"id":     AnonymizeHash,
+			"salary": AnonymizeRedact,
+		},
+	}
+	person := func(email string) Person {
+		return Person{CompareValue: email, Attributes: map[string]string{"email": email, "first": "Jane",
+			"last": "Doe", "full": "Jane Doe", "phone": "+1 (555) 123-4567", "id": "E100", "salary": "100000",
+			"title": "Director", "manager": ""}}
+	}
+	people := []Person{person("jane.doe@example.com"), person(" Jane.Doe@Example.com"), person("john@example.com")}
+	anonymizePeople(people, config)
+
+	got := people[0].Attributes
+	checks := map[string]*regexp.Regexp{
+		"email":   regexp.MustCompile(`^user-[0-9a-f]{10}@test\.example\.org$`),
+		"first":   regexp.MustCompile(`^(` + strings.Join(anonymousGivenNames, "|") + `)$`),
+		"last":    regexp.MustCompile(`^(` + strings.Join(anonymousFamilyNames, "|") + `)$`),
+		"full":    regexp.MustCompile(`^\w+ \w+$`),
+		"phone":   regexp.MustCompile(`^\+\d \(\d{3}\) \d{3}-\d{4}$`),
+		"id":      regexp.MustCompile(`^[0-9a-f]{16}$`),
+		"salary":  regexp.MustCompile(`^$`),
+		"title":   regexp.MustCompile(`^Director$`),
+		"manager": regexp.MustCompile(`^$`),
+	}
+	for name, re := range checks {
+		if !re.MatchString(got[name]) {
+			t.Errorf("%s = %q, want a match for %s", name, got[name], re)
+		}
+	}
+	if got["phone"] == "+1 (555) 123-4567" {
+		t.Error("phone was not changed")
+	}
+	if people[0].CompareValue != got["email"] {
+		t.Errorf("CompareValue = %s, want the anonymized email %s", people[0].CompareValue, got["email"])
+	}
+
+	if people[1].Attributes["email"] != got["email"] {
+		t.Errorf("the same email in a different case was anonymized as %s and %s", people[1].Attributes["email"],
+			got["email"])
+	}
+	if people[2].Attributes["email"] == got["email"] {
+		t.Error("different emails were anonymized the same")
+	}
+
+	other := []Person{person("jane.doe@example.com")}
+	config.Key = "another secret"
+	anonymizePeople(other, config)
+	if other[0].Attributes["email"] == got["email"] {
+		t.Error("the email was anonymized the same with a different Key")
+	}
+}
+
+func TestAnonymizeConfig_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  AnonymizeConfig
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "valid", config: AnonymizeConfig{Key: "k", Attributes: map[string]string{"email": AnonymizeEmail}}},
+		{name: "no key", config: AnonymizeConfig{Attributes: map[string]string{"email": AnonymizeEmail}},
+			wantErr: true},
+		{name: "unknown", config: AnonymizeConfig{Key: "k", Attributes: map[string]string{"email": "scramble"}},
+			wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
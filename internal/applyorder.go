@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ApplyOrderKey is an expression that orders the changes of each type, so that the most time-sensitive ones, such
+// as accounts for people starting today, are made first in runs that are slowed by batch delays and rate limits
+type ApplyOrderKey struct {
+	// Expression is written like a sync set Filter, over the destination attributes of each change, such as
+	// attrs.startDate == today
+	Expression string
+
+	// Descending orders from the highest value to the lowest. Otherwise true is before false, and lower numbers and
+	// strings are before higher ones.
+	Descending bool
+}
+
+// validateApplyOrder checks that each expression can be parsed
+func validateApplyOrder(keys []ApplyOrderKey) error {
+	for _, key := range keys {
+		if _, err := parseFilter(key.Expression); err != nil {
+			return fmt.Errorf("invalid ApplyOrder expression %q: %s", key.Expression, err)
+		}
+	}
+	return nil
+}
+
+// orderChangeSet sorts the people of each type of change by the keys, keeping the order of people with the same
+// values. A person for whom an expression cannot be evaluated is placed after those for whom it can, and the first
+// such error is returned along with the sorted ChangeSet.
+func orderChangeSet(changeSet ChangeSet, keys []ApplyOrderKey, now time.Time) (ChangeSet, error) {
+	if len(keys) == 0 {
+		return changeSet, nil
+	}
+	expressions := make([]*filterExpression, len(keys))
+	for i, key := range keys {
+		expression, err := parseFilter(key.Expression)
+		if err != nil {
+			return changeSet, err
+		}
+		expressions[i] = expression
+	}
+
+	var firstErr error
+	order := func(people []Person) []Person {
+		values := make([][]interface{}, len(people))
+		for i, person := range people {
+			values[i] = make([]interface{}, len(expressions))
+			for j, expression := range expressions {
+				value, err := expression.eval(person, now)
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("unable to evaluate ApplyOrder for %s: %s", person.CompareValue, err)
+				}
+				values[i][j] = value
+			}
+		}
+
+		index := make([]int, len(people))
+		for i := range index {
+			index[i] = i
+		}
+		sort.SliceStable(index, func(a, b int) bool {
+			for j, key := range keys {
+				if cmp := compareOrderValues(values[index[a]][j], values[index[b]][j], key.Descending); cmp != 0 {
+					return cmp < 0
+				}
+			}
+			return false
+		})
+
+		sorted := make([]Person, len(people))
+		for i, k := range index {
+			sorted[i] = people[k]
+		}
+		return sorted
+	}
+
+	changeSet.Create = order(changeSet.Create)
+	changeSet.Update = order(changeSet.Update)
+	changeSet.Delete = order(changeSet.Delete)
+	return changeSet, firstErr
+}
+
+// compareOrderValues returns a negative number if a is applied before b, a positive number if b is applied before
+// a, or zero if they are equal. Missing values are always last.
+func compareOrderValues(a, b interface{}, descending bool) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	var cmp int
+	aBool, aIsBool := a.(bool)
+	bBool, bIsBool := b.(bool)
+	if aIsBool && bIsBool {
+		switch {
+		case aBool && !bBool:
+			cmp = -1
+		case !aBool && bBool:
+			cmp = 1
+		}
+	} else if x, y, ok := orderNumbers(a, b); ok {
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(filterString(a), filterString(b))
+	}
+
+	if descending {
+		return -cmp
+	}
+	return cmp
+}
+
+// orderNumbers returns both values as numbers if they are numbers or numeric strings, so that attribute values
+// such as "9" and "10" are in numeric order
+func orderNumbers(a, b interface{}) (float64, float64, bool) {
+	x, ok := orderNumber(a)
+	if !ok {
+		return 0, 0, false
+	}
+	y, ok := orderNumber(b)
+	return x, y, ok
+}
+
+func orderNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
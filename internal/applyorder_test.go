@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOrderChangeSet(t *testing.T) {
+	now := time.Date(2021, 3, 1, 8, 0, 0, 0, time.UTC)
+	person := func(name, startDate, title, level string) Person {
+		return Person{CompareValue: name, Attributes: map[string]string{"startDate": startDate, "title": title,
+			"level": level}}
+	}
+	people := []Person{
+		person("ann", "2021-03-08", "Engineer", "3"),
+		person("bob", "2021-03-01", "Engineer", "9"),
+		person("cy", "2021-03-05", "VP", "10"),
+		person("di", "2021-03-01", "CEO", "12"),
+		person("ed", "2021-03-05", "Engineer", "9"),
+	}
+
+	tests := []struct {
+		name    string
+		keys    []ApplyOrderKey
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "no keys",
+			want: []string{"ann", "bob", "cy", "di", "ed"},
+		},
+		{
+			name: "starting today, then executives",
+			keys: []ApplyOrderKey{
+				{Expression: `attrs.startDate == today`},
+				{Expression: `attrs.title in ["CEO", "VP"]`},
+			},
+			want: []string{"di", "bob", "cy", "ann", "ed"},
+		},
+		{
+			name: "earliest start date",
+			keys: []ApplyOrderKey{{Expression: `attrs.startDate`}},
+			want: []string{"bob", "di", "cy", "ed", "ann"},
+		},
+		{
+			name: "highest level, numerically",
+			keys: []ApplyOrderKey{{Expression: `attrs.level`, Descending: true}},
+			want: []string{"di", "cy", "bob", "ed", "ann"},
+		},
+		{
+			name:    "error",
+			keys:    []ApplyOrderKey{{Expression: `attrs.title == "VP" || attrs.level`}},
+			want:    []string{"cy", "ann", "bob", "di", "ed"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := orderChangeSet(ChangeSet{Create: people, Delete: people}, tt.keys, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("orderChangeSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, list := range [][]Person{got.Create, got.Delete} {
+				var names []string
+				for _, p := range list {
+					names = append(names, p.CompareValue)
+				}
+				if !reflect.DeepEqual(names, tt.want) {
+					t.Errorf("orderChangeSet() = %v, want %v", names, tt.want)
+				}
+			}
+		})
+	}
+
+	if people[0].CompareValue != "ann" {
+		t.Error("orderChangeSet() modified the given ChangeSet")
+	}
+	if err := validateApplyOrder([]ApplyOrderKey{{Expression: `attrs.level >`}}); err == nil {
+		t.Error("validateApplyOrder() did not return an error for an invalid expression")
+	}
+}
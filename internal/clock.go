@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the current time and a way to wait, so that time-dependent behavior can be tested without
+// waiting for real time to pass
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// SystemClock is the real clock
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// FakeClock is a Clock for testing. Time only passes when Sleep or Advance is called.
+type FakeClock struct {
+	now   time.Time
+	slept time.Duration
+	mutex sync.Mutex
+}
+
+// NewFakeClock returns a FakeClock set to the given time
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (f *FakeClock) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+// Sleep advances the time by d without waiting
+func (f *FakeClock) Sleep(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.now = f.now.Add(d)
+	f.slept += d
+}
+
+// Advance moves the time forward by d
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// Slept returns the total duration passed to Sleep
+func (f *FakeClock) Slept() time.Duration {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.slept
+}
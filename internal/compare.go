@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// CompareConfig replaces matching by CompareValue with a chain of match keys. Each key is an expression over the
+// destination attribute names, such as `lower(employeeId)` or `email + '|' + employeeId`. A source person is
+// matched to the destination person with the same value for the first key, trying each key in turn.
+type CompareConfig struct {
+	Keys []string
+
+	// Normalizers are applied in order to compare values before matching, e.g. "stripPlus" so that
+	// `j.doe+hr@example.org` matches `j.doe@example.org`. A sync set may override them with its CompareNormalizers.
+	Normalizers []string
+}
+
+// compareExpr computes a match key for a person
+type compareExpr func(p Person) string
+
+var compareFunctions = map[string]func(args []string) string{
+	"lower":  func(args []string) string { return strings.ToLower(strings.Join(args, "")) },
+	"upper":  func(args []string) string { return strings.ToUpper(strings.Join(args, "")) },
+	"trim":   func(args []string) string { return strings.TrimSpace(strings.Join(args, "")) },
+	"concat": func(args []string) string { return strings.Join(args, "") },
+}
+
+// parseCompareExpression parses an expression made of attribute names, single-quoted strings, the functions lower,
+// upper, trim, and concat, and the + operator for concatenation. The name CompareValue refers to the person's
+// CompareValue rather than an attribute. An expression evaluates to an empty string if any attribute is empty, so
+// that people missing an attribute are not matched with each other.
+func parseCompareExpression(s string) (compareExpr, error) {
+	p := &compareParser{input: s}
+	expr, err := p.parseSum()
+	if err != nil {
+		return nil, fmt.Errorf("invalid compare key %q: %s", s, err)
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("invalid compare key %q: unexpected %q", s, p.input[p.pos:])
+	}
+	return func(person Person) string {
+		value, ok := expr(person)
+		if !ok {
+			return ""
+		}
+		return value
+	}, nil
+}
+
+// partialExpr returns the value of an expression and false if an attribute it depends on is empty
+type partialExpr func(p Person) (string, bool)
+
+type compareParser struct {
+	input string
+	pos   int
+}
+
+func (c *compareParser) skipSpace() {
+	for c.pos < len(c.input) && unicode.IsSpace(rune(c.input[c.pos])) {
+		c.pos++
+	}
+}
+
+func (c *compareParser) parseSum() (partialExpr, error) {
+	terms := []partialExpr{}
+	for {
+		term, err := c.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+
+		c.skipSpace()
+		if c.pos >= len(c.input) || c.input[c.pos] != '+' {
+			break
+		}
+		c.pos++
+	}
+
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return concatExprs(terms, compareFunctions["concat"]), nil
+}
+
+func (c *compareParser) parseTerm() (partialExpr, error) {
+	c.skipSpace()
+	if c.pos >= len(c.input) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	if c.input[c.pos] == '\'' {
+		end := strings.IndexByte(c.input[c.pos+1:], '\'')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		literal := c.input[c.pos+1 : c.pos+1+end]
+		c.pos += end + 2
+		return func(Person) (string, bool) { return literal, true }, nil
+	}
+
+	start := c.pos
+	for c.pos < len(c.input) && isIdentifierChar(c.input[c.pos]) {
+		c.pos++
+	}
+	name := c.input[start:c.pos]
+	if name == "" {
+		return nil, fmt.Errorf("unexpected %q", c.input[c.pos:])
+	}
+
+	c.skipSpace()
+	if c.pos >= len(c.input) || c.input[c.pos] != '(' {
+		if name == "CompareValue" {
+			return func(p Person) (string, bool) { return p.CompareValue, p.CompareValue != "" }, nil
+		}
+		return func(p Person) (string, bool) {
+			value := p.Attributes[name]
+			return value, value != ""
+		}, nil
+	}
+
+	fn, ok := compareFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	c.pos++
+
+	var args []partialExpr
+	for {
+		arg, err := c.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		c.skipSpace()
+		if c.pos >= len(c.input) {
+			return nil, fmt.Errorf("missing ) after arguments to %s", name)
+		}
+		if c.input[c.pos] == ')' {
+			c.pos++
+			break
+		}
+		if c.input[c.pos] != ',' {
+			return nil, fmt.Errorf("unexpected %q in arguments to %s", c.input[c.pos:], name)
+		}
+		c.pos++
+	}
+
+	return concatExprs(args, fn), nil
+}
+
+func concatExprs(exprs []partialExpr, fn func(args []string) string) partialExpr {
+	return func(p Person) (string, bool) {
+		values := make([]string, len(exprs))
+		for i, expr := range exprs {
+			value, ok := expr(p)
+			if !ok {
+				return "", false
+			}
+			values[i] = value
+		}
+		return fn(values), true
+	}
+}
+
+func isIdentifierChar(b byte) bool {
+	return b == '_' || b == '.' || b == '-' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// matchByCompareKeys returns the index of the matching destination person for each source person, or -1 if there
+// is none. All source people are matched by the first key before the next key is tried, and each destination person
+// is matched at most once, so a fallback key never takes a destination person that matches someone else better.
+// A key value that is shared by more than one destination person is not used.
+func matchByCompareKeys(keys []string, sourcePeople, destinationPeople []Person) ([]int, error) {
+	matches := make([]int, len(sourcePeople))
+	for s := range matches {
+		matches[s] = -1
+	}
+	claimed := map[int]bool{}
+
+	for _, key := range keys {
+		expr, err := parseCompareExpression(key)
+		if err != nil {
+			return nil, err
+		}
+
+		index := map[string][]int{}
+		for d, dp := range destinationPeople {
+			if value := expr(dp); value != "" {
+				index[value] = append(index[value], d)
+			}
+		}
+
+		for s, sp := range sourcePeople {
+			if matches[s] >= 0 {
+				continue
+			}
+			value := expr(sp)
+			if value == "" {
+				continue
+			}
+			if candidates := index[value]; len(candidates) == 1 && !claimed[candidates[0]] {
+				matches[s] = candidates[0]
+				claimed[candidates[0]] = true
+			}
+		}
+	}
+
+	return matches, nil
+}
+
+// validateCompareKeys checks that all compare keys can be parsed
+func validateCompareKeys(keys []string) error {
+	for _, key := range keys {
+		if _, err := parseCompareExpression(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
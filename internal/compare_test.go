@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestParseCompareExpression(t *testing.T) {
+	person := Person{
+		CompareValue: "Alfred@Example.com",
+		Attributes:   map[string]string{"employeeId": " E100 ", "email": "Alfred@Example.com", "empty": ""},
+	}
+
+	tests := []struct {
+		expression string
+		want       string
+		wantErr    bool
+	}{
+		{expression: "email", want: "Alfred@Example.com"},
+		{expression: "lower(email)", want: "alfred@example.com"},
+		{expression: "upper(trim(employeeId))", want: "E100"},
+		{expression: "lower(CompareValue)", want: "alfred@example.com"},
+		{expression: "trim(employeeId) + '|' + lower(email)", want: "E100|alfred@example.com"},
+		{expression: "concat(trim(employeeId), '-', 'x')", want: "E100-x"},
+		{expression: "email + empty", want: ""},
+		{expression: "missing", want: ""},
+		{expression: "unknown(email)", wantErr: true},
+		{expression: "lower(email", wantErr: true},
+		{expression: "email +", wantErr: true},
+		{expression: "'unterminated", wantErr: true},
+		{expression: "email email", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			expr, err := parseCompareExpression(tt.expression)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCompareExpression() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := expr(person); got != tt.want {
+				t.Errorf("expression evaluated to %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchByCompareKeys(t *testing.T) {
+	sourcePeople := []Person{
+		{CompareValue: "new@example.com", Attributes: map[string]string{"employeeId": "1", "email": "new@example.com"}},
+		{CompareValue: "two@example.com", Attributes: map[string]string{"email": "two@example.com"}},
+		{CompareValue: "three@example.com", Attributes: map[string]string{"employeeId": "3", "email": "three@example.com"}},
+		{CompareValue: "four@example.com", Attributes: map[string]string{"employeeId": "4", "email": "one@example.com"}},
+	}
+	destinationPeople := []Person{
+		{CompareValue: "one@example.com", Attributes: map[string]string{"employeeId": "1", "email": "one@example.com"}},
+		{CompareValue: "Two@example.com", Attributes: map[string]string{"email": "Two@example.com"}},
+	}
+
+	got, err := matchByCompareKeys([]string{"employeeId", "lower(email)"}, sourcePeople, destinationPeople)
+	if err != nil {
+		t.Fatalf("matchByCompareKeys() error = %s", err)
+	}
+
+	// the fourth person's email matches the first destination person, but that is already matched by employeeId
+	want := []int{0, 1, -1, -1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("matchByCompareKeys() = %v, want %v", got, want)
+	}
+}
+
+func TestGenerateChangeSet_CompareKeys(t *testing.T) {
+	config := AppConfig{
+		Compare: CompareConfig{Keys: []string{"employeeId", "lower(email)"}},
+		AttributeMap: []AttributeMap{
+			{Source: "email", Destination: "email"},
+			{Source: "employeeId", Destination: "employeeId"},
+		},
+	}
+	sourcePeople := []Person{
+		{CompareValue: "new@example.com", Attributes: map[string]string{"employeeId": "1", "email": "new@example.com"}},
+	}
+	destinationPeople := []Person{
+		{
+			CompareValue: "old@example.com",
+			Attributes:   map[string]string{"id": "a", "employeeId": "1", "email": "old@example.com"},
+		},
+	}
+
+	changeSet := GenerateChangeSet(log.New(ioutil.Discard, "", 0), sourcePeople, destinationPeople, config)
+	if len(changeSet.Create) != 0 || len(changeSet.Delete) != 0 || len(changeSet.Update) != 1 {
+		t.Fatalf("GenerateChangeSet() = %+v, want one update", changeSet)
+	}
+	if changeSet.Update[0].ID != "a" {
+		t.Errorf("update ID = %q, want a", changeSet.Update[0].ID)
+	}
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// SyncSetChains returns the indexes of the config's SyncSets in chains that must run one after another, because
+// their sync sets change the same destination target, such as two sync sets of the same Google group, or a sync set
+// and another that adds the people it removes with OnDelete. Sync sets in different chains are independent, and
+// can run at the same time. The chains are in order of their first sync set, and each chain is in config order.
+func (a *AppConfig) SyncSetChains() [][]int {
+	// parent is a union-find forest of sync set indexes
+	parent := make([]int, len(a.SyncSets))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if parent[i] != i {
+			parent[i] = root(parent[i])
+		}
+		return parent[i]
+	}
+
+	firstByTarget := map[string]int{}
+	for i, syncSet := range a.SyncSets {
+		for _, target := range a.syncSetTargets(syncSet) {
+			first, ok := firstByTarget[target]
+			if !ok {
+				firstByTarget[target] = i
+				continue
+			}
+			if r, f := root(i), root(first); r != f {
+				// keep the earliest sync set as the root, so that chains are ordered by their first sync set
+				if r < f {
+					parent[f] = r
+				} else {
+					parent[r] = f
+				}
+			}
+		}
+	}
+
+	var chains [][]int
+	chainByRoot := map[int]int{}
+	for i := range a.SyncSets {
+		r := root(i)
+		c, ok := chainByRoot[r]
+		if !ok {
+			c = len(chains)
+			chainByRoot[r] = c
+			chains = append(chains, nil)
+		}
+		chains[c] = append(chains[c], i)
+	}
+	return chains
+}
+
+// WorkerChains divides the SyncSetChains among the given number of workers, so that each worker knows the sync sets
+// it will run before it starts, such as to preload them. Each chain is given to the worker with the fewest sync sets
+// so far, in order of the chains.
+func (a *AppConfig) WorkerChains(workers int) [][][]int {
+	if workers < 1 {
+		workers = 1
+	}
+	assigned := make([][][]int, workers)
+	sizes := make([]int, workers)
+	for _, chain := range a.SyncSetChains() {
+		w := 0
+		for i := range sizes {
+			if sizes[i] < sizes[w] {
+				w = i
+			}
+		}
+		assigned[w] = append(assigned[w], chain)
+		sizes[w] += len(chain)
+	}
+	return assigned
+}
+
+// syncSetTargets returns a key for each destination target that the sync set changes: the sync set configuration
+// of each of its destinations, and of its OnDelete destination
+func (a *AppConfig) syncSetTargets(syncSet SyncSet) []string {
+	var targets []string
+	for _, run := range a.SyncSetDestinations(syncSet) {
+		targets = append(targets, targetKey(run.Index, run.SyncSet.Destination))
+	}
+	if syncSet.OnDelete.isSet() {
+		for i, destination := range a.DestinationConfigs() {
+			if destination.Name != "" && destination.Name == syncSet.OnDelete.DestinationName {
+				targets = append(targets, targetKey(i, syncSet.OnDelete.Destination))
+			}
+		}
+	}
+	return targets
+}
+
+// targetKey returns a key for the sync set configuration of a destination that is the same for JSON that only
+// differs in whitespace
+func targetKey(destinationIndex int, syncSetJSON json.RawMessage) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, syncSetJSON); err != nil {
+		return fmt.Sprintf("%v %s", destinationIndex, syncSetJSON)
+	}
+	return fmt.Sprintf("%v %s", destinationIndex, compact.Bytes())
+}
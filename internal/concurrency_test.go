@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestAppConfig_SyncSetChains(t *testing.T) {
+	tests := []struct {
+		name     string
+		syncSets []SyncSet
+		want     [][]int
+	}{
+		{
+			name: "independent",
+			syncSets: []SyncSet{
+				{Name: "a", Destination: json.RawMessage(`{"GroupEmail": "a@example.org"}`)},
+				{Name: "b", Destination: json.RawMessage(`{"GroupEmail": "b@example.org"}`)},
+			},
+			want: [][]int{{0}, {1}},
+		},
+		{
+			name: "same target",
+			syncSets: []SyncSet{
+				{Name: "a", Destination: json.RawMessage(`{"GroupEmail": "a@example.org"}`)},
+				{Name: "b", Destination: json.RawMessage(`{"GroupEmail": "b@example.org"}`)},
+				{Name: "c", Destination: json.RawMessage(`{"GroupEmail":"a@example.org"}`)},
+			},
+			want: [][]int{{0, 2}, {1}},
+		},
+		{
+			name: "named destination and OnDelete",
+			syncSets: []SyncSet{
+				{Name: "a", Destination: json.RawMessage(`{"GroupEmail": "a@example.org"}`),
+					Destinations: map[string]json.RawMessage{"alumni": json.RawMessage(`{"List": "x"}`)}},
+				{Name: "b", Destination: json.RawMessage(`{"GroupEmail": "b@example.org"}`)},
+				{Name: "c", Destination: json.RawMessage(`{"GroupEmail": "c@example.org"}`),
+					OnDelete: OnDeleteConfig{DestinationName: "alumni", Destination: json.RawMessage(`{"List": "y"}`)}},
+				{Name: "d", Destination: json.RawMessage(`{"GroupEmail": "d@example.org"}`),
+					OnDelete: OnDeleteConfig{DestinationName: "alumni", Destination: json.RawMessage(`{"List": "x"}`)}},
+				{Name: "e", Destination: json.RawMessage(`{"GroupEmail": "c@example.org"}`)},
+			},
+			want: [][]int{{0, 3}, {1}, {2, 4}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := AppConfig{
+				Destination:  DestinationConfig{Type: "GoogleGroups"},
+				Destinations: []DestinationConfig{{Name: "alumni", Type: "Mailchimp"}},
+				SyncSets:     tt.syncSets,
+			}
+			if got := config.SyncSetChains(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SyncSetChains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppConfig_WorkerChains(t *testing.T) {
+	target := func(email string) json.RawMessage {
+		return json.RawMessage(`{"GroupEmail": "` + email + `"}`)
+	}
+	config := AppConfig{Destination: DestinationConfig{Type: "GoogleGroups"}, SyncSets: []SyncSet{
+		{Name: "a", Destination: target("a@example.org")},
+		{Name: "b", Destination: target("b@example.org")},
+		{Name: "c", Destination: target("a@example.org")},
+		{Name: "d", Destination: target("d@example.org")},
+		{Name: "e", Destination: target("e@example.org")},
+	}}
+
+	tests := []struct {
+		name    string
+		workers int
+		want    [][][]int
+	}{
+		{name: "one worker", workers: 1, want: [][][]int{{{0, 2}, {1}, {3}, {4}}}},
+		{name: "two workers", workers: 2, want: [][][]int{{{0, 2}, {4}}, {{1}, {3}}}},
+		{name: "more workers than chains", workers: 5, want: [][][]int{{{0, 2}}, {{1}}, {{3}}, {{4}}, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := config.WorkerChains(tt.workers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WorkerChains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	ConfigChangeAdded   = "added"
+	ConfigChangeRemoved = "removed"
+	ConfigChangeChanged = "changed"
+
+	redactedValue = "(redacted)"
+)
+
+// ConfigChange is a difference between two configs
+type ConfigChange struct {
+	// Kind is ConfigChangeAdded, ConfigChangeRemoved, or ConfigChangeChanged
+	Kind string
+
+	// Path locates the setting, such as SyncSets["Staff"].Destination.GroupEmail. Sync sets, named sources and
+	// destinations, and attribute maps are identified by name rather than by their position in the config.
+	Path string
+
+	Old interface{} `json:",omitempty"`
+	New interface{} `json:",omitempty"`
+}
+
+// keyedLists are the lists of the config whose entries are matched by a key rather than by position, so that
+// reordering them is not a change. The key of an AttributeMap entry is its Destination attribute.
+var keyedLists = map[string]string{
+	"SyncSets":     "Name",
+	"Destinations": "Name",
+	"Sources":      "Name",
+	"AttributeMap": "Destination",
+}
+
+// DiffConfigs compares two configs semantically and returns the changes from old to new, in order of their Path.
+// The values of settings that may hold credentials, such as passwords and keys, are redacted.
+func DiffConfigs(old, new AppConfig) ([]ConfigChange, error) {
+	oldTree, err := configTree(old)
+	if err != nil {
+		return nil, err
+	}
+	newTree, err := configTree(new)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ConfigChange
+	diffValues("", "", oldTree, newTree, &changes)
+	return changes, nil
+}
+
+// configTree returns the config as generic JSON values
+func configTree(config AppConfig) (interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal config: %s", err)
+	}
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("unable to read config: %s", err)
+	}
+	return tree, nil
+}
+
+// diffValues adds the changes between two values at path. The name is the key of the value in its parent object.
+func diffValues(path, name string, old, new interface{}, changes *[]ConfigChange) {
+	if reflect.DeepEqual(old, new) {
+		return
+	}
+
+	oldObject, oldIsObject := old.(map[string]interface{})
+	newObject, newIsObject := new.(map[string]interface{})
+	if oldIsObject && newIsObject {
+		for _, key := range unionKeys(oldObject, newObject) {
+			diffEntry(path+"."+key, key, key, oldObject, newObject, changes)
+		}
+		return
+	}
+
+	if key, ok := keyedLists[name]; ok {
+		oldEntries, oldOK := keyedEntries(old, key)
+		newEntries, newOK := keyedEntries(new, key)
+		if oldOK && newOK {
+			for _, entryKey := range unionKeys(oldEntries, newEntries) {
+				diffEntry(fmt.Sprintf("%s[%q]", path, entryKey), "", entryKey, oldEntries, newEntries, changes)
+			}
+			return
+		}
+	}
+
+	*changes = append(*changes, ConfigChange{Kind: ConfigChangeChanged, Path: strings.TrimPrefix(path, "."),
+		Old: redact(name, old), New: redact(name, new)})
+}
+
+// diffEntry compares the entries with a key in two objects, which may be missing from either of them. The name is
+// the key if the objects are part of the config, or empty if they are the entries of a keyed list.
+func diffEntry(path, name, key string, oldParent, newParent map[string]interface{}, changes *[]ConfigChange) {
+	old, inOld := oldParent[key]
+	new, inNew := newParent[key]
+	switch {
+	case inOld && !inNew && !isEmpty(old):
+		*changes = append(*changes, ConfigChange{Kind: ConfigChangeRemoved, Path: strings.TrimPrefix(path, "."),
+			Old: redact(name, old)})
+	case inNew && !inOld && !isEmpty(new):
+		*changes = append(*changes, ConfigChange{Kind: ConfigChangeAdded, Path: strings.TrimPrefix(path, "."),
+			New: redact(name, new)})
+	case inOld && inNew:
+		diffValues(path, name, old, new, changes)
+	}
+}
+
+// keyedEntries returns the entries of a list of objects by their key. It returns false if the value is not such a
+// list, or if the keys are not unique.
+func keyedEntries(value interface{}, key string) (map[string]interface{}, bool) {
+	if value == nil {
+		return map[string]interface{}{}, true
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	entries := map[string]interface{}{}
+	for _, entry := range list {
+		object, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		entryKey, ok := object[key].(string)
+		if _, duplicate := entries[entryKey]; !ok || duplicate {
+			return nil, false
+		}
+		entries[entryKey] = entry
+	}
+	return entries, true
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	var keys []string
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isEmpty returns true for the zero values that a setting has when it is left out of the config
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case float64:
+		return v == 0
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		for _, child := range v {
+			if !isEmpty(child) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isSecret returns true for the names of settings that may hold credentials
+func isSecret(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range []string{"password", "secret", "token", "apikey", "api_key", "private_key", "credential"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return name == "key" || strings.HasSuffix(name, "accesskey") || strings.HasSuffix(name, "signingkey") ||
+		strings.HasSuffix(name, "webhookurl")
+}
+
+// redact replaces a secret value, or the secrets within an object, with redactedValue
+func redact(name string, value interface{}) interface{} {
+	if isSecret(name) && !isEmpty(value) {
+		return redactedValue
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			redacted[key] = redact(key, child)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, child := range v {
+			redacted[i] = redact("", child)
+		}
+		return redacted
+	}
+	return value
+}
+
+// FormatConfigDiff returns the changes as text for people to read, one per line, followed by a count of the sync
+// sets that were added, removed, and changed
+func FormatConfigDiff(changes []ConfigChange) string {
+	if len(changes) == 0 {
+		return "No differences\n"
+	}
+
+	var b strings.Builder
+	for _, change := range changes {
+		switch change.Kind {
+		case ConfigChangeAdded:
+			fmt.Fprintf(&b, "+ %s: %s\n", change.Path, formatValue(change.New))
+		case ConfigChangeRemoved:
+			fmt.Fprintf(&b, "- %s: %s\n", change.Path, formatValue(change.Old))
+		default:
+			fmt.Fprintf(&b, "~ %s: %s -> %s\n", change.Path, formatValue(change.Old), formatValue(change.New))
+		}
+	}
+
+	added, removed, changed := countSyncSetChanges(changes)
+	fmt.Fprintf(&b, "\n%v changes: %v sync sets added, %v removed, %v changed\n", len(changes), added, removed,
+		changed)
+	return b.String()
+}
+
+// countSyncSetChanges returns the number of sync sets that were added, removed, and changed
+func countSyncSetChanges(changes []ConfigChange) (added, removed, changed int) {
+	changedSets := map[string]bool{}
+	for _, change := range changes {
+		if !strings.HasPrefix(change.Path, `SyncSets["`) {
+			continue
+		}
+		syncSet := change.Path[:strings.Index(change.Path, `"]`)+2]
+		switch {
+		case syncSet != change.Path:
+			changedSets[syncSet] = true
+		case change.Kind == ConfigChangeAdded:
+			added++
+		case change.Kind == ConfigChangeRemoved:
+			removed++
+		}
+	}
+	return added, removed, len(changedSets)
+}
+
+func formatValue(value interface{}) string {
+	if s, ok := value.(string); ok && s == redactedValue {
+		return s
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	base := AppConfig{
+		Source:      SourceConfig{Type: "Fake", ExtraJSON: json.RawMessage(`{"URL": "https://hr", "Password": "a"}`)},
+		Destination: DestinationConfig{Type: "Fake", ExtraJSON: json.RawMessage(`{"Domain": "example.org"}`)},
+		AttributeMap: []AttributeMap{
+			{Source: "mail", Destination: "email", Required: true},
+			{Source: "first", Destination: "givenName"},
+		},
+		SyncSets: []SyncSet{
+			{Name: "staff", Source: json.RawMessage(`{"Path": "/staff"}`),
+				Destination: json.RawMessage(`{"GroupEmail": "staff@example.org", "Owners": ["a", "b"]}`)},
+			{Name: "interns", Source: json.RawMessage(`{"Path": "/interns"}`),
+				Destination: json.RawMessage(`{"GroupEmail": "interns@example.org"}`)},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		change func(config *AppConfig)
+		want   []string
+	}{
+		{
+			name: "reordered and reformatted",
+			change: func(config *AppConfig) {
+				config.SyncSets = []SyncSet{config.SyncSets[1], config.SyncSets[0]}
+				config.SyncSets[1].Destination = json.RawMessage(`{"Owners":["a","b"],"GroupEmail":"staff@example.org"}`)
+				config.AttributeMap = []AttributeMap{config.AttributeMap[1], config.AttributeMap[0]}
+			},
+		},
+		{
+			name: "sync sets added, removed, and changed",
+			change: func(config *AppConfig) {
+				config.SyncSets = []SyncSet{config.SyncSets[0], {Name: "alumni"}}
+				config.SyncSets[0].Destination = json.RawMessage(`{"GroupEmail": "all@example.org", "Owners": ["a"]}`)
+			},
+			want: []string{
+				`added SyncSets["alumni"]`,
+				`removed SyncSets["interns"]`,
+				`changed SyncSets["staff"].Destination.GroupEmail: "staff@example.org" -> "all@example.org"`,
+				`changed SyncSets["staff"].Destination.Owners: ["a","b"] -> ["a"]`,
+			},
+		},
+		{
+			name: "attribute map",
+			change: func(config *AppConfig) {
+				config.AttributeMap = []AttributeMap{
+					{Source: "email", Destination: "email"},
+					{Source: "phone", Destination: "phone"},
+				}
+			},
+			want: []string{
+				`changed AttributeMap["email"].Required: true -> false`,
+				`changed AttributeMap["email"].Source: "mail" -> "email"`,
+				`removed AttributeMap["givenName"]`,
+				`added AttributeMap["phone"]`,
+			},
+		},
+		{
+			name: "settings and secrets",
+			change: func(config *AppConfig) {
+				config.Source.ExtraJSON = json.RawMessage(`{"URL": "https://hr2", "Password": "b"}`)
+				config.Destination.ExtraJSON = json.RawMessage(`{"Domain": "example.org", "Token": "t"}`)
+			},
+			want: []string{
+				`added Destination.ExtraJSON.Token`,
+				`changed Source.ExtraJSON.Password: (redacted) -> (redacted)`,
+				`changed Source.ExtraJSON.URL: "https://hr" -> "https://hr2"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newConfig := base
+			newConfig.SyncSets = append([]SyncSet{}, base.SyncSets...)
+			newConfig.AttributeMap = append([]AttributeMap{}, base.AttributeMap...)
+			tt.change(&newConfig)
+
+			changes, err := DiffConfigs(base, newConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, change := range changes {
+				summary := change.Kind + " " + change.Path
+				if change.Kind == ConfigChangeChanged {
+					summary += ": " + formatValue(change.Old) + " -> " + formatValue(change.New)
+				}
+				got = append(got, summary)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffConfigs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	changes, _ := DiffConfigs(AppConfig{Destination: DestinationConfig{ExtraJSON: json.RawMessage(`{}`)}},
+		AppConfig{Destination: DestinationConfig{ExtraJSON: json.RawMessage(`{"Auth": {"Password": "p", "User": "u"}}`)}})
+	if len(changes) != 1 || !reflect.DeepEqual(changes[0].New, map[string]interface{}{"Password": redactedValue,
+		"User": "u"}) {
+		t.Errorf("a secret in an added setting was not redacted: %+v", changes)
+	}
+}
+
+func TestFormatConfigDiff(t *testing.T) {
+	if got := FormatConfigDiff(nil); got != "No differences\n" {
+		t.Errorf("FormatConfigDiff(nil) = %q", got)
+	}
+
+	got := FormatConfigDiff([]ConfigChange{
+		{Kind: ConfigChangeAdded, Path: `SyncSets["alumni"]`, New: map[string]interface{}{"Name": "alumni"}},
+		{Kind: ConfigChangeChanged, Path: `SyncSets["staff"].Destination.GroupEmail`, Old: "a", New: "b"},
+		{Kind: ConfigChangeChanged, Path: `SyncSets["staff"].Source.Path`, Old: "/a", New: "/b"},
+		{Kind: ConfigChangeRemoved, Path: `AttributeMap["phone"].Required`, Old: true},
+		{Kind: ConfigChangeChanged, Path: `Source.ExtraJSON.Password`, Old: redactedValue, New: redactedValue},
+	})
+	want := `+ SyncSets["alumni"]: {"Name":"alumni"}
+~ SyncSets["staff"].Destination.GroupEmail: "a" -> "b"
+~ SyncSets["staff"].Source.Path: "/a" -> "/b"
+- AttributeMap["phone"].Required: true
+~ Source.ExtraJSON.Password: (redacted) -> (redacted)
+
+5 changes: 1 sync sets added, 0 removed, 1 changed
+`
+	if got != want {
+		t.Errorf("FormatConfigDiff() =\n%s\nwant\n%s", got, want)
+	}
+}
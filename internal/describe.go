@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AdapterConfig describes the configuration of an adapter type, for help output: the values that its ExtraJSON and
+// the JSON of its sync sets are read into. Either may be nil.
+type AdapterConfig struct {
+	ExtraJSON []interface{}
+	SyncSet   interface{}
+
+	// Features are the features that need support from the destination, such as FeaturePartialUpdates, which it
+	// implements
+	Features []string
+}
+
+// ConfigField is a configuration field of an adapter, such as "BatchSize" of type "integer". The fields of an
+// object are named after it, such as "Password.Length", and those of the objects in a list are named like
+// "CustomSchemaFields[].Name".
+type ConfigField struct {
+	Name string
+	Type string
+}
+
+var (
+	sourceConfigs      = map[string]AdapterConfig{}
+	destinationConfigs = map[string]AdapterConfig{}
+)
+
+// DescribeSource records the configuration of a source type for help output. Adapter packages call it from init,
+// after RegisterSource.
+func DescribeSource(sourceType string, config AdapterConfig) {
+	sourceConfigs[sourceType] = config
+}
+
+// DescribeDestination records the configuration of a destination type for help output
+func DescribeDestination(destinationType string, config AdapterConfig) {
+	destinationConfigs[destinationType] = config
+}
+
+// SourceTypes returns the registered source types in alphabetical order
+func SourceTypes() []string {
+	var types []string
+	for sourceType := range sourceConstructors {
+		types = append(types, sourceType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// DestinationTypes returns the registered destination types in alphabetical order
+func DestinationTypes() []string {
+	var types []string
+	for destinationType := range destinationConstructors {
+		types = append(types, destinationType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// StateStoreTypes returns the state store types, including the file type, in alphabetical order
+func StateStoreTypes() []string {
+	types := []string{StateTypeFile}
+	for stateType := range stateStoreConstructors {
+		types = append(types, stateType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// DescribedSource returns the configuration of a registered source type, and false if it has not been described
+func DescribedSource(sourceType string) (AdapterConfig, bool) {
+	config, ok := sourceConfigs[sourceType]
+	return config, ok
+}
+
+// DescribedDestination returns the configuration of a registered destination type, and false if it has not been
+// described
+func DescribedDestination(destinationType string) (AdapterConfig, bool) {
+	config, ok := destinationConfigs[destinationType]
+	return config, ok
+}
+
+// ExtraJSONFields returns the fields of the ExtraJSON. A field whose type is one of the other ExtraJSON values, or
+// the sync set, is left out, since its fields are listed with that value.
+func (a AdapterConfig) ExtraJSONFields() []ConfigField {
+	described := map[reflect.Type]bool{}
+	if a.SyncSet != nil {
+		described[indirectType(reflect.TypeOf(a.SyncSet))] = true
+	}
+	for _, v := range a.ExtraJSON {
+		described[indirectType(reflect.TypeOf(v))] = true
+	}
+	var fields []ConfigField
+	for _, v := range a.ExtraJSON {
+		fields = append(fields, configFields(reflect.TypeOf(v), "", described, 0)...)
+	}
+	return fields
+}
+
+// SyncSetFields returns the fields of the JSON of a sync set
+func (a AdapterConfig) SyncSetFields() []ConfigField {
+	if a.SyncSet == nil {
+		return nil
+	}
+	return configFields(reflect.TypeOf(a.SyncSet), "", nil, 0)
+}
+
+// maxConfigDepth limits how deeply nested objects are described
+const maxConfigDepth = 3
+
+// modulePath is the import path of this module. Only its structs are described field by field; a struct from
+// another package, such as an API client, is not configuration.
+const modulePath = "github.com/silinternational/personnel-sync/"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// configFields returns the fields of a struct type that can be set in JSON, with the prefix before their names
+func configFields(t reflect.Type, prefix string, described map[reflect.Type]bool, depth int) []ConfigField {
+	t = indirectType(t)
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []ConfigField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous { // unexported
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		fieldType := indirectType(field.Type)
+		if described[fieldType] || !isConfigType(fieldType) {
+			continue
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			fields = append(fields, configFields(fieldType, prefix, described, depth)...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fields = append(fields, ConfigField{Name: prefix + name, Type: typeName(fieldType)})
+		if depth+1 >= maxConfigDepth {
+			continue
+		}
+		switch {
+		case isModuleStruct(fieldType):
+			fields = append(fields, configFields(fieldType, prefix+name+".", described, depth+1)...)
+		case fieldType.Kind() == reflect.Slice && isModuleStruct(indirectType(fieldType.Elem())):
+			fields = append(fields, configFields(fieldType.Elem(), prefix+name+"[].", described, depth+1)...)
+		}
+	}
+	return fields
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func isModuleStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && strings.HasPrefix(t.PkgPath(), modulePath)
+}
+
+// isConfigType reports whether a value of the type can be configured in JSON. The configs of sources and
+// destinations themselves are not, since adapters keep them for reference.
+func isConfigType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Func, reflect.Chan, reflect.Interface, reflect.UnsafePointer:
+		return false
+	case reflect.Struct:
+		if t == reflect.TypeOf(SourceConfig{}) || t == reflect.TypeOf(DestinationConfig{}) {
+			return false
+		}
+		return t == timeType || isModuleStruct(t)
+	case reflect.Slice, reflect.Map:
+		return t.Elem().Kind() == reflect.Uint8 || isConfigType(indirectType(t.Elem()))
+	}
+	return true
+}
+
+// typeName describes a type as it is written in JSON
+func typeName(t reflect.Type) string {
+	t = indirectType(t)
+	if t == timeType {
+		return "time"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8,
+		reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "JSON"
+		}
+		return "list of " + typeName(t.Elem())
+	case reflect.Map:
+		return "map of " + typeName(t.Elem())
+	}
+	return "object"
+}
+
+// FormatConfigFields lists the fields with their types, one per line, indented
+func FormatConfigFields(fields []ConfigField) string {
+	width := 0
+	for _, field := range fields {
+		if len(field.Name) > width {
+			width = len(field.Name)
+		}
+	}
+	var b strings.Builder
+	for _, field := range fields {
+		fmt.Fprintf(&b, "  %-*s  %s\n", width, field.Name, field.Type)
+	}
+	return b.String()
+}
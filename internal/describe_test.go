@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type describedAuth struct {
+	Token string `json:"token"`
+}
+
+type describedItem struct {
+	Name  string
+	Count int
+}
+
+type describedSyncSet struct {
+	GroupID    string
+	DisableAdd bool
+}
+
+type describedAdapter struct {
+	DestinationConfig DestinationConfig
+	SyncSet           describedSyncSet
+	Client            *http.Client
+	Auth              describedAuth
+	Items             []describedItem
+	Tags              []string
+	Limits            map[string]float64
+	Since             time.Time
+	Body              []byte
+	Secret            string `json:"-"`
+	Renamed           bool   `json:"renamed,omitempty"`
+	Retry             *RetryConfig
+	callback          func()
+	RetryConfig
+}
+
+func TestAdapterConfig_ExtraJSONFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		config AdapterConfig
+		want   []ConfigField
+	}{
+		{
+			name:   "none",
+			config: AdapterConfig{},
+			want:   nil,
+		},
+		{
+			name: "adapter",
+			config: AdapterConfig{
+				ExtraJSON: []interface{}{describedAdapter{}},
+				SyncSet:   describedSyncSet{},
+			},
+			want: []ConfigField{
+				{Name: "Auth", Type: "object"},
+				{Name: "Auth.token", Type: "string"},
+				{Name: "Items", Type: "list of object"},
+				{Name: "Items[].Name", Type: "string"},
+				{Name: "Items[].Count", Type: "integer"},
+				{Name: "Tags", Type: "list of string"},
+				{Name: "Limits", Type: "map of number"},
+				{Name: "Since", Type: "time"},
+				{Name: "Body", Type: "JSON"},
+				{Name: "renamed", Type: "boolean"},
+				{Name: "Retry", Type: "object"},
+				{Name: "Retry.MaxAttempts", Type: "integer"},
+				{Name: "Retry.BaseDelayMillisec", Type: "integer"},
+				{Name: "Retry.MaxDelayMillisec", Type: "integer"},
+				{Name: "Retry.RetryableStatusCodes", Type: "list of integer"},
+				{Name: "Retry.RetryMethods", Type: "list of string"},
+				{Name: "MaxAttempts", Type: "integer"},
+				{Name: "BaseDelayMillisec", Type: "integer"},
+				{Name: "MaxDelayMillisec", Type: "integer"},
+				{Name: "RetryableStatusCodes", Type: "list of integer"},
+				{Name: "RetryMethods", Type: "list of string"},
+			},
+		},
+		{
+			name: "several values",
+			config: AdapterConfig{
+				ExtraJSON: []interface{}{describedAuth{}, &struct {
+					Auth describedAuth
+					API  string
+				}{}},
+			},
+			want: []ConfigField{
+				{Name: "token", Type: "string"},
+				{Name: "API", Type: "string"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.ExtraJSONFields(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExtraJSONFields() =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdapterConfig_SyncSetFields(t *testing.T) {
+	config := AdapterConfig{SyncSet: describedSyncSet{}}
+	want := []ConfigField{{Name: "GroupID", Type: "string"}, {Name: "DisableAdd", Type: "boolean"}}
+	if got := config.SyncSetFields(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SyncSetFields() = %v, want %v", got, want)
+	}
+	if got := (AdapterConfig{}).SyncSetFields(); got != nil {
+		t.Errorf("SyncSetFields() without a sync set = %v, want nil", got)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	RegisterSource("DescribeTest", func(SourceConfig) (Source, error) { return nil, nil })
+	RegisterDestination("DescribeTest", func(DestinationConfig) (Destination, error) { return nil, nil })
+	defer func() {
+		delete(sourceConstructors, "DescribeTest")
+		delete(destinationConstructors, "DescribeTest")
+		delete(sourceConfigs, "DescribeTest")
+		delete(destinationConfigs, "DescribeTest")
+	}()
+
+	DescribeDestination("DescribeTest", AdapterConfig{SyncSet: describedSyncSet{}})
+
+	if !contains(SourceTypes(), "DescribeTest") || !contains(DestinationTypes(), "DescribeTest") {
+		t.Errorf("registered types are not listed: %v, %v", SourceTypes(), DestinationTypes())
+	}
+	if !contains(StateStoreTypes(), StateTypeFile) {
+		t.Errorf("StateStoreTypes() = %v, want the file type", StateStoreTypes())
+	}
+	if _, ok := DescribedSource("DescribeTest"); ok {
+		t.Error("DescribedSource() is ok for a source that has not been described")
+	}
+	config, ok := DescribedDestination("DescribeTest")
+	if !ok || len(config.SyncSetFields()) != 2 {
+		t.Errorf("DescribedDestination() = %v, %v", config, ok)
+	}
+}
+
+func TestFormatConfigFields(t *testing.T) {
+	fields := []ConfigField{{Name: "URL", Type: "string"}, {Name: "BatchSize", Type: "integer"}}
+	want := "  URL        string\n  BatchSize  integer\n"
+	if got := FormatConfigFields(fields); got != want {
+		t.Errorf("FormatConfigFields() = %q, want %q", got, want)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
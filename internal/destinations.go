@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// SyncSetDestination is one of the destinations that a sync set sends to, with the config and sync set to use for it
+type SyncSetDestination struct {
+	// Index is the position of the destination in DestinationConfigs
+	Index int
+
+	Config  AppConfig
+	SyncSet SyncSet
+}
+
+// DestinationConfigs returns the Destination, if it is configured, followed by the named Destinations
+func (a *AppConfig) DestinationConfigs() []DestinationConfig {
+	var configs []DestinationConfig
+	if a.Destination.Type != "" {
+		configs = append(configs, a.Destination)
+	}
+	return append(configs, a.Destinations...)
+}
+
+// forDestination returns the config with the Destination, and its AttributeMap if it has one
+func (a AppConfig) forDestination(destination DestinationConfig) AppConfig {
+	a.Destination = destination
+	if len(destination.AttributeMap) > 0 {
+		a.AttributeMap = destination.AttributeMap
+	}
+	return a
+}
+
+// SyncSetDestinations returns the destinations of a sync set: the Destination, if it is configured, and each of the
+// named Destinations in the sync set's Destinations. A sync set that has Destinations but no Destination is only
+// sent to its named destinations. A named destination runs as a sync set named "<sync set>/<destination>", so that
+// its state and plan are kept separately.
+func (a *AppConfig) SyncSetDestinations(syncSet SyncSet) []SyncSetDestination {
+	var destinations []SyncSetDestination
+	hasDestination := a.Destination.Type != ""
+	for i, destination := range a.DestinationConfigs() {
+		destinationSyncSet := syncSet
+		if i == 0 && hasDestination {
+			if len(syncSet.Destination) == 0 && len(syncSet.Destinations) > 0 {
+				continue
+			}
+		} else {
+			setJSON, ok := syncSet.Destinations[destination.Name]
+			if !ok {
+				continue
+			}
+			destinationSyncSet.Name = syncSet.Name + "/" + destination.Name
+			destinationSyncSet.Destination = setJSON
+		}
+		destinationSyncSet.Destinations = nil
+		destinations = append(destinations, SyncSetDestination{
+			Index:   i,
+			Config:  a.forDestination(destination),
+			SyncSet: destinationSyncSet,
+		})
+	}
+	return destinations
+}
+
+// allAttributeMaps returns the entries of the AttributeMap and of the AttributeMap of every destination
+func (a *AppConfig) allAttributeMaps() []AttributeMap {
+	attributeMaps := append([]AttributeMap{}, a.AttributeMap...)
+	for _, destination := range a.DestinationConfigs() {
+		attributeMaps = append(attributeMaps, destination.AttributeMap...)
+	}
+	return attributeMaps
+}
+
+// validateDestinations checks that there is a destination, that each named destination has a unique Name, and that
+// the sync sets only send to named destinations that exist
+func validateDestinations(config AppConfig) error {
+	if config.Destination.Type == "" && len(config.Destinations) == 0 {
+		return errors.New("configuration appears to be missing a Destination configuration")
+	}
+
+	names := map[string]bool{}
+	for i, destination := range config.Destinations {
+		if destination.Name == "" {
+			return fmt.Errorf("Destinations %v is missing a Name", i+1)
+		}
+		if names[destination.Name] {
+			return fmt.Errorf("there is more than one destination named %s", destination.Name)
+		}
+		if destination.Type == "" {
+			return fmt.Errorf("destination %s is missing a Type", destination.Name)
+		}
+		names[destination.Name] = true
+	}
+
+	for _, syncSet := range config.SyncSets {
+		for name := range syncSet.Destinations {
+			if !names[name] {
+				return fmt.Errorf("sync set %s sends to destination %s, which is not in Destinations", syncSet.Name,
+					name)
+			}
+		}
+	}
+	return nil
+}
+
+// sharedSource lists the people in a source once, with the attributes needed by all of a sync set's destinations,
+// and gives each destination its own copy of them
+type sharedSource struct {
+	Source
+	attributes []string
+
+	once   sync.Once
+	people []Person
+	err    error
+}
+
+// NewSharedSource returns a Source that lists the people in source once for a sync set, and returns them for every
+// destination. The source must already be set for the sync set with ForSet. The attributes are the source
+// attributes of the AttributeMap of every destination, and those used by the sync set Filter.
+func NewSharedSource(source Source, destinations []SyncSetDestination) Source {
+	var attributes []string
+	for _, destination := range destinations {
+		needed := appendFilterAttributes(sourceAttributes(destination.Config, true), destination.SyncSet)
+		for _, attribute := range needed {
+			if found, _ := InArray(attribute, attributes); !found {
+				attributes = append(attributes, attribute)
+			}
+		}
+	}
+	return &sharedSource{Source: source, attributes: attributes}
+}
+
+func (s *sharedSource) ListUsers(desiredAttrs []string) ([]Person, error) {
+	s.once.Do(func() {
+		s.people, s.err = s.Source.ListUsers(s.attributes)
+	})
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	people := make([]Person, len(s.people))
+	for i, person := range s.people {
+		people[i] = person
+		people[i].Attributes = make(map[string]string, len(person.Attributes))
+		for name, value := range person.Attributes {
+			people[i].Attributes[name] = value
+		}
+	}
+	return people, nil
+}
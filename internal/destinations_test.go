@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAppConfig_SyncSetDestinations(t *testing.T) {
+	groupsMap := []AttributeMap{{Source: "email", Destination: "email"}}
+	config := AppConfig{
+		Destination:  DestinationConfig{Type: "GoogleUsers"},
+		AttributeMap: []AttributeMap{{Source: "email", Destination: "primaryEmail"}},
+		Destinations: []DestinationConfig{
+			{Name: "groups", Type: "GoogleGroups", AttributeMap: groupsMap},
+			{Name: "helpdesk", Type: "WebHelpDesk"},
+		},
+	}
+
+	type want struct {
+		index   int
+		name    string
+		setJSON string
+	}
+	tests := []struct {
+		name    string
+		config  AppConfig
+		syncSet SyncSet
+		want    []want
+	}{
+		{
+			name:    "destination only",
+			config:  config,
+			syncSet: SyncSet{Name: "staff", Destination: json.RawMessage(`{"a":1}`)},
+			want:    []want{{index: 0, name: "staff", setJSON: `{"a":1}`}},
+		},
+		{
+			name:   "destination and named destinations",
+			config: config,
+			syncSet: SyncSet{Name: "staff", Destination: json.RawMessage(`{"a":1}`),
+				Destinations: map[string]json.RawMessage{"helpdesk": json.RawMessage(`{"c":3}`),
+					"groups": json.RawMessage(`{"b":2}`)}},
+			want: []want{
+				{index: 0, name: "staff", setJSON: `{"a":1}`},
+				{index: 1, name: "staff/groups", setJSON: `{"b":2}`},
+				{index: 2, name: "staff/helpdesk", setJSON: `{"c":3}`},
+			},
+		},
+		{
+			name:   "named destinations only",
+			config: config,
+			syncSet: SyncSet{Name: "staff",
+				Destinations: map[string]json.RawMessage{"helpdesk": json.RawMessage(`{"c":3}`)}},
+			want: []want{{index: 2, name: "staff/helpdesk", setJSON: `{"c":3}`}},
+		},
+		{
+			name:   "no Destination configured",
+			config: AppConfig{AttributeMap: config.AttributeMap, Destinations: config.Destinations},
+			syncSet: SyncSet{Name: "staff",
+				Destinations: map[string]json.RawMessage{"groups": json.RawMessage(`{"b":2}`)}},
+			want: []want{{index: 0, name: "staff/groups", setJSON: `{"b":2}`}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []want
+			for _, destination := range tt.config.SyncSetDestinations(tt.syncSet) {
+				got = append(got, want{index: destination.Index, name: destination.SyncSet.Name,
+					setJSON: string(destination.SyncSet.Destination)})
+
+				wantType := tt.config.DestinationConfigs()[destination.Index].Type
+				if destination.Config.Destination.Type != wantType {
+					t.Errorf("%s Destination Type = %s, want %s", destination.SyncSet.Name,
+						destination.Config.Destination.Type, wantType)
+				}
+				wantMap := tt.config.AttributeMap
+				if wantType == "GoogleGroups" {
+					wantMap = groupsMap
+				}
+				if !reflect.DeepEqual(destination.Config.AttributeMap, wantMap) {
+					t.Errorf("%s AttributeMap = %v, want %v", destination.SyncSet.Name,
+						destination.Config.AttributeMap, wantMap)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SyncSetDestinations() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDestinations(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  AppConfig
+		wantErr string
+	}{
+		{name: "destination", config: AppConfig{Destination: DestinationConfig{Type: "GoogleUsers"}}},
+		{name: "none", wantErr: "missing a Destination"},
+		{
+			name: "named",
+			config: AppConfig{
+				Destinations: []DestinationConfig{{Name: "groups", Type: "GoogleGroups"}},
+				SyncSets: []SyncSet{{Name: "staff",
+					Destinations: map[string]json.RawMessage{"groups": json.RawMessage(`{}`)}}},
+			},
+		},
+		{
+			name:    "missing name",
+			config:  AppConfig{Destinations: []DestinationConfig{{Type: "GoogleGroups"}}},
+			wantErr: "missing a Name",
+		},
+		{
+			name:    "missing type",
+			config:  AppConfig{Destinations: []DestinationConfig{{Name: "groups"}}},
+			wantErr: "missing a Type",
+		},
+		{
+			name: "duplicate name",
+			config: AppConfig{Destinations: []DestinationConfig{{Name: "groups", Type: "GoogleGroups"},
+				{Name: "groups", Type: "WebHelpDesk"}}},
+			wantErr: "more than one",
+		},
+		{
+			name: "unknown destination",
+			config: AppConfig{
+				Destinations: []DestinationConfig{{Name: "groups", Type: "GoogleGroups"}},
+				SyncSets: []SyncSet{{Name: "staff",
+					Destinations: map[string]json.RawMessage{"slack": json.RawMessage(`{}`)}}},
+			},
+			wantErr: "slack",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDestinations(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateDestinations() error = %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateDestinations() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// countingSource counts the times it is listed, and the attributes asked for
+type countingSource struct {
+	testSource
+	lists      int
+	attributes []string
+}
+
+func (s *countingSource) ListUsers(desiredAttrs []string) ([]Person, error) {
+	s.lists++
+	s.attributes = desiredAttrs
+	return s.testSource.ListUsers(desiredAttrs)
+}
+
+func TestNewSharedSource(t *testing.T) {
+	source := &countingSource{testSource: testSource{people: []Person{
+		{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com", "dept": "IT",
+			"phone": "555-1234"}},
+	}}}
+	config := AppConfig{
+		Destination:  DestinationConfig{Type: "users"},
+		AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}, {Source: "phone", Destination: "phone"}},
+		Destinations: []DestinationConfig{{Name: "groups", Type: "groups",
+			AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}, {Source: "dept", Destination: "group"}}}},
+	}
+	syncSet := SyncSet{Name: "staff", Destination: json.RawMessage(`{}`),
+		Destinations: map[string]json.RawMessage{"groups": json.RawMessage(`{}`)}}
+
+	runs := config.SyncSetDestinations(syncSet)
+	shared := NewSharedSource(source, runs)
+	destinations := []*testDestination{{}, {}}
+	for _, run := range runs {
+		err := RunSyncSet(log.New(ioutil.Discard, "", 0), shared, destinations[run.Index], run.Config, run.SyncSet, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if source.lists != 1 {
+		t.Errorf("source was listed %v times, want once", source.lists)
+	}
+	if want := []string{"email", "phone", "dept"}; !reflect.DeepEqual(source.attributes, want) {
+		t.Errorf("source attributes = %v, want %v", source.attributes, want)
+	}
+	wantCreated := []map[string]string{
+		{"email": "ann@example.com", "phone": "555-1234"},
+		{"email": "ann@example.com", "group": "IT"},
+	}
+	for i, destination := range destinations {
+		if len(destination.changes.Create) != 1 ||
+			!reflect.DeepEqual(destination.changes.Create[0].Attributes, wantCreated[i]) {
+			t.Errorf("destination %v created %+v, want %v", i, destination.changes.Create, wantCreated[i])
+		}
+	}
+	if len(source.people[0].Attributes) != 3 {
+		t.Errorf("the source people were changed: %v", source.people[0].Attributes)
+	}
+}
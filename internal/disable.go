@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"log"
+)
+
+// DisabledChanges are the numbers of planned changes that were not applied because their operation is disabled
+// for the destination with DisableAdd, DisableUpdate, or DisableDelete
+type DisabledChanges struct {
+	Create int
+	Update int
+	Delete int
+}
+
+// removeDisabledChanges returns the ChangeSet without the changes whose operation is disabled for the destination,
+// so that no destination makes them, whether or not its adapter checks the Disable flags itself
+func removeDisabledChanges(changeSet ChangeSet, destination DestinationConfig) (ChangeSet, DisabledChanges) {
+	var disabled DisabledChanges
+	if destination.DisableAdd {
+		disabled.Create = len(changeSet.Create)
+		changeSet.Create = nil
+	}
+	if destination.DisableUpdate {
+		disabled.Update = len(changeSet.Update)
+		changeSet.Update = nil
+	}
+	if destination.DisableDelete {
+		disabled.Delete = len(changeSet.Delete)
+		changeSet.Delete = nil
+	}
+	return changeSet, disabled
+}
+
+// printDisabled logs the number of changes of each disabled operation that are not applied
+func printDisabled(logger *log.Logger, disabled DisabledChanges) {
+	counts := []struct {
+		flag  string
+		count int
+		verb  string
+	}{
+		{"DisableAdd", disabled.Create, "created"},
+		{"DisableUpdate", disabled.Update, "updated"},
+		{"DisableDelete", disabled.Delete, "deleted"},
+	}
+	for _, c := range counts {
+		if c.count > 0 {
+			logger.Printf("    %v people are not %s because of %s\n", c.count, c.verb, c.flag)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestRunSyncSet_Disabled(t *testing.T) {
+	source := &testSource{people: []Person{
+		{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com", "name": "Ann"}},
+		{CompareValue: "bob@example.com", Attributes: map[string]string{"email": "bob@example.com", "name": "Bob"}},
+	}}
+
+	tests := []struct {
+		name        string
+		destination DestinationConfig
+		wantCreate  int
+		wantUpdate  int
+		wantDelete  int
+		wantLog     []string
+	}{
+		{name: "none disabled", wantCreate: 1, wantUpdate: 1, wantDelete: 1},
+		{
+			name:        "add disabled",
+			destination: DestinationConfig{DisableAdd: true},
+			wantUpdate:  1,
+			wantDelete:  1,
+			wantLog:     []string{"1 people are not created because of DisableAdd"},
+		},
+		{
+			name:        "all disabled",
+			destination: DestinationConfig{DisableAdd: true, DisableUpdate: true, DisableDelete: true},
+			wantLog: []string{
+				"1 people are not created because of DisableAdd",
+				"1 people are not updated because of DisableUpdate",
+				"1 people are not deleted because of DisableDelete",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination := &testDestination{people: []Person{
+				{CompareValue: "bob@example.com", Attributes: map[string]string{"email": "bob@example.com", "name": "B"}},
+				{CompareValue: "cat@example.com", Attributes: map[string]string{"email": "cat@example.com", "name": "Cat"}},
+			}}
+			config := AppConfig{
+				Destination: tt.destination,
+				AttributeMap: []AttributeMap{
+					{Source: "email", Destination: "email"},
+					{Source: "name", Destination: "name"},
+				},
+			}
+
+			var buf bytes.Buffer
+			err := RunSyncSet(log.New(&buf, "", 0), source, destination, config, SyncSet{Name: "staff"}, nil)
+			if err != nil {
+				t.Fatalf("RunSyncSet() error = %s", err)
+			}
+
+			changes := destination.changes
+			if len(changes.Create) != tt.wantCreate || len(changes.Update) != tt.wantUpdate ||
+				len(changes.Delete) != tt.wantDelete {
+				t.Errorf("ApplyChangeSet() got %v creates, %v updates, %v deletes, want %v, %v, %v",
+					len(changes.Create), len(changes.Update), len(changes.Delete),
+					tt.wantCreate, tt.wantUpdate, tt.wantDelete)
+			}
+			for _, want := range tt.wantLog {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("RunSyncSet() log does not contain %q:\n%s", want, buf.String())
+				}
+			}
+			if len(tt.wantLog) == 0 && strings.Contains(buf.String(), "because of Disable") {
+				t.Errorf("RunSyncSet() logged disabled changes:\n%s", buf.String())
+			}
+		})
+	}
+}
+
+func TestRunSyncSet_DisabledDryRun(t *testing.T) {
+	source := &testSource{people: []Person{
+		{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com"}},
+	}}
+	destination := &testDestination{people: []Person{
+		{CompareValue: "cat@example.com", Attributes: map[string]string{"email": "cat@example.com"}},
+	}}
+	config := AppConfig{
+		Destination:  DestinationConfig{DisableAdd: true},
+		AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}},
+		Runtime:      RuntimeConfig{DryRunMode: true},
+	}
+
+	var buf bytes.Buffer
+	err := RunSyncSet(log.New(&buf, "", 0), source, destination, config, SyncSet{Name: "staff"}, nil)
+	if err != nil {
+		t.Fatalf("RunSyncSet() error = %s", err)
+	}
+	for _, want := range []string{"1 people are not created because of DisableAdd",
+		"ChangeSet Plans: Create 0, Update 0, Delete 1"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("RunSyncSet() log does not contain %q:\n%s", want, buf.String())
+		}
+	}
+}
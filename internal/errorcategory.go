@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrorCategory is a broad classification of an error, used for alerting and metrics
+type ErrorCategory string
+
+const (
+	ErrorCategoryAuth       = ErrorCategory("auth")
+	ErrorCategoryQuota      = ErrorCategory("quota")
+	ErrorCategoryValidation = ErrorCategory("validation")
+	ErrorCategoryConflict   = ErrorCategory("conflict")
+	ErrorCategoryNetwork    = ErrorCategory("network")
+	ErrorCategoryUnknown    = ErrorCategory("unknown")
+)
+
+// ErrorCategories lists all error categories
+var ErrorCategories = []ErrorCategory{
+	ErrorCategoryAuth,
+	ErrorCategoryQuota,
+	ErrorCategoryValidation,
+	ErrorCategoryConflict,
+	ErrorCategoryNetwork,
+	ErrorCategoryUnknown,
+}
+
+// statusPattern finds an HTTP status code in error messages such as "status: 403" or "Error 403: ..."
+var statusPattern = regexp.MustCompile(`(?i)(?:status(?: ?code)?[:=]?\s*|error\s+)([1-5]\d\d)\b`)
+
+var categoryKeywords = []struct {
+	category ErrorCategory
+	keywords []string
+}{
+	{ErrorCategoryQuota, []string{"quota", "rate limit", "rate limited", "ratelimit", "too many requests",
+		"throttle", "throttled", "throttling"}},
+	{ErrorCategoryAuth, []string{"unauthorized", "forbidden", "not authorized", "invalid_grant", "invalid_client",
+		"permission", "permissions", "access denied", "authentication"}},
+	{ErrorCategoryNetwork, []string{"timeout", "timed out", "connection refused", "connection reset", "no such host",
+		"network is unreachable", "eof", "tls handshake"}},
+	{ErrorCategoryConflict, []string{"already exist", "already exists", "conflict", "conflicts", "duplicate",
+		"duplicated"}},
+	{ErrorCategoryValidation, []string{"invalid", "required", "missing", "bad request", "not found", "too long",
+		"unable to convert", "unable to marshal"}},
+}
+
+// categoryPatterns match the categoryKeywords as whole words, so that "eof" does not match an email address such as
+// "geoffrey@example.org"
+var categoryPatterns = func() []*regexp.Regexp {
+	patterns := make([]*regexp.Regexp, len(categoryKeywords))
+	for i, c := range categoryKeywords {
+		quoted := make([]string, len(c.keywords))
+		for j, keyword := range c.keywords {
+			quoted[j] = regexp.QuoteMeta(keyword)
+		}
+		patterns[i] = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	}
+	return patterns
+}()
+
+// ClassifyHTTPStatus returns the category of an HTTP error status code
+func ClassifyHTTPStatus(statusCode int) ErrorCategory {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrorCategoryAuth
+	case statusCode == http.StatusTooManyRequests:
+		return ErrorCategoryQuota
+	case statusCode == http.StatusConflict || statusCode == http.StatusPreconditionFailed:
+		return ErrorCategoryConflict
+	case statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable ||
+		statusCode == http.StatusGatewayTimeout || statusCode == http.StatusRequestTimeout:
+		return ErrorCategoryNetwork
+	case statusCode >= 400 && statusCode < 500:
+		return ErrorCategoryValidation
+	}
+	return ErrorCategoryUnknown
+}
+
+// ClassifyError returns the category of an error, based on its type, such as a RateLimitError, or, failing that,
+// its message
+func ClassifyError(err error) ErrorCategory {
+	if err == nil {
+		return ""
+	}
+	if category := classifyErrorType(err); category != "" {
+		return category
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrorCategoryNetwork
+	}
+	return ClassifyMessage(err.Error())
+}
+
+// ClassifyMessage returns the category of an error message, using any HTTP status code it contains or common
+// phrases found in error messages
+func ClassifyMessage(message string) ErrorCategory {
+	if match := statusPattern.FindStringSubmatch(message); match != nil {
+		status, _ := strconv.Atoi(match[1])
+		if category := ClassifyHTTPStatus(status); category != ErrorCategoryUnknown {
+			return category
+		}
+	}
+
+	for i, pattern := range categoryPatterns {
+		if pattern.MatchString(message) {
+			return categoryKeywords[i].category
+		}
+	}
+	return ErrorCategoryUnknown
+}
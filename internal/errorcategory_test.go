@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"log/syslog"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCategory
+	}{
+		{name: "nil", err: nil, want: ""},
+		{name: "google api", err: errors.New("googleapi: Error 403: Not Authorized to access this resource/api, forbidden"), want: ErrorCategoryAuth},
+		{name: "webhelpdesk status", err: errors.New("error returned from API. status: 400, body: {}"), want: ErrorCategoryValidation},
+		{name: "rate limited", err: errors.New("error returned from API. status: 429, body: slow down"), want: ErrorCategoryQuota},
+		{name: "quota text", err: errors.New("Quota exceeded for quota metric"), want: ErrorCategoryQuota},
+		{name: "conflict status", err: errors.New("googleapi: Error 409: Member already exists., duplicate"), want: ErrorCategoryConflict},
+		{name: "net error", err: fmt.Errorf("request failed: %w", &net.DNSError{Err: "no such host", Name: "example.invalid"}), want: ErrorCategoryNetwork},
+		{name: "timeout text", err: errors.New("Get https://example.com: context deadline exceeded (Client.Timeout exceeded)"), want: ErrorCategoryNetwork},
+		{name: "invalid", err: errors.New("invalid id \"abc\""), want: ErrorCategoryValidation},
+		{name: "unknown", err: errors.New("something odd happened"), want: ErrorCategoryUnknown},
+		{name: "keyword in a word", err: errors.New("no match for geoffrey@example.org"), want: ErrorCategoryUnknown},
+		{name: "unexpected eof", err: errors.New("read body: unexpected EOF"), want: ErrorCategoryNetwork},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessEventLog_ErrorCounts(t *testing.T) {
+	eventLog := make(chan EventLogItem, 10)
+	eventLog <- EventLogItem{Level: syslog.LOG_INFO, Message: "AddMember a@example.com"}
+	eventLog <- EventLogItem{Level: syslog.LOG_ERR, Message: "googleapi: Error 401: Login Required"}
+	eventLog <- EventLogItem{Level: syslog.LOG_ERR, Message: "bad value", Category: ErrorCategoryValidation}
+	eventLog <- EventLogItem{Level: syslog.LOG_ERR, Message: "status: 400"}
+	eventLog <- EventLogItem{Level: syslog.LOG_ERR, Message: "UpdateUser quota.admin@example.org: connection refused",
+		Error: "connection refused"}
+	close(eventLog)
+
+	got, _ := processEventLog(log.New(ioutil.Discard, "", 0), AppConfig{}, "staff", nil, nil, eventLog).split()
+	want := map[ErrorCategory]uint64{ErrorCategoryAuth: 1, ErrorCategoryNetwork: 1, ErrorCategoryValidation: 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("processEventLog() = %v, want %v", got, want)
+	}
+	if s := formatErrorCounts(got); s != "auth: 1, validation: 2, network: 1" {
+		t.Errorf("formatErrorCounts() = %q", s)
+	}
+}
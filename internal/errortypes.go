@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimitError is returned by an adapter when the API refused a request because too many were made. The request
+// may succeed if it is made again after RetryAfter, or after a backoff if RetryAfter is zero.
+type RateLimitError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string { return e.Err.Error() }
+func (e *RateLimitError) Unwrap() error { return e.Err }
+
+// NotFoundError is returned by an adapter when a person, group, or other resource that a request refers to does not
+// exist
+type NotFoundError struct {
+	Err error
+}
+
+func (e *NotFoundError) Error() string { return e.Err.Error() }
+func (e *NotFoundError) Unwrap() error { return e.Err }
+
+// ValidationError is returned by an adapter when the API rejected the data in a request, so the request would fail
+// again if it were retried
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// AuthError is returned by an adapter when its credentials were rejected, or do not allow the request
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string { return e.Err.Error() }
+func (e *AuthError) Unwrap() error { return e.Err }
+
+// NewStatusError returns err as the error type for an HTTP status code: a RateLimitError for 429, using the
+// Retry-After header value given in seconds, an AuthError for 401 and 403, a NotFoundError for 404, and a
+// ValidationError for 400 and 422. For any other status code, err is returned as it is.
+func NewStatusError(statusCode int, retryAfter string, err error) error {
+	switch statusCode {
+	case http.StatusTooManyRequests:
+		rateLimitErr := &RateLimitError{Err: err}
+		if seconds, parseErr := strconv.Atoi(retryAfter); parseErr == nil && seconds > 0 {
+			rateLimitErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return rateLimitErr
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &AuthError{Err: err}
+	case http.StatusNotFound:
+		return &NotFoundError{Err: err}
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return &ValidationError{Err: err}
+	}
+	return err
+}
+
+// classifyErrorType returns the category of one of the error types, or "" if err is not one of them
+func classifyErrorType(err error) ErrorCategory {
+	var rateLimitErr *RateLimitError
+	var authErr *AuthError
+	var notFoundErr *NotFoundError
+	var validationErr *ValidationError
+	switch {
+	case errors.As(err, &rateLimitErr):
+		return ErrorCategoryQuota
+	case errors.As(err, &authErr):
+		return ErrorCategoryAuth
+	case errors.As(err, &notFoundErr), errors.As(err, &validationErr):
+		return ErrorCategoryValidation
+	}
+	return ""
+}
+
+// IsRateLimited returns true if err is a RateLimitError, and how long to wait before trying again, which is zero
+// if the API did not say
+func IsRateLimited(err error) (bool, time.Duration) {
+	var rateLimitErr *RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return true, rateLimitErr.RetryAfter
+	}
+	return false, 0
+}
+
+// DoWithRetry calls fn until it does not return a RateLimitError, up to MaxAttempts times in total, waiting between
+// attempts as the API asked or with backoff. If the API asks to wait longer than MaxDelayMillisec, it does not retry
+// any sooner. It returns the error of the last attempt.
+func (r RetryConfig) DoWithRetry(fn func() error) error {
+	r = r.withDefaults()
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		limited, retryAfter := IsRateLimited(err)
+		if !limited || attempt+1 >= r.MaxAttempts {
+			return err
+		}
+		if r.ExceedsMaxDelay(retryAfter) {
+			return err
+		}
+		if retryAfter == 0 {
+			retryAfter = r.Delay(attempt, "")
+		}
+		r.Clock.Sleep(retryAfter)
+	}
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewStatusError(t *testing.T) {
+	cause := errors.New("request failed")
+	tests := []struct {
+		name         string
+		statusCode   int
+		retryAfter   string
+		wantCategory ErrorCategory
+		wantLimited  bool
+		wantAfter    time.Duration
+	}{
+		{name: "rate limit", statusCode: http.StatusTooManyRequests, retryAfter: "30",
+			wantCategory: ErrorCategoryQuota, wantLimited: true, wantAfter: 30 * time.Second},
+		{name: "rate limit without Retry-After", statusCode: http.StatusTooManyRequests,
+			wantCategory: ErrorCategoryQuota, wantLimited: true},
+		{name: "unauthorized", statusCode: http.StatusUnauthorized, wantCategory: ErrorCategoryAuth},
+		{name: "forbidden", statusCode: http.StatusForbidden, wantCategory: ErrorCategoryAuth},
+		{name: "not found", statusCode: http.StatusNotFound, wantCategory: ErrorCategoryValidation},
+		{name: "bad request", statusCode: http.StatusBadRequest, wantCategory: ErrorCategoryValidation},
+		{name: "server error", statusCode: http.StatusInternalServerError, wantCategory: ErrorCategoryUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewStatusError(tt.statusCode, tt.retryAfter, cause)
+			if err.Error() != cause.Error() {
+				t.Errorf("NewStatusError() message = %q, want %q", err, cause)
+			}
+			if !errors.Is(err, cause) {
+				t.Error("NewStatusError() does not unwrap to the cause")
+			}
+			if got := ClassifyError(fmt.Errorf("unable to list: %w", err)); got != tt.wantCategory {
+				t.Errorf("ClassifyError() = %s, want %s", got, tt.wantCategory)
+			}
+			limited, after := IsRateLimited(err)
+			if limited != tt.wantLimited || after != tt.wantAfter {
+				t.Errorf("IsRateLimited() = %v, %s, want %v, %s", limited, after, tt.wantLimited, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestRetryConfig_DoWithRetry(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	attempts := 0
+	err := RetryConfig{Clock: clock}.DoWithRetry(func() error {
+		attempts++
+		if attempts < 3 {
+			return &RateLimitError{Err: errors.New("rate limited"), RetryAfter: 10 * time.Second}
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("DoWithRetry() = %v after %d attempts, want no error after 3", err, attempts)
+	}
+	if clock.Slept() != 20*time.Second {
+		t.Errorf("DoWithRetry() waited %s, want 20s", clock.Slept())
+	}
+
+	attempts = 0
+	notFound := &NotFoundError{Err: errors.New("not found")}
+	err = RetryConfig{Clock: clock}.DoWithRetry(func() error {
+		attempts++
+		return notFound
+	})
+	if err != notFound || attempts != 1 {
+		t.Errorf("DoWithRetry() = %v after %d attempts, want the NotFoundError after 1", err, attempts)
+	}
+
+	attempts = 0
+	err = RetryConfig{Clock: clock, MaxAttempts: 2}.DoWithRetry(func() error {
+		attempts++
+		return &RateLimitError{Err: errors.New("rate limited")}
+	})
+	if _, ok := err.(*RateLimitError); !ok || attempts != 2 {
+		t.Errorf("DoWithRetry() = %v after %d attempts, want a RateLimitError after 2", err, attempts)
+	}
+
+	attempts = 0
+	slept := clock.Slept()
+	err = RetryConfig{Clock: clock, MaxDelayMillisec: 1000}.DoWithRetry(func() error {
+		attempts++
+		return &RateLimitError{Err: errors.New("rate limited"), RetryAfter: time.Hour}
+	})
+	if _, ok := err.(*RateLimitError); !ok || attempts != 1 || clock.Slept() != slept {
+		t.Errorf("DoWithRetry() = %v after %d attempts, want a RateLimitError after 1 without waiting", err, attempts)
+	}
+}
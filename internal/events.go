@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"strings"
+)
+
+// The formats of the event log of a sync set, set by the Runtime EventLogFormat
+const (
+	EventLogFormatText = "text"
+	EventLogFormatJSON = "json"
+)
+
+// validateEventLogFormat checks that the EventLogFormat is empty, text, or json
+func validateEventLogFormat(format string) error {
+	switch format {
+	case "", EventLogFormatText, EventLogFormatJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid EventLogFormat %q, must be %s or %s", format, EventLogFormatText, EventLogFormatJSON)
+}
+
+// ChangeEvent returns an informational event for a change to a person, with a Message such as
+// "AddMember ann@example.org"
+func ChangeEvent(operation, compareValue string) EventLogItem {
+	return EventLogItem{
+		Level:              syslog.LOG_INFO,
+		Message:            operation + " " + compareValue,
+		Operation:          operation,
+		PersonCompareValue: compareValue,
+	}
+}
+
+// UpdateEvent returns an informational event for an update of the person, with the Message of UpdateMessage. name
+// is how the destination knows the person, such as their email address.
+func UpdateEvent(operation, name string, person Person) EventLogItem {
+	return EventLogItem{
+		Level:              syslog.LOG_INFO,
+		Message:            UpdateMessage(operation, name, person),
+		Operation:          operation,
+		PersonCompareValue: person.CompareValue,
+	}
+}
+
+// ChangeErrorEvent returns an error event for a change to a person that failed, with the Message
+// "<message>: <err>", and the Category of the error
+func ChangeErrorEvent(operation, compareValue, message string, err error) EventLogItem {
+	return EventLogItem{
+		Level:              syslog.LOG_ERR,
+		Message:            message + ": " + err.Error(),
+		Category:           ClassifyError(err),
+		Operation:          operation,
+		PersonCompareValue: compareValue,
+		Error:              err.Error(),
+	}
+}
+
+// JSON returns the event as one line of JSON, with the name of its Level, for processing by other programs
+func (l EventLogItem) JSON() string {
+	data, _ := json.Marshal(struct {
+		Level              string
+		Category           ErrorCategory `json:",omitempty"`
+		SyncSet            string        `json:",omitempty"`
+		Destination        string        `json:",omitempty"`
+		Operation          string        `json:",omitempty"`
+		PersonCompareValue string        `json:",omitempty"`
+		Error              string        `json:",omitempty"`
+		Message            string
+	}{
+		Level:              LogLevels[l.Level],
+		Category:           l.Category,
+		SyncSet:            l.SyncSet,
+		Destination:        l.Destination,
+		Operation:          l.Operation,
+		PersonCompareValue: l.PersonCompareValue,
+		Error:              l.Error,
+		Message:            l.Message,
+	})
+	return string(data)
+}
+
+// describeEvent sets the SyncSet and Destination of an event, if they are not set, and the Operation of an
+// informational event from the first word of its Message
+func describeEvent(item EventLogItem, syncSetName string, destination DestinationConfig) EventLogItem {
+	if item.SyncSet == "" {
+		item.SyncSet = syncSetName
+	}
+	if item.Destination == "" {
+		item.Destination = destination.Name
+		if item.Destination == "" {
+			item.Destination = destination.Type
+		}
+	}
+	if item.Operation == "" && item.Level == syslog.LOG_INFO {
+		item.Operation = messageOperation(item.Message)
+	}
+	return item
+}
+
+// messageOperation returns the first word of an event message, such as AddMember or CreateUser
+func messageOperation(message string) string {
+	if i := strings.IndexByte(message, ' '); i > 0 {
+		return message[:i]
+	}
+	return message
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"log/syslog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProcessEventLog_Structured(t *testing.T) {
+	events := []EventLogItem{
+		ChangeEvent("AddMember", "a@example.com"),
+		{Level: syslog.LOG_INFO, Message: "RemoveMember b@example.com"},
+		ChangeErrorEvent("AddMember", "c@example.com", "unable to insert c@example.com",
+			&AuthError{Err: errors.New("403 forbidden")}),
+	}
+
+	tests := []struct {
+		name   string
+		config AppConfig
+		want   []string
+	}{
+		{
+			name:   "text",
+			config: AppConfig{Destination: DestinationConfig{Type: DestinationTypeGoogleGroups}},
+			want: []string{
+				"Info: AddMember a@example.com",
+				"Info: RemoveMember b@example.com",
+				"Error (auth): unable to insert c@example.com: 403 forbidden",
+			},
+		},
+		{
+			name: "json",
+			config: AppConfig{
+				Runtime:     RuntimeConfig{EventLogFormat: EventLogFormatJSON},
+				Destination: DestinationConfig{Type: DestinationTypeGoogleGroups, Name: "groups"},
+			},
+			want: []string{
+				`{"Level":"Info","SyncSet":"staff","Destination":"groups","Operation":"AddMember",` +
+					`"PersonCompareValue":"a@example.com","Message":"AddMember a@example.com"}`,
+				`{"Level":"Info","SyncSet":"staff","Destination":"groups","Operation":"RemoveMember",` +
+					`"Message":"RemoveMember b@example.com"}`,
+				`{"Level":"Error","Category":"auth","SyncSet":"staff","Destination":"groups","Operation":"AddMember",` +
+					`"PersonCompareValue":"c@example.com","Error":"403 forbidden",` +
+					`"Message":"unable to insert c@example.com: 403 forbidden"}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventLog := make(chan EventLogItem, len(events))
+			for _, event := range events {
+				eventLog <- event
+			}
+			close(eventLog)
+
+			var buf bytes.Buffer
+			processEventLog(log.New(&buf, "", 0), tt.config, "staff", nil, nil, eventLog)
+			got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("processEventLog() logged\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestDescribeEvent(t *testing.T) {
+	destination := DestinationConfig{Type: DestinationTypeGoogleGroups}
+	tests := []struct {
+		name  string
+		event EventLogItem
+		want  EventLogItem
+	}{
+		{
+			name:  "operation from message",
+			event: EventLogItem{Level: syslog.LOG_INFO, Message: "CreateUser ann@example.org"},
+			want: EventLogItem{Level: syslog.LOG_INFO, Message: "CreateUser ann@example.org", SyncSet: "staff",
+				Destination: DestinationTypeGoogleGroups, Operation: "CreateUser"},
+		},
+		{
+			name:  "error without operation",
+			event: EventLogItem{Level: syslog.LOG_ERR, Message: "unable to list users"},
+			want: EventLogItem{Level: syslog.LOG_ERR, Message: "unable to list users", SyncSet: "staff",
+				Destination: DestinationTypeGoogleGroups},
+		},
+		{
+			name:  "fields already set",
+			event: EventLogItem{Level: syslog.LOG_INFO, Message: "x", SyncSet: "s", Destination: "d", Operation: "o"},
+			want:  EventLogItem{Level: syslog.LOG_INFO, Message: "x", SyncSet: "s", Destination: "d", Operation: "o"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeEvent(tt.event, "staff", destination); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("describeEvent() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
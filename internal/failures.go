@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FailureThresholds are the numbers of failed creates, updates, and deletes in a sync set at which the run fails,
+// so that the process exits with an error. A change is counted as failed when the destination reports an error
+// for it. Zero, the default, never fails the run.
+type FailureThresholds struct {
+	Create int
+	Update int
+	Delete int
+}
+
+// FailureThresholdError is returned for a sync set in which the failures of an operation reached its threshold
+type FailureThresholdError struct {
+	SyncSet   string
+	Operation string
+	Failures  int
+	Threshold int
+}
+
+func (e *FailureThresholdError) Error() string {
+	return fmt.Sprintf("%v %s failures in sync set %s reached the threshold of %v", e.Failures, e.Operation,
+		e.SyncSet, e.Threshold)
+}
+
+// checkFailureThresholds returns a FailureThresholdError for the first operation whose failures, counted from the
+// errors in the event log, reached its threshold. Planned changes that a destination leaves alone without an error,
+// such as deletes in Google Users without OnDelete, are not failures.
+func checkFailureThresholds(config AppConfig, syncSetName string, results ChangeResults) error {
+	thresholds := config.Runtime.FailureThresholds
+	checks := []struct {
+		operation string
+		threshold int
+	}{
+		{OperationCreate, thresholds.Create},
+		{OperationUpdate, thresholds.Update},
+		{OperationDelete, thresholds.Delete},
+	}
+	for _, c := range checks {
+		if c.threshold <= 0 {
+			continue
+		}
+		if failures := int(results.Failures[c.operation]); failures >= c.threshold {
+			return &FailureThresholdError{SyncSet: syncSetName, Operation: c.operation, Failures: failures,
+				Threshold: c.threshold}
+		}
+	}
+	return nil
+}
+
+// eventCounts are the numbers of errors in an event log, by category and by the operation that failed
+type eventCounts struct {
+	errors   map[ErrorCategory]uint64
+	failures map[string]uint64
+
+	// texts are the person, message, and error of each error event in lower case, to find whose change failed
+	texts []string
+}
+
+// addError counts an error event in its Category, and in the operation that failed, if known
+func (c *eventCounts) addError(item EventLogItem) {
+	if c.errors == nil {
+		c.errors = map[ErrorCategory]uint64{}
+	}
+	c.errors[item.Category]++
+	c.texts = append(c.texts, strings.ToLower(item.PersonCompareValue+" "+item.Message+" "+item.Error))
+
+	if operation := errorOperation(item); operation != "" {
+		if c.failures == nil {
+			c.failures = map[string]uint64{}
+		}
+		c.failures[operation]++
+	}
+}
+
+// failed returns true if an error event names the person's compare value
+func (c eventCounts) failed(person Person) bool {
+	if person.CompareValue == "" {
+		return false
+	}
+	compareValue := strings.ToLower(person.CompareValue)
+	for _, text := range c.texts {
+		if strings.Contains(text, compareValue) {
+			return true
+		}
+	}
+	return false
+}
+
+// split returns the error counts by category and by operation
+func (c eventCounts) split() (map[ErrorCategory]uint64, map[string]uint64) {
+	return c.errors, c.failures
+}
+
+// operationWords are the words of operations and error messages that name the operation that failed
+var operationWords = map[string]string{
+	"add":         OperationCreate,
+	"create":      OperationCreate,
+	"insert":      OperationCreate,
+	"invite":      OperationCreate,
+	"subscribe":   OperationCreate,
+	"update":      OperationUpdate,
+	"change":      OperationUpdate,
+	"patch":       OperationUpdate,
+	"delete":      OperationDelete,
+	"remove":      OperationDelete,
+	"deactivate":  OperationDelete,
+	"suspend":     OperationDelete,
+	"archive":     OperationDelete,
+	"unsubscribe": OperationDelete,
+}
+
+// errorOperation returns the operation of an error event, from its Operation, such as AddMember, or otherwise from
+// the first word of its Message that names an operation, such as "unable to insert ...". It returns "" if the
+// error cannot be attributed to an operation.
+func errorOperation(item EventLogItem) string {
+	if item.Operation != "" {
+		operation := strings.ToLower(item.Operation)
+		for word, op := range operationWords {
+			if strings.HasPrefix(operation, word) {
+				return op
+			}
+		}
+		return ""
+	}
+	for _, word := range strings.Fields(strings.ToLower(item.Message)) {
+		if op, ok := operationWords[word]; ok {
+			return op
+		}
+	}
+	return ""
+}
@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+func TestRunSyncSet_FailureThresholds(t *testing.T) {
+	source := &testSource{people: []Person{
+		{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com"}},
+		{CompareValue: "bob@example.com", Attributes: map[string]string{"email": "bob@example.com"}},
+	}}
+	failing := &eventDestination{fail: "bob@example.com"}
+
+	tests := []struct {
+		name        string
+		destination Destination
+		thresholds  FailureThresholds
+		disableAdd  bool
+		wantErr     bool
+	}{
+		{name: "no thresholds"},
+		{name: "create threshold reached", thresholds: FailureThresholds{Create: 1}, wantErr: true},
+		{name: "create threshold not reached", thresholds: FailureThresholds{Create: 2}},
+		{name: "other thresholds", thresholds: FailureThresholds{Update: 1, Delete: 1}},
+		{name: "creates disabled", thresholds: FailureThresholds{Create: 1}, disableAdd: true},
+		{name: "creates left alone without errors", destination: &ignoringDestination{},
+			thresholds: FailureThresholds{Create: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := AppConfig{
+				Runtime:      RuntimeConfig{FailureThresholds: tt.thresholds},
+				Destination:  DestinationConfig{DisableAdd: tt.disableAdd},
+				AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}},
+			}
+			destination := tt.destination
+			if destination == nil {
+				destination = failing
+			}
+			err := RunSyncSet(log.New(ioutil.Discard, "", 0), source, destination, config, SyncSet{Name: "staff"}, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunSyncSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var thresholdErr *FailureThresholdError
+			if tt.wantErr && (!errors.As(err, &thresholdErr) || thresholdErr.Operation != OperationCreate ||
+				thresholdErr.Failures != 1) {
+				t.Errorf("RunSyncSet() error = %#v, want a FailureThresholdError for 1 create", err)
+			}
+		})
+	}
+}
+
+// ignoringDestination makes none of the planned changes, without reporting any errors, like a destination that does
+// not support an operation
+type ignoringDestination struct {
+	testDestination
+}
+
+func (d *ignoringDestination) ApplyChangeSet(changes ChangeSet, eventLog chan<- EventLogItem) ChangeResults {
+	return ChangeResults{}
+}
+
+func TestErrorOperation(t *testing.T) {
+	tests := []struct {
+		name string
+		item EventLogItem
+		want string
+	}{
+		{name: "operation", item: EventLogItem{Operation: "AddMember", Message: "unable to do it"},
+			want: OperationCreate},
+		{name: "unknown operation", item: EventLogItem{Operation: "Licence", Message: "unable to add"}},
+		{name: "insert", item: EventLogItem{Message: "unable to insert a@example.com in Google group g"},
+			want: OperationCreate},
+		{name: "change", item: EventLogItem{Message: "unable to change role of a@example.com"},
+			want: OperationUpdate},
+		{name: "deactivate", item: EventLogItem{Message: "unable to deactivate user a@example.com"},
+			want: OperationDelete},
+		{name: "word in an email address", item: EventLogItem{Message: "unable to get removed@example.com"}},
+		{name: "no operation", item: EventLogItem{Message: "unable to list users"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorOperation(tt.item); got != tt.want {
+				t.Errorf("errorOperation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
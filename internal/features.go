@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// Features turns new behaviors on or off by name, so they can be rolled out per deployment and per sync set
+// before they become the default. A feature that is not listed is off.
+type Features map[string]bool
+
+// FeaturePartialUpdates makes destinations that support it update only the attributes that changed, rather than
+// all of the attributes in the AttributeMap
+const FeaturePartialUpdates = "PartialUpdates"
+
+// knownFeatures describes each feature that can be enabled
+var knownFeatures = map[string]string{}
+
+func init() {
+	RegisterFeature(FeaturePartialUpdates, "update only the attributes that changed")
+}
+
+// RegisterFeature makes a feature known, so that it is not reported as unrecognized in the config
+func RegisterFeature(name, description string) {
+	knownFeatures[name] = description
+}
+
+// Enabled returns true if the feature is turned on
+func (f Features) Enabled(name string) bool {
+	return f[name]
+}
+
+// merge returns the features with the overrides applied
+func (f Features) merge(overrides Features) Features {
+	if len(overrides) == 0 {
+		return f
+	}
+	merged := Features{}
+	for name, enabled := range f {
+		merged[name] = enabled
+	}
+	for name, enabled := range overrides {
+		merged[name] = enabled
+	}
+	return merged
+}
+
+// unknown returns the names of the features that are not registered, in order
+func (f Features) unknown() []string {
+	var names []string
+	for name := range f {
+		if _, ok := knownFeatures[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FeatureEnabled returns true if the feature is turned on. While a sync set is run, its own Features take
+// precedence over the Runtime Features.
+func (c AppConfig) FeatureEnabled(name string) bool {
+	return c.Runtime.Features.Enabled(name)
+}
+
+// forSyncSet returns the config with the sync set's Features applied
+func (c AppConfig) forSyncSet(syncSet SyncSet) AppConfig {
+	c.Runtime.Features = c.Runtime.Features.merge(syncSet.Features)
+	if syncSet.CompareNormalizers != nil {
+		c.Compare.Normalizers = syncSet.CompareNormalizers
+	}
+	return c
+}
+
+// destinationSupports returns true if the destination type is described as implementing the feature
+func destinationSupports(destinationType, feature string) bool {
+	for _, name := range destinationConfigs[destinationType].Features {
+		if name == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// validateFeatures checks that the destinations of each sync set that has PartialUpdates enabled implement it, so
+// that the others do not quietly send full updates
+func validateFeatures(config AppConfig) error {
+	for _, syncSet := range config.SyncSets {
+		if !config.forSyncSet(syncSet).FeatureEnabled(FeaturePartialUpdates) {
+			continue
+		}
+		for _, destination := range config.SyncSetDestinations(syncSet) {
+			destinationType := destination.Config.Destination.Type
+			if !destinationSupports(destinationType, FeaturePartialUpdates) {
+				return fmt.Errorf("sync set %s: the %s destination does not support the %s feature", syncSet.Name,
+					destinationType, FeaturePartialUpdates)
+			}
+		}
+	}
+	return nil
+}
+
+// warnUnknownFeatures logs the features in the config that are not recognized, which may be misspelled or may be
+// for a different version
+func warnUnknownFeatures(config AppConfig) {
+	for _, name := range config.Runtime.Features.unknown() {
+		log.Printf("unrecognized feature %q in Runtime Features is ignored", name)
+	}
+	for _, syncSet := range config.SyncSets {
+		for _, name := range syncSet.Features.unknown() {
+			log.Printf("unrecognized feature %q in Features of sync set %s is ignored", name, syncSet.Name)
+		}
+	}
+}
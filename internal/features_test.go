@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestAppConfig_forSyncSet(t *testing.T) {
+	RegisterFeature("TestFeatureA", "a feature for testing")
+	RegisterFeature("TestFeatureB", "another feature for testing")
+
+	config := AppConfig{Runtime: RuntimeConfig{Features: Features{"TestFeatureA": true}}}
+	syncSet := SyncSet{Name: "set", Features: Features{"TestFeatureA": false, "TestFeatureB": true}}
+
+	if !config.FeatureEnabled("TestFeatureA") || config.FeatureEnabled("TestFeatureB") {
+		t.Errorf("Runtime Features = %v, want only TestFeatureA enabled", config.Runtime.Features)
+	}
+
+	setConfig := config.forSyncSet(syncSet)
+	if setConfig.FeatureEnabled("TestFeatureA") || !setConfig.FeatureEnabled("TestFeatureB") {
+		t.Errorf("sync set Features = %v, want only TestFeatureB enabled", setConfig.Runtime.Features)
+	}
+	if !config.FeatureEnabled("TestFeatureA") {
+		t.Error("forSyncSet should not change the Runtime Features")
+	}
+
+	if got := config.forSyncSet(SyncSet{}).Runtime.Features; !reflect.DeepEqual(got, config.Runtime.Features) {
+		t.Errorf("Features = %v, want unchanged without sync set Features", got)
+	}
+
+	unknown := Features{"TestFeatureA": true, "Misspelled": true}.unknown()
+	if !reflect.DeepEqual(unknown, []string{"Misspelled"}) {
+		t.Errorf("unknown() = %v, want [Misspelled]", unknown)
+	}
+}
+
+func TestRunSyncSet_PartialUpdates(t *testing.T) {
+	source := &testSource{people: []Person{
+		{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com", "name": "Ann"}},
+	}}
+
+	for _, enabled := range []bool{false, true} {
+		destination := &testDestination{people: []Person{
+			{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com", "name": "A"}},
+		}}
+		config := AppConfig{
+			Runtime: RuntimeConfig{Features: Features{FeaturePartialUpdates: enabled}},
+			AttributeMap: []AttributeMap{
+				{Source: "email", Destination: "email"},
+				{Source: "name", Destination: "name"},
+			},
+		}
+		if err := RunSyncSet(log.New(ioutil.Discard, "", 0), source, destination, config, SyncSet{Name: "staff"},
+			nil); err != nil {
+			t.Fatal(err)
+		}
+		if destination.changes.PartialUpdates != enabled {
+			t.Errorf("PartialUpdates = %v with the feature enabled %v", destination.changes.PartialUpdates, enabled)
+		}
+	}
+}
+
+func TestValidateFeatures(t *testing.T) {
+	DescribeDestination("PartialTest", AdapterConfig{Features: []string{FeaturePartialUpdates}})
+	DescribeDestination("FullTest", AdapterConfig{})
+
+	tests := []struct {
+		name    string
+		config  AppConfig
+		wantErr bool
+	}{
+		{
+			name: "supported",
+			config: AppConfig{
+				Runtime:     RuntimeConfig{Features: Features{FeaturePartialUpdates: true}},
+				Destination: DestinationConfig{Type: "PartialTest"},
+				SyncSets:    []SyncSet{{Name: "staff"}},
+			},
+		},
+		{
+			name: "not supported",
+			config: AppConfig{
+				Runtime:     RuntimeConfig{Features: Features{FeaturePartialUpdates: true}},
+				Destination: DestinationConfig{Type: "FullTest"},
+				SyncSets:    []SyncSet{{Name: "staff"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "turned off for the sync set",
+			config: AppConfig{
+				Runtime:     RuntimeConfig{Features: Features{FeaturePartialUpdates: true}},
+				Destination: DestinationConfig{Type: "FullTest"},
+				SyncSets:    []SyncSet{{Name: "staff", Features: Features{FeaturePartialUpdates: false}}},
+			},
+		},
+		{
+			name: "enabled for a sync set",
+			config: AppConfig{
+				Destination: DestinationConfig{Type: "FullTest"},
+				SyncSets:    []SyncSet{{Name: "staff", Features: Features{FeaturePartialUpdates: true}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "not enabled",
+			config: AppConfig{
+				Destination: DestinationConfig{Type: "FullTest"},
+				SyncSets:    []SyncSet{{Name: "staff"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateFeatures(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("validateFeatures() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,604 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// filterExpression is a parsed sync set Filter. It is written in a subset of the expr language, such as
+// attrs.status == "active" && attrs.country in ["US", "CA"], and is evaluated for each person in the source.
+type filterExpression struct {
+	root filterNode
+
+	// attributes are the source attributes used in the expression
+	attributes []string
+}
+
+// parseFilter parses a Filter expression. Attributes are referenced as attrs.name, or attrs["name"] for names that
+// are not identifiers, and today is the current date in the form 2006-01-02. The operators are ||, &&, !, ==, !=,
+// <, <=, >, >=, in, not in, contains, startsWith, endsWith, and matches, along with or, and, and not.
+func parseFilter(expression string) (*filterExpression, error) {
+	tokens, err := scanFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != filterTokenEnd {
+		return nil, fmt.Errorf("unexpected %q at position %v", t.text, t.pos)
+	}
+	return &filterExpression{root: root, attributes: p.attributes}, nil
+}
+
+// match returns true if the person is selected by the expression
+func (f *filterExpression) match(person Person, now time.Time) (bool, error) {
+	value, err := f.eval(person, now)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("the filter returned %s instead of true or false", formatFilterValue(value))
+	}
+	return b, nil
+}
+
+// eval returns the value of the expression for the person
+func (f *filterExpression) eval(person Person, now time.Time) (interface{}, error) {
+	return f.root.eval(filterEnv{attributes: person.Attributes, today: now.Format("2006-01-02")})
+}
+
+// filterPeople returns the people selected by the filter and the number left out
+func filterPeople(people []Person, filter *filterExpression, now time.Time) ([]Person, int, error) {
+	var kept []Person
+	for _, p := range people {
+		ok, err := filter.match(p, now)
+		if err != nil {
+			return nil, 0, fmt.Errorf("unable to evaluate Filter for %s: %s", p.CompareValue, err)
+		}
+		if ok {
+			kept = append(kept, p)
+		}
+	}
+	return kept, len(people) - len(kept), nil
+}
+
+// appendFilterAttributes adds the attributes used by the sync set Filter to the source attributes to list
+func appendFilterAttributes(attributes []string, syncSet SyncSet) []string {
+	if syncSet.Filter == "" {
+		return attributes
+	}
+	filter, err := parseFilter(syncSet.Filter)
+	if err != nil {
+		return attributes // reported when the sync set is planned
+	}
+	for _, attribute := range filter.attributes {
+		if found, _ := InArray(attribute, attributes); !found {
+			attributes = append(attributes, attribute)
+		}
+	}
+	return attributes
+}
+
+const (
+	filterTokenEnd = iota
+	filterTokenIdent
+	filterTokenString
+	filterTokenNumber
+	filterTokenOperator
+)
+
+type filterToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+var filterOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", "."}
+
+// scanFilter splits an expression into tokens. The text of a string token is its unquoted value.
+func scanFilter(expression string) ([]filterToken, error) {
+	var tokens []filterToken
+	i := 0
+	for i < len(expression) {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			value, end, err := scanFilterString(expression, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenString, text: value, pos: i})
+			i = end
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(expression) && (expression[i] >= '0' && expression[i] <= '9' || expression[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenNumber, text: expression[start:i], pos: start})
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(expression) && isIdentChar(expression[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenIdent, text: expression[start:i], pos: start})
+		default:
+			operator := ""
+			for _, op := range filterOperators {
+				if strings.HasPrefix(expression[i:], op) {
+					operator = op
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected %q at position %v", string(c), i)
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenOperator, text: operator, pos: i})
+			i += len(operator)
+		}
+	}
+	return append(tokens, filterToken{kind: filterTokenEnd, text: "end of filter", pos: len(expression)}), nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// scanFilterString returns the value of the quoted string starting at start, and the position after it
+func scanFilterString(expression string, start int) (string, int, error) {
+	quote := expression[start]
+	var b strings.Builder
+	for i := start + 1; i < len(expression); i++ {
+		c := expression[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && i+1 < len(expression):
+			i++
+			switch expression[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(expression[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string at position %v", start)
+}
+
+type filterParser struct {
+	tokens     []filterToken
+	i          int
+	attributes []string
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.i]
+}
+
+// accept consumes the next token if it is one of the given operators or keywords, and returns its text
+func (p *filterParser) accept(texts ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != filterTokenOperator && t.kind != filterTokenIdent {
+		return "", false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			p.i++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *filterParser) expect(text string) error {
+	if _, ok := p.accept(text); !ok {
+		t := p.peek()
+		return fmt.Errorf("expected %q at position %v, found %q", text, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||", "or"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = filterLogical{and: false, left: left, right: right}
+	}
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&", "and"); !ok {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = filterLogical{and: true, left: left, right: right}
+	}
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	operator, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "in", "contains", "startsWith", "endsWith",
+		"matches")
+	if !ok {
+		if _, ok := p.accept("not"); !ok {
+			return left, nil
+		}
+		if err := p.expect("in"); err != nil {
+			return nil, err
+		}
+		operator = "not in"
+	}
+
+	right, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	node := filterComparison{operator: operator, left: left, right: right}
+	if literal, ok := right.(filterLiteral); ok && operator == "matches" {
+		pattern, ok := literal.value.(string)
+		if !ok {
+			return nil, errors.New("matches requires a string pattern")
+		}
+		if node.pattern, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", pattern, err)
+		}
+	}
+	return node, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return filterNot{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	t := p.peek()
+	p.i++
+	switch t.kind {
+	case filterTokenString:
+		return filterLiteral{value: t.text}, nil
+	case filterTokenNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %v", t.text, t.pos)
+		}
+		return filterLiteral{value: n}, nil
+	case filterTokenIdent:
+		switch t.text {
+		case "true", "false":
+			return filterLiteral{value: t.text == "true"}, nil
+		case "attrs":
+			return p.parseAttribute()
+		case "today":
+			return filterToday{}, nil
+		}
+		return nil, fmt.Errorf("unknown name %q at position %v, attributes are used as attrs.name", t.text, t.pos)
+	case filterTokenOperator:
+		switch t.text {
+		case "(":
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		case "[":
+			return p.parseList()
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at position %v", t.text, t.pos)
+}
+
+// parseAttribute parses the rest of attrs.name or attrs["name"]
+func (p *filterParser) parseAttribute() (filterNode, error) {
+	var name string
+	if _, ok := p.accept("."); ok {
+		t := p.peek()
+		if t.kind != filterTokenIdent {
+			return nil, fmt.Errorf("expected an attribute name at position %v", t.pos)
+		}
+		p.i++
+		name = t.text
+	} else if _, ok := p.accept("["); ok {
+		t := p.peek()
+		if t.kind != filterTokenString {
+			return nil, fmt.Errorf("expected a quoted attribute name at position %v", t.pos)
+		}
+		p.i++
+		name = t.text
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+	} else {
+		t := p.peek()
+		return nil, fmt.Errorf("expected an attribute after attrs at position %v", t.pos)
+	}
+
+	if found, _ := InArray(name, p.attributes); !found {
+		p.attributes = append(p.attributes, name)
+	}
+	return filterAttribute{name: name}, nil
+}
+
+func (p *filterParser) parseList() (filterNode, error) {
+	var list filterList
+	if _, ok := p.accept("]"); ok {
+		return list, nil
+	}
+	for {
+		item, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		list.items = append(list.items, item)
+		if _, ok := p.accept(","); !ok {
+			return list, p.expect("]")
+		}
+	}
+}
+
+// filterNode is a part of a filter expression. Its value is a string, a float64, a bool, or a []interface{}.
+type filterNode interface {
+	eval(env filterEnv) (interface{}, error)
+}
+
+// filterEnv is what an expression is evaluated with
+type filterEnv struct {
+	attributes map[string]string
+	today      string
+}
+
+type filterLiteral struct {
+	value interface{}
+}
+
+func (n filterLiteral) eval(filterEnv) (interface{}, error) {
+	return n.value, nil
+}
+
+type filterToday struct{}
+
+func (n filterToday) eval(env filterEnv) (interface{}, error) {
+	return env.today, nil
+}
+
+// filterAttribute is the value of a source attribute, which is empty if the person does not have it
+type filterAttribute struct {
+	name string
+}
+
+func (n filterAttribute) eval(env filterEnv) (interface{}, error) {
+	return env.attributes[n.name], nil
+}
+
+type filterList struct {
+	items []filterNode
+}
+
+func (n filterList) eval(env filterEnv) (interface{}, error) {
+	values := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		value, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+type filterNot struct {
+	operand filterNode
+}
+
+func (n filterNot) eval(env filterEnv) (interface{}, error) {
+	b, err := evalBool(n.operand, env, "!")
+	return !b, err
+}
+
+type filterLogical struct {
+	and         bool
+	left, right filterNode
+}
+
+func (n filterLogical) eval(env filterEnv) (interface{}, error) {
+	operator := "||"
+	if n.and {
+		operator = "&&"
+	}
+	left, err := evalBool(n.left, env, operator)
+	if err != nil || left != n.and {
+		return left, err
+	}
+	return evalBool(n.right, env, operator)
+}
+
+func evalBool(node filterNode, env filterEnv, operator string) (bool, error) {
+	value, err := node.eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s requires true or false, not %s", operator, formatFilterValue(value))
+	}
+	return b, nil
+}
+
+type filterComparison struct {
+	operator    string
+	left, right filterNode
+
+	// pattern is the compiled pattern of matches with a literal pattern
+	pattern *regexp.Regexp
+}
+
+func (n filterComparison) eval(env filterEnv) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.operator {
+	case "==":
+		return filterEqual(left, right), nil
+	case "!=":
+		return !filterEqual(left, right), nil
+	case "<", "<=", ">", ">=":
+		return filterOrder(n.operator, left, right)
+	case "in", "not in":
+		list, ok := right.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s requires a list, not %s", n.operator, formatFilterValue(right))
+		}
+		found := false
+		for _, item := range list {
+			found = found || filterEqual(left, item)
+		}
+		return found == (n.operator == "in"), nil
+	case "contains":
+		return strings.Contains(filterString(left), filterString(right)), nil
+	case "startsWith":
+		return strings.HasPrefix(filterString(left), filterString(right)), nil
+	case "endsWith":
+		return strings.HasSuffix(filterString(left), filterString(right)), nil
+	case "matches":
+		pattern := n.pattern
+		if pattern == nil {
+			if pattern, err = regexp.Compile(filterString(right)); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %s", filterString(right), err)
+			}
+		}
+		return pattern.MatchString(filterString(left)), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.operator)
+}
+
+// filterEqual compares two values. Attribute values are strings, so a comparison with a number is numeric if the
+// string is a number, and any other comparison is of the values as strings.
+func filterEqual(a, b interface{}) bool {
+	if x, y, ok := filterNumbers(a, b); ok {
+		return x == y
+	}
+	return filterString(a) == filterString(b)
+}
+
+// filterOrder compares two values numerically if both are numbers, or as strings otherwise, so that dates in the
+// form 2006-01-02 are in order
+func filterOrder(operator string, a, b interface{}) (bool, error) {
+	var cmp int
+	if x, y, ok := filterNumbers(a, b); ok {
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	} else {
+		_, aIsString := a.(string)
+		_, bIsString := b.(string)
+		if !aIsString || !bIsString {
+			return false, fmt.Errorf("cannot compare %s %s %s", formatFilterValue(a), operator,
+				formatFilterValue(b))
+		}
+		cmp = strings.Compare(a.(string), b.(string))
+	}
+
+	switch operator {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+// filterNumbers returns both values as numbers if one is a number and the other is a number or a numeric string
+func filterNumbers(a, b interface{}) (float64, float64, bool) {
+	x, aIsNumber := a.(float64)
+	y, bIsNumber := b.(float64)
+	if !aIsNumber && !bIsNumber {
+		return 0, 0, false
+	}
+	var err error
+	if s, ok := a.(string); ok {
+		x, err = strconv.ParseFloat(strings.TrimSpace(s), 64)
+	} else if s, ok := b.(string); ok {
+		y, err = strconv.ParseFloat(strings.TrimSpace(s), 64)
+	} else if !aIsNumber || !bIsNumber {
+		return 0, 0, false
+	}
+	return x, y, err == nil
+}
+
+func filterString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return formatFilterValue(value)
+}
+
+func formatFilterValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = formatFilterValue(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return filterString(value)
+}
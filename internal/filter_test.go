@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterExpression_match(t *testing.T) {
+	attributes := map[string]string{
+		"status":      "active",
+		"country":     "US",
+		"grade":       "12",
+		"start_date":  "2020-06-01",
+		"email":       "jane.doe@example.org",
+		"cost center": "Finance",
+	}
+
+	now := time.Date(2020, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		expression string
+		want       bool
+		wantErr    string
+	}{
+		{expression: `attrs.status == "active" && attrs.country == "US"`, want: true},
+		{expression: `attrs.status == "active" and attrs.country == 'CA'`, want: false},
+		{expression: `attrs.country == "CA" || attrs.country == "US"`, want: true},
+		{expression: `attrs.country in ["US", "CA"]`, want: true},
+		{expression: `attrs.country not in ["US", "CA"]`, want: false},
+		{expression: `!(attrs.status == "active")`, want: false},
+		{expression: `not (attrs.status != "active")`, want: true},
+		{expression: `attrs.grade >= 10`, want: true},
+		{expression: `attrs.grade == 12.0`, want: true},
+		{expression: `attrs.grade > "2"`, want: false},
+		{expression: `attrs.start_date < "2021-01-01"`, want: true},
+		{expression: `attrs.start_date == today`, want: true},
+		{expression: `attrs.email endsWith "@example.org"`, want: true},
+		{expression: `attrs.email startsWith "jane" && attrs.email contains ".doe"`, want: true},
+		{expression: `attrs.email matches "^[a-z.]+@example\\.(org|com)$"`, want: true},
+		{expression: `attrs["cost center"] == "Finance"`, want: true},
+		{expression: `attrs.missing == ""`, want: true},
+		{expression: `attrs.missing == "" || attrs.status`, want: true},
+		{expression: `attrs.status`, wantErr: "instead of true or false"},
+		{expression: `attrs.status && true`, wantErr: "&& requires true or false"},
+		{expression: `attrs.status in "active"`, wantErr: "requires a list"},
+		{expression: `attrs.status < true`, wantErr: "cannot compare"},
+		{expression: `attrs.status matches attrs.country + "("`, wantErr: `unexpected "+"`},
+		{expression: `status == "active"`, wantErr: "attrs.name"},
+		{expression: `attrs.status == "active`, wantErr: "unterminated string"},
+		{expression: `attrs.status == `, wantErr: "end of filter"},
+		{expression: `(attrs.status == "active"`, wantErr: `expected ")"`},
+		{expression: `attrs.email matches "("`, wantErr: "invalid pattern"},
+		{expression: `attrs.status = "active"`, wantErr: `unexpected "="`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			filter, err := parseFilter(tt.expression)
+			var got bool
+			if err == nil {
+				got, err = filter.match(Person{Attributes: attributes}, now)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterPeople(t *testing.T) {
+	people := []Person{
+		{CompareValue: "a", Attributes: map[string]string{"status": "active", "country": "US"}},
+		{CompareValue: "b", Attributes: map[string]string{"status": "terminated", "country": "US"}},
+		{CompareValue: "c", Attributes: map[string]string{"status": "active", "country": "CA"}},
+	}
+	filter, err := parseFilter(`attrs.status == "active" && attrs["country"] == "US"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"status", "country"}; !reflect.DeepEqual(filter.attributes, want) {
+		t.Errorf("attributes = %v, want %v", filter.attributes, want)
+	}
+
+	kept, excluded, err := filterPeople(people, filter, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 1 || kept[0].CompareValue != "a" || excluded != 2 {
+		t.Errorf("filterPeople() = %v, %v, want only a and 2 excluded", kept, excluded)
+	}
+
+	got := appendFilterAttributes([]string{"email", "status"}, SyncSet{Filter: `attrs.country == "US"`})
+	if want := []string{"email", "status", "country"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("appendFilterAttributes() = %v, want %v", got, want)
+	}
+}
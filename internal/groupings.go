@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SyncSetGrouping creates sync sets when the sync runs, one for each value of a source attribute, such as a Google
+// group for each department, so that new values do not need a change to the config. The SyncSet is a template, as
+// in a SyncSetTemplate, with two parameters: {value}, the attribute value, and {slug}, the value in lowercase with
+// each run of characters other than a-z and 0-9 replaced by a hyphen. Each sync set syncs the people with its value,
+// among those selected by the Filter of the SyncSet.
+type SyncSetGrouping struct {
+	// Attribute is the source attribute that people are grouped by. People without a value are not synced by the
+	// grouping.
+	Attribute string
+
+	// SyncSet is the template of the sync sets. Its Source is listed once, before the sync sets run, to find the
+	// values of the Attribute. Its Name must contain {value} or {slug}.
+	SyncSet SyncSet
+
+	// Exclude lists values that no sync set is created for, ignoring case
+	Exclude []string
+}
+
+// The parameters of a SyncSetGrouping's SyncSet
+const (
+	GroupingValueParameter = "value"
+	GroupingSlugParameter  = "slug"
+)
+
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// validateSyncSetGroupings checks that each grouping has an Attribute, a Name that differs for each value, and a
+// valid Filter
+func validateSyncSetGroupings(groupings []SyncSetGrouping) error {
+	for i, grouping := range groupings {
+		if grouping.Attribute == "" {
+			return fmt.Errorf("sync set grouping %v (%s) is missing an Attribute", i+1, grouping.SyncSet.Name)
+		}
+		name := grouping.SyncSet.Name
+		if !strings.Contains(name, "{"+GroupingValueParameter+"}") &&
+			!strings.Contains(name, "{"+GroupingSlugParameter+"}") {
+			return fmt.Errorf("the Name of sync set grouping %v (%s) must contain {%s} or {%s}", i+1, name,
+				GroupingValueParameter, GroupingSlugParameter)
+		}
+		if grouping.SyncSet.Filter != "" {
+			if _, err := parseFilter(grouping.SyncSet.Filter); err != nil {
+				return fmt.Errorf("invalid Filter for sync set grouping %s: %s", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ExpandSyncSetGroupings lists the source of each of the config's SyncSetGroupings, and adds a sync set to the
+// config for each value of the grouping's Attribute, in alphabetical order of the values
+func ExpandSyncSetGroupings(config *AppConfig, source Source) error {
+	if len(config.SyncSetGroupings) == 0 {
+		return nil
+	}
+
+	names := map[string]bool{}
+	for _, syncSet := range config.SyncSets {
+		names[syncSet.Name] = true
+	}
+
+	for _, grouping := range config.SyncSetGroupings {
+		values, err := groupingValues(grouping, source, config.Runtime.GetClock())
+		if err != nil {
+			return fmt.Errorf("unable to list the values of %s for sync set grouping %s: %s", grouping.Attribute,
+				grouping.SyncSet.Name, err)
+		}
+
+		for _, value := range values {
+			syncSet := grouping.SyncSet.expand(map[string]string{
+				GroupingValueParameter: value,
+				GroupingSlugParameter:  slug(value),
+			})
+			if names[syncSet.Name] {
+				return fmt.Errorf("sync set grouping %s creates a sync set named %q, which already exists",
+					grouping.SyncSet.Name, syncSet.Name)
+			}
+			names[syncSet.Name] = true
+
+			valueFilter := fmt.Sprintf(`attrs["%s"] == "%s"`, filterEscape(grouping.Attribute), filterEscape(value))
+			if syncSet.Filter == "" {
+				syncSet.Filter = valueFilter
+			} else {
+				syncSet.Filter = "(" + syncSet.Filter + ") && " + valueFilter
+			}
+			config.SyncSets = append(config.SyncSets, syncSet)
+		}
+		log.Printf("Sync set grouping %s created %v sync sets, one for each value of %s", grouping.SyncSet.Name,
+			len(values), grouping.Attribute)
+	}
+	return nil
+}
+
+// groupingValues lists the source people selected by the grouping's Filter, and returns the distinct values of the
+// Attribute, sorted, without empty and excluded values
+func groupingValues(grouping SyncSetGrouping, source Source, clock Clock) ([]string, error) {
+	if err := source.ForSet(grouping.SyncSet.Source); err != nil {
+		return nil, err
+	}
+	people, err := source.ListUsers(appendFilterAttributes([]string{grouping.Attribute}, grouping.SyncSet))
+	if err != nil {
+		return nil, err
+	}
+
+	if grouping.SyncSet.Filter != "" {
+		filter, err := parseFilter(grouping.SyncSet.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Filter: %s", err)
+		}
+		if people, _, err = filterPeople(people, filter, clock.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	excluded := map[string]bool{}
+	for _, value := range grouping.Exclude {
+		excluded[strings.ToLower(value)] = true
+	}
+
+	found := map[string]bool{}
+	var values []string
+	for _, person := range people {
+		value := person.Attributes[grouping.Attribute]
+		if strings.TrimSpace(value) == "" || excluded[strings.ToLower(value)] || found[value] {
+			continue
+		}
+		found[value] = true
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values, nil
+}
+
+// slug returns the value in lowercase, with each run of characters other than a-z and 0-9 replaced by a hyphen,
+// such as "research-development" for "Research & Development"
+func slug(value string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(value), "-"), "-")
+}
+
+// filterEscape returns the value escaped for use inside a quoted string of a Filter
+func filterEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+}
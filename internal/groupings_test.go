@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExpandSyncSetGroupings(t *testing.T) {
+	source := &fakeSource{People: []Person{
+		{CompareValue: "ann", Attributes: map[string]string{"department": "Sales", "status": "active"}},
+		{CompareValue: "bob", Attributes: map[string]string{"department": "Research & Development", "status": "active"}},
+		{CompareValue: "cat", Attributes: map[string]string{"department": "Sales", "status": "active"}},
+		{CompareValue: "dan", Attributes: map[string]string{"department": "Finance", "status": "inactive"}},
+		{CompareValue: "eve", Attributes: map[string]string{"department": "", "status": "active"}},
+		{CompareValue: "fay", Attributes: map[string]string{"department": `Say "Hi"`, "status": "active"}},
+		{CompareValue: "gus", Attributes: map[string]string{"department": "Contractors", "status": "active"}},
+	}}
+	grouping := SyncSetGrouping{
+		Attribute: "department",
+		SyncSet: SyncSet{
+			Name:        "Department {value}",
+			Destination: json.RawMessage(`{"GroupEmail":"dept-{slug}@example.org"}`),
+			Filter:      `attrs.status == "active"`,
+		},
+		Exclude: []string{"contractors"},
+	}
+
+	tests := []struct {
+		name    string
+		config  AppConfig
+		want    []SyncSet
+		wantErr bool
+	}{
+		{
+			name:   "none",
+			config: AppConfig{SyncSets: []SyncSet{{Name: "All"}}},
+			want:   []SyncSet{{Name: "All"}},
+		},
+		{
+			name: "grouping",
+			config: AppConfig{
+				SyncSets:         []SyncSet{{Name: "All"}},
+				SyncSetGroupings: []SyncSetGrouping{grouping},
+			},
+			want: []SyncSet{
+				{Name: "All"},
+				{
+					Name:        "Department Research & Development",
+					Destination: json.RawMessage(`{"GroupEmail":"dept-research-development@example.org"}`),
+					Filter:      `(attrs.status == "active") && attrs["department"] == "Research & Development"`,
+				},
+				{
+					Name:        "Department Sales",
+					Destination: json.RawMessage(`{"GroupEmail":"dept-sales@example.org"}`),
+					Filter:      `(attrs.status == "active") && attrs["department"] == "Sales"`,
+				},
+				{
+					Name:        `Department Say "Hi"`,
+					Destination: json.RawMessage(`{"GroupEmail":"dept-say-hi@example.org"}`),
+					Filter:      `(attrs.status == "active") && attrs["department"] == "Say \"Hi\""`,
+				},
+			},
+		},
+		{
+			name: "duplicate name",
+			config: AppConfig{
+				SyncSets:         []SyncSet{{Name: "Department Sales"}},
+				SyncSetGroupings: []SyncSetGrouping{grouping},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			err := ExpandSyncSetGroupings(&config, source)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("ExpandSyncSetGroupings() did not return an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExpandSyncSetGroupings() error = %s", err)
+			}
+			if !reflect.DeepEqual(config.SyncSets, tt.want) {
+				t.Errorf("ExpandSyncSetGroupings() SyncSets =\n%+v\nwant\n%+v", config.SyncSets, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandSyncSetGroupings_filter(t *testing.T) {
+	people := []Person{
+		{CompareValue: "ann", Attributes: map[string]string{"department": `Say "Hi"`}},
+		{CompareValue: "bob", Attributes: map[string]string{"department": `Say "Hi" \ Bye`}},
+		{CompareValue: "cat", Attributes: map[string]string{"department": "Sales"}},
+	}
+	config := AppConfig{SyncSetGroupings: []SyncSetGrouping{{
+		Attribute: "department",
+		SyncSet:   SyncSet{Name: "{slug}"},
+	}}}
+	if err := ExpandSyncSetGroupings(&config, &fakeSource{People: people}); err != nil {
+		t.Fatalf("ExpandSyncSetGroupings() error = %s", err)
+	}
+
+	for i, want := range []string{"cat", "ann", "bob"} {
+		filter, err := parseFilter(config.SyncSets[i].Filter)
+		if err != nil {
+			t.Fatalf("invalid Filter %s: %s", config.SyncSets[i].Filter, err)
+		}
+		kept, _, err := filterPeople(people, filter, time.Now())
+		if err != nil || len(kept) != 1 || kept[0].CompareValue != want {
+			t.Errorf("sync set %s kept %v, want only %s, error: %v", config.SyncSets[i].Name, kept, want, err)
+		}
+	}
+}
+
+func TestValidateSyncSetGroupings(t *testing.T) {
+	tests := []struct {
+		name      string
+		groupings []SyncSetGrouping
+		wantErr   bool
+	}{
+		{
+			name:      "valid",
+			groupings: []SyncSetGrouping{{Attribute: "department", SyncSet: SyncSet{Name: "dept-{slug}"}}},
+		},
+		{
+			name:      "no attribute",
+			groupings: []SyncSetGrouping{{SyncSet: SyncSet{Name: "dept-{slug}"}}},
+			wantErr:   true,
+		},
+		{
+			name:      "name without a parameter",
+			groupings: []SyncSetGrouping{{Attribute: "department", SyncSet: SyncSet{Name: "Department"}}},
+			wantErr:   true,
+		},
+		{
+			name: "invalid filter",
+			groupings: []SyncSetGrouping{{
+				Attribute: "department",
+				SyncSet:   SyncSet{Name: "{value}", Filter: "attrs.status =="},
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateSyncSetGroupings(tt.groupings); (err != nil) != tt.wantErr {
+				t.Errorf("validateSyncSetGroupings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"Sales":                      "sales",
+		"Research & Development":     "research-development",
+		"  IT / Help Desk (Tier 2) ": "it-help-desk-tier-2",
+	}
+	for value, want := range tests {
+		if got := slug(value); got != want {
+			t.Errorf("slug(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GrowthGuardConfig stops a sync set whose destination would grow or shrink by more than MaxFactor in one run, such
+// as when a source filter is misconfigured and suddenly matches the whole organization, or matches no one
+type GrowthGuardConfig struct {
+	// MaxFactor is the largest allowed ratio of the destination size after the run to its size before, or before
+	// to after. It must be greater than 1. Zero disables the guard.
+	MaxFactor float64
+
+	// MinSize is the smallest destination that is guarded, so that a small destination can grow from a few people
+	MinSize int
+
+	// Approved lists the sync sets that may grow or shrink by any factor on the next run. A name without a
+	// destination, such as "staff", approves every destination of the sync set.
+	Approved []string
+}
+
+// GrowthError is returned for a sync set whose destination would change size by more than the MaxFactor
+type GrowthError struct {
+	SyncSet   string
+	Before    int
+	After     int
+	MaxFactor float64
+}
+
+func (e *GrowthError) Error() string {
+	verb := "grow"
+	if e.After < e.Before {
+		verb = "shrink"
+	}
+	return fmt.Sprintf("sync set %s would %s from %v to %v people, more than the GrowthGuard MaxFactor of %v, "+
+		"add it to the GrowthGuard Approved list to allow it", e.SyncSet, verb, e.Before, e.After, e.MaxFactor)
+}
+
+func (g GrowthGuardConfig) validate() error {
+	if g.MaxFactor != 0 && g.MaxFactor <= 1 {
+		return fmt.Errorf("GrowthGuard MaxFactor must be greater than 1, not %v", g.MaxFactor)
+	}
+	if g.MinSize < 0 {
+		return fmt.Errorf("GrowthGuard MinSize must not be negative, not %v", g.MinSize)
+	}
+	return nil
+}
+
+func (g GrowthGuardConfig) isApproved(syncSetName string) bool {
+	baseName := strings.SplitN(syncSetName, "/", 2)[0]
+	for _, name := range g.Approved {
+		if name == syncSetName || name == baseName {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGrowth returns a GrowthError if making the ChangeSet would change the number of people in the destination by
+// more than the MaxFactor. Operations that are disabled for the destination are not counted, since they are not
+// made. An empty destination, or one smaller than the MinSize, is not guarded.
+func checkGrowth(config AppConfig, syncSetName string, destinationSize int, changeSet ChangeSet) error {
+	guard := config.GrowthGuard
+	if guard.MaxFactor == 0 || destinationSize == 0 || destinationSize < guard.MinSize ||
+		guard.isApproved(syncSetName) {
+		return nil
+	}
+
+	after := destinationSize
+	if !config.Destination.DisableAdd {
+		after += len(changeSet.Create)
+	}
+	if !config.Destination.DisableDelete {
+		after -= len(changeSet.Delete)
+	}
+
+	if float64(after) > float64(destinationSize)*guard.MaxFactor ||
+		float64(after)*guard.MaxFactor < float64(destinationSize) {
+		return &GrowthError{SyncSet: syncSetName, Before: destinationSize, After: after, MaxFactor: guard.MaxFactor}
+	}
+	return nil
+}
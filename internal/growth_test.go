@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+func TestCheckGrowth(t *testing.T) {
+	people := func(n int) []Person {
+		list := make([]Person, n)
+		for i := range list {
+			list[i] = Person{CompareValue: fmt.Sprintf("person%v@example.org", i)}
+		}
+		return list
+	}
+	guard := GrowthGuardConfig{MaxFactor: 2, MinSize: 5, Approved: []string{"approved", "staff/ldap"}}
+
+	tests := []struct {
+		name        string
+		syncSet     string
+		destination DestinationConfig
+		size        int
+		changeSet   ChangeSet
+		wantAfter   int
+	}{
+		{name: "double", syncSet: "staff", size: 10, changeSet: ChangeSet{Create: people(10)}},
+		{name: "grow", syncSet: "staff", size: 10, changeSet: ChangeSet{Create: people(11)}, wantAfter: 21},
+		{name: "half", syncSet: "staff", size: 10, changeSet: ChangeSet{Delete: people(5)}},
+		{name: "shrink", syncSet: "staff", size: 10, changeSet: ChangeSet{Delete: people(6)}, wantAfter: 4},
+		{name: "empty", syncSet: "staff", size: 10, changeSet: ChangeSet{Delete: people(10)}, wantAfter: -1},
+		{name: "updates", syncSet: "staff", size: 10, changeSet: ChangeSet{Update: people(50)}},
+		{name: "small", syncSet: "staff", size: 4, changeSet: ChangeSet{Create: people(100)}},
+		{name: "new", syncSet: "staff", size: 0, changeSet: ChangeSet{Create: people(100)}},
+		{name: "approved", syncSet: "approved/ldap", size: 10, changeSet: ChangeSet{Create: people(100)}},
+		{name: "approved destination", syncSet: "staff/ldap", size: 10, changeSet: ChangeSet{Create: people(100)}},
+		{name: "other destination", syncSet: "staff/google", size: 10, changeSet: ChangeSet{Create: people(100)},
+			wantAfter: 110},
+		{name: "deletes disabled", syncSet: "staff", destination: DestinationConfig{DisableDelete: true}, size: 10,
+			changeSet: ChangeSet{Delete: people(10)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := AppConfig{Destination: tt.destination, GrowthGuard: guard}
+			err := checkGrowth(config, tt.syncSet, tt.size, tt.changeSet)
+			if tt.wantAfter == 0 {
+				if err != nil {
+					t.Errorf("checkGrowth() = %s, want no error", err)
+				}
+				return
+			}
+			growthErr, ok := err.(*GrowthError)
+			if !ok {
+				t.Fatalf("checkGrowth() = %v, want a GrowthError", err)
+			}
+			wantAfter := tt.wantAfter
+			if wantAfter < 0 {
+				wantAfter = 0
+			}
+			if growthErr.Before != tt.size || growthErr.After != wantAfter {
+				t.Errorf("checkGrowth() = %+v, want %v to %v people", growthErr, tt.size, wantAfter)
+			}
+		})
+	}
+
+	if err := (GrowthGuardConfig{MaxFactor: 1}).validate(); err == nil {
+		t.Error("validate() did not return an error for a MaxFactor of 1")
+	}
+}
+
+func TestRunSyncSet_GrowthGuard(t *testing.T) {
+	var sourcePeople []Person
+	for i := 0; i < 30; i++ {
+		email := fmt.Sprintf("person%v@example.org", i)
+		sourcePeople = append(sourcePeople, Person{CompareValue: email, Attributes: map[string]string{"email": email}})
+	}
+	config := AppConfig{
+		AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}},
+		GrowthGuard:  GrowthGuardConfig{MaxFactor: 2},
+	}
+	logger := log.New(ioutil.Discard, "", 0)
+
+	destination := &testDestination{people: sourcePeople[:10]}
+	err := RunSyncSet(logger, &testSource{people: sourcePeople}, destination, config, SyncSet{Name: "staff"}, nil)
+	if _, ok := err.(*GrowthError); !ok {
+		t.Fatalf("RunSyncSet() = %v, want a GrowthError", err)
+	}
+	if len(destination.changes.Create) > 0 {
+		t.Errorf("RunSyncSet() created %v people", len(destination.changes.Create))
+	}
+
+	config.GrowthGuard.Approved = []string{"staff"}
+	if err := RunSyncSet(logger, &testSource{people: sourcePeople}, destination, config, SyncSet{Name: "staff"},
+		nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(destination.changes.Create) != 20 {
+		t.Errorf("RunSyncSet() created %v people, want 20", len(destination.changes.Create))
+	}
+}
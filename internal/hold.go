@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"log"
+	"strings"
+)
+
+// HoldConfig puts people on hold, such as for a legal hold or a disputed HR record, so that nothing about them is
+// created, updated, or deleted until the hold is lifted
+type HoldConfig struct {
+	// SourceAttribute is a source attribute that holds a person when it is true, whether or not the person is
+	// excluded by SyncTargets or a Filter
+	SourceAttribute string
+
+	// DestinationAttribute is a destination attribute that holds a person when it is true
+	DestinationAttribute string
+
+	// CompareValues are the compare values of people on hold, ignoring case
+	CompareValues []string
+}
+
+// HeldChange is a planned change that was left out because the person is on hold
+type HeldChange struct {
+	Operation string
+	Person    Person
+}
+
+// heldPeople collects the lower case compare values of the people on hold, from the config and the attributes
+type heldPeople map[string]bool
+
+func newHeldPeople(config HoldConfig) heldPeople {
+	held := heldPeople{}
+	for _, value := range config.CompareValues {
+		held[strings.ToLower(value)] = true
+	}
+	return held
+}
+
+// addFlagged adds the people whose attribute is true
+func (h heldPeople) addFlagged(people []Person, attribute string) {
+	if attribute == "" {
+		return
+	}
+	for _, person := range people {
+		if isTrue(person.Attributes[attribute]) {
+			h[strings.ToLower(person.CompareValue)] = true
+		}
+	}
+}
+
+// apply removes the changes of people on hold from the ChangeSet, and returns them
+func (h heldPeople) apply(changeSet ChangeSet) (ChangeSet, []HeldChange) {
+	if len(h) == 0 {
+		return changeSet, nil
+	}
+
+	var skipped []HeldChange
+	filter := func(people []Person, operation string) []Person {
+		var kept []Person
+		for _, person := range people {
+			if h[strings.ToLower(person.CompareValue)] {
+				skipped = append(skipped, HeldChange{Operation: operation, Person: person})
+				continue
+			}
+			kept = append(kept, person)
+		}
+		return kept
+	}
+	changeSet.Create = filter(changeSet.Create, OperationCreate)
+	changeSet.Update = filter(changeSet.Update, OperationUpdate)
+	changeSet.Delete = filter(changeSet.Delete, OperationDelete)
+	return changeSet, skipped
+}
+
+func printHeld(logger *log.Logger, skipped []HeldChange) {
+	if len(skipped) == 0 {
+		return
+	}
+	logger.Printf("    %v changes to people on hold are not made\n", len(skipped))
+	for i, h := range skipped {
+		logger.Printf("  %v) HOLD %s %s", i+1, h.Operation, h.Person.CompareValue)
+	}
+}
@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunSyncSet_Hold(t *testing.T) {
+	person := func(email, name, hold string) Person {
+		return Person{CompareValue: email, Attributes: map[string]string{"email": email, "name": name,
+			"hold": hold}}
+	}
+	source := &testSource{people: []Person{
+		person("new@example.org", "New", ""),
+		person("newheld@example.org", "New Held", "yes"),
+		person("ann@example.org", "Ann Changed", "true"),
+		person("bob@example.org", "Bob Changed", ""),
+		person("cy@example.org", "Cy Changed", ""),
+		person("listed@example.org", "Listed Changed", ""),
+		person("gone@example.org", "Gone", "true"),
+	}}
+	destination := &testDestination{people: []Person{
+		person("ann@example.org", "Ann", ""),
+		person("bob@example.org", "Bob", "true"),
+		person("cy@example.org", "Cy", "false"),
+		person("listed@example.org", "Listed", ""),
+		person("gone@example.org", "Gone", ""),
+		person("old@example.org", "Old", ""),
+	}}
+	config := AppConfig{
+		AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}, {Source: "name", Destination: "name"}},
+		Hold: HoldConfig{
+			SourceAttribute:      "hold",
+			DestinationAttribute: "hold",
+			CompareValues:        []string{"LISTED@example.org"},
+		},
+	}
+	syncSet := SyncSet{Name: "staff", Filter: `attrs.email != "gone@example.org"`}
+
+	var buf bytes.Buffer
+	if err := RunSyncSet(log.New(&buf, "", 0), source, destination, config, syncSet, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(people []Person) []string {
+		var names []string
+		for _, p := range people {
+			names = append(names, p.CompareValue)
+		}
+		return names
+	}
+	got := [][]string{names(destination.changes.Create), names(destination.changes.Update),
+		names(destination.changes.Delete)}
+	want := [][]string{{"new@example.org"}, {"cy@example.org"}, {"old@example.org"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %v, want %v", got, want)
+	}
+
+	for _, line := range []string{
+		"5 changes to people on hold are not made",
+		"HOLD create newheld@example.org",
+		"HOLD update ann@example.org",
+		"HOLD update bob@example.org",
+		"HOLD update listed@example.org",
+		"HOLD delete gone@example.org",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("log does not contain %q:\n%s", line, buf.String())
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package internal
+
+import "log/syslog"
+
+// Phase is a step in the run of a sync set
+type Phase string
+
+const (
+	PhaseListSource      Phase = "ListSource"
+	PhaseListDestination Phase = "ListDestination"
+	PhaseApply           Phase = "Apply"
+)
+
+// Hooks are called as a sync progresses, so that a program embedding the engine can show progress or publish
+// events without parsing the log. Any of them may be nil. They are called while the sync waits, so they should
+// return quickly.
+type Hooks struct {
+	// SyncSetStart is called when a sync set begins, and SyncSetEnd when it ends, with the error that stopped it
+	SyncSetStart func(syncSet string)
+	SyncSetEnd   func(syncSet string, err error)
+
+	// PhaseStart and PhaseEnd are called around each phase of a sync set. A phase that fails ends with its error.
+	PhaseStart func(syncSet string, phase Phase)
+	PhaseEnd   func(syncSet string, phase Phase, err error)
+
+	// Change is called for each change applied to the destination, and for each one that failed
+	Change func(syncSet string, progress ChangeProgress)
+
+	// Error is called for each error logged while applying a ChangeSet
+	Error func(syncSet string, item EventLogItem)
+
+	// Results is called with the results of applying the ChangeSet of each sync set
+	Results func(syncSet string, results ChangeResults)
+}
+
+// ChangeProgress is passed to the Change hook
+type ChangeProgress struct {
+	// Item is the event logged by the destination for the change
+	Item EventLogItem
+
+	// Done is how many changes have been applied or have failed so far, out of the Total in the ChangeSet.
+	// Destinations log one event for each change, so Done is exact for most of them.
+	Done  int
+	Total int
+}
+
+func (h *Hooks) syncSetStart(syncSet string) {
+	if h != nil && h.SyncSetStart != nil {
+		h.SyncSetStart(syncSet)
+	}
+}
+
+func (h *Hooks) syncSetEnd(syncSet string, err error) {
+	if h != nil && h.SyncSetEnd != nil {
+		h.SyncSetEnd(syncSet, err)
+	}
+}
+
+func (h *Hooks) phaseStart(syncSet string, phase Phase) {
+	if h != nil && h.PhaseStart != nil {
+		h.PhaseStart(syncSet, phase)
+	}
+}
+
+func (h *Hooks) phaseEnd(syncSet string, phase Phase, err error) {
+	if h != nil && h.PhaseEnd != nil {
+		h.PhaseEnd(syncSet, phase, err)
+	}
+}
+
+func (h *Hooks) results(syncSet string, results ChangeResults) {
+	if h != nil && h.Results != nil {
+		h.Results(syncSet, results)
+	}
+}
+
+// SyncSetStarted calls the SyncSetStart hook, if there is one
+func (c AppConfig) SyncSetStarted(syncSet string) {
+	c.Runtime.Hooks.syncSetStart(syncSet)
+}
+
+// SyncSetEnded calls the SyncSetEnd hook, if there is one
+func (c AppConfig) SyncSetEnded(syncSet string, err error) {
+	c.Runtime.Hooks.syncSetEnd(syncSet, err)
+}
+
+// changeProgress passes the events logged while applying a ChangeSet to the Change and Error hooks
+type changeProgress struct {
+	hooks   *Hooks
+	syncSet string
+	done    int
+	total   int
+}
+
+func newChangeProgress(hooks *Hooks, syncSet string, changeSet ChangeSet) *changeProgress {
+	if hooks == nil || hooks.Change == nil && hooks.Error == nil {
+		return nil
+	}
+	total := len(changeSet.Create) + len(changeSet.Update) + len(changeSet.Delete)
+	return &changeProgress{hooks: hooks, syncSet: syncSet, total: total}
+}
+
+// event reports an event to the hooks. Informational events and errors at LOG_ERR are counted as changes, but
+// more severe errors, such as conflicts and failures of a whole sync set, and warnings are not.
+func (p *changeProgress) event(item EventLogItem) {
+	if p == nil {
+		return
+	}
+
+	if item.Level <= syslog.LOG_ERR && p.hooks.Error != nil {
+		p.hooks.Error(p.syncSet, item)
+	}
+	if item.Level != syslog.LOG_INFO && item.Level != syslog.LOG_ERR {
+		return
+	}
+	if p.done < p.total {
+		p.done++
+	}
+	if p.hooks.Change != nil {
+		p.hooks.Change(p.syncSet, ChangeProgress{Item: item, Done: p.done, Total: p.total})
+	}
+}
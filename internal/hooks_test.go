@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"log/syslog"
+	"reflect"
+	"testing"
+)
+
+// eventDestination logs an event for each person it creates, and fails to create those named in fail
+type eventDestination struct {
+	testDestination
+	fail string
+}
+
+func (d *eventDestination) ApplyChangeSet(changes ChangeSet, eventLog chan<- EventLogItem) ChangeResults {
+	var results ChangeResults
+	eventLog <- EventLogItem{Level: syslog.LOG_WARNING, Message: "slow down"}
+	for _, person := range changes.Create {
+		if person.CompareValue == d.fail {
+			eventLog <- EventLogItem{Level: syslog.LOG_ERR, Message: "unable to create " + person.CompareValue}
+			continue
+		}
+		eventLog <- EventLogItem{Level: syslog.LOG_INFO, Message: "created " + person.CompareValue}
+		results.Created++
+	}
+	return results
+}
+
+func TestHooks(t *testing.T) {
+	var calls []string
+	hooks := &Hooks{
+		PhaseStart: func(syncSet string, phase Phase) {
+			calls = append(calls, fmt.Sprintf("%s start %s", syncSet, phase))
+		},
+		PhaseEnd: func(syncSet string, phase Phase, err error) {
+			calls = append(calls, fmt.Sprintf("%s end %s %v", syncSet, phase, err))
+		},
+		Change: func(syncSet string, progress ChangeProgress) {
+			calls = append(calls, fmt.Sprintf("%s %s %v/%v", syncSet, progress.Item.Message, progress.Done,
+				progress.Total))
+		},
+		Error: func(syncSet string, item EventLogItem) {
+			calls = append(calls, fmt.Sprintf("%s error %s", syncSet, item.Category))
+		},
+		Results: func(syncSet string, results ChangeResults) {
+			calls = append(calls, fmt.Sprintf("%s created %v", syncSet, results.Created))
+		},
+	}
+	config := AppConfig{
+		Runtime:      RuntimeConfig{Hooks: hooks},
+		AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}},
+	}
+	source := &testSource{people: []Person{
+		{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com"}},
+		{CompareValue: "bob@example.com", Attributes: map[string]string{"email": "bob@example.com"}},
+	}}
+	destination := &eventDestination{fail: "bob@example.com"}
+
+	logger := log.New(ioutil.Discard, "", 0)
+	if err := RunSyncSet(logger, source, destination, config, SyncSet{Name: "staff"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"staff start ListSource",
+		"staff end ListSource <nil>",
+		"staff start ListDestination",
+		"staff end ListDestination <nil>",
+		"staff start Apply",
+		"staff created ann@example.com 1/2",
+		"staff error unknown",
+		"staff unable to create bob@example.com 2/2",
+		"staff end Apply <nil>",
+		"staff created 1",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("hook calls =\n%q\nwant\n%q", calls, want)
+	}
+
+	calls = nil
+	config.SyncSetStarted("other")
+	config.SyncSetEnded("other", errors.New("failed"))
+	if len(calls) != 0 {
+		t.Errorf("hook calls = %q, want none for hooks that are not set", calls)
+	}
+
+	config.Runtime.Hooks = nil
+	if err := RunSyncSet(logger, source, destination, config, SyncSet{Name: "staff"}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
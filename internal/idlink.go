@@ -0,0 +1,155 @@
+package internal
+
+import "log"
+
+// IDLinkConfig enables linking each source person to their destination record by a stable source ID. Once a
+// link exists, people are matched by the link rather than the compare value, so a changed email address is
+// treated as an update rather than a delete and a create.
+type IDLinkConfig struct {
+	// SourceAttribute is the source attribute holding a stable, unique ID, such as an employee number
+	SourceAttribute string
+}
+
+// IDLinks maps stable source IDs to destination IDs
+type IDLinks map[string]string
+
+func idLinksKey(destinationType, syncSetName string) string {
+	return "idlinks/" + destinationType + "/" + syncSetName
+}
+
+// destinationID returns the value that identifies the destination person, preferring the destination's own ID
+func destinationID(dp Person) string {
+	if id := dp.Attributes["id"]; id != "" {
+		return id
+	}
+	if dp.ID != "" {
+		return dp.ID
+	}
+	return dp.CompareValue
+}
+
+// linkIndex indexes the destination people and the ID links, to find the destination person of each source person
+// without searching all of them
+type linkIndex struct {
+	links IDLinks
+
+	// destinationIDs are the destination IDs of the destination people, in order
+	destinationIDs []string
+
+	// byDestinationID is the index of the destination person with each destination ID
+	byDestinationID map[string]int
+
+	// sourceByLinkedID is the source ID linked to each destination ID
+	sourceByLinkedID map[string]string
+}
+
+// newLinkIndex returns a linkIndex of the destination people and links
+func newLinkIndex(destinationPeople []Person, links IDLinks) linkIndex {
+	index := linkIndex{
+		links:            links,
+		destinationIDs:   make([]string, len(destinationPeople)),
+		byDestinationID:  make(map[string]int, len(destinationPeople)),
+		sourceByLinkedID: make(map[string]string, len(links)),
+	}
+	for i, dp := range destinationPeople {
+		id := destinationID(dp)
+		index.destinationIDs[i] = id
+		if _, ok := index.byDestinationID[id]; !ok {
+			index.byDestinationID[id] = i
+		}
+	}
+	for sourceID, linkedID := range links {
+		index.sourceByLinkedID[linkedID] = sourceID
+	}
+	return index
+}
+
+// findDestinationPerson returns the index of the destination person that matches sp, or -1 if there is none, and
+// whether they were matched by an ID link. A linked destination person is used if present. Otherwise, candidate is
+// used, which is the index of the person matched by compare value or compare keys, unless that destination person
+// is already linked to someone else.
+func (l linkIndex) findDestinationPerson(sp Person, candidate int) (int, bool) {
+	if sp.SourceID != "" {
+		if linkedID, ok := l.links[sp.SourceID]; ok {
+			if i, ok := l.byDestinationID[linkedID]; ok {
+				return i, true
+			}
+		}
+	}
+
+	i := candidate
+	if i < 0 || len(l.links) == 0 {
+		return i, false
+	}
+
+	if sourceID, ok := l.sourceByLinkedID[l.destinationIDs[i]]; ok && sourceID != sp.SourceID {
+		return -1, false
+	}
+	return i, false
+}
+
+// setSourceIDs copies the value of the source attribute into the SourceID of each person
+func setSourceIDs(people []Person, sourceAttribute string) {
+	for i := range people {
+		people[i].SourceID = people[i].Attributes[sourceAttribute]
+	}
+}
+
+// updateIDLinks merges the links for people matched on this run into the existing links and removes the links to
+// destination people that were deleted. Only the deletes that succeeded are given, see succeededDeletes.
+func updateIDLinks(links, matched IDLinks, deleted []Person) IDLinks {
+	updated := IDLinks{}
+	for sourceID, destID := range links {
+		updated[sourceID] = destID
+	}
+	for sourceID, destID := range matched {
+		updated[sourceID] = destID
+	}
+
+	for _, dp := range deleted {
+		dpID := destinationID(dp)
+		for sourceID, destID := range updated {
+			if destID == dpID {
+				delete(updated, sourceID)
+			}
+		}
+	}
+	return updated
+}
+
+// succeededDeletes returns the planned deletes that the destination made, leaving out the people named by an error
+// event. If the destination deleted fewer people than are left, the deletes that were made cannot be told apart
+// and none are returned, so that no link to a person still in the destination is removed.
+func succeededDeletes(deletes []Person, deleted uint64, counts eventCounts) []Person {
+	var succeeded []Person
+	for _, dp := range deletes {
+		if !counts.failed(dp) {
+			succeeded = append(succeeded, dp)
+		}
+	}
+	if uint64(len(succeeded)) > deleted {
+		return nil
+	}
+	return succeeded
+}
+
+// linkCreatedPeople lists the destination again to find the IDs assigned to newly created people and adds them
+// to links
+func linkCreatedPeople(logger *log.Logger, destination Destination, config AppConfig, created []Person,
+	links IDLinks) {
+
+	destinationPeople, err := destination.ListUsers(GetDestinationAttributes(config.AttributeMap))
+	if err != nil {
+		logger.Printf("unable to list destination to link created people: %s", err)
+		return
+	}
+
+	for _, sp := range created {
+		if sp.SourceID == "" {
+			continue
+		}
+		if i := getPersonIndexFromList(sp.CompareValue, destinationPeople); i >= 0 {
+			links[sp.SourceID] = destinationID(destinationPeople[i])
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type testSource struct {
+	people []Person
+}
+
+func (s *testSource) ForSet(syncSetJson json.RawMessage) error {
+	return nil
+}
+
+func (s *testSource) ListUsers(desiredAttrs []string) ([]Person, error) {
+	return s.people, nil
+}
+
+// testDestination keeps people in memory, assigning a new ID to each person it creates
+type testDestination struct {
+	people  []Person
+	changes ChangeSet
+	nextID  int
+}
+
+func (d *testDestination) ForSet(syncSetJson json.RawMessage) error {
+	return nil
+}
+
+func (d *testDestination) ListUsers(desiredAttrs []string) ([]Person, error) {
+	return d.people, nil
+}
+
+func (d *testDestination) ApplyChangeSet(changes ChangeSet, eventLog chan<- EventLogItem) ChangeResults {
+	d.changes = changes
+
+	var people []Person
+	for _, dp := range d.people {
+		if i := getPersonIndexFromList(dp.CompareValue, changes.Delete); i >= 0 {
+			continue
+		}
+		for _, update := range changes.Update {
+			if update.ID == dp.Attributes["id"] {
+				dp = Person{CompareValue: update.Attributes["email"], Attributes: update.Attributes}
+				dp.Attributes["id"] = update.ID
+			}
+		}
+		people = append(people, dp)
+	}
+	for _, create := range changes.Create {
+		d.nextID++
+		attrs := map[string]string{"id": strconv.Itoa(d.nextID)}
+		for k, v := range create.Attributes {
+			attrs[k] = v
+		}
+		people = append(people, Person{CompareValue: create.CompareValue, Attributes: attrs})
+	}
+	d.people = people
+
+	return ChangeResults{
+		Created: uint64(len(changes.Create)),
+		Updated: uint64(len(changes.Update)),
+		Deleted: uint64(len(changes.Delete)),
+	}
+}
+
+func TestGenerateLinkedChangeSet(t *testing.T) {
+	sourcePeople := []Person{
+		{CompareValue: "new.name@example.com", SourceID: "100", Attributes: map[string]string{"email": "new.name@example.com"}},
+		{CompareValue: "reused@example.com", SourceID: "200", Attributes: map[string]string{"email": "reused@example.com"}},
+	}
+	destinationPeople := []Person{
+		{CompareValue: "old.name@example.com", Attributes: map[string]string{"id": "a", "email": "old.name@example.com"}},
+		{CompareValue: "reused@example.com", Attributes: map[string]string{"id": "b", "email": "reused@example.com"}},
+	}
+	links := IDLinks{"100": "a", "300": "b"}
+
+	logger := log.New(ioutil.Discard, "", 0)
+	changeSet, matched := generateLinkedChangeSet(logger, sourcePeople, destinationPeople, AppConfig{}, links, nil)
+
+	wantUpdate := []Person{{
+		CompareValue:         "new.name@example.com",
+		ID:                   "a",
+		SourceID:             "100",
+		Attributes:           map[string]string{"email": "new.name@example.com"},
+		PreviousCompareValue: "old.name@example.com",
+		Changes: []AttributeChange{
+			{Attribute: "email", Old: "old.name@example.com", New: "new.name@example.com"},
+		},
+	}}
+	if !reflect.DeepEqual(changeSet.Update, wantUpdate) {
+		t.Errorf("Update = %+v, want %+v", changeSet.Update, wantUpdate)
+	}
+	if len(changeSet.Create) != 1 || changeSet.Create[0].SourceID != "200" {
+		t.Errorf("Create = %+v, want the person whose email is linked to someone else", changeSet.Create)
+	}
+	if len(changeSet.Delete) != 1 || changeSet.Delete[0].Attributes["id"] != "b" {
+		t.Errorf("Delete = %+v, want the person linked to a source ID that no longer exists", changeSet.Delete)
+	}
+	if want := (IDLinks{"100": "a"}); !reflect.DeepEqual(matched, want) {
+		t.Errorf("matched links = %v, want %v", matched, want)
+	}
+
+	got := updateIDLinks(links, IDLinks{"400": "c"}, changeSet.Delete)
+	if want := (IDLinks{"100": "a", "400": "c"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("updateIDLinks() = %v, want %v", got, want)
+	}
+}
+
+func TestRunSyncSet_IDLink(t *testing.T) {
+	config := AppConfig{
+		Destination:  DestinationConfig{Type: "test"},
+		IDLink:       IDLinkConfig{SourceAttribute: "employee_id"},
+		AttributeMap: []AttributeMap{{Source: "email", Destination: "email", Required: true}},
+	}
+	syncSet := SyncSet{Name: "set"}
+	store := &MemoryStateStore{}
+	logger := log.New(ioutil.Discard, "", 0)
+
+	source := &testSource{people: []Person{
+		{CompareValue: "first@example.com", Attributes: map[string]string{"email": "first@example.com", "employee_id": "100"}},
+	}}
+	destination := &testDestination{}
+
+	if err := RunSyncSet(logger, source, destination, config, syncSet, store); err != nil {
+		t.Fatalf("RunSyncSet() error = %s", err)
+	}
+
+	var links IDLinks
+	if _, err := store.Load(idLinksKey("test", "set"), &links); err != nil {
+		t.Fatalf("Load() error = %s", err)
+	}
+	if want := (IDLinks{"100": "1"}); !reflect.DeepEqual(links, want) {
+		t.Fatalf("links after create = %v, want %v", links, want)
+	}
+
+	// change the email address in the source
+	source.people = []Person{
+		{CompareValue: "renamed@example.com", Attributes: map[string]string{"email": "renamed@example.com", "employee_id": "100"}},
+	}
+	if err := RunSyncSet(logger, source, destination, config, syncSet, store); err != nil {
+		t.Fatalf("RunSyncSet() error = %s", err)
+	}
+
+	if len(destination.changes.Create) != 0 || len(destination.changes.Delete) != 0 || len(destination.changes.Update) != 1 {
+		t.Errorf("changes after email change = %+v, want a single update", destination.changes)
+	}
+	if got := destination.people[0].CompareValue; got != "renamed@example.com" {
+		t.Errorf("destination email = %s, want renamed@example.com", got)
+	}
+}
+
+func TestSucceededDeletes(t *testing.T) {
+	deletes := []Person{{CompareValue: "ann@example.org"}, {CompareValue: "bob@example.org"}}
+	failedBob := eventCounts{}
+	failedBob.addError(EventLogItem{Message: "unable to delete Bob@example.org: forbidden"})
+
+	tests := []struct {
+		name    string
+		deleted uint64
+		counts  eventCounts
+		want    []Person
+	}{
+		{name: "all deleted", deleted: 2, want: deletes},
+		{name: "one failed", deleted: 1, counts: failedBob, want: deletes[:1]},
+		{name: "unknown failure", deleted: 1, want: nil},
+		{name: "none deleted", deleted: 0, counts: failedBob, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := succeededDeletes(deletes, tt.deleted, tt.counts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("succeededDeletes() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
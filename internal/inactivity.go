@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"log/syslog"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	InactivityActionFlag   = "flag"
+	InactivityActionReview = "review"
+)
+
+// InactivityConfig flags the destination accounts of people who are still in the source but have not logged in
+// for Days, so that their licenses can be reclaimed. Accounts that have never been used are flagged once they are
+// older than Days. Flagged accounts are only reported, they are never changed.
+type InactivityConfig struct {
+	// Days without a login before an account is flagged. Zero disables the policy.
+	Days int
+
+	// LastLoginAttribute is a destination attribute holding the last login time, as RFC 3339 or YYYY-MM-DD, for
+	// destinations that do not provide it themselves
+	LastLoginAttribute string
+
+	// Action is "flag" (the default) to report the accounts in the log and to the alerter, or "review" to also
+	// keep them on a review list in the state store, until they log in again or leave the source
+	Action string
+}
+
+// InactiveAccount is a destination account with no recent login
+type InactiveAccount struct {
+	CompareValue string
+	LastLoginAt  time.Time `json:",omitempty"`
+	CreatedAt    time.Time `json:",omitempty"`
+
+	// FlaggedAt is when the account was first put on the review list
+	FlaggedAt time.Time `json:",omitempty"`
+}
+
+// ReviewList holds the inactive accounts of a sync set, keyed by lower case compare value
+type ReviewList map[string]InactiveAccount
+
+func reviewListKey(syncSetName string) string {
+	return "review/inactive/" + syncSetName
+}
+
+func validateInactivity(config InactivityConfig, stateType string) error {
+	switch config.Action {
+	case "", InactivityActionFlag:
+	case InactivityActionReview:
+		if config.Days > 0 && stateType == "" {
+			return fmt.Errorf("Inactivity Action %q requires a State store to be configured", config.Action)
+		}
+	default:
+		return fmt.Errorf("invalid Inactivity Action %q, must be %q or %q", config.Action, InactivityActionFlag,
+			InactivityActionReview)
+	}
+	return nil
+}
+
+// findInactive returns the destination people who are not going to be deleted, and so are in the source, whose last
+// login, or creation if they never logged in, was more than days ago. People whose activity is unknown are not
+// included. The longest inactive are listed first.
+func findInactive(destinationPeople, toDelete []Person, lastLoginAttribute string, days int,
+	now time.Time) []InactiveAccount {
+
+	deleted := map[string]bool{}
+	for _, p := range toDelete {
+		deleted[strings.ToLower(p.CompareValue)] = true
+	}
+
+	cutoff := now.AddDate(0, 0, -days)
+	var inactive []InactiveAccount
+	for _, p := range destinationPeople {
+		if deleted[strings.ToLower(p.CompareValue)] {
+			continue
+		}
+
+		account := InactiveAccount{CompareValue: p.CompareValue, LastLoginAt: p.LastLoginAt, CreatedAt: p.CreatedAt}
+		if lastLoginAttribute != "" && account.LastLoginAt.IsZero() {
+			account.LastLoginAt = parseLoginTime(p.Attributes[lastLoginAttribute])
+		}
+
+		lastActive := account.lastActive()
+		if lastActive.IsZero() || lastActive.After(cutoff) {
+			continue
+		}
+		inactive = append(inactive, account)
+	}
+
+	sort.SliceStable(inactive, func(i, j int) bool {
+		return inactive[i].lastActive().Before(inactive[j].lastActive())
+	})
+	return inactive
+}
+
+func (a InactiveAccount) lastActive() time.Time {
+	if !a.LastLoginAt.IsZero() {
+		return a.LastLoginAt
+	}
+	return a.CreatedAt
+}
+
+func parseLoginTime(value string) time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// updateReviewList returns the review list holding only the inactive accounts, keeping the time that accounts
+// already on the list were first flagged
+func updateReviewList(list ReviewList, inactive []InactiveAccount, now time.Time) ReviewList {
+	updated := ReviewList{}
+	for _, account := range inactive {
+		key := strings.ToLower(account.CompareValue)
+		account.FlaggedAt = now
+		if previous, ok := list[key]; ok && !previous.FlaggedAt.IsZero() {
+			account.FlaggedAt = previous.FlaggedAt
+		}
+		updated[key] = account
+	}
+	return updated
+}
+
+// printInactive lists the inactive accounts with their age
+func printInactive(logger *log.Logger, inactive []InactiveAccount, days int, now time.Time, maxListed int) {
+	if len(inactive) == 0 {
+		return
+	}
+	logger.Printf("    %v accounts have not logged in for %v days\n", len(inactive), days)
+	for i, a := range inactive {
+		if maxListed >= 0 && i >= maxListed {
+			logger.Printf("  ... and %v more", len(inactive)-i)
+			return
+		}
+		logger.Printf("  %v) INACTIVE %s  created: %s, last login: %s", i+1, a.CompareValue, age(a.CreatedAt, now),
+			age(a.LastLoginAt, now))
+	}
+}
+
+// reportInactive sends the number of inactive accounts to the alerter and, for the review action, saves them to
+// the review list
+func reportInactive(logger *log.Logger, config AppConfig, syncSet SyncSet, stateStore StateStore,
+	inactive []InactiveAccount) {
+
+	if len(inactive) > 0 {
+		config.GetAlerter().SyncSetEvent(syncSet.Name, EventLogItem{
+			Level: syslog.LOG_WARNING,
+			Message: fmt.Sprintf("sync set %s: %v accounts have not logged in for %v days", syncSet.Name,
+				len(inactive), config.Inactivity.Days),
+		})
+	}
+
+	if config.Inactivity.Action != InactivityActionReview || stateStore == nil {
+		return
+	}
+
+	var list ReviewList
+	if _, err := stateStore.Load(reviewListKey(syncSet.Name), &list); err != nil {
+		logger.Printf("unable to load inactive account review list: %s", err)
+	}
+	list = updateReviewList(list, inactive, config.Runtime.GetClock().Now())
+	if err := stateStore.Save(reviewListKey(syncSet.Name), list); err != nil {
+		logger.Printf("unable to save inactive account review list: %s", err)
+	}
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v5/alert"
+)
+
+func TestFindInactive(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+
+	destination := []Person{
+		{CompareValue: "active@example.com", LastLoginAt: daysAgo(5), CreatedAt: daysAgo(500)},
+		{CompareValue: "idle@example.com", LastLoginAt: daysAgo(100), CreatedAt: daysAgo(500)},
+		{CompareValue: "unused@example.com", CreatedAt: daysAgo(200)},
+		{CompareValue: "new@example.com", CreatedAt: daysAgo(10)},
+		{CompareValue: "unknown@example.com"},
+		{CompareValue: "attr@example.com", Attributes: map[string]string{"lastLogin": "2020-03-01"}},
+		{CompareValue: "leaving@example.com", LastLoginAt: daysAgo(300)},
+	}
+	toDelete := []Person{{CompareValue: "Leaving@example.com"}}
+
+	tests := []struct {
+		name      string
+		attribute string
+		want      []string
+	}{
+		{name: "destination times", want: []string{"unused@example.com", "idle@example.com"}},
+		{
+			name:      "last login attribute",
+			attribute: "lastLogin",
+			want:      []string{"unused@example.com", "idle@example.com", "attr@example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, a := range findInactive(destination, toDelete, tt.attribute, 60, now) {
+				got = append(got, a.CompareValue)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findInactive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSyncSet_InactivityReview(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC))
+	config := AppConfig{
+		Runtime:      RuntimeConfig{Clock: clock},
+		Alert:        alert.Config{Policy: alert.Policy{DigestHours: 24}},
+		Inactivity:   InactivityConfig{Days: 30, Action: InactivityActionReview},
+		AttributeMap: []AttributeMap{{Source: "email", Destination: "email", Required: true}},
+	}
+	store := &MemoryStateStore{}
+	config.Runtime.Alerter = NewAlerter(config, store)
+
+	source := &testSource{people: []Person{
+		{CompareValue: "a@example.com", Attributes: map[string]string{"email": "a@example.com"}},
+		{CompareValue: "b@example.com", Attributes: map[string]string{"email": "b@example.com"}},
+	}}
+	destination := &testDestination{people: []Person{
+		{CompareValue: "a@example.com", Attributes: map[string]string{"id": "1", "email": "a@example.com"},
+			LastLoginAt: clock.Now().AddDate(0, 0, -40)},
+		{CompareValue: "b@example.com", Attributes: map[string]string{"id": "2", "email": "b@example.com"},
+			LastLoginAt: clock.Now().AddDate(0, 0, -45)},
+	}}
+	syncSet := SyncSet{Name: "licenses"}
+
+	run := func() ReviewList {
+		var buf bytes.Buffer
+		if err := RunSyncSet(log.New(&buf, "", 0), source, destination, config, syncSet, store); err != nil {
+			t.Fatalf("RunSyncSet() error = %s", err)
+		}
+		var list ReviewList
+		if _, err := store.Load(reviewListKey(syncSet.Name), &list); err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+
+	firstRun := clock.Now()
+	list := run()
+	if len(list) != 2 || !list["a@example.com"].FlaggedAt.Equal(firstRun) {
+		t.Fatalf("review list = %+v, want a and b flagged", list)
+	}
+	if !reflect.DeepEqual(destination.changes, ChangeSet{}) {
+		t.Errorf("inactive accounts were changed: %+v", destination.changes)
+	}
+	want := []string{"Warning: sync set licenses: 2 accounts have not logged in for 30 days"}
+	if got := config.Runtime.Alerter.state.Digest; !reflect.DeepEqual(got, want) {
+		t.Errorf("Digest = %q, want %q", got, want)
+	}
+
+	// b logs in again, a keeps the time it was first flagged
+	clock.Advance(24 * time.Hour)
+	destination.people[1].LastLoginAt = clock.Now()
+	list = run()
+	if len(list) != 1 || !list["a@example.com"].FlaggedAt.Equal(firstRun) {
+		t.Errorf("review list = %+v, want only a, flagged at %s", list, firstRun)
+	}
+}
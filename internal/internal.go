@@ -3,28 +3,44 @@ package internal
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"log/syslog"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/silinternational/personnel-sync/v5/alert"
+	"github.com/silinternational/personnel-sync/v5/pkg/diff"
 )
 
 const (
-	DefaultConfigFile             = "./config.json"
-	DefaultVerbosity              = 5
-	DestinationTypeGoogleContacts = "GoogleContacts"
-	DestinationTypeGoogleGroups   = "GoogleGroups"
-	DestinationTypeGoogleSheets   = "GoogleSheets"
-	DestinationTypeGoogleUsers    = "GoogleUsers"
-	DestinationTypeRestAPI        = "RestAPI"
-	DestinationTypeWebHelpDesk    = "WebHelpDesk"
-	SourceTypeGoogleSheets        = "GoogleSheets"
-	SourceTypeRestAPI             = "RestAPI"
+	DefaultConfigFile                  = "./config.json"
+	DefaultVerbosity                   = 5
+	DestinationTypeAWSIdentityCenter   = "AWSIdentityCenter"
+	DestinationTypeAtlassianGroups     = "AtlassianGroups"
+	DestinationTypeGitHubTeams         = "GitHubTeams"
+	DestinationTypeGoogleCalendar      = "GoogleCalendar"
+	DestinationTypeGoogleCloudIdentity = "GoogleCloudIdentity"
+	DestinationTypeGoogleContacts      = "GoogleContacts"
+	DestinationTypeGoogleGroups        = "GoogleGroups"
+	DestinationTypeGoogleSheets        = "GoogleSheets"
+	DestinationTypeGoogleUsers         = "GoogleUsers"
+	DestinationTypeKeycloak            = "Keycloak"
+	DestinationTypeMailchimpLists      = "MailchimpLists"
+	DestinationTypeMicrosoftGroups     = "MicrosoftGroups"
+	DestinationTypeRestAPI             = "RestAPI"
+	DestinationTypeWebHelpDesk         = "WebHelpDesk"
+	DestinationTypeWebhook             = "Webhook"
+	SourceTypeGoogleSheets             = "GoogleSheets"
+	SourceTypeRestAPI                  = "RestAPI"
+	SourceTypeSFTP                     = "SFTP"
+	SourceTypeSQL                      = "SQL"
+	SourceTypeWorkday                  = "Workday"
 )
 
 // LoadConfig looks for a config file if one is provided. Otherwise, it looks for
@@ -58,19 +74,157 @@ func LoadConfig(configFile string) (AppConfig, error) {
 		return config, err
 	}
 
-	if config.Source.Type == "" {
-		return config, errors.New("configuration appears to be missing a Source configuration")
+	if err := validateSources(config); err != nil {
+		return config, err
+	}
+
+	if err := validateDestinations(config); err != nil {
+		return config, err
+	}
+
+	if err := validateOnDelete(config); err != nil {
+		return config, err
 	}
 
-	if config.Destination.Type == "" {
-		return config, errors.New("configuration appears to be missing a Destination configuration")
+	for _, destination := range config.DestinationConfigs() {
+		if len(config.AttributeMap) == 0 && len(destination.AttributeMap) == 0 {
+			return config, errors.New("configuration appears to be missing an AttributeMap")
+		}
 	}
 
-	if len(config.AttributeMap) == 0 {
-		return config, errors.New("configuration appears to be missing an AttributeMap")
+	if err := loadSyncSetManifests(&config, configFile); err != nil {
+		return config, err
+	}
+
+	if err := expandSyncSetTemplates(&config); err != nil {
+		return config, err
+	}
+
+	if err := validateSyncSetGroupings(config.SyncSetGroupings); err != nil {
+		return config, err
+	}
+
+	for _, attrMap := range config.allAttributeMaps() {
+		switch attrMap.UpdateMode {
+		case "", UpdateModeOverwrite, UpdateModeFillIfEmpty, UpdateModeIgnore:
+		case UpdateModeBackfill:
+			// a value hidden by the PrivacyAttribute would be backfilled from the destination instead
+			if attrMap.PrivacyAttribute != "" {
+				return config, fmt.Errorf("UpdateMode %q for attribute %s cannot be used with a PrivacyAttribute",
+					attrMap.UpdateMode, attrMap.Destination)
+			}
+		default:
+			return config, fmt.Errorf("invalid UpdateMode %q for attribute %s", attrMap.UpdateMode,
+				attrMap.Destination)
+		}
 	}
 
-	log.Printf("Configuration loaded. Source type: %s, Destination type: %s\n", config.Source.Type, config.Destination.Type)
+	for _, attrMap := range config.allAttributeMaps() {
+		switch attrMap.OverflowPolicy {
+		case "", OverflowTruncate, OverflowSkip, OverflowFail:
+		default:
+			return config, fmt.Errorf("invalid OverflowPolicy %q for attribute %s", attrMap.OverflowPolicy,
+				attrMap.Destination)
+		}
+		if attrMap.MaxLength < 0 {
+			return config, fmt.Errorf("MaxLength for attribute %s must not be negative", attrMap.Destination)
+		}
+	}
+
+	if config.IDLink.SourceAttribute != "" && config.State.Type == "" {
+		return config, errors.New("IDLink requires a State store to be configured")
+	}
+
+	if config.Quarantine.Threshold > 0 && config.State.Type == "" {
+		return config, errors.New("Quarantine requires a State store to be configured")
+	}
+
+	for _, attrMap := range config.allAttributeMaps() {
+		if attrMap.UpdateWindowHours > 0 && config.State.Type == "" {
+			return config, fmt.Errorf("UpdateWindowHours for attribute %s requires a State store to be configured",
+				attrMap.Destination)
+		}
+	}
+
+	for _, destination := range config.DestinationConfigs() {
+		if config.SyncTargets.Attribute != "" && destination.SyncTarget == "" {
+			return config, errors.New("SyncTargets requires the Destination SyncTarget to be set")
+		}
+	}
+
+	if err := validateInactivity(config.Inactivity, config.State.Type); err != nil {
+		return config, err
+	}
+
+	if err := config.Anonymize.validate(); err != nil {
+		return config, err
+	}
+
+	if err := config.Protected.validate(); err != nil {
+		return config, err
+	}
+
+	if err := config.GrowthGuard.validate(); err != nil {
+		return config, err
+	}
+
+	if err := validateApplyOrder(config.ApplyOrder); err != nil {
+		return config, err
+	}
+
+	if err := validateEventLogFormat(config.Runtime.EventLogFormat); err != nil {
+		return config, err
+	}
+
+	for _, syncSet := range config.SyncSets {
+		if syncSet.Filter == "" {
+			continue
+		}
+		if _, err := parseFilter(syncSet.Filter); err != nil {
+			return config, fmt.Errorf("invalid Filter for sync set %s: %s", syncSet.Name, err)
+		}
+	}
+
+	if err := validateCompareKeys(config.Compare.Keys); err != nil {
+		return config, err
+	}
+
+	if err := validateNormalizers(config.Compare.Normalizers); err != nil {
+		return config, err
+	}
+	for _, syncSet := range config.SyncSets {
+		if err := validateNormalizers(syncSet.CompareNormalizers); err != nil {
+			return config, fmt.Errorf("sync set %s: %s", syncSet.Name, err)
+		}
+	}
+
+	warnUnknownFeatures(config)
+	if err := validateFeatures(config); err != nil {
+		return config, err
+	}
+
+	if err := config.Alert.Validate(); err != nil {
+		return config, err
+	}
+
+	policy := config.Alert.Policy
+	if (policy.ConsecutiveFailures > 1 || policy.DigestHours > 0) && config.State.Type == "" {
+		return config, errors.New("the alert Policy requires a State store to be configured")
+	}
+
+	var destinationTypes []string
+	for _, destination := range config.DestinationConfigs() {
+		destinationTypes = append(destinationTypes, destination.Type)
+	}
+	sourceTypes := []string{config.Source.Type}
+	if len(config.Sources) > 0 {
+		sourceTypes = nil
+		for _, source := range config.Sources {
+			sourceTypes = append(sourceTypes, source.Type)
+		}
+	}
+	log.Printf("Configuration loaded. Source type: %s, Destination type: %s\n", strings.Join(sourceTypes, ", "),
+		strings.Join(destinationTypes, ", "))
 	log.Printf("%v Sync sets found:\n", len(config.SyncSets))
 
 	for i, syncSet := range config.SyncSets {
@@ -83,7 +237,8 @@ func LoadConfig(configFile string) (AppConfig, error) {
 // RemapToDestinationAttributes returns a slice of Person instances that each have
 // only the desired attributes based on the destination attribute keys.
 // If a required attribute is missing for a Person, then their disableChanges
-// value is set to true.
+// value is set to true. Values longer than the MaxLength are handled as set
+// by the OverflowPolicy.
 func RemapToDestinationAttributes(logger *log.Logger, sourcePersons []Person, attributeMap []AttributeMap) ([]Person, error) {
 	var peopleForDestination []Person
 
@@ -93,7 +248,35 @@ func RemapToDestinationAttributes(logger *log.Logger, sourcePersons []Person, at
 		// Build attrs with only attributes from destination map, disable changes on person missing a required attribute
 		disableChanges := false
 		for _, attrMap := range attributeMap {
+			if attrMap.PrivacyAttribute != "" && !isTrue(person.Attributes[attrMap.PrivacyAttribute]) {
+				attrs[attrMap.Destination] = ""
+				continue
+			}
 			if value, ok := person.Attributes[attrMap.Source]; ok {
+				if len(attrMap.ActiveValues) > 0 {
+					if strings.TrimSpace(value) == "" {
+						continue
+					}
+					value = attrMap.activeValue(value)
+				}
+				if len(attrMap.Values) > 0 {
+					value = attrMap.mappedValue(value)
+				}
+				if attrMap.overflows(value) {
+					switch attrMap.OverflowPolicy {
+					case OverflowSkip:
+						logger.Printf("%s of user %s is longer than %v characters, not syncing it",
+							attrMap.Destination, person.CompareValue, attrMap.MaxLength)
+						continue
+					case OverflowFail:
+						return nil, fmt.Errorf("%s of user %s is %v characters, more than the MaxLength of %v",
+							attrMap.Destination, person.CompareValue, len([]rune(value)), attrMap.MaxLength)
+					default:
+						logger.Printf("%s of user %s is longer than %v characters, truncating it",
+							attrMap.Destination, person.CompareValue, attrMap.MaxLength)
+						value = attrMap.truncate(value)
+					}
+				}
 				attrs[attrMap.Destination] = value
 			} else if attrMap.Required {
 				jsonAttrs, _ := json.Marshal(attrs)
@@ -106,6 +289,7 @@ func RemapToDestinationAttributes(logger *log.Logger, sourcePersons []Person, at
 			CompareValue:   person.CompareValue,
 			Attributes:     attrs,
 			DisableChanges: disableChanges,
+			SourceID:       person.SourceID,
 		})
 
 	}
@@ -113,27 +297,33 @@ func RemapToDestinationAttributes(logger *log.Logger, sourcePersons []Person, at
 	return peopleForDestination, nil
 }
 
-// getPersonFromList returns the person if found in peopleList otherwise an empty Person{}
-func getPersonFromList(compareValue string, peopleList []Person) Person {
-	lowerCompareValue := strings.ToLower(compareValue)
+// getPersonIndexFromList returns the index of the person if found in peopleList otherwise -1
+func getPersonIndexFromList(compareValue string, peopleList []Person) int {
+	if compareValue == "" {
+		return -1
+	}
 
-	for _, person := range peopleList {
-		if strings.ToLower(person.CompareValue) == lowerCompareValue {
-			return person
+	for i, person := range peopleList {
+		if diff.SameCompareValue(person.CompareValue, compareValue) {
+			return i
 		}
 	}
 
-	return Person{}
+	return -1
 }
 
 func personAttributesAreEqual(logger *log.Logger, sp, dp Person, config AppConfig) bool {
-	caseSensitivityList := getCaseSensitivitySourceAttributeList(config.AttributeMap)
+	attributeMaps := getAttributeMapsByDestination(config.AttributeMap)
 	equal := true
 	for key, val := range sp.Attributes {
-		if !stringsAreEqual(val, dp.Attributes[key], caseSensitivityList[key]) {
-			if config.Runtime.Verbosity >= VerbosityMedium {
+		attrMap := attributeMaps[key]
+		if !attributeValuesAreEqual(val, dp.Attributes[key], attrMap) {
+			if config.Runtime.Verbosity >= VerbosityMedium && attrMap.MaskChanges {
+				logger.Printf(`User: "%s", "%s" not equal`+"\n", sp.CompareValue, key)
+				equal = false
+			} else if config.Runtime.Verbosity >= VerbosityMedium {
 				logger.Printf(`User: "%s", "%s" not equal, CaseSensitive: "%t", Source: "%s", Dest: "%s"`+"\n",
-					sp.CompareValue, key, caseSensitivityList[key], val, dp.Attributes[key])
+					sp.CompareValue, key, attrMap.CaseSensitive, val, dp.Attributes[key])
 				equal = false
 			} else {
 				logger.Printf(`User: "%s" not equal`+"\n", key)
@@ -145,60 +335,182 @@ func personAttributesAreEqual(logger *log.Logger, sp, dp Person, config AppConfi
 	return equal
 }
 
-func stringsAreEqual(val1, val2 string, caseSensitive bool) bool {
-	if caseSensitive {
-		return val1 == val2
+// attributeChanges returns the attributes of sp whose values differ from those of dp, sorted by attribute name
+func attributeChanges(sp, dp Person, attributeMap []AttributeMap) []AttributeChange {
+	attributeMaps := getAttributeMapsByDestination(attributeMap)
+	var changes []AttributeChange
+	for key, val := range sp.Attributes {
+		attrMap := attributeMaps[key]
+		if !attributeValuesAreEqual(val, dp.Attributes[key], attrMap) {
+			changes = append(changes, AttributeChange{
+				Attribute: key,
+				Old:       dp.Attributes[key],
+				New:       val,
+				Masked:    attrMap.MaskChanges,
+			})
+		}
 	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Attribute < changes[j].Attribute
+	})
+	return changes
+}
 
-	return strings.ToLower(val1) == strings.ToLower(val2)
+// attributeValuesAreEqual compares two values of an attribute as configured by its AttributeMap, with the
+// semantics of the diff package
+func attributeValuesAreEqual(val1, val2 string, attrMap AttributeMap) bool {
+	return diff.ValuesEqual(val1, val2, diff.AttributeMap{
+		CaseSensitive:       attrMap.CaseSensitive,
+		NormalizeWhitespace: attrMap.NormalizeWhitespace,
+		Multivalued:         attrMap.Multivalued,
+	})
 }
 
-func getCaseSensitivitySourceAttributeList(attributeMap []AttributeMap) map[string]bool {
-	results := map[string]bool{}
+// getAttributeMapsByDestination returns the AttributeMap entries keyed by destination attribute name
+func getAttributeMapsByDestination(attributeMap []AttributeMap) map[string]AttributeMap {
+	results := map[string]AttributeMap{}
 
 	for _, attrMap := range attributeMap {
-		results[attrMap.Destination] = attrMap.CaseSensitive
+		results[attrMap.Destination] = attrMap
 	}
 
 	return results
 }
 
+// applyUpdateModes returns a copy of sp in which the attributes that the source does not own on update are given
+// the destination value, so they are neither reported as a difference nor overwritten. A backfill attribute that the
+// source omits or leaves empty is given the destination value in the same way.
+func applyUpdateModes(sp, dp Person, attributeMap []AttributeMap) Person {
+	attrs := map[string]string{}
+	for key, val := range sp.Attributes {
+		attrs[key] = val
+	}
+
+	modified := false
+	for _, attrMap := range attributeMap {
+		key := attrMap.Destination
+		dpValue, inDestination := dp.Attributes[key]
+
+		switch attrMap.GetUpdateMode() {
+		case UpdateModeFillIfEmpty:
+			if dpValue != "" && dpValue != attrs[key] {
+				attrs[key] = dpValue
+				modified = true
+			}
+		case UpdateModeIgnore:
+			if !inDestination {
+				delete(attrs, key)
+				modified = true
+			} else if dpValue != attrs[key] {
+				attrs[key] = dpValue
+				modified = true
+			}
+		case UpdateModeBackfill:
+			if attrs[key] == "" && dpValue != "" {
+				attrs[key] = dpValue
+				modified = true
+			}
+		}
+	}
+
+	if modified {
+		sp.Attributes = attrs
+	}
+	return sp
+}
+
 // GenerateChangeSet builds the three slice attributes of a ChangeSet
 // (Create, Update and Delete) based on whether they are in the slice
 //  of destination Person instances.
 // It skips all source Person instances that have DisableChanges set to true
 func GenerateChangeSet(logger *log.Logger, sourcePeople, destinationPeople []Person, config AppConfig) ChangeSet {
+	changeSet, _ := generateLinkedChangeSet(logger, sourcePeople, destinationPeople, config, nil, nil)
+	return changeSet
+}
+
+// generateLinkedChangeSet is GenerateChangeSet for people that may be linked to a destination person by their
+// SourceID. It also returns the links for every source person that was matched to a destination person. If a
+// suppressor is given, updates to attributes that were updated too recently are left out.
+func generateLinkedChangeSet(logger *log.Logger, sourcePeople, destinationPeople []Person, config AppConfig,
+	links IDLinks, suppressor *updateSuppressor) (ChangeSet, IDLinks) {
+
 	var changeSet ChangeSet
+	matched := map[int]bool{}
+	newLinks := IDLinks{}
+
+	var keyMatches []int
+	if len(config.Compare.Keys) > 0 {
+		var err error
+		if keyMatches, err = matchByCompareKeys(config.Compare.Keys, sourcePeople, destinationPeople); err != nil {
+			logger.Printf("%s, matching by compare value instead", err)
+		}
+	}
+
+	normalizers := config.Compare.Normalizers
+	var normalized map[string]int
+	if len(normalizers) > 0 {
+		normalized = normalizedIndex(destinationPeople, normalizers)
+	}
+
+	index := newLinkIndex(destinationPeople, links)
 
 	// Find users who need to be created or updated
-	for _, sp := range sourcePeople {
+	for s, sp := range sourcePeople {
+		var candidate int
+		if keyMatches != nil {
+			candidate = keyMatches[s]
+		} else {
+			candidate = getNormalizedPersonIndex(sp.CompareValue, destinationPeople, normalizers, normalized)
+		}
+
+		i, linked := index.findDestinationPerson(sp, candidate)
+		if i >= 0 {
+			matched[i] = true
+			if sp.SourceID != "" {
+				newLinks[sp.SourceID] = destinationID(destinationPeople[i])
+			}
+		}
+
 		// If user was missing a required attribute, don't change their record
 		if sp.DisableChanges {
 			continue
 		}
 
-		destinationPerson := getPersonFromList(sp.CompareValue, destinationPeople)
-		if destinationPerson.CompareValue == "" {
+		if i < 0 {
 			changeSet.Create = append(changeSet.Create, sp)
 			continue
 		}
 
+		destinationPerson := destinationPeople[i]
+		if normalized != nil {
+			// the destination knows the person by its own compare value
+			sp.CompareValue = destinationPerson.CompareValue
+		}
+		if linked && !strings.EqualFold(sp.CompareValue, destinationPerson.CompareValue) {
+			sp.PreviousCompareValue = destinationPerson.CompareValue
+		}
+		sp = applyUpdateModes(sp, destinationPerson, config.AttributeMap)
+		sp = suppressor.apply(logger, sp, destinationPerson)
+
 		if !personAttributesAreEqual(logger, sp, destinationPerson, config) {
 			sp.ID = destinationPerson.Attributes["id"]
+			if sp.ID == "" {
+				sp.ID = destinationPerson.ID
+			}
+			sp.Changes = attributeChanges(sp, destinationPerson, config.AttributeMap)
 			changeSet.Update = append(changeSet.Update, sp)
 			continue
 		}
 	}
 
 	// Find users who need to be deleted
-	for _, dp := range destinationPeople {
-		sourcePerson := getPersonFromList(dp.CompareValue, sourcePeople)
-		if sourcePerson.CompareValue == "" {
+	for i, dp := range destinationPeople {
+		if !matched[i] {
 			changeSet.Delete = append(changeSet.Delete, dp)
 		}
 	}
 
-	return changeSet
+	return changeSet, newLinks
 }
 
 // RunSyncSet calls a number of functions to do the following ...
@@ -207,49 +519,378 @@ func GenerateChangeSet(logger *log.Logger, sourcePeople, destinationPeople []Per
 //  - it gets the list of people from the destination
 //  - it generates the lists of people to change, update and delete
 //  - if dryRun is true, it prints those lists, but otherwise makes the associated changes
-func RunSyncSet(logger *log.Logger, source Source, destination Destination, config AppConfig) error {
-	sourcePeople, err := source.ListUsers(GetSourceAttributes(config.AttributeMap))
-	if err != nil {
+// If a stateStore is provided, the result of the run is recorded in it for comparison on the next run, along with
+// the ID links if IDLink is configured.
+func RunSyncSet(logger *log.Logger, source Source, destination Destination, config AppConfig, syncSet SyncSet,
+	stateStore StateStore) error {
+
+	run, err := planSyncSet(logger, source, destination, config, syncSet, stateStore)
+	if err != nil || run.skip {
+		return err
+	}
+
+	if config.Destination.Shadow {
+		reportShadowChanges(logger, destination, config, syncSet, run.changeSet)
+		return nil
+	}
+
+	// If in DryRun mode only print out ChangeSet plans and return mocked change results based on plans
+	if config.Runtime.DryRunMode {
+		dryRunSyncSet(logger, destination, config, syncSet, run)
+		return nil
+	}
+
+	return applySyncSet(logger, destination, config, syncSet, stateStore, run)
+}
+
+// dryRunSyncSet prints the planned changes, checked by the destination if it can, instead of applying them
+func dryRunSyncSet(logger *log.Logger, destination Destination, config AppConfig, syncSet SyncSet, run syncSetRun) {
+	failures := validateChangeSet(destination, run.changeSet)
+
+	artifact := ""
+	if config.Runtime.ChangeSetDir != "" {
+		path, err := writeChangeSetFile(config.Runtime.ChangeSetDir, syncSet.Name, run.changeSet)
+		if err != nil {
+			logger.Println(err)
+		} else {
+			artifact = path
+		}
+	}
+	printChangeSet(logger, run.changeSet, failures, config.Runtime.GetMaxListedChanges(), artifact)
+	if err := addRemovedPeople(logger, config, syncSet, run.changeSet.Delete); err != nil {
+		logger.Println(err)
+	}
+}
+
+// syncSetRun holds the results of planning a sync set that are needed to apply it
+type syncSetRun struct {
+	sourcePeople []Person
+	sourceHash   string
+	changeSet    ChangeSet
+	links        IDLinks
+	matchedLinks IDLinks
+	quarantine   QuarantineState
+	suppressor   *updateSuppressor
+	inactive     []InactiveAccount
+	skip         bool
+}
+
+// planSyncSet lists the source and destination people and generates the ChangeSet, leaving out the changes of
+// operations disabled for the destination, without making any changes
+func planSyncSet(logger *log.Logger, source Source, destination Destination, config AppConfig, syncSet SyncSet,
+	stateStore StateStore) (syncSetRun, error) {
+
+	config = config.forSyncSet(syncSet)
+
+	var run syncSetRun
+	linking := config.IDLink.SourceAttribute != "" && stateStore != nil
+
+	targetsAttribute := config.SyncTargets.Attribute
+
+	hooks := config.Runtime.Hooks
+	// listing is retried if the API is rate limited, since nothing has been changed yet
+	retry := RetryConfig{Clock: config.Runtime.GetClock()}
+
+	hooks.phaseStart(syncSet.Name, PhaseListSource)
+	var sourcePeople []Person
+	err := retry.DoWithRetry(func() (err error) {
+		sourcePeople, err = source.ListUsers(appendFilterAttributes(sourceAttributes(config, linking), syncSet))
 		return err
+	})
+	hooks.phaseEnd(syncSet.Name, PhaseListSource, err)
+	if err != nil {
+		return run, err
 	}
 	if len(sourcePeople) == 0 {
-		return errors.New("no people found in source")
+		return run, errors.New("no people found in source")
 	}
 	logger.Printf("    Found %v people in source", len(sourcePeople))
 
+	held := newHeldPeople(config.Hold)
+	held.addFlagged(sourcePeople, config.Hold.SourceAttribute)
+
+	if targetsAttribute != "" {
+		var excluded int
+		sourcePeople, excluded = filterSyncTargets(sourcePeople, targetsAttribute, config.Destination.SyncTarget)
+		if excluded > 0 {
+			logger.Printf("    %v people in source are not synced to %s", excluded, config.Destination.SyncTarget)
+		}
+		if len(sourcePeople) == 0 {
+			return run, fmt.Errorf("no people in source are synced to %s", config.Destination.SyncTarget)
+		}
+	}
+
+	if syncSet.Filter != "" {
+		filter, err := parseFilter(syncSet.Filter)
+		if err != nil {
+			return run, fmt.Errorf("invalid Filter: %s", err)
+		}
+		var excluded int
+		sourcePeople, excluded, err = filterPeople(sourcePeople, filter, config.Runtime.GetClock().Now())
+		if err != nil {
+			return run, err
+		}
+		if excluded > 0 {
+			logger.Printf("    %v people in source are excluded by the Filter", excluded)
+		}
+		if len(sourcePeople) == 0 {
+			return run, errors.New("no people in source match the Filter")
+		}
+	}
+
+	if len(config.Anonymize.Attributes) > 0 {
+		anonymizePeople(sourcePeople, config.Anonymize)
+		logger.Printf("    Anonymized %v attributes of the people in source", len(config.Anonymize.Attributes))
+	}
+
+	if linking {
+		setSourceIDs(sourcePeople, config.IDLink.SourceAttribute)
+	}
+
 	// remap source people to destination attributes for comparison
-	sourcePeople, err = RemapToDestinationAttributes(logger, sourcePeople, config.AttributeMap)
+	run.sourcePeople, err = RemapToDestinationAttributes(logger, sourcePeople, config.AttributeMap)
 	if err != nil {
-		return err
+		return run, err
 	}
 
-	destinationPeople, err := destination.ListUsers(GetDestinationAttributes(config.AttributeMap))
-	if err != nil {
+	var lastState SyncSetState
+	haveState := false
+	run.sourceHash = hashPeople(run.sourcePeople)
+	if stateStore != nil {
+		haveState, err = stateStore.Load(syncSetStateKey(syncSet.Name), &lastState)
+		if err != nil {
+			logger.Printf("unable to load state, continuing with a full sync: %s", err)
+			haveState = false
+		}
+	}
+
+	destinationAttributes := GetDestinationAttributes(config.AttributeMap)
+	lastLoginAttribute := config.Inactivity.LastLoginAttribute
+	if config.Inactivity.Days > 0 && lastLoginAttribute != "" {
+		if found, _ := InArray(lastLoginAttribute, destinationAttributes); !found {
+			destinationAttributes = append(destinationAttributes, lastLoginAttribute)
+		}
+	}
+	if holdAttribute := config.Hold.DestinationAttribute; holdAttribute != "" {
+		if found, _ := InArray(holdAttribute, destinationAttributes); !found {
+			destinationAttributes = append(destinationAttributes, holdAttribute)
+		}
+	}
+
+	hooks.phaseStart(syncSet.Name, PhaseListDestination)
+	var destinationPeople []Person
+	err = retry.DoWithRetry(func() (err error) {
+		destinationPeople, err = destination.ListUsers(destinationAttributes)
 		return err
+	})
+	hooks.phaseEnd(syncSet.Name, PhaseListDestination, err)
+	if err != nil {
+		return run, err
 	}
 	logger.Printf("    Found %v people in destination", len(destinationPeople))
+	held.addFlagged(destinationPeople, config.Hold.DestinationAttribute)
+
+	if haveState {
+		drifted := reportDrift(logger, lastState, destinationPeople, config)
+
+		// a sync set is only skipped if the last run made all of its changes and nothing has changed since
+		if config.State.SkipUnchanged && !config.Destination.Shadow && lastState.SourceHash == run.sourceHash &&
+			!lastState.Dirty && !drifted {
+			logger.Printf("    Source and destination are unchanged since last run at %s, skipping",
+				lastState.LastRun.UTC().Format(time.RFC1123Z))
+			run.skip = true
+			return run, nil
+		}
+	}
 
-	changeSet := GenerateChangeSet(logger, sourcePeople, destinationPeople, config)
+	if linking {
+		if _, err := stateStore.Load(idLinksKey(config.Destination.Type, syncSet.Name), &run.links); err != nil {
+			logger.Printf("unable to load ID links, matching by compare value only: %s", err)
+		}
+	}
 
-	// If in DryRun mode only print out ChangeSet plans and return mocked change results based on plans
-	if config.Runtime.DryRunMode {
-		printChangeSet(logger, changeSet)
-		return nil
+	if stateStore != nil {
+		var history UpdateHistory
+		if _, err := stateStore.Load(updateHistoryKey(syncSet.Name), &history); err != nil {
+			logger.Printf("unable to load update history, no updates are suppressed: %s", err)
+		}
+		run.suppressor = newUpdateSuppressor(history, config.AttributeMap, config.Runtime.GetClock().Now())
+	}
+
+	run.changeSet, run.matchedLinks = generateLinkedChangeSet(logger, run.sourcePeople, destinationPeople, config,
+		run.links, run.suppressor)
+
+	var protected []ProtectedChange
+	run.changeSet, protected, err = protectAccounts(run.changeSet, config.Protected)
+	if err != nil {
+		return run, err
+	}
+	printProtected(logger, protected)
+
+	var onHold []HeldChange
+	run.changeSet, onHold = held.apply(run.changeSet)
+	printHeld(logger, onHold)
+
+	if config.Runtime.OrphanReport {
+		now := config.Runtime.GetClock().Now()
+		printOrphans(logger, findOrphans(run.changeSet.Delete, now, config.Runtime.GetOrphanRecentDays()), now,
+			config.Runtime.GetMaxListedChanges())
+	}
+
+	if config.Inactivity.Days > 0 {
+		now := config.Runtime.GetClock().Now()
+		run.inactive = findInactive(destinationPeople, run.changeSet.Delete, lastLoginAttribute,
+			config.Inactivity.Days, now)
+		printInactive(logger, run.inactive, config.Inactivity.Days, now, config.Runtime.GetMaxListedChanges())
+	}
+
+	var disabled DisabledChanges
+	run.changeSet, disabled = removeDisabledChanges(run.changeSet, config.Destination)
+	printDisabled(logger, disabled)
+
+	if config.Quarantine.Threshold > 0 && stateStore != nil {
+		var state QuarantineState
+		if _, err := stateStore.Load(quarantineKey(syncSet.Name), &state); err != nil {
+			logger.Printf("unable to load quarantine state, no one is quarantined: %s", err)
+		}
+		var skipped []QuarantinedChange
+		run.changeSet, skipped, run.quarantine = applyQuarantine(run.changeSet, state, config, config.Runtime.GetClock().Now())
+		printQuarantined(logger, skipped)
+	}
+
+	if !config.Destination.Shadow {
+		if err := checkGrowth(config, syncSet.Name, len(destinationPeople), run.changeSet); err != nil {
+			if !config.Runtime.DryRunMode {
+				return run, err
+			}
+			logger.Printf("    %s", err)
+		}
+	}
+
+	run.changeSet, err = orderChangeSet(run.changeSet, config.ApplyOrder, config.Runtime.GetClock().Now())
+	if err != nil {
+		logger.Printf("    %s, changes are applied after those that can be ordered", err)
+	}
+
+	return run, nil
+}
+
+// sourceAttributes returns the source attributes to list: those in the AttributeMap, the IDLink SourceAttribute if
+// linking, the SyncTargets Attribute, and the Hold SourceAttribute
+func sourceAttributes(config AppConfig, linking bool) []string {
+	attributes := GetSourceAttributes(config.AttributeMap)
+	if linking && config.IDLink.SourceAttribute != "" {
+		if found, _ := InArray(config.IDLink.SourceAttribute, attributes); !found {
+			attributes = append(attributes, config.IDLink.SourceAttribute)
+		}
+	}
+	if config.SyncTargets.Attribute != "" {
+		if found, _ := InArray(config.SyncTargets.Attribute, attributes); !found {
+			attributes = append(attributes, config.SyncTargets.Attribute)
+		}
+	}
+	if config.Hold.SourceAttribute != "" {
+		if found, _ := InArray(config.Hold.SourceAttribute, attributes); !found {
+			attributes = append(attributes, config.Hold.SourceAttribute)
+		}
 	}
+	return attributes
+}
+
+// applySyncSet makes the changes in the ChangeSet and records the new state. It returns a FailureThresholdError if
+// too many changes failed, or an error if the removed people could not be added to the OnDelete destination.
+func applySyncSet(logger *log.Logger, destination Destination, config AppConfig, syncSet SyncSet,
+	stateStore StateStore, run syncSetRun) error {
+
+	config = config.forSyncSet(syncSet)
 
 	// Create a channel to pass activity logs for printing
+	hooks := config.Runtime.Hooks
+	hooks.phaseStart(syncSet.Name, PhaseApply)
+	progress := newChangeProgress(hooks, syncSet.Name, run.changeSet)
+
 	eventLog := make(chan EventLogItem, 50)
-	go processEventLog(logger, config.Alert, eventLog)
+	counts := make(chan eventCounts)
+	go func() {
+		var summary *eventSummary
+		if config.Runtime.Verbosity < VerbosityMedium {
+			summary = newEventSummary(syncSet.Name)
+		}
+		counts <- processEventLog(logger, config, syncSet.Name, progress, summary, eventLog)
+	}()
 
-	results := destination.ApplyChangeSet(changeSet, eventLog)
+	if run.suppressor != nil {
+		for _, conflict := range run.suppressor.conflicts {
+			eventLog <- EventLogItem{Level: syslog.LOG_ALERT, Category: ErrorCategoryConflict, Message: conflict}
+		}
+	}
+
+	run.changeSet.PartialUpdates = config.FeatureEnabled(FeaturePartialUpdates)
+	results := destination.ApplyChangeSet(run.changeSet, eventLog)
+	close(eventLog)
+	events := <-counts
+	results.Errors, results.Failures = events.split()
+	hooks.phaseEnd(syncSet.Name, PhaseApply, nil)
+	hooks.results(syncSet.Name, results)
+	config.Runtime.Results.add(syncSet.Name, config.Destination, results)
 
 	logger.Printf("Sync results: %v users added, %v users updated, %v users removed\n",
 		results.Created, results.Updated, results.Deleted)
+	if len(results.Errors) > 0 {
+		logger.Printf("Errors by category: %s\n", formatErrorCounts(results.Errors))
+	}
+	reportErrorThreshold(config.Alert, syncSet.Name, results)
+	failureErr := checkFailureThresholds(config, syncSet.Name, results)
 
-	time.Sleep(time.Millisecond * 10)
-	close(eventLog)
+	if err := addRemovedPeople(logger, config, syncSet, run.changeSet.Delete); err != nil {
+		logger.Println(err)
+		if failureErr == nil {
+			failureErr = err
+		}
+	}
 
-	return nil
+	if config.Inactivity.Days > 0 {
+		reportInactive(logger, config, syncSet, stateStore, run.inactive)
+	}
+
+	if stateStore == nil {
+		return failureErr
+	}
+
+	if config.IDLink.SourceAttribute != "" {
+		if len(run.changeSet.Create) > 0 {
+			linkCreatedPeople(logger, destination, config, run.changeSet.Create, run.matchedLinks)
+		}
+		deleted := succeededDeletes(run.changeSet.Delete, results.Deleted, events)
+		links := updateIDLinks(run.links, run.matchedLinks, deleted)
+		if err := stateStore.Save(idLinksKey(config.Destination.Type, syncSet.Name), links); err != nil {
+			logger.Printf("unable to save ID links: %s", err)
+		}
+	}
+
+	if run.quarantine != nil {
+		if err := stateStore.Save(quarantineKey(syncSet.Name), run.quarantine); err != nil {
+			logger.Printf("unable to save quarantine state: %s", err)
+		}
+	}
+
+	if run.suppressor != nil {
+		history := run.suppressor.updatedHistory(run.changeSet.Update)
+		if err := stateStore.Save(updateHistoryKey(syncSet.Name), history); err != nil {
+			logger.Printf("unable to save update history: %s", err)
+		}
+	}
+
+	newState := SyncSetState{
+		LastRun:    config.Runtime.GetClock().Now(),
+		SourceHash: run.sourceHash,
+		Applied:    run.sourcePeople,
+		Dirty:      len(results.Errors) > 0,
+	}
+	if err := stateStore.Save(syncSetStateKey(syncSet.Name), newState); err != nil {
+		logger.Printf("unable to save state: %s", err)
+	}
+	return failureErr
 }
 
 func GetSourceAttributes(attrMap []AttributeMap) []string {
@@ -258,9 +899,28 @@ func GetSourceAttributes(attrMap []AttributeMap) []string {
 		keys = append(keys, attrMap.Source)
 	}
 
+	// privacy attributes are needed to decide what to share, but are not synced themselves
+	for _, attrMap := range attrMap {
+		if attrMap.PrivacyAttribute == "" {
+			continue
+		}
+		if found, _ := InArray(attrMap.PrivacyAttribute, keys); !found {
+			keys = append(keys, attrMap.PrivacyAttribute)
+		}
+	}
+
 	return keys
 }
 
+// isTrue interprets common representations of a boolean source value
+func isTrue(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "yes", "y", "1":
+		return true
+	}
+	return false
+}
+
 func GetDestinationAttributes(attrMap []AttributeMap) []string {
 	var keys []string
 	for _, attrMap := range attrMap {
@@ -270,33 +930,139 @@ func GetDestinationAttributes(attrMap []AttributeMap) []string {
 	return keys
 }
 
-func processEventLog(logger *log.Logger, config alert.Config, eventLog <-chan EventLogItem) {
+// processEventLog logs each event and passes it to the alerter, until eventLog is closed. Errors that have no Category are
+// classified by their message. Each event is given the sync set name and the config's Destination, and is logged as
+// text or JSON as set by the Runtime EventLogFormat. If summary is not nil, informational events are counted in it
+// instead of logged, and the summary is logged at the end. It returns the number of errors in each category and of
+// each failed operation.
+func processEventLog(logger *log.Logger, config AppConfig, syncSetName string, progress *changeProgress,
+	summary *eventSummary, eventLog <-chan EventLogItem) eventCounts {
+
+	alerter := config.GetAlerter()
+	var counts eventCounts
 	for msg := range eventLog {
-		logger.Println(msg)
-		if msg.Level == syslog.LOG_ALERT || msg.Level == syslog.LOG_EMERG {
-			alert.SendEmail(config, msg.String())
+		msg = describeEvent(msg, syncSetName, config.Destination)
+		if msg.Level <= syslog.LOG_ERR {
+			if msg.Category == "" && msg.Error != "" {
+				msg.Category = ClassifyMessage(msg.Error)
+			} else if msg.Category == "" {
+				msg.Category = ClassifyMessage(msg.Message)
+			}
+			counts.addError(msg)
+		}
+		if summary == nil || !summary.add(msg) {
+			if config.Runtime.EventLogFormat == EventLogFormatJSON {
+				_, _ = fmt.Fprintln(logger.Writer(), msg.JSON())
+			} else {
+				logger.Println(msg.String())
+			}
+		}
+		alerter.SyncSetEvent(syncSetName, msg)
+		progress.event(msg)
+	}
+	if summary != nil && len(summary.actions) > 0 {
+		logger.Println(summary.String())
+	}
+	return counts
+}
+
+// reportErrorThreshold triggers a PagerDuty incident if the number of errors reached the configured threshold, or
+// otherwise resolves any incident for the sync set
+func reportErrorThreshold(config alert.Config, syncSetName string, results ChangeResults) {
+	var total uint64
+	for _, n := range results.Errors {
+		total += n
+	}
+
+	threshold := config.PagerDuty.ErrorThreshold
+	if threshold > 0 && total >= uint64(threshold) {
+		alert.TriggerIncident(config, syncSetName, fmt.Sprintf("Sync set %s had %v errors (%s)", syncSetName, total,
+			formatErrorCounts(results.Errors)))
+		return
+	}
+	alert.ResolveIncident(config, syncSetName)
+}
+
+// formatErrorCounts returns a summary such as "auth: 1, validation: 2"
+func formatErrorCounts(errorCounts map[ErrorCategory]uint64) string {
+	var parts []string
+	for _, category := range ErrorCategories {
+		if n := errorCounts[category]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %v", category, n))
 		}
 	}
+	return strings.Join(parts, ", ")
 }
 
-func printChangeSet(logger *log.Logger, changeSet ChangeSet) {
+// printChangeSet lists the planned changes. Any change listed in failures is marked with the reason it would fail.
+// At most maxListed changes of each type are listed, or all if maxListed is negative. If the lists are truncated,
+// artifact tells where the full ChangeSet can be found.
+func printChangeSet(logger *log.Logger, changeSet ChangeSet, failures map[string]string, maxListed int,
+	artifact string) {
+
 	logger.Printf("ChangeSet Plans: Create %v, Update %v, Delete %v\n",
 		len(changeSet.Create), len(changeSet.Update), len(changeSet.Delete))
+	if len(failures) > 0 {
+		logger.Printf("%v planned changes would fail validation\n", len(failures))
+	}
+
+	truncated := false
 
 	logger.Println("Users to be created...")
-	for i, user := range changeSet.Create {
-		logger.Printf("  %v) %s", i+1, user.CompareValue)
-	}
+	truncated = printPlannedChanges(logger, changeSet.Create, failures, maxListed) || truncated
 
 	logger.Println("Users to be updated...")
-	for i, user := range changeSet.Update {
-		logger.Printf("  %v) %s", i+1, user.CompareValue)
-	}
+	truncated = printPlannedChanges(logger, changeSet.Update, failures, maxListed) || truncated
 
 	logger.Println("Users to be deleted...")
-	for i, user := range changeSet.Delete {
+	truncated = printPlannedChanges(logger, changeSet.Delete, failures, maxListed) || truncated
+
+	if truncated && artifact != "" {
+		logger.Printf("The full list of changes is in %s\n", artifact)
+	}
+}
+
+// printPlannedChanges lists up to maxListed people and returns true if any were left out
+func printPlannedChanges(logger *log.Logger, people []Person, failures map[string]string, maxListed int) bool {
+	for i, user := range people {
+		if maxListed >= 0 && i >= maxListed {
+			logger.Printf("  ... and %v more", len(people)-i)
+			return true
+		}
+		if reason, ok := failures[user.CompareValue]; ok {
+			logger.Printf("  %v) %s  WOULD FAIL: %s", i+1, user.CompareValue, reason)
+			continue
+		}
+		if len(user.Changes) > 0 {
+			logger.Printf("  %v) %s: %s", i+1, user.CompareValue, user.FormatChanges())
+			continue
+		}
 		logger.Printf("  %v) %s", i+1, user.CompareValue)
 	}
+	return false
+}
+
+// writeChangeSetFile writes the ChangeSet as JSON to a file named for the sync set in dir, and returns its path
+func writeChangeSetFile(dir, syncSetName string, changeSet ChangeSet) (string, error) {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, syncSetName)
+	if name == "" {
+		name = "changeset"
+	}
+	path := filepath.Join(dir, name+".json")
+
+	data, err := json.MarshalIndent(changeSet, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal change set: %s", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("unable to write change set file %s: %s", path, err)
+	}
+	return path, nil
 }
 
 // This function will search element inside array with any type.
@@ -350,7 +1116,12 @@ func (e *EmptySource) ListUsers(desiredAttrs []string) ([]Person, error) {
 // Init sets the startTime to the current time,
 //    sets the endTime based on secondsPerBatch into the future
 func NewBatchTimer(batchSize, secondsPerBatch int) BatchTimer {
-	b := BatchTimer{}
+	return NewBatchTimerWithClock(batchSize, secondsPerBatch, SystemClock)
+}
+
+// NewBatchTimerWithClock is NewBatchTimer using the given Clock
+func NewBatchTimerWithClock(batchSize, secondsPerBatch int, clock Clock) BatchTimer {
+	b := BatchTimer{Clock: clock}
 	b.Init(batchSize, secondsPerBatch)
 	return b
 }
@@ -365,12 +1136,13 @@ type BatchTimer struct {
 	Counter         int
 	SecondsPerBatch int
 	BatchSize       int
+	Clock           Clock
 }
 
 // Init sets the startTime to the current time,
 //    sets the endTime based on secondsPerBatch into the future
 func (b *BatchTimer) Init(batchSize, secondsPerBatch int) {
-	b.startTime = time.Now()
+	b.startTime = b.clock().Now()
 	b.setEndTime()
 	b.SecondsPerBatch = secondsPerBatch
 	b.BatchSize = batchSize
@@ -380,7 +1152,7 @@ func (b *BatchTimer) Init(batchSize, secondsPerBatch int) {
 func (b *BatchTimer) setEndTime() {
 	var emptyTime time.Time
 	if b.startTime == emptyTime {
-		b.startTime = time.Now()
+		b.startTime = b.clock().Now()
 	}
 	b.endTime = b.startTime.Add(time.Second * time.Duration(b.SecondsPerBatch))
 }
@@ -396,20 +1168,29 @@ func (b *BatchTimer) WaitOnBatch() {
 	}
 
 	for {
-		currTime := time.Now()
+		currTime := b.clock().Now()
 		if currTime.After(b.endTime) {
 			break
 		}
-		time.Sleep(time.Second)
+		b.clock().Sleep(time.Second)
 	}
 	b.Init(b.BatchSize, b.SecondsPerBatch)
 }
 
+func (b *BatchTimer) clock() Clock {
+	if b.Clock == nil {
+		return SystemClock
+	}
+	return b.Clock
+}
+
 func (a *AppConfig) MaxSyncSetNameLength() int {
 	maxLength := 0
 	for _, set := range a.SyncSets {
-		if maxLength < len(set.Name) {
-			maxLength = len(set.Name)
+		for _, destination := range a.SyncSetDestinations(set) {
+			if maxLength < len(destination.SyncSet.Name) {
+				maxLength = len(destination.SyncSet.Name)
+			}
 		}
 	}
 	return maxLength
@@ -1,11 +1,20 @@
 package internal
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"math/rand"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/silinternational/personnel-sync/v5/pkg/diff"
 )
 
 func TestGenerateChangeSet(t *testing.T) {
@@ -40,6 +49,7 @@ func TestGenerateChangeSet(t *testing.T) {
 						Attributes: map[string]string{
 							"name": "case sensitive",
 						},
+						Changes: []AttributeChange{{Attribute: "name", Old: "CASE SENSITIVE", New: "case sensitive"}},
 					},
 				},
 			},
@@ -160,6 +170,32 @@ func TestBatchTimer(t *testing.T) {
 	}
 }
 
+func TestBatchTimer_Clock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	bTimer := NewBatchTimerWithClock(2, 10, clock)
+
+	// the first batch ends when it starts, because Init sets the end time before SecondsPerBatch, so it only waits
+	// for the one second granularity of WaitOnBatch
+	for i := 0; i < 2; i++ {
+		bTimer.WaitOnBatch()
+	}
+	if clock.Slept() != time.Second {
+		t.Errorf("first batch waited %s, want 1s", clock.Slept())
+	}
+
+	// later batches wait until SecondsPerBatch have passed since the batch started
+	bTimer.WaitOnBatch()
+	clock.Advance(4 * time.Second)
+	bTimer.WaitOnBatch()
+	if clock.Slept() != 8*time.Second {
+		t.Errorf("batches waited %s in total, want 8s", clock.Slept())
+	}
+	if want := start.Add(11 * time.Second); !clock.Now().After(want) {
+		t.Errorf("second batch ended at %s, want after %s", clock.Now(), want)
+	}
+}
+
 func TestIDSetForUpdate(t *testing.T) {
 	sourcePeople := []Person{
 		{
@@ -231,3 +267,561 @@ func TestIDSetForUpdate(t *testing.T) {
 		}
 	}
 }
+
+func TestRemapToDestinationAttributes_PrivacyAttribute(t *testing.T) {
+	attributeMap := []AttributeMap{
+		{Source: "email", Destination: "email", Required: true},
+		{Source: "dob", Destination: "birthday", PrivacyAttribute: "shareBirthday"},
+	}
+
+	sourcePeople := []Person{
+		{
+			CompareValue: "shared@example.com",
+			Attributes:   map[string]string{"email": "shared@example.com", "dob": "1980-01-01", "shareBirthday": "Yes"},
+		},
+		{
+			CompareValue: "private@example.com",
+			Attributes:   map[string]string{"email": "private@example.com", "dob": "1980-01-01", "shareBirthday": "false"},
+		},
+		{
+			CompareValue: "unset@example.com",
+			Attributes:   map[string]string{"email": "unset@example.com", "dob": "1980-01-01"},
+		},
+	}
+
+	want := []Person{
+		{
+			CompareValue: "shared@example.com",
+			Attributes:   map[string]string{"email": "shared@example.com", "birthday": "1980-01-01"},
+		},
+		{
+			CompareValue: "private@example.com",
+			Attributes:   map[string]string{"email": "private@example.com", "birthday": ""},
+		},
+		{
+			CompareValue: "unset@example.com",
+			Attributes:   map[string]string{"email": "unset@example.com", "birthday": ""},
+		},
+	}
+
+	logger := log.New(os.Stdout, "", 0)
+	got, err := RemapToDestinationAttributes(logger, sourcePeople, attributeMap)
+	if err != nil {
+		t.Fatalf("RemapToDestinationAttributes() error = %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RemapToDestinationAttributes() = %v, want %v", got, want)
+	}
+
+	wantAttrs := []string{"email", "dob", "shareBirthday"}
+	if gotAttrs := GetSourceAttributes(attributeMap); !reflect.DeepEqual(gotAttrs, wantAttrs) {
+		t.Errorf("GetSourceAttributes() = %v, want %v", gotAttrs, wantAttrs)
+	}
+}
+
+func TestRemapToDestinationAttributes_ActiveValues(t *testing.T) {
+	attributeMap := []AttributeMap{
+		{Source: "email", Destination: "email", Required: true},
+		{Source: "status", Destination: "enabled", ActiveValues: []string{"Active", "Leave"}},
+	}
+
+	sourcePeople := []Person{
+		{CompareValue: "a@example.com", Attributes: map[string]string{"email": "a@example.com", "status": "active"}},
+		{CompareValue: "b@example.com", Attributes: map[string]string{"email": "b@example.com", "status": "Leave"}},
+		{CompareValue: "c@example.com", Attributes: map[string]string{"email": "c@example.com", "status": "Terminated"}},
+		{CompareValue: "d@example.com", Attributes: map[string]string{"email": "d@example.com", "status": " "}},
+	}
+
+	want := []Person{
+		{CompareValue: "a@example.com", Attributes: map[string]string{"email": "a@example.com", "enabled": "true"}},
+		{CompareValue: "b@example.com", Attributes: map[string]string{"email": "b@example.com", "enabled": "true"}},
+		{CompareValue: "c@example.com", Attributes: map[string]string{"email": "c@example.com", "enabled": "false"}},
+		{CompareValue: "d@example.com", Attributes: map[string]string{"email": "d@example.com"}},
+	}
+
+	got, err := RemapToDestinationAttributes(log.New(ioutil.Discard, "", 0), sourcePeople, attributeMap)
+	if err != nil {
+		t.Fatalf("RemapToDestinationAttributes() error = %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RemapToDestinationAttributes() = %v, want %v", got, want)
+	}
+}
+
+func TestRemapToDestinationAttributes_Values(t *testing.T) {
+	attributeMap := []AttributeMap{
+		{Source: "email", Destination: "email", Required: true},
+		{Source: "isManager", Destination: "Role", Values: map[string]string{"true": "MANAGER", "false": "MEMBER"}},
+	}
+
+	sourcePeople := []Person{
+		{CompareValue: "a@example.com", Attributes: map[string]string{"email": "a@example.com", "isManager": " TRUE"}},
+		{CompareValue: "b@example.com", Attributes: map[string]string{"email": "b@example.com", "isManager": "false"}},
+		{CompareValue: "c@example.com", Attributes: map[string]string{"email": "c@example.com", "isManager": "OWNER"}},
+	}
+
+	want := []Person{
+		{CompareValue: "a@example.com", Attributes: map[string]string{"email": "a@example.com", "Role": "MANAGER"}},
+		{CompareValue: "b@example.com", Attributes: map[string]string{"email": "b@example.com", "Role": "MEMBER"}},
+		{CompareValue: "c@example.com", Attributes: map[string]string{"email": "c@example.com", "Role": "OWNER"}},
+	}
+
+	got, err := RemapToDestinationAttributes(log.New(ioutil.Discard, "", 0), sourcePeople, attributeMap)
+	if err != nil {
+		t.Fatalf("RemapToDestinationAttributes() error = %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RemapToDestinationAttributes() = %v, want %v", got, want)
+	}
+}
+
+func TestRemapToDestinationAttributes_MaxLength(t *testing.T) {
+	sourcePeople := []Person{
+		{CompareValue: "a@example.com", Attributes: map[string]string{"email": "a@example.com", "title": "Director"}},
+		{CompareValue: "b@example.com", Attributes: map[string]string{"email": "b@example.com", "title": "Head of é ops"}},
+	}
+
+	tests := []struct {
+		name    string
+		policy  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "truncate", policy: "", want: map[string]string{"email": "b@example.com", "title": "Head of é"}},
+		{name: "skip", policy: OverflowSkip, want: map[string]string{"email": "b@example.com"}},
+		{name: "fail", policy: OverflowFail, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attributeMap := []AttributeMap{
+				{Source: "email", Destination: "email", Required: true},
+				{Source: "title", Destination: "title", MaxLength: 10, OverflowPolicy: tt.policy},
+			}
+			got, err := RemapToDestinationAttributes(log.New(ioutil.Discard, "", 0), sourcePeople, attributeMap)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("RemapToDestinationAttributes() did not return an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RemapToDestinationAttributes() error = %s", err)
+			}
+			if got[0].Attributes["title"] != "Director" {
+				t.Errorf("RemapToDestinationAttributes() changed a short value to %q", got[0].Attributes["title"])
+			}
+			if !reflect.DeepEqual(got[1].Attributes, tt.want) {
+				t.Errorf("RemapToDestinationAttributes() = %v, want %v", got[1].Attributes, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateChangeSet_WriteOnce(t *testing.T) {
+	config := AppConfig{
+		AttributeMap: []AttributeMap{
+			{Source: "email", Destination: "email", Required: true},
+			{Source: "first_name", Destination: "preferredName", WriteOnce: true},
+			{Source: "title", Destination: "title"},
+		},
+	}
+
+	sourcePeople := []Person{
+		{
+			CompareValue: "edited@example.com",
+			Attributes:   map[string]string{"email": "edited@example.com", "preferredName": "Robert", "title": "Dev"},
+		},
+		{
+			CompareValue: "empty@example.com",
+			Attributes:   map[string]string{"email": "empty@example.com", "preferredName": "Jennifer", "title": "Dev"},
+		},
+		{
+			CompareValue: "retitled@example.com",
+			Attributes:   map[string]string{"email": "retitled@example.com", "preferredName": "William", "title": "Lead"},
+		},
+	}
+
+	destinationPeople := []Person{
+		{
+			CompareValue: "edited@example.com",
+			Attributes:   map[string]string{"email": "edited@example.com", "preferredName": "Bob", "title": "Dev"},
+		},
+		{
+			CompareValue: "empty@example.com",
+			Attributes:   map[string]string{"email": "empty@example.com", "preferredName": "", "title": "Dev"},
+		},
+		{
+			CompareValue: "retitled@example.com",
+			Attributes:   map[string]string{"email": "retitled@example.com", "preferredName": "Bill", "title": "Dev"},
+		},
+	}
+
+	want := []Person{
+		{
+			CompareValue: "empty@example.com",
+			Attributes:   map[string]string{"email": "empty@example.com", "preferredName": "Jennifer", "title": "Dev"},
+			Changes:      []AttributeChange{{Attribute: "preferredName", Old: "", New: "Jennifer"}},
+		},
+		{
+			CompareValue: "retitled@example.com",
+			Attributes:   map[string]string{"email": "retitled@example.com", "preferredName": "Bill", "title": "Lead"},
+			Changes:      []AttributeChange{{Attribute: "title", Old: "Dev", New: "Lead"}},
+		},
+	}
+
+	logger := log.New(os.Stdout, "", 0)
+	changeSet := GenerateChangeSet(logger, sourcePeople, destinationPeople, config)
+	if !reflect.DeepEqual(changeSet.Update, want) {
+		t.Errorf("GenerateChangeSet() Update = %v, want %v", changeSet.Update, want)
+	}
+	if sourcePeople[2].Attributes["preferredName"] != "William" {
+		t.Error("GenerateChangeSet() modified the source attributes")
+	}
+}
+
+type validatingDestination struct {
+	testDestination
+	validated bool
+}
+
+func (v *validatingDestination) ValidateChangeSet(changes ChangeSet) map[string]string {
+	v.validated = true
+	return map[string]string{"bad@example.com": "too long"}
+}
+
+func TestRunSyncSet_DryRunValidation(t *testing.T) {
+	config := AppConfig{
+		Runtime:      RuntimeConfig{DryRunMode: true},
+		AttributeMap: []AttributeMap{{Source: "email", Destination: "email", Required: true}},
+	}
+	source := &testSource{people: []Person{
+		{CompareValue: "good@example.com", Attributes: map[string]string{"email": "good@example.com"}},
+		{CompareValue: "bad@example.com", Attributes: map[string]string{"email": "bad@example.com"}},
+	}}
+	destination := &validatingDestination{}
+
+	var buf bytes.Buffer
+	if err := RunSyncSet(log.New(&buf, "", 0), source, destination, config, SyncSet{}, nil); err != nil {
+		t.Fatalf("RunSyncSet() error = %s", err)
+	}
+
+	if !destination.validated {
+		t.Error("ValidateChangeSet was not called in dry-run mode")
+	}
+	if len(destination.people) != 0 {
+		t.Error("changes were applied in dry-run mode")
+	}
+	if !strings.Contains(buf.String(), "2) bad@example.com  WOULD FAIL: too long") {
+		t.Errorf("plan does not mark the failing change:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "good@example.com  WOULD FAIL") {
+		t.Errorf("plan marks a valid change as failing:\n%s", buf.String())
+	}
+}
+
+func TestGenerateChangeSet_UpdateMode(t *testing.T) {
+	config := AppConfig{
+		AttributeMap: []AttributeMap{
+			{Source: "email", Destination: "email", Required: true},
+			{Source: "phone", Destination: "phone", UpdateMode: UpdateModeFillIfEmpty, MaskChanges: true},
+			{Source: "nickname", Destination: "nickname", UpdateMode: UpdateModeIgnore},
+			{Source: "notes", Destination: "notes", UpdateMode: UpdateModeIgnore},
+			{Source: "title", Destination: "title", UpdateMode: UpdateModeOverwrite},
+		},
+	}
+
+	sourcePeople := []Person{
+		{
+			CompareValue: "a@example.com",
+			Attributes: map[string]string{"email": "a@example.com", "phone": "111", "nickname": "Al", "notes": "n",
+				"title": "Lead"},
+		},
+		{
+			CompareValue: "b@example.com",
+			Attributes: map[string]string{"email": "b@example.com", "phone": "222", "nickname": "Bo", "notes": "n",
+				"title": "Dev"},
+		},
+	}
+	destinationPeople := []Person{
+		{
+			CompareValue: "a@example.com",
+			Attributes:   map[string]string{"email": "a@example.com", "phone": "", "nickname": "Alfie", "title": "Dev"},
+		},
+		{
+			CompareValue: "b@example.com",
+			Attributes:   map[string]string{"email": "b@example.com", "phone": "999", "nickname": "Bobby", "title": "Dev"},
+		},
+	}
+
+	changeSet := GenerateChangeSet(log.New(os.Stdout, "", 0), sourcePeople, destinationPeople, config)
+
+	want := []Person{
+		{
+			CompareValue: "a@example.com",
+			Attributes:   map[string]string{"email": "a@example.com", "phone": "111", "nickname": "Alfie", "title": "Lead"},
+			Changes: []AttributeChange{
+				{Attribute: "phone", Old: "", New: "111", Masked: true},
+				{Attribute: "title", Old: "Dev", New: "Lead"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(changeSet.Update, want) {
+		t.Errorf("GenerateChangeSet() Update = %v, want %v", changeSet.Update, want)
+	}
+	if len(changeSet.Create) != 0 || len(changeSet.Delete) != 0 {
+		t.Errorf("GenerateChangeSet() = %+v, want only updates", changeSet)
+	}
+}
+
+func TestGenerateChangeSet_Backfill(t *testing.T) {
+	config := AppConfig{
+		AttributeMap: []AttributeMap{
+			{Source: "email", Destination: "email", Required: true},
+			{Source: "username", Destination: "username", UpdateMode: UpdateModeBackfill},
+			{Source: "title", Destination: "title"},
+		},
+	}
+
+	sourcePeople := []Person{
+		{CompareValue: "a@example.com", Attributes: map[string]string{"email": "a@example.com", "title": "Lead"}},
+		{CompareValue: "b@example.com", Attributes: map[string]string{"email": "b@example.com", "username": "",
+			"title": "Dev"}},
+		{CompareValue: "c@example.com", Attributes: map[string]string{"email": "c@example.com", "username": "cee",
+			"title": "Dev"}},
+		{CompareValue: "d@example.com", Attributes: map[string]string{"email": "d@example.com"}},
+	}
+	destinationPeople := []Person{
+		{CompareValue: "a@example.com", Attributes: map[string]string{"email": "a@example.com", "username": "al",
+			"title": "Dev"}},
+		{CompareValue: "b@example.com", Attributes: map[string]string{"email": "b@example.com", "username": "bo",
+			"title": "Dev"}},
+		{CompareValue: "c@example.com", Attributes: map[string]string{"email": "c@example.com", "username": "cy",
+			"title": "Dev"}},
+	}
+
+	changeSet := GenerateChangeSet(log.New(ioutil.Discard, "", 0), sourcePeople, destinationPeople, config)
+
+	wantUpdate := []Person{
+		{CompareValue: "a@example.com", Attributes: map[string]string{"email": "a@example.com", "username": "al",
+			"title": "Lead"}, Changes: []AttributeChange{{Attribute: "title", Old: "Dev", New: "Lead"}}},
+		{CompareValue: "c@example.com", Attributes: map[string]string{"email": "c@example.com", "username": "cee",
+			"title": "Dev"}, Changes: []AttributeChange{{Attribute: "username", Old: "cy", New: "cee"}}},
+	}
+	if !reflect.DeepEqual(changeSet.Update, wantUpdate) {
+		t.Errorf("GenerateChangeSet() Update = %v, want %v", changeSet.Update, wantUpdate)
+	}
+	if len(changeSet.Create) != 1 || len(changeSet.Create[0].Attributes) != 1 {
+		t.Errorf("GenerateChangeSet() Create = %v, want d@example.com with only an email", changeSet.Create)
+	}
+}
+
+func TestAttributeValuesAreEqual(t *testing.T) {
+	tests := []struct {
+		name    string
+		val1    string
+		val2    string
+		attrMap AttributeMap
+		want    bool
+	}{
+		{name: "case insensitive", val1: "Alfred", val2: "ALFRED", want: true},
+		{name: "case sensitive", val1: "Alfred", val2: "ALFRED", attrMap: AttributeMap{CaseSensitive: true}},
+		{name: "whitespace not normalized", val1: "Alfred  Newman ", val2: "Alfred Newman"},
+		{
+			name:    "whitespace normalized",
+			val1:    " Alfred \t Newman ",
+			val2:    "Alfred Newman",
+			attrMap: AttributeMap{NormalizeWhitespace: true},
+			want:    true,
+		},
+		{
+			name:    "whitespace normalized and case sensitive",
+			val1:    "Alfred  newman",
+			val2:    "Alfred Newman",
+			attrMap: AttributeMap{NormalizeWhitespace: true, CaseSensitive: true},
+		},
+		{
+			name:    "whitespace is not removed",
+			val1:    "AlfredNewman",
+			val2:    "Alfred Newman",
+			attrMap: AttributeMap{NormalizeWhitespace: true},
+		},
+		{
+			name:    "multivalued in a different order",
+			val1:    "b@example.org, A@example.org,,a@example.org",
+			val2:    "a@example.org,b@example.org",
+			attrMap: AttributeMap{Multivalued: true},
+			want:    true,
+		},
+		{
+			name:    "multivalued with a missing item",
+			val1:    "a@example.org,b@example.org",
+			val2:    "a@example.org",
+			attrMap: AttributeMap{Multivalued: true},
+		},
+		{name: "not multivalued", val1: "b@example.org,a@example.org", val2: "a@example.org,b@example.org"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := attributeValuesAreEqual(tt.val1, tt.val2, tt.attrMap); got != tt.want {
+				t.Errorf("attributeValuesAreEqual() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintChangeSet_Truncated(t *testing.T) {
+	var changeSet ChangeSet
+	for i := 0; i < 5; i++ {
+		changeSet.Update = append(changeSet.Update, Person{CompareValue: fmt.Sprintf("user%v@example.com", i)})
+	}
+	changeSet.Create = []Person{{CompareValue: "new@example.com"}}
+
+	var buf bytes.Buffer
+	printChangeSet(log.New(&buf, "", 0), changeSet, nil, 2, "changes.json")
+	out := buf.String()
+
+	for _, want := range []string{
+		"ChangeSet Plans: Create 1, Update 5, Delete 0",
+		"1) new@example.com",
+		"2) user1@example.com",
+		"... and 3 more",
+		"The full list of changes is in changes.json",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "user2@example.com") {
+		t.Errorf("output should be truncated after 2 people:\n%s", out)
+	}
+
+	buf.Reset()
+	printChangeSet(log.New(&buf, "", 0), changeSet, nil, -1, "changes.json")
+	if !strings.Contains(buf.String(), "5) user4@example.com") || strings.Contains(buf.String(), "changes.json") {
+		t.Errorf("output should not be truncated:\n%s", buf.String())
+	}
+}
+
+func TestWriteChangeSetFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "changeset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	want := ChangeSet{Delete: []Person{{CompareValue: "old@example.com", ID: "1"}}}
+	path, err := writeChangeSetFile(dir, "staff/all", want)
+	if err != nil {
+		t.Fatalf("writeChangeSetFile() error = %s", err)
+	}
+	if path != filepath.Join(dir, "staff_all.json") {
+		t.Errorf("writeChangeSetFile() path = %s", path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got ChangeSet
+	if err := json.Unmarshal(data, &got); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("change set file = %s, error %v", data, err)
+	}
+}
+
+// TestGenerateChangeSet_MatchesDiff checks that GenerateChangeSet, when none of its extra comparison features are
+// configured, makes the same changes as the diff package
+func TestGenerateChangeSet_MatchesDiff(t *testing.T) {
+	attributeMap := []AttributeMap{
+		{Source: "name", Destination: "name", NormalizeWhitespace: true},
+		{Source: "title", Destination: "title", CaseSensitive: true},
+	}
+	diffAttributeMap := []diff.AttributeMap{
+		{Source: "name", Destination: "name", NormalizeWhitespace: true},
+		{Source: "title", Destination: "title", CaseSensitive: true},
+	}
+	config := AppConfig{AttributeMap: attributeMap}
+
+	generate := func(r *rand.Rand) []Person {
+		compareValues := []string{"ann@example.org", "ANN@example.org", "bob@example.org", "", "cy@example.org"}
+		values := []string{"Manager", "manager", " Manager ", "Director"}
+		var people []Person
+		for i := r.Intn(6); i > 0; i-- {
+			cv := compareValues[r.Intn(len(compareValues))]
+			attrs := map[string]string{"id": fmt.Sprint(i)}
+			for _, key := range []string{"name", "title"} {
+				if r.Intn(3) > 0 {
+					attrs[key] = values[r.Intn(len(values))]
+				}
+			}
+			people = append(people, Person{CompareValue: cv, Attributes: attrs, DisableChanges: r.Intn(5) == 0})
+		}
+		return people
+	}
+	toDiff := func(people []Person) []diff.Person {
+		var diffPeople []diff.Person
+		for _, p := range people {
+			diffPeople = append(diffPeople, diff.Person{CompareValue: p.CompareValue, ID: p.ID,
+				Attributes: p.Attributes, DisableChanges: p.DisableChanges})
+		}
+		return diffPeople
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		source, destination := generate(r), generate(r)
+		for j := range source {
+			delete(source[j].Attributes, "id")
+		}
+
+		got := GenerateChangeSet(log.New(ioutil.Discard, "", 0), source, destination, config)
+		want := diff.Diff(toDiff(source), toDiff(destination), diffAttributeMap)
+		if !reflect.DeepEqual(toDiff(got.Create), want.Create) || !reflect.DeepEqual(toDiff(got.Update), want.Update) ||
+			!reflect.DeepEqual(toDiff(got.Delete), want.Delete) {
+			t.Fatalf("GenerateChangeSet() = %+v\ndiff.Diff() = %+v\nsource %+v\ndestination %+v", got, want, source,
+				destination)
+		}
+	}
+}
+
+func TestPerson_Changes(t *testing.T) {
+	person := Person{
+		CompareValue: "ann@example.org",
+		Attributes:   map[string]string{"email": "ann@example.org", "title": "Manager", "phone": "555"},
+		Changes: []AttributeChange{
+			{Attribute: "phone", Old: "", New: "555"},
+			{Attribute: "title", Old: "Engineer", New: "Manager"},
+		},
+	}
+
+	wantChanged := map[string]string{"phone": "555", "title": "Manager"}
+	if got := person.ChangedAttributes(); !reflect.DeepEqual(got, wantChanged) {
+		t.Errorf("ChangedAttributes() = %v, want %v", got, wantChanged)
+	}
+	if got := (ChangeSet{}).UpdateAttributes(person); !reflect.DeepEqual(got, person.Attributes) {
+		t.Errorf("UpdateAttributes() without PartialUpdates = %v, want all Attributes", got)
+	}
+	if got := (ChangeSet{PartialUpdates: true}).UpdateAttributes(person); !reflect.DeepEqual(got, wantChanged) {
+		t.Errorf("UpdateAttributes() with PartialUpdates = %v, want %v", got, wantChanged)
+	}
+	wantMessage := `UpdateUser ann@example.org: phone "" -> "555", title "Engineer" -> "Manager"`
+	if got := UpdateMessage("UpdateUser", person.CompareValue, person); got != wantMessage {
+		t.Errorf("UpdateMessage() = %q, want %q", got, wantMessage)
+	}
+
+	person.Changes[0].Masked = true
+	wantMessage = `UpdateUser ann@example.org: phone changed, title "Engineer" -> "Manager"`
+	if got := UpdateMessage("UpdateUser", person.CompareValue, person); got != wantMessage {
+		t.Errorf("UpdateMessage() with a masked change = %q, want %q", got, wantMessage)
+	}
+	if got := person.ChangedAttributes(); !reflect.DeepEqual(got, wantChanged) {
+		t.Errorf("ChangedAttributes() with a masked change = %v, want %v", got, wantChanged)
+	}
+
+	person.Changes = nil
+	if got := person.ChangedAttributes(); !reflect.DeepEqual(got, person.Attributes) {
+		t.Errorf("ChangedAttributes() without Changes = %v, want all Attributes", got)
+	}
+	if got := UpdateMessage("UpdateUser", person.CompareValue, person); got != "UpdateUser ann@example.org" {
+		t.Errorf("UpdateMessage() without Changes = %q", got)
+	}
+}
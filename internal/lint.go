@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// EmailAddressPattern matches a plausible email address, for destinations that reject malformed ones
+var EmailAddressPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s.]+$`)
+
+// LintRule is a constraint that a destination's API places on the value of an attribute, such as a maximum length
+type LintRule struct {
+	// Attribute is the destination attribute the rule applies to
+	Attribute string
+
+	// MaxLength is the maximum length of the value in characters, if not zero
+	MaxLength int
+
+	// Pattern, if set, must match the value
+	Pattern *regexp.Regexp
+
+	// Description describes the values that match the Pattern, such as "an email address"
+	Description string
+}
+
+// AttributeLinter may be implemented by a Destination whose API rejects some attribute values. The rules are
+// checked for every person to be created or updated when changes are planned, so that a value that would be
+// rejected is reported in the plan rather than as an error when it is applied.
+type AttributeLinter interface {
+	LintRules() []LintRule
+}
+
+// check returns the reason that the value breaks the rule, or an empty string if it does not. Empty values are
+// not checked; the AttributeMap Required setting is for those.
+func (r LintRule) check(value string) string {
+	if value == "" {
+		return ""
+	}
+	if length := len([]rune(value)); r.MaxLength > 0 && length > r.MaxLength {
+		return fmt.Sprintf("%s is %d characters, the maximum is %d", r.Attribute, length, r.MaxLength)
+	}
+	if r.Pattern != nil && !r.Pattern.MatchString(value) {
+		description := r.Description
+		if description == "" {
+			description = "in the form " + r.Pattern.String()
+		}
+		return fmt.Sprintf("%s %q is not %s", r.Attribute, value, description)
+	}
+	return ""
+}
+
+// lintChangeSet checks the people to be created or updated against the rules, and returns the reasons, keyed by
+// compare value, for each that breaks any of them
+func lintChangeSet(rules []LintRule, changes ChangeSet) map[string]string {
+	failures := map[string]string{}
+	for _, people := range [][]Person{changes.Create, changes.Update} {
+		for _, person := range people {
+			var reasons []string
+			for _, rule := range rules {
+				value, ok := person.Attributes[rule.Attribute]
+				if !ok {
+					continue
+				}
+				if reason := rule.check(value); reason != "" {
+					reasons = append(reasons, reason)
+				}
+			}
+			if len(reasons) > 0 {
+				failures[person.CompareValue] = strings.Join(reasons, "; ")
+			}
+		}
+	}
+	return failures
+}
+
+// validateChangeSet returns the reason, keyed by compare value, for each planned change that would fail: values
+// that break the destination's LintRules, and failures found by its ChangeSetValidator
+func validateChangeSet(destination Destination, changes ChangeSet) map[string]string {
+	failures := map[string]string{}
+	if linter, ok := destination.(AttributeLinter); ok {
+		failures = lintChangeSet(linter.LintRules(), changes)
+	}
+
+	validator, ok := destination.(ChangeSetValidator)
+	if !ok {
+		return failures
+	}
+	for key, reason := range validator.ValidateChangeSet(changes) {
+		if linted, ok := failures[key]; ok {
+			reason = linted + "; " + reason
+		}
+		failures[key] = reason
+	}
+	return failures
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"log"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// lintingDestination has lint rules as well as a ChangeSetValidator
+type lintingDestination struct {
+	validatingDestination
+}
+
+func (l *lintingDestination) LintRules() []LintRule {
+	return []LintRule{
+		{Attribute: "givenName", MaxLength: 5},
+		{Attribute: "username", Pattern: regexp.MustCompile(`^[a-z]+$`), Description: "lowercase letters"},
+		{Attribute: "email", Pattern: EmailAddressPattern},
+	}
+}
+
+func TestValidateChangeSet(t *testing.T) {
+	changes := ChangeSet{
+		Create: []Person{
+			{CompareValue: "ok@example.com", Attributes: map[string]string{"givenName": "Ann", "username": "ann",
+				"email": "ok@example.com"}},
+			{CompareValue: "long@example.com", Attributes: map[string]string{"givenName": "Christopher",
+				"username": "chris"}},
+			{CompareValue: "two@example.com", Attributes: map[string]string{"givenName": "Bob", "username": "Bob 1",
+				"email": "two@example"}},
+			{CompareValue: "empty@example.com", Attributes: map[string]string{"givenName": "", "username": ""}},
+		},
+		Update: []Person{
+			{CompareValue: "bad@example.com", Attributes: map[string]string{"givenName": "Élodie"}},
+		},
+		Delete: []Person{
+			{CompareValue: "deleted@example.com", Attributes: map[string]string{"username": "NOT CHECKED"}},
+		},
+	}
+
+	got := validateChangeSet(&lintingDestination{}, changes)
+	want := map[string]string{
+		"long@example.com": "givenName is 11 characters, the maximum is 5",
+		"two@example.com": `username "Bob 1" is not lowercase letters; ` +
+			`email "two@example" is not in the form ` + EmailAddressPattern.String(),
+		"bad@example.com": "givenName is 6 characters, the maximum is 5; too long",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("validateChangeSet() = %v, want %v", got, want)
+	}
+
+	if got := validateChangeSet(&testDestination{}, changes); len(got) != 0 {
+		t.Errorf("validateChangeSet() = %v for a destination without rules", got)
+	}
+}
+
+func TestPlanSyncSet_Lint(t *testing.T) {
+	config := AppConfig{
+		AttributeMap: []AttributeMap{
+			{Source: "email", Destination: "email", Required: true},
+			{Source: "first", Destination: "givenName"},
+		},
+	}
+	source := &testSource{people: []Person{
+		{CompareValue: "a@example.com", Attributes: map[string]string{"email": "a@example.com", "first": "Al"}},
+		{CompareValue: "c@example.com", Attributes: map[string]string{"email": "c@example.com", "first": "Cassandra"}},
+	}}
+
+	var buf strings.Builder
+	_, err := PlanSyncSet(log.New(&buf, "", 0), source, &lintingDestination{}, config, SyncSet{Name: "s"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "c@example.com  WOULD FAIL: givenName is 9 characters, the maximum is 5") {
+		t.Errorf("plan does not mark the change that breaks a lint rule:\n%s", buf.String())
+	}
+}
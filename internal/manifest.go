@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SyncSetManifest creates a sync set for each row of a manifest file, so that groups can be added by editing the
+// manifest instead of deploying a new config. The row's columns are the parameters of the SyncSet template, as in
+// a SyncSetTemplate.
+type SyncSetManifest struct {
+	// Location is the path of the manifest, relative to the config file, or an http or https URL
+	Location string
+
+	// Format is csv or json. If it is not set, it is taken from the Location's extension. A CSV manifest has a
+	// header row naming its columns, and a JSON manifest is an array of objects.
+	Format string
+
+	SyncSet SyncSet
+}
+
+// loadSyncSetManifests reads each manifest and adds it to the config as a SyncSetTemplate
+func loadSyncSetManifests(config *AppConfig, configFile string) error {
+	for _, manifest := range config.SyncSetManifests {
+		data, err := readManifest(manifest.Location, filepath.Dir(configFile))
+		if err != nil {
+			return fmt.Errorf("unable to read sync set manifest %s: %s", manifest.Location, err)
+		}
+
+		format := manifest.Format
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(manifest.Location)), ".")
+		}
+
+		var rows []map[string]string
+		switch format {
+		case "csv":
+			rows, err = parseCSVManifest(data)
+		case "json":
+			rows, err = parseJSONManifest(data)
+		default:
+			return fmt.Errorf("sync set manifest %s has an unknown Format %q, must be csv or json",
+				manifest.Location, format)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to parse sync set manifest %s: %s", manifest.Location, err)
+		}
+		if len(rows) == 0 {
+			return fmt.Errorf("sync set manifest %s is empty", manifest.Location)
+		}
+
+		config.SyncSetTemplates = append(config.SyncSetTemplates, SyncSetTemplate{
+			SyncSet:    manifest.SyncSet,
+			Parameters: rows,
+		})
+	}
+	return nil
+}
+
+func readManifest(location, configDir string) ([]byte, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Get(location)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("request returned %s", resp.Status)
+		}
+		return body, nil
+	}
+
+	if !filepath.IsAbs(location) {
+		location = filepath.Join(configDir, location)
+	}
+	return ioutil.ReadFile(location)
+}
+
+func parseCSVManifest(data []byte) ([]map[string]string, error) {
+	lines, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	header := lines[0]
+	rows := make([]map[string]string, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		row := map[string]string{}
+		for i, name := range header {
+			row[strings.TrimSpace(name)] = line[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseJSONManifest(data []byte) ([]map[string]string, error) {
+	var objects []map[string]interface{}
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]string, 0, len(objects))
+	for _, object := range objects {
+		row := map[string]string{}
+		for key, value := range object {
+			if value != nil {
+				row[key] = fmt.Sprintf("%v", value)
+			} else {
+				row[key] = ""
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
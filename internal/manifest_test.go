@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadSyncSetManifests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	csvManifest := "group,department\nsales@example.org,Sales\nit@example.org,IT\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "groups.csv"), []byte(csvManifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/groups" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`[{"group":"hr@example.org","department":"HR"}]`))
+	}))
+	defer server.Close()
+
+	syncSet := SyncSet{
+		Name:        "{department}",
+		Source:      json.RawMessage(`{"Department":"{department}"}`),
+		Destination: json.RawMessage(`{"GroupEmail":"{group}"}`),
+	}
+
+	tests := []struct {
+		name     string
+		manifest SyncSetManifest
+		want     []map[string]string
+		wantErr  bool
+	}{
+		{
+			name:     "csv file",
+			manifest: SyncSetManifest{Location: "groups.csv", SyncSet: syncSet},
+			want: []map[string]string{
+				{"group": "sales@example.org", "department": "Sales"},
+				{"group": "it@example.org", "department": "IT"},
+			},
+		},
+		{
+			name:     "json url",
+			manifest: SyncSetManifest{Location: server.URL + "/groups", Format: "json", SyncSet: syncSet},
+			want:     []map[string]string{{"group": "hr@example.org", "department": "HR"}},
+		},
+		{
+			name:     "missing file",
+			manifest: SyncSetManifest{Location: "missing.csv", SyncSet: syncSet},
+			wantErr:  true,
+		},
+		{
+			name:     "url error",
+			manifest: SyncSetManifest{Location: server.URL + "/missing.json", SyncSet: syncSet},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown format",
+			manifest: SyncSetManifest{Location: server.URL + "/groups", SyncSet: syncSet},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := AppConfig{SyncSetManifests: []SyncSetManifest{tt.manifest}}
+			err := loadSyncSetManifests(&config, filepath.Join(dir, "config.json"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadSyncSetManifests() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(config.SyncSetTemplates) != 1 {
+				t.Fatalf("got %v templates, want 1", len(config.SyncSetTemplates))
+			}
+			if got := config.SyncSetTemplates[0].Parameters; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parameters = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
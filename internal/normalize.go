@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Names of the built-in CompareValue normalizers
+const (
+	NormalizerLowercase = "lowercase"
+	NormalizerTrim      = "trim"
+	NormalizerStripPlus = "stripPlus"
+	NormalizerStripDots = "stripDots"
+)
+
+// compareNormalizers holds the normalizers available by name. More can be added with RegisterCompareNormalizer.
+var compareNormalizers = map[string]func(string) string{
+	NormalizerLowercase: strings.ToLower,
+	NormalizerTrim:      strings.TrimSpace,
+	NormalizerStripPlus: stripPlusAddressing,
+	NormalizerStripDots: stripLocalPartDots,
+}
+
+// RegisterCompareNormalizer makes a CompareValue normalizer available to the Normalizers config by name
+func RegisterCompareNormalizer(name string, normalizer func(string) string) {
+	compareNormalizers[name] = normalizer
+}
+
+// stripPlusAddressing removes a "+tag" suffix from the local part of an email address
+func stripPlusAddressing(value string) string {
+	at := strings.LastIndex(value, "@")
+	if at < 0 {
+		return value
+	}
+	if plus := strings.Index(value[:at], "+"); plus >= 0 {
+		return value[:plus] + value[at:]
+	}
+	return value
+}
+
+// stripLocalPartDots removes the dots from the local part of an email address, as Gmail ignores them
+func stripLocalPartDots(value string) string {
+	at := strings.LastIndex(value, "@")
+	if at < 0 {
+		return value
+	}
+	return strings.Replace(value[:at], ".", "", -1) + value[at:]
+}
+
+func validateNormalizers(names []string) error {
+	for _, name := range names {
+		if _, ok := compareNormalizers[name]; !ok {
+			return fmt.Errorf("unknown compare value normalizer %q", name)
+		}
+	}
+	return nil
+}
+
+// normalizeCompareValue applies the named normalizers in order. Values are always compared without regard to case.
+func normalizeCompareValue(value string, names []string) string {
+	for _, name := range names {
+		if normalizer, ok := compareNormalizers[name]; ok {
+			value = normalizer(value)
+		}
+	}
+	return strings.ToLower(value)
+}
+
+// getNormalizedPersonIndex is getPersonIndexFromList for compare values that are normalized before comparing. An
+// exact match is preferred over a normalized one.
+func getNormalizedPersonIndex(compareValue string, peopleList []Person, names []string,
+	normalized map[string]int) int {
+
+	if i := getPersonIndexFromList(compareValue, peopleList); i >= 0 || len(names) == 0 {
+		return i
+	}
+	if i, ok := normalized[normalizeCompareValue(compareValue, names)]; ok {
+		return i
+	}
+	return -1
+}
+
+// normalizedIndex maps the normalized compare value of each person to their index in the list. A value shared by
+// more than one person is not included, as it is ambiguous.
+func normalizedIndex(peopleList []Person, names []string) map[string]int {
+	index := map[string]int{}
+	ambiguous := map[string]bool{}
+	for i, p := range peopleList {
+		if p.CompareValue == "" {
+			continue
+		}
+		value := normalizeCompareValue(p.CompareValue, names)
+		if _, ok := index[value]; ok {
+			ambiguous[value] = true
+			continue
+		}
+		index[value] = i
+	}
+	for value := range ambiguous {
+		delete(index, value)
+	}
+	return index
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+func TestNormalizeCompareValue(t *testing.T) {
+	tests := []struct {
+		value       string
+		normalizers []string
+		want        string
+	}{
+		{value: " J.Doe+HR@Example.org ", normalizers: []string{NormalizerTrim}, want: "j.doe+hr@example.org"},
+		{value: "j.doe+hr@x.org", normalizers: []string{NormalizerStripPlus}, want: "j.doe@x.org"},
+		{value: "j.doe+h.r@x.org", normalizers: []string{NormalizerStripDots}, want: "jdoe+hr@x.org"},
+		{value: "j.doe+hr@x.org", normalizers: []string{NormalizerStripPlus, NormalizerStripDots}, want: "jdoe@x.org"},
+		{value: "not.an.email", normalizers: []string{NormalizerStripPlus, NormalizerStripDots}, want: "not.an.email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := normalizeCompareValue(tt.value, tt.normalizers); got != tt.want {
+				t.Errorf("normalizeCompareValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if err := validateNormalizers([]string{NormalizerLowercase, "unknown"}); err == nil {
+		t.Error("validateNormalizers() should fail for an unknown normalizer")
+	}
+}
+
+func TestGenerateChangeSet_Normalizers(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	sourcePeople := []Person{
+		{CompareValue: "j.doe+hr@x.org", Attributes: map[string]string{"name": "Jane"}},
+		{CompareValue: "a.b@x.org", Attributes: map[string]string{"name": "AB"}},
+	}
+	destinationPeople := []Person{
+		{CompareValue: "j.doe@x.org", Attributes: map[string]string{"name": "J"}},
+		{CompareValue: "ab@x.org", Attributes: map[string]string{"name": "AB 1"}},
+		{CompareValue: "a.b+1@x.org", Attributes: map[string]string{"name": "AB 2"}},
+	}
+	config := AppConfig{AttributeMap: []AttributeMap{{Source: "name", Destination: "name"}}}
+
+	changeSet := GenerateChangeSet(logger, sourcePeople, destinationPeople, config)
+	if len(changeSet.Create) != 2 || len(changeSet.Delete) != 3 {
+		t.Errorf("without normalizers, changeSet = %+v, want 2 creates and 3 deletes", changeSet)
+	}
+
+	config.Compare.Normalizers = []string{NormalizerStripPlus, NormalizerStripDots}
+	changeSet = GenerateChangeSet(logger, sourcePeople, destinationPeople, config)
+
+	// a.b@x.org is ambiguous, so it is not matched
+	if len(changeSet.Create) != 1 || changeSet.Create[0].CompareValue != "a.b@x.org" {
+		t.Errorf("Create = %v, want a.b@x.org", changeSet.Create)
+	}
+	if len(changeSet.Update) != 1 || changeSet.Update[0].CompareValue != "j.doe@x.org" {
+		t.Errorf("Update = %v, want j.doe@x.org with the destination compare value", changeSet.Update)
+	}
+	if len(changeSet.Delete) != 2 {
+		t.Errorf("Delete = %v, want the two ambiguous destination people", changeSet.Delete)
+	}
+}
@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// OnDeleteConfig adds the people removed from a sync set's destination to another destination, such as an alumni
+// mailing list or archived contacts, at the same time
+type OnDeleteConfig struct {
+	// DestinationName is the Name of the AppConfig Destinations entry to add the removed people to
+	DestinationName string
+
+	// Destination is the sync set configuration for that destination, such as the group to add people to
+	Destination json.RawMessage
+}
+
+func (o OnDeleteConfig) isSet() bool {
+	return o.DestinationName != "" || len(o.Destination) > 0
+}
+
+// validateOnDelete checks that each sync set with an OnDelete adds people to a named destination that exists
+func validateOnDelete(config AppConfig) error {
+	for _, syncSet := range config.SyncSets {
+		onDelete := syncSet.OnDelete
+		if !onDelete.isSet() {
+			continue
+		}
+		if onDelete.DestinationName == "" || len(onDelete.Destination) == 0 {
+			return fmt.Errorf("OnDelete of sync set %s requires a DestinationName and Destination", syncSet.Name)
+		}
+		if _, ok := config.namedDestination(onDelete.DestinationName); !ok {
+			return fmt.Errorf("OnDelete of sync set %s adds people to destination %s, which is not in Destinations",
+				syncSet.Name, onDelete.DestinationName)
+		}
+	}
+	return nil
+}
+
+// namedDestination returns the Destinations entry with the name
+func (a AppConfig) namedDestination(name string) (DestinationConfig, bool) {
+	for _, destination := range a.Destinations {
+		if destination.Name == name {
+			return destination, true
+		}
+	}
+	return DestinationConfig{}, false
+}
+
+// addRemovedPeople adds the people removed from the destination to the sync set's OnDelete destination, unless they
+// are already there. Only the attributes in the AttributeMap of the OnDelete destination are given to it. Nothing is
+// added if the destination does not delete people, or if the OnDelete destination does not add them. In dry-run
+// mode, the number of people that would be added is logged instead.
+func addRemovedPeople(logger *log.Logger, config AppConfig, syncSet SyncSet, removed []Person) error {
+	onDelete := syncSet.OnDelete
+	if !onDelete.isSet() || len(removed) == 0 || config.Destination.DisableDelete {
+		return nil
+	}
+
+	destinationConfig, ok := config.namedDestination(onDelete.DestinationName)
+	if !ok {
+		return fmt.Errorf("OnDelete destination %s is not in Destinations", onDelete.DestinationName)
+	}
+	if destinationConfig.DisableAdd {
+		return nil
+	}
+	onDeleteConfig := config.forDestination(destinationConfig)
+
+	destination, err := NewDestination(destinationConfig)
+	if err != nil {
+		return fmt.Errorf("unable to initialize OnDelete destination %s: %s", onDelete.DestinationName, err)
+	}
+	if err := destination.ForSet(onDelete.Destination); err != nil {
+		return fmt.Errorf("unable to set OnDelete destination %s: %s", onDelete.DestinationName, err)
+	}
+
+	attributes := GetDestinationAttributes(onDeleteConfig.AttributeMap)
+	existing, err := destination.ListUsers(attributes)
+	if err != nil {
+		return fmt.Errorf("unable to list OnDelete destination %s: %s", onDelete.DestinationName, err)
+	}
+
+	var toAdd []Person
+	for _, person := range removed {
+		if getPersonIndexFromList(person.CompareValue, existing) >= 0 {
+			continue
+		}
+		attrs := map[string]string{}
+		for _, attribute := range attributes {
+			if value, ok := person.Attributes[attribute]; ok {
+				attrs[attribute] = value
+			}
+		}
+		toAdd = append(toAdd, Person{CompareValue: person.CompareValue, Attributes: attrs})
+	}
+
+	if config.Runtime.DryRunMode {
+		logger.Printf("    %v people removed from the destination would be added to %s\n", len(toAdd),
+			onDelete.DestinationName)
+		return nil
+	}
+	if len(toAdd) == 0 {
+		return nil
+	}
+
+	eventLog := make(chan EventLogItem, 50)
+	counts := make(chan eventCounts)
+	go func() {
+		counts <- processEventLog(logger, onDeleteConfig, syncSet.Name, nil, nil, eventLog)
+	}()
+	results := destination.ApplyChangeSet(ChangeSet{Create: toAdd}, eventLog)
+	close(eventLog)
+	results.Errors, results.Failures = (<-counts).split()
+
+	logger.Printf("OnDelete results: %v of %v removed users added to %s\n", results.Created, len(toAdd),
+		onDelete.DestinationName)
+	if len(results.Errors) > 0 {
+		return fmt.Errorf("%v errors adding removed users to %s (%s)", len(toAdd)-int(results.Created),
+			onDelete.DestinationName, formatErrorCounts(results.Errors))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestAddRemovedPeople(t *testing.T) {
+	alumni := &testDestination{people: []Person{
+		{CompareValue: "old@example.org", Attributes: map[string]string{"email": "old@example.org"}},
+	}}
+	RegisterDestination("OnDeleteTest", func(DestinationConfig) (Destination, error) {
+		return alumni, nil
+	})
+
+	source := &testSource{people: []Person{
+		{CompareValue: "stays@example.org", Attributes: map[string]string{"email": "stays@example.org"}},
+	}}
+	destination := &testDestination{people: []Person{
+		{CompareValue: "stays@example.org", Attributes: map[string]string{"id": "1", "email": "stays@example.org"}},
+		{CompareValue: "left@example.org", Attributes: map[string]string{"id": "2", "email": "left@example.org"}},
+		{CompareValue: "old@example.org", Attributes: map[string]string{"id": "3", "email": "old@example.org"}},
+	}}
+	config := AppConfig{
+		Destination:  DestinationConfig{Type: "Test"},
+		Destinations: []DestinationConfig{{Name: "alumni", Type: "OnDeleteTest"}},
+		AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}},
+		SyncSets: []SyncSet{{Name: "staff", OnDelete: OnDeleteConfig{DestinationName: "alumni",
+			Destination: json.RawMessage(`{"GroupEmail": "alumni@example.org"}`)}}},
+	}
+	if err := validateOnDelete(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RunSyncSet(log.New(ioutil.Discard, "", 0), source, destination, config, config.SyncSets[0],
+		nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Person{{CompareValue: "left@example.org", Attributes: map[string]string{"email": "left@example.org"}}}
+	if !reflect.DeepEqual(alumni.changes.Create, want) {
+		t.Errorf("OnDelete destination created %+v, want %+v", alumni.changes.Create, want)
+	}
+	if len(destination.changes.Delete) != 2 {
+		t.Errorf("destination deleted %v people, want 2", len(destination.changes.Delete))
+	}
+
+	config.SyncSets[0].OnDelete.DestinationName = "missing"
+	if err := validateOnDelete(config); err == nil {
+		t.Error("validateOnDelete() did not return an error for a missing destination")
+	}
+}
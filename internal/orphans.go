@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// DefaultOrphanRecentDays is the age in days under which an orphaned account is reported as recently added
+const DefaultOrphanRecentDays = 30
+
+// Orphan is a destination person not present in the source
+type Orphan struct {
+	CompareValue string
+	CreatedAt    time.Time
+	LastLoginAt  time.Time
+
+	// Recent is true if the account was created within the OrphanRecentDays, and so may have been added manually
+	// on purpose
+	Recent bool
+}
+
+// GetOrphanRecentDays returns the effective OrphanRecentDays
+func (r RuntimeConfig) GetOrphanRecentDays() int {
+	if r.OrphanRecentDays <= 0 {
+		return DefaultOrphanRecentDays
+	}
+	return r.OrphanRecentDays
+}
+
+// findOrphans returns the people to be deleted, ordered with the longest inactive first. People whose age is
+// unknown are listed last.
+func findOrphans(toDelete []Person, now time.Time, recentDays int) []Orphan {
+	recent := now.AddDate(0, 0, -recentDays)
+
+	orphans := make([]Orphan, len(toDelete))
+	for i, p := range toDelete {
+		orphans[i] = Orphan{
+			CompareValue: p.CompareValue,
+			CreatedAt:    p.CreatedAt,
+			LastLoginAt:  p.LastLoginAt,
+			Recent:       p.CreatedAt.After(recent),
+		}
+	}
+
+	sort.SliceStable(orphans, func(i, j int) bool {
+		a, b := orphans[i].lastActive(), orphans[j].lastActive()
+		if a.IsZero() || b.IsZero() {
+			return b.IsZero() && !a.IsZero()
+		}
+		return a.Before(b)
+	})
+	return orphans
+}
+
+// lastActive is the last login, or the creation time if the person has never logged in
+func (o Orphan) lastActive() time.Time {
+	if !o.LastLoginAt.IsZero() {
+		return o.LastLoginAt
+	}
+	return o.CreatedAt
+}
+
+// printOrphans lists the orphans with their age, so it can be judged whether deleting them is safe
+func printOrphans(logger *log.Logger, orphans []Orphan, now time.Time, maxListed int) {
+	recent := 0
+	for _, o := range orphans {
+		if o.Recent {
+			recent++
+		}
+	}
+	logger.Printf("Orphan report: %v people in the destination are not in the source, %v of them created recently\n",
+		len(orphans), recent)
+
+	for i, o := range orphans {
+		if maxListed >= 0 && i >= maxListed {
+			logger.Printf("  ... and %v more", len(orphans)-i)
+			return
+		}
+		note := ""
+		if o.Recent {
+			note = "  RECENT"
+		}
+		logger.Printf("  %v) %s  created: %s, last login: %s%s", i+1, o.CompareValue, age(o.CreatedAt, now),
+			age(o.LastLoginAt, now), note)
+	}
+}
+
+func age(t, now time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s (%v days ago)", t.UTC().Format("2006-01-02"), int(now.Sub(t).Hours()/24))
+}
@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindOrphans(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	toDelete := []Person{
+		{CompareValue: "unknown@example.com"},
+		{CompareValue: "new@example.com", CreatedAt: now.AddDate(0, 0, -2)},
+		{CompareValue: "active@example.com", CreatedAt: now.AddDate(-2, 0, 0), LastLoginAt: now.AddDate(0, 0, -1)},
+		{CompareValue: "abandoned@example.com", CreatedAt: now.AddDate(-3, 0, 0), LastLoginAt: now.AddDate(-1, 0, 0)},
+		{CompareValue: "never@example.com", CreatedAt: now.AddDate(0, -6, 0)},
+	}
+
+	orphans := findOrphans(toDelete, now, 30)
+
+	var got []string
+	for _, o := range orphans {
+		got = append(got, o.CompareValue)
+	}
+	want := []string{"abandoned@example.com", "never@example.com", "new@example.com", "active@example.com",
+		"unknown@example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findOrphans() order = %v, want %v", got, want)
+	}
+
+	for _, o := range orphans {
+		if o.Recent != (o.CompareValue == "new@example.com") {
+			t.Errorf("%s: Recent = %v", o.CompareValue, o.Recent)
+		}
+	}
+
+	var buf bytes.Buffer
+	printOrphans(log.New(&buf, "", 0), orphans, now, 1)
+	out := buf.String()
+	for _, s := range []string{
+		"5 people in the destination are not in the source, 1 of them created recently",
+		"abandoned@example.com  created: 2017-06-01 (1096 days ago), last login: 2019-06-01 (366 days ago)",
+		"... and 4 more",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("printOrphans() output is missing %q:\n%s", s, out)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PlanSigningKeyEnv is the environment variable used for the plan signing key if it is not in the Runtime config
+const PlanSigningKeyEnv = "PLAN_SIGNING_KEY"
+
+// Plan is a record of the changes computed for each sync set, to be applied later exactly as planned
+type Plan struct {
+	CreatedAt  time.Time
+	ConfigHash string
+	SyncSets   []PlannedSyncSet
+	Signature  string
+}
+
+type PlannedSyncSet struct {
+	Name    string
+	Skipped bool
+	Changes ChangeSet
+}
+
+// NewPlan returns an empty plan for the given config
+func NewPlan(config AppConfig) Plan {
+	return Plan{
+		CreatedAt:  config.Runtime.GetClock().Now().UTC(),
+		ConfigHash: configHash(config),
+	}
+}
+
+// PlanSyncSet generates the ChangeSet for a sync set without making any changes
+func PlanSyncSet(logger *log.Logger, source Source, destination Destination, config AppConfig, syncSet SyncSet,
+	stateStore StateStore) (PlannedSyncSet, error) {
+
+	run, err := planSyncSet(logger, source, destination, config, syncSet, stateStore)
+	if err != nil {
+		return PlannedSyncSet{}, err
+	}
+
+	planned := PlannedSyncSet{Name: syncSet.Name, Skipped: run.skip, Changes: run.changeSet}
+	if !run.skip {
+		failures := validateChangeSet(destination, run.changeSet)
+		printChangeSet(logger, run.changeSet, failures, config.Runtime.GetMaxListedChanges(), "the plan file")
+	}
+	return planned, nil
+}
+
+// ApplyPlannedSyncSet generates the ChangeSet again and, if it still matches the plan, applies the planned changes.
+// In DryRunMode, the planned changes are printed instead.
+func ApplyPlannedSyncSet(logger *log.Logger, source Source, destination Destination, config AppConfig,
+	syncSet SyncSet, stateStore StateStore, planned PlannedSyncSet) error {
+
+	run, err := planSyncSet(logger, source, destination, config, syncSet, stateStore)
+	if err != nil {
+		return err
+	}
+
+	if run.skip != planned.Skipped || changeSetHash(run.changeSet) != changeSetHash(planned.Changes) {
+		return fmt.Errorf("changes for sync set %s no longer match the plan, a new plan is required", syncSet.Name)
+	}
+	if run.skip {
+		return nil
+	}
+
+	run.changeSet = planned.Changes
+	if config.Destination.Shadow {
+		reportShadowChanges(logger, destination, config, syncSet, run.changeSet)
+		return nil
+	}
+	if config.Runtime.DryRunMode {
+		logger.Println("    DryRunMode is set, the plan is not applied")
+		dryRunSyncSet(logger, destination, config, syncSet, run)
+		return nil
+	}
+	return applySyncSet(logger, destination, config, syncSet, stateStore, run)
+}
+
+// Find returns the planned sync set with the given name
+func (p *Plan) Find(name string) (PlannedSyncSet, bool) {
+	for _, s := range p.SyncSets {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return PlannedSyncSet{}, false
+}
+
+// WritePlan signs the plan and writes it to a file
+func WritePlan(path string, plan Plan, config AppConfig) error {
+	key, err := planSigningKey(config)
+	if err != nil {
+		return err
+	}
+
+	plan.Signature = ""
+	if plan.Signature, err = signPlan(plan, key); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal plan: %s", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("unable to write plan file %s: %s", path, err)
+	}
+	return nil
+}
+
+// ReadPlan reads a plan file, verifying its signature and that it was created with the same configuration
+func ReadPlan(path string, config AppConfig) (Plan, error) {
+	key, err := planSigningKey(config)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Plan{}, fmt.Errorf("unable to read plan file %s: %s", path, err)
+	}
+
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return Plan{}, fmt.Errorf("unable to parse plan file %s: %s", path, err)
+	}
+
+	signature := plan.Signature
+	plan.Signature = ""
+	expected, err := signPlan(plan, key)
+	if err != nil {
+		return Plan{}, err
+	}
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return Plan{}, errors.New("plan signature is invalid")
+	}
+	plan.Signature = signature
+
+	if plan.ConfigHash != configHash(config) {
+		return Plan{}, errors.New("plan was created with a different configuration")
+	}
+
+	return plan, nil
+}
+
+func planSigningKey(config AppConfig) (string, error) {
+	key := config.Runtime.PlanSigningKey
+	if key == "" {
+		key = os.Getenv(PlanSigningKeyEnv)
+	}
+	if key == "" {
+		return "", fmt.Errorf("a plan signing key is required in Runtime.PlanSigningKey or %s", PlanSigningKeyEnv)
+	}
+	return key, nil
+}
+
+func signPlan(plan Plan, key string) (string, error) {
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal plan: %s", err)
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	_, _ = mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// configHash returns a hash of the parts of the configuration that affect the planned changes
+func configHash(config AppConfig) string {
+	data, _ := json.Marshal(struct {
+		Source       SourceConfig
+		Destination  DestinationConfig
+		IDLink       IDLinkConfig
+		AttributeMap []AttributeMap
+		SyncSets     []SyncSet
+		Destinations []DestinationConfig
+		Sources      []SourceConfig
+		SourceMerge  SourceMergeConfig
+		Anonymize    AnonymizeConfig
+
+		SyncSetGroupings []SyncSetGrouping `json:",omitempty"`
+	}{config.Source, config.Destination, config.IDLink, config.AttributeMap, config.SyncSets, config.Destinations,
+		config.Sources, config.SourceMerge, config.Anonymize, config.SyncSetGroupings})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// changeSetHash returns a hash of the ChangeSet that does not depend on the order of the people in it
+func changeSetHash(changeSet ChangeSet) string {
+	h := sha256.New()
+	for _, people := range [][]Person{changeSet.Create, changeSet.Update, changeSet.Delete} {
+		sorted := make([]Person, len(people))
+		copy(sorted, people)
+		sort.Slice(sorted, func(i, j int) bool {
+			return strings.ToLower(sorted[i].CompareValue) < strings.ToLower(sorted[j].CompareValue)
+		})
+		data, _ := json.Marshal(sorted)
+		_, _ = h.Write(data)
+		_, _ = h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteReadPlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "plan.json")
+
+	config := AppConfig{
+		Runtime:      RuntimeConfig{PlanSigningKey: "secret"},
+		AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}},
+	}
+	plan := NewPlan(config)
+	plan.SyncSets = []PlannedSyncSet{{
+		Name:    "set",
+		Changes: ChangeSet{Create: []Person{{CompareValue: "a@example.com", Attributes: map[string]string{"email": "a@example.com"}}}},
+	}}
+
+	if err := WritePlan(path, plan, config); err != nil {
+		t.Fatalf("WritePlan() error = %s", err)
+	}
+
+	got, err := ReadPlan(path, config)
+	if err != nil {
+		t.Fatalf("ReadPlan() error = %s", err)
+	}
+	if planned, ok := got.Find("set"); !ok || len(planned.Changes.Create) != 1 {
+		t.Errorf("ReadPlan() = %+v, want the planned sync set", got)
+	}
+
+	wrongKey := config
+	wrongKey.Runtime.PlanSigningKey = "other"
+	if _, err := ReadPlan(path, wrongKey); err == nil {
+		t.Error("ReadPlan() with the wrong key should fail")
+	}
+
+	changedConfig := config
+	changedConfig.AttributeMap = []AttributeMap{{Source: "mail", Destination: "email"}}
+	if _, err := ReadPlan(path, changedConfig); err == nil {
+		t.Error("ReadPlan() with a changed config should fail")
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	tampered := strings.Replace(string(data), "a@example.com", "b@example.com", -1)
+	if err := ioutil.WriteFile(path, []byte(tampered), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadPlan(path, config); err == nil {
+		t.Error("ReadPlan() of a modified plan should fail")
+	}
+}
+
+func TestApplyPlannedSyncSet(t *testing.T) {
+	config := AppConfig{
+		AttributeMap: []AttributeMap{{Source: "email", Destination: "email", Required: true}},
+	}
+	logger := log.New(ioutil.Discard, "", 0)
+	source := &testSource{people: []Person{
+		{CompareValue: "a@example.com", Attributes: map[string]string{"email": "a@example.com"}},
+	}}
+	destination := &testDestination{}
+
+	planned, err := PlanSyncSet(logger, source, destination, config, SyncSet{Name: "set"}, nil)
+	if err != nil {
+		t.Fatalf("PlanSyncSet() error = %s", err)
+	}
+	if len(destination.people) != 0 {
+		t.Fatal("PlanSyncSet() made changes")
+	}
+
+	source.people = append(source.people,
+		Person{CompareValue: "b@example.com", Attributes: map[string]string{"email": "b@example.com"}})
+	if err := ApplyPlannedSyncSet(logger, source, destination, config, SyncSet{Name: "set"}, nil, planned); err == nil {
+		t.Error("ApplyPlannedSyncSet() should fail when the source has changed since planning")
+	}
+	if len(destination.people) != 0 {
+		t.Fatal("ApplyPlannedSyncSet() made changes from a stale plan")
+	}
+
+	source.people = source.people[:1]
+	dryRun := config
+	dryRun.Runtime.DryRunMode = true
+	if err := ApplyPlannedSyncSet(logger, source, destination, dryRun, SyncSet{Name: "set"}, nil, planned); err != nil {
+		t.Fatalf("ApplyPlannedSyncSet() error = %s", err)
+	}
+	if len(destination.people) != 0 {
+		t.Fatal("ApplyPlannedSyncSet() made changes in DryRunMode")
+	}
+
+	if err := ApplyPlannedSyncSet(logger, source, destination, config, SyncSet{Name: "set"}, nil, planned); err != nil {
+		t.Fatalf("ApplyPlannedSyncSet() error = %s", err)
+	}
+	if len(destination.people) != 1 || destination.people[0].CompareValue != "a@example.com" {
+		t.Errorf("destination after apply = %+v, want a@example.com", destination.people)
+	}
+}
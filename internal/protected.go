@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// ProtectedConfig lists destination accounts, such as service accounts and break-glass admins, that the sync must
+// never update or delete. They can still be created if they are in the source and not in the destination.
+type ProtectedConfig struct {
+	// CompareValues are the compare values of protected accounts, ignoring case
+	CompareValues []string
+
+	// Patterns are regular expressions, and an account whose compare value matches any of them is protected
+	Patterns []string
+}
+
+// ProtectedChange is a planned change that was left out because the account is protected
+type ProtectedChange struct {
+	Operation string
+	Person    Person
+}
+
+// validate checks that the Patterns are valid regular expressions
+func (p ProtectedConfig) validate() error {
+	_, err := p.compile()
+	return err
+}
+
+func (p ProtectedConfig) compile() ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, len(p.Patterns))
+	for i, pattern := range p.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Protected pattern %q: %s", pattern, err)
+		}
+		patterns[i] = re
+	}
+	return patterns, nil
+}
+
+// protectAccounts removes the updates and deletes of protected accounts from the ChangeSet, and returns them
+func protectAccounts(changeSet ChangeSet, config ProtectedConfig) (ChangeSet, []ProtectedChange, error) {
+	if len(config.CompareValues) == 0 && len(config.Patterns) == 0 {
+		return changeSet, nil, nil
+	}
+	patterns, err := config.compile()
+	if err != nil {
+		return changeSet, nil, err
+	}
+
+	isProtected := func(compareValue string) bool {
+		for _, value := range config.CompareValues {
+			if strings.EqualFold(value, compareValue) {
+				return true
+			}
+		}
+		for _, re := range patterns {
+			if re.MatchString(compareValue) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var skipped []ProtectedChange
+	filter := func(people []Person, operation string) []Person {
+		var kept []Person
+		for _, person := range people {
+			if isProtected(person.CompareValue) {
+				skipped = append(skipped, ProtectedChange{Operation: operation, Person: person})
+				continue
+			}
+			kept = append(kept, person)
+		}
+		return kept
+	}
+	changeSet.Update = filter(changeSet.Update, OperationUpdate)
+	changeSet.Delete = filter(changeSet.Delete, OperationDelete)
+	return changeSet, skipped, nil
+}
+
+func printProtected(logger *log.Logger, skipped []ProtectedChange) {
+	if len(skipped) == 0 {
+		return
+	}
+	logger.Printf("    %v changes to protected accounts are not made\n", len(skipped))
+	for i, p := range skipped {
+		logger.Printf("  %v) PROTECTED %s %s", i+1, p.Operation, p.Person.CompareValue)
+	}
+}
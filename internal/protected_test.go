@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProtectAccounts(t *testing.T) {
+	person := func(compareValue string) Person {
+		return Person{CompareValue: compareValue}
+	}
+	changeSet := ChangeSet{
+		Create: []Person{person("admin@example.org"), person("new@example.org")},
+		Update: []Person{person("Admin@Example.org"), person("jane@example.org"), person("svc-backup@example.org")},
+		Delete: []Person{person("svc-mail@example.org"), person("john@example.org"), person("breakglass1@example.org")},
+	}
+	config := ProtectedConfig{
+		CompareValues: []string{"admin@example.org"},
+		Patterns:      []string{`^svc-`, `^breakglass\d+@`},
+	}
+
+	got, skipped, err := protectAccounts(changeSet, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ChangeSet{
+		Create: []Person{person("admin@example.org"), person("new@example.org")},
+		Update: []Person{person("jane@example.org")},
+		Delete: []Person{person("john@example.org")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("protectAccounts() = %+v, want %+v", got, want)
+	}
+	wantSkipped := []ProtectedChange{
+		{Operation: OperationUpdate, Person: person("Admin@Example.org")},
+		{Operation: OperationUpdate, Person: person("svc-backup@example.org")},
+		{Operation: OperationDelete, Person: person("svc-mail@example.org")},
+		{Operation: OperationDelete, Person: person("breakglass1@example.org")},
+	}
+	if !reflect.DeepEqual(skipped, wantSkipped) {
+		t.Errorf("protectAccounts() skipped %+v, want %+v", skipped, wantSkipped)
+	}
+
+	if got, skipped, _ := protectAccounts(changeSet, ProtectedConfig{}); !reflect.DeepEqual(got, changeSet) ||
+		len(skipped) > 0 {
+		t.Errorf("protectAccounts() changed the ChangeSet without any protected accounts")
+	}
+
+	if err := (ProtectedConfig{Patterns: []string{"("}}).validate(); err == nil {
+		t.Error("validate() did not return an error for an invalid pattern")
+	}
+}
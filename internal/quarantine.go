@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultQuarantineRetryAfterHours = 24
+
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+// QuarantineConfig enables the quarantine of people whose change keeps failing. A change that is attempted but is
+// still needed on the next run is counted as a failure. After Threshold consecutive failures of the same change,
+// the person is skipped until RetryAfterHours have passed, rather than generating the same error on every run.
+type QuarantineConfig struct {
+	// Threshold is the number of consecutive failures before a person is quarantined. Zero disables quarantine.
+	Threshold int
+
+	// RetryAfterHours is how long a person stays quarantined before their change is attempted once more
+	RetryAfterHours int
+}
+
+// QuarantineRecord tracks the pending change for one person
+type QuarantineRecord struct {
+	Operation     string
+	Hash          string
+	Failures      int
+	QuarantinedAt time.Time `json:",omitempty"`
+}
+
+// QuarantineState holds the records for a sync set, keyed by lower case compare value
+type QuarantineState map[string]QuarantineRecord
+
+// QuarantinedChange is a change that was skipped because the person is quarantined
+type QuarantinedChange struct {
+	Operation string
+	Person    Person
+	Failures  int
+}
+
+func quarantineKey(syncSetName string) string {
+	return "quarantine/" + syncSetName
+}
+
+// applyQuarantine removes the changes of quarantined people from the ChangeSet. It returns the remaining changes,
+// the changes that were skipped, and the new state to be saved once the remaining changes have been applied.
+// Operations that are disabled for the destination are never attempted, so they are not tracked.
+func applyQuarantine(changeSet ChangeSet, state QuarantineState, config AppConfig, now time.Time) (ChangeSet,
+	[]QuarantinedChange, QuarantineState) {
+
+	retryAfter := config.Quarantine.RetryAfterHours
+	if retryAfter <= 0 {
+		retryAfter = DefaultQuarantineRetryAfterHours
+	}
+
+	var remaining ChangeSet
+	var skipped []QuarantinedChange
+	newState := QuarantineState{}
+
+	filter := func(operation string, people []Person, disabled bool) []Person {
+		if disabled {
+			return people
+		}
+
+		var keep []Person
+		for _, p := range people {
+			key := strings.ToLower(p.CompareValue)
+			hash := hashPeople([]Person{p})
+
+			rec, ok := state[key]
+			if !ok || rec.Operation != operation || rec.Hash != hash {
+				newState[key] = QuarantineRecord{Operation: operation, Hash: hash}
+				keep = append(keep, p)
+				continue
+			}
+
+			if !rec.QuarantinedAt.IsZero() {
+				if now.Before(rec.QuarantinedAt.Add(time.Duration(retryAfter) * time.Hour)) {
+					newState[key] = rec
+					skipped = append(skipped, QuarantinedChange{Operation: operation, Person: p, Failures: rec.Failures})
+					continue
+				}
+
+				// retry once; if it fails again, the person is quarantined again on the next run
+				rec.QuarantinedAt = time.Time{}
+				newState[key] = rec
+				keep = append(keep, p)
+				continue
+			}
+
+			rec.Failures++
+			if rec.Failures >= config.Quarantine.Threshold {
+				rec.QuarantinedAt = now
+				newState[key] = rec
+				skipped = append(skipped, QuarantinedChange{Operation: operation, Person: p, Failures: rec.Failures})
+				continue
+			}
+			newState[key] = rec
+			keep = append(keep, p)
+		}
+		return keep
+	}
+
+	remaining.Create = filter(OperationCreate, changeSet.Create, config.Destination.DisableAdd)
+	remaining.Update = filter(OperationUpdate, changeSet.Update, config.Destination.DisableUpdate)
+	remaining.Delete = filter(OperationDelete, changeSet.Delete, config.Destination.DisableDelete)
+
+	return remaining, skipped, newState
+}
+
+// printQuarantined lists the changes skipped because of quarantine
+func printQuarantined(logger *log.Logger, skipped []QuarantinedChange) {
+	if len(skipped) == 0 {
+		return
+	}
+	logger.Printf("    %v people are quarantined after repeated failures\n", len(skipped))
+	for i, q := range skipped {
+		logger.Printf("  %v) QUARANTINED %s %s after %v consecutive failures", i+1, q.Operation,
+			q.Person.CompareValue, q.Failures)
+	}
+}
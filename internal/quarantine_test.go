@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyQuarantine(t *testing.T) {
+	config := AppConfig{Quarantine: QuarantineConfig{Threshold: 2, RetryAfterHours: 1}}
+	bad := Person{CompareValue: "bad@example.com", Attributes: map[string]string{"name": "Bad"}}
+	good := Person{CompareValue: "good@example.com", Attributes: map[string]string{"name": "Good"}}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var state QuarantineState
+	run := func(changeSet ChangeSet) (ChangeSet, []QuarantinedChange) {
+		var remaining ChangeSet
+		var skipped []QuarantinedChange
+		remaining, skipped, state = applyQuarantine(changeSet, state, config, now)
+		now = now.Add(10 * time.Minute)
+		return remaining, skipped
+	}
+
+	// first attempt and one failure are allowed
+	for i := 0; i < 2; i++ {
+		remaining, skipped := run(ChangeSet{Create: []Person{bad, good}})
+		if len(remaining.Create) != 2 || len(skipped) != 0 {
+			t.Fatalf("run %v: remaining = %v, skipped = %v, want no quarantine", i+1, remaining, skipped)
+		}
+	}
+
+	// good succeeded, bad failed for the second time
+	remaining, skipped := run(ChangeSet{Create: []Person{bad}})
+	if len(remaining.Create) != 0 || len(skipped) != 1 || skipped[0].Failures != 2 {
+		t.Fatalf("remaining = %v, skipped = %v, want bad quarantined after 2 failures", remaining, skipped)
+	}
+	if _, ok := state["good@example.com"]; ok {
+		t.Error("state should not include a person without a pending change")
+	}
+
+	// still quarantined
+	if remaining, _ := run(ChangeSet{Create: []Person{bad}}); len(remaining.Create) != 0 {
+		t.Errorf("remaining = %v, want bad still quarantined", remaining)
+	}
+
+	// retried once the quarantine has expired, then quarantined again
+	now = now.Add(time.Hour)
+	if remaining, _ := run(ChangeSet{Create: []Person{bad}}); len(remaining.Create) != 1 {
+		t.Errorf("remaining = %v, want bad retried", remaining)
+	}
+	if remaining, _ := run(ChangeSet{Create: []Person{bad}}); len(remaining.Create) != 0 {
+		t.Errorf("remaining = %v, want bad quarantined again", remaining)
+	}
+
+	// a different change is not quarantined
+	changed := Person{CompareValue: "bad@example.com", Attributes: map[string]string{"name": "Fixed"}}
+	if remaining, _ := run(ChangeSet{Create: []Person{changed}}); len(remaining.Create) != 1 {
+		t.Errorf("remaining = %v, want changed person attempted", remaining)
+	}
+}
@@ -0,0 +1,52 @@
+package internal
+
+import "fmt"
+
+// SourceConstructor creates a Source from its config
+type SourceConstructor func(SourceConfig) (Source, error)
+
+// DestinationConstructor creates a Destination from its config
+type DestinationConstructor func(DestinationConfig) (Destination, error)
+
+// StateStoreConstructor creates a StateStore from its config
+type StateStoreConstructor func(StateConfig) (StateStore, error)
+
+var (
+	sourceConstructors      = map[string]SourceConstructor{}
+	destinationConstructors = map[string]DestinationConstructor{}
+	stateStoreConstructors  = map[string]StateStoreConstructor{}
+)
+
+// RegisterSource makes a source type available to the config. Adapter packages call it from init, so a program
+// only includes the adapters it imports.
+func RegisterSource(sourceType string, constructor SourceConstructor) {
+	sourceConstructors[sourceType] = constructor
+}
+
+// RegisterDestination makes a destination type available to the config
+func RegisterDestination(destinationType string, constructor DestinationConstructor) {
+	destinationConstructors[destinationType] = constructor
+}
+
+// RegisterStateStore makes a state store type available to the config
+func RegisterStateStore(stateType string, constructor StateStoreConstructor) {
+	stateStoreConstructors[stateType] = constructor
+}
+
+// NewSource creates the source of the configured type
+func NewSource(config SourceConfig) (Source, error) {
+	constructor, ok := sourceConstructors[config.Type]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized source type %q, is its adapter imported?", config.Type)
+	}
+	return constructor(config)
+}
+
+// NewDestination creates the destination of the configured type
+func NewDestination(config DestinationConfig) (Destination, error) {
+	constructor, ok := destinationConstructors[config.Type]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized destination type %q, is its adapter imported?", config.Type)
+	}
+	return constructor(config)
+}
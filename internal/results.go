@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// RunResults collects the ChangeResults of every sync set in a run, keyed by sync set name and then by destination,
+// so that a whole run can be reported from one object
+type RunResults struct {
+	mutex sync.Mutex
+
+	// SyncSets holds the results of each sync set for each of its destinations. The main Destination is keyed by
+	// its Type, unless it has a Name, and the named Destinations by their Name.
+	SyncSets map[string]map[string]ChangeResults
+}
+
+// NewRunResults returns an empty RunResults
+func NewRunResults() *RunResults {
+	return &RunResults{SyncSets: map[string]map[string]ChangeResults{}}
+}
+
+// add records the results of a sync set. The name of a sync set sent to a named destination is
+// "<sync set>/<destination>", so the destination name is removed to key it by the sync set's own name.
+func (r *RunResults) add(syncSetName string, destination DestinationConfig, results ChangeResults) {
+	if r == nil {
+		return
+	}
+
+	key := destination.Type
+	if destination.Name != "" {
+		key = destination.Name
+		syncSetName = strings.TrimSuffix(syncSetName, "/"+destination.Name)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.SyncSets[syncSetName] == nil {
+		r.SyncSets[syncSetName] = map[string]ChangeResults{}
+	}
+	r.SyncSets[syncSetName][key] = results
+}
+
+// JSON returns the results as a JSON object
+func (r *RunResults) JSON() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	data, _ := json.Marshal(struct {
+		SyncSets map[string]map[string]ChangeResults
+	}{r.SyncSets})
+	return string(data)
+}
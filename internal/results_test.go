@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestRunResults(t *testing.T) {
+	source := &testSource{people: []Person{
+		{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com"}},
+		{CompareValue: "bob@example.com", Attributes: map[string]string{"email": "bob@example.com"}},
+	}}
+	results := NewRunResults()
+	config := AppConfig{
+		Runtime:      RuntimeConfig{Results: results},
+		Destination:  DestinationConfig{Type: "GoogleGroups"},
+		Destinations: []DestinationConfig{{Name: "ldap", Type: "RestAPI"}},
+		AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}},
+	}
+	syncSet := SyncSet{Name: "staff", Destination: json.RawMessage(`{}`),
+		Destinations: map[string]json.RawMessage{"ldap": json.RawMessage(`{}`)}}
+
+	for i, run := range config.SyncSetDestinations(syncSet) {
+		destination := &eventDestination{}
+		if i == 1 {
+			destination.fail = "bob@example.com"
+		}
+		if err := RunSyncSet(log.New(ioutil.Discard, "", 0), source, destination, run.Config, run.SyncSet,
+			nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]map[string]ChangeResults{"staff": {
+		"GoogleGroups": {Created: 2},
+		"ldap": {Created: 1, Errors: map[ErrorCategory]uint64{ErrorCategoryUnknown: 1},
+			Failures: map[string]uint64{OperationCreate: 1}},
+	}}
+	if !reflect.DeepEqual(results.SyncSets, want) {
+		t.Errorf("SyncSets = %+v, want %+v", results.SyncSets, want)
+	}
+
+	var decoded struct {
+		SyncSets map[string]map[string]ChangeResults
+	}
+	if err := json.Unmarshal([]byte(results.JSON()), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.SyncSets, want) {
+		t.Errorf("JSON() = %s", results.JSON())
+	}
+}
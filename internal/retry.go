@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRetryMaxAttempts       = 3
+	DefaultRetryBaseDelayMillisec = 1000
+	DefaultRetryMaxDelayMillisec  = 30000
+)
+
+// DefaultRetryableStatusCodes are the HTTP status codes that are retried if RetryableStatusCodes is not configured
+var DefaultRetryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// DefaultRetryMethods are the HTTP methods that are retried for any retryable error if RetryMethods is not
+// configured. Repeating one of these requests has the same effect as sending it once.
+var DefaultRetryMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// RetryConfig controls how failed HTTP requests are retried. The zero value uses the defaults.
+type RetryConfig struct {
+	MaxAttempts          int
+	BaseDelayMillisec    int
+	MaxDelayMillisec     int
+	RetryableStatusCodes []int
+
+	// RetryMethods are the HTTP methods that are retried for any network error or retryable status code. Requests
+	// with other methods, such as a POST that creates a record, are only retried if they were not processed: if the
+	// connection could not be made, or the status is 429 or 503 and is retryable. Otherwise, a request that timed
+	// out after the record was created would create it twice.
+	RetryMethods []string
+
+	// Clock is used to wait between attempts. It is SystemClock unless set by a test.
+	Clock Clock `json:"-"`
+}
+
+func (r RetryConfig) withDefaults() RetryConfig {
+	if r.MaxAttempts <= 0 {
+		r.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if r.BaseDelayMillisec <= 0 {
+		r.BaseDelayMillisec = DefaultRetryBaseDelayMillisec
+	}
+	if r.MaxDelayMillisec <= 0 {
+		r.MaxDelayMillisec = DefaultRetryMaxDelayMillisec
+	}
+	if len(r.RetryableStatusCodes) == 0 {
+		r.RetryableStatusCodes = DefaultRetryableStatusCodes
+	}
+	if len(r.RetryMethods) == 0 {
+		r.RetryMethods = DefaultRetryMethods
+	}
+	if r.Clock == nil {
+		r.Clock = SystemClock
+	}
+	return r
+}
+
+// Do sends the request, retrying network errors and retryable status codes up to MaxAttempts times in total.
+// Requests with a method that is not in RetryMethods are only retried if they were not processed. The response
+// of the last attempt is returned, even if its status code is retryable. A response with a Retry-After longer than
+// MaxDelayMillisec is returned without retrying. The request body is resent on each
+// attempt, so requests must be created with a body that supports GetBody, such as strings.Reader or bytes.Reader.
+func (r RetryConfig) Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	r = r.withDefaults()
+	retryMethod := r.isRetryMethod(req.Method)
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := client.Do(req)
+		lastAttempt := attempt+1 >= r.MaxAttempts
+		if err != nil {
+			if lastAttempt || req.Context().Err() != nil || !(retryMethod || isConnectError(err)) {
+				return nil, err
+			}
+			r.Clock.Sleep(r.Delay(attempt, ""))
+			continue
+		}
+
+		if lastAttempt || !r.IsRetryable(resp.StatusCode) || !(retryMethod || isUnprocessedStatus(resp.StatusCode)) {
+			return resp, nil
+		}
+
+		delay := r.Delay(attempt, resp.Header.Get("Retry-After"))
+		if r.ExceedsMaxDelay(delay) {
+			return resp, nil
+		}
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		r.Clock.Sleep(delay)
+	}
+}
+
+// isRetryMethod returns true if the method is one of the RetryMethods
+func (r RetryConfig) isRetryMethod(method string) bool {
+	for _, m := range r.RetryMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// isConnectError returns true if the request failed because the connection could not be made, so it was not sent
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isUnprocessedStatus returns true for the statuses of a request that the server rejected without processing it
+func isUnprocessedStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// Wait sleeps for the given duration using the configured Clock
+func (r RetryConfig) Wait(d time.Duration) {
+	r.withDefaults().Clock.Sleep(d)
+}
+
+// IsRetryable returns true if the status code is one of the RetryableStatusCodes
+func (r RetryConfig) IsRetryable(statusCode int) bool {
+	for _, code := range r.withDefaults().RetryableStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// ExceedsMaxDelay returns true if the delay, such as one asked for with Retry-After, is longer than MaxDelayMillisec,
+// so that the request should fail rather than be retried after a long wait
+func (r RetryConfig) ExceedsMaxDelay(delay time.Duration) bool {
+	r = r.withDefaults()
+	return delay > time.Duration(r.MaxDelayMillisec)*time.Millisecond
+}
+
+// Delay returns how long to wait before the next attempt. A Retry-After value given in seconds is honored.
+// Otherwise, it uses exponential backoff with "full jitter", a random delay between zero and the backoff.
+func (r RetryConfig) Delay(attempt int, retryAfter string) time.Duration {
+	r = r.withDefaults()
+
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	backoff := r.MaxDelayMillisec
+	if attempt < 30 && r.BaseDelayMillisec<<uint(attempt) < backoff {
+		backoff = r.BaseDelayMillisec << uint(attempt)
+	}
+
+	return time.Duration(rand.Intn(backoff+1)) * time.Millisecond
+}
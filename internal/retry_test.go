@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryConfig_Do(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       RetryConfig
+		method       string
+		statuses     []int
+		wantStatus   int
+		wantAttempts int
+	}{
+		{
+			name:         "success on first attempt",
+			config:       RetryConfig{BaseDelayMillisec: 1, MaxDelayMillisec: 1},
+			statuses:     []int{http.StatusOK},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 1,
+		},
+		{
+			name:         "retry 503 then succeed",
+			config:       RetryConfig{BaseDelayMillisec: 1, MaxDelayMillisec: 1},
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 3,
+		},
+		{
+			name:         "give up after MaxAttempts",
+			config:       RetryConfig{MaxAttempts: 2, BaseDelayMillisec: 1, MaxDelayMillisec: 1},
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantAttempts: 2,
+		},
+		{
+			name:         "do not retry non-retryable status",
+			config:       RetryConfig{BaseDelayMillisec: 1, MaxDelayMillisec: 1},
+			statuses:     []int{http.StatusBadRequest, http.StatusOK},
+			wantStatus:   http.StatusBadRequest,
+			wantAttempts: 1,
+		},
+		{
+			name: "custom retryable status codes",
+			config: RetryConfig{BaseDelayMillisec: 1, MaxDelayMillisec: 1,
+				RetryableStatusCodes: []int{http.StatusConflict}},
+			method:       http.MethodPut,
+			statuses:     []int{http.StatusConflict, http.StatusServiceUnavailable, http.StatusOK},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantAttempts: 2,
+		},
+		{
+			name:         "do not retry a POST that may have been processed",
+			config:       RetryConfig{BaseDelayMillisec: 1, MaxDelayMillisec: 1},
+			statuses:     []int{http.StatusGatewayTimeout, http.StatusOK},
+			wantStatus:   http.StatusGatewayTimeout,
+			wantAttempts: 1,
+		},
+		{
+			name:         "retry an idempotent method",
+			config:       RetryConfig{BaseDelayMillisec: 1, MaxDelayMillisec: 1},
+			method:       http.MethodPut,
+			statuses:     []int{http.StatusGatewayTimeout, http.StatusOK},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+		},
+		{
+			name: "configured retry methods",
+			config: RetryConfig{BaseDelayMillisec: 1, MaxDelayMillisec: 1,
+				RetryMethods: []string{http.MethodPost}},
+			statuses:     []int{http.StatusInternalServerError, http.StatusOK},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				body, _ := ioutil.ReadAll(req.Body)
+				if string(body) != "payload" {
+					t.Errorf("attempt %d got body %q, want %q", attempts+1, body, "payload")
+				}
+				w.WriteHeader(tt.statuses[attempts])
+				attempts++
+			}))
+			defer server.Close()
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req, _ := http.NewRequest(method, server.URL, strings.NewReader("payload"))
+			resp, err := tt.config.Do(&http.Client{}, req)
+			if err != nil {
+				t.Fatalf("Do() error = %s", err)
+			}
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Do() status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("Do() made %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryConfig_Delay(t *testing.T) {
+	r := RetryConfig{BaseDelayMillisec: 100, MaxDelayMillisec: 300}
+
+	if got := r.Delay(0, "7"); got != 7*time.Second {
+		t.Errorf("Delay() with Retry-After = %s, want 7s", got)
+	}
+
+	for attempt, max := range []time.Duration{100, 200, 300, 300} {
+		for i := 0; i < 20; i++ {
+			if got := r.Delay(attempt, ""); got < 0 || got > max*time.Millisecond {
+				t.Errorf("Delay(%d) = %s, want between 0 and %dms", attempt, got, max)
+			}
+		}
+	}
+}
+
+func TestRetryConfig_Do_RetryAfter(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := RetryConfig{Clock: clock}.Do(&http.Client{}, req)
+	if err != nil {
+		t.Fatalf("Do() error = %s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || attempts != 2 {
+		t.Errorf("Do() status = %d after %d attempts, want 200 after 2", resp.StatusCode, attempts)
+	}
+	if clock.Slept() != 30*time.Second {
+		t.Errorf("Do() waited %s, want 30s", clock.Slept())
+	}
+}
+
+func TestIsConnectError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	_, err := http.Post(url, "text/plain", strings.NewReader("payload"))
+	if err == nil || !isConnectError(err) {
+		t.Errorf("isConnectError(%v) = false, want true for a refused connection", err)
+	}
+	if isConnectError(io.ErrUnexpectedEOF) {
+		t.Errorf("isConnectError(%v) = true, want false", io.ErrUnexpectedEOF)
+	}
+}
+
+func TestRetryConfig_Do_LongRetryAfter(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := RetryConfig{Clock: clock}.Do(&http.Client{}, req)
+	if err != nil {
+		t.Fatalf("Do() error = %s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests || attempts != 1 {
+		t.Errorf("Do() status = %d after %d attempts, want 429 after 1", resp.StatusCode, attempts)
+	}
+	if clock.Slept() != 0 {
+		t.Errorf("Do() waited %s, want no wait", clock.Slept())
+	}
+}
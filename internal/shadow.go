@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"log/syslog"
+)
+
+// reportShadowChanges logs the changes that would be made to a destination in shadow mode and reports them to the
+// alerter. In digest mode they are included in the digest. They are sent as an alert only if there are at least
+// ShadowAlertThreshold changes.
+func reportShadowChanges(logger *log.Logger, destination Destination, config AppConfig, syncSet SyncSet,
+	changeSet ChangeSet) {
+
+	failures := validateChangeSet(destination, changeSet)
+	printChangeSet(logger, changeSet, failures, config.Runtime.GetMaxListedChanges(), "")
+
+	total := len(changeSet.Create) + len(changeSet.Update) + len(changeSet.Delete)
+	message := fmt.Sprintf("Shadow mode, sync set %s: %v users to add, %v users to update, %v users to remove, "+
+		"not applied", syncSet.Name, len(changeSet.Create), len(changeSet.Update), len(changeSet.Delete))
+	logger.Println(message)
+	if total == 0 {
+		return
+	}
+
+	level := syslog.LOG_WARNING
+	threshold := config.Destination.ShadowAlertThreshold
+	if threshold > 0 && total >= threshold {
+		level = syslog.LOG_ALERT
+	}
+	config.GetAlerter().SyncSetEvent(syncSet.Name, EventLogItem{Level: level, Message: message})
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v5/alert"
+)
+
+func TestRunSyncSet_Shadow(t *testing.T) {
+	source := &testSource{people: []Person{
+		{CompareValue: "new@example.com", Attributes: map[string]string{"email": "new@example.com"}},
+		{CompareValue: "other@example.com", Attributes: map[string]string{"email": "other@example.com"}},
+	}}
+
+	tests := []struct {
+		name      string
+		threshold int
+		want      []string
+	}{
+		{
+			name: "warning",
+			want: []string{"Warning: Shadow mode, sync set shadow: 2 users to add, 0 users to update, " +
+				"1 users to remove, not applied"},
+		},
+		{
+			name:      "alert",
+			threshold: 3,
+			want: []string{"Alert: Shadow mode, sync set shadow: 2 users to add, 0 users to update, " +
+				"1 users to remove, not applied"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := AppConfig{
+				Runtime:      RuntimeConfig{Clock: NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))},
+				Destination:  DestinationConfig{Shadow: true, ShadowAlertThreshold: tt.threshold},
+				Alert:        alert.Config{Policy: alert.Policy{DigestHours: 24}},
+				AttributeMap: []AttributeMap{{Source: "email", Destination: "email", Required: true}},
+			}
+			config.Runtime.Alerter = NewAlerter(config, &MemoryStateStore{})
+
+			destination := &testDestination{people: []Person{
+				{CompareValue: "old@example.com", Attributes: map[string]string{"id": "1", "email": "old@example.com"}},
+			}}
+
+			var buf bytes.Buffer
+			err := RunSyncSet(log.New(&buf, "", 0), source, destination, config, SyncSet{Name: "shadow"}, nil)
+			if err != nil {
+				t.Fatalf("RunSyncSet() error = %s", err)
+			}
+
+			if !reflect.DeepEqual(destination.changes, ChangeSet{}) {
+				t.Errorf("changes were applied in shadow mode: %+v", destination.changes)
+			}
+			if !strings.Contains(buf.String(), "1) new@example.com") {
+				t.Errorf("changes were not listed:\n%s", buf.String())
+			}
+			if got := config.Runtime.Alerter.state.Digest; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Digest = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
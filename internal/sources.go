@@ -0,0 +1,269 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SourceMergeConfig controls how the people of the AppConfig Sources are merged. People are matched by compare
+// value, ignoring case, and a person in any of the sources is synced.
+type SourceMergeConfig struct {
+	// Precedence lists the Sources by name, highest first. When a person is in more than one source, each attribute
+	// is taken from the first source in Precedence that has it. Sources that are not listed follow in the order of
+	// Sources.
+	Precedence []string
+
+	// AttributePrecedence overrides the Precedence for individual attributes, by the name used in the AttributeMap
+	AttributePrecedence map[string][]string
+
+	// SkipEmpty takes an attribute from the next source when it is empty in a source with a higher precedence
+	SkipEmpty bool
+
+	// SourcesAttribute, if set, is an attribute holding the names of the sources each person was found in, in
+	// order of precedence and separated by commas. It can be mapped in the AttributeMap like any other attribute.
+	SourcesAttribute string
+}
+
+// validateSources checks that either Source or Sources is configured, that each of the Sources has a unique Name,
+// and that the merge rules and sync sets only name Sources that exist
+func validateSources(config AppConfig) error {
+	if len(config.Sources) == 0 {
+		if config.Source.Type == "" {
+			return errors.New("configuration appears to be missing a Source configuration")
+		}
+		return nil
+	}
+	if config.Source.Type != "" {
+		return errors.New("configure either Source or Sources, not both")
+	}
+
+	names := map[string]bool{}
+	for i, source := range config.Sources {
+		if source.Name == "" {
+			return fmt.Errorf("Sources %v is missing a Name", i+1)
+		}
+		if names[source.Name] {
+			return fmt.Errorf("there is more than one source named %s", source.Name)
+		}
+		if source.Type == "" {
+			return fmt.Errorf("source %s is missing a Type", source.Name)
+		}
+		names[source.Name] = true
+	}
+
+	checkNames := func(what string, sourceNames []string) error {
+		for _, name := range sourceNames {
+			if !names[name] {
+				return fmt.Errorf("%s names source %s, which is not in Sources", what, name)
+			}
+		}
+		return nil
+	}
+	if err := checkNames("the SourceMerge Precedence", config.SourceMerge.Precedence); err != nil {
+		return err
+	}
+	for attribute, precedence := range config.SourceMerge.AttributePrecedence {
+		if err := checkNames("the SourceMerge AttributePrecedence of "+attribute, precedence); err != nil {
+			return err
+		}
+	}
+
+	for _, syncSet := range config.SyncSets {
+		var sourceSets map[string]json.RawMessage
+		if err := json.Unmarshal(syncSet.Source, &sourceSets); err != nil {
+			return fmt.Errorf("the Source of sync set %s must have the sync set config of each of its Sources, "+
+				"by name: %s", syncSet.Name, err)
+		}
+		for name := range sourceSets {
+			if err := checkNames("the Source of sync set "+syncSet.Name, []string{name}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mergedSource lists the people in several sources and merges them into one list
+type mergedSource struct {
+	configs map[string]SourceConfig
+	sources map[string]Source
+	merge   SourceMergeConfig
+
+	// precedence is the names of all of the sources, highest precedence first
+	precedence []string
+
+	// active is the names of the sources used by the current sync set, highest precedence first
+	active []string
+}
+
+// NewMergedSource creates each of the sources, and returns a Source that merges their people as configured. The
+// sync set config given to ForSet must be a JSON object with the sync set config of each source, by name. A source
+// that is not in it is not used for the sync set.
+func NewMergedSource(configs []SourceConfig, merge SourceMergeConfig) (Source, error) {
+	m := &mergedSource{
+		configs: map[string]SourceConfig{},
+		sources: map[string]Source{},
+		merge:   merge,
+	}
+	for _, config := range configs {
+		source, err := NewSource(config)
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize %s source %s: %s", config.Type, config.Name, err)
+		}
+		m.configs[config.Name] = config
+		m.sources[config.Name] = source
+	}
+
+	m.precedence = append(m.precedence, merge.Precedence...)
+	for _, config := range configs {
+		if found, _ := InArray(config.Name, m.precedence); !found {
+			m.precedence = append(m.precedence, config.Name)
+		}
+	}
+	return m, nil
+}
+
+// SetStateStore passes the state store to each source that uses one
+func (m *mergedSource) SetStateStore(stateStore StateStore) {
+	for _, source := range m.sources {
+		if user, ok := source.(StateStoreUser); ok {
+			user.SetStateStore(stateStore)
+		}
+	}
+}
+
+func (m *mergedSource) ForSet(syncSetJson json.RawMessage) error {
+	var sourceSets map[string]json.RawMessage
+	if err := json.Unmarshal(syncSetJson, &sourceSets); err != nil {
+		return fmt.Errorf("the sync set Source must have the config of each source, by name: %s", err)
+	}
+
+	m.active = nil
+	for _, name := range m.precedence {
+		setJSON, ok := sourceSets[name]
+		if !ok {
+			continue
+		}
+		if err := m.sources[name].ForSet(setJSON); err != nil {
+			return fmt.Errorf("source %s: %s", name, err)
+		}
+		m.active = append(m.active, name)
+	}
+	if len(m.active) == 0 {
+		return errors.New("the sync set Source does not name any of the Sources")
+	}
+	return nil
+}
+
+// sourcePerson is a person found in one of the sources
+type sourcePerson struct {
+	source string
+	person Person
+}
+
+// ListUsers lists the people in each of the sources used by the sync set, and merges the people with the same
+// compare value
+func (m *mergedSource) ListUsers(desiredAttrs []string) ([]Person, error) {
+	found := map[string][]sourcePerson{}
+	var keys []string
+	for _, name := range m.active {
+		people, err := m.listSource(name, desiredAttrs)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %s", name, err)
+		}
+		for _, person := range people {
+			key := strings.ToLower(person.CompareValue)
+			entries := found[key]
+			if len(entries) > 0 && entries[len(entries)-1].source == name {
+				continue // only the first record of a person in each source is used
+			}
+			if len(entries) == 0 {
+				keys = append(keys, key)
+			}
+			found[key] = append(entries, sourcePerson{source: name, person: person})
+		}
+	}
+
+	merged := make([]Person, 0, len(keys))
+	for _, key := range keys {
+		merged = append(merged, m.mergePerson(found[key]))
+	}
+	return merged, nil
+}
+
+// listSource lists the people in a source, renaming their attributes to the names used in the AttributeMap
+func (m *mergedSource) listSource(name string, desiredAttrs []string) ([]Person, error) {
+	attributeNames := m.configs[name].AttributeNames
+
+	var sourceAttrs []string
+	for _, attr := range desiredAttrs {
+		if attr == m.merge.SourcesAttribute {
+			continue
+		}
+		if sourceName, ok := attributeNames[attr]; ok {
+			attr = sourceName
+		}
+		sourceAttrs = append(sourceAttrs, attr)
+	}
+
+	people, err := m.sources[name].ListUsers(sourceAttrs)
+	if err != nil || len(attributeNames) == 0 {
+		return people, err
+	}
+
+	for i, person := range people {
+		attributes := make(map[string]string, len(person.Attributes))
+		for attr, value := range person.Attributes {
+			attributes[attr] = value
+		}
+		for attr, sourceName := range attributeNames {
+			if value, ok := person.Attributes[sourceName]; ok {
+				delete(attributes, sourceName)
+				attributes[attr] = value
+			}
+		}
+		people[i].Attributes = attributes
+	}
+	return people, nil
+}
+
+// mergePerson combines the records of a person from several sources, which are in order of precedence
+func (m *mergedSource) mergePerson(entries []sourcePerson) Person {
+	merged := entries[0].person
+	merged.Attributes = map[string]string{}
+
+	var sourceNames []string
+	for _, entry := range entries {
+		sourceNames = append(sourceNames, entry.source)
+		merged.DisableChanges = merged.DisableChanges || entry.person.DisableChanges
+
+		for attr := range entry.person.Attributes {
+			if _, ok := merged.Attributes[attr]; !ok {
+				merged.Attributes[attr] = m.attributeValue(attr, entries)
+			}
+		}
+	}
+
+	if m.merge.SourcesAttribute != "" {
+		merged.Attributes[m.merge.SourcesAttribute] = strings.Join(sourceNames, ",")
+	}
+	return merged
+}
+
+// attributeValue returns the value of an attribute from the source with the highest precedence for it
+func (m *mergedSource) attributeValue(attr string, entries []sourcePerson) string {
+	precedence := append(append([]string{}, m.merge.AttributePrecedence[attr]...), m.precedence...)
+	for _, name := range precedence {
+		for _, entry := range entries {
+			if entry.source != name {
+				continue
+			}
+			if value, ok := entry.person.Attributes[attr]; ok && (value != "" || !m.merge.SkipEmpty) {
+				return value
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeSource returns the people in its ExtraJSON, with only the desired attributes
+type fakeSource struct {
+	People []Person
+}
+
+func init() {
+	RegisterSource("Fake", func(config SourceConfig) (Source, error) {
+		var s fakeSource
+		err := json.Unmarshal(config.ExtraJSON, &s)
+		return &s, err
+	})
+}
+
+func (s *fakeSource) ForSet(syncSetJson json.RawMessage) error {
+	return nil
+}
+
+func (s *fakeSource) ListUsers(desiredAttrs []string) ([]Person, error) {
+	var people []Person
+	for _, person := range s.People {
+		attributes := map[string]string{}
+		for _, attr := range desiredAttrs {
+			if value, ok := person.Attributes[attr]; ok {
+				attributes[attr] = value
+			}
+		}
+		person.Attributes = attributes
+		people = append(people, person)
+	}
+	return people, nil
+}
+
+func TestMergedSource(t *testing.T) {
+	sources := []SourceConfig{
+		{Name: "hr", Type: "Fake", ExtraJSON: json.RawMessage(`{"People": [
+			{"CompareValue": "ann@example.org", "Attributes": {"email": "ann@example.org", "name": "Ann", "phone": ""}},
+			{"CompareValue": "bob@example.org", "Attributes": {"email": "bob@example.org", "name": "Bob"}}
+		]}`)},
+		{Name: "contractors", Type: "Fake", AttributeNames: map[string]string{"name": "full_name"},
+			ExtraJSON: json.RawMessage(`{"People": [
+			{"CompareValue": "ANN@example.org", "Attributes": {"email": "ANN@example.org", "full_name": "Annie",
+				"phone": "555-1234"}},
+			{"CompareValue": "cy@example.org", "Attributes": {"email": "cy@example.org", "full_name": "Cy"}},
+			{"CompareValue": "cy@example.org", "Attributes": {"email": "cy@example.org", "full_name": "Duplicate"}}
+		]}`)},
+	}
+
+	tests := []struct {
+		name    string
+		merge   SourceMergeConfig
+		setJSON string
+		want    map[string]map[string]string
+	}{
+		{
+			name:    "order of Sources",
+			setJSON: `{"hr": {}, "contractors": {}}`,
+			want: map[string]map[string]string{
+				"ann@example.org": {"email": "ann@example.org", "name": "Ann", "phone": ""},
+				"bob@example.org": {"email": "bob@example.org", "name": "Bob"},
+				"cy@example.org":  {"email": "cy@example.org", "name": "Cy"},
+			},
+		},
+		{
+			name:    "precedence and skip empty",
+			merge:   SourceMergeConfig{Precedence: []string{"contractors"}, SkipEmpty: true},
+			setJSON: `{"hr": {}, "contractors": {}}`,
+			want: map[string]map[string]string{
+				"ANN@example.org": {"email": "ANN@example.org", "name": "Annie", "phone": "555-1234"},
+				"bob@example.org": {"email": "bob@example.org", "name": "Bob"},
+				"cy@example.org":  {"email": "cy@example.org", "name": "Cy"},
+			},
+		},
+		{
+			name: "attribute precedence and sources attribute",
+			merge: SourceMergeConfig{AttributePrecedence: map[string][]string{"phone": {"contractors"}},
+				SourcesAttribute: "sources"},
+			setJSON: `{"hr": {}, "contractors": {}}`,
+			want: map[string]map[string]string{
+				"ann@example.org": {"email": "ann@example.org", "name": "Ann", "phone": "555-1234",
+					"sources": "hr,contractors"},
+				"bob@example.org": {"email": "bob@example.org", "name": "Bob", "sources": "hr"},
+				"cy@example.org":  {"email": "cy@example.org", "name": "Cy", "sources": "contractors"},
+			},
+		},
+		{
+			name:    "one source",
+			setJSON: `{"contractors": {}}`,
+			want: map[string]map[string]string{
+				"ANN@example.org": {"email": "ANN@example.org", "name": "Annie", "phone": "555-1234"},
+				"cy@example.org":  {"email": "cy@example.org", "name": "Cy"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewMergedSource(sources, tt.merge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := source.ForSet(json.RawMessage(tt.setJSON)); err != nil {
+				t.Fatal(err)
+			}
+			people, err := source.ListUsers([]string{"email", "name", "phone", "sources"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string]map[string]string{}
+			for _, person := range people {
+				got[person.CompareValue] = person.Attributes
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListUsers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSources(t *testing.T) {
+	sources := []SourceConfig{{Name: "hr", Type: "Fake"}, {Name: "contractors", Type: "Fake"}}
+	syncSets := []SyncSet{{Name: "staff", Source: json.RawMessage(`{"hr": {}, "contractors": {}}`)}}
+
+	tests := []struct {
+		name    string
+		config  AppConfig
+		wantErr string
+	}{
+		{name: "source", config: AppConfig{Source: SourceConfig{Type: "Fake"}}},
+		{name: "none", wantErr: "missing a Source"},
+		{name: "sources", config: AppConfig{Sources: sources, SyncSets: syncSets,
+			SourceMerge: SourceMergeConfig{Precedence: []string{"contractors"}}}},
+		{name: "both", config: AppConfig{Source: SourceConfig{Type: "Fake"}, Sources: sources}, wantErr: "not both"},
+		{name: "missing name", config: AppConfig{Sources: []SourceConfig{{Type: "Fake"}}}, wantErr: "missing a Name"},
+		{name: "missing type", config: AppConfig{Sources: []SourceConfig{{Name: "hr"}}}, wantErr: "missing a Type"},
+		{name: "duplicate name", config: AppConfig{Sources: append(sources, SourceConfig{Name: "hr", Type: "Fake"})},
+			wantErr: "more than one"},
+		{name: "unknown precedence", config: AppConfig{Sources: sources,
+			SourceMerge: SourceMergeConfig{Precedence: []string{"payroll"}}}, wantErr: "payroll"},
+		{name: "unknown attribute precedence", config: AppConfig{Sources: sources,
+			SourceMerge: SourceMergeConfig{AttributePrecedence: map[string][]string{"phone": {"payroll"}}}},
+			wantErr: "payroll"},
+		{name: "unknown sync set source", config: AppConfig{Sources: sources,
+			SyncSets: []SyncSet{{Name: "staff", Source: json.RawMessage(`{"payroll": {}}`)}}}, wantErr: "payroll"},
+		{name: "sync set source not an object", config: AppConfig{Sources: sources,
+			SyncSets: []SyncSet{{Name: "staff", Source: json.RawMessage(`["hr"]`)}}}, wantErr: "staff"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSources(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateSources() error = %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateSources() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMergedSource_ForSet(t *testing.T) {
+	source, err := NewMergedSource([]SourceConfig{{Name: "hr", Type: "Fake", ExtraJSON: json.RawMessage(`{}`)}},
+		SourceMergeConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, setJSON := range []string{`{}`, `{"payroll": {}}`, `[]`} {
+		if err := source.ForSet(json.RawMessage(setJSON)); err == nil {
+			t.Errorf("ForSet(%s) did not return an error", setJSON)
+		}
+	}
+
+	if _, err := NewMergedSource([]SourceConfig{{Name: "x", Type: "Unknown"}}, SourceMergeConfig{}); err == nil {
+		t.Error("NewMergedSource() did not return an error for an unknown type")
+	}
+}
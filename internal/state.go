@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StateTypeFile     = "file"
+	StateTypeS3       = "s3"
+	StateTypeDynamoDB = "dynamodb"
+)
+
+type StateConfig struct {
+	Type               string
+	Path               string
+	Bucket             string
+	Prefix             string
+	Table              string
+	AWSRegion          string
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+
+	// SkipUnchanged skips a sync set if its source data, and the destination, are unchanged since the last run.
+	// The destination is still listed in full to detect drift, as no destination can list only what changed.
+	SkipUnchanged bool
+}
+
+// StateStore persists JSON-encodable values between runs
+type StateStore interface {
+	// Load unmarshals the value stored at key into v. It returns false if nothing has been stored at key.
+	Load(key string, v interface{}) (bool, error)
+	Save(key string, v interface{}) error
+}
+
+// SyncSetState is the record of the last applied run of a sync set
+type SyncSetState struct {
+	LastRun    time.Time
+	SourceHash string
+	Applied    []Person
+
+	// Dirty is set if any change failed on the last run, so that the next run is not skipped by SkipUnchanged
+	Dirty bool `json:",omitempty"`
+}
+
+// NewStateStore returns a StateStore for the configured backend, or nil if no backend is configured. Backends
+// other than file are provided by packages that register them, such as awsstate.
+func NewStateStore(config StateConfig) (StateStore, error) {
+	switch config.Type {
+	case "":
+		return nil, nil
+	case StateTypeFile:
+		if config.Path == "" {
+			return nil, errors.New("state Path is required for file state store")
+		}
+		return &FileStateStore{Path: config.Path}, nil
+	}
+
+	if constructor, ok := stateStoreConstructors[config.Type]; ok {
+		return constructor(config)
+	}
+	return nil, fmt.Errorf("unrecognized state store type: %s", config.Type)
+}
+
+// FileStateStore keeps all state in a single local JSON file
+type FileStateStore struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+func (f *FileStateStore) Load(key string, v interface{}) (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	all, err := f.readAll()
+	if err != nil {
+		return false, err
+	}
+	data, ok := all[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+func (f *FileStateStore) Save(key string, v interface{}) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	all, err := f.readAll()
+	if err != nil {
+		return err
+	}
+	if all[key], err = json.Marshal(v); err != nil {
+		return fmt.Errorf("unable to marshal state for %s: %s", key, err)
+	}
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal state file: %s", err)
+	}
+
+	// write to a temporary file first so a failed write doesn't destroy the existing state
+	tmp := f.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("unable to write state file %s: %s", tmp, err)
+	}
+	return os.Rename(tmp, f.Path)
+}
+
+func (f *FileStateStore) readAll() (map[string]json.RawMessage, error) {
+	all := map[string]json.RawMessage{}
+	data, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read state file %s: %s", f.Path, err)
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("unable to parse state file %s: %s", f.Path, err)
+	}
+	return all, nil
+}
+
+// MemoryStateStore keeps state in memory only. It is intended for testing.
+type MemoryStateStore struct {
+	data  map[string][]byte
+	mutex sync.Mutex
+}
+
+func (m *MemoryStateStore) Load(key string, v interface{}) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	data, ok := m.data[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+func (m *MemoryStateStore) Save(key string, v interface{}) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if m.data == nil {
+		m.data = map[string][]byte{}
+	}
+	m.data[key] = data
+	return nil
+}
+
+func syncSetStateKey(syncSetName string) string {
+	return "syncset/" + syncSetName
+}
+
+// hashPeople returns a hash of the people's compare values and attributes that does not depend on the
+// order of the list
+func hashPeople(people []Person) string {
+	sorted := make([]Person, len(people))
+	copy(sorted, people)
+	sort.Slice(sorted, func(i, j int) bool {
+		return strings.ToLower(sorted[i].CompareValue) < strings.ToLower(sorted[j].CompareValue)
+	})
+
+	h := sha256.New()
+	for _, p := range sorted {
+		attrs, _ := json.Marshal(p.Attributes)
+		_, _ = fmt.Fprintf(h, "%s\x00%s\x00%t\n", p.CompareValue, attrs, p.DisableChanges)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// reportDrift logs the differences between what was applied on the last run and what is now in the destination,
+// and returns whether there are any
+func reportDrift(logger *log.Logger, lastState SyncSetState, destinationPeople []Person, config AppConfig) bool {
+	quiet := config
+	quiet.Runtime.Verbosity = VerbosityLow
+	drift := GenerateChangeSet(log.New(ioutil.Discard, "", 0), lastState.Applied, destinationPeople, quiet)
+	if len(drift.Create)+len(drift.Update)+len(drift.Delete) == 0 {
+		return false
+	}
+	logger.Printf("Drift since last run at %s: %v added outside sync, %v modified outside sync, %v removed outside sync",
+		lastState.LastRun.UTC().Format(time.RFC1123Z), len(drift.Delete), len(drift.Update), len(drift.Create))
+	return true
+}
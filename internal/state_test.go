@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"log/syslog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileStateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewStateStore(StateConfig{Type: StateTypeFile, Path: filepath.Join(dir, "state.json")})
+	if err != nil {
+		t.Fatalf("NewStateStore() error = %s", err)
+	}
+
+	var got SyncSetState
+	found, err := store.Load(syncSetStateKey("set1"), &got)
+	if err != nil || found {
+		t.Fatalf("Load() on empty store = %v, %v; want false, nil", found, err)
+	}
+
+	want := SyncSetState{
+		LastRun:    time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		SourceHash: "abc",
+		Applied:    []Person{{CompareValue: "a", Attributes: map[string]string{"name": "A"}}},
+	}
+	if err := store.Save(syncSetStateKey("set1"), want); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+	if err := store.Save(syncSetStateKey("set2"), SyncSetState{SourceHash: "def"}); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+
+	found, err = store.Load(syncSetStateKey("set1"), &got)
+	if err != nil || !found {
+		t.Fatalf("Load() = %v, %v; want true, nil", found, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+}
+
+func TestHashPeople(t *testing.T) {
+	a := Person{CompareValue: "a", Attributes: map[string]string{"x": "1", "y": "2"}}
+	b := Person{CompareValue: "b", Attributes: map[string]string{"x": "3"}}
+
+	if hashPeople([]Person{a, b}) != hashPeople([]Person{b, a}) {
+		t.Error("hashPeople should not depend on order")
+	}
+
+	changed := Person{CompareValue: "b", Attributes: map[string]string{"x": "4"}}
+	if hashPeople([]Person{a, b}) == hashPeople([]Person{a, changed}) {
+		t.Error("hashPeople should change when an attribute changes")
+	}
+}
+
+// erringDestination makes the changes of a testDestination, but reports an error as if one of them had failed
+type erringDestination struct {
+	testDestination
+}
+
+func (d *erringDestination) ApplyChangeSet(changes ChangeSet, eventLog chan<- EventLogItem) ChangeResults {
+	results := d.testDestination.ApplyChangeSet(changes, eventLog)
+	eventLog <- EventLogItem{Level: syslog.LOG_ERR, Message: "unable to create bob@example.com"}
+	return results
+}
+
+func TestRunSyncSet_SkipUnchanged(t *testing.T) {
+	source := &testSource{people: []Person{
+		{CompareValue: "ann@example.com", Attributes: map[string]string{"email": "ann@example.com"}},
+		{CompareValue: "bob@example.com", Attributes: map[string]string{"email": "bob@example.com"}},
+	}}
+
+	tests := []struct {
+		name        string
+		destination func() (Destination, *testDestination)
+		drift       bool
+		wantSkip    bool
+	}{
+		{
+			name: "unchanged",
+			destination: func() (Destination, *testDestination) {
+				d := &testDestination{}
+				return d, d
+			},
+			wantSkip: true,
+		},
+		{
+			name: "failed changes",
+			destination: func() (Destination, *testDestination) {
+				d := &erringDestination{}
+				return d, &d.testDestination
+			},
+		},
+		{
+			name: "drift",
+			destination: func() (Destination, *testDestination) {
+				d := &testDestination{}
+				return d, d
+			},
+			drift: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "state")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			stateConfig := StateConfig{Type: StateTypeFile, Path: filepath.Join(dir, "state.json"), SkipUnchanged: true}
+			store, err := NewStateStore(stateConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config := AppConfig{
+				State:        stateConfig,
+				AttributeMap: []AttributeMap{{Source: "email", Destination: "email"}},
+			}
+			destination, people := tt.destination()
+
+			logger := log.New(ioutil.Discard, "", 0)
+			if err := RunSyncSet(logger, source, destination, config, SyncSet{Name: "staff"}, store); err != nil {
+				t.Fatal(err)
+			}
+			if tt.drift {
+				people.people[0].Attributes["email"] = "changed@example.com"
+			}
+
+			var buf bytes.Buffer
+			if err := RunSyncSet(log.New(&buf, "", 0), source, destination, config, SyncSet{Name: "staff"},
+				store); err != nil {
+				t.Fatal(err)
+			}
+			if skipped := strings.Contains(buf.String(), "skipping"); skipped != tt.wantSkip {
+				t.Errorf("second run skipped = %v, want %v:\n%s", skipped, tt.wantSkip, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+)
+
+// eventSummary counts the informational events of a sync set by their action, the first word of the message, such
+// as AddMember or CreateUser, so that a large reconciliation can be logged as one line instead of one per person
+type eventSummary struct {
+	syncSet string
+	actions []string
+	counts  map[string]int
+}
+
+func newEventSummary(syncSet string) *eventSummary {
+	return &eventSummary{syncSet: syncSet, counts: map[string]int{}}
+}
+
+// add counts an informational event by its Operation, and returns false for events at any other level
+func (s *eventSummary) add(item EventLogItem) bool {
+	if item.Level != syslog.LOG_INFO {
+		return false
+	}
+	action := item.Operation
+	if action == "" {
+		action = messageOperation(item.Message)
+	}
+	if s.counts[action] == 0 {
+		s.actions = append(s.actions, action)
+	}
+	s.counts[action]++
+	return true
+}
+
+// String returns a line such as `Sync set "staff": AddMember 150, RemoveMember 3`, or an empty string if no events
+// were counted
+func (s *eventSummary) String() string {
+	if len(s.actions) == 0 {
+		return ""
+	}
+	parts := make([]string, len(s.actions))
+	for i, action := range s.actions {
+		parts[i] = fmt.Sprintf("%s %v", action, s.counts[action])
+	}
+	return fmt.Sprintf("Sync set %q: %s", s.syncSet, strings.Join(parts, ", "))
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"bytes"
+	"log"
+	"log/syslog"
+	"strings"
+	"testing"
+)
+
+func TestProcessEventLog_Summary(t *testing.T) {
+	events := []EventLogItem{
+		{Level: syslog.LOG_INFO, Message: "AddMember a@example.com"},
+		{Level: syslog.LOG_INFO, Message: "AddMember b@example.com"},
+		{Level: syslog.LOG_ERR, Message: "unable to insert c@example.com in Google group"},
+		{Level: syslog.LOG_INFO, Message: "RemoveMember d@example.com"},
+		{Level: syslog.LOG_INFO, Message: "AddMember e@example.com"},
+	}
+
+	tests := []struct {
+		name    string
+		summary *eventSummary
+		want    []string
+	}{
+		{
+			name: "each event",
+			want: []string{
+				"Info: AddMember a@example.com",
+				"Info: AddMember b@example.com",
+				"Error (unknown): unable to insert c@example.com in Google group",
+				"Info: RemoveMember d@example.com",
+				"Info: AddMember e@example.com",
+			},
+		},
+		{
+			name:    "summary",
+			summary: newEventSummary("staff"),
+			want: []string{
+				"Error (unknown): unable to insert c@example.com in Google group",
+				`Sync set "staff": AddMember 3, RemoveMember 1`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventLog := make(chan EventLogItem, len(events))
+			for _, event := range events {
+				eventLog <- event
+			}
+			close(eventLog)
+
+			var buf bytes.Buffer
+			processEventLog(log.New(&buf, "", 0), AppConfig{}, "staff", nil, tt.summary, eventLog)
+			got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("processEventLog() logged\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
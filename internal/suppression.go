@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// UpdateHistory records when each attribute with an UpdateWindowHours was last written, keyed by person and then
+// by destination attribute
+type UpdateHistory map[string]map[string]AttributeUpdate
+
+// AttributeUpdate is the last value written to an attribute
+type AttributeUpdate struct {
+	Value     string
+	UpdatedAt time.Time
+
+	// Overwritten is set once the value has been found changed in the destination, so it is only reported once
+	Overwritten bool `json:",omitempty"`
+}
+
+func updateHistoryKey(syncSetName string) string {
+	return "updates/" + syncSetName
+}
+
+// updateSuppressor holds back updates to attributes that were already updated within their UpdateWindowHours
+type updateSuppressor struct {
+	history UpdateHistory
+	pending UpdateHistory
+	windows map[string]time.Duration
+	maps    map[string]AttributeMap
+	now     time.Time
+
+	// conflicts describes each attribute that was changed in the destination after it was synced
+	conflicts []string
+}
+
+// newUpdateSuppressor returns an updateSuppressor, or nil if no attribute has an UpdateWindowHours
+func newUpdateSuppressor(history UpdateHistory, attributeMap []AttributeMap, now time.Time) *updateSuppressor {
+	windows := map[string]time.Duration{}
+	for _, attrMap := range attributeMap {
+		if attrMap.UpdateWindowHours > 0 {
+			windows[attrMap.Destination] = time.Duration(attrMap.UpdateWindowHours) * time.Hour
+		}
+	}
+	if len(windows) == 0 {
+		return nil
+	}
+	if history == nil {
+		history = UpdateHistory{}
+	}
+
+	return &updateSuppressor{
+		history: history,
+		pending: UpdateHistory{},
+		windows: windows,
+		maps:    getAttributeMapsByDestination(attributeMap),
+		now:     now,
+	}
+}
+
+func updatePersonKey(p Person) string {
+	if p.SourceID != "" {
+		return "id:" + p.SourceID
+	}
+	return strings.ToLower(p.CompareValue)
+}
+
+// apply returns sp with the destination value restored for each attribute that was updated within its window.
+// The attributes that will be updated are recorded as pending.
+func (u *updateSuppressor) apply(logger *log.Logger, sp, dp Person) Person {
+	if u == nil {
+		return sp
+	}
+
+	key := updatePersonKey(sp)
+	var attrs map[string]string
+	for attr, window := range u.windows {
+		value, ok := sp.Attributes[attr]
+		if !ok || attributeValuesAreEqual(value, dp.Attributes[attr], u.maps[attr]) {
+			continue
+		}
+
+		last, found := u.history[key][attr]
+		if !found || !u.now.Before(last.UpdatedAt.Add(window)) {
+			u.setPending(key, attr, AttributeUpdate{Value: value, UpdatedAt: u.now})
+			continue
+		}
+
+		if dp.Attributes[attr] != last.Value && !last.Overwritten {
+			u.conflicts = append(u.conflicts, fmt.Sprintf(
+				`attribute "%s" of %s was changed in the destination from "%s" to "%s" after it was synced at %s; `+
+					"another process may also be writing it", attr, sp.CompareValue, last.Value, dp.Attributes[attr],
+				last.UpdatedAt.UTC().Format(time.RFC1123Z)))
+			last.Overwritten = true
+			u.history[key][attr] = last
+		}
+
+		logger.Printf(`User: "%s", update of "%s" suppressed until %s`+"\n", sp.CompareValue, attr,
+			last.UpdatedAt.Add(window).UTC().Format(time.RFC1123Z))
+		if attrs == nil {
+			attrs = map[string]string{}
+			for k, v := range sp.Attributes {
+				attrs[k] = v
+			}
+		}
+		attrs[attr] = dp.Attributes[attr]
+	}
+
+	if attrs != nil {
+		sp.Attributes = attrs
+	}
+	return sp
+}
+
+func (u *updateSuppressor) setPending(key, attr string, update AttributeUpdate) {
+	if u.pending[key] == nil {
+		u.pending[key] = map[string]AttributeUpdate{}
+	}
+	u.pending[key][attr] = update
+}
+
+// updatedHistory returns the history with the pending updates of the people that were updated added, and with
+// expired entries removed
+func (u *updateSuppressor) updatedHistory(updatedPeople []Person) UpdateHistory {
+	applied := UpdateHistory{}
+	for _, p := range updatedPeople {
+		key := updatePersonKey(p)
+		if attrs, ok := u.pending[key]; ok {
+			applied[key] = attrs
+		}
+	}
+
+	updated := UpdateHistory{}
+	for _, history := range []UpdateHistory{u.history, applied} {
+		for key, attrs := range history {
+			for attr, update := range attrs {
+				window, ok := u.windows[attr]
+				if !ok || !u.now.Before(update.UpdatedAt.Add(window)) {
+					continue
+				}
+				if updated[key] == nil {
+					updated[key] = map[string]AttributeUpdate{}
+				}
+				updated[key][attr] = update
+			}
+		}
+	}
+	return updated
+}
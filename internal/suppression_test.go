@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestUpdateSuppressor(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	config := AppConfig{AttributeMap: []AttributeMap{
+		{Source: "title", Destination: "title", UpdateWindowHours: 24},
+		{Source: "name", Destination: "name"},
+	}}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	person := func(title, name string) Person {
+		return Person{CompareValue: "a@example.com", Attributes: map[string]string{"title": title, "name": name}}
+	}
+
+	var history UpdateHistory
+	run := func(source, destination Person) (ChangeSet, *updateSuppressor) {
+		suppressor := newUpdateSuppressor(history, config.AttributeMap, now)
+		changeSet, _ := generateLinkedChangeSet(logger, []Person{source}, []Person{destination}, config, nil,
+			suppressor)
+		history = suppressor.updatedHistory(changeSet.Update)
+		return changeSet, suppressor
+	}
+
+	// first update is written and recorded
+	changeSet, _ := run(person("Manager", "A"), person("Clerk", "A"))
+	if len(changeSet.Update) != 1 || changeSet.Update[0].Attributes["title"] != "Manager" {
+		t.Fatalf("changeSet = %v, want title updated", changeSet)
+	}
+	if history["a@example.com"]["title"].Value != "Manager" {
+		t.Fatalf("history = %v, want title recorded", history)
+	}
+
+	// another process writes it back within the window: no update, one conflict
+	now = now.Add(time.Hour)
+	changeSet, suppressor := run(person("Manager", "A"), person("Clerk", "A"))
+	if len(changeSet.Update) != 0 {
+		t.Errorf("changeSet = %v, want title update suppressed", changeSet)
+	}
+	if len(suppressor.conflicts) != 1 {
+		t.Errorf("conflicts = %v, want one conflict", suppressor.conflicts)
+	}
+
+	// the conflict is only reported once, and other attributes are still updated
+	now = now.Add(time.Hour)
+	changeSet, suppressor = run(person("Manager", "B"), person("Clerk", "A"))
+	if len(suppressor.conflicts) != 0 {
+		t.Errorf("conflicts = %v, want conflict not repeated", suppressor.conflicts)
+	}
+	if len(changeSet.Update) != 1 || changeSet.Update[0].Attributes["title"] != "Clerk" ||
+		changeSet.Update[0].Attributes["name"] != "B" {
+		t.Errorf("changeSet = %v, want only name updated", changeSet)
+	}
+
+	// updated again once the window has passed
+	now = now.Add(24 * time.Hour)
+	changeSet, _ = run(person("Manager", "B"), person("Clerk", "B"))
+	if len(changeSet.Update) != 1 || changeSet.Update[0].Attributes["title"] != "Manager" {
+		t.Errorf("changeSet = %v, want title updated after the window", changeSet)
+	}
+	if !history["a@example.com"]["title"].UpdatedAt.Equal(now) {
+		t.Errorf("history = %v, want new update time", history)
+	}
+}
+
+func TestNewUpdateSuppressor_NoWindows(t *testing.T) {
+	if s := newUpdateSuppressor(nil, []AttributeMap{{Source: "a", Destination: "a"}}, time.Now()); s != nil {
+		t.Errorf("newUpdateSuppressor() = %v, want nil", s)
+	}
+}
@@ -0,0 +1,34 @@
+package internal
+
+import "strings"
+
+// SyncTargetsConfig lets a source attribute choose the destinations each person is synced to, such as board
+// members who should be in the contacts directory but not have an account
+type SyncTargetsConfig struct {
+	// Attribute is the source attribute holding the names of the person's targets, separated by commas. A person
+	// with no targets listed is synced to every destination. Each destination is named by its SyncTarget.
+	Attribute string
+}
+
+// filterSyncTargets returns the people whose targets include the named target and the number left out
+func filterSyncTargets(people []Person, attribute, target string) ([]Person, int) {
+	var kept []Person
+	for _, p := range people {
+		if hasSyncTarget(p.Attributes[attribute], target) {
+			kept = append(kept, p)
+		}
+	}
+	return kept, len(people) - len(kept)
+}
+
+func hasSyncTarget(targets, target string) bool {
+	if strings.TrimSpace(targets) == "" {
+		return true
+	}
+	for _, t := range strings.Split(targets, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), target) {
+			return true
+		}
+	}
+	return false
+}
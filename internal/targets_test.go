@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterSyncTargets(t *testing.T) {
+	people := []Person{
+		{CompareValue: "staff@example.org", Attributes: map[string]string{"syncTargets": ""}},
+		{CompareValue: "board@example.org", Attributes: map[string]string{"syncTargets": "contacts"}},
+		{CompareValue: "both@example.org", Attributes: map[string]string{"syncTargets": "Google, contacts"}},
+		{CompareValue: "none@example.org", Attributes: map[string]string{}},
+	}
+
+	tests := []struct {
+		name         string
+		target       string
+		want         []string
+		wantExcluded int
+	}{
+		{
+			name:         "google",
+			target:       "google",
+			want:         []string{"staff@example.org", "both@example.org", "none@example.org"},
+			wantExcluded: 1,
+		},
+		{
+			name:   "contacts",
+			target: "contacts",
+			want:   []string{"staff@example.org", "board@example.org", "both@example.org", "none@example.org"},
+		},
+		{
+			name:         "whd",
+			target:       "whd",
+			want:         []string{"staff@example.org", "none@example.org"},
+			wantExcluded: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, excluded := filterSyncTargets(people, "syncTargets", tt.target)
+			var got []string
+			for _, p := range kept {
+				got = append(got, p.CompareValue)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterSyncTargets() = %v, want %v", got, tt.want)
+			}
+			if excluded != tt.wantExcluded {
+				t.Errorf("filterSyncTargets() excluded %v, want %v", excluded, tt.wantExcluded)
+			}
+		})
+	}
+}
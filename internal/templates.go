@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SyncSetTemplate is a sync set to be repeated for each entry of Parameters. A `{name}` placeholder in the Name,
+// Source, Destination, or Destinations of the SyncSet is replaced by the value of the parameter with that name.
+type SyncSetTemplate struct {
+	SyncSet    SyncSet
+	Parameters []map[string]string
+}
+
+// expandSyncSetTemplates adds a sync set to the config for each parameter set of each template
+func expandSyncSetTemplates(config *AppConfig) error {
+	names := map[string]bool{}
+	for _, syncSet := range config.SyncSets {
+		names[syncSet.Name] = true
+	}
+
+	for i, template := range config.SyncSetTemplates {
+		if len(template.Parameters) == 0 {
+			return fmt.Errorf("sync set template %v (%s) has no Parameters", i+1, template.SyncSet.Name)
+		}
+
+		keys := parameterKeys(template.Parameters[0])
+		for j, params := range template.Parameters {
+			if got := parameterKeys(params); strings.Join(got, ",") != strings.Join(keys, ",") {
+				return fmt.Errorf("sync set template %v (%s) parameter set %v has parameters %v, expected %v",
+					i+1, template.SyncSet.Name, j+1, got, keys)
+			}
+
+			syncSet := template.SyncSet.expand(params)
+			if names[syncSet.Name] {
+				return fmt.Errorf("sync set template %v (%s) creates a sync set named %q, which already exists",
+					i+1, template.SyncSet.Name, syncSet.Name)
+			}
+			names[syncSet.Name] = true
+			config.SyncSets = append(config.SyncSets, syncSet)
+		}
+	}
+	return nil
+}
+
+// expand returns a copy of the sync set with its placeholders replaced by the parameter values
+func (s SyncSet) expand(params map[string]string) SyncSet {
+	var plain, escaped []string
+	for _, key := range parameterKeys(params) {
+		placeholder := "{" + key + "}"
+		plain = append(plain, placeholder, params[key])
+		escaped = append(escaped, placeholder, jsonEscape(params[key]))
+	}
+	jsonReplacer := strings.NewReplacer(escaped...)
+
+	s.Name = strings.NewReplacer(plain...).Replace(s.Name)
+	s.Filter = strings.NewReplacer(plain...).Replace(s.Filter)
+	if len(s.Source) > 0 {
+		s.Source = json.RawMessage(jsonReplacer.Replace(string(s.Source)))
+	}
+	if len(s.Destination) > 0 {
+		s.Destination = json.RawMessage(jsonReplacer.Replace(string(s.Destination)))
+	}
+	if len(s.Destinations) > 0 {
+		destinations := make(map[string]json.RawMessage, len(s.Destinations))
+		for name, setJSON := range s.Destinations {
+			destinations[name] = json.RawMessage(jsonReplacer.Replace(string(setJSON)))
+		}
+		s.Destinations = destinations
+	}
+	return s
+}
+
+func parameterKeys(params map[string]string) []string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonEscape returns the value escaped for use inside a JSON string
+func jsonEscape(value string) string {
+	b, _ := json.Marshal(value)
+	return string(b[1 : len(b)-1])
+}
@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExpandSyncSetTemplates(t *testing.T) {
+	template := SyncSetTemplate{
+		SyncSet: SyncSet{
+			Name:        "Staff in {country}",
+			Source:      json.RawMessage(`{"Query":"SELECT email FROM staff WHERE country = '{country}'"}`),
+			Destination: json.RawMessage(`{"GroupEmail":"staff-{code}@example.org"}`),
+			Features:    Features{"x": true},
+		},
+		Parameters: []map[string]string{
+			{"country": "Papua New Guinea", "code": "pg"},
+			{"country": `Côte d"Ivoire`, "code": "ci"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		config  AppConfig
+		want    []SyncSet
+		wantErr bool
+	}{
+		{
+			name: "expand",
+			config: AppConfig{
+				SyncSets:         []SyncSet{{Name: "All staff"}},
+				SyncSetTemplates: []SyncSetTemplate{template},
+			},
+			want: []SyncSet{
+				{Name: "All staff"},
+				{
+					Name:        "Staff in Papua New Guinea",
+					Source:      json.RawMessage(`{"Query":"SELECT email FROM staff WHERE country = 'Papua New Guinea'"}`),
+					Destination: json.RawMessage(`{"GroupEmail":"staff-pg@example.org"}`),
+					Features:    Features{"x": true},
+				},
+				{
+					Name:        `Staff in Côte d"Ivoire`,
+					Source:      json.RawMessage(`{"Query":"SELECT email FROM staff WHERE country = 'Côte d\"Ivoire'"}`),
+					Destination: json.RawMessage(`{"GroupEmail":"staff-ci@example.org"}`),
+					Features:    Features{"x": true},
+				},
+			},
+		},
+		{
+			name: "duplicate name",
+			config: AppConfig{
+				SyncSets:         []SyncSet{{Name: "Staff in Papua New Guinea"}},
+				SyncSetTemplates: []SyncSetTemplate{template},
+			},
+			wantErr: true,
+		},
+		{
+			name: "mismatched parameters",
+			config: AppConfig{SyncSetTemplates: []SyncSetTemplate{{
+				SyncSet:    SyncSet{Name: "{country}"},
+				Parameters: []map[string]string{{"country": "Kenya"}, {"contry": "Ghana"}},
+			}}},
+			wantErr: true,
+		},
+		{
+			name:    "no parameters",
+			config:  AppConfig{SyncSetTemplates: []SyncSetTemplate{{SyncSet: SyncSet{Name: "{country}"}}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := expandSyncSetTemplates(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandSyncSetTemplates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(tt.config.SyncSets, tt.want) {
+				t.Errorf("SyncSets = %+v\nwant %+v", tt.config.SyncSets, tt.want)
+			}
+			for _, s := range tt.config.SyncSets {
+				if len(s.Source) > 0 && !json.Valid(s.Source) {
+					t.Errorf("invalid Source JSON %s", s.Source)
+				}
+			}
+		})
+	}
+}
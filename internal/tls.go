@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// TLSConfig sets a client certificate for mutual TLS, and the CA certificates to trust, for an adapter's requests
+type TLSConfig struct {
+	// ClientCert and ClientKey are the PEM encoded client certificate and its private key. The certificate may be
+	// followed by intermediate certificates.
+	ClientCert PEMSource
+	ClientKey  PEMSource
+
+	// CACert is one or more PEM encoded CA certificates that are trusted in addition to the system roots, for
+	// servers with a certificate from a private CA
+	CACert PEMSource
+}
+
+// PEMSource is PEM encoded data given inline, in a file, or in an AWS Secrets Manager secret
+type PEMSource struct {
+	PEM  string
+	File string
+
+	// SecretID is the name or ARN of a secret holding the PEM data, read from AWSRegion, or the default region if
+	// not set, with the default AWS credentials
+	SecretID  string
+	AWSRegion string
+}
+
+// SecretProvider returns the value of the secret with the ID, from the region, or the default region if it is empty
+type SecretProvider func(secretID, region string) ([]byte, error)
+
+// getSecret reads the secret of a PEMSource with a SecretID. It is set by RegisterSecretProvider.
+var getSecret SecretProvider
+
+// RegisterSecretProvider sets the provider of the secrets of PEMSources with a SecretID, such as AWS Secrets Manager.
+// The provider package calls it from init, so a program only includes the dependencies of the provider it imports.
+func RegisterSecretProvider(provider SecretProvider) {
+	getSecret = provider
+}
+
+func (p PEMSource) isSet() bool {
+	return p.PEM != "" || p.File != "" || p.SecretID != ""
+}
+
+func (p PEMSource) load() ([]byte, error) {
+	switch {
+	case p.PEM != "":
+		return []byte(p.PEM), nil
+	case p.File != "":
+		data, err := ioutil.ReadFile(p.File)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %s", p.File, err)
+		}
+		return data, nil
+	case p.SecretID != "":
+		if getSecret == nil {
+			return nil, fmt.Errorf("unable to get secret %s: no secret provider is registered", p.SecretID)
+		}
+		data, err := getSecret(p.SecretID, p.AWSRegion)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get secret %s: %s", p.SecretID, err)
+		}
+		return data, nil
+	}
+	return nil, nil
+}
+
+// Config returns the tls.Config for the certificates, or nil if none are configured
+func (t TLSConfig) Config() (*tls.Config, error) {
+	if !t.ClientCert.isSet() && !t.ClientKey.isSet() && !t.CACert.isSet() {
+		return nil, nil
+	}
+	if t.ClientCert.isSet() != t.ClientKey.isSet() {
+		return nil, errors.New("TLS ClientCert and ClientKey must be set together")
+	}
+
+	config := &tls.Config{}
+
+	if t.ClientCert.isSet() {
+		certPEM, err := t.ClientCert.load()
+		if err != nil {
+			return nil, fmt.Errorf("unable to load TLS ClientCert: %s", err)
+		}
+		keyPEM, err := t.ClientKey.load()
+		if err != nil {
+			return nil, fmt.Errorf("unable to load TLS ClientKey: %s", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if t.CACert.isSet() {
+		caPEM, err := t.CACert.load()
+		if err != nil {
+			return nil, fmt.Errorf("unable to load TLS CACert: %s", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("no certificates found in TLS CACert")
+		}
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
+
+// NewHTTPClient returns an http.Client with the timeout, or no timeout if it is zero, that connects through the
+// proxy and uses the TLS certificates, if they are configured
+func NewHTTPClient(timeout time.Duration, proxy ProxyConfig, tlsConfig TLSConfig) (*http.Client, error) {
+
+	transport, err := proxy.Transport()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := tlsConfig.Config()
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		transport.TLSClientConfig = config
+	}
+
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newClientCertificate returns a self-signed client certificate and its key, PEM encoded
+func newClientCertificate(t *testing.T) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "personnel-sync"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestNewHTTPClient_MutualTLS(t *testing.T) {
+	clientCert, certPEM, keyPEM := newClientCertificate(t)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	serverCA := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "client.key")
+	if err := ioutil.WriteFile(keyFile, []byte(keyPEM), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer RegisterSecretProvider(getSecret)
+	RegisterSecretProvider(func(secretID, region string) ([]byte, error) {
+		if secretID == "hr/client-cert" && region == "us-east-1" {
+			return []byte(certPEM), nil
+		}
+		return nil, errors.New("secret not found")
+	})
+
+	tests := []struct {
+		name    string
+		config  TLSConfig
+		wantErr bool
+	}{
+		{
+			name: "inline",
+			config: TLSConfig{ClientCert: PEMSource{PEM: certPEM}, ClientKey: PEMSource{PEM: keyPEM},
+				CACert: PEMSource{PEM: serverCA}},
+		},
+		{
+			name: "file and secret",
+			config: TLSConfig{ClientCert: PEMSource{SecretID: "hr/client-cert", AWSRegion: "us-east-1"},
+				ClientKey: PEMSource{File: keyFile}, CACert: PEMSource{PEM: serverCA}},
+		},
+		{
+			name:    "no client certificate",
+			config:  TLSConfig{CACert: PEMSource{PEM: serverCA}},
+			wantErr: true,
+		},
+		{
+			name:    "untrusted server",
+			config:  TLSConfig{ClientCert: PEMSource{PEM: certPEM}, ClientKey: PEMSource{PEM: keyPEM}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewHTTPClient(5*time.Second, ProxyConfig{}, tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Get(server.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if string(body) != "personnel-sync" {
+				t.Errorf("body = %q, want the client certificate's common name", body)
+			}
+		})
+	}
+}
+
+func TestTLSConfig_Config(t *testing.T) {
+	_, certPEM, keyPEM := newClientCertificate(t)
+
+	tests := []struct {
+		name    string
+		config  TLSConfig
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "none", wantNil: true},
+		{name: "cert and key", config: TLSConfig{ClientCert: PEMSource{PEM: certPEM}, ClientKey: PEMSource{PEM: keyPEM}}},
+		{name: "cert without key", config: TLSConfig{ClientCert: PEMSource{PEM: certPEM}}, wantErr: true},
+		{name: "mismatched", config: TLSConfig{ClientCert: PEMSource{PEM: keyPEM}, ClientKey: PEMSource{PEM: certPEM}},
+			wantErr: true},
+		{name: "missing file", config: TLSConfig{ClientCert: PEMSource{PEM: certPEM},
+			ClientKey: PEMSource{File: "/nonexistent/client.key"}}, wantErr: true},
+		{name: "bad CA", config: TLSConfig{CACert: PEMSource{PEM: "not a certificate"}}, wantErr: true},
+		{name: "no secret provider", config: TLSConfig{CACert: PEMSource{SecretID: "hr/ca"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.Config()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Config() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got == nil) != tt.wantNil {
+				t.Errorf("Config() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
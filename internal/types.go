@@ -2,7 +2,11 @@ package internal
 
 import (
 	"encoding/json"
+	"fmt"
 	"log/syslog"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/silinternational/personnel-sync/v5/alert"
 )
@@ -12,6 +16,71 @@ type Person struct {
 	ID             string
 	Attributes     map[string]string
 	DisableChanges bool
+
+	// SourceID is the stable source identifier used for ID linking. It is only set if IDLink is configured.
+	SourceID string
+
+	// PreviousCompareValue is the compare value of the destination person, on an update of a person matched by an
+	// ID link whose compare value has changed, such as a new email address. A destination finds the person by it,
+	// and renames them to the new CompareValue.
+	PreviousCompareValue string `json:",omitempty"`
+
+	// CreatedAt and LastLoginAt are set by destinations that provide them, for the orphan report. They are zero
+	// if unknown.
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+
+	// Changes are the attributes that differ from the destination, sorted by attribute name. They are only set on
+	// the people in the Update of a ChangeSet, so that a destination can update only what changed.
+	Changes []AttributeChange `json:",omitempty"`
+}
+
+// AttributeChange is an attribute of a person to be updated, with its value in the destination and its new value
+type AttributeChange struct {
+	Attribute string
+	Old       string
+	New       string
+
+	// Masked leaves Old and New out of log and event messages, as configured by MaskChanges of the AttributeMap
+	Masked bool `json:",omitempty"`
+}
+
+// ChangedAttributes returns the new value of each attribute in the person's Changes, for a destination that updates
+// only what changed. If the person has no Changes, as in a ChangeSet made without comparing with the destination,
+// it returns all of the Attributes.
+func (p Person) ChangedAttributes() map[string]string {
+	if len(p.Changes) == 0 {
+		return p.Attributes
+	}
+	changed := map[string]string{}
+	for _, change := range p.Changes {
+		changed[change.Attribute] = change.New
+	}
+	return changed
+}
+
+// FormatChanges returns the person's Changes as text, such as `title "Engineer" -> "Manager", phone changed`,
+// without the values of Masked changes
+func (p Person) FormatChanges() string {
+	changes := make([]string, len(p.Changes))
+	for i, change := range p.Changes {
+		if change.Masked {
+			changes[i] = change.Attribute + " changed"
+			continue
+		}
+		changes[i] = fmt.Sprintf("%s %q -> %q", change.Attribute, change.Old, change.New)
+	}
+	return strings.Join(changes, ", ")
+}
+
+// UpdateMessage returns the event log message for an update of the person, such as
+// `UpdateUser ann@example.org: title "Engineer" -> "Manager"`, listing the person's Changes if it has any
+func UpdateMessage(action, name string, person Person) string {
+	message := action + " " + name
+	if len(person.Changes) > 0 {
+		message += ": " + person.FormatChanges()
+	}
+	return message
 }
 
 type AttributeMap struct {
@@ -19,21 +88,145 @@ type AttributeMap struct {
 	Destination   string
 	Required      bool
 	CaseSensitive bool
+
+	// NormalizeWhitespace ignores leading and trailing whitespace and differences in internal whitespace, such as
+	// a double space, when comparing source and destination values
+	NormalizeWhitespace bool
+
+	// Multivalued compares the values as lists separated by commas, such as email aliases, ignoring the order of the
+	// items and whitespace around them
+	Multivalued bool
+
+	// PrivacyAttribute is the name of a source attribute that must be "true" for this attribute to be shared.
+	// If it is not, the attribute is synced as empty.
+	PrivacyAttribute string
+
+	// MaskChanges leaves the old and new values of the attribute, such as a phone number, out of the changes that
+	// are logged and recorded in update events
+	MaskChanges bool
+
+	// UpdateMode controls how the attribute is changed on update: UpdateModeOverwrite (the default),
+	// UpdateModeFillIfEmpty, UpdateModeIgnore, or UpdateModeBackfill. It has no effect when a person is created.
+	UpdateMode string
+
+	// UpdateWindowHours suppresses repeated updates of the attribute for the same person within this many hours,
+	// such as when another process is also writing it. It requires a state store.
+	UpdateWindowHours int
+
+	// WriteOnce is equivalent to an UpdateMode of UpdateModeFillIfEmpty, so that a value edited by the user in
+	// the destination, such as a preferred name, is not overwritten by the source.
+	WriteOnce bool
+
+	// ActiveValues converts the source value to "true" if it is one of these values, ignoring case, or "false"
+	// otherwise. It is used to sync an HR status field to the enabled attribute of a destination. An empty source
+	// value is left out, so that the destination is not changed.
+	ActiveValues []string
+
+	// Values converts the source value to the value it is mapped to, ignoring case and surrounding whitespace, such
+	// as "true" to "MANAGER". A value that is not in the map is synced as it is.
+	Values map[string]string
+
+	// MaxLength is the greatest number of characters a value may have, such as the limit of the destination's API.
+	// Longer values are handled as set by OverflowPolicy. Zero allows any length.
+	MaxLength int
+
+	// OverflowPolicy is what is done with a value longer than MaxLength: OverflowTruncate (the default) shortens
+	// it, OverflowSkip leaves the attribute out so that the destination is not changed, and OverflowFail fails the
+	// sync set.
+	OverflowPolicy string
+}
+
+// activeValue returns "true" if the value is one of the ActiveValues and "false" if not
+func (a AttributeMap) activeValue(value string) string {
+	for _, active := range a.ActiveValues {
+		if strings.EqualFold(strings.TrimSpace(value), active) {
+			return "true"
+		}
+	}
+	return "false"
+}
+
+// mappedValue returns the value that the source value is mapped to by Values, or the source value if it is not
+// mapped
+func (a AttributeMap) mappedValue(value string) string {
+	for from, to := range a.Values {
+		if strings.EqualFold(strings.TrimSpace(value), strings.TrimSpace(from)) {
+			return to
+		}
+	}
+	return value
+}
+
+const (
+	OverflowTruncate = "truncate"
+	OverflowSkip     = "skip"
+	OverflowFail     = "fail"
+)
+
+// overflows returns true if the value is longer than the MaxLength
+func (a AttributeMap) overflows(value string) bool {
+	return a.MaxLength > 0 && len([]rune(value)) > a.MaxLength
+}
+
+// truncate returns the first MaxLength characters of the value, without trailing whitespace
+func (a AttributeMap) truncate(value string) string {
+	return strings.TrimRightFunc(string([]rune(value)[:a.MaxLength]), unicode.IsSpace)
+}
+
+const (
+	UpdateModeOverwrite   = "overwrite"
+	UpdateModeFillIfEmpty = "fillIfEmpty"
+	UpdateModeIgnore      = "ignore"
+	UpdateModeBackfill    = "backfill"
+)
+
+// GetUpdateMode returns the effective UpdateMode, taking WriteOnce and the default into account
+func (a AttributeMap) GetUpdateMode() string {
+	if a.UpdateMode != "" {
+		return a.UpdateMode
+	}
+	if a.WriteOnce {
+		return UpdateModeFillIfEmpty
+	}
+	return UpdateModeOverwrite
 }
 
 type SourceConfig struct {
+	// Name identifies one of the AppConfig Sources in the Source of a sync set
+	Name string
+
 	Type      string
 	ExtraJSON json.RawMessage
+
+	// AttributeNames maps the attribute names used in the AttributeMap to the names used by this source, for the
+	// attributes that it names differently than the other Sources
+	AttributeNames map[string]string
 }
 
 type DestinationConfig struct {
+	// Name identifies one of the AppConfig Destinations in the Destinations of a sync set
+	Name string
+
 	Type          string
 	ExtraJSON     json.RawMessage
 	DisableAdd    bool
 	DisableUpdate bool
 	DisableDelete bool
+
+	// SyncTarget names this destination in the SyncTargets attribute of source people
+	SyncTarget string
+
+	// Shadow lists and compares the destination on every run and reports what would change, but never writes to
+	// it. If ShadowAlertThreshold is above zero, an alert is sent when at least that many changes are found.
+	Shadow               bool
+	ShadowAlertThreshold int
+
+	// AttributeMap, if set, replaces the AppConfig AttributeMap for this destination
+	AttributeMap []AttributeMap
 }
 
+const DefaultMaxListedChanges = 100
+
 const (
 	VerbosityLow    = 0
 	VerbosityMedium = 5
@@ -41,8 +234,72 @@ const (
 )
 
 type RuntimeConfig struct {
-	DryRunMode bool
-	Verbosity  int
+	DryRunMode     bool
+	Verbosity      int
+	PlanSigningKey string
+
+	// MaxListedChanges limits how many changes of each type are listed in dry-run and plan output. Zero means
+	// DefaultMaxListedChanges, and a negative number lists all changes.
+	MaxListedChanges int
+
+	// ChangeSetDir is a directory where the full ChangeSet of each sync set is written as JSON in dry-run mode
+	ChangeSetDir string
+
+	// OrphanReport lists the destination people not in the source with their age, whether or not deletes are
+	// enabled. People created within OrphanRecentDays (default DefaultOrphanRecentDays) are marked as recent.
+	OrphanReport     bool
+	OrphanRecentDays int
+
+	// FailureThresholds fail the run when too many changes of a sync set fail
+	FailureThresholds FailureThresholds
+
+	// Features turns new behaviors on or off before they become the default
+	Features Features
+
+	// EventLogFormat is the format that the events of each sync set are logged in: text, the default, or json,
+	// one JSON object per line with the structured fields of the event
+	EventLogFormat string
+
+	// MaxConcurrentSyncSets is the number of sync sets that are run at the same time, each with its own source and
+	// destinations. Sync sets that change the same destination target still run one after another, in order. Zero
+	// or one runs every sync set in turn.
+	MaxConcurrentSyncSets int
+
+	// Clock is used for all time-dependent behavior of the engine. It is SystemClock unless set by a test.
+	Clock Clock `json:"-"`
+
+	// Alerter applies the alert Policy across all sync sets of a run. If it is nil, alerts are sent immediately.
+	Alerter *Alerter `json:"-"`
+
+	// Hooks are called as the sync progresses, if they are set by a program embedding the engine
+	Hooks *Hooks `json:"-"`
+
+	// Results collects the results of every sync set, if it is set
+	Results *RunResults `json:"-"`
+}
+
+// GetAlerter returns the configured Alerter, or one that sends alerts immediately
+func (c AppConfig) GetAlerter() *Alerter {
+	if c.Runtime.Alerter == nil {
+		return NewAlerter(c, nil)
+	}
+	return c.Runtime.Alerter
+}
+
+// GetMaxListedChanges returns the effective MaxListedChanges
+func (r RuntimeConfig) GetMaxListedChanges() int {
+	if r.MaxListedChanges == 0 {
+		return DefaultMaxListedChanges
+	}
+	return r.MaxListedChanges
+}
+
+// GetClock returns the configured Clock or SystemClock
+func (r RuntimeConfig) GetClock() Clock {
+	if r.Clock == nil {
+		return SystemClock
+	}
+	return r.Clock
 }
 
 type AppConfig struct {
@@ -50,34 +307,133 @@ type AppConfig struct {
 	Source       SourceConfig
 	Destination  DestinationConfig
 	Alert        alert.Config
+	State        StateConfig
+	IDLink       IDLinkConfig
+	Compare      CompareConfig
+	Quarantine   QuarantineConfig
+	SyncTargets  SyncTargetsConfig
+	Inactivity   InactivityConfig
 	AttributeMap []AttributeMap
 	SyncSets     []SyncSet
+
+	// Destinations are named destinations that sync sets may send to, in addition to the Destination
+	Destinations []DestinationConfig
+
+	// Sources are named sources whose people are merged, instead of a single Source
+	Sources     []SourceConfig
+	SourceMerge SourceMergeConfig
+
+	// Anonymize pseudonymizes personal data from the source, for syncing to a test destination
+	Anonymize AnonymizeConfig
+
+	// Protected lists destination accounts that are never updated or deleted
+	Protected ProtectedConfig
+
+	// Hold lists people, or source and destination attributes, whose changes are not made while they are on hold
+	Hold HoldConfig
+
+	// GrowthGuard stops a sync set whose destination would grow or shrink too much in one run
+	GrowthGuard GrowthGuardConfig
+
+	// ApplyOrder orders the changes of each sync set, so that the most time-sensitive are made first
+	ApplyOrder []ApplyOrderKey
+
+	// SyncSetTemplates are expanded into SyncSets when the config is loaded
+	SyncSetTemplates []SyncSetTemplate
+
+	// SyncSetManifests are read when the config is loaded, and each adds a SyncSetTemplate
+	SyncSetManifests []SyncSetManifest
+
+	// SyncSetGroupings create sync sets when the sync runs, one for each value of a source attribute
+	SyncSetGroupings []SyncSetGrouping
 }
 
 type SyncSet struct {
 	Name        string
 	Source      json.RawMessage
 	Destination json.RawMessage
+
+	// Destinations holds the sync set configuration for each of the AppConfig Destinations that the sync set sends
+	// to, by destination Name. The source is listed once for all of them.
+	Destinations map[string]json.RawMessage
+
+	// Filter, if set, is an expression that selects the source people synced by this sync set, such as
+	// attrs.status == "active" && attrs.country == "US". See parseFilter.
+	Filter string
+
+	// CompareNormalizers, if set, replace the Compare Normalizers for this sync set
+	CompareNormalizers []string
+
+	// Features turns features on or off for this sync set, overriding the Runtime Features
+	Features Features
+
+	// Owner is sent the alerts about this sync set, in addition to the Alert RecipientEmails
+	Owner alert.Owner
+
+	// OnDelete adds the people removed from the destination to another destination, such as an alumni group
+	OnDelete OnDeleteConfig
 }
 
 type ChangeSet struct {
 	Create []Person
 	Update []Person
 	Delete []Person
+
+	// PartialUpdates is set when the PartialUpdates feature is enabled, so that a destination that supports it
+	// updates only the attributes that changed. See UpdateAttributes.
+	PartialUpdates bool `json:",omitempty"`
+}
+
+// UpdateAttributes returns the attributes to update for a person in the Update of the ChangeSet: the
+// ChangedAttributes if PartialUpdates is set, or otherwise all of the Attributes
+func (c ChangeSet) UpdateAttributes(person Person) map[string]string {
+	if c.PartialUpdates {
+		return person.ChangedAttributes()
+	}
+	return person.Attributes
 }
 
 type ChangeResults struct {
 	Created uint64
 	Updated uint64
 	Deleted uint64
+
+	// Errors is the number of errors in each category, counted from the event log
+	Errors map[ErrorCategory]uint64
+
+	// Failures is the number of failed changes of each operation (create, update, or delete), counted from the
+	// errors in the event log that can be attributed to an operation
+	Failures map[string]uint64 `json:",omitempty"`
 }
 
 type EventLogItem struct {
 	Message string
 	Level   syslog.Priority
+
+	// Category classifies an error. If it is not set on an error, it is derived from the Error, or from the Message
+	// if Error is not set.
+	Category ErrorCategory
+
+	// SyncSet is the name of the sync set, and Destination the Name of its destination, or the Type if it has no
+	// Name. They are set by the engine.
+	SyncSet     string
+	Destination string
+
+	// Operation is the kind of change, such as AddMember or UpdateUser. If it is not set on an informational event,
+	// it is the first word of the Message.
+	Operation string
+
+	// PersonCompareValue is the compare value of the person that the event is about, if any
+	PersonCompareValue string
+
+	// Error is the error of a failed change, without the rest of the Message
+	Error string
 }
 
 func (l *EventLogItem) String() string {
+	if l.Category != "" {
+		return LogLevels[l.Level] + " (" + string(l.Category) + "): " + l.Message
+	}
 	return LogLevels[l.Level] + ": " + l.Message
 }
 
@@ -98,7 +454,32 @@ type Destination interface {
 	ApplyChangeSet(changes ChangeSet, activityLog chan<- EventLogItem) ChangeResults
 }
 
+// ChangeSetValidator may be implemented by a Destination to check a ChangeSet in dry-run mode without making
+// any changes. It returns the reason, keyed by compare value, for each change that would fail.
+type ChangeSetValidator interface {
+	ValidateChangeSet(changes ChangeSet) map[string]string
+}
+
 type Source interface {
 	ForSet(syncSetJson json.RawMessage) error
 	ListUsers(desiredAttrs []string) ([]Person, error)
 }
+
+// SyncSetPreloader may be implemented by a Destination that can list the destinations of many sync sets faster
+// together than one at a time. PreloadSyncSets is called once, before the first sync set, with the Destination JSON
+// of each sync set that uses the Destination. An error is logged, and each sync set is then listed as usual.
+type SyncSetPreloader interface {
+	PreloadSyncSets(syncSetsJson []json.RawMessage) error
+}
+
+// StateStoreUser may be implemented by a Source or Destination that keeps data between runs, such as cached
+// responses. SetStateStore is called once, before the first sync set, if a state store is configured.
+type StateStoreUser interface {
+	SetStateStore(stateStore StateStore)
+}
+
+// AlertConfigUser may be implemented by a Destination that sends its own alerts, such as the password of a new
+// account. SetAlertConfig is called once, before the first sync set.
+type AlertConfigUser interface {
+	SetAlertConfig(config alert.Config)
+}
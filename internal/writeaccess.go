@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// WriteAccessChecker may be implemented by a Destination that can tell whether its credentials are allowed to make
+// changes. CheckWriteAccess is called once, before the first sync set. A Destination whose credentials are
+// read-only should prepare itself to list with them, so that it can still be used for dry runs and plans.
+type WriteAccessChecker interface {
+	CheckWriteAccess() (bool, error)
+}
+
+// CheckWriteAccess checks the credentials of each destination that is a WriteAccessChecker. Read-only credentials
+// are logged, and are an error if the run applies changes to the destination: applying is true for a run that
+// applies changes, and a destination in Shadow mode never has its changes applied. The destinations are in the
+// order of the configs.
+func CheckWriteAccess(destinations []Destination, configs []DestinationConfig, applying bool) error {
+	var readOnly []string
+	for i, destination := range destinations {
+		checker, ok := destination.(WriteAccessChecker)
+		if !ok {
+			continue
+		}
+		config := configs[i]
+		writable, err := checker.CheckWriteAccess()
+		if err != nil {
+			return fmt.Errorf("unable to check the credentials of %s: %s", destinationName(config), err)
+		}
+		if writable {
+			continue
+		}
+		if !applying || config.Shadow {
+			log.Printf("%s has read-only credentials, its changes can only be planned", destinationName(config))
+			continue
+		}
+		readOnly = append(readOnly, destinationName(config))
+	}
+
+	if len(readOnly) > 0 {
+		return fmt.Errorf("refusing to apply changes with read-only credentials for %s; use a dry run or a plan, "+
+			"or credentials that can make changes", strings.Join(readOnly, ", "))
+	}
+	return nil
+}
+
+// destinationName names the destination in messages by its Name, if it has one, and its Type
+func destinationName(config DestinationConfig) string {
+	if config.Name == "" {
+		return config.Type + " destination"
+	}
+	return fmt.Sprintf("%s destination %q", config.Type, config.Name)
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// credentialedDestination is a WriteAccessChecker with fixed credentials
+type credentialedDestination struct {
+	EmptyDestination
+	writable bool
+	err      error
+}
+
+func (c *credentialedDestination) CheckWriteAccess() (bool, error) {
+	return c.writable, c.err
+}
+
+func TestCheckWriteAccess(t *testing.T) {
+	configs := []DestinationConfig{
+		{Type: "GoogleUsers"},
+		{Type: "GoogleGroups", Name: "groups"},
+		{Type: "WebHelpDesk", Name: "helpdesk"},
+	}
+
+	tests := []struct {
+		name     string
+		readOnly *credentialedDestination
+		applying bool
+		shadow   bool
+		wantErr  string
+	}{
+		{name: "writable", readOnly: &credentialedDestination{writable: true}, applying: true},
+		{name: "read-only, planning", readOnly: &credentialedDestination{}},
+		{name: "read-only, shadow", readOnly: &credentialedDestination{}, applying: true, shadow: true},
+		{
+			name:     "read-only, applying",
+			readOnly: &credentialedDestination{},
+			applying: true,
+			wantErr:  `read-only credentials for GoogleGroups destination "groups";`,
+		},
+		{
+			name:     "check failed",
+			readOnly: &credentialedDestination{err: errors.New("no token")},
+			wantErr:  `unable to check the credentials of GoogleGroups destination "groups": no token`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destinations := []Destination{
+				&credentialedDestination{writable: true},
+				tt.readOnly,
+				&EmptyDestination{},
+			}
+			configs[1].Shadow = tt.shadow
+
+			err := CheckWriteAccess(destinations, configs, tt.applying)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("CheckWriteAccess() error = %s, want none", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("CheckWriteAccess() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,567 @@
+package keycloak
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+const (
+	DefaultBatchSize         = 10
+	DefaultBatchDelaySeconds = 1
+	DefaultPageSize          = 100
+
+	CompareUsername = "username"
+	CompareEmail    = "email"
+
+	// attributePrefix names a Person attribute that holds a Keycloak user attribute, e.g. attributes.employeeId
+	attributePrefix = "attributes."
+)
+
+// Keycloak is a destination for the users, or the members of a group, in a Keycloak realm, managed through the
+// admin REST API
+type Keycloak struct {
+	// BaseURL is the Keycloak server, e.g. https://sso.example.org, including /auth for versions before 17
+	BaseURL string
+
+	// Realm is the realm to manage, and AuthRealm is the realm of the client, if different
+	Realm     string
+	AuthRealm string
+
+	// ClientID and ClientSecret are the credentials of a confidential client with a service account that has the
+	// manage-users role of the realm-management client
+	ClientID     string
+	ClientSecret string
+
+	// CompareAttribute is username (the default) or email
+	CompareAttribute string
+
+	// DeleteUsers deletes users that are not in the source. By default they are disabled instead.
+	DeleteUsers bool
+
+	// BatchSize changes are made every BatchDelaySeconds, to avoid overloading the server
+	BatchSize         int
+	BatchDelaySeconds int
+
+	PageSize int
+	Retry    internal.RetryConfig
+
+	// Proxy is a SOCKS5 proxy for all requests, for a server that only allows a fixed egress host
+	Proxy internal.ProxyConfig
+
+	setConfig SetConfig
+	groupID   string
+	client    *http.Client
+}
+
+// SetConfig selects what a sync set manages
+type SetConfig struct {
+	// GroupPath, if set, is the path of a group, such as /staff/engineering, whose membership is synced instead of
+	// the realm's users. Members are added and removed, but users are never created or changed.
+	GroupPath string
+}
+
+// user is the part of a Keycloak UserRepresentation used to list users
+type user struct {
+	ID         string              `json:"id"`
+	Username   string              `json:"username"`
+	Email      string              `json:"email"`
+	FirstName  string              `json:"firstName"`
+	LastName   string              `json:"lastName"`
+	Enabled    bool                `json:"enabled"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+// apiError is an error response from Keycloak
+type apiError struct {
+	Status int
+	Body   string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("status: %d, body: %s", e.Status, e.Body)
+}
+
+func init() {
+	internal.RegisterDestination(internal.DestinationTypeKeycloak, NewKeycloakDestination)
+
+	internal.DescribeDestination(internal.DestinationTypeKeycloak, internal.AdapterConfig{
+		ExtraJSON: []interface{}{Keycloak{}},
+		SyncSet:   SetConfig{},
+	})
+}
+
+// NewKeycloakDestination unmarshals the destinationConfig's ExtraJSON into a Keycloak struct
+func NewKeycloakDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var k Keycloak
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &k); err != nil {
+		return &Keycloak{}, err
+	}
+
+	if k.BaseURL == "" || k.Realm == "" {
+		return &Keycloak{}, errors.New("BaseURL and Realm are required for the Keycloak destination")
+	}
+	if k.ClientID == "" || k.ClientSecret == "" {
+		return &Keycloak{}, errors.New("ClientID and ClientSecret are required for the Keycloak destination")
+	}
+
+	switch k.CompareAttribute {
+	case "":
+		k.CompareAttribute = CompareUsername
+	case CompareUsername, CompareEmail:
+	default:
+		return &Keycloak{}, fmt.Errorf("invalid Keycloak CompareAttribute %q, must be username or email",
+			k.CompareAttribute)
+	}
+
+	k.BaseURL = strings.TrimSuffix(k.BaseURL, "/")
+	if k.AuthRealm == "" {
+		k.AuthRealm = k.Realm
+	}
+	if k.BatchSize <= 0 {
+		k.BatchSize = DefaultBatchSize
+	}
+	if k.BatchDelaySeconds <= 0 {
+		k.BatchDelaySeconds = DefaultBatchDelaySeconds
+	}
+	if k.PageSize <= 0 {
+		k.PageSize = DefaultPageSize
+	}
+
+	cc := clientcredentials.Config{
+		ClientID:     k.ClientID,
+		ClientSecret: k.ClientSecret,
+		TokenURL:     k.BaseURL + "/realms/" + url.PathEscape(k.AuthRealm) + "/protocol/openid-connect/token",
+	}
+	proxyClient, err := k.Proxy.Client(0)
+	if err != nil {
+		return &Keycloak{}, err
+	}
+	k.client = cc.Client(context.WithValue(context.Background(), oauth2.HTTPClient, proxyClient))
+
+	return &k, nil
+}
+
+func (k *Keycloak) ForSet(syncSetJson json.RawMessage) error {
+	var setConfig SetConfig
+	if len(syncSetJson) > 0 {
+		if err := json.Unmarshal(syncSetJson, &setConfig); err != nil {
+			return err
+		}
+	}
+
+	if setConfig.GroupPath != "" && !strings.HasPrefix(setConfig.GroupPath, "/") {
+		setConfig.GroupPath = "/" + setConfig.GroupPath
+	}
+
+	k.setConfig = setConfig
+	k.groupID = ""
+	return nil
+}
+
+// ListUsers returns the enabled users of the realm, or the members of the group if the sync set has a GroupPath
+func (k *Keycloak) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+	path := "/users"
+	if k.setConfig.GroupPath != "" {
+		groupID, err := k.getGroupID()
+		if err != nil {
+			return nil, err
+		}
+		path = "/groups/" + url.PathEscape(groupID) + "/members"
+	}
+
+	var users []user
+	for first := 0; ; first += k.PageSize {
+		params := url.Values{
+			"first":               {strconv.Itoa(first)},
+			"max":                 {strconv.Itoa(k.PageSize)},
+			"briefRepresentation": {"false"},
+		}
+
+		body, err := k.request(http.MethodGet, path+"?"+params.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list Keycloak users: %s", err)
+		}
+
+		var page []user
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("unable to parse Keycloak users: %s", err)
+		}
+		users = append(users, page...)
+
+		if len(page) < k.PageSize {
+			break
+		}
+	}
+
+	var people []internal.Person
+	for _, u := range users {
+		if !u.Enabled && k.setConfig.GroupPath == "" {
+			continue
+		}
+		person := personFromUser(u, desiredAttrs)
+		person.CompareValue = person.Attributes[k.CompareAttribute]
+		if person.CompareValue == "" {
+			continue
+		}
+		people = append(people, person)
+	}
+	return people, nil
+}
+
+func personFromUser(u user, desiredAttrs []string) internal.Person {
+	attributes := map[string]string{
+		"id":        u.ID,
+		"username":  u.Username,
+		"email":     strings.ToLower(u.Email),
+		"firstName": u.FirstName,
+		"lastName":  u.LastName,
+		"enabled":   strconv.FormatBool(u.Enabled),
+	}
+	for _, attr := range desiredAttrs {
+		if !strings.HasPrefix(attr, attributePrefix) {
+			continue
+		}
+		if values := u.Attributes[strings.TrimPrefix(attr, attributePrefix)]; len(values) > 0 {
+			attributes[attr] = values[0]
+		} else {
+			attributes[attr] = ""
+		}
+	}
+
+	return internal.Person{
+		ID:         u.ID,
+		Attributes: attributes,
+	}
+}
+
+func (k *Keycloak) ApplyChangeSet(changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem) internal.ChangeResults {
+
+	var results internal.ChangeResults
+	var wg sync.WaitGroup
+	batchTimer := internal.NewBatchTimer(k.BatchSize, k.BatchDelaySeconds)
+
+	if k.setConfig.GroupPath != "" {
+		if _, err := k.getGroupID(); err != nil {
+			eventLog <- errorEvent(fmt.Sprintf("unable to sync Keycloak group %s", k.setConfig.GroupPath), err)
+			return results
+		}
+
+		for _, person := range changes.Create {
+			wg.Add(1)
+			go k.addMember(person, &results.Created, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+		for _, person := range changes.Delete {
+			wg.Add(1)
+			go k.removeMember(person, &results.Deleted, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+
+		wg.Wait()
+		return results
+	}
+
+	for _, person := range changes.Create {
+		wg.Add(1)
+		go k.createUser(person, &results.Created, &wg, eventLog)
+		batchTimer.WaitOnBatch()
+	}
+	for _, person := range changes.Update {
+		wg.Add(1)
+		go k.updateUser(person, &results.Updated, &wg, eventLog)
+		batchTimer.WaitOnBatch()
+	}
+	for _, person := range changes.Delete {
+		wg.Add(1)
+		go k.deleteUser(person, &results.Deleted, &wg, eventLog)
+		batchTimer.WaitOnBatch()
+	}
+
+	wg.Wait()
+	return results
+}
+
+// createUser creates the user. If the user already exists, as a disabled user, it is enabled and updated instead.
+func (k *Keycloak) createUser(person internal.Person, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	rep := map[string]interface{}{"enabled": true}
+	applyPerson(rep, person)
+
+	_, err := k.request(http.MethodPost, "/users", rep)
+	var e *apiError
+	if errors.As(err, &e) && e.Status == http.StatusConflict {
+		var existing user
+		existing, err = k.findUser(person.CompareValue)
+		if err == nil {
+			person.ID = existing.ID
+			err = k.putUser(person, true)
+		}
+	}
+	if err != nil {
+		eventLog <- errorEvent("unable to create Keycloak user "+person.CompareValue, err)
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: "CreateUser " + person.CompareValue,
+	}
+	atomic.AddUint64(counter, 1)
+}
+
+func (k *Keycloak) updateUser(person internal.Person, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	if err := k.putUser(person, false); err != nil {
+		eventLog <- errorEvent("unable to update Keycloak user "+person.CompareValue, err)
+		return
+	}
+
+	eventLog <- internal.UpdateEvent("UpdateUser", person.CompareValue, person)
+	atomic.AddUint64(counter, 1)
+}
+
+// putUser updates the user with the person's attributes, keeping any fields and user attributes that are not
+// synced
+func (k *Keycloak) putUser(person internal.Person, enable bool) error {
+	path := "/users/" + url.PathEscape(person.ID)
+	body, err := k.request(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+
+	var rep map[string]interface{}
+	if err := json.Unmarshal(body, &rep); err != nil {
+		return fmt.Errorf("unable to parse user: %s", err)
+	}
+	applyPerson(rep, person)
+	if enable {
+		rep["enabled"] = true
+	}
+
+	_, err = k.request(http.MethodPut, path, rep)
+	return err
+}
+
+func (k *Keycloak) deleteUser(person internal.Person, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	path := "/users/" + url.PathEscape(person.ID)
+	var err error
+	action := "DeleteUser"
+	if k.DeleteUsers {
+		_, err = k.request(http.MethodDelete, path, nil)
+	} else {
+		action = "DisableUser"
+		_, err = k.request(http.MethodPut, path, map[string]interface{}{"enabled": false})
+	}
+	if err != nil {
+		eventLog <- errorEvent("unable to delete Keycloak user "+person.CompareValue, err)
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: action + " " + person.CompareValue,
+	}
+	atomic.AddUint64(counter, 1)
+}
+
+func (k *Keycloak) addMember(person internal.Person, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	u, err := k.findUser(person.CompareValue)
+	if err == nil {
+		_, err = k.request(http.MethodPut, k.membershipPath(u.ID), nil)
+	}
+	if err != nil {
+		eventLog <- errorEvent(fmt.Sprintf("unable to add %s to Keycloak group %s", person.CompareValue,
+			k.setConfig.GroupPath), err)
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: fmt.Sprintf("AddMember %s to %s", person.CompareValue, k.setConfig.GroupPath),
+	}
+	atomic.AddUint64(counter, 1)
+}
+
+func (k *Keycloak) removeMember(person internal.Person, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	if _, err := k.request(http.MethodDelete, k.membershipPath(person.ID), nil); err != nil {
+		eventLog <- errorEvent(fmt.Sprintf("unable to remove %s from Keycloak group %s", person.CompareValue,
+			k.setConfig.GroupPath), err)
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: fmt.Sprintf("RemoveMember %s from %s", person.CompareValue, k.setConfig.GroupPath),
+	}
+	atomic.AddUint64(counter, 1)
+}
+
+func (k *Keycloak) membershipPath(userID string) string {
+	return "/users/" + url.PathEscape(userID) + "/groups/" + url.PathEscape(k.groupID)
+}
+
+// getGroupID looks up the ID of the sync set's group, once per sync set
+func (k *Keycloak) getGroupID() (string, error) {
+	if k.groupID != "" {
+		return k.groupID, nil
+	}
+
+	escaped := strings.Split(k.setConfig.GroupPath, "/")
+	for i := range escaped {
+		escaped[i] = url.PathEscape(escaped[i])
+	}
+	body, err := k.request(http.MethodGet, "/group-by-path"+strings.Join(escaped, "/"), nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to find Keycloak group %s: %s", k.setConfig.GroupPath, err)
+	}
+
+	var group struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &group); err != nil || group.ID == "" {
+		return "", fmt.Errorf("unable to parse Keycloak group %s: %s", k.setConfig.GroupPath, body)
+	}
+
+	k.groupID = group.ID
+	return k.groupID, nil
+}
+
+// findUser returns the user whose compare attribute exactly matches the value
+func (k *Keycloak) findUser(value string) (user, error) {
+	params := url.Values{
+		k.CompareAttribute: {value},
+		"exact":            {"true"},
+	}
+	body, err := k.request(http.MethodGet, "/users?"+params.Encode(), nil)
+	if err != nil {
+		return user{}, err
+	}
+
+	var users []user
+	if err := json.Unmarshal(body, &users); err != nil {
+		return user{}, fmt.Errorf("unable to parse users: %s", err)
+	}
+	for _, u := range users {
+		found := u.Username
+		if k.CompareAttribute == CompareEmail {
+			found = u.Email
+		}
+		if strings.EqualFold(found, value) {
+			return u, nil
+		}
+	}
+	return user{}, fmt.Errorf("user %s not found", value)
+}
+
+// applyPerson sets the fields of a UserRepresentation from the person's attributes
+func applyPerson(rep map[string]interface{}, person internal.Person) {
+	for _, field := range []string{"username", "email", "firstName", "lastName"} {
+		if value, ok := person.Attributes[field]; ok {
+			rep[field] = value
+		}
+	}
+	if value, ok := person.Attributes["enabled"]; ok {
+		if enabled, err := strconv.ParseBool(value); err == nil {
+			rep["enabled"] = enabled
+		}
+	}
+
+	attributes, _ := rep["attributes"].(map[string]interface{})
+	for name, value := range person.Attributes {
+		if !strings.HasPrefix(name, attributePrefix) {
+			continue
+		}
+		if attributes == nil {
+			attributes = map[string]interface{}{}
+		}
+		attributes[strings.TrimPrefix(name, attributePrefix)] = []string{value}
+	}
+	if attributes != nil {
+		rep["attributes"] = attributes
+	}
+}
+
+// request sends a request to the admin API of the realm
+func (k *Keycloak) request(method, path string, body interface{}) ([]byte, error) {
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		if bodyBytes, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("unable to marshal request body: %s", err)
+		}
+	}
+
+	reqURL := k.BaseURL + "/admin/realms/" + url.PathEscape(k.Realm) + path
+	req, err := http.NewRequest(method, reqURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := k.Retry.Do(k.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read http response body: %s", err)
+	}
+	if resp.StatusCode >= 400 {
+		return respBody, internal.NewStatusError(resp.StatusCode, resp.Header.Get("Retry-After"),
+			&apiError{Status: resp.StatusCode, Body: string(respBody)})
+	}
+	return respBody, nil
+}
+
+func errorEvent(message string, err error) internal.EventLogItem {
+	category := internal.ClassifyError(err)
+	var e *apiError
+	if errors.As(err, &e) {
+		category = internal.ClassifyHTTPStatus(e.Status)
+	}
+	return internal.EventLogItem{
+		Level:    syslog.LOG_ERR,
+		Category: category,
+		Message:  fmt.Sprintf("%s: %s", message, err),
+		Error:    err.Error(),
+	}
+}
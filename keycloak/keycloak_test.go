@@ -0,0 +1,275 @@
+package keycloak
+
+import (
+	"encoding/json"
+	"io"
+	"log/syslog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+// fakeKeycloak is an in-memory realm with one group, /staff
+type fakeKeycloak struct {
+	sync.Mutex
+	users   map[string]map[string]interface{}
+	members map[string]bool
+}
+
+func newFakeKeycloak() *fakeKeycloak {
+	return &fakeKeycloak{
+		users: map[string]map[string]interface{}{
+			"1": {"id": "1", "username": "jane", "email": "Jane@example.org", "firstName": "Jane", "enabled": true,
+				"attributes": map[string]interface{}{"employeeId": []interface{}{"100"}, "other": []interface{}{"x"}}},
+			"2": {"id": "2", "username": "john", "email": "john@example.org", "enabled": true},
+			"3": {"id": "3", "username": "gone", "email": "gone@example.org", "enabled": false},
+		},
+		members: map[string]bool{"1": true},
+	}
+}
+
+func (f *fakeKeycloak) server(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/realms/master/protocol/openid-connect/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"access_token":"token","token_type":"Bearer","expires_in":3600}`)
+	})
+
+	mux.HandleFunc("/admin/realms/acme/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.Lock()
+		defer f.Unlock()
+
+		path := strings.TrimPrefix(r.URL.Path, "/admin/realms/acme")
+		parts := strings.Split(strings.Trim(path, "/"), "/")
+		switch {
+		case path == "/users" && r.Method == http.MethodGet:
+			f.listUsers(w, r, func(u map[string]interface{}) bool { return true })
+		case path == "/users" && r.Method == http.MethodPost:
+			var u map[string]interface{}
+			_ = json.NewDecoder(r.Body).Decode(&u)
+			for _, existing := range f.users {
+				if existing["username"] == u["username"] {
+					w.WriteHeader(http.StatusConflict)
+					return
+				}
+			}
+			u["id"] = strconv.Itoa(len(f.users) + 1)
+			f.users[u["id"].(string)] = u
+			w.WriteHeader(http.StatusCreated)
+		case path == "/group-by-path/staff":
+			_, _ = io.WriteString(w, `{"id":"g1","path":"/staff"}`)
+		case path == "/groups/g1/members":
+			f.listUsers(w, r, func(u map[string]interface{}) bool { return f.members[u["id"].(string)] })
+		case len(parts) == 2 && parts[0] == "users":
+			u, ok := f.users[parts[1]]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			switch r.Method {
+			case http.MethodGet:
+				_ = json.NewEncoder(w).Encode(u)
+			case http.MethodPut:
+				var update map[string]interface{}
+				_ = json.NewDecoder(r.Body).Decode(&update)
+				for key, value := range update {
+					u[key] = value
+				}
+				w.WriteHeader(http.StatusNoContent)
+			case http.MethodDelete:
+				delete(f.users, parts[1])
+				w.WriteHeader(http.StatusNoContent)
+			}
+		case len(parts) == 4 && parts[0] == "users" && parts[2] == "groups" && parts[3] == "g1":
+			f.members[parts[1]] = r.Method == http.MethodPut
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func (f *fakeKeycloak) listUsers(w http.ResponseWriter, r *http.Request, include func(map[string]interface{}) bool) {
+	q := r.URL.Query()
+	var ids []string
+	for id, u := range f.users {
+		if !include(u) {
+			continue
+		}
+		if q.Get("exact") == "true" && q.Get("username") != u["username"] {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	first, _ := strconv.Atoi(q.Get("first"))
+	max, err := strconv.Atoi(q.Get("max"))
+	if err != nil {
+		max = len(ids)
+	}
+	page := []map[string]interface{}{}
+	for i := first; i < len(ids) && i < first+max; i++ {
+		page = append(page, f.users[ids[i]])
+	}
+	_ = json.NewEncoder(w).Encode(page)
+}
+
+func newTestKeycloak(t *testing.T, serverURL string) *Keycloak {
+	config := `{"BaseURL":"` + serverURL + `","Realm":"acme","AuthRealm":"master","ClientID":"sync",
+		"ClientSecret":"secret","PageSize":2}`
+	dest, err := NewKeycloakDestination(internal.DestinationConfig{ExtraJSON: json.RawMessage(config)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dest.(*Keycloak)
+}
+
+func applyChanges(k *Keycloak, changes internal.ChangeSet) (internal.ChangeResults, []string) {
+	eventLog := make(chan internal.EventLogItem, 50)
+	results := k.ApplyChangeSet(changes, eventLog)
+	close(eventLog)
+
+	var errs []string
+	for msg := range eventLog {
+		if msg.Level <= syslog.LOG_ERR {
+			errs = append(errs, msg.Message)
+		}
+	}
+	return results, errs
+}
+
+func TestKeycloak_ListUsers(t *testing.T) {
+	fake := newFakeKeycloak()
+	server := fake.server(t)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		setJSON string
+		want    []string
+	}{
+		{name: "users", setJSON: `{}`, want: []string{"jane", "john"}},
+		{name: "group", setJSON: `{"GroupPath":"staff"}`, want: []string{"jane"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := newTestKeycloak(t, server.URL)
+			if err := k.ForSet(json.RawMessage(tt.setJSON)); err != nil {
+				t.Fatal(err)
+			}
+			people, err := k.ListUsers([]string{"email", "attributes.employeeId"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, p := range people {
+				got = append(got, p.CompareValue)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListUsers() = %v, want %v", got, tt.want)
+			}
+			if people[0].Attributes["email"] != "jane@example.org" || people[0].Attributes["attributes.employeeId"] != "100" {
+				t.Errorf("ListUsers() attributes = %v", people[0].Attributes)
+			}
+		})
+	}
+}
+
+func TestKeycloak_ApplyChangeSet_Users(t *testing.T) {
+	fake := newFakeKeycloak()
+	server := fake.server(t)
+	defer server.Close()
+
+	k := newTestKeycloak(t, server.URL)
+	if err := k.ForSet(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	results, errs := applyChanges(k, internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "new", Attributes: map[string]string{"username": "new", "email": "new@example.org"}},
+			{CompareValue: "gone", Attributes: map[string]string{"username": "gone", "firstName": "Back"}},
+		},
+		Update: []internal.Person{
+			{CompareValue: "jane", ID: "1", Attributes: map[string]string{"lastName": "Doe", "attributes.employeeId": "101"}},
+		},
+		Delete: []internal.Person{{CompareValue: "john", ID: "2"}},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	want := internal.ChangeResults{Created: 2, Updated: 1, Deleted: 1}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+
+	if fake.users["4"]["username"] != "new" || fake.users["4"]["enabled"] != true {
+		t.Errorf("new user = %v", fake.users["4"])
+	}
+	if fake.users["3"]["enabled"] != true || fake.users["3"]["firstName"] != "Back" {
+		t.Errorf("existing disabled user was not enabled: %v", fake.users["3"])
+	}
+	wantAttributes := map[string]interface{}{"employeeId": []interface{}{"101"}, "other": []interface{}{"x"}}
+	if fake.users["1"]["lastName"] != "Doe" || !reflect.DeepEqual(fake.users["1"]["attributes"], wantAttributes) {
+		t.Errorf("updated user = %v", fake.users["1"])
+	}
+	if fake.users["2"]["enabled"] != false {
+		t.Errorf("deleted user was not disabled: %v", fake.users["2"])
+	}
+
+	k.DeleteUsers = true
+	_, errs = applyChanges(k, internal.ChangeSet{Delete: []internal.Person{{CompareValue: "john", ID: "2"}}})
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if _, ok := fake.users["2"]; ok {
+		t.Error("user was not deleted")
+	}
+}
+
+func TestKeycloak_ApplyChangeSet_Group(t *testing.T) {
+	fake := newFakeKeycloak()
+	server := fake.server(t)
+	defer server.Close()
+
+	k := newTestKeycloak(t, server.URL)
+	if err := k.ForSet(json.RawMessage(`{"GroupPath":"/staff"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	results, errs := applyChanges(k, internal.ChangeSet{
+		Create: []internal.Person{{CompareValue: "john"}, {CompareValue: "nobody"}},
+		Update: []internal.Person{{CompareValue: "jane", ID: "1", Attributes: map[string]string{"lastName": "Doe"}}},
+		Delete: []internal.Person{{CompareValue: "jane", ID: "1"}},
+	})
+	if len(errs) != 1 || !strings.Contains(errs[0], "nobody") {
+		t.Errorf("errors = %v, want one for nobody", errs)
+	}
+	want := internal.ChangeResults{Created: 1, Deleted: 1}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+	if !reflect.DeepEqual(fake.members, map[string]bool{"1": false, "2": true}) {
+		t.Errorf("members = %v", fake.members)
+	}
+	if _, ok := fake.users["1"]["lastName"]; ok {
+		t.Error("user was updated in group mode")
+	}
+}
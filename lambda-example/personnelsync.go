@@ -4,6 +4,7 @@ import (
 	"github.com/aws/aws-lambda-go/lambda"
 
 	personnel_sync "github.com/silinternational/personnel-sync/v5"
+	_ "github.com/silinternational/personnel-sync/v5/adapters"
 )
 
 type LambdaConfig struct {
@@ -0,0 +1,411 @@
+package mailchimp
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+const (
+	DefaultBatchSize         = 10
+	DefaultBatchDelaySeconds = 1
+	DefaultPageSize          = 1000
+
+	// EmailAttribute is the destination attribute holding a member's email address. All other destination
+	// attributes are merge fields, named by their tag, such as FNAME.
+	EmailAttribute = "email"
+
+	OnDeleteArchive     = "archive"
+	OnDeleteUnsubscribe = "unsubscribe"
+
+	statusSubscribed   = "subscribed"
+	statusUnsubscribed = "unsubscribed"
+	statusCleaned      = "cleaned"
+)
+
+// MailchimpLists is a destination for the members of Mailchimp audiences, also known as lists
+type MailchimpLists struct {
+	// APIKey is a Mailchimp API key. It ends with the data center of the account, such as -us6, which is used for
+	// the BaseURL.
+	APIKey string
+
+	// BaseURL is the API URL, https://<dc>.api.mailchimp.com/3.0 by default
+	BaseURL string
+
+	// BatchSize changes are made every BatchDelaySeconds, to stay within the API rate limits
+	BatchSize         int
+	BatchDelaySeconds int
+
+	// PageSize is the number of members listed per request, at most 1000
+	PageSize int
+
+	Retry internal.RetryConfig
+
+	// Proxy is a SOCKS5 proxy for all requests
+	Proxy internal.ProxyConfig
+
+	ListSyncSet ListSyncSet
+	client      *http.Client
+
+	// statuses are the statuses of the members listed by ListUsers, by lowercase email address
+	statuses map[string]string
+}
+
+// ListSyncSet selects the audience for a sync set by its ID
+type ListSyncSet struct {
+	ListID string
+
+	// OnDelete is what is done to members who are no longer in the source, archive (the default) or unsubscribe
+	OnDelete string
+
+	DisableAdd    bool
+	DisableUpdate bool
+	DisableDelete bool
+}
+
+type member struct {
+	EmailAddress string                     `json:"email_address"`
+	Status       string                     `json:"status"`
+	MergeFields  map[string]json.RawMessage `json:"merge_fields"`
+}
+
+func init() {
+	internal.RegisterDestination(internal.DestinationTypeMailchimpLists, NewMailchimpListsDestination)
+
+	internal.DescribeDestination(internal.DestinationTypeMailchimpLists, internal.AdapterConfig{
+		ExtraJSON: []interface{}{MailchimpLists{}},
+		SyncSet:   ListSyncSet{},
+		Features:  []string{internal.FeaturePartialUpdates},
+	})
+}
+
+// NewMailchimpListsDestination unmarshals the destinationConfig's ExtraJSON into a MailchimpLists struct
+func NewMailchimpListsDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var m MailchimpLists
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &m); err != nil {
+		return &MailchimpLists{}, err
+	}
+
+	if m.APIKey == "" {
+		return &MailchimpLists{}, errors.New("APIKey is required for MailchimpLists")
+	}
+
+	if m.BaseURL == "" {
+		i := strings.LastIndex(m.APIKey, "-")
+		if i < 0 {
+			return &MailchimpLists{}, errors.New("the MailchimpLists APIKey does not end with a data center, " +
+				"such as -us6, so BaseURL is required")
+		}
+		m.BaseURL = fmt.Sprintf("https://%s.api.mailchimp.com/3.0", m.APIKey[i+1:])
+	}
+	m.BaseURL = strings.TrimSuffix(m.BaseURL, "/")
+	if m.BatchSize <= 0 {
+		m.BatchSize = DefaultBatchSize
+	}
+	if m.BatchDelaySeconds <= 0 {
+		m.BatchDelaySeconds = DefaultBatchDelaySeconds
+	}
+	if m.PageSize <= 0 || m.PageSize > DefaultPageSize {
+		m.PageSize = DefaultPageSize
+	}
+	var err error
+	if m.client, err = m.Proxy.Client(time.Minute); err != nil {
+		return &MailchimpLists{}, err
+	}
+
+	return &m, nil
+}
+
+func (m *MailchimpLists) ForSet(syncSetJson json.RawMessage) error {
+	var syncSetConfig ListSyncSet
+	if err := json.Unmarshal(syncSetJson, &syncSetConfig); err != nil {
+		return err
+	}
+
+	if syncSetConfig.ListID == "" {
+		return errors.New("ListID missing from sync set json")
+	}
+
+	switch syncSetConfig.OnDelete {
+	case "":
+		syncSetConfig.OnDelete = OnDeleteArchive
+	case OnDeleteArchive, OnDeleteUnsubscribe:
+	default:
+		return fmt.Errorf("invalid OnDelete %q for list %s, must be archive or unsubscribe", syncSetConfig.OnDelete,
+			syncSetConfig.ListID)
+	}
+
+	m.ListSyncSet = syncSetConfig
+	return nil
+}
+
+// ListUsers returns the members of the audience that are not archived. Members who have unsubscribed, or whose
+// address was cleaned after bouncing, are included so that they are not subscribed again.
+func (m *MailchimpLists) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+	members, err := m.listAll()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get members of list %s: %s", m.ListSyncSet.ListID, err)
+	}
+
+	m.statuses = map[string]string{}
+	people := make([]internal.Person, 0, len(members))
+	for _, mbr := range members {
+		email := strings.ToLower(mbr.EmailAddress)
+		m.statuses[email] = mbr.Status
+
+		attributes := map[string]string{EmailAttribute: mbr.EmailAddress}
+		for _, attr := range desiredAttrs {
+			if value, ok := mergeFieldValue(mbr.MergeFields[attr]); ok {
+				attributes[attr] = value
+			}
+		}
+
+		people = append(people, internal.Person{
+			CompareValue: email,
+			ID:           subscriberHash(email),
+			Attributes:   attributes,
+		})
+	}
+
+	return people, nil
+}
+
+// mergeFieldValue returns a text or number merge field value as a string. Address values are not supported.
+func mergeFieldValue(raw json.RawMessage) (string, bool) {
+	if len(raw) == 0 {
+		return "", false
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, true
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n.String(), true
+	}
+	return "", false
+}
+
+func (m *MailchimpLists) listAll() ([]member, error) {
+	var all []member
+	for offset := 0; ; offset += m.PageSize {
+		body, err := m.request(http.MethodGet, fmt.Sprintf("%s/members?count=%v&offset=%v&fields=%s", m.listPath(),
+			m.PageSize, offset, "members.email_address,members.status,members.merge_fields,total_items"), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Members    []member `json:"members"`
+			TotalItems int      `json:"total_items"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("unable to parse response: %s", err)
+		}
+		all = append(all, page.Members...)
+
+		if len(page.Members) == 0 || offset+len(page.Members) >= page.TotalItems {
+			return all, nil
+		}
+	}
+}
+
+func (m *MailchimpLists) ApplyChangeSet(changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem) internal.ChangeResults {
+
+	var results internal.ChangeResults
+	var wg sync.WaitGroup
+	batchTimer := internal.NewBatchTimer(m.BatchSize, m.BatchDelaySeconds)
+
+	if !m.ListSyncSet.DisableAdd {
+		for _, person := range changes.Create {
+			wg.Add(1)
+			go m.subscribe(person, &results.Created, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	if !m.ListSyncSet.DisableUpdate {
+		for _, person := range changes.Update {
+			wg.Add(1)
+			go m.updateMember(person, changes.UpdateAttributes(person), &results.Updated, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	if !m.ListSyncSet.DisableDelete {
+		for _, person := range changes.Delete {
+			// an unsubscribed member would otherwise be unsubscribed again on every run
+			status := m.statuses[strings.ToLower(person.CompareValue)]
+			if m.ListSyncSet.OnDelete == OnDeleteUnsubscribe && (status == statusUnsubscribed ||
+				status == statusCleaned) {
+				continue
+			}
+			wg.Add(1)
+			go m.removeMember(person, &results.Deleted, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	wg.Wait()
+	return results
+}
+
+// email is the address of a person, the email attribute if it is mapped
+func email(person internal.Person) string {
+	if address := person.Attributes[EmailAttribute]; address != "" {
+		return address
+	}
+	return person.CompareValue
+}
+
+// mergeFields returns the attributes other than the email address
+func mergeFields(attributes map[string]string) map[string]string {
+	fields := map[string]string{}
+	for name, value := range attributes {
+		if name != EmailAttribute {
+			fields[name] = value
+		}
+	}
+	return fields
+}
+
+func (m *MailchimpLists) subscribe(person internal.Person, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	address := email(person)
+	body := map[string]interface{}{
+		"email_address": address,
+		"status_if_new": statusSubscribed,
+		"status":        statusSubscribed,
+		"merge_fields":  mergeFields(person.Attributes),
+	}
+	if _, err := m.request(http.MethodPut, m.memberPath(address), body); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  fmt.Sprintf("unable to subscribe %s to list %s: %s", address, m.ListSyncSet.ListID, err)}
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: fmt.Sprintf("Subscribe %s to %s", address, m.ListSyncSet.ListID),
+	}
+	atomic.AddUint64(counter, 1)
+}
+
+func (m *MailchimpLists) updateMember(person internal.Person, attributes map[string]string, counter *uint64,
+	wg *sync.WaitGroup, eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	address := email(person)
+	body := map[string]interface{}{"merge_fields": mergeFields(attributes)}
+	if _, err := m.request(http.MethodPatch, m.memberPath(address), body); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  fmt.Sprintf("unable to update %s in list %s: %s", address, m.ListSyncSet.ListID, err)}
+		return
+	}
+
+	eventLog <- internal.UpdateEvent("UpdateMember", address+" in "+m.ListSyncSet.ListID, person)
+	atomic.AddUint64(counter, 1)
+}
+
+func (m *MailchimpLists) removeMember(person internal.Person, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	address := email(person)
+	var err error
+	if m.ListSyncSet.OnDelete == OnDeleteUnsubscribe {
+		_, err = m.request(http.MethodPatch, m.memberPath(address), map[string]string{"status": statusUnsubscribed})
+	} else {
+		_, err = m.request(http.MethodDelete, m.memberPath(address), nil)
+	}
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message: fmt.Sprintf("unable to %s %s in list %s: %s", m.ListSyncSet.OnDelete, address,
+				m.ListSyncSet.ListID, err)}
+		return
+	}
+
+	action := "Archive"
+	if m.ListSyncSet.OnDelete == OnDeleteUnsubscribe {
+		action = "Unsubscribe"
+	}
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: fmt.Sprintf("%s %s in %s", action, address, m.ListSyncSet.ListID),
+	}
+	atomic.AddUint64(counter, 1)
+}
+
+// subscriberHash is the ID of a list member, the MD5 hash of the lowercase email address
+func subscriberHash(email string) string {
+	sum := md5.Sum([]byte(strings.ToLower(email)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *MailchimpLists) listPath() string {
+	return "/lists/" + url.PathEscape(m.ListSyncSet.ListID)
+}
+
+func (m *MailchimpLists) memberPath(email string) string {
+	return m.listPath() + "/members/" + subscriberHash(email)
+}
+
+func (m *MailchimpLists) request(method, path string, body interface{}) ([]byte, error) {
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		if bodyBytes, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("unable to marshal request body: %s", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, m.BaseURL+path, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth("personnel-sync", m.APIKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := m.Retry.Do(m.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read http response body: %s", err)
+	}
+	if resp.StatusCode >= 400 {
+		return respBody, internal.NewStatusError(resp.StatusCode, resp.Header.Get("Retry-After"),
+			fmt.Errorf("status: %d, body: %s", resp.StatusCode, respBody))
+	}
+	return respBody, nil
+}
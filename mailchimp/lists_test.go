@@ -0,0 +1,275 @@
+package mailchimp
+
+import (
+	"encoding/json"
+	"log/syslog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+// fakeMailchimp is an in-memory account with one audience, staff
+type fakeMailchimp struct {
+	sync.Mutex
+	members map[string]member // by subscriber hash
+}
+
+func newFakeMailchimp() *fakeMailchimp {
+	f := &fakeMailchimp{members: map[string]member{}}
+	for _, m := range []member{
+		{EmailAddress: "Ann@example.org", Status: statusSubscribed, MergeFields: map[string]json.RawMessage{
+			"FNAME": json.RawMessage(`"Ann"`), "AGE": json.RawMessage(`42`),
+			"ADDRESS": json.RawMessage(`{"addr1":"1 Main St"}`)}},
+		{EmailAddress: "ben@example.org", Status: statusSubscribed},
+		{EmailAddress: "cat@example.org", Status: statusUnsubscribed},
+	} {
+		f.members[subscriberHash(m.EmailAddress)] = m
+	}
+	return f
+}
+
+func (f *fakeMailchimp) server(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, key, _ := r.BasicAuth(); key != "secret-us6" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.Lock()
+		defer f.Unlock()
+
+		const list = "/lists/staff/members"
+		switch {
+		case r.URL.Path == list && r.Method == http.MethodGet:
+			f.writePage(w, r)
+		case strings.HasPrefix(r.URL.Path, list+"/"):
+			hash := strings.TrimPrefix(r.URL.Path, list+"/")
+			var body struct {
+				member
+				StatusIfNew string `json:"status_if_new"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+
+			existing, ok := f.members[hash]
+			switch r.Method {
+			case http.MethodPut:
+				if strings.HasSuffix(body.EmailAddress, "@invalid") {
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte(`{"title":"Invalid Resource"}`))
+					return
+				}
+				if hash != subscriberHash(body.EmailAddress) {
+					t.Errorf("subscriber hash %s does not match %s", hash, body.EmailAddress)
+				}
+				f.members[hash] = body.member
+			case http.MethodPatch:
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if body.Status != "" {
+					existing.Status = body.Status
+				}
+				if body.MergeFields != nil {
+					existing.MergeFields = body.MergeFields
+				}
+				f.members[hash] = existing
+			case http.MethodDelete:
+				delete(f.members, hash)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func (f *fakeMailchimp) writePage(w http.ResponseWriter, r *http.Request) {
+	var hashes []string
+	for hash := range f.members {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+
+	members := []member{}
+	for i := offset; i < len(hashes) && i < offset+count; i++ {
+		members = append(members, f.members[hashes[i]])
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"members": members, "total_items": len(hashes)})
+}
+
+func newTestMailchimpLists(t *testing.T, serverURL, setJSON string) *MailchimpLists {
+	config := `{"BaseURL":"` + serverURL + `","APIKey":"secret-us6","PageSize":2}`
+	dest, err := NewMailchimpListsDestination(internal.DestinationConfig{ExtraJSON: json.RawMessage(config)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dest.ForSet(json.RawMessage(setJSON)); err != nil {
+		t.Fatal(err)
+	}
+	return dest.(*MailchimpLists)
+}
+
+func TestNewMailchimpListsDestination(t *testing.T) {
+	tests := []struct {
+		config      string
+		wantBaseURL string
+		wantErr     bool
+	}{
+		{config: `{"APIKey":"abc123-us6"}`, wantBaseURL: "https://us6.api.mailchimp.com/3.0"},
+		{config: `{"APIKey":"abc123","BaseURL":"https://example.org/3.0/"}`, wantBaseURL: "https://example.org/3.0"},
+		{config: `{"APIKey":"abc123"}`, wantErr: true},
+		{config: `{}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		dest, err := NewMailchimpListsDestination(internal.DestinationConfig{ExtraJSON: json.RawMessage(tt.config)})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewMailchimpListsDestination(%s) error = %v, wantErr %v", tt.config, err, tt.wantErr)
+			continue
+		}
+		if err == nil && dest.(*MailchimpLists).BaseURL != tt.wantBaseURL {
+			t.Errorf("BaseURL = %s, want %s", dest.(*MailchimpLists).BaseURL, tt.wantBaseURL)
+		}
+	}
+}
+
+func TestMailchimpLists_ListUsers(t *testing.T) {
+	fake := newFakeMailchimp()
+	server := fake.server(t)
+	defer server.Close()
+
+	m := newTestMailchimpLists(t, server.URL, `{"ListID":"staff"}`)
+	people, err := m.ListUsers([]string{"email", "FNAME", "AGE", "ADDRESS"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]map[string]string{}
+	for _, p := range people {
+		got[p.CompareValue] = p.Attributes
+	}
+	want := map[string]map[string]string{
+		"ann@example.org": {"email": "Ann@example.org", "FNAME": "Ann", "AGE": "42"},
+		"ben@example.org": {"email": "ben@example.org"},
+		"cat@example.org": {"email": "cat@example.org"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListUsers() = %v, want %v", got, want)
+	}
+}
+
+func TestMailchimpLists_ForSet(t *testing.T) {
+	m := &MailchimpLists{}
+	tests := []struct {
+		setJSON string
+		wantErr bool
+	}{
+		{setJSON: `{"ListID":"staff"}`},
+		{setJSON: `{"ListID":"staff","OnDelete":"unsubscribe"}`},
+		{setJSON: `{"ListID":"staff","OnDelete":"delete"}`, wantErr: true},
+		{setJSON: `{}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := m.ForSet(json.RawMessage(tt.setJSON)); (err != nil) != tt.wantErr {
+			t.Errorf("ForSet(%s) error = %v, wantErr %v", tt.setJSON, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMailchimpLists_ApplyChangeSet(t *testing.T) {
+	tests := []struct {
+		name         string
+		setJSON      string
+		want         internal.ChangeResults
+		wantStatuses map[string]string
+		wantErrs     int
+	}{
+		{
+			name:    "archive",
+			setJSON: `{"ListID":"staff"}`,
+			want:    internal.ChangeResults{Created: 1, Updated: 1, Deleted: 2},
+			wantStatuses: map[string]string{"Ann@example.org": statusSubscribed,
+				"dan@example.org": statusSubscribed},
+			wantErrs: 1,
+		},
+		{
+			name:    "unsubscribe",
+			setJSON: `{"ListID":"staff","OnDelete":"unsubscribe"}`,
+			want:    internal.ChangeResults{Created: 1, Updated: 1, Deleted: 1},
+			wantStatuses: map[string]string{"Ann@example.org": statusSubscribed, "ben@example.org": statusUnsubscribed,
+				"cat@example.org": statusUnsubscribed, "dan@example.org": statusSubscribed},
+			wantErrs: 1,
+		},
+		{
+			name:    "disabled",
+			setJSON: `{"ListID":"staff","DisableAdd":true,"DisableUpdate":true,"DisableDelete":true}`,
+			want:    internal.ChangeResults{},
+			wantStatuses: map[string]string{"Ann@example.org": statusSubscribed, "ben@example.org": statusSubscribed,
+				"cat@example.org": statusUnsubscribed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeMailchimp()
+			server := fake.server(t)
+			defer server.Close()
+
+			m := newTestMailchimpLists(t, server.URL, tt.setJSON)
+			if _, err := m.ListUsers(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			eventLog := make(chan internal.EventLogItem, 10)
+			results := m.ApplyChangeSet(internal.ChangeSet{
+				Create: []internal.Person{
+					{CompareValue: "dan@example.org", Attributes: map[string]string{"FNAME": "Dan"}},
+					{CompareValue: "bad@invalid"},
+				},
+				Update: []internal.Person{
+					{CompareValue: "ann@example.org", Attributes: map[string]string{"email": "Ann@example.org",
+						"FNAME": "Annie"}},
+				},
+				Delete: []internal.Person{{CompareValue: "ben@example.org"}, {CompareValue: "cat@example.org"}},
+			}, eventLog)
+			close(eventLog)
+
+			var errs []string
+			for msg := range eventLog {
+				if msg.Level <= syslog.LOG_ERR {
+					errs = append(errs, msg.Message)
+				}
+			}
+			if len(errs) != tt.wantErrs {
+				t.Errorf("errors = %v, want %v", errs, tt.wantErrs)
+			}
+			if !reflect.DeepEqual(results, tt.want) {
+				t.Errorf("results = %+v, want %+v", results, tt.want)
+			}
+
+			statuses := map[string]string{}
+			for _, mbr := range fake.members {
+				statuses[mbr.EmailAddress] = mbr.Status
+			}
+			if !reflect.DeepEqual(statuses, tt.wantStatuses) {
+				t.Errorf("statuses = %v, want %v", statuses, tt.wantStatuses)
+			}
+			if tt.want.Updated == 1 {
+				ann := fake.members[subscriberHash("ann@example.org")]
+				if string(ann.MergeFields["FNAME"]) != `"Annie"` {
+					t.Errorf("FNAME = %s, want Annie", ann.MergeFields["FNAME"])
+				}
+			}
+		})
+	}
+}
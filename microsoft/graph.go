@@ -0,0 +1,212 @@
+package microsoft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+const DefaultBaseURL = "https://graph.microsoft.com/v1.0"
+const DefaultAuthURL = "https://login.microsoftonline.com"
+
+// MaxBatchSize is the maximum number of requests allowed in one Graph JSON batch
+const MaxBatchSize = 20
+
+type MicrosoftConfig struct {
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	BaseURL      string
+	AuthURL      string
+	Retry        internal.RetryConfig
+
+	// Proxy is a SOCKS5 proxy for all requests
+	Proxy internal.ProxyConfig
+}
+
+type graphClient struct {
+	config MicrosoftConfig
+	client *http.Client
+}
+
+type batchRequest struct {
+	ID      string            `json:"id"`
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    interface{}       `json:"body,omitempty"`
+}
+
+type batchResponse struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+type graphError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (m *MicrosoftConfig) setDefaults() {
+	if m.BaseURL == "" {
+		m.BaseURL = DefaultBaseURL
+	}
+	if m.AuthURL == "" {
+		m.AuthURL = DefaultAuthURL
+	}
+	if m.Retry.MaxAttempts <= 0 {
+		m.Retry.MaxAttempts = internal.DefaultRetryMaxAttempts
+	}
+	if len(m.Retry.RetryableStatusCodes) == 0 {
+		m.Retry.RetryableStatusCodes = []int{
+			http.StatusTooManyRequests,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		}
+	}
+}
+
+// newGraphClient returns a client authenticated with the OAuth2 client credentials grant for the
+// configured Azure AD application
+func newGraphClient(config MicrosoftConfig) (graphClient, error) {
+	if config.TenantID == "" || config.ClientID == "" || config.ClientSecret == "" {
+		return graphClient{}, errors.New("TenantID, ClientID, and ClientSecret are required")
+	}
+
+	config.setDefaults()
+
+	cc := clientcredentials.Config{
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		TokenURL:     fmt.Sprintf("%s/%s/oauth2/v2.0/token", config.AuthURL, config.TenantID),
+		Scopes:       []string{"https://graph.microsoft.com/.default"},
+	}
+
+	proxyClient, err := config.Proxy.Client(0)
+	if err != nil {
+		return graphClient{}, err
+	}
+
+	return graphClient{
+		config: config,
+		client: cc.Client(context.WithValue(context.Background(), oauth2.HTTPClient, proxyClient)),
+	}, nil
+}
+
+// request issues a single Graph API request, retrying throttled responses as configured in Retry
+func (g *graphClient) request(method, url string, body interface{}) ([]byte, error) {
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		if bodyBytes, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("unable to marshal request body: %s", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, g.config.BaseURL+url, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("User-Agent", "personnel-sync")
+
+	resp, err := g.config.Retry.Do(g.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read http response body: %s", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return respBody, internal.NewStatusError(resp.StatusCode, resp.Header.Get("Retry-After"),
+			fmt.Errorf("%s %s: %s", method, url, describeError(resp.StatusCode, respBody)))
+	}
+
+	return respBody, nil
+}
+
+// batch sends the requests using the Graph JSON batching endpoint, at most MaxBatchSize at a time.
+// Throttled requests within a batch are resubmitted in a later batch. The returned map is keyed by
+// request ID.
+func (g *graphClient) batch(requests []batchRequest) (map[string]batchResponse, error) {
+	results := map[string]batchResponse{}
+	pending := requests
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		var throttled []batchRequest
+		var delay time.Duration
+
+		for start := 0; start < len(pending); start += MaxBatchSize {
+			end := start + MaxBatchSize
+			if end > len(pending) {
+				end = len(pending)
+			}
+			chunk := pending[start:end]
+
+			respBody, err := g.request(http.MethodPost, "/$batch", map[string]interface{}{"requests": chunk})
+			if err != nil {
+				return results, err
+			}
+
+			var parsed struct {
+				Responses []batchResponse `json:"responses"`
+			}
+			if err := json.Unmarshal(respBody, &parsed); err != nil {
+				return results, fmt.Errorf("unable to parse batch response: %s", err)
+			}
+
+			byID := map[string]batchRequest{}
+			for _, r := range chunk {
+				byID[r.ID] = r
+			}
+
+			for _, r := range parsed.Responses {
+				d := g.config.Retry.Delay(attempt, r.Headers["Retry-After"])
+				if g.config.Retry.IsRetryable(r.Status) && attempt+1 < g.config.Retry.MaxAttempts &&
+					!g.config.Retry.ExceedsMaxDelay(d) {
+					throttled = append(throttled, byID[r.ID])
+					if d > delay {
+						delay = d
+					}
+					continue
+				}
+				results[r.ID] = r
+			}
+		}
+
+		pending = throttled
+		if len(pending) > 0 {
+			g.config.Retry.Wait(delay)
+		}
+	}
+
+	return results, nil
+}
+
+func describeError(status int, body []byte) string {
+	var e graphError
+	if err := json.Unmarshal(body, &e); err == nil && e.Error.Message != "" {
+		return fmt.Sprintf("%d %s: %s", status, e.Error.Code, e.Error.Message)
+	}
+	return fmt.Sprintf("%d %s", status, body)
+}
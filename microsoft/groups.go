@@ -0,0 +1,324 @@
+package microsoft
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+type MicrosoftGroups struct {
+	DestinationConfig internal.DestinationConfig
+	MicrosoftConfig   MicrosoftConfig
+	GroupSyncSet      GroupSyncSet
+	BatchSize         int
+	graph             graphClient
+}
+
+type GroupSyncSet struct {
+	GroupID       string
+	ExtraMembers  []string
+	DisableAdd    bool
+	DisableDelete bool
+}
+
+type directoryObject struct {
+	ID                string `json:"id"`
+	Mail              string `json:"mail"`
+	UserPrincipalName string `json:"userPrincipalName"`
+}
+
+func init() {
+	internal.RegisterDestination(internal.DestinationTypeMicrosoftGroups, NewMicrosoftGroupsDestination)
+
+	internal.DescribeDestination(internal.DestinationTypeMicrosoftGroups, internal.AdapterConfig{
+		ExtraJSON: []interface{}{MicrosoftConfig{}, MicrosoftGroups{}},
+		SyncSet:   GroupSyncSet{},
+	})
+}
+
+// NewMicrosoftGroupsDestination creates a destination for managing the membership of Microsoft 365 or
+// Entra ID security groups through the Microsoft Graph API
+func NewMicrosoftGroupsDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var m MicrosoftGroups
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &m.MicrosoftConfig); err != nil {
+		return &MicrosoftGroups{}, err
+	}
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &m); err != nil {
+		return &MicrosoftGroups{}, err
+	}
+
+	// Defaults
+	if m.BatchSize <= 0 || m.BatchSize > MaxBatchSize {
+		m.BatchSize = MaxBatchSize
+	}
+
+	m.DestinationConfig = destinationConfig
+
+	var err error
+	m.graph, err = newGraphClient(m.MicrosoftConfig)
+	if err != nil {
+		return &MicrosoftGroups{}, err
+	}
+
+	return &m, nil
+}
+
+func (m *MicrosoftGroups) ForSet(syncSetJson json.RawMessage) error {
+	var syncSetConfig GroupSyncSet
+	err := json.Unmarshal(syncSetJson, &syncSetConfig)
+	if err != nil {
+		return err
+	}
+
+	if syncSetConfig.GroupID == "" {
+		return fmt.Errorf("GroupID missing from sync set json")
+	}
+
+	m.GroupSyncSet = syncSetConfig
+
+	return nil
+}
+
+func (m *MicrosoftGroups) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+	var membersList []directoryObject
+
+	next := fmt.Sprintf("/groups/%s/members?$select=id,mail,userPrincipalName&$top=999",
+		url.PathEscape(m.GroupSyncSet.GroupID))
+	for next != "" {
+		body, err := m.graph.request(http.MethodGet, next, nil)
+		if err != nil {
+			return []internal.Person{}, fmt.Errorf("unable to get members of group %s: %s",
+				m.GroupSyncSet.GroupID, err)
+		}
+
+		var page struct {
+			Value    []directoryObject `json:"value"`
+			NextLink string            `json:"@odata.nextLink"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return []internal.Person{}, fmt.Errorf("unable to parse members of group %s: %s",
+				m.GroupSyncSet.GroupID, err)
+		}
+
+		membersList = append(membersList, page.Value...)
+		next = strings.TrimPrefix(page.NextLink, m.graph.config.BaseURL)
+	}
+
+	var members []internal.Person
+	for _, nextMember := range membersList {
+		email := nextMember.Mail
+		if email == "" {
+			email = nextMember.UserPrincipalName
+		}
+
+		// Do not include ExtraMembers in list to prevent inclusion in delete list
+		if isExtraMember, _ := internal.InArray(strings.ToLower(email), m.extraMembers()); isExtraMember {
+			continue
+		}
+
+		members = append(members, internal.Person{
+			CompareValue: email,
+			ID:           nextMember.ID,
+			Attributes: map[string]string{
+				"id":    nextMember.ID,
+				"email": strings.ToLower(email),
+			},
+		})
+	}
+
+	return members, nil
+}
+
+func (m *MicrosoftGroups) ApplyChangeSet(
+	changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem) internal.ChangeResults {
+
+	var results internal.ChangeResults
+
+	if !m.GroupSyncSet.DisableAdd {
+		toBeAdded := make([]string, 0, len(changes.Create)+len(m.GroupSyncSet.ExtraMembers))
+		for _, person := range changes.Create {
+			toBeAdded = append(toBeAdded, person.CompareValue)
+		}
+		toBeAdded = append(toBeAdded, m.GroupSyncSet.ExtraMembers...)
+
+		results.Created = m.addMembers(toBeAdded, eventLog)
+	}
+
+	if !m.GroupSyncSet.DisableDelete {
+		var toBeRemoved []internal.Person
+		for _, dp := range changes.Delete {
+			if isExtraMember, _ := internal.InArray(strings.ToLower(dp.CompareValue), m.extraMembers()); isExtraMember {
+				continue
+			}
+			toBeRemoved = append(toBeRemoved, dp)
+		}
+
+		results.Deleted = m.removeMembers(toBeRemoved, eventLog)
+	}
+
+	return results
+}
+
+// addMembers resolves each email address to a directory object ID and then adds the objects to the group,
+// using batch requests for both steps
+func (m *MicrosoftGroups) addMembers(emails []string, eventLog chan<- internal.EventLogItem) uint64 {
+	if len(emails) == 0 {
+		return 0
+	}
+
+	lookups := make([]batchRequest, len(emails))
+	for i, email := range emails {
+		lookups[i] = batchRequest{
+			ID:     strconv.Itoa(i),
+			Method: http.MethodGet,
+			URL:    "/users/" + url.PathEscape(email) + "?$select=id",
+		}
+	}
+
+	lookupResults, err := m.batchInChunks(lookups)
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to look up users to add to group %s: %s", m.GroupSyncSet.GroupID, err)}
+		return 0
+	}
+
+	var adds []batchRequest
+	for i, email := range emails {
+		resp := lookupResults[strconv.Itoa(i)]
+		var user directoryObject
+		if resp.Status >= 400 || json.Unmarshal(resp.Body, &user) != nil || user.ID == "" {
+			eventLog <- internal.EventLogItem{
+				Level:    syslog.LOG_ERR,
+				Category: internal.ClassifyHTTPStatus(resp.Status),
+				Message: fmt.Sprintf("unable to find user %s to add to group %s: %s",
+					email, m.GroupSyncSet.GroupID, describeError(resp.Status, resp.Body))}
+			continue
+		}
+
+		adds = append(adds, batchRequest{
+			ID:      strconv.Itoa(i),
+			Method:  http.MethodPost,
+			URL:     "/groups/" + url.PathEscape(m.GroupSyncSet.GroupID) + "/members/$ref",
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body: map[string]string{
+				"@odata.id": m.graph.config.BaseURL + "/directoryObjects/" + user.ID,
+			},
+		})
+	}
+
+	addResults, err := m.batchInChunks(adds)
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to add members to group %s: %s", m.GroupSyncSet.GroupID, err)}
+	}
+
+	var counter uint64
+	for _, add := range adds {
+		resp, ok := addResults[add.ID]
+		if !ok {
+			continue
+		}
+		i, _ := strconv.Atoi(add.ID)
+
+		// A 400 with "already exist" means the user is already a member
+		if resp.Status >= 400 && !strings.Contains(string(resp.Body), "already exist") {
+			eventLog <- internal.EventLogItem{
+				Level:    syslog.LOG_ERR,
+				Category: internal.ClassifyHTTPStatus(resp.Status),
+				Message: fmt.Sprintf("unable to insert %s in Microsoft group %s: %s",
+					emails[i], m.GroupSyncSet.GroupID, describeError(resp.Status, resp.Body))}
+			continue
+		}
+
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_INFO,
+			Message: "AddMember " + emails[i],
+		}
+		counter++
+	}
+
+	return counter
+}
+
+func (m *MicrosoftGroups) removeMembers(people []internal.Person, eventLog chan<- internal.EventLogItem) uint64 {
+	if len(people) == 0 {
+		return 0
+	}
+
+	removes := make([]batchRequest, len(people))
+	for i, p := range people {
+		removes[i] = batchRequest{
+			ID:     strconv.Itoa(i),
+			Method: http.MethodDelete,
+			URL: fmt.Sprintf("/groups/%s/members/%s/$ref",
+				url.PathEscape(m.GroupSyncSet.GroupID), url.PathEscape(p.ID)),
+		}
+	}
+
+	removeResults, err := m.batchInChunks(removes)
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to remove members from group %s: %s", m.GroupSyncSet.GroupID, err)}
+	}
+
+	var counter uint64
+	for i, p := range people {
+		resp, ok := removeResults[strconv.Itoa(i)]
+		if !ok {
+			continue
+		}
+		if resp.Status >= 400 {
+			eventLog <- internal.EventLogItem{
+				Level:    syslog.LOG_ERR,
+				Category: internal.ClassifyHTTPStatus(resp.Status),
+				Message: fmt.Sprintf("unable to delete %s from Microsoft group %s: %s",
+					p.CompareValue, m.GroupSyncSet.GroupID, describeError(resp.Status, resp.Body))}
+			continue
+		}
+
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_INFO,
+			Message: "RemoveMember " + p.CompareValue,
+		}
+		counter++
+	}
+
+	return counter
+}
+
+// batchInChunks submits the requests in batches no larger than the configured BatchSize
+func (m *MicrosoftGroups) batchInChunks(requests []batchRequest) (map[string]batchResponse, error) {
+	results := map[string]batchResponse{}
+	for start := 0; start < len(requests); start += m.BatchSize {
+		end := start + m.BatchSize
+		if end > len(requests) {
+			end = len(requests)
+		}
+		chunkResults, err := m.graph.batch(requests[start:end])
+		for id, r := range chunkResults {
+			results[id] = r
+		}
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+func (m *MicrosoftGroups) extraMembers() []string {
+	lower := make([]string, len(m.GroupSyncSet.ExtraMembers))
+	for i, e := range m.GroupSyncSet.ExtraMembers {
+		lower[i] = strings.ToLower(e)
+	}
+	return lower
+}
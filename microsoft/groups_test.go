@@ -0,0 +1,148 @@
+package microsoft
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+func getTestServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+
+	mux.HandleFunc("/tenant/oauth2/v2.0/token", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"access_token":"token","token_type":"Bearer","expires_in":3600}`)
+	})
+
+	mux.HandleFunc("/groups/group1/members", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if req.URL.Query().Get("page") == "2" {
+			_, _ = io.WriteString(w, `{"value":[{"id":"3","mail":"extra@example.com"}]}`)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"value":[{"id":"1","mail":"User1@example.com"},{"id":"2","userPrincipalName":"user2@example.com"}],
+			"@odata.nextLink":"%s/groups/group1/members?page=2"}`, server.URL)
+	})
+
+	mux.HandleFunc("/$batch", func(w http.ResponseWriter, req *http.Request) {
+		var batch struct {
+			Requests []batchRequest `json:"requests"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+			t.Errorf("invalid batch request: %s", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var responses []batchResponse
+		for _, r := range batch.Requests {
+			resp := batchResponse{ID: r.ID, Status: http.StatusNoContent}
+			switch {
+			case r.Method == http.MethodGet && strings.HasPrefix(r.URL, "/users/missing"):
+				resp.Status = http.StatusNotFound
+				resp.Body = json.RawMessage(`{"error":{"code":"Request_ResourceNotFound","message":"not found"}}`)
+			case r.Method == http.MethodGet:
+				resp.Status = http.StatusOK
+				resp.Body = json.RawMessage(`{"id":"new-id"}`)
+			}
+			responses = append(responses, resp)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"responses": responses})
+	})
+
+	return server
+}
+
+func getTestDestination(t *testing.T, server *httptest.Server) internal.Destination {
+	extraJSON := fmt.Sprintf(`{"TenantID":"tenant","ClientID":"id","ClientSecret":"secret","BaseURL":"%s","AuthURL":"%s"}`,
+		server.URL, server.URL)
+	m, err := NewMicrosoftGroupsDestination(internal.DestinationConfig{
+		Type:      internal.DestinationTypeMicrosoftGroups,
+		ExtraJSON: json.RawMessage(extraJSON),
+	})
+	if err != nil {
+		t.Fatalf("Failed to get new MicrosoftGroups instance, error: %s", err)
+	}
+	if err := m.ForSet(json.RawMessage(`{"GroupID":"group1","ExtraMembers":["Extra@example.com"]}`)); err != nil {
+		t.Fatalf("ForSet failed: %s", err)
+	}
+	return m
+}
+
+func TestMicrosoftGroups_ListUsers(t *testing.T) {
+	server := getTestServer(t)
+	defer server.Close()
+	m := getTestDestination(t, server)
+
+	got, err := m.ListUsers([]string{"email"})
+	if err != nil {
+		t.Fatalf("MicrosoftGroups.ListUsers() error = %s", err)
+	}
+
+	want := []internal.Person{
+		{
+			CompareValue: "User1@example.com",
+			ID:           "1",
+			Attributes:   map[string]string{"id": "1", "email": "user1@example.com"},
+		},
+		{
+			CompareValue: "user2@example.com",
+			ID:           "2",
+			Attributes:   map[string]string{"id": "2", "email": "user2@example.com"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MicrosoftGroups.ListUsers() = %v, want %v", got, want)
+	}
+}
+
+func TestMicrosoftGroups_ApplyChangeSet(t *testing.T) {
+	server := getTestServer(t)
+	defer server.Close()
+	m := getTestDestination(t, server)
+
+	changes := internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "new@example.com"},
+			{CompareValue: "missing@example.com"},
+		},
+		Delete: []internal.Person{
+			{CompareValue: "old@example.com", ID: "1"},
+			{CompareValue: "extra@example.com", ID: "3"},
+		},
+	}
+
+	eventLog := make(chan internal.EventLogItem, 50)
+	got := m.ApplyChangeSet(changes, eventLog)
+	close(eventLog)
+
+	want := internal.ChangeResults{Created: 2, Deleted: 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MicrosoftGroups.ApplyChangeSet() = %v, want %v", got, want)
+	}
+
+	var errorCount int
+	for msg := range eventLog {
+		if msg.Level == syslog.LOG_ERR {
+			errorCount++
+		}
+	}
+	if errorCount != 1 {
+		t.Errorf("expected 1 error in event log, got %d", errorCount)
+	}
+}
@@ -0,0 +1,148 @@
+// Package negotiate authenticates HTTP requests with NTLM or Kerberos, for the adapters that support Windows
+// integrated authentication
+package negotiate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	ntlmssp "github.com/Azure/go-ntlmssp"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+const (
+	TypeNTLM     = "ntlm"
+	TypeKerberos = "kerberos"
+)
+
+// Config authenticates requests with NTLM or Kerberos (SPNEGO), for on-premises servers that use Windows
+// integrated authentication
+type Config struct {
+	// Type is ntlm or kerberos. If it is empty, requests are not authenticated this way.
+	Type string
+
+	// Username and Password of the account. An NTLM username may include the domain, as DOMAIN\user.
+	Username string
+	Password string
+
+	Kerberos KerberosConfig
+}
+
+// KerberosConfig locates the Kerberos KDCs for the kerberos Config Type
+type KerberosConfig struct {
+	// Realm of the account, such as EXAMPLE.ORG. Its KDCs are found in DNS if KDCs is empty.
+	Realm string
+
+	// KDCs are the host:port of the realm's KDCs
+	KDCs []string
+
+	// Krb5ConfFile is a krb5.conf file to use instead of KDCs
+	Krb5ConfFile string
+
+	// SPN is the service principal name of the server, HTTP/<host> by default
+	SPN string
+}
+
+// Validate checks that the credentials for the Type are set
+func (n Config) Validate() error {
+	switch n.Type {
+	case "":
+		return nil
+	case TypeNTLM:
+	case TypeKerberos:
+		if n.Kerberos.Realm == "" {
+			return errors.New("the Kerberos Realm is required")
+		}
+	default:
+		return fmt.Errorf("invalid authentication type %q, must be ntlm or kerberos", n.Type)
+	}
+	if n.Username == "" || n.Password == "" {
+		return fmt.Errorf("Username and Password are required for %s authentication", n.Type)
+	}
+	return nil
+}
+
+// RoundTripper returns base wrapped to authenticate its requests, or base if the Type is empty
+func (n Config) RoundTripper(base http.RoundTripper) (http.RoundTripper, error) {
+	if err := n.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch n.Type {
+	case TypeNTLM:
+		return &ntlmTransport{
+			negotiator: ntlmssp.Negotiator{RoundTripper: base},
+			username:   n.Username,
+			password:   n.Password,
+		}, nil
+	case TypeKerberos:
+		krb5conf, err := n.Kerberos.krb5Config()
+		if err != nil {
+			return nil, err
+		}
+		// Active Directory does not support FAST pre-authentication
+		krb5client := client.NewWithPassword(n.Username, n.Kerberos.Realm, n.Password, krb5conf,
+			client.DisablePAFXFAST(true))
+		return &kerberosTransport{base: base, client: krb5client, spn: n.Kerberos.SPN}, nil
+	}
+	return base, nil
+}
+
+func (k KerberosConfig) krb5Config() (*config.Config, error) {
+	if k.Krb5ConfFile != "" {
+		krb5conf, err := config.Load(k.Krb5ConfFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load Krb5ConfFile %s: %s", k.Krb5ConfFile, err)
+		}
+		return krb5conf, nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[libdefaults]\n  default_realm = %s\n  dns_lookup_kdc = %t\n", k.Realm, len(k.KDCs) == 0)
+	if len(k.KDCs) > 0 {
+		fmt.Fprintf(&b, "[realms]\n  %s = {\n", k.Realm)
+		for _, kdc := range k.KDCs {
+			fmt.Fprintf(&b, "    kdc = %s\n", kdc)
+		}
+		b.WriteString("  }\n")
+	}
+
+	krb5conf, err := config.NewFromString(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kerberos configuration: %s", err)
+	}
+	return krb5conf, nil
+}
+
+// ntlmTransport authenticates requests with NTLM, if the server asks for it
+type ntlmTransport struct {
+	negotiator ntlmssp.Negotiator
+	username   string
+	password   string
+}
+
+func (t *ntlmTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the negotiator takes the credentials from a basic authorization header
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(t.username, t.password)
+	return t.negotiator.RoundTrip(req)
+}
+
+// kerberosTransport adds a SPNEGO token for the server to every request
+type kerberosTransport struct {
+	base   http.RoundTripper
+	client *client.Client
+	spn    string
+}
+
+func (t *kerberosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if err := spnego.SetSPNEGOHeader(t.client, req, t.spn); err != nil {
+		return nil, fmt.Errorf("unable to authenticate with Kerberos: %s", err)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,128 @@
+package negotiate
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "ntlm", config: Config{Type: "ntlm", Username: `CORP\jdoe`, Password: "secret"}},
+		{name: "kerberos", config: Config{Type: "kerberos", Username: "jdoe", Password: "secret",
+			Kerberos: KerberosConfig{Realm: "CORP.EXAMPLE.ORG", KDCs: []string{"dc1.corp.example.org:88"}}}},
+		{name: "no realm", config: Config{Type: "kerberos", Username: "jdoe", Password: "secret"},
+			wantErr: true},
+		{name: "no password", config: Config{Type: "ntlm", Username: "jdoe"}, wantErr: true},
+		{name: "unknown type", config: Config{Type: "digest", Username: "jdoe", Password: "secret"},
+			wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := tt.config.RoundTripper(http.DefaultTransport); (err != nil) != tt.wantErr {
+				t.Errorf("RoundTripper() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// ntlmChallenge is an NTLM challenge message from the CORP domain, with the Unicode, NTLM, and extended session
+// security flags
+func ntlmChallenge() []byte {
+	msg := make([]byte, 48, 56)
+	copy(msg, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	binary.LittleEndian.PutUint16(msg[12:], 8)
+	binary.LittleEndian.PutUint16(msg[14:], 8)
+	binary.LittleEndian.PutUint32(msg[16:], 48)
+	binary.LittleEndian.PutUint32(msg[20:], 0x00080201)
+	copy(msg[24:], "12345678")
+	for _, c := range "CORP" {
+		msg = append(msg, byte(c), 0)
+	}
+	return msg
+}
+
+// ntlmUser returns the domain and user of an NTLM authenticate message
+func ntlmUser(msg []byte) (string, string) {
+	field := func(offset int) string {
+		length := int(binary.LittleEndian.Uint16(msg[offset:]))
+		start := int(binary.LittleEndian.Uint32(msg[offset+4:]))
+		if start+length > len(msg) {
+			return ""
+		}
+		u := make([]uint16, length/2)
+		for i := range u {
+			u[i] = binary.LittleEndian.Uint16(msg[start+2*i:])
+		}
+		return string(utf16.Decode(u))
+	}
+	return field(28), field(36)
+}
+
+func TestConfig_RoundTripper_NTLM(t *testing.T) {
+	var gotBody, gotDomain, gotUser string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "NTLM ") {
+			w.Header().Set("WWW-Authenticate", "NTLM")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		msg, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "NTLM "))
+		if len(msg) < 44 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch binary.LittleEndian.Uint32(msg[8:]) {
+		case 1:
+			w.Header().Set("WWW-Authenticate", "NTLM "+base64.StdEncoding.EncodeToString(ntlmChallenge()))
+			w.WriteHeader(http.StatusUnauthorized)
+		case 3:
+			body, _ := ioutil.ReadAll(r.Body)
+			gotBody = string(body)
+			gotDomain, gotUser = ntlmUser(msg)
+			_, _ = io.WriteString(w, "ok")
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	config := Config{Type: TypeNTLM, Username: `CORP\jdoe`, Password: "secret"}
+	roundTripper, err := config.RoundTripper(http.DefaultTransport.(*http.Transport).Clone())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Timeout: 5 * time.Second, Transport: roundTripper}
+	resp, err := client.Post(server.URL, "application/json", strings.NewReader(`{"name":"Jane"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %v, want 200", resp.StatusCode)
+	}
+	if gotDomain != "CORP" || gotUser != "jdoe" {
+		t.Errorf("authenticated as %s\\%s, want CORP\\jdoe", gotDomain, gotUser)
+	}
+	if gotBody != `{"name":"Jane"}` {
+		t.Errorf("body = %q, want it sent with the authenticate message", gotBody)
+	}
+}
@@ -0,0 +1,215 @@
+// Package diff compares the people of a source with the people of a destination, with the same semantics as a
+// sync: attributes are remapped by an AttributeMap, people are matched by their compare value ignoring case, and
+// attribute values are compared as their AttributeMap says. It only uses the standard library, so that other tools
+// can reuse the comparison of the sync engine, and so that properties of it, such as that applying a ChangeSet
+// leaves nothing to change, can be tested on their own.
+//
+// The sync engine adds more to this comparison when it is configured to: compare keys, compare value normalizers,
+// ID links, update modes, and suppression of repeated updates. A ChangeSet from Diff is the ChangeSet of a sync
+// that uses none of them.
+package diff
+
+import (
+	"sort"
+	"strings"
+)
+
+// Person is a person of a source or destination, known by their CompareValue
+type Person struct {
+	CompareValue string
+
+	// ID is the destination's ID of the person, which Diff sets from the "id" attribute for an update
+	ID string
+
+	Attributes map[string]string
+
+	// DisableChanges is set by Remap if the person is missing a Required attribute. Such a person is neither
+	// created nor updated, but is not deleted if they are in the destination.
+	DisableChanges bool
+}
+
+// AttributeMap maps a Source attribute to a Destination attribute
+type AttributeMap struct {
+	Source      string
+	Destination string
+
+	// Required disables changes for a person who does not have the Source attribute
+	Required bool
+
+	// CaseSensitive compares the values with case. By default, case is ignored.
+	CaseSensitive bool
+
+	// NormalizeWhitespace ignores leading and trailing whitespace and the length of each run of whitespace
+	NormalizeWhitespace bool
+
+	// Multivalued compares the values as lists separated by commas, ignoring the order of the items, duplicates,
+	// empty items, and whitespace around each item
+	Multivalued bool
+}
+
+// ChangeSet holds the people to create, update, and delete in a destination
+type ChangeSet struct {
+	Create []Person
+	Update []Person
+	Delete []Person
+}
+
+// Empty returns true if there is nothing to change
+func (c ChangeSet) Empty() bool {
+	return len(c.Create) == 0 && len(c.Update) == 0 && len(c.Delete) == 0
+}
+
+// Remap returns the people with only the Destination attributes of the AttributeMap, taken from their Source
+// attributes. A person missing a Required attribute has DisableChanges set.
+func Remap(people []Person, attributeMap []AttributeMap) []Person {
+	remapped := make([]Person, 0, len(people))
+	for _, person := range people {
+		attrs := map[string]string{}
+		disableChanges := false
+		for _, attrMap := range attributeMap {
+			if value, ok := person.Attributes[attrMap.Source]; ok {
+				attrs[attrMap.Destination] = value
+			} else if attrMap.Required {
+				disableChanges = true
+			}
+		}
+		remapped = append(remapped, Person{
+			CompareValue:   person.CompareValue,
+			Attributes:     attrs,
+			DisableChanges: disableChanges,
+		})
+	}
+	return remapped
+}
+
+// Diff returns the changes that make the destination people match the source people, which have already been
+// remapped. A source person is matched to the first destination person with the same compare value. The source
+// people that are not matched are created, and the matched ones are updated if any of their attributes differ. The
+// destination people that are not matched are deleted.
+func Diff(sourcePeople, destinationPeople []Person, attributeMap []AttributeMap) ChangeSet {
+	attributeMaps := map[string]AttributeMap{}
+	for _, attrMap := range attributeMap {
+		attributeMaps[attrMap.Destination] = attrMap
+	}
+
+	var changeSet ChangeSet
+	matched := map[int]bool{}
+	for _, sp := range sourcePeople {
+		i := IndexOf(sp.CompareValue, destinationPeople)
+		if i >= 0 {
+			matched[i] = true
+		}
+		if sp.DisableChanges {
+			continue
+		}
+		if i < 0 {
+			changeSet.Create = append(changeSet.Create, sp)
+			continue
+		}
+
+		dp := destinationPeople[i]
+		for key, value := range sp.Attributes {
+			if !ValuesEqual(value, dp.Attributes[key], attributeMaps[key]) {
+				sp.ID = dp.Attributes["id"]
+				changeSet.Update = append(changeSet.Update, sp)
+				break
+			}
+		}
+	}
+
+	for i, dp := range destinationPeople {
+		if !matched[i] {
+			changeSet.Delete = append(changeSet.Delete, dp)
+		}
+	}
+	return changeSet
+}
+
+// Apply returns the destination people as they would be after the ChangeSet is made: deleted people are removed,
+// updated people are given the attributes of the update, and created people are added at the end
+func Apply(destinationPeople []Person, changeSet ChangeSet) []Person {
+	var people []Person
+	for _, dp := range destinationPeople {
+		if IndexOf(dp.CompareValue, changeSet.Delete) >= 0 {
+			continue
+		}
+		if i := IndexOf(dp.CompareValue, changeSet.Update); i >= 0 {
+			attrs := map[string]string{}
+			for key, value := range dp.Attributes {
+				attrs[key] = value
+			}
+			for key, value := range changeSet.Update[i].Attributes {
+				attrs[key] = value
+			}
+			dp.Attributes = attrs
+		}
+		people = append(people, dp)
+	}
+	return append(people, changeSet.Create...)
+}
+
+// IndexOf returns the index of the first person with the compare value, ignoring case, or -1 if there is none or
+// the compare value is empty
+func IndexOf(compareValue string, people []Person) int {
+	if compareValue == "" {
+		return -1
+	}
+	for i, person := range people {
+		if SameCompareValue(compareValue, person.CompareValue) {
+			return i
+		}
+	}
+	return -1
+}
+
+// SameCompareValue returns true if two compare values match, ignoring case
+func SameCompareValue(a, b string) bool {
+	return strings.ToLower(a) == strings.ToLower(b)
+}
+
+// ValuesEqual compares two values of an attribute as configured by its AttributeMap
+func ValuesEqual(a, b string, attrMap AttributeMap) bool {
+	if attrMap.Multivalued {
+		a = NormalizeList(a, attrMap.CaseSensitive)
+		b = NormalizeList(b, attrMap.CaseSensitive)
+	}
+	if attrMap.NormalizeWhitespace {
+		a = NormalizeWhitespace(a)
+		b = NormalizeWhitespace(b)
+	}
+	if attrMap.CaseSensitive {
+		return a == b
+	}
+	return strings.ToLower(a) == strings.ToLower(b)
+}
+
+// NormalizeList returns the items of a list separated by commas, trimmed, sorted, and without duplicates or empty
+// items, separated by commas. Unless caseSensitive is set, items that differ only by case are duplicates.
+func NormalizeList(s string, caseSensitive bool) string {
+	seen := map[string]bool{}
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		key := item
+		if !caseSensitive {
+			key = strings.ToLower(item)
+		}
+		if item == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if caseSensitive {
+			return items[i] < items[j]
+		}
+		return strings.ToLower(items[i]) < strings.ToLower(items[j])
+	})
+	return strings.Join(items, ",")
+}
+
+// NormalizeWhitespace trims leading and trailing whitespace and replaces each run of whitespace with a single space
+func NormalizeWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,94 @@
+package diff
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+var testAttributeMap = []AttributeMap{
+	{Source: "email", Destination: "email", Required: true},
+	{Source: "name", Destination: "name", NormalizeWhitespace: true},
+	{Source: "title", Destination: "title", CaseSensitive: true},
+}
+
+func TestRemap(t *testing.T) {
+	got := Remap([]Person{
+		{CompareValue: "ann@example.org", Attributes: map[string]string{"email": "ann@example.org", "name": "Ann",
+			"ssn": "123"}},
+		{CompareValue: "bob@example.org", Attributes: map[string]string{"name": "Bob"}},
+	}, testAttributeMap)
+
+	want := []Person{
+		{CompareValue: "ann@example.org", Attributes: map[string]string{"email": "ann@example.org", "name": "Ann"}},
+		{CompareValue: "bob@example.org", Attributes: map[string]string{"name": "Bob"}, DisableChanges: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Remap() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	source := []Person{
+		{CompareValue: "new@example.org", Attributes: map[string]string{"name": "New"}},
+		{CompareValue: "Same@example.org", Attributes: map[string]string{"name": " same  person", "title": "CEO"}},
+		{CompareValue: "changed@example.org", Attributes: map[string]string{"title": "cto"}},
+		{CompareValue: "disabled@example.org", Attributes: map[string]string{"title": "Changed"}, DisableChanges: true},
+	}
+	destination := []Person{
+		{CompareValue: "same@example.org", Attributes: map[string]string{"id": "1", "name": "Same Person",
+			"title": "CEO"}},
+		{CompareValue: "changed@example.org", Attributes: map[string]string{"id": "2", "title": "CTO"}},
+		{CompareValue: "disabled@example.org", Attributes: map[string]string{"id": "3", "title": "Old"}},
+		{CompareValue: "old@example.org", Attributes: map[string]string{"id": "4"}},
+	}
+
+	got := Diff(source, destination, testAttributeMap)
+	want := ChangeSet{
+		Create: []Person{source[0]},
+		Update: []Person{{CompareValue: "changed@example.org", ID: "2", Attributes: map[string]string{"title": "cto"}}},
+		Delete: []Person{destination[3]},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %+v\nwant %+v", got, want)
+	}
+}
+
+// testPeople generates lists of people with unique compare values, drawn from a small set so that source and
+// destination people often match, and with attribute values that differ only by case or whitespace
+type testPeople []Person
+
+func (testPeople) Generate(r *rand.Rand, size int) reflect.Value {
+	compareValues := []string{"ann@example.org", "BOB@example.org", "cy@example.org", "di@example.org"}
+	values := []string{"", "Manager", "manager", " Manager ", "Director"}
+
+	var people testPeople
+	for _, i := range r.Perm(len(compareValues))[:r.Intn(len(compareValues)+1)] {
+		attrs := map[string]string{"id": compareValues[i]}
+		for _, key := range []string{"email", "name", "title"} {
+			if r.Intn(4) > 0 {
+				attrs[key] = values[r.Intn(len(values))]
+			}
+		}
+		people = append(people, Person{CompareValue: compareValues[i], Attributes: attrs,
+			DisableChanges: r.Intn(5) == 0})
+	}
+	return reflect.ValueOf(people)
+}
+
+func TestDiff_Idempotent(t *testing.T) {
+	idempotent := func(source, destination testPeople) bool {
+		source = Remap(source, testAttributeMap)
+		changeSet := Diff(source, destination, testAttributeMap)
+		next := Diff(source, Apply(destination, changeSet), testAttributeMap)
+		if !next.Empty() {
+			t.Logf("source %+v\ndestination %+v\nchanges %+v\nnext changes %+v", source, destination, changeSet,
+				next)
+		}
+		return next.Empty()
+	}
+	if err := quick.Check(idempotent, &quick.Config{MaxCount: 1000}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,70 @@
+package restapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+
+	internal "github.com/silinternational/personnel-sync/v5/internal"
+)
+
+// cachedResponse is a list response kept in the state store, with the validators to check whether it changed
+type cachedResponse struct {
+	ETag         string
+	LastModified string
+	Body         string
+}
+
+// SetStateStore sets the state store in which responses are cached
+func (r *RestAPI) SetStateStore(stateStore internal.StateStore) {
+	r.stateStore = stateStore
+}
+
+// responseCacheKey is the state store key of the response to a list request
+func responseCacheKey(method, url, body string) string {
+	sum := sha256.Sum256([]byte(method + " " + url + "\n" + body))
+	return "restapi/cache/" + hex.EncodeToString(sum[:])
+}
+
+// loadCachedResponse returns the cache key and the cached response for the request, if caching is enabled, and
+// makes the request conditional on the cached response having changed
+func (r *RestAPI) loadCachedResponse(req *http.Request, body string) (string, *cachedResponse) {
+	if !r.CacheResponses || r.stateStore == nil {
+		return "", nil
+	}
+
+	key := responseCacheKey(req.Method, req.URL.String(), body)
+	var cached cachedResponse
+	found, err := r.stateStore.Load(key, &cached)
+	if err != nil {
+		log.Printf("unable to load cached response for %s: %s", req.URL, err)
+		return key, nil
+	}
+	if !found {
+		return key, nil
+	}
+
+	if cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+	return key, &cached
+}
+
+// saveCachedResponse stores a response that has an ETag or Last-Modified header
+func (r *RestAPI) saveCachedResponse(key string, resp *http.Response, body []byte) {
+	cached := cachedResponse{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Body:         string(body),
+	}
+	if cached.ETag == "" && cached.LastModified == "" {
+		return
+	}
+	if err := r.stateStore.Save(key, cached); err != nil {
+		log.Printf("unable to cache response from %s: %s", resp.Request.URL, err)
+	}
+}
@@ -0,0 +1,80 @@
+package restapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	internal "github.com/silinternational/personnel-sync/v5/internal"
+)
+
+func TestRestAPI_CacheResponses(t *testing.T) {
+	body := `[{"email": "one@example.com"}]`
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		switch req.URL.Path {
+		case "/etag":
+			if req.Header.Get("If-None-Match") == `"v1"` {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+		case "/modified":
+			if req.Header.Get("If-Modified-Since") == "Mon, 05 Oct 2026 10:00:00 GMT" {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Last-Modified", "Mon, 05 Oct 2026 10:00:00 GMT")
+		}
+		_, _ = io.WriteString(w, body)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name            string
+		cache           string
+		path            string
+		wantNotModified int
+	}{
+		{name: "etag", cache: "true", path: "/etag", wantNotModified: 1},
+		{name: "last modified", cache: "true", path: "/modified", wantNotModified: 1},
+		{name: "no validators", cache: "true", path: "/plain"},
+		{name: "disabled", cache: "false", path: "/etag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, notModified = 0, 0
+			stateStore := &internal.MemoryStateStore{}
+
+			var results [][]internal.Person
+			for i := 0; i < 2; i++ {
+				source, err := NewRestAPISource(internal.SourceConfig{ExtraJSON: []byte(`{"BaseURL": "` +
+					server.URL + `", "CompareAttribute": "email", "CacheResponses": ` + tt.cache + `}`)})
+				if err != nil {
+					t.Fatal(err)
+				}
+				source.(internal.StateStoreUser).SetStateStore(stateStore)
+				if err := source.ForSet([]byte(`{"Paths": ["` + tt.path + `"]}`)); err != nil {
+					t.Fatal(err)
+				}
+				people, err := source.ListUsers([]string{"email"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				results = append(results, people)
+			}
+
+			if requests != 2 || notModified != tt.wantNotModified {
+				t.Errorf("requests = %v, not modified = %v, want 2 and %v", requests, notModified, tt.wantNotModified)
+			}
+			if len(results[1]) != 1 || !reflect.DeepEqual(results[0], results[1]) {
+				t.Errorf("second ListUsers() = %v, want %v", results[1], results[0])
+			}
+		})
+	}
+}
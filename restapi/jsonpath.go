@@ -0,0 +1,134 @@
+package restapi
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep is one step of a parsed JSONPath: an object key, an array index, or a wildcard
+type jsonPathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses the subset of JSONPath used to locate results: a leading `$`, followed by any of `.key`,
+// `['key']`, `[n]`, `.*`, and `[*]`
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSONPath %q must start with $", path)
+	}
+
+	var steps []jsonPathStep
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			if key == "" {
+				return nil, fmt.Errorf("JSONPath %q has an empty key", path)
+			}
+			steps = append(steps, jsonPathStep{key: key, wildcard: key == "*"})
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("JSONPath %q is missing a ]", path)
+			}
+			selector := rest[1:end]
+			rest = rest[end+1:]
+
+			switch {
+			case selector == "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') &&
+				selector[len(selector)-1] == selector[0]:
+				steps = append(steps, jsonPathStep{key: selector[1 : len(selector)-1]})
+			default:
+				index, err := strconv.Atoi(selector)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("JSONPath %q has an invalid selector [%s]", path, selector)
+				}
+				steps = append(steps, jsonPathStep{index: index, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("JSONPath %q has an unexpected character %q", path, rest[0])
+		}
+	}
+
+	return steps, nil
+}
+
+// searchJSONPath returns all values in the decoded JSON data matched by the path steps
+func searchJSONPath(data interface{}, steps []jsonPathStep) []interface{} {
+	nodes := []interface{}{data}
+	for _, step := range steps {
+		var next []interface{}
+		for _, node := range nodes {
+			switch v := node.(type) {
+			case map[string]interface{}:
+				if step.wildcard {
+					keys := make([]string, 0, len(v))
+					for key := range v {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+					for _, key := range keys {
+						next = append(next, v[key])
+					}
+				} else if child, ok := v[step.key]; ok && !step.isIndex {
+					next = append(next, child)
+				}
+			case []interface{}:
+				if step.wildcard {
+					next = append(next, v...)
+				} else if step.isIndex && step.index < len(v) {
+					next = append(next, v[step.index])
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// flattenJSON returns the scalar values in the decoded JSON data, keyed by their path with object keys and array
+// indexes joined by dots, e.g. `address.city` or `phones.0.number`
+func flattenJSON(data interface{}) map[string]string {
+	flat := map[string]string{}
+	flattenInto(flat, "", data)
+	return flat
+}
+
+func flattenInto(flat map[string]string, prefix string, data interface{}) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			flattenInto(flat, join(key), value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			flattenInto(flat, join(strconv.Itoa(i)), value)
+		}
+	case nil:
+	default:
+		if prefix != "" {
+			flat[prefix] = fmt.Sprintf("%v", v)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package restapi
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Jeffail/gabs/v2"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+const nestedUsersJSON = `{
+  "data": {
+    "users": [
+      {"email": "one@example.com", "address": {"city": "Dallas"}, "phones": [{"number": "111"}, {"number": "222"}]},
+      {"email": "two@example.com", "address": {"city": "Paris"}, "active": true}
+    ]
+  }
+}`
+
+func Test_parseJSONPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []jsonPathStep
+		wantErr bool
+	}{
+		{path: "$", want: nil},
+		{path: "$.data.users[*]", want: []jsonPathStep{{key: "data"}, {key: "users"}, {wildcard: true}}},
+		{path: "$['odd.key'][2]", want: []jsonPathStep{{key: "odd.key"}, {index: 2, isIndex: true}}},
+		{path: "$.*", want: []jsonPathStep{{key: "*", wildcard: true}}},
+		{path: "data.users", wantErr: true},
+		{path: "$.data[", wantErr: true},
+		{path: "$.data[-1]", wantErr: true},
+		{path: "$..users", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := parseJSONPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJSONPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseJSONPath() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestAPI_searchResults(t *testing.T) {
+	jsonParsed, err := gabs.ParseJSON([]byte(nestedUsersJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{path: "$.data.users", want: []string{"one@example.com", "two@example.com"}},
+		{path: "$.data.users[*]", want: []string{"one@example.com", "two@example.com"}},
+		{path: "$.data.users[1]", want: []string{"two@example.com"}},
+		{path: "$.data.missing", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			steps, err := parseJSONPath(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := RestAPI{resultsPath: steps}
+			got := []string{}
+			for _, p := range r.searchResults(jsonParsed) {
+				got = append(got, p.Path("email").Data().(string))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("searchResults() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getPersonsFromFlattenedResults(t *testing.T) {
+	jsonParsed, err := gabs.ParseJSON([]byte(nestedUsersJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := getPersonsFromFlattenedResults(jsonParsed.S("data", "users").Children(), "email",
+		[]string{"email", "address.city", "phones.1.number", "active"})
+	want := []internal.Person{
+		{
+			CompareValue: "one@example.com",
+			Attributes: map[string]string{
+				"email":           "one@example.com",
+				"address.city":    "Dallas",
+				"phones.1.number": "222",
+			},
+		},
+		{
+			CompareValue: "two@example.com",
+			Attributes: map[string]string{
+				"email":        "two@example.com",
+				"address.city": "Paris",
+				"active":       "true",
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getPersonsFromFlattenedResults() = %#v, want %#v", got, want)
+	}
+}
@@ -1,9 +1,11 @@
 package restapi
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"log/syslog"
@@ -13,15 +15,26 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"text/template"
+	"time"
 
 	"github.com/Jeffail/gabs/v2"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
 
 	internal "github.com/silinternational/personnel-sync/v5/internal"
+	"github.com/silinternational/personnel-sync/v5/negotiate"
 )
 
 const AuthTypeBasic = "basic"
 const AuthTypeBearer = "bearer"
 const AuthTypeSalesforceOauth = "SalesforceOauth"
+const AuthTypeAWSSigV4 = "AWSSigV4"
+const AuthTypeNTLM = negotiate.TypeNTLM
+const AuthTypeKerberos = negotiate.TypeKerberos
+const DefaultAWSService = "execute-api"
 const DefaultBatchSize = 10
 const DefaultBatchDelaySeconds = 3
 
@@ -40,13 +53,80 @@ type RestAPI struct {
 	UserAgent            string
 	BatchSize            int
 	BatchDelaySeconds    int
+	Retry                internal.RetryConfig
 	destinationConfig    internal.DestinationConfig
 	setConfig            SetConfig
+
+	// ResultsJSONPath is a JSONPath, such as `$.data.users[*]`, locating the records in the list response. It
+	// takes precedence over ResultsJSONContainer.
+	ResultsJSONPath string
+
+	// ListBody is a template for the body of the list request, for APIs that require a POST to list users. It is
+	// executed as a Go template with ListVariables, e.g. `{"report": "{{.report}}"}`.
+	ListBody string
+
+	// GraphQLQuery is a GraphQL query used to list users. It is sent in a POST with ListVariables as its variables.
+	GraphQLQuery string
+
+	// ListVariables are substituted into ListBody or sent as GraphQL variables. A sync set may add to or override
+	// them with its own ListVariables.
+	ListVariables map[string]string
+
+	// FlattenAttributes makes nested values available as attributes keyed by their dotted path, such as
+	// `address.city` or `phones.0.number`
+	FlattenAttributes bool
+
+	// CreateRequest, UpdateRequest, and DeleteRequest define the requests that change the destination. If
+	// CreateRequest is not set, the attributes are sent to the sync set's CreatePath with the CreateMethod. People
+	// are only updated or deleted if UpdateRequest or DeleteRequest is set.
+	CreateRequest *RequestTemplate
+	UpdateRequest *RequestTemplate
+	DeleteRequest *RequestTemplate
+
+	// IDAttribute is the attribute of the listed records that holds their ID, for update and delete requests
+	IDAttribute string
+
+	// Proxy is a SOCKS5 proxy for all requests
+	Proxy internal.ProxyConfig
+
+	// TLS is a client certificate for servers that require mutual TLS, and CA certificates to trust
+	TLS internal.TLSConfig
+
+	// AWSRegion and AWSService identify the API for the AWSSigV4 AuthType. AWSService defaults to execute-api, for
+	// API Gateway. Requests are signed with the default AWS credentials, such as a Lambda function's role, or with
+	// the role AWSRoleARN if it is set.
+	AWSRegion  string
+	AWSService string
+	AWSRoleARN string
+
+	// Kerberos locates the KDCs for the kerberos AuthType, which authenticates as Username with Password
+	Kerberos negotiate.KerberosConfig
+
+	// CacheResponses keeps list responses that have an ETag or Last-Modified header in the state store. They are
+	// requested again with If-None-Match or If-Modified-Since, and the stored response is used if the server
+	// reports that it is unchanged.
+	CacheResponses bool
+
+	signer       *v4.Signer
+	stateStore   internal.StateStore
+	resultsPath  []jsonPathStep
+	listTemplate *template.Template
+	client       *http.Client
 }
 
 type SetConfig struct {
-	Paths      []string
-	CreatePath string
+	Paths         []string
+	CreatePath    string
+	ListVariables map[string]string
+}
+
+func init() {
+	internal.RegisterSource(internal.SourceTypeRestAPI, NewRestAPISource)
+	internal.RegisterDestination(internal.DestinationTypeRestAPI, NewRestAPIDestination)
+
+	config := internal.AdapterConfig{ExtraJSON: []interface{}{RestAPI{}}, SyncSet: SetConfig{}}
+	internal.DescribeSource(internal.SourceTypeRestAPI, config)
+	internal.DescribeDestination(internal.DestinationTypeRestAPI, config)
 }
 
 // NewRestAPISource unmarshals the sourceConfig's ExtraJson into a RestApi struct
@@ -58,7 +138,17 @@ func NewRestAPISource(sourceConfig internal.SourceConfig) (internal.Source, erro
 		return &RestAPI{}, err
 	}
 
+	if err := restAPI.parseListConfig(); err != nil {
+		return &RestAPI{}, err
+	}
+
 	restAPI.setDefaults()
+	if restAPI.client, err = restAPI.newHTTPClient(); err != nil {
+		return &RestAPI{}, err
+	}
+	if err := restAPI.initSigner(); err != nil {
+		return &RestAPI{}, err
+	}
 
 	if restAPI.AuthType == AuthTypeSalesforceOauth {
 		token, err := restAPI.getSalesforceOauthToken()
@@ -82,8 +172,18 @@ func NewRestAPIDestination(destinationConfig internal.DestinationConfig) (intern
 		return &RestAPI{}, err
 	}
 
+	if err := restAPI.parseListConfig(); err != nil {
+		return &RestAPI{}, err
+	}
+
 	restAPI.setDefaults()
 	restAPI.destinationConfig = destinationConfig
+	if restAPI.client, err = restAPI.newHTTPClient(); err != nil {
+		return &RestAPI{}, err
+	}
+	if err := restAPI.initSigner(); err != nil {
+		return &RestAPI{}, err
+	}
 
 	return &restAPI, nil
 }
@@ -155,12 +255,24 @@ func (r *RestAPI) ApplyChangeSet(changes internal.ChangeSet, eventLog chan<- int
 
 	batchTimer := internal.NewBatchTimer(r.BatchSize, r.BatchDelaySeconds)
 
-	if r.destinationConfig.DisableAdd {
-		log.Println("Contact creation is disabled.")
-	} else {
-		for _, toCreate := range changes.Create {
+	for _, toCreate := range changes.Create {
+		wg.Add(1)
+		go r.addContact(toCreate, &results.Created, &wg, eventLog)
+		batchTimer.WaitOnBatch()
+	}
+
+	if r.UpdateRequest != nil {
+		for _, toUpdate := range changes.Update {
+			wg.Add(1)
+			go r.updateContact(toUpdate, &results.Updated, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	if r.DeleteRequest != nil {
+		for _, toDelete := range changes.Delete {
 			wg.Add(1)
-			go r.addContact(toCreate, &results.Created, &wg, eventLog)
+			go r.deleteContact(toDelete, &results.Deleted, &wg, eventLog)
 			batchTimer.WaitOnBatch()
 		}
 	}
@@ -179,31 +291,55 @@ func (r *RestAPI) listUsersForPath(
 
 	defer wg.Done()
 
-	client := &http.Client{}
+	client := r.httpClient()
 	apiURL := fmt.Sprintf("%s%s", r.BaseURL, path)
-	req, err := http.NewRequest(r.ListMethod, apiURL, nil)
+
+	body, err := r.listRequestBody()
+	if err != nil {
+		errLog <- err.Error()
+		return
+	}
+	var bodyReader io.Reader
+	if body != "" {
+		bodyReader = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequest(r.ListMethod, apiURL, bodyReader)
 	if err != nil {
 		log.Println(err)
 		errLog <- err.Error()
+		return
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
 	}
 
-	switch r.AuthType {
-	case AuthTypeBasic:
-		req.SetBasicAuth(r.Username, r.Password)
-	case AuthTypeBearer, AuthTypeSalesforceOauth:
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", r.Password))
+	cacheKey, cached := r.loadCachedResponse(req, body)
+
+	if err := r.setAuth(req, body); err != nil {
+		errLog <- err.Error()
+		return
 	}
 
-	resp, err := client.Do(req)
+	resp, err := r.Retry.Do(client, req)
 	if err != nil {
 		errLog <- "error issuing http request, " + err.Error()
 		return
 	}
+	defer resp.Body.Close()
 
-	bodyText, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		errLog <- "error reading response body: " + err.Error()
-		return
+	var bodyText []byte
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		log.Printf("response from %s is unchanged, using the cached response", apiURL)
+		bodyText = []byte(cached.Body)
+	} else {
+		if bodyText, err = ioutil.ReadAll(resp.Body); err != nil {
+			errLog <- "error reading response body: " + err.Error()
+			return
+		}
+		if cacheKey != "" && resp.StatusCode == http.StatusOK {
+			r.saveCachedResponse(cacheKey, resp, bodyText)
+		}
 	}
 
 	jsonParsed, err := gabs.ParseJSON(bodyText)
@@ -215,7 +351,9 @@ func (r *RestAPI) listUsersForPath(
 	}
 
 	var peopleList []*gabs.Container
-	if r.ResultsJSONContainer != "" {
+	if r.resultsPath != nil {
+		peopleList = r.searchResults(jsonParsed)
+	} else if r.ResultsJSONContainer != "" {
 		// Get children records based on ResultsJSONContainer from config
 		peopleList = jsonParsed.S(r.ResultsJSONContainer).Children()
 	} else {
@@ -223,9 +361,22 @@ func (r *RestAPI) listUsersForPath(
 		peopleList = jsonParsed.Children()
 	}
 
-	results := getPersonsFromResults(peopleList, r.CompareAttribute, desiredAttrs)
+	if r.IDAttribute != "" {
+		desiredAttrs = append(desiredAttrs[:len(desiredAttrs):len(desiredAttrs)], r.IDAttribute)
+	}
+
+	var results []internal.Person
+	if r.FlattenAttributes {
+		results = getPersonsFromFlattenedResults(peopleList, r.CompareAttribute, desiredAttrs)
+	} else {
+		results = getPersonsFromResults(peopleList, r.CompareAttribute, desiredAttrs)
+	}
 
 	for _, person := range results {
+		if r.IDAttribute != "" {
+			person.ID = person.Attributes[r.IDAttribute]
+			person.Attributes["id"] = person.ID
+		}
 		people <- person
 	}
 }
@@ -281,6 +432,128 @@ func getPersonsFromResults(peopleList []*gabs.Container, compareAttr string, des
 	return sourcePeople
 }
 
+// parseListConfig parses the ResultsJSONPath and ListBody
+func (r *RestAPI) parseListConfig() error {
+	var err error
+	if r.ResultsJSONPath != "" {
+		if r.resultsPath, err = parseJSONPath(r.ResultsJSONPath); err != nil {
+			return err
+		}
+	}
+	if r.ListBody != "" {
+		r.listTemplate, err = template.New("ListBody").Funcs(listBodyFuncs).Option("missingkey=error").Parse(r.ListBody)
+		if err != nil {
+			return fmt.Errorf("invalid ListBody: %s", err)
+		}
+	}
+	for name, t := range map[string]*RequestTemplate{
+		"CreateRequest": r.CreateRequest,
+		"UpdateRequest": r.UpdateRequest,
+		"DeleteRequest": r.DeleteRequest,
+	} {
+		if t == nil {
+			continue
+		}
+		if err := t.parse(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var listBodyFuncs = template.FuncMap{
+	// json encodes a value as a JSON string, including the quotes
+	"json": func(v string) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// listVariables returns the ListVariables with those of the sync set added
+func (r *RestAPI) listVariables() map[string]string {
+	vars := map[string]string{}
+	for k, v := range r.ListVariables {
+		vars[k] = v
+	}
+	for k, v := range r.setConfig.ListVariables {
+		vars[k] = v
+	}
+	return vars
+}
+
+// listRequestBody returns the body of the list request: the GraphQL query, the executed ListBody, or none
+func (r *RestAPI) listRequestBody() (string, error) {
+	if r.GraphQLQuery != "" {
+		body, err := json.Marshal(map[string]interface{}{
+			"query":     r.GraphQLQuery,
+			"variables": r.listVariables(),
+		})
+		return string(body), err
+	}
+
+	if r.listTemplate == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := r.listTemplate.Execute(&buf, r.listVariables()); err != nil {
+		return "", fmt.Errorf("unable to create list request body: %s", err)
+	}
+	return buf.String(), nil
+}
+
+// searchResults returns the records located by ResultsJSONPath. If the path matches a single array, its elements
+// are the records.
+func (r *RestAPI) searchResults(jsonParsed *gabs.Container) []*gabs.Container {
+	nodes := searchJSONPath(jsonParsed.Data(), r.resultsPath)
+	if len(nodes) == 1 {
+		if list, ok := nodes[0].([]interface{}); ok {
+			nodes = list
+		}
+	}
+
+	peopleList := make([]*gabs.Container, len(nodes))
+	for i, node := range nodes {
+		peopleList[i] = gabs.Wrap(node)
+	}
+	return peopleList
+}
+
+// getPersonsFromFlattenedResults is like getPersonsFromResults, but the desired attributes are dotted paths into
+// each record as produced by flattenJSON
+func getPersonsFromFlattenedResults(peopleList []*gabs.Container, compareAttr string,
+	desiredAttrs []string) []internal.Person {
+
+	sourcePeople := make([]internal.Person, 0)
+
+	for _, person := range peopleList {
+		flat := flattenJSON(person.Data())
+		peep := internal.Person{
+			Attributes: map[string]string{},
+		}
+
+		for _, sourceKey := range desiredAttrs {
+			value, ok := flat[sourceKey]
+			if !ok {
+				continue
+			}
+			peep.Attributes[sourceKey] = value
+
+			if sourceKey == compareAttr {
+				peep.CompareValue = value
+			}
+		}
+
+		// If person is missing a compare value, do not append them to list
+		if peep.CompareValue == "" {
+			continue
+		}
+
+		sourcePeople = append(sourcePeople, peep)
+	}
+
+	return sourcePeople
+}
+
 type SalesforceAuthResponse struct {
 	ID          string `json:"id"`
 	IssuedAt    string `json:"issued_at"`
@@ -298,7 +571,7 @@ func (r *RestAPI) getSalesforceOauthToken() (string, error) {
 	data.Set("client_id", r.ClientID)
 	data.Set("client_secret", r.ClientSecret)
 
-	client := &http.Client{}
+	client := r.httpClient()
 	req, err := http.NewRequest(http.MethodPost, r.BaseURL, strings.NewReader(data.Encode()))
 	if err != nil {
 		log.Println(err)
@@ -309,7 +582,7 @@ func (r *RestAPI) getSalesforceOauthToken() (string, error) {
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Length", strconv.Itoa(len(data.Encode())))
 
-	resp, err := client.Do(req)
+	resp, err := r.Retry.Do(client, req)
 	if err != nil {
 		log.Println(err)
 		return "", err
@@ -334,11 +607,94 @@ func (r *RestAPI) getSalesforceOauthToken() (string, error) {
 	return authResponse.AccessToken, nil
 }
 
+// httpClient returns the client for requests, which connects through the Proxy, uses the TLS certificates, and
+// does NTLM or Kerberos authentication if they are configured
+func (r *RestAPI) httpClient() *http.Client {
+	if r.client == nil {
+		return &http.Client{}
+	}
+	return r.client
+}
+
+// initSigner creates the signer for the AWSSigV4 AuthType
+func (r *RestAPI) initSigner() error {
+	if r.AuthType != AuthTypeAWSSigV4 {
+		return nil
+	}
+	if r.AWSRegion == "" {
+		return errors.New("AWSRegion is required for the AWSSigV4 AuthType")
+	}
+
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(r.AWSRegion)})
+	if err != nil {
+		return fmt.Errorf("error creating AWS session: %s", err)
+	}
+	creds := sess.Config.Credentials
+	if r.AWSRoleARN != "" {
+		creds = stscreds.NewCredentials(sess, r.AWSRoleARN)
+	}
+	r.signer = v4.NewSigner(creds)
+	return nil
+}
+
+// newHTTPClient returns a client that connects through the Proxy, uses the TLS certificates, and does the NTLM or
+// Kerberos authentication of the AuthType, if they are configured
+func (r *RestAPI) newHTTPClient() (*http.Client, error) {
+	client, err := internal.NewHTTPClient(0, r.Proxy, r.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if client.Transport, err = r.negotiateConfig().RoundTripper(client.Transport); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// negotiateConfig returns the configuration of the NTLM or Kerberos authentication done by the HTTP client
+func (r *RestAPI) negotiateConfig() negotiate.Config {
+	if r.AuthType != AuthTypeNTLM && r.AuthType != AuthTypeKerberos {
+		return negotiate.Config{}
+	}
+	return negotiate.Config{
+		Type:     r.AuthType,
+		Username: r.Username,
+		Password: r.Password,
+		Kerberos: r.Kerberos,
+	}
+}
+
+// setAuth adds the credentials for the AuthType to the request. The body is needed to sign the request for the
+// AWSSigV4 AuthType.
+func (r *RestAPI) setAuth(req *http.Request, body string) error {
+	switch r.AuthType {
+	case AuthTypeBasic:
+		req.SetBasicAuth(r.Username, r.Password)
+	case AuthTypeBearer, AuthTypeSalesforceOauth:
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", r.Password))
+	case AuthTypeAWSSigV4:
+		if r.signer == nil {
+			return errors.New("the AWSSigV4 signer is not initialized")
+		}
+		var bodyReader io.ReadSeeker
+		if body != "" {
+			bodyReader = strings.NewReader(body)
+		}
+		if _, err := r.signer.Sign(req, bodyReader, r.AWSService, r.AWSRegion, time.Now()); err != nil {
+			return fmt.Errorf("error signing request: %s", err)
+		}
+	}
+	return nil
+}
+
 func (r *RestAPI) setDefaults() {
 	// migrate from `Method` to `ListMethod`
 	if r.ListMethod == "" {
 		r.ListMethod = r.Method
 	}
+	// a GraphQL query is always sent in a POST
+	if r.ListMethod == "" && r.GraphQLQuery != "" {
+		r.ListMethod = http.MethodPost
+	}
 	// if neither was set, use the default
 	if r.ListMethod == "" {
 		r.ListMethod = http.MethodGet
@@ -355,14 +711,23 @@ func (r *RestAPI) setDefaults() {
 	if r.UserAgent == "" {
 		r.UserAgent = "personnel-sync"
 	}
+	if r.AWSService == "" {
+		r.AWSService = DefaultAWSService
+	}
 }
 
 func (r *RestAPI) addContact(p internal.Person, n *uint64, wg *sync.WaitGroup, eventLog chan<- internal.EventLogItem) {
 	defer wg.Done()
 
-	apiURL := fmt.Sprintf("%s%s", r.BaseURL, r.setConfig.CreatePath)
-	headers := map[string]string{"Content-Type": "application/json"}
-	responseBody, err := r.httpRequest(r.CreateMethod, apiURL, attributesToJSON(p.Attributes), headers)
+	var responseBody string
+	var err error
+	if r.CreateRequest != nil {
+		responseBody, err = r.templateRequest(r.CreateRequest, p)
+	} else {
+		apiURL := fmt.Sprintf("%s%s", r.BaseURL, r.setConfig.CreatePath)
+		headers := map[string]string{"Content-Type": "application/json"}
+		responseBody, err = r.httpRequest(r.CreateMethod, apiURL, attributesToJSON(p.Attributes), headers)
+	}
 	if err != nil {
 		eventLog <- internal.EventLogItem{
 			Level: syslog.LOG_ERR,
@@ -391,11 +756,51 @@ func attributesToJSON(attr map[string]string) string {
 }
 
 func (r *RestAPI) updateContact(p internal.Person, n *uint64, wg *sync.WaitGroup, eventLog chan<- internal.EventLogItem) {
-	wg.Done()
+	defer wg.Done()
+
+	responseBody, err := r.templateRequest(r.UpdateRequest, p)
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level: syslog.LOG_ERR,
+			Message: fmt.Sprintf("updateContact %s httpRequest error %s, response: %s", p.CompareValue, err,
+				responseBody),
+		}
+		return
+	}
+
+	eventLog <- internal.UpdateEvent("UpdateContact", p.CompareValue, p)
+
+	atomic.AddUint64(n, 1)
 }
 
 func (r *RestAPI) deleteContact(p internal.Person, n *uint64, wg *sync.WaitGroup, eventLog chan<- internal.EventLogItem) {
-	wg.Done()
+	defer wg.Done()
+
+	responseBody, err := r.templateRequest(r.DeleteRequest, p)
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level: syslog.LOG_ERR,
+			Message: fmt.Sprintf("deleteContact %s httpRequest error %s, response: %s", p.CompareValue, err,
+				responseBody),
+		}
+		return
+	}
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: "DeleteContact " + p.CompareValue,
+	}
+
+	atomic.AddUint64(n, 1)
+}
+
+// templateRequest makes the request defined by the template for a person
+func (r *RestAPI) templateRequest(t *RequestTemplate, p internal.Person) (string, error) {
+	apiURL, headers, body, err := t.build(r.BaseURL, r.requestData(p))
+	if err != nil {
+		return "", err
+	}
+	return r.httpRequest(t.Method, apiURL, body, headers)
 }
 
 func (r *RestAPI) httpRequest(verb, url, body string, headers map[string]string) (string, error) {
@@ -416,15 +821,12 @@ func (r *RestAPI) httpRequest(verb, url, body string, headers map[string]string)
 	}
 	req.Header.Set("User-Agent", r.UserAgent)
 
-	switch r.AuthType {
-	case AuthTypeBasic:
-		req.SetBasicAuth(r.Username, r.Password)
-	case AuthTypeBearer, AuthTypeSalesforceOauth:
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", r.Password))
+	if err := r.setAuth(req, body); err != nil {
+		return "", err
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	client := r.httpClient()
+	resp, err := r.Retry.Do(client, req)
 	if err != nil {
 		return "", err
 	}
@@ -437,7 +839,7 @@ func (r *RestAPI) httpRequest(verb, url, body string, headers map[string]string)
 	bodyString := string(bodyBytes)
 
 	if resp.StatusCode >= 400 {
-		return bodyString, errors.New(resp.Status)
+		return bodyString, internal.NewStatusError(resp.StatusCode, resp.Header.Get("Retry-After"), errors.New(resp.Status))
 	}
 
 	return bodyString, nil
@@ -2,12 +2,21 @@ package restapi
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/Jeffail/gabs/v2"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
 
 	"github.com/silinternational/personnel-sync/v5/internal"
 )
@@ -307,6 +316,71 @@ func TestRestAPI_listUsersForPath(t *testing.T) {
 	}
 }
 
+func TestRestAPI_listRequestBody(t *testing.T) {
+	var gotMethod, gotBody, gotContentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		gotMethod, gotBody, gotContentType = req.Method, string(body), req.Header.Get("Content-Type")
+		_, _ = io.WriteString(w, `{"data": {"users": [{"email": "one@example.com"}]}}`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		extraJSON string
+		setJSON   string
+		wantBody  string
+	}{
+		{
+			name: "ListBody",
+			extraJSON: `{"ListMethod": "POST", "ListBody": "{\"report\": {{json .report}}, \"org\": \"{{.org}}\"}",
+				"ListVariables": {"report": "All \"Staff\"", "org": "acme"}}`,
+			setJSON:  `{"Paths": ["/users"], "ListVariables": {"org": "widgets"}}`,
+			wantBody: `{"report": "All \"Staff\"", "org": "widgets"}`,
+		},
+		{
+			name:      "GraphQL",
+			extraJSON: `{"GraphQLQuery": "query($org: String) { users(org: $org) { email } }"}`,
+			setJSON:   `{"Paths": ["/graphql"], "ListVariables": {"org": "acme"}}`,
+			wantBody:  `{"query":"query($org: String) { users(org: $org) { email } }","variables":{"org":"acme"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extraJSON := strings.Replace(tt.extraJSON, "{", `{"BaseURL": "`+server.URL+
+				`", "CompareAttribute": "email", "ResultsJSONPath": "$.data.users", `, 1)
+			source, err := NewRestAPISource(internal.SourceConfig{ExtraJSON: []byte(extraJSON)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := source.ForSet([]byte(tt.setJSON)); err != nil {
+				t.Fatal(err)
+			}
+
+			people, err := source.ListUsers([]string{"email"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(people) != 1 || people[0].CompareValue != "one@example.com" {
+				t.Errorf("ListUsers() = %v, want one person", people)
+			}
+			if gotMethod != http.MethodPost || gotContentType != "application/json" {
+				t.Errorf("method = %s, Content-Type = %s, want a JSON POST", gotMethod, gotContentType)
+			}
+			if gotBody != tt.wantBody {
+				t.Errorf("body = %s\nwant %s", gotBody, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestNewRestAPISource_InvalidListBody(t *testing.T) {
+	_, err := NewRestAPISource(internal.SourceConfig{ExtraJSON: []byte(`{"ListBody": "{{.unclosed"}`)})
+	if err == nil {
+		t.Error("NewRestAPISource() should fail for an invalid ListBody")
+	}
+}
+
 func Test_getPersonsFromResults(t *testing.T) {
 	person1 := gabs.New()
 	_, _ = person1.Set("value1", "field1")
@@ -506,3 +580,180 @@ func TestRestAPI_httpRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestRestAPI_AWSSigV4(t *testing.T) {
+	for key, value := range map[string]string{"AWS_ACCESS_KEY_ID": "AKID", "AWS_SECRET_ACCESS_KEY": "secret",
+		"AWS_SESSION_TOKEN": "", "AWS_PROFILE": "", "AWS_CONFIG_FILE": "/nonexistent"} {
+		old, ok := os.LookupEnv(key)
+		_ = os.Setenv(key, value)
+		if ok {
+			defer os.Setenv(key, old)
+		} else {
+			defer os.Unsetenv(key)
+		}
+	}
+
+	// the server signs a copy of the request, with the same signed headers and date, and checks that the
+	// signatures match
+	signer := v4.NewSigner(credentials.NewStaticCredentials("AKID", "secret", ""))
+	var gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		gotBody = string(body)
+
+		auth := req.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(auth, "/us-east-1/execute-api/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		signedAt, err := time.Parse("20060102T150405Z", req.Header.Get("X-Amz-Date"))
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		check, _ := http.NewRequest(req.Method, "http://"+req.Host+req.URL.RequestURI(), nil)
+		signedHeaders := strings.Split(auth, "SignedHeaders=")[1]
+		for _, name := range strings.Split(strings.Split(signedHeaders, ",")[0], ";") {
+			if name != "host" && name != "x-amz-date" {
+				check.Header.Set(name, req.Header.Get(name))
+			}
+		}
+		var bodyReader io.ReadSeeker
+		if len(body) > 0 {
+			bodyReader = strings.NewReader(string(body))
+		}
+		_, _ = signer.Sign(check, bodyReader, "execute-api", "us-east-1", signedAt)
+		if check.Header.Get("Authorization") != auth {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = io.WriteString(w, `[{"email": "one@example.com"}]`)
+	}))
+	defer server.Close()
+
+	source, err := NewRestAPISource(internal.SourceConfig{ExtraJSON: []byte(`{"BaseURL": "` + server.URL +
+		`", "AuthType": "AWSSigV4", "AWSRegion": "us-east-1", "CompareAttribute": "email"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := source.ForSet([]byte(`{"Paths": ["/users?active=true"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	people, err := source.ListUsers([]string{"email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(people) != 1 {
+		t.Errorf("ListUsers() = %v, want one person", people)
+	}
+
+	restAPI := source.(*RestAPI)
+	got, err := restAPI.httpRequest(http.MethodPost, server.URL+"/users", `{"email": "two@example.com"}`,
+		map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		t.Fatalf("httpRequest() error = %v, response %s", err, got)
+	}
+	if gotBody != `{"email": "two@example.com"}` {
+		t.Errorf("body = %s, want the signed body", gotBody)
+	}
+
+	if _, err := NewRestAPIDestination(internal.DestinationConfig{ExtraJSON: []byte(
+		`{"AuthType": "AWSSigV4"}`)}); err == nil {
+		t.Error("NewRestAPIDestination() should fail without an AWSRegion")
+	}
+}
+
+func TestRestAPI_RequestTemplates(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet && req.URL.Path == "/people" {
+			_, _ = io.WriteString(w, `{"data": [{"key": 7, "mail": "ann@example.com", "name": "Ann"},
+				{"key": 9, "mail": "bob@example.com", "name": "Bob"}]}`)
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		mutex.Lock()
+		requests = append(requests, fmt.Sprintf("%s %s %s %s", req.Method, req.URL.RequestURI(),
+			req.Header.Get("X-Tenant"), body))
+		mutex.Unlock()
+		if strings.Contains(string(body), "fail@example.com") {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	extraJSON := `{"BaseURL": "` + server.URL + `", "CompareAttribute": "mail", "ResultsJSONContainer": "data",
+		"IDAttribute": "key", "ListVariables": {"tenant": "acme"},
+		"CreateRequest": {"Method": "post", "URL": "/people?notify={{.Variables.notify}}",
+			"Headers": {"X-Tenant": "{{.Variables.tenant}}"}},
+		"UpdateRequest": {"Method": "PATCH", "URL": "/people/{{path .ID}}",
+			"Body": "{\"displayName\": {{json .Attributes.name}}, \"missing\": \"{{.Attributes.missing}}\"}"},
+		"DeleteRequest": {"Method": "DELETE", "URL": "{{.Variables.archive}}/{{.ID}}"}}`
+	dest, err := NewRestAPIDestination(internal.DestinationConfig{ExtraJSON: []byte(extraJSON)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setJSON := `{"Paths": ["/people"], "ListVariables": {"notify": "false", "archive": "` + server.URL + `/archive"}}`
+	if err := dest.ForSet([]byte(setJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	people, err := dest.ListUsers([]string{"mail", "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPeople := []internal.Person{
+		{CompareValue: "ann@example.com", ID: "7", Attributes: map[string]string{"mail": "ann@example.com",
+			"name": "Ann", "key": "7", "id": "7"}},
+		{CompareValue: "bob@example.com", ID: "9", Attributes: map[string]string{"mail": "bob@example.com",
+			"name": "Bob", "key": "9", "id": "9"}},
+	}
+	if !reflect.DeepEqual(people, wantPeople) {
+		t.Errorf("ListUsers() = %+v\nwant %+v", people, wantPeople)
+	}
+
+	eventLog := make(chan internal.EventLogItem, 10)
+	results := dest.ApplyChangeSet(internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "cat@example.com", Attributes: map[string]string{"mail": "cat@example.com"}},
+			{CompareValue: "fail@example.com", Attributes: map[string]string{"mail": "fail@example.com"}},
+		},
+		Update: []internal.Person{
+			{CompareValue: "ann@example.com", ID: "7", Attributes: map[string]string{"name": "Ann \"A\" Lee"}},
+		},
+		Delete: []internal.Person{people[1]},
+	}, eventLog)
+	close(eventLog)
+
+	if want := (internal.ChangeResults{Created: 1, Updated: 1, Deleted: 1}); !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+	if len(eventLog) != 4 {
+		t.Errorf("got %v events, want 4", len(eventLog))
+	}
+
+	sort.Strings(requests)
+	wantRequests := []string{
+		"DELETE /archive/9  ",
+		`PATCH /people/7  {"displayName": "Ann \"A\" Lee", "missing": ""}`,
+		`POST /people?notify=false acme {"mail":"cat@example.com"}`,
+		`POST /people?notify=false acme {"mail":"fail@example.com"}`,
+	}
+	if !reflect.DeepEqual(requests, wantRequests) {
+		t.Errorf("requests = %q\nwant %q", requests, wantRequests)
+	}
+}
+
+func TestNewRestAPIDestination_InvalidRequestTemplate(t *testing.T) {
+	for _, extraJSON := range []string{
+		`{"UpdateRequest": {"Method": "PUT", "URL": "/users/{{.ID"}}`,
+		`{"DeleteRequest": {"URL": "/users/{{.ID}}"}}`,
+		`{"CreateRequest": {"Method": "POST"}}`,
+	} {
+		if _, err := NewRestAPIDestination(internal.DestinationConfig{ExtraJSON: []byte(extraJSON)}); err == nil {
+			t.Errorf("NewRestAPIDestination(%s) should fail", extraJSON)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package restapi
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	internal "github.com/silinternational/personnel-sync/v5/internal"
+)
+
+// RequestTemplate defines the request made for each person that is created, updated, or deleted. URL, the header
+// values, and Body are Go templates, executed with the fields of requestData.
+type RequestTemplate struct {
+	Method string
+
+	// URL of the request, relative to the BaseURL if it begins with a /, e.g. `/users/{{path .ID}}`
+	URL string
+
+	Headers map[string]string
+
+	// Body of the request. If it is not set, a POST, PUT, or PATCH sends the person's attributes as a JSON object.
+	Body string
+
+	url     *template.Template
+	headers map[string]*template.Template
+	body    *template.Template
+}
+
+// requestData is the data for a RequestTemplate
+type requestData struct {
+	// ID is the destination's ID of the person, from the IDAttribute. It is empty for a new person.
+	ID           string
+	CompareValue string
+	Attributes   map[string]string
+
+	// JSON is the attributes as a JSON object, which is the default body
+	JSON string
+
+	// Variables are the ListVariables, including those of the sync set
+	Variables map[string]string
+}
+
+var requestFuncs = template.FuncMap{
+	"json": listBodyFuncs["json"],
+
+	// path escapes a value for use as a segment of a URL path
+	"path": url.PathEscape,
+}
+
+// parse parses the templates. The name is used in error messages.
+func (t *RequestTemplate) parse(name string) error {
+	if t.URL == "" {
+		return fmt.Errorf("%s URL is required", name)
+	}
+	if t.Method == "" {
+		return fmt.Errorf("%s Method is required", name)
+	}
+	t.Method = strings.ToUpper(t.Method)
+
+	var err error
+	if t.url, err = newRequestTemplate(name+" URL", t.URL); err != nil {
+		return err
+	}
+	if t.body, err = newRequestTemplate(name+" Body", t.Body); err != nil {
+		return err
+	}
+	t.headers = map[string]*template.Template{}
+	for header, value := range t.Headers {
+		if t.headers[header], err = newRequestTemplate(name+" header "+header, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newRequestTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(requestFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", name, err)
+	}
+	return tmpl, nil
+}
+
+// build returns the URL, headers, and body of the request for a person
+func (t *RequestTemplate) build(baseURL string, data requestData) (string, map[string]string, string, error) {
+	apiURL, err := execute(t.url, data)
+	if err != nil {
+		return "", nil, "", err
+	}
+	if strings.HasPrefix(apiURL, "/") {
+		apiURL = baseURL + apiURL
+	}
+
+	body, err := execute(t.body, data)
+	if err != nil {
+		return "", nil, "", err
+	}
+	if t.Body == "" && (t.Method == http.MethodPost || t.Method == http.MethodPut || t.Method == http.MethodPatch) {
+		body = data.JSON
+	}
+
+	headers := map[string]string{}
+	if body != "" {
+		headers["Content-Type"] = "application/json"
+	}
+	for header, tmpl := range t.headers {
+		if headers[header], err = execute(tmpl, data); err != nil {
+			return "", nil, "", err
+		}
+	}
+	return apiURL, headers, body, nil
+}
+
+func execute(tmpl *template.Template, data requestData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("unable to execute %s: %s", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// requestData returns the template data for a person
+func (r *RestAPI) requestData(p internal.Person) requestData {
+	id := p.ID
+	if id == "" {
+		id = p.Attributes["id"]
+	}
+	return requestData{
+		ID:           id,
+		CompareValue: p.CompareValue,
+		Attributes:   p.Attributes,
+		JSON:         attributesToJSON(p.Attributes),
+		Variables:    r.listVariables(),
+	}
+}
@@ -0,0 +1,53 @@
+// Package sesalert sends alert emails through AWS SES. It registers itself with the alert package when imported.
+package sesalert
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ses"
+
+	"github.com/silinternational/personnel-sync/v5/alert"
+)
+
+func init() {
+	alert.RegisterEmailSender(SendEmail)
+}
+
+// SendEmail sends an alert email to one recipient through AWS SES, in the AWSRegion and with the AWS credentials of
+// the config, or the default credentials if they are not set
+func SendEmail(config alert.Config, recipient, subject, body string) error {
+	charSet := config.CharSet
+
+	emailMsg := ses.Message{}
+	emailMsg.SetSubject(&ses.Content{Charset: &charSet, Data: &subject})
+	emailMsg.SetBody(&ses.Body{Text: &ses.Content{Charset: &charSet, Data: &body}})
+
+	input := &ses.SendEmailInput{
+		Destination: &ses.Destination{
+			ToAddresses: []*string{&recipient},
+		},
+		Message: &emailMsg,
+		Source:  aws.String(config.ReturnToAddr),
+	}
+
+	cfg := &aws.Config{Region: aws.String(config.AWSRegion)}
+	if config.AWSAccessKeyID != "" && config.AWSSecretAccessKey != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(config.AWSAccessKeyID, config.AWSSecretAccessKey, "")
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return fmt.Errorf("error creating AWS session: %s", err)
+	}
+
+	svc := ses.New(sess)
+	result, err := svc.SendEmail(input)
+	if err != nil {
+		return fmt.Errorf("error sending email, result: %s, error: %s", result, err)
+	}
+	log.Printf("alert message sent to %s, message ID: %s", recipient, *result.MessageId)
+	return nil
+}
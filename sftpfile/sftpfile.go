@@ -0,0 +1,342 @@
+package sftpfile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+
+	DefaultPort = 22
+)
+
+func init() {
+	internal.RegisterSource(internal.SourceTypeSFTP, NewSFTPSource)
+
+	internal.DescribeSource(internal.SourceTypeSFTP, internal.AdapterConfig{
+		ExtraJSON: []interface{}{SFTP{}},
+		SyncSet:   SetConfig{},
+	})
+}
+
+// SFTP is a source that reads the newest file matching a pattern from an SFTP server
+type SFTP struct {
+	Host     string
+	Port     int
+	Username string
+
+	// Password or PrivateKey (in PEM format) authenticates the user. A PrivateKeyPassphrase is needed if the key
+	// is encrypted.
+	Password             string
+	PrivateKey           string
+	PrivateKeyPassphrase string
+
+	// HostKey is the server's public key in authorized_keys format, e.g. "ssh-ed25519 AAAA...". It is required
+	// unless InsecureIgnoreHostKey is set, which should only be used for testing.
+	HostKey               string
+	InsecureIgnoreHostKey bool
+
+	// Proxy is a SOCKS5 proxy for the connection to the server
+	Proxy internal.ProxyConfig
+
+	CompareAttribute string
+	setConfig        SetConfig
+}
+
+// SetConfig selects the file for a sync set
+type SetConfig struct {
+	// Directory on the server to look for files in
+	Directory string
+
+	// Pattern is a shell pattern for the file name, e.g. "staff_*.csv". The most recently modified file that
+	// matches is used.
+	Pattern string
+
+	// Format is csv or json. If it is not set, it is taken from the file name extension.
+	Format string
+}
+
+// fileSystem is the part of an SFTP client used to find and read a file
+type fileSystem interface {
+	ReadDir(dir string) ([]os.FileInfo, error)
+	Open(path string) (io.ReadCloser, error)
+}
+
+// sftpFileSystem adapts an sftp.Client to the fileSystem interface
+type sftpFileSystem struct {
+	*sftp.Client
+}
+
+func (f sftpFileSystem) Open(path string) (io.ReadCloser, error) {
+	return f.Client.Open(path)
+}
+
+// NewSFTPSource unmarshals the sourceConfig's ExtraJSON into an SFTP struct
+func NewSFTPSource(sourceConfig internal.SourceConfig) (internal.Source, error) {
+	var s SFTP
+	if err := json.Unmarshal(sourceConfig.ExtraJSON, &s); err != nil {
+		return &SFTP{}, err
+	}
+
+	if s.Host == "" || s.Username == "" {
+		return &SFTP{}, errors.New("Host and Username are required for the SFTP source")
+	}
+	if s.Password == "" && s.PrivateKey == "" {
+		return &SFTP{}, errors.New("a Password or PrivateKey is required for the SFTP source")
+	}
+	if s.HostKey == "" && !s.InsecureIgnoreHostKey {
+		return &SFTP{}, errors.New("HostKey is required for the SFTP source")
+	}
+	if s.CompareAttribute == "" {
+		return &SFTP{}, errors.New("CompareAttribute is required for the SFTP source")
+	}
+	if s.Port == 0 {
+		s.Port = DefaultPort
+	}
+	if err := s.Proxy.Validate(); err != nil {
+		return &SFTP{}, err
+	}
+
+	return &s, nil
+}
+
+func (s *SFTP) ForSet(syncSetJson json.RawMessage) error {
+	var setConfig SetConfig
+	if err := json.Unmarshal(syncSetJson, &setConfig); err != nil {
+		return err
+	}
+
+	if setConfig.Pattern == "" {
+		return errors.New("Pattern is empty in sync set")
+	}
+	if _, err := path.Match(setConfig.Pattern, ""); err != nil {
+		return fmt.Errorf("invalid Pattern %q: %s", setConfig.Pattern, err)
+	}
+	switch setConfig.Format {
+	case "", FormatCSV, FormatJSON:
+	default:
+		return fmt.Errorf("invalid Format %q, must be csv or json", setConfig.Format)
+	}
+	if setConfig.Directory == "" {
+		setConfig.Directory = "."
+	}
+
+	s.setConfig = setConfig
+	return nil
+}
+
+// ListUsers downloads the newest matching file and returns a Person for each record in it
+func (s *SFTP) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+	sshClient, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer sshClient.Close()
+
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start SFTP session with %s: %s", s.Host, err)
+	}
+	defer client.Close()
+
+	return s.listUsersFrom(sftpFileSystem{client}, desiredAttrs)
+}
+
+func (s *SFTP) listUsersFrom(fs fileSystem, desiredAttrs []string) ([]internal.Person, error) {
+	name, err := newestMatchingFile(fs, s.setConfig.Directory, s.setConfig.Pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	filePath := path.Join(s.setConfig.Directory, name)
+	file, err := fs.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %s", filePath, err)
+	}
+	defer file.Close()
+
+	format := s.setConfig.Format
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(path.Ext(name)), ".")
+	}
+
+	var records []map[string]string
+	switch format {
+	case FormatCSV:
+		records, err = parseCSV(file)
+	case FormatJSON:
+		records, err = parseJSON(file)
+	default:
+		return nil, fmt.Errorf("unable to tell the format of %s, set the Format in the sync set", filePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", filePath, err)
+	}
+
+	var people []internal.Person
+	for _, record := range records {
+		if record[s.CompareAttribute] == "" {
+			continue
+		}
+		person := internal.Person{
+			CompareValue: record[s.CompareAttribute],
+			Attributes:   map[string]string{},
+		}
+		for _, attr := range desiredAttrs {
+			if value, ok := record[attr]; ok {
+				person.Attributes[attr] = value
+			}
+		}
+		people = append(people, person)
+	}
+	return people, nil
+}
+
+func (s *SFTP) dial() (*ssh.Client, error) {
+	var auth []ssh.AuthMethod
+	if s.PrivateKey != "" {
+		var signer ssh.Signer
+		var err error
+		if s.PrivateKeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(s.PrivateKey), []byte(s.PrivateKeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(s.PrivateKey))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse SFTP PrivateKey: %s", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if s.Password != "" {
+		auth = append(auth, ssh.Password(s.Password))
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if !s.InsecureIgnoreHostKey {
+		hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse SFTP HostKey: %s", err)
+		}
+		hostKeyCallback = ssh.FixedHostKey(hostKey)
+	}
+
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	conn, err := s.Proxy.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to SFTP server %s: %s", addr, err)
+	}
+
+	// the handshake has the same timeout as ssh.Dial would use
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            s.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to connect to SFTP server %s: %s", addr, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// newestMatchingFile returns the name of the most recently modified file in the directory that matches the pattern
+func newestMatchingFile(fs fileSystem, dir, pattern string) (string, error) {
+	files, err := fs.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("unable to list directory %s: %s", dir, err)
+	}
+
+	var newest os.FileInfo
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if matched, _ := path.Match(pattern, f.Name()); !matched {
+			continue
+		}
+		if newest == nil || f.ModTime().After(newest.ModTime()) {
+			newest = f
+		}
+	}
+
+	if newest == nil {
+		return "", fmt.Errorf("no file matching %s found in %s", pattern, dir)
+	}
+	return newest.Name(), nil
+}
+
+// parseCSV returns a record for each row, keyed by the column names in the first row
+func parseCSV(r io.Reader) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	header := rows[0]
+	if len(header) > 0 {
+		// Remove a byte order mark, which is common in CSV files exported by Excel
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	records := make([]map[string]string, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		record := map[string]string{}
+		for i, value := range row {
+			if i < len(header) {
+				record[strings.TrimSpace(header[i])] = value
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// parseJSON returns a record for each object in a JSON array, with the values of its top-level fields
+func parseJSON(r io.Reader) ([]map[string]string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []map[string]interface{}
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+
+	records := make([]map[string]string, 0, len(objects))
+	for _, object := range objects {
+		record := map[string]string{}
+		for key, value := range object {
+			if value != nil {
+				record[key] = fmt.Sprintf("%v", value)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
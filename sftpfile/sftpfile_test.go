@@ -0,0 +1,186 @@
+package sftpfile
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+// localFileSystem is a fileSystem backed by a local directory
+type localFileSystem struct{}
+
+func (localFileSystem) ReadDir(dir string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(dir)
+}
+
+func (localFileSystem) Open(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string, modTimes map[string]time.Time) {
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if modTime, ok := modTimes[name]; ok {
+			if err := os.Chtimes(p, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestNewSFTPSource(t *testing.T) {
+	const server = `"Host":"sftp.example.com","Username":"hr",`
+	tests := []struct {
+		name    string
+		extra   string
+		wantErr bool
+	}{
+		{
+			name:  "password",
+			extra: `{` + server + `"Password":"pw","HostKey":"ssh-ed25519 AAAA","CompareAttribute":"email"}`,
+		},
+		{
+			name:    "no credentials",
+			extra:   `{` + server + `"HostKey":"ssh-ed25519 AAAA","CompareAttribute":"email"}`,
+			wantErr: true,
+		},
+		{
+			name:    "no host key",
+			extra:   `{` + server + `"Password":"pw","CompareAttribute":"email"}`,
+			wantErr: true,
+		},
+		{
+			name:  "insecure host key",
+			extra: `{` + server + `"Password":"pw","InsecureIgnoreHostKey":true,"CompareAttribute":"email"}`,
+		},
+		{
+			name:    "no compare attribute",
+			extra:   `{` + server + `"Password":"pw","HostKey":"ssh-ed25519 AAAA"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewSFTPSource(internal.SourceConfig{ExtraJSON: json.RawMessage(tt.extra)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSFTPSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && source.(*SFTP).Port != DefaultPort {
+				t.Errorf("Port = %v, want %v", source.(*SFTP).Port, DefaultPort)
+			}
+		})
+	}
+}
+
+func TestSFTP_ForSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		setJSON string
+		wantErr bool
+	}{
+		{name: "valid", setJSON: `{"Directory":"/exports","Pattern":"staff_*.csv"}`},
+		{name: "no pattern", setJSON: `{"Directory":"/exports"}`, wantErr: true},
+		{name: "bad pattern", setJSON: `{"Pattern":"staff_[.csv"}`, wantErr: true},
+		{name: "bad format", setJSON: `{"Pattern":"*.txt","Format":"xml"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SFTP{}
+			if err := s.ForSet(json.RawMessage(tt.setJSON)); (err != nil) != tt.wantErr {
+				t.Errorf("ForSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSFTP_listUsersFrom(t *testing.T) {
+	now := time.Now()
+	files := map[string]string{
+		"staff_20201001.csv": "email,name\nold@example.com,Old\n",
+		"staff_20201002.csv": "\ufeffemail,name,dept\njane@example.com,Jane,IT\n,No Email,HR\njohn@example.com,John,HR\n",
+		"other_20201003.csv": "email,name\nother@example.com,Other\n",
+		"staff.json":         `[{"email":"jane@example.com","name":"Jane","id":12,"manager":null}]`,
+	}
+	modTimes := map[string]time.Time{
+		"staff_20201001.csv": now.Add(-48 * time.Hour),
+		"staff_20201002.csv": now.Add(-24 * time.Hour),
+		"other_20201003.csv": now,
+		"staff.json":         now,
+	}
+
+	tests := []struct {
+		name      string
+		setConfig SetConfig
+		want      []internal.Person
+		wantErr   bool
+	}{
+		{
+			name:      "newest csv",
+			setConfig: SetConfig{Pattern: "staff_*.csv"},
+			want: []internal.Person{
+				{CompareValue: "jane@example.com", Attributes: map[string]string{"email": "jane@example.com", "name": "Jane"}},
+				{CompareValue: "john@example.com", Attributes: map[string]string{"email": "john@example.com", "name": "John"}},
+			},
+		},
+		{
+			name:      "json",
+			setConfig: SetConfig{Pattern: "*.json"},
+			want: []internal.Person{
+				{CompareValue: "jane@example.com", Attributes: map[string]string{"email": "jane@example.com", "name": "Jane"}},
+			},
+		},
+		{
+			name:      "no match",
+			setConfig: SetConfig{Pattern: "*.xlsx"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "sftpfile")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			writeFiles(t, dir, files, modTimes)
+
+			s := &SFTP{CompareAttribute: "email"}
+			tt.setConfig.Directory = dir
+			s.setConfig = tt.setConfig
+
+			got, err := s.listUsersFrom(localFileSystem{}, []string{"email", "name"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("listUsersFrom() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listUsersFrom() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	got, err := parseJSON(strings.NewReader(`[{"id":12,"active":true,"name":"Jane"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{{"id": "12", "active": "true", "name": "Jane"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseJSON() = %v, want %v", got, want)
+	}
+
+	if _, err := parseJSON(strings.NewReader(`{"not":"an array"}`)); err == nil {
+		t.Error("parseJSON() expected an error for an object")
+	}
+}
@@ -0,0 +1,170 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	// Register the supported database drivers
+	_ "github.com/denisenkom/go-mssqldb"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+const (
+	DriverMySQL     = "mysql"
+	DriverPostgres  = "postgres"
+	DriverSQLServer = "sqlserver"
+
+	DefaultQueryTimeoutSeconds = 300
+)
+
+func init() {
+	internal.RegisterSource(internal.SourceTypeSQL, NewSQLSource)
+
+	internal.DescribeSource(internal.SourceTypeSQL, internal.AdapterConfig{
+		ExtraJSON: []interface{}{SQL{}},
+		SyncSet:   SetConfig{},
+	})
+}
+
+// SQL is a source that reads people from a database query. Each column of the result becomes an attribute.
+type SQL struct {
+	// Driver is mysql, postgres, or sqlserver
+	Driver string
+
+	// DSN is the data source name in the format of the driver, e.g. user:pass@tcp(host:3306)/hr for mysql
+	DSN string
+
+	CompareAttribute    string
+	QueryTimeoutSeconds int
+
+	setConfig SetConfig
+	db        *sql.DB
+}
+
+// SetConfig holds the query for a sync set
+type SetConfig struct {
+	Query string
+
+	// Args are values for the placeholders in the Query, which are ? for mysql, $1 for postgres, and @p1 for
+	// sqlserver
+	Args []interface{}
+}
+
+// NewSQLSource unmarshals the sourceConfig's ExtraJSON into a SQL struct and opens the database
+func NewSQLSource(sourceConfig internal.SourceConfig) (internal.Source, error) {
+	var s SQL
+	if err := json.Unmarshal(sourceConfig.ExtraJSON, &s); err != nil {
+		return &SQL{}, err
+	}
+
+	switch s.Driver {
+	case DriverMySQL, DriverPostgres, DriverSQLServer:
+	default:
+		return &SQL{}, fmt.Errorf("invalid SQL Driver %q, must be mysql, postgres, or sqlserver", s.Driver)
+	}
+	if s.DSN == "" {
+		return &SQL{}, errors.New("DSN is required for the SQL source")
+	}
+	if s.CompareAttribute == "" {
+		return &SQL{}, errors.New("CompareAttribute is required for the SQL source")
+	}
+	if s.QueryTimeoutSeconds <= 0 {
+		s.QueryTimeoutSeconds = DefaultQueryTimeoutSeconds
+	}
+
+	var err error
+	if s.db, err = sql.Open(s.Driver, s.DSN); err != nil {
+		return &SQL{}, fmt.Errorf("unable to open %s database: %s", s.Driver, err)
+	}
+	return &s, nil
+}
+
+func (s *SQL) ForSet(syncSetJson json.RawMessage) error {
+	var setConfig SetConfig
+	if err := json.Unmarshal(syncSetJson, &setConfig); err != nil {
+		return err
+	}
+	if setConfig.Query == "" {
+		return errors.New("Query is empty in sync set")
+	}
+
+	s.setConfig = setConfig
+	return nil
+}
+
+// ListUsers runs the query and returns a Person for each row
+func (s *SQL) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.QueryTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, s.setConfig.Query, s.setConfig.Args...)
+	if err != nil {
+		return nil, fmt.Errorf("error running SQL query: %s", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("error reading SQL columns: %s", err)
+	}
+
+	var people []internal.Person
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("error reading SQL row: %s", err)
+		}
+
+		row := map[string]string{}
+		for i, column := range columns {
+			if values[i] != nil {
+				row[column] = columnString(values[i])
+			}
+		}
+
+		if row[s.CompareAttribute] == "" {
+			continue
+		}
+		person := internal.Person{
+			CompareValue: row[s.CompareAttribute],
+			Attributes:   map[string]string{},
+		}
+		for _, attr := range desiredAttrs {
+			if value, ok := row[attr]; ok {
+				person.Attributes[attr] = value
+			}
+		}
+		people = append(people, person)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading SQL rows: %s", err)
+	}
+
+	return people, nil
+}
+
+// columnString formats a column value as an attribute value. Dates without a time are formatted as YYYY-MM-DD.
+func columnString(value interface{}) string {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,141 @@
+package sqldb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+// fakeDriver returns the same rows for any query, and records the query and its arguments
+type fakeDriver struct {
+	query string
+	args  []driver.Value
+}
+
+type fakeConn struct{ driver *fakeDriver }
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+var fakeColumns = []string{"email", "first_name", "hire_date", "manager_id"}
+
+var fakeData = [][]driver.Value{
+	{"mickey@acme.com", []byte("Mickey"), time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC), int64(10)},
+	{"donald@acme.com", "Donald", time.Date(2020, 2, 1, 9, 30, 0, 0, time.UTC), nil},
+	{nil, "No Email", nil, nil},
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) { return &fakeConn{driver: d}, nil }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+func (s *fakeStmt) Close() error                                    { return nil }
+func (s *fakeStmt) NumInput() int                                   { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.conn.driver.query, s.conn.driver.args = s.query, args
+	return &fakeRows{columns: fakeColumns, rows: fakeData}, nil
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSQL_ListUsers(t *testing.T) {
+	fake := &fakeDriver{}
+	sql.Register("fakesql", fake)
+	db, err := sql.Open("fakesql", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &SQL{CompareAttribute: "email", QueryTimeoutSeconds: 10, db: db}
+	if err := s.ForSet([]byte(`{"Query": "SELECT * FROM staff WHERE dept = ?", "Args": ["IT"]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.ListUsers([]string{"email", "first_name", "hire_date", "manager_id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []internal.Person{
+		{
+			CompareValue: "mickey@acme.com",
+			Attributes: map[string]string{
+				"email":      "mickey@acme.com",
+				"first_name": "Mickey",
+				"hire_date":  "2020-01-15",
+				"manager_id": "10",
+			},
+		},
+		{
+			CompareValue: "donald@acme.com",
+			Attributes: map[string]string{
+				"email":      "donald@acme.com",
+				"first_name": "Donald",
+				"hire_date":  "2020-02-01T09:30:00Z",
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListUsers() = %#v\nwant %#v", got, want)
+	}
+	if fake.query != "SELECT * FROM staff WHERE dept = ?" || !reflect.DeepEqual(fake.args, []driver.Value{"IT"}) {
+		t.Errorf("query = %q %v, want the sync set Query and Args", fake.query, fake.args)
+	}
+}
+
+func TestNewSQLSource(t *testing.T) {
+	tests := []struct {
+		name      string
+		extraJSON string
+		wantErr   bool
+	}{
+		{
+			name:      "valid",
+			extraJSON: `{"Driver": "postgres", "DSN": "postgres://u:p@localhost/hr", "CompareAttribute": "email"}`,
+		},
+		{
+			name:      "unsupported driver",
+			extraJSON: `{"Driver": "oracle", "DSN": "x", "CompareAttribute": "email"}`,
+			wantErr:   true,
+		},
+		{
+			name:      "missing DSN",
+			extraJSON: `{"Driver": "mysql", "CompareAttribute": "email"}`,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSQLSource(internal.SourceConfig{ExtraJSON: []byte(tt.extraJSON)})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSQLSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,112 +1,476 @@
 package personnel_sync
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/silinternational/personnel-sync/v5/alert"
-	"github.com/silinternational/personnel-sync/v5/google"
 	"github.com/silinternational/personnel-sync/v5/internal"
-	"github.com/silinternational/personnel-sync/v5/restapi"
-	"github.com/silinternational/personnel-sync/v5/webhelpdesk"
 )
 
+// Hooks are called as a sync progresses, for programs that embed the engine. See RunSyncWithHooks.
+type Hooks = internal.Hooks
+
+// Phase is a step in the run of a sync set, passed to the PhaseStart and PhaseEnd Hooks
+type Phase = internal.Phase
+
+// ChangeProgress is passed to the Change hook
+type ChangeProgress = internal.ChangeProgress
+
+// RunResults are the results of every sync set of a run, returned by RunSyncWithResults
+type RunResults = internal.RunResults
+
 func RunSync(configFile string) error {
+	return RunSyncWithHooks(configFile, Hooks{})
+}
+
+// RunSyncWithHooks runs the sync like RunSync, and calls the hooks as it progresses
+func RunSyncWithHooks(configFile string, hooks Hooks) error {
+	_, err := RunSyncWithResults(configFile, hooks)
+	return err
+}
+
+// RunSyncWithResults runs the sync like RunSyncWithHooks, and returns the results of every sync set by sync set
+// name and destination
+func RunSyncWithResults(configFile string, hooks Hooks) (*RunResults, error) {
 	log.SetOutput(os.Stdout)
 	log.SetFlags(0)
 	log.Printf("Personnel sync started at %s", time.Now().UTC().Format(time.RFC1123Z))
 
-	appConfig, err := internal.LoadConfig(configFile)
+	results := internal.NewRunResults()
+	appConfig, source, destinations, stateStore, err := initialize(configFile)
+	if err == nil {
+		err = internal.CheckWriteAccess(destinations, appConfig.DestinationConfigs(), !appConfig.Runtime.DryRunMode)
+	}
+	if err == nil {
+		err = internal.ExpandSyncSetGroupings(&appConfig, source)
+	}
 	if err != nil {
-		msg := fmt.Sprintf("Unable to load config, error: %s", err)
-		log.Println(msg)
-		alert.SendEmail(appConfig.Alert, msg)
-		return nil
+		log.Println(err)
+		alert.SendAlert(appConfig.Alert, alert.TemplateConfigError, alert.ErrorData{Error: err.Error()})
+		return results, nil
 	}
 
-	// Instantiate Source
-	var source internal.Source
-	switch appConfig.Source.Type {
-	case internal.SourceTypeRestAPI:
-		source, err = restapi.NewRestAPISource(appConfig.Source)
-	case internal.SourceTypeGoogleSheets:
-		source, err = google.NewGoogleSheetsSource(appConfig.Source)
-	default:
-		err = errors.New("unrecognized source type")
+	appConfig.Runtime.Alerter = internal.NewAlerter(appConfig, stateStore)
+	appConfig.Runtime.Hooks = &hooks
+	appConfig.Runtime.Results = results
+	var failures []string
+	var failuresMutex sync.Mutex
+	forEachSyncSet(appConfig, source, destinations, stateStore,
+		func(syncSetLogger *log.Logger, source internal.Source, destination internal.Destination,
+			config internal.AppConfig, syncSet internal.SyncSet) error {
+			err := internal.RunSyncSet(syncSetLogger, source, destination, config, syncSet, stateStore)
+			var thresholdErr *internal.FailureThresholdError
+			if errors.As(err, &thresholdErr) {
+				failuresMutex.Lock()
+				failures = append(failures, err.Error())
+				failuresMutex.Unlock()
+			}
+			return err
+		})
+	appConfig.Runtime.Alerter.Finish(alert.TemplateSyncErrors)
+
+	log.Printf("Sync results by sync set: %s", results.JSON())
+	log.Printf("Personnel sync completed at %s", time.Now().UTC().Format(time.RFC1123Z))
+	if len(failures) > 0 {
+		return results, fmt.Errorf("Sync failed:\n%s", strings.Join(failures, "\n"))
 	}
+	return results, nil
+}
 
+// RunPlan computes the changes for every sync set without applying them, and writes them to a signed plan file
+func RunPlan(configFile, planFile string) error {
+	log.SetOutput(os.Stdout)
+	log.SetFlags(0)
+	log.Printf("Personnel sync plan started at %s", time.Now().UTC().Format(time.RFC1123Z))
+
+	appConfig, source, destinations, stateStore, err := initialize(configFile)
+	if err == nil {
+		err = internal.CheckWriteAccess(destinations, appConfig.DestinationConfigs(), false)
+	}
 	if err != nil {
-		msg := fmt.Sprintf("Unable to initialize %s source, error: %s", appConfig.Source.Type, err)
-		log.Println(msg)
-		alert.SendEmail(appConfig.Alert, msg)
-		return nil
+		log.Println(err)
+		return err
+	}
+
+	plan := internal.NewPlan(appConfig)
+	if err := internal.ExpandSyncSetGroupings(&appConfig, source); err != nil {
+		log.Println(err)
+		return err
+	}
+	var planMutex sync.Mutex
+	errs := forEachSyncSet(appConfig, source, destinations, stateStore,
+		func(syncSetLogger *log.Logger, source internal.Source, destination internal.Destination,
+			config internal.AppConfig, syncSet internal.SyncSet) error {
+			planned, err := internal.PlanSyncSet(syncSetLogger, source, destination, config, syncSet, stateStore)
+			if err != nil {
+				return err
+			}
+			planMutex.Lock()
+			plan.SyncSets = append(plan.SyncSets, planned)
+			planMutex.Unlock()
+			return nil
+		})
+	if len(errs) > 0 {
+		return fmt.Errorf("plan not written due to error(s):\n%s", strings.Join(errs, "\n"))
+	}
+
+	if err := internal.WritePlan(planFile, plan, appConfig); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	log.Printf("Plan written to %s", planFile)
+	return nil
+}
+
+// RunApply applies the changes in a plan file written by RunPlan. Each sync set is planned again first, and is only
+// applied if the changes still match the plan.
+func RunApply(configFile, planFile string) error {
+	return RunApplyWithHooks(configFile, planFile, Hooks{})
+}
+
+// RunApplyWithHooks applies a plan like RunApply, and calls the hooks as it progresses
+func RunApplyWithHooks(configFile, planFile string, hooks Hooks) error {
+	log.SetOutput(os.Stdout)
+	log.SetFlags(0)
+	log.Printf("Personnel sync apply started at %s", time.Now().UTC().Format(time.RFC1123Z))
+
+	appConfig, source, destinations, stateStore, err := initialize(configFile)
+	if err == nil {
+		err = internal.CheckWriteAccess(destinations, appConfig.DestinationConfigs(), !appConfig.Runtime.DryRunMode)
+	}
+	if err != nil {
+		log.Println(err)
+		alert.SendAlert(appConfig.Alert, alert.TemplateConfigError, alert.ErrorData{Error: err.Error()})
+		return err
 	}
 
-	// Instantiate Destination
-	var destination internal.Destination
-	switch appConfig.Destination.Type {
-	case internal.DestinationTypeGoogleContacts:
-		destination, err = google.NewGoogleContactsDestination(appConfig.Destination)
-	case internal.DestinationTypeGoogleGroups:
-		destination, err = google.NewGoogleGroupsDestination(appConfig.Destination)
-	case internal.DestinationTypeGoogleSheets:
-		destination, err = google.NewGoogleSheetsDestination(appConfig.Destination)
-	case internal.DestinationTypeGoogleUsers:
-		destination, err = google.NewGoogleUsersDestination(appConfig.Destination)
-	case internal.DestinationTypeRestAPI:
-		destination, err = restapi.NewRestAPIDestination(appConfig.Destination)
-	case internal.DestinationTypeWebHelpDesk:
-		destination, err = webhelpdesk.NewWebHelpDeskDestination(appConfig.Destination)
-	default:
-		err = errors.New("unrecognized destination type")
+	plan, err := internal.ReadPlan(planFile, appConfig)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	if err := internal.ExpandSyncSetGroupings(&appConfig, source); err != nil {
+		log.Println(err)
+		alert.SendAlert(appConfig.Alert, alert.TemplateConfigError, alert.ErrorData{Error: err.Error()})
+		return err
 	}
 
+	appConfig.Runtime.Alerter = internal.NewAlerter(appConfig, stateStore)
+	appConfig.Runtime.Hooks = &hooks
+	appConfig.Runtime.Results = internal.NewRunResults()
+	errs := forEachSyncSet(appConfig, source, destinations, stateStore,
+		func(syncSetLogger *log.Logger, source internal.Source, destination internal.Destination,
+			config internal.AppConfig, syncSet internal.SyncSet) error {
+			planned, ok := plan.Find(syncSet.Name)
+			if !ok {
+				return errors.New("sync set is not in the plan")
+			}
+			return internal.ApplyPlannedSyncSet(syncSetLogger, source, destination, config, syncSet, stateStore,
+				planned)
+		})
+
+	appConfig.Runtime.Alerter.Finish(alert.TemplateApplyErrors)
+	log.Printf("Apply results by sync set: %s", appConfig.Runtime.Results.JSON())
+	if len(errs) > 0 {
+		return fmt.Errorf("Apply error(s):\n%s", strings.Join(errs, "\n"))
+	}
+
+	log.Printf("Personnel sync apply completed at %s", time.Now().UTC().Format(time.RFC1123Z))
+	return nil
+}
+
+// RunConfigDiff loads two config files, resolving their templates and manifests, and writes the differences from
+// the old config to the new one to stdout, as text or as JSON. Secrets in the configs are redacted.
+func RunConfigDiff(oldFile, newFile string, asJSON bool) error {
+	log.SetOutput(os.Stderr)
+	log.SetFlags(0)
+
+	oldConfig, err := internal.LoadConfig(oldFile)
 	if err != nil {
-		msg := fmt.Sprintf("Unable to initialize %s destination, error: %s", appConfig.Destination.Type, err)
-		log.Println(msg)
-		alert.SendEmail(appConfig.Alert, msg)
+		return fmt.Errorf("unable to load %s: %s", oldFile, err)
+	}
+	newConfig, err := internal.LoadConfig(newFile)
+	if err != nil {
+		return fmt.Errorf("unable to load %s: %s", newFile, err)
+	}
+
+	changes, err := internal.DiffConfigs(oldConfig, newConfig)
+	if err != nil {
+		return err
+	}
+
+	if !asJSON {
+		fmt.Print(internal.FormatConfigDiff(changes))
 		return nil
 	}
+	if changes == nil {
+		changes = []internal.ConfigChange{}
+	}
+	data, err := json.MarshalIndent(struct{ Changes []internal.ConfigChange }{changes}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// initialize loads the config and creates the source, destinations, and state store it describes. The destinations
+// are in the order of the config's DestinationConfigs.
+func initialize(configFile string) (internal.AppConfig, internal.Source, []internal.Destination, internal.StateStore,
+	error) {
+
+	appConfig, err := internal.LoadConfig(configFile)
+	if err != nil {
+		return appConfig, nil, nil, nil, fmt.Errorf("Unable to load config, error: %s", err)
+	}
 
-	maxNameLength := appConfig.MaxSyncSetNameLength()
-	var errors []string
+	stateStore, err := internal.NewStateStore(appConfig.State)
+	if err != nil {
+		return appConfig, nil, nil, nil,
+			fmt.Errorf("Unable to initialize %s state store, error: %s", appConfig.State.Type, err)
+	}
+
+	source, destinations, err := newAdapters(appConfig, stateStore)
+	if err != nil {
+		return appConfig, nil, nil, nil, err
+	}
+	return appConfig, source, destinations, stateStore, nil
+}
+
+// newAdapters creates the source and destinations that the config describes, and gives them the state store and
+// alert config if they use them. The destinations are in the order of the config's DestinationConfigs.
+func newAdapters(appConfig internal.AppConfig, stateStore internal.StateStore) (internal.Source,
+	[]internal.Destination, error) {
+
+	var source internal.Source
+	var err error
+	if len(appConfig.Sources) > 0 {
+		source, err = internal.NewMergedSource(appConfig.Sources, appConfig.SourceMerge)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Unable to initialize sources, error: %s", err)
+		}
+	} else {
+		source, err = internal.NewSource(appConfig.Source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Unable to initialize %s source, error: %s", appConfig.Source.Type, err)
+		}
+	}
+
+	var destinations []internal.Destination
+	for _, destinationConfig := range appConfig.DestinationConfigs() {
+		destination, err := internal.NewDestination(destinationConfig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Unable to initialize %s destination, error: %s", destinationConfig.Type, err)
+		}
+		destinations = append(destinations, destination)
+	}
+
+	if stateStore != nil {
+		adapters := []interface{}{source}
+		for _, destination := range destinations {
+			adapters = append(adapters, destination)
+		}
+		for _, adapter := range adapters {
+			if user, ok := adapter.(internal.StateStoreUser); ok {
+				user.SetStateStore(stateStore)
+			}
+		}
+	}
+
+	for _, destination := range destinations {
+		if user, ok := destination.(internal.AlertConfigUser); ok {
+			user.SetAlertConfig(appConfig.Alert)
+		}
+	}
+
+	return source, destinations, nil
+}
+
+// preloadSyncSets gives each destination that is a SyncSetPreloader the configuration of all of its sync sets
+func preloadSyncSets(destinations []internal.Destination, runs [][]internal.SyncSetDestination) {
+	for i, destination := range destinations {
+		preloader, ok := destination.(internal.SyncSetPreloader)
+		if !ok {
+			continue
+		}
+		var syncSetsJson []json.RawMessage
+		for _, syncSetRuns := range runs {
+			for _, run := range syncSetRuns {
+				if run.Index == i {
+					syncSetsJson = append(syncSetsJson, run.SyncSet.Destination)
+				}
+			}
+		}
+		if err := preloader.PreloadSyncSets(syncSetsJson); err != nil {
+			log.Printf("unable to preload sync sets: %s\n", err)
+		}
+	}
+}
 
-	// Iterate through SyncSets and process changes
-	for i, syncSet := range appConfig.SyncSets {
-		prefix := fmt.Sprintf("[%-*s] ", maxNameLength, syncSet.Name)
-		syncSetLogger := log.New(os.Stdout, prefix, 0)
-		syncSetLogger.Printf("(%v/%v) Beginning sync set", i+1, len(appConfig.SyncSets))
+// syncSetFunc is called by forEachSyncSet for each destination of each sync set
+type syncSetFunc func(syncSetLogger *log.Logger, source internal.Source, destination internal.Destination,
+	config internal.AppConfig, syncSet internal.SyncSet) error
 
-		// Apply SyncSet configs (excluding source/destination as appropriate)
-		err = source.ForSet(syncSet.Source)
+// forEachSyncSet configures the source for each sync set in turn, and then each of the sync set's destinations, and
+// calls fn for each destination. The source is listed once for all of the destinations of a sync set. It returns
+// the errors that occurred, and reports the outcome for each destination to the alerter.
+//
+// If the Runtime MaxConcurrentSyncSets is more than one, that many sync sets are run at the same time, each worker
+// with its own source and destinations, and fn must be safe to call from several goroutines. The sync sets are
+// divided among the workers before they start, so that each worker preloads its own sync sets. Sync sets that change
+// the same destination target are run one after another by the same worker. The log of each sync set is written
+// when it is done, so that the logs of sync sets that run at the same time are not interleaved.
+func forEachSyncSet(appConfig internal.AppConfig, source internal.Source, destinations []internal.Destination,
+	stateStore internal.StateStore, fn syncSetFunc) []string {
+
+	runner := syncSetRunner{
+		appConfig:     appConfig,
+		maxNameLength: appConfig.MaxSyncSetNameLength(),
+		alerter:       appConfig.GetAlerter(),
+		fn:            fn,
+	}
+	for _, syncSet := range appConfig.SyncSets {
+		runner.runs = append(runner.runs, appConfig.SyncSetDestinations(syncSet))
+		runner.total += len(runner.runs[len(runner.runs)-1])
+	}
+
+	chains := appConfig.SyncSetChains()
+	workers := appConfig.Runtime.MaxConcurrentSyncSets
+	if workers > len(chains) {
+		workers = len(chains)
+	}
+	if workers <= 1 {
+		preloadSyncSets(destinations, runner.runs)
+		for i := range appConfig.SyncSets {
+			runner.runSyncSet(i, source, destinations, os.Stdout)
+		}
+		return runner.errors
+	}
+
+	log.Printf("Running up to %v of %v sync sets at a time", workers, len(appConfig.SyncSets))
+
+	// the first worker uses the adapters that were already created, and each other worker creates its own
+	workerSources, workerDestinations := []internal.Source{source}, [][]internal.Destination{destinations}
+	for w := 1; w < workers; w++ {
+		workerSource, destinations, err := newAdapters(appConfig, stateStore)
 		if err != nil {
-			msg := fmt.Sprintf(`Error setting source set on syncSet "%s": %s`, syncSet.Name, err)
+			log.Printf("unable to start sync set worker %v: %s", w+1, err)
+			continue
+		}
+		workerSources = append(workerSources, workerSource)
+		workerDestinations = append(workerDestinations, destinations)
+	}
+
+	var wg sync.WaitGroup
+	for w, workerChains := range appConfig.WorkerChains(len(workerSources)) {
+		var workerRuns [][]internal.SyncSetDestination
+		for _, chain := range workerChains {
+			for _, i := range chain {
+				workerRuns = append(workerRuns, runner.runs[i])
+			}
+		}
+
+		wg.Add(1)
+		go func(workerSource internal.Source, destinations []internal.Destination, workerChains [][]int) {
+			defer wg.Done()
+			preloadSyncSets(destinations, workerRuns)
+			for _, chain := range workerChains {
+				for _, i := range chain {
+					var syncSetLog bytes.Buffer
+					runner.runSyncSet(i, workerSource, destinations, &syncSetLog)
+					runner.mutex.Lock()
+					_, _ = os.Stdout.Write(syncSetLog.Bytes())
+					runner.mutex.Unlock()
+				}
+			}
+		}(workerSources[w], workerDestinations[w], workerChains)
+	}
+	wg.Wait()
+
+	return runner.errors
+}
+
+// syncSetRunner runs the sync sets of forEachSyncSet, and collects their errors
+type syncSetRunner struct {
+	appConfig     internal.AppConfig
+	runs          [][]internal.SyncSetDestination
+	total         int
+	maxNameLength int
+	alerter       *internal.Alerter
+	fn            syncSetFunc
+
+	// mutex guards count and errors, and the writing of logs to stdout
+	mutex  sync.Mutex
+	count  int
+	errors []string
+}
+
+// runSyncSet runs the i-th sync set with the source and destinations, and writes its log to out
+func (r *syncSetRunner) runSyncSet(i int, source internal.Source, destinations []internal.Destination,
+	out io.Writer) {
+
+	syncSet := r.appConfig.SyncSets[i]
+
+	// Apply SyncSet configs (excluding source/destination as appropriate)
+	sourceErr := source.ForSet(syncSet.Source)
+	syncSetSource := source
+	if len(r.runs[i]) > 1 {
+		syncSetSource = internal.NewSharedSource(source, r.runs[i])
+	}
+
+	for _, run := range r.runs[i] {
+		r.mutex.Lock()
+		r.count++
+		count := r.count
+		r.mutex.Unlock()
+
+		var syncSetErrors []string
+		prefix := fmt.Sprintf("[%-*s] ", r.maxNameLength, run.SyncSet.Name)
+		syncSetLogger := log.New(out, prefix, 0)
+		syncSetLogger.Printf("(%v/%v) Beginning sync set", count, r.total)
+		run.Config.SyncSetStarted(run.SyncSet.Name)
+
+		if sourceErr != nil {
+			msg := fmt.Sprintf(`Error setting source set on syncSet "%s": %s`, run.SyncSet.Name, sourceErr)
 			syncSetLogger.Println(msg)
-			errors = append(errors, msg)
+			syncSetErrors = append(syncSetErrors, msg)
 		}
 
-		err = destination.ForSet(syncSet.Destination)
+		destination := destinations[run.Index]
+		err := destination.ForSet(run.SyncSet.Destination)
 		if err != nil {
-			msg := fmt.Sprintf(`Error setting destination set on syncSet "%s": %s`, syncSet.Name, err)
+			msg := fmt.Sprintf(`Error setting destination set on syncSet "%s": %s`, run.SyncSet.Name, err)
 			syncSetLogger.Println(msg)
-			errors = append(errors, msg)
+			syncSetErrors = append(syncSetErrors, msg)
 		}
 
-		if err := internal.RunSyncSet(syncSetLogger, source, destination, appConfig); err != nil {
-			msg := fmt.Sprintf(`Sync failed with error on syncSet "%s": %s`, syncSet.Name, err)
+		err = r.fn(syncSetLogger, syncSetSource, destination, run.Config, run.SyncSet)
+		if err != nil {
+			msg := fmt.Sprintf(`Sync failed with error on syncSet "%s": %s`, run.SyncSet.Name, err)
 			syncSetLogger.Println(msg)
-			errors = append(errors, msg)
+			syncSetErrors = append(syncSetErrors, msg)
+			alert.TriggerIncident(r.appConfig.Alert, run.SyncSet.Name, msg)
 		}
-	}
+		run.Config.SyncSetEnded(run.SyncSet.Name, err)
 
-	if len(errors) > 0 {
-		alert.SendEmail(appConfig.Alert, fmt.Sprintf("Sync error(s):\n%s", strings.Join(errors, "\n")))
+		if len(syncSetErrors) > 0 {
+			r.alerter.SyncSetFailed(run.SyncSet.Name, strings.Join(syncSetErrors, "\n"))
+		} else {
+			r.alerter.SyncSetSucceeded(run.SyncSet.Name)
+		}
+		r.mutex.Lock()
+		r.errors = append(r.errors, syncSetErrors...)
+		r.mutex.Unlock()
 	}
-
-	log.Printf("Personnel sync completed at %s", time.Now().UTC().Format(time.RFC1123Z))
-	return nil
 }
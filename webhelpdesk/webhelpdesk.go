@@ -7,12 +7,14 @@ import (
 	"io/ioutil"
 	"log/syslog"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 
 	"github.com/silinternational/personnel-sync/v5/internal"
+	"github.com/silinternational/personnel-sync/v5/negotiate"
 )
 
 const DefaultBatchSize = 50
@@ -20,6 +22,20 @@ const DefaultBatchDelaySeconds = 60
 const DefaultListClientsPageLimit = 100
 const ClientsAPIPath = "/ra/Clients"
 
+// DefaultCompareAttribute is the client attribute used as the compare value, unless CompareAttribute is set
+const DefaultCompareAttribute = "username"
+
+// DefaultUsernamePattern is the pattern of usernames that WebHelpDesk accepts, used to lint planned changes
+const DefaultUsernamePattern = `^[A-Za-z0-9._@\\-]+$`
+
+// DefaultFieldMaxLengths are the maximum lengths of Client fields used for validation in dry-run mode
+var DefaultFieldMaxLengths = map[string]int{
+	"firstName": 50,
+	"lastName":  50,
+	"email":     100,
+	"username":  50,
+}
+
 // In WebHelpDesk the basic user is called a "Client", so this is not an API Client
 type User struct {
 	ID        int    `json:"id,omitempty"`
@@ -27,6 +43,9 @@ type User struct {
 	LastName  string `json:"lastName"`
 	Email     string `json:"email"`
 	Username  string `json:"username"`
+
+	// Inactive is only sent if the enabled attribute is synced, so that the state is otherwise left as it is
+	Inactive *bool `json:"inactive,omitempty"`
 }
 
 type WebHelpDesk struct {
@@ -36,6 +55,40 @@ type WebHelpDesk struct {
 	ListClientsPageLimit int
 	BatchSize            int
 	BatchDelaySeconds    int
+	FieldMaxLengths      map[string]int
+	UsernamePattern      string
+	Retry                internal.RetryConfig
+
+	// CompareAttribute is the client attribute matched with the source compare value: username (the default), email,
+	// or id. Matching by username or id keeps clients from being created again when their email address changes.
+	CompareAttribute string
+
+	// DeactivateOnDelete sets clients to inactive when they are deleted from the source. WebHelpDesk clients cannot
+	// be deleted through the API, so deletes are skipped if this is not set.
+	DeactivateOnDelete bool
+
+	// Proxy is a SOCKS5 proxy for all requests, for a server that only allows a fixed egress host
+	Proxy internal.ProxyConfig
+
+	// WindowsAuth is NTLM or Kerberos authentication, for a server behind IIS with Windows authentication
+	WindowsAuth negotiate.Config
+
+	// VerifyTLS checks the server certificate, unless it is set to false for a server with a self-signed certificate
+	VerifyTLS *bool
+
+	// TLS is a client certificate and CA certificates, such as the private CA of the WebHelpDesk server
+	TLS internal.TLSConfig
+
+	client          *http.Client
+	usernamePattern *regexp.Regexp
+}
+
+func init() {
+	internal.RegisterDestination(internal.DestinationTypeWebHelpDesk, NewWebHelpDeskDestination)
+
+	internal.DescribeDestination(internal.DestinationTypeWebHelpDesk, internal.AdapterConfig{
+		ExtraJSON: []interface{}{WebHelpDesk{}},
+	})
 }
 
 func NewWebHelpDeskDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
@@ -58,6 +111,30 @@ func NewWebHelpDeskDestination(destinationConfig internal.DestinationConfig) (in
 		webHelpDesk.ListClientsPageLimit = DefaultListClientsPageLimit
 	}
 
+	if webHelpDesk.FieldMaxLengths == nil {
+		webHelpDesk.FieldMaxLengths = DefaultFieldMaxLengths
+	}
+
+	switch webHelpDesk.CompareAttribute {
+	case "":
+		webHelpDesk.CompareAttribute = DefaultCompareAttribute
+	case "username", "email", "id":
+	default:
+		return &WebHelpDesk{}, fmt.Errorf("invalid CompareAttribute %q, must be username, email, or id",
+			webHelpDesk.CompareAttribute)
+	}
+
+	if webHelpDesk.UsernamePattern == "" {
+		webHelpDesk.UsernamePattern = DefaultUsernamePattern
+	}
+	if webHelpDesk.usernamePattern, err = regexp.Compile(webHelpDesk.UsernamePattern); err != nil {
+		return &WebHelpDesk{}, fmt.Errorf("invalid UsernamePattern: %s", err)
+	}
+
+	if webHelpDesk.client, err = webHelpDesk.newHTTPClient(); err != nil {
+		return &WebHelpDesk{}, err
+	}
+
 	return &webHelpDesk, nil
 }
 
@@ -100,8 +177,7 @@ func (w *WebHelpDesk) ListUsers(desiredAttrs []string) ([]internal.Person, error
 
 	var users []internal.Person
 	for _, nextClient := range allClients {
-		users = append(users, internal.Person{
-			CompareValue: nextClient.Username,
+		person := internal.Person{
 			Attributes: map[string]string{
 				"id":        strconv.Itoa(nextClient.ID),
 				"email":     nextClient.Email,
@@ -109,7 +185,12 @@ func (w *WebHelpDesk) ListUsers(desiredAttrs []string) ([]internal.Person, error
 				"lastName":  nextClient.LastName,
 				"username":  nextClient.Username,
 			},
-		})
+		}
+		person.CompareValue = person.Attributes[w.CompareAttribute]
+		if nextClient.Inactive != nil {
+			person.Attributes["enabled"] = strconv.FormatBool(!*nextClient.Inactive)
+		}
+		users = append(users, person)
 	}
 
 	return users, nil
@@ -137,7 +218,23 @@ func (w *WebHelpDesk) ApplyChangeSet(
 		batchTimer.WaitOnBatch()
 	}
 
-	// WHD API does not support deactivating or deleting users
+	// WHD API does not support deleting users, so they are deactivated instead if enabled
+	if w.DeactivateOnDelete {
+		for _, dp := range changes.Delete {
+			if dp.Attributes["enabled"] == "false" {
+				continue // already inactive
+			}
+			wg.Add(1)
+			go w.DeactivateUser(dp, &results.Deleted, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	} else if len(changes.Delete) > 0 {
+		eventLog <- internal.EventLogItem{
+			Level: syslog.LOG_NOTICE,
+			Message: fmt.Sprintf("%v clients not in the source are not deactivated, because DeactivateOnDelete "+
+				"is not set", len(changes.Delete)),
+		}
+	}
 
 	wg.Wait()
 
@@ -156,7 +253,7 @@ func (w *WebHelpDesk) CreateUser(
 	if err != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ERR,
-			Message: fmt.Sprintf("unable to create user, unable to convert string to int, error: %s", err.Error())}
+			Message: fmt.Sprintf("unable to create user, unable to convert person to client, error: %s", err.Error())}
 		return
 	}
 
@@ -198,7 +295,7 @@ func (w *WebHelpDesk) UpdateUser(
 	if err != nil {
 		eventLog <- internal.EventLogItem{
 			Level:   syslog.LOG_ERR,
-			Message: fmt.Sprintf("unable to update user, unable to convert string to int, error: %s", err.Error())}
+			Message: fmt.Sprintf("unable to update user, unable to convert person to client, error: %s", err.Error())}
 		return
 	}
 
@@ -221,20 +318,146 @@ func (w *WebHelpDesk) UpdateUser(
 		return
 	}
 
+	eventLog <- internal.UpdateEvent("UpdateUser", person.CompareValue, person)
+
+	atomic.AddUint64(counter, 1)
+}
+
+// DeactivateUser sets a client to inactive, keeping the rest of its details as they were listed
+func (w *WebHelpDesk) DeactivateUser(
+	person internal.Person,
+	counter *uint64,
+	wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	if person.ID == "" {
+		person.ID = person.Attributes["id"]
+	}
+	person.Attributes = copyAttributes(person.Attributes)
+	person.Attributes["enabled"] = "false"
+
+	client, err := getWebHelpDeskClientFromPerson(person)
+	if err != nil || client.ID == 0 {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to deactivate user %s, invalid id %q", person.CompareValue, person.ID)}
+		return
+	}
+
+	jsonBody, err := json.Marshal(client)
+	if err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to deactivate user, unable to marshal json, error: %s", err.Error())}
+		return
+	}
+
+	updatePath := fmt.Sprintf("%s/%v", ClientsAPIPath, client.ID)
+	if _, err = w.makeHttpRequest(updatePath, http.MethodPut, string(jsonBody), map[string]string{}); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:   syslog.LOG_ERR,
+			Message: fmt.Sprintf("unable to deactivate user %s, error calling api: %s", person.CompareValue, err)}
+		return
+	}
+
 	eventLog <- internal.EventLogItem{
 		Level:   syslog.LOG_INFO,
-		Message: "UpdateUser " + person.CompareValue,
+		Message: "DeactivateUser " + person.CompareValue,
 	}
 
 	atomic.AddUint64(counter, 1)
 }
 
+func copyAttributes(attributes map[string]string) map[string]string {
+	c := make(map[string]string, len(attributes)+1)
+	for key, value := range attributes {
+		c[key] = value
+	}
+	return c
+}
+
+// ValidateChangeSet checks the creates and updates locally for missing usernames, invalid IDs, and values that are
+// too long for WebHelpDesk
+func (w *WebHelpDesk) ValidateChangeSet(changes internal.ChangeSet) map[string]string {
+	failures := map[string]string{}
+
+	for _, person := range changes.Create {
+		if msg := w.validatePerson(person); msg != "" {
+			failures[person.CompareValue] = msg
+		}
+	}
+
+	for _, person := range changes.Update {
+		if _, err := getWebHelpDeskClientFromPerson(person); err != nil {
+			failures[person.CompareValue] = fmt.Sprintf("invalid id %q", person.ID)
+			continue
+		}
+		if msg := w.validatePerson(person); msg != "" {
+			failures[person.CompareValue] = msg
+		}
+	}
+
+	return failures
+}
+
+// LintRules checks usernames against the UsernamePattern and email addresses for a valid format
+func (w *WebHelpDesk) LintRules() []internal.LintRule {
+	return []internal.LintRule{
+		{Attribute: "username", Pattern: w.usernamePattern,
+			Description: "a username matching " + w.UsernamePattern},
+		{Attribute: "email", Pattern: internal.EmailAddressPattern, Description: "an email address"},
+	}
+}
+
+func (w *WebHelpDesk) validatePerson(person internal.Person) string {
+	if person.Attributes["username"] == "" {
+		return "username is empty"
+	}
+
+	for field, maxLength := range w.FieldMaxLengths {
+		if length := len([]rune(person.Attributes[field])); length > maxLength {
+			return fmt.Sprintf("%s is %d characters, the maximum is %d", field, length, maxLength)
+		}
+	}
+
+	return ""
+}
+
+// newHTTPClient returns a client that connects through the Proxy, uses the TLS certificates, and does the
+// WindowsAuth, if they are configured
+func (w *WebHelpDesk) newHTTPClient() (*http.Client, error) {
+	tr, err := w.Proxy.Transport()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := w.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig.InsecureSkipVerify = w.VerifyTLS != nil && !*w.VerifyTLS
+	tr.TLSClientConfig = tlsConfig
+
+	roundTripper, err := w.WindowsAuth.RoundTripper(tr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WindowsAuth: %s", err)
+	}
+	return &http.Client{Transport: roundTripper}, nil
+}
+
 func (w *WebHelpDesk) makeHttpRequest(path, method, body string, additionalQueryParams map[string]string) ([]byte, error) {
 	// Create client and request
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	client := w.client
+	if client == nil {
+		var err error
+		if client, err = w.newHTTPClient(); err != nil {
+			return []byte{}, err
+		}
 	}
-	client := http.Client{Transport: tr}
 	req, err := http.NewRequest(method, w.URL+path, strings.NewReader(body))
 	if err != nil {
 		return []byte{}, err
@@ -250,7 +473,7 @@ func (w *WebHelpDesk) makeHttpRequest(path, method, body string, additionalQuery
 	req.URL.RawQuery = q.Encode()
 
 	// do request
-	resp, err := client.Do(req)
+	resp, err := w.Retry.Do(client, req)
 	if err != nil {
 		return []byte{}, err
 	}
@@ -261,7 +484,8 @@ func (w *WebHelpDesk) makeHttpRequest(path, method, body string, additionalQuery
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode > 204 {
-		return []byte{}, fmt.Errorf("error returned from API. status: %v, body: %s", resp.StatusCode, responseBody)
+		return []byte{}, internal.NewStatusError(resp.StatusCode, resp.Header.Get("Retry-After"),
+			fmt.Errorf("error returned from API. status: %v, body: %s", resp.StatusCode, responseBody))
 	}
 
 	return responseBody, nil
@@ -275,6 +499,15 @@ func getWebHelpDeskClientFromPerson(person internal.Person) (User, error) {
 		Email:     person.Attributes["email"],
 	}
 
+	if value, ok := person.Attributes["enabled"]; ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return User{}, fmt.Errorf("invalid enabled value %q", value)
+		}
+		inactive := !enabled
+		newClient.Inactive = &inactive
+	}
+
 	// if id attribute isn't present, default to a zero
 	if person.ID != "" {
 		intId, err := strconv.Atoi(person.ID)
@@ -2,12 +2,16 @@ package webhelpdesk
 
 import (
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"log"
+	"log/syslog"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/silinternational/personnel-sync/v5/internal"
@@ -326,3 +330,284 @@ func TestWebHelpDesk_CreateUser(t *testing.T) {
 		log.Println("Errors creating user:")
 	}
 }
+
+func TestWebHelpDesk_ApplyChangeSet_Delete(t *testing.T) {
+	var requests []string
+	var bodies []User
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		var client User
+		_ = json.NewDecoder(req.Body).Decode(&client)
+		bodies = append(bodies, client)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	deletes := []internal.Person{
+		{CompareValue: "c1", Attributes: map[string]string{"id": "1", "username": "c1", "email": "c1@c1.com",
+			"firstName": "C", "lastName": "One", "enabled": "true"}},
+		{CompareValue: "c2", Attributes: map[string]string{"id": "2", "username": "c2", "enabled": "false"}},
+		{CompareValue: "c3", Attributes: map[string]string{"id": "x", "username": "c3"}},
+	}
+
+	tests := []struct {
+		name         string
+		deactivate   bool
+		wantRequests []string
+		wantDeleted  uint64
+		wantLevels   []syslog.Priority
+	}{
+		{
+			name:        "deletes skipped",
+			wantLevels:  []syslog.Priority{syslog.LOG_NOTICE},
+			wantDeleted: 0,
+		},
+		{
+			name:         "deactivate",
+			deactivate:   true,
+			wantRequests: []string{"PUT /ra/Clients/1"},
+			wantDeleted:  1,
+			wantLevels:   []syslog.Priority{syslog.LOG_ERR, syslog.LOG_INFO},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, bodies = nil, nil
+			whd := &WebHelpDesk{URL: server.URL, BatchSize: 10, BatchDelaySeconds: 1, DeactivateOnDelete: tt.deactivate}
+
+			eventLog := make(chan internal.EventLogItem, 10)
+			results := whd.ApplyChangeSet(internal.ChangeSet{Delete: deletes}, eventLog)
+			close(eventLog)
+
+			var levels []syslog.Priority
+			for event := range eventLog {
+				levels = append(levels, event.Level)
+			}
+			sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+
+			if results.Deleted != tt.wantDeleted {
+				t.Errorf("Deleted = %v, want %v", results.Deleted, tt.wantDeleted)
+			}
+			if !reflect.DeepEqual(requests, tt.wantRequests) {
+				t.Errorf("requests = %v, want %v", requests, tt.wantRequests)
+			}
+			if !reflect.DeepEqual(levels, tt.wantLevels) {
+				t.Errorf("event levels = %v, want %v", levels, tt.wantLevels)
+			}
+			if len(bodies) == 1 {
+				inactive := true
+				want := User{ID: 1, FirstName: "C", LastName: "One", Email: "c1@c1.com", Username: "c1",
+					Inactive: &inactive}
+				if !reflect.DeepEqual(bodies[0], want) {
+					t.Errorf("body = %+v, want %+v", bodies[0], want)
+				}
+			}
+		})
+	}
+	if deletes[0].Attributes["enabled"] != "true" {
+		t.Error("ApplyChangeSet() modified the attributes of a deleted person")
+	}
+}
+
+func TestWebHelpDesk_ValidateChangeSet(t *testing.T) {
+	whd, err := NewWebHelpDeskDestination(internal.DestinationConfig{ExtraJSON: json.RawMessage(`{}`)})
+	if err != nil {
+		t.Fatalf("Failed to get new whd client, error: %s", err)
+	}
+
+	changes := internal.ChangeSet{
+		Create: []internal.Person{
+			{CompareValue: "ok", Attributes: map[string]string{"username": "ok", "firstName": "Ok"}},
+			{CompareValue: "nousername", Attributes: map[string]string{"firstName": "No"}},
+			{CompareValue: "long", Attributes: map[string]string{"username": "long", "lastName": strings.Repeat("x", 51)}},
+		},
+		Update: []internal.Person{
+			{CompareValue: "badid", ID: "abc", Attributes: map[string]string{"username": "badid"}},
+		},
+	}
+
+	got := whd.(internal.ChangeSetValidator).ValidateChangeSet(changes)
+	want := map[string]string{
+		"nousername": "username is empty",
+		"long":       "lastName is 51 characters, the maximum is 50",
+		"badid":      `invalid id "abc"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ValidateChangeSet() = %v, want %v", got, want)
+	}
+}
+
+func TestWebHelpDesk_LintRules(t *testing.T) {
+	whd, err := NewWebHelpDeskDestination(internal.DestinationConfig{ExtraJSON: json.RawMessage(`{}`)})
+	if err != nil {
+		t.Fatalf("Failed to get new whd client, error: %s", err)
+	}
+	rules := whd.(internal.AttributeLinter).LintRules()
+
+	tests := []struct {
+		attribute string
+		value     string
+		valid     bool
+	}{
+		{attribute: "username", value: "jane.doe", valid: true},
+		{attribute: "username", value: `CORP\jane_doe-2`, valid: true},
+		{attribute: "username", value: "jane doe"},
+		{attribute: "username", value: "jané"},
+		{attribute: "email", value: "jane@example.org", valid: true},
+		{attribute: "email", value: "jane@example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			valid := true
+			for _, rule := range rules {
+				if rule.Attribute == tt.attribute && !rule.Pattern.MatchString(tt.value) {
+					valid = false
+				}
+			}
+			if valid != tt.valid {
+				t.Errorf("%s %q valid = %v, want %v", tt.attribute, tt.value, valid, tt.valid)
+			}
+		})
+	}
+
+	if _, err := NewWebHelpDeskDestination(internal.DestinationConfig{
+		ExtraJSON: json.RawMessage(`{"UsernamePattern": "["}`)}); err == nil {
+		t.Error("an invalid UsernamePattern did not return an error")
+	}
+}
+
+func Test_getWebHelpDeskClientFromPerson(t *testing.T) {
+	tests := []struct {
+		name    string
+		person  internal.Person
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "enabled not synced",
+			person: internal.Person{ID: "1", Attributes: map[string]string{"username": "jane"}},
+			want:   `{"id":1,"firstName":"","lastName":"","email":"","username":"jane"}`,
+		},
+		{
+			name:   "enabled",
+			person: internal.Person{Attributes: map[string]string{"username": "jane", "enabled": "true"}},
+			want:   `{"firstName":"","lastName":"","email":"","username":"jane","inactive":false}`,
+		},
+		{
+			name:   "disabled",
+			person: internal.Person{Attributes: map[string]string{"username": "jane", "enabled": "false"}},
+			want:   `{"firstName":"","lastName":"","email":"","username":"jane","inactive":true}`,
+		},
+		{
+			name:    "invalid enabled",
+			person:  internal.Person{Attributes: map[string]string{"username": "jane", "enabled": "Active"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := getWebHelpDeskClientFromPerson(tt.person)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getWebHelpDeskClientFromPerson() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, _ := json.Marshal(client)
+			if string(got) != tt.want {
+				t.Errorf("getWebHelpDeskClientFromPerson() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebHelpDesk_VerifyTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/ra/Clients/500" {
+			http.Error(w, "database unavailable", http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	verify, skip := true, false
+
+	tests := []struct {
+		name    string
+		whd     WebHelpDesk
+		path    string
+		wantErr string
+	}{
+		{name: "verified by default", wantErr: "certificate"},
+		{name: "verified", whd: WebHelpDesk{VerifyTLS: &verify}, wantErr: "certificate"},
+		{name: "not verified", whd: WebHelpDesk{VerifyTLS: &skip}},
+		{name: "CA certificate", whd: WebHelpDesk{TLS: internal.TLSConfig{CACert: internal.PEMSource{PEM: caPEM}}}},
+		{name: "error status", whd: WebHelpDesk{VerifyTLS: &skip}, path: "/ra/Clients/500",
+			wantErr: "status: 500, body: database unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			whd := tt.whd
+			whd.URL = server.URL
+			whd.Retry = internal.RetryConfig{MaxAttempts: 1}
+			client, err := whd.newHTTPClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+			whd.client = client
+
+			path := tt.path
+			if path == "" {
+				path = ClientsAPIPath
+			}
+			_, err = whd.makeHttpRequest(path, http.MethodGet, "", map[string]string{})
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("makeHttpRequest() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("makeHttpRequest() error = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebHelpDesk_CompareAttribute(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_ = json.NewEncoder(w).Encode([]User{{ID: 7, Email: "jane@new.example.org", Username: "jdoe"}})
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		compareAttribute string
+		want             string
+		wantErr          bool
+	}{
+		{compareAttribute: "", want: "jdoe"},
+		{compareAttribute: "username", want: "jdoe"},
+		{compareAttribute: "email", want: "jane@new.example.org"},
+		{compareAttribute: "id", want: "7"},
+		{compareAttribute: "firstName", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.compareAttribute, func(t *testing.T) {
+			extraJSON := fmt.Sprintf(`{"URL": %q, "CompareAttribute": %q}`, server.URL, tt.compareAttribute)
+			whd, err := NewWebHelpDeskDestination(internal.DestinationConfig{ExtraJSON: []byte(extraJSON)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewWebHelpDeskDestination() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			people, err := whd.ListUsers(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(people) != 1 || people[0].CompareValue != tt.want {
+				t.Errorf("ListUsers() = %+v, want compare value %q", people, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/syslog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+const (
+	DefaultBatchSize         = 10
+	DefaultBatchDelaySeconds = 1
+
+	EventCreate = "create"
+	EventUpdate = "update"
+	EventDelete = "delete"
+
+	// SignatureHeader holds the HMAC-SHA256 of the request body, keyed with the Secret, as sha256=<hex>
+	SignatureHeader = "X-Personnel-Sync-Signature"
+
+	// EventHeader holds the event of the request, create, update, or delete
+	EventHeader = "X-Personnel-Sync-Event"
+)
+
+// Webhook is a notify-only destination. Each change is POSTed to a webhook URL, so that other systems can react
+// to personnel changes without personnel-sync managing them. The people that have been notified are kept in the
+// state store, which is required, so that a person is only sent again when they change.
+type Webhook struct {
+	// URL receives the changes of every sync set that does not set its own
+	URL string
+
+	// Secret is the key for the HMAC-SHA256 signature of each request. If it is empty, requests are not signed.
+	Secret string
+
+	// Headers are added to every request, for example for an API key
+	Headers map[string]string
+
+	// BatchSize changes are sent every BatchDelaySeconds
+	BatchSize         int
+	BatchDelaySeconds int
+
+	Retry internal.RetryConfig
+
+	// Proxy is a SOCKS5 proxy for all requests
+	Proxy internal.ProxyConfig
+
+	// TLS is a client certificate and CA certificates for the webhook server
+	TLS internal.TLSConfig
+
+	WebhookSyncSet WebhookSyncSet
+	client         *http.Client
+	stateStore     internal.StateStore
+
+	// notified are the people last sent for the sync set, by lowercase compare value
+	notified      map[string]internal.Person
+	notifiedMutex sync.Mutex
+}
+
+// WebhookSyncSet is the configuration of a sync set
+type WebhookSyncSet struct {
+	// Name identifies the sync set's record of notified people in the state store. It must be unique.
+	Name string
+
+	// URL overrides the Webhook URL for the sync set
+	URL string
+
+	DisableAdd    bool
+	DisableUpdate bool
+	DisableDelete bool
+}
+
+// Event is the body of a webhook request
+type Event struct {
+	Event        string            `json:"event"`
+	SyncSet      string            `json:"syncSet"`
+	CompareValue string            `json:"compareValue"`
+	Attributes   map[string]string `json:"attributes"`
+	Timestamp    time.Time         `json:"timestamp"`
+}
+
+func init() {
+	internal.RegisterDestination(internal.DestinationTypeWebhook, NewWebhookDestination)
+
+	internal.DescribeDestination(internal.DestinationTypeWebhook, internal.AdapterConfig{
+		ExtraJSON: []interface{}{Webhook{}},
+		SyncSet:   WebhookSyncSet{},
+	})
+}
+
+// NewWebhookDestination unmarshals the destinationConfig's ExtraJSON into a Webhook struct
+func NewWebhookDestination(destinationConfig internal.DestinationConfig) (internal.Destination, error) {
+	var w Webhook
+	if err := json.Unmarshal(destinationConfig.ExtraJSON, &w); err != nil {
+		return &Webhook{}, err
+	}
+
+	if w.BatchSize <= 0 {
+		w.BatchSize = DefaultBatchSize
+	}
+	if w.BatchDelaySeconds <= 0 {
+		w.BatchDelaySeconds = DefaultBatchDelaySeconds
+	}
+	var err error
+	if w.client, err = internal.NewHTTPClient(time.Minute, w.Proxy, w.TLS); err != nil {
+		return &Webhook{}, err
+	}
+
+	return &w, nil
+}
+
+// SetStateStore sets the state store that keeps the people that have been notified
+func (w *Webhook) SetStateStore(stateStore internal.StateStore) {
+	w.stateStore = stateStore
+}
+
+func (w *Webhook) ForSet(syncSetJson json.RawMessage) error {
+	var syncSetConfig WebhookSyncSet
+	if err := json.Unmarshal(syncSetJson, &syncSetConfig); err != nil {
+		return err
+	}
+
+	if syncSetConfig.Name == "" {
+		return errors.New("Name missing from sync set json")
+	}
+	if syncSetConfig.URL == "" {
+		syncSetConfig.URL = w.URL
+	}
+	if syncSetConfig.URL == "" {
+		return fmt.Errorf("URL is required for Webhook sync set %s", syncSetConfig.Name)
+	}
+
+	w.WebhookSyncSet = syncSetConfig
+	return nil
+}
+
+// ListUsers returns the people that were last sent for the sync set, as recorded in the state store
+func (w *Webhook) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+	if w.stateStore == nil {
+		return nil, errors.New("a state store is required for the Webhook destination")
+	}
+
+	var stored []internal.Person
+	if _, err := w.stateStore.Load(w.stateKey(), &stored); err != nil {
+		return nil, fmt.Errorf("unable to load the people notified for %s: %s", w.WebhookSyncSet.Name, err)
+	}
+
+	w.notified = map[string]internal.Person{}
+	people := make([]internal.Person, 0, len(stored))
+	for _, person := range stored {
+		w.notified[strings.ToLower(person.CompareValue)] = person
+
+		attributes := map[string]string{}
+		for _, attr := range desiredAttrs {
+			if value, ok := person.Attributes[attr]; ok {
+				attributes[attr] = value
+			}
+		}
+		people = append(people, internal.Person{CompareValue: person.CompareValue, Attributes: attributes})
+	}
+
+	return people, nil
+}
+
+func (w *Webhook) ApplyChangeSet(changes internal.ChangeSet,
+	eventLog chan<- internal.EventLogItem) internal.ChangeResults {
+
+	if w.notified == nil {
+		w.notified = map[string]internal.Person{}
+	}
+
+	var results internal.ChangeResults
+	var wg sync.WaitGroup
+	batchTimer := internal.NewBatchTimer(w.BatchSize, w.BatchDelaySeconds)
+
+	if !w.WebhookSyncSet.DisableAdd {
+		for _, person := range changes.Create {
+			wg.Add(1)
+			go w.notify(EventCreate, person, &results.Created, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	if !w.WebhookSyncSet.DisableUpdate {
+		for _, person := range changes.Update {
+			wg.Add(1)
+			go w.notify(EventUpdate, person, &results.Updated, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	if !w.WebhookSyncSet.DisableDelete {
+		for _, person := range changes.Delete {
+			wg.Add(1)
+			go w.notify(EventDelete, person, &results.Deleted, &wg, eventLog)
+			batchTimer.WaitOnBatch()
+		}
+	}
+
+	wg.Wait()
+
+	if err := w.saveNotified(); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message: fmt.Sprintf("unable to save the people notified for %s, they will be sent again: %s",
+				w.WebhookSyncSet.Name, err)}
+	}
+
+	return results
+}
+
+// notify sends an event for a person, and records it so that it is not sent again. A person whose event could not
+// be sent is not recorded, so the change is sent on the next run.
+func (w *Webhook) notify(event string, person internal.Person, counter *uint64, wg *sync.WaitGroup,
+	eventLog chan<- internal.EventLogItem) {
+
+	defer wg.Done()
+
+	if err := w.send(event, person); err != nil {
+		eventLog <- internal.EventLogItem{
+			Level:    syslog.LOG_ERR,
+			Category: internal.ClassifyError(err),
+			Message:  fmt.Sprintf("unable to send %s event for %s: %s", event, person.CompareValue, err)}
+		return
+	}
+
+	w.notifiedMutex.Lock()
+	key := strings.ToLower(person.CompareValue)
+	switch event {
+	case EventCreate:
+		w.notified[key] = internal.Person{CompareValue: person.CompareValue, Attributes: person.Attributes}
+	case EventUpdate:
+		notified := w.notified[key]
+		attributes := map[string]string{}
+		for name, value := range notified.Attributes {
+			attributes[name] = value
+		}
+		for name, value := range person.Attributes {
+			attributes[name] = value
+		}
+		w.notified[key] = internal.Person{CompareValue: person.CompareValue, Attributes: attributes}
+	case EventDelete:
+		delete(w.notified, key)
+	}
+	w.notifiedMutex.Unlock()
+
+	eventLog <- internal.EventLogItem{
+		Level:   syslog.LOG_INFO,
+		Message: fmt.Sprintf("Send %s event for %s", event, person.CompareValue),
+	}
+	atomic.AddUint64(counter, 1)
+}
+
+func (w *Webhook) saveNotified() error {
+	if w.stateStore == nil {
+		return errors.New("no state store is configured")
+	}
+	people := make([]internal.Person, 0, len(w.notified))
+	for _, person := range w.notified {
+		people = append(people, person)
+	}
+	sort.Slice(people, func(i, j int) bool {
+		return strings.ToLower(people[i].CompareValue) < strings.ToLower(people[j].CompareValue)
+	})
+	return w.stateStore.Save(w.stateKey(), people)
+}
+
+func (w *Webhook) stateKey() string {
+	return "webhook/" + w.WebhookSyncSet.Name
+}
+
+func (w *Webhook) send(event string, person internal.Person) error {
+	body, err := json.Marshal(Event{
+		Event:        event,
+		SyncSet:      w.WebhookSyncSet.Name,
+		CompareValue: person.CompareValue,
+		Attributes:   person.Attributes,
+		Timestamp:    time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to marshal event: %s", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.WebhookSyncSet.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range w.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(body, w.Secret))
+	}
+
+	resp, err := w.Retry.Do(w.client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read http response body: %s", err)
+	}
+	if resp.StatusCode >= 300 {
+		return internal.NewStatusError(resp.StatusCode, resp.Header.Get("Retry-After"),
+			fmt.Errorf("status: %d, body: %s", resp.StatusCode, respBody))
+	}
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of a request body, for a receiver to check the SignatureHeader
+func Sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
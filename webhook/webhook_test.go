@@ -0,0 +1,169 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/syslog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+func TestWebhook(t *testing.T) {
+	var mutex sync.Mutex
+	var events []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != "sha256="+Sign(body, "s3cret") || r.Header.Get("X-Api-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Error(err)
+		}
+		if event.Event != r.Header.Get(EventHeader) || event.SyncSet != "staff" {
+			t.Errorf("event = %+v, %s header = %s", event, EventHeader, r.Header.Get(EventHeader))
+		}
+		if event.CompareValue == "broken@example.org" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mutex.Lock()
+		events = append(events, event.Event+" "+event.CompareValue+" "+event.Attributes["name"])
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	dest, err := NewWebhookDestination(internal.DestinationConfig{ExtraJSON: json.RawMessage(`{"URL":"` +
+		server.URL + `","Secret":"s3cret","Headers":{"X-Api-Key":"key"},"Retry":{"MaxAttempts":1}}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook := dest.(*Webhook)
+	if _, err := webhook.ListUsers(nil); err == nil {
+		t.Error("ListUsers() without a state store did not return an error")
+	}
+	webhook.SetStateStore(&internal.MemoryStateStore{})
+	if err := webhook.ForSet(json.RawMessage(`{"Name":"staff"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := []struct {
+		name         string
+		changes      internal.ChangeSet
+		wantResults  internal.ChangeResults
+		wantErrors   int
+		wantEvents   []string
+		wantNotified []internal.Person
+	}{
+		{
+			name: "create",
+			changes: internal.ChangeSet{Create: []internal.Person{
+				{CompareValue: "ann@example.org", Attributes: map[string]string{"name": "Ann"}},
+				{CompareValue: "bob@example.org", Attributes: map[string]string{"name": "Bob"}},
+				{CompareValue: "broken@example.org", Attributes: map[string]string{"name": "Broken"}},
+			}},
+			wantResults: internal.ChangeResults{Created: 2},
+			wantErrors:  1,
+			wantEvents:  []string{"create ann@example.org Ann", "create bob@example.org Bob"},
+			wantNotified: []internal.Person{
+				{CompareValue: "ann@example.org", Attributes: map[string]string{"name": "Ann"}},
+				{CompareValue: "bob@example.org", Attributes: map[string]string{"name": "Bob"}},
+			},
+		},
+		{
+			name: "update and delete",
+			changes: internal.ChangeSet{
+				Update: []internal.Person{{CompareValue: "ann@example.org", Attributes: map[string]string{"name": "Anne"}}},
+				Delete: []internal.Person{{CompareValue: "bob@example.org", Attributes: map[string]string{"name": "Bob"}}},
+			},
+			wantResults: internal.ChangeResults{Updated: 1, Deleted: 1},
+			wantEvents:  []string{"delete bob@example.org Bob", "update ann@example.org Anne"},
+			wantNotified: []internal.Person{
+				{CompareValue: "ann@example.org", Attributes: map[string]string{"name": "Anne"}},
+			},
+		},
+	}
+	for _, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			events = nil
+			if _, err := webhook.ListUsers([]string{"name"}); err != nil {
+				t.Fatal(err)
+			}
+
+			eventLog := make(chan internal.EventLogItem, 10)
+			results := webhook.ApplyChangeSet(run.changes, eventLog)
+			close(eventLog)
+			errors := 0
+			for msg := range eventLog {
+				if msg.Level <= syslog.LOG_ERR {
+					errors++
+				}
+			}
+
+			if !reflect.DeepEqual(results, run.wantResults) || errors != run.wantErrors {
+				t.Errorf("results = %+v with %v errors, want %+v with %v", results, errors, run.wantResults,
+					run.wantErrors)
+			}
+			sort.Strings(events)
+			if !reflect.DeepEqual(events, run.wantEvents) {
+				t.Errorf("events = %v, want %v", events, run.wantEvents)
+			}
+			notified, err := webhook.ListUsers([]string{"name"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(notified, run.wantNotified) {
+				t.Errorf("ListUsers() = %+v, want %+v", notified, run.wantNotified)
+			}
+		})
+	}
+}
+
+func TestWebhook_ForSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		setJSON string
+		wantURL string
+		wantErr string
+	}{
+		{name: "default URL", url: "https://a.example.org", setJSON: `{"Name":"staff"}`,
+			wantURL: "https://a.example.org"},
+		{name: "sync set URL", url: "https://a.example.org", setJSON: `{"Name":"staff","URL":"https://b.example.org"}`,
+			wantURL: "https://b.example.org"},
+		{name: "no name", url: "https://a.example.org", setJSON: `{}`, wantErr: "Name"},
+		{name: "no URL", setJSON: `{"Name":"staff"}`, wantErr: "URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, err := NewWebhookDestination(internal.DestinationConfig{
+				ExtraJSON: json.RawMessage(`{"URL":"` + tt.url + `"}`)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = dest.ForSet(json.RawMessage(tt.setJSON))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ForSet() error = %v, want one about %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := dest.(*Webhook).WebhookSyncSet.URL; got != tt.wantURL {
+				t.Errorf("URL = %s, want %s", got, tt.wantURL)
+			}
+		})
+	}
+}
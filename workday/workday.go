@@ -0,0 +1,362 @@
+package workday
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+const (
+	FormatJSON = "json"
+	FormatXML  = "xml"
+
+	// reportEntry is the name of the element or field holding each row of a report
+	reportEntry = "Report_Entry"
+)
+
+// Workday is a source for Workday Report-as-a-Service (RaaS) custom reports, authenticated as an Integration
+// System User (ISU)
+type Workday struct {
+	// BaseURL is the Workday services host, e.g. https://wd2-impl-services1.workday.com
+	BaseURL string
+
+	// Username and Password are the ISU credentials, with the username in the form ISU_User@tenant
+	Username string
+	Password string
+
+	// Format of the report to request, json (the default) or xml
+	Format string
+
+	CompareAttribute string
+
+	// EffectiveDateAttribute is a report field holding the date each row takes effect. Rows that take effect in the
+	// future are ignored, and if a worker has several rows, the one most recently in effect is used.
+	EffectiveDateAttribute string
+
+	// EffectiveAsOfParameter is the name of a report prompt, such as Effective_as_of_Date, that is set to the
+	// current date
+	EffectiveAsOfParameter string
+
+	Retry internal.RetryConfig
+
+	// Proxy is a SOCKS5 proxy for report requests
+	Proxy internal.ProxyConfig
+
+	setConfig SetConfig
+	clock     internal.Clock
+}
+
+// SetConfig selects the report for a sync set
+type SetConfig struct {
+	// ReportPath is the path of the report, e.g. /ccx/service/customreport2/tenant/ISU_User/All_Workers
+	ReportPath string
+
+	// Parameters are report prompts added to the request
+	Parameters map[string]string
+}
+
+func init() {
+	internal.RegisterSource(internal.SourceTypeWorkday, NewWorkdaySource)
+
+	internal.DescribeSource(internal.SourceTypeWorkday, internal.AdapterConfig{
+		ExtraJSON: []interface{}{Workday{}},
+		SyncSet:   SetConfig{},
+	})
+}
+
+// NewWorkdaySource unmarshals the sourceConfig's ExtraJSON into a Workday struct
+func NewWorkdaySource(sourceConfig internal.SourceConfig) (internal.Source, error) {
+	var workday Workday
+	if err := json.Unmarshal(sourceConfig.ExtraJSON, &workday); err != nil {
+		return &Workday{}, err
+	}
+
+	if workday.BaseURL == "" {
+		return &Workday{}, errors.New("BaseURL is required for the Workday source")
+	}
+	if workday.CompareAttribute == "" {
+		return &Workday{}, errors.New("CompareAttribute is required for the Workday source")
+	}
+
+	switch workday.Format {
+	case "":
+		workday.Format = FormatJSON
+	case FormatJSON, FormatXML:
+	default:
+		return &Workday{}, fmt.Errorf("invalid Workday Format %q, must be json or xml", workday.Format)
+	}
+
+	if err := workday.Proxy.Validate(); err != nil {
+		return &Workday{}, err
+	}
+
+	workday.clock = internal.SystemClock
+	return &workday, nil
+}
+
+func (w *Workday) ForSet(syncSetJson json.RawMessage) error {
+	var setConfig SetConfig
+	if err := json.Unmarshal(syncSetJson, &setConfig); err != nil {
+		return err
+	}
+
+	if setConfig.ReportPath == "" {
+		return errors.New("ReportPath is empty in sync set")
+	}
+	if !strings.HasPrefix(setConfig.ReportPath, "/") {
+		setConfig.ReportPath = "/" + setConfig.ReportPath
+	}
+
+	w.setConfig = setConfig
+	return nil
+}
+
+// ListUsers requests the report and returns a Person for each worker in it
+func (w *Workday) ListUsers(desiredAttrs []string) ([]internal.Person, error) {
+	body, err := w.getReport()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []map[string]string
+	if w.Format == FormatXML {
+		entries, err = parseXMLReport(body)
+	} else {
+		entries, err = parseJSONReport(body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse Workday report %s: %s", w.setConfig.ReportPath, err)
+	}
+
+	if w.EffectiveDateAttribute != "" {
+		entries = effectiveEntries(entries, w.CompareAttribute, w.EffectiveDateAttribute, w.clock.Now())
+	}
+
+	var people []internal.Person
+	for _, entry := range entries {
+		compareValue := entry[w.CompareAttribute]
+		if compareValue == "" {
+			continue
+		}
+
+		person := internal.Person{
+			CompareValue: compareValue,
+			Attributes:   map[string]string{},
+		}
+		for _, attr := range desiredAttrs {
+			if value, ok := entry[attr]; ok {
+				person.Attributes[attr] = value
+			}
+		}
+		people = append(people, person)
+	}
+
+	return people, nil
+}
+
+func (w *Workday) getReport() ([]byte, error) {
+	params := url.Values{}
+	for name, value := range w.setConfig.Parameters {
+		params.Set(name, value)
+	}
+	if w.EffectiveAsOfParameter != "" {
+		params.Set(w.EffectiveAsOfParameter, w.clock.Now().Format("2006-01-02"))
+	}
+	if w.Format == FormatJSON {
+		params.Set("format", "json")
+	}
+
+	reportURL := strings.TrimSuffix(w.BaseURL, "/") + w.setConfig.ReportPath
+	if len(params) > 0 {
+		reportURL += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, reportURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(w.Username, w.Password)
+
+	client, err := w.Proxy.Client(5 * time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := w.Retry.Do(client, req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting Workday report %s: %s", w.setConfig.ReportPath, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Workday report %s: %s", w.setConfig.ReportPath, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Workday report %s returned %s: %s", w.setConfig.ReportPath, resp.Status, body)
+	}
+	return body, nil
+}
+
+// parseJSONReport returns the fields of each Report_Entry. Nested fields are named by their path, such as
+// Worker.Email, and only the first value of a multi-instance field is used.
+func parseJSONReport(body []byte) ([]map[string]string, error) {
+	var report map[string][]map[string]interface{}
+	if err := json.Unmarshal(body, &report); err != nil {
+		return nil, err
+	}
+
+	entries := make([]map[string]string, 0, len(report[reportEntry]))
+	for _, row := range report[reportEntry] {
+		entry := map[string]string{}
+		for name, value := range row {
+			flattenJSONField(entry, name, value)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func flattenJSONField(entry map[string]string, name string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			flattenJSONField(entry, name+"."+key, child)
+		}
+	case []interface{}:
+		if len(v) > 0 {
+			flattenJSONField(entry, name, v[0])
+		}
+	case nil:
+	default:
+		if _, ok := entry[name]; !ok {
+			entry[name] = fmt.Sprintf("%v", v)
+		}
+	}
+}
+
+// parseXMLReport returns the fields of each Report_Entry, ignoring namespaces. Nested fields are named by their
+// path, such as Worker.Email. A reference field without text uses its Descriptor attribute, and an ID element is
+// named by its type attribute, e.g. Worker.Employee_ID. Only the first value of a multi-instance field is used.
+func parseXMLReport(body []byte) ([]map[string]string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+
+	var entries []map[string]string
+	var entry map[string]string
+	var path []string
+	var text strings.Builder
+	var descriptors []string
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if entry == nil {
+				if t.Name.Local == reportEntry {
+					entry = map[string]string{}
+					path = nil
+				}
+				continue
+			}
+
+			name := t.Name.Local
+			descriptor := ""
+			for _, attr := range t.Attr {
+				switch attr.Name.Local {
+				case "type":
+					if name == "ID" {
+						name = attr.Value
+					}
+				case "Descriptor":
+					descriptor = attr.Value
+				}
+			}
+			path = append(path, name)
+			descriptors = append(descriptors, descriptor)
+			text.Reset()
+
+		case xml.CharData:
+			if entry != nil {
+				text.Write(t)
+			}
+
+		case xml.EndElement:
+			if entry == nil {
+				continue
+			}
+			if len(path) == 0 {
+				entries = append(entries, entry)
+				entry = nil
+				continue
+			}
+
+			name := strings.Join(path, ".")
+			value := strings.TrimSpace(text.String())
+			if value == "" {
+				value = descriptors[len(descriptors)-1]
+			}
+			if _, ok := entry[name]; !ok && value != "" {
+				entry[name] = value
+			}
+			path = path[:len(path)-1]
+			descriptors = descriptors[:len(descriptors)-1]
+			text.Reset()
+		}
+	}
+
+	return entries, nil
+}
+
+// effectiveEntries removes the entries that take effect after now and, of the entries with the same compare
+// value, keeps only the one that took effect most recently. Entries without an effective date are always kept.
+func effectiveEntries(entries []map[string]string, compareAttr, dateAttr string,
+	now time.Time) []map[string]string {
+
+	today := now.Format("2006-01-02")
+	latest := map[string]int{}
+	var kept []map[string]string
+
+	for _, entry := range entries {
+		date := effectiveDate(entry[dateAttr])
+		if date > today {
+			continue
+		}
+
+		key := strings.ToLower(entry[compareAttr])
+		if i, ok := latest[key]; ok && key != "" {
+			if date >= effectiveDate(kept[i][dateAttr]) {
+				kept[i] = entry
+			}
+			continue
+		}
+		latest[key] = len(kept)
+		kept = append(kept, entry)
+	}
+
+	return kept
+}
+
+// effectiveDate returns the date part of a Workday date, which may include a time or a UTC offset, such as
+// 2020-01-15-08:00
+func effectiveDate(value string) string {
+	if len(value) > 10 {
+		return value[:10]
+	}
+	return value
+}
@@ -0,0 +1,186 @@
+package workday
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/silinternational/personnel-sync/v5/internal"
+)
+
+const jsonReport = `{
+  "Report_Entry": [
+    {
+      "Employee_ID": "10011",
+      "Email": "donald_duck@acme.com",
+      "Effective_Date": "2020-01-01",
+      "Job_Title": "Clerk",
+      "Manager": {"Descriptor": "Mickey Mouse", "Email": "mickey_mouse@acme.com"},
+      "Phones": [{"Number": "555-1212"}, {"Number": "555-3434"}]
+    },
+    {
+      "Employee_ID": "10011",
+      "Email": "donald_duck@acme.com",
+      "Effective_Date": "2020-03-01",
+      "Job_Title": "Manager"
+    },
+    {
+      "Employee_ID": "10011",
+      "Email": "donald_duck@acme.com",
+      "Effective_Date": "2021-01-01",
+      "Job_Title": "Director"
+    },
+    {
+      "Employee_ID": "10012",
+      "Email": "daisy_duck@acme.com"
+    }
+  ]
+}`
+
+const xmlReport = `<?xml version='1.0' encoding='UTF-8'?>
+<wd:Report_Data xmlns:wd="urn:com.workday.report/All_Workers">
+  <wd:Report_Entry>
+    <wd:Worker wd:Descriptor="Donald Duck">
+      <wd:ID wd:type="WID">3aa5550b7fe348b98d7b5741afc65534</wd:ID>
+      <wd:ID wd:type="Employee_ID">10011</wd:ID>
+    </wd:Worker>
+    <wd:Email>donald_duck@acme.com</wd:Email>
+    <wd:Effective_Date>2020-03-01-08:00</wd:Effective_Date>
+    <wd:Location wd:Descriptor="Orlando"/>
+    <wd:Phones><wd:Number>555-1212</wd:Number></wd:Phones>
+    <wd:Phones><wd:Number>555-3434</wd:Number></wd:Phones>
+  </wd:Report_Entry>
+  <wd:Report_Entry>
+    <wd:Worker wd:Descriptor="Daisy Duck"/>
+    <wd:Email>daisy_duck@acme.com</wd:Email>
+  </wd:Report_Entry>
+</wd:Report_Data>`
+
+func TestWorkday_ListUsers(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, pass, _ := req.BasicAuth()
+		if user != "ISU_Sync@acme" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		query = req.URL.RawQuery
+		if req.URL.Query().Get("format") == "json" {
+			_, _ = io.WriteString(w, jsonReport)
+		} else {
+			_, _ = io.WriteString(w, xmlReport)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		extraJSON string
+		attrs     []string
+		wantQuery string
+		want      []internal.Person
+	}{
+		{
+			name: "json, effective dated",
+			extraJSON: `{"Format": "json", "CompareAttribute": "Email", "EffectiveDateAttribute": "Effective_Date",
+				"EffectiveAsOfParameter": "Effective_as_of_Date"}`,
+			attrs:     []string{"Email", "Job_Title", "Manager.Email", "Phones.Number"},
+			wantQuery: "Effective_as_of_Date=2020-06-15&Organization=Ducks&format=json",
+			want: []internal.Person{
+				{
+					CompareValue: "donald_duck@acme.com",
+					Attributes:   map[string]string{"Email": "donald_duck@acme.com", "Job_Title": "Manager"},
+				},
+				{
+					CompareValue: "daisy_duck@acme.com",
+					Attributes:   map[string]string{"Email": "daisy_duck@acme.com"},
+				},
+			},
+		},
+		{
+			name:      "json, all rows",
+			extraJSON: `{"CompareAttribute": "Employee_ID"}`,
+			attrs:     []string{"Job_Title", "Manager.Email", "Phones.Number"},
+			wantQuery: "Organization=Ducks&format=json",
+			want: []internal.Person{
+				{
+					CompareValue: "10011",
+					Attributes: map[string]string{
+						"Job_Title":     "Clerk",
+						"Manager.Email": "mickey_mouse@acme.com",
+						"Phones.Number": "555-1212",
+					},
+				},
+				{CompareValue: "10011", Attributes: map[string]string{"Job_Title": "Manager"}},
+				{CompareValue: "10011", Attributes: map[string]string{"Job_Title": "Director"}},
+				{CompareValue: "10012", Attributes: map[string]string{}},
+			},
+		},
+		{
+			name: "xml",
+			extraJSON: `{"Format": "xml", "CompareAttribute": "Email",
+				"EffectiveDateAttribute": "Effective_Date"}`,
+			attrs:     []string{"Worker", "Worker.Employee_ID", "Location", "Phones.Number"},
+			wantQuery: "Organization=Ducks",
+			want: []internal.Person{
+				{
+					CompareValue: "donald_duck@acme.com",
+					Attributes: map[string]string{
+						"Worker":             "Donald Duck",
+						"Worker.Employee_ID": "10011",
+						"Location":           "Orlando",
+						"Phones.Number":      "555-1212",
+					},
+				},
+				{
+					CompareValue: "daisy_duck@acme.com",
+					Attributes:   map[string]string{"Worker": "Daisy Duck"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extraJSON := `{"BaseURL": "` + server.URL + `", "Username": "ISU_Sync@acme", "Password": "secret", ` +
+				tt.extraJSON[1:]
+			source, err := NewWorkdaySource(internal.SourceConfig{ExtraJSON: []byte(extraJSON)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := source.(*Workday)
+			w.clock = internal.NewFakeClock(time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC))
+
+			setJSON := `{"ReportPath": "ccx/service/customreport2/acme/ISU_Sync/All_Workers",
+				"Parameters": {"Organization": "Ducks"}}`
+			if err := w.ForSet([]byte(setJSON)); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := w.ListUsers(tt.attrs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query != tt.wantQuery {
+				t.Errorf("query = %s, want %s", query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListUsers() = %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewWorkdaySource_Invalid(t *testing.T) {
+	for _, extraJSON := range []string{
+		`{"CompareAttribute": "Email"}`,
+		`{"BaseURL": "https://example.com"}`,
+		`{"BaseURL": "https://example.com", "CompareAttribute": "Email", "Format": "csv"}`,
+	} {
+		if _, err := NewWorkdaySource(internal.SourceConfig{ExtraJSON: []byte(extraJSON)}); err == nil {
+			t.Errorf("NewWorkdaySource(%s) should fail", extraJSON)
+		}
+	}
+}